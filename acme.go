@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caiyeon/goldfish/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// certificates are renewed when they have less than this left
+	acmeRenewBefore = 30 * 24 * time.Hour
+	// how often the certificate's expiry is checked, and failed attempts retried
+	acmeCheckInterval = 12 * time.Hour
+	acmeRetryInterval = time.Hour
+	// how long the dns hook may take, including waiting for the record to propagate
+	acmeHookTimeout = 10 * time.Minute
+)
+
+// true if the listener gets its certificates from an ACME CA, as it has no certificate files
+func acmeListener(listener *config.ListenerConfig) bool {
+	return !listener.Tls_disable && listener.Tls_pki_path == "" &&
+		listener.Tls_cert_file == "" && listener.Tls_key_file == ""
+}
+
+// true if the CA checks the listener's hostnames on port 80, which goldfish must answer
+func acmeHTTPChallenge(listener *config.ListenerConfig) bool {
+	return acmeListener(listener) && listener.Acme != nil && listener.Acme.Challenge == "http-01"
+}
+
+// the GetCertificate of a listener that gets its certificates from an ACME CA, and the handler
+// that answers http-01 challenges on port 80, nil unless the acme block uses them
+func acmeCertificates(listener *config.ListenerConfig, manager *autocert.Manager) (func(*tls.ClientHelloInfo) (*tls.Certificate, error), http.Handler) {
+	cfg := listener.Acme
+	if cfg == nil {
+		// without an acme block, autocert gets certificates for the listener's address
+		manager.Cache = autocert.DirCache("/var/www/.cache")
+		manager.HostPolicy = autocert.HostWhitelist(listener.Address)
+		return manager.GetCertificate, nil
+	}
+
+	directory := cfg.Directory_url
+	if directory == "" {
+		directory = acme.LetsEncryptURL
+	}
+	m := &acmeCertManager{
+		hostnames: cfg.Hostnames,
+		challenge: cfg.Challenge,
+		hook:      cfg.Dns_hook,
+		email:     cfg.Email,
+		directory: directory,
+		cache:     autocert.DirCache(cfg.Cache_dir),
+		responses: map[string]string{},
+	}
+	go m.maintain()
+	if m.challenge == "http-01" {
+		return m.GetCertificate, m
+	}
+	return m.GetCertificate, nil
+}
+
+// obtains one certificate for all hostnames, and renews it before it expires. The CA checks
+// an http-01 response on port 80, or a dns-01 TXT record, which needs no port reachable from it
+type acmeCertManager struct {
+	hostnames []string
+	challenge string
+	hook      string
+	email     string
+	directory string
+	cache     autocert.Cache
+
+	lock sync.RWMutex
+	cert *tls.Certificate
+	// http-01 responses being checked by the CA, by their path
+	responses map[string]string
+}
+
+func (m *acmeCertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if m.cert == nil {
+		return nil, errors.New("No certificate has been obtained yet")
+	}
+	return m.cert, nil
+}
+
+// the cache entry of the certificate, alongside autocert's own entries
+func (m *acmeCertManager) cacheKey() string {
+	return m.challenge + "+" + m.hostnames[0]
+}
+
+func (m *acmeCertManager) maintain() {
+	ctx := context.Background()
+	if cert, err := m.cached(ctx); err == nil {
+		m.set(cert)
+	}
+	for {
+		wait := acmeCheckInterval
+		if m.expiring(time.Now()) {
+			log.Println("[INFO ]: Obtaining a certificate for", strings.Join(m.hostnames, ", "))
+			if cert, err := m.obtain(ctx); err != nil {
+				log.Println("[ERROR]: Could not obtain a certificate:", err)
+				wait = acmeRetryInterval
+			} else {
+				m.set(cert)
+			}
+		}
+		time.Sleep(wait)
+	}
+}
+
+func (m *acmeCertManager) set(cert *tls.Certificate) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.cert = cert
+}
+
+// true if there is no certificate, or it should be renewed
+func (m *acmeCertManager) expiring(now time.Time) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.cert == nil || m.cert.Leaf.NotAfter.Sub(now) < acmeRenewBefore
+}
+
+// the cached certificate, if it is still for the configured hostnames
+func (m *acmeCertManager) cached(ctx context.Context) (*tls.Certificate, error) {
+	data, err := m.cache.Get(ctx, m.cacheKey())
+	if err != nil {
+		return nil, err
+	}
+	// the entry holds the key and the chain, as autocert stores them
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, err
+	}
+	for _, hostname := range m.hostnames {
+		if err := cert.Leaf.VerifyHostname(hostname); err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+func (m *acmeCertManager) obtain(ctx context.Context) (*tls.Certificate, error) {
+	client, err := m.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, hostname := range m.hostnames {
+		if err := m.authorize(ctx, client, hostname); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.hostnames[0]},
+		DNSNames: m.hostnames,
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	der, _, err := client.CreateCert(ctx, csr, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := pemKey(&buf, key); err != nil {
+		return nil, err
+	}
+	for _, b := range der {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: b})
+	}
+	if err := m.cache.Put(ctx, m.cacheKey(), buf.Bytes()); err != nil {
+		log.Println("[ERROR]: Could not cache the certificate:", err)
+	}
+	return &tls.Certificate{Certificate: der, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// a registered client, with the account key autocert keeps in the same cache
+func (m *acmeCertManager) client(ctx context.Context) (*acme.Client, error) {
+	key, err := m.accountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{DirectoryURL: m.directory, Key: key}
+	account := &acme.Account{}
+	if m.email != "" {
+		account.Contact = []string{"mailto:" + m.email}
+	}
+	_, err = client.Register(ctx, account, acme.AcceptTOS)
+	// a conflict means the key is already registered
+	if e, ok := err.(*acme.Error); ok && e.StatusCode == http.StatusConflict {
+		err = nil
+	}
+	return client, err
+}
+
+func (m *acmeCertManager) accountKey(ctx context.Context) (crypto.Signer, error) {
+	const name = "acme_account.key"
+	data, err := m.cache.Get(ctx, name)
+	if err == autocert.ErrCacheMiss {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := pemKey(&buf, key); err != nil {
+			return nil, err
+		}
+		return key, m.cache.Put(ctx, name, buf.Bytes())
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("Invalid ACME account key in the cache")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// proves control of the hostname with an http-01 response, or a TXT record, which the dns hook
+// presents and cleans up
+func (m *acmeCertManager) authorize(ctx context.Context, client *acme.Client, hostname string) error {
+	authz, err := client.Authorize(ctx, hostname)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == m.challenge {
+			challenge = c
+		}
+	}
+	if challenge == nil {
+		return errors.New("The CA offered no " + m.challenge + " challenge for " + hostname)
+	}
+
+	if m.challenge == "http-01" {
+		response, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return err
+		}
+		path := client.HTTP01ChallengePath(challenge.Token)
+		m.setResponse(path, response)
+		defer m.setResponse(path, "")
+	} else {
+		record, err := client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return err
+		}
+
+		name := "_acme-challenge." + hostname
+		if err := m.runHook(ctx, "present", name, record); err != nil {
+			return err
+		}
+		defer func() {
+			if err := m.runHook(ctx, "cleanup", name, record); err != nil {
+				log.Println("[ERROR]: Could not clean up the challenge record of", hostname+":", err)
+			}
+		}()
+	}
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return err
+	}
+	_, err = client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// an empty response stops answering the path
+func (m *acmeCertManager) setResponse(path, response string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if response == "" {
+		delete(m.responses, path)
+	} else {
+		m.responses[path] = response
+	}
+}
+
+// answers http-01 challenges on port 80, and redirects everything else to https
+func (m *acmeCertManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.lock.RLock()
+	response, ok := m.responses[r.URL.Path]
+	m.lock.RUnlock()
+	if !ok {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(response))
+}
+
+// runs the dns hook as: hook present|cleanup _acme-challenge.<hostname> <value>
+func (m *acmeCertManager) runHook(ctx context.Context, action, name, value string) error {
+	ctx, cancel := context.WithTimeout(ctx, acmeHookTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, m.hook, action, name, value).CombinedOutput()
+	if err != nil {
+		return errors.New("dns_hook " + action + " failed: " + err.Error() + ": " + strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func pemKey(buf *bytes.Buffer, key *ecdsa.PrivateKey) error {
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return pem.Encode(buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+}
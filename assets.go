@@ -0,0 +1,38 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo"
+)
+
+// the webpack'd frontend, built into public/ before compiling goldfish
+// the placeholder in public/ keeps goldfish compiling before the frontend has been built
+//
+//go:embed all:public
+var embeddedAssets embed.FS
+
+// serves the frontend from the binary, or from assetsDir if it is set
+// serving from disk picks up a rebuilt frontend without recompiling goldfish
+func serveAssets(e *echo.Echo, assetsDir string) {
+	if assetsDir != "" {
+		if _, err := os.Stat(assetsDir); err != nil {
+			log.Fatalln("[ERROR]: Could not serve assets:", err.Error())
+		}
+		e.Static("/", assetsDir)
+		return
+	}
+
+	public, err := fs.Sub(embeddedAssets, "public")
+	if err != nil {
+		log.Fatalln("[ERROR]: Could not serve assets:", err.Error())
+	}
+	if _, err := fs.Stat(public, "index.html"); err != nil {
+		log.Println("[WARN ]: This binary was built without the frontend, build it with 'npm run build' and rebuild goldfish")
+	}
+	e.GET("/*", echo.WrapHandler(http.FileServer(http.FS(public))))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/caiyeon/goldfish/audit"
+	"github.com/caiyeon/goldfish/config"
+	"github.com/caiyeon/goldfish/vault"
+)
+
+// opens the configured audit sinks. A sink that can't be opened stops goldfish from
+// starting, rather than leaving actions unrecorded
+func startAudit(sinks []*config.AuditConfig) error {
+	for _, a := range sinks {
+		var sink audit.Sink
+		var err error
+		switch a.Type {
+		case "file":
+			sink, err = audit.NewFileSink(a.Path)
+		case "syslog":
+			sink, err = audit.NewSyslogSink(a.Tag)
+		case "vault":
+			sink, err = vault.NewAuditKVSink(a.Path)
+		}
+		if err != nil {
+			return err
+		}
+		audit.AddSink(a.Type+" "+a.Path, sink)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Package audit records goldfish's state-changing actions to sinks of its own, such as an
+// append-only file, independently of the audit devices vault keeps for its requests
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// a state-changing request to goldfish, and how it turned out
+type Event struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	// display name of the session's token, empty if there was no session, e.g. when logging in
+	User     string `json:"user"`
+	RemoteIP string `json:"remote_ip"`
+	Method   string `json:"method"`
+	// the route, e.g. /api/policy/request/:id
+	Endpoint string `json:"endpoint"`
+	// route parameters, and the vault paths given as form values
+	Params map[string]string `json:"params"`
+	// why the user took a destructive action, for the endpoints that require one
+	Reason string `json:"reason,omitempty"`
+	Status int    `json:"status"`
+	// success or failure, from the status
+	Result string `json:"result"`
+}
+
+// somewhere events are written to
+type Sink interface {
+	Write(Event) error
+}
+
+type namedSink struct {
+	name string
+	sink Sink
+}
+
+var (
+	sinksLock = sync.RWMutex{}
+	sinks     = []namedSink{}
+)
+
+// adds a sink every event is written to. The name identifies it in error logs
+func AddSink(name string, sink Sink) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	sinks = append(sinks, namedSink{name, sink})
+}
+
+// true if any sink is configured, so callers can skip building events nobody records
+func Enabled() bool {
+	sinksLock.RLock()
+	defer sinksLock.RUnlock()
+	return len(sinks) > 0
+}
+
+// writes the event to every sink. The action has already happened, so a sink that fails
+// is logged rather than failing the request
+func Record(e Event) {
+	if e.Result == "" {
+		e.Result = "success"
+		if e.Status >= 400 {
+			e.Result = "failure"
+		}
+	}
+	sinksLock.RLock()
+	defer sinksLock.RUnlock()
+	for _, s := range sinks {
+		if err := s.sink.Write(e); err != nil {
+			log.Println("[ERROR]: Could not write audit event to", s.name+":", err.Error())
+		}
+	}
+}
+
+// appends one json line per event to a file
+type FileSink struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// the file is created if needed, and only ever appended to
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: f}, nil
+}
+
+func (s *FileSink) Write(e Event) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.file.Write(append(raw, '\n'))
+	return err
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type memorySink struct {
+	events []Event
+	err    error
+}
+
+func (s *memorySink) Write(e Event) error {
+	s.events = append(s.events, e)
+	return s.err
+}
+
+func TestRecord(t *testing.T) {
+	Convey("Events should reach every sink, with their result", t, func(c C) {
+		first, second := &memorySink{err: errors.New("unavailable")}, &memorySink{}
+		sinks = []namedSink{}
+		AddSink("first", first)
+		AddSink("second", second)
+		defer func() { sinks = []namedSink{} }()
+
+		c.So(Enabled(), ShouldBeTrue)
+		Record(Event{Endpoint: "/api/policy", Status: 200})
+		Record(Event{Endpoint: "/api/policy", Status: 403})
+		c.So(first.events, ShouldHaveLength, 2)
+		c.So(second.events, ShouldHaveLength, 2)
+		c.So(second.events[0].Result, ShouldEqual, "success")
+		c.So(second.events[1].Result, ShouldEqual, "failure")
+	})
+}
+
+func TestFileSink(t *testing.T) {
+	Convey("File sinks should append one json line per event", t, func(c C) {
+		dir, err := ioutil.TempDir("", "goldfish-audit")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "audit.log")
+		c.So(ioutil.WriteFile(path, []byte("{}\n"), 0600), ShouldBeNil)
+
+		sink, err := NewFileSink(path)
+		c.So(err, ShouldBeNil)
+		c.So(sink.Write(Event{Time: time.Now(), User: "alice", Method: "DELETE", Endpoint: "/api/policy"}), ShouldBeNil)
+
+		raw, err := ioutil.ReadFile(path)
+		c.So(err, ShouldBeNil)
+		lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+		c.So(lines, ShouldHaveLength, 2)
+		var e Event
+		c.So(json.Unmarshal([]byte(lines[1]), &e), ShouldBeNil)
+		c.So(e.User, ShouldEqual, "alice")
+		c.So(e.Method, ShouldEqual, "DELETE")
+	})
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package audit
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// sends each event as json to the local syslog daemon, on the auth facility
+type SyslogSink struct {
+	writer *syslog.Writer
+}
+
+func NewSyslogSink(tag string) (*SyslogSink, error) {
+	w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{writer: w}, nil
+}
+
+func (s *SyslogSink) Write(e Event) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.writer.Notice(string(raw))
+}
@@ -0,0 +1,13 @@
+package audit
+
+import "errors"
+
+type SyslogSink struct{}
+
+func NewSyslogSink(tag string) (*SyslogSink, error) {
+	return nil, errors.New("syslog is not available on windows")
+}
+
+func (s *SyslogSink) Write(e Event) error {
+	return errors.New("syslog is not available on windows")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/caiyeon/goldfish/config"
+	"github.com/caiyeon/goldfish/vault"
+)
+
+// registers the configured clusters. Their server tokens are taken over from the previous
+// process on an upgrade, as the wrapping tokens in their files can only be used once
+func startClusters(clusters []*config.ClusterConfig, handover *handoverState) error {
+	for _, c := range clusters {
+		if err := vault.AddCluster(c.Name, c.Address, c.Tls_skip_verify); err != nil {
+			return err
+		}
+		if handover != nil {
+			if token, ok := handover.ClusterTokens[c.Name]; ok {
+				if err := vault.ResumeClusterWrapper(c.Name, token); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if c.Wrapping_token_file == "" {
+			continue
+		}
+		raw, err := ioutil.ReadFile(c.Wrapping_token_file)
+		if err != nil {
+			return err
+		}
+		if err := vault.StartClusterWrapper(c.Name, strings.TrimSpace(string(raw)), c.Approle_login, c.Approle_id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
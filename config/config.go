@@ -5,17 +5,27 @@ import (
 	"fmt"
 	"errors"
 	"strings"
+	"net"
 	"net/url"
+	"os"
+	"strconv"
+	"time"
 
+	"github.com/caiyeon/goldfish/logging"
+	"github.com/caiyeon/goldfish/tracing"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
 )
 
-var ch = make(chan error)
-
 type Config struct {
-	Listener *ListenerConfig `hcl:"-"`
-	Vault    *VaultConfig    `hcl:"-"`
+	Listener    *ListenerConfig    `hcl:"-"`
+	Vault       *VaultConfig       `hcl:"-"`
+	Coordinator *CoordinatorConfig `hcl:"-"`
+	Clusters    []*ClusterConfig   `hcl:"-"`
+	Log         *LogConfig         `hcl:"-"`
+	Audit       []*AuditConfig     `hcl:"-"`
+	Tracing     *TracingConfig     `hcl:"-"`
+	LoginLimit  *LoginLimitConfig  `hcl:"-"`
 }
 
 type ListenerConfig struct {
@@ -25,8 +35,91 @@ type ListenerConfig struct {
 	Tls_cert_file    string
 	Tls_key_file     string
 	Tls_autoredirect bool
+	// if set, the certificate is issued by this vault PKI role, e.g. "pki/issue/goldfish",
+	// instead of being read from files, and renewed before it expires
+	Tls_pki_path        string
+	Tls_pki_common_name string
+	Tls_pki_alt_names   []string
+	Tls_pki_ttl         string
+	// if set, /metrics is served over plain http on this address instead of the listener
+	Metrics_address  string
+	// how long in-flight requests may take to finish when goldfish shuts down
+	Shutdown_timeout time.Duration
+	// limits on each connection, so slow or idle clients can't tie up the server. 0 is no limit
+	Read_header_timeout time.Duration
+	Read_timeout        time.Duration
+	Write_timeout       time.Duration
+	Idle_timeout        time.Duration
+	Max_header_bytes    int
+	// whether https connections may negotiate HTTP/2
+	Http2               bool
+	// permissions of the socket file, when Address is a unix socket. 0 leaves them to the umask
+	Socket_mode      os.FileMode
+	// comma separated addresses and CIDRs of reverse proxies whose X-Forwarded-* headers are believed
+	Trusted_proxies  string
+	// the URL prefix goldfish is served under, e.g. "/goldfish". Empty when served at the root
+	Base_path        string
+	// comma separated addresses and CIDRs that clients must, or must not, connect from.
+	// The admin lists additionally apply to the admin endpoints, see vault.AdminRoute
+	Allowed_networks       string
+	Denied_networks        string
+	Admin_allowed_networks string
+	Admin_denied_networks  string
+	// lets browsers on other origins call the api. nil unless a cors block is configured
+	Cors             *CORSConfig
+	// security headers sent with every response
+	Headers          *HeadersConfig
+	// gzips responses for clients that accept it. nil unless a compression block is configured
+	Compression      *CompressionConfig
+	// how certificates are obtained when tls is on without certificate files. nil otherwise,
+	// or if no acme block is configured
+	Acme             *AcmeConfig
+}
+
+// certificates for Hostnames are obtained from an ACME CA such as Let's Encrypt, and kept
+// in Cache_dir. The CA validates each hostname with an http-01 challenge answered on port 80,
+// or a dns-01 challenge, whose TXT record Dns_hook is run to present and clean up
+type AcmeConfig struct {
+	Hostnames     []string
+	Cache_dir     string
+	Email         string
+	Challenge     string
+	Dns_hook      string
+	Directory_url string
+}
+
+// an empty header value leaves that header out. HSTS is only sent over https
+type HeadersConfig struct {
+	Content_security_policy string
+	Frame_options           string
+	Referrer_policy         string
+	Hsts_max_age            int
+	Hsts_include_subdomains bool
+}
+
+func defaultHeaders() *HeadersConfig {
+	return &HeadersConfig{
+		Content_security_policy: "default-src 'self'",
+		Frame_options:           "SAMEORIGIN",
+		Referrer_policy:         "same-origin",
+		Hsts_max_age:            31536000,
+	}
+}
+
+// Level is a gzip level, from 1 (fastest) to 9 (smallest)
+type CompressionConfig struct {
+	Level int
+}
+
+type CORSConfig struct {
+	Allowed_origins   []string
+	Allowed_methods   []string
+	Allow_credentials bool
 }
 
+// unix socket addresses are written as unix:///path/to/goldfish.sock
+const UnixSocketPrefix = "unix://"
+
 type VaultConfig struct {
 	Type            string
 	Address         string
@@ -34,17 +127,108 @@ type VaultConfig struct {
 	Runtime_config  string
 	Approle_login   string
 	Approle_id      string
+	// keeps the unwrapped secret_id, to log in again once the server token can't be renewed
+	Approle_relogin bool
+	// how goldfish logs in for its server token: approle with the wrapped secret_id given with
+	// -token, or kubernetes or aws, which need nothing passed in at startup
+	Auth_method         string
+	Kubernetes_login    string
+	Kubernetes_role     string
+	Kubernetes_jwt_file string
+	Aws_login           string
+	Aws_role            string
+	Aws_header_value    string
+	// with auth_method token_file, goldfish uses the token in this file, e.g. vault agent's sink
+	Token_file          string
+	Startup_retries        int
+	Startup_retry_interval time.Duration
+	// how often the runtime config is re-read from vault
+	Runtime_config_interval time.Duration
+}
+
+// replicas forward state mutations to the coordinator at Address,
+// and the coordinator accepts them on Listen. Both sides authenticate with mTLS
+type CoordinatorConfig struct {
+	Address       string
+	Listen        string
+	Tls_cert_file string
+	Tls_key_file  string
+	Tls_ca_file   string
+}
+
+// another vault cluster that sessions may choose at login. Goldfish logs in to it with an
+// approle if Wrapping_token_file holds a wrapped secret_id, like the one given with -token
+type ClusterConfig struct {
+	Name                string
+	Address             string
+	Tls_skip_verify     bool
+	Approle_login       string
+	Approle_id          string
+	Wrapping_token_file string
+}
+
+// how goldfish logs. Json lines suit log shippers, and lines below Level are dropped
+type LogConfig struct {
+	Format string
+	Level  string
+}
+
+// where goldfish records its state-changing actions: a file or vault path at Path, or syslog
+type AuditConfig struct {
+	Type string
+	Path string
+	Tag  string
+}
+
+// spans are exported to an OpenTelemetry collector's OTLP/HTTP Endpoint
+type TracingConfig struct {
+	Endpoint     string
+	Service_name string
+	Sample_ratio float64
 }
 
-func LoadConfigFile(path string) (*Config, error) {
+// failed logins are slowed down per client IP and per username. Past the allowed attempts,
+// each further failure locks logins out for Backoff, doubling up to Max_lockout.
+// Zero attempts turns that limit off
+type LoginLimitConfig struct {
+	Ip_attempts   int
+	User_attempts int
+	Backoff       time.Duration
+	Max_lockout   time.Duration
+}
+
+func defaultLoginLimit() *LoginLimitConfig {
+	return &LoginLimitConfig{
+		Ip_attempts:   20,
+		User_attempts: 5,
+		Backoff:       time.Second,
+		Max_lockout:   15 * time.Minute,
+	}
+}
+
+// listener limits unless configured otherwise. Reads and writes are generous enough for large
+// transit payloads and raft snapshots, while headers have to arrive promptly
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 5 * time.Minute
+	defaultWriteTimeout      = 5 * time.Minute
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultMaxHeaderBytes    = 1 << 20
+)
+
+// overrides apply on top of the file. Without a file, the whole config can come from overrides
+func LoadConfigFile(path string, overrides []Override) (*Config, error) {
 	if path == "" {
-		return nil, errors.New("[ERROR]: Config file not specified")
+		if len(overrides) == 0 {
+			return nil, errors.New("[ERROR]: Config file not specified")
+		}
+		return ParseConfig("", overrides...)
 	}
 	d, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	return ParseConfig(string(d))
+	return ParseConfig(string(d), overrides...)
 }
 
 func LoadConfigDev() (*Config, chan struct{}, string, error) {
@@ -65,6 +249,14 @@ func LoadConfigDev() (*Config, chan struct{}, string, error) {
 			Type:        "tcp",
 			Address:     "127.0.0.1:8000",
 			Tls_disable: true,
+			Shutdown_timeout: 30 * time.Second,
+			Read_header_timeout: defaultReadHeaderTimeout,
+			Read_timeout:        defaultReadTimeout,
+			Write_timeout:       defaultWriteTimeout,
+			Idle_timeout:        defaultIdleTimeout,
+			Max_header_bytes:    defaultMaxHeaderBytes,
+			Http2:               true,
+			Headers:          defaultHeaders(),
 		},
 		Vault: &VaultConfig{
 			Type:           "vault",
@@ -72,7 +264,16 @@ func LoadConfigDev() (*Config, chan struct{}, string, error) {
 			Runtime_config: "secret/goldfish",
 			Approle_login:  "auth/approle/login",
 			Approle_id:     "goldfish",
+			Auth_method:    "approle",
+			Startup_retries:        10,
+			Startup_retry_interval: 2 * time.Second,
+			Runtime_config_interval: time.Minute,
+		},
+		Log: &LogConfig{
+			Format: logging.FormatText,
+			Level:  "debug",
 		},
+		LoginLimit: defaultLoginLimit(),
 	}
 
 	// generate an approle secret ID
@@ -84,7 +285,7 @@ func LoadConfigDev() (*Config, chan struct{}, string, error) {
 	return &result, shutdownCh, secretID, nil
 }
 
-func ParseConfig(d string) (*Config, error) {
+func ParseConfig(d string, overrides ...Override) (*Config, error) {
 	// parse as hcl
 	obj, err := hcl.Parse(d)
 	if err != nil {
@@ -94,6 +295,11 @@ func ParseConfig(d string) (*Config, error) {
 	result := Config{
 		Listener: &ListenerConfig{},
 		Vault:    &VaultConfig{},
+		Log: &LogConfig{
+			Format: logging.FormatText,
+			Level:  "info",
+		},
+		LoginLimit: defaultLoginLimit(),
 	}
 	if err := hcl.DecodeObject(&result, obj); err != nil {
 		return nil, err
@@ -104,35 +310,89 @@ func ParseConfig(d string) (*Config, error) {
 	if !ok {
 		return nil, errors.New("[ERROR]: Config file doesn't have a root object")
 	}
+	if err := applyOverrides(list, overrides); err != nil {
+		return nil, err
+	}
 
 	// config root object should contain only this set of keys
 	valid := []string{
 		"listener",
 		"vault",
+		"coordinator",
+		"cluster",
+		"log",
+		"audit",
+		"tracing",
+		"login_limit",
 	}
 	if err := checkHCLKeys(list, valid); err != nil {
 		return nil, err
 	}
 
+	// each block is checked even if another is invalid, so every problem is reported at once
+	problems := []string{}
+	parse := func(name string, item *ast.ObjectItem, fn func(*Config, *ast.ObjectItem) error) {
+		if err := fn(&result, item); err != nil {
+			problems = append(problems, fmt.Sprintf("Error parsing '%s' %s: %s", name, position(item), err))
+		}
+	}
+
 	// build each specific config component
 	if object := list.Filter("listener"); len(object.Items) != 1 {
-		return nil, fmt.Errorf("Config requires exactly one 'listener' object")
+		problems = append(problems, "Config requires exactly one 'listener' object")
 	} else {
 		// there should be only one listener to parse
-		if err := parseListener(&result, object.Items[0]); err != nil {
-			return nil, fmt.Errorf("Error parsing 'listener': %s", err)
-		}
+		parse("listener", object.Items[0], parseListener)
 	}
 
 	if object := list.Filter("vault"); len(object.Items) != 1 {
-		return nil, fmt.Errorf("Config requires exactly one 'vault' object")
+		problems = append(problems, "Config requires exactly one 'vault' object")
 	} else {
 		// there should be only one vault to parse
-		if err := parseVault(&result, object.Items[0]); err != nil {
-			return nil, fmt.Errorf("Error parsing 'vault': %s", err)
-		}
+		parse("vault", object.Items[0], parseVault)
 	}
 
+	// coordinator is optional, and only used by multi-replica deployments
+	if object := list.Filter("coordinator"); len(object.Items) > 1 {
+		problems = append(problems, "Config allows at most one 'coordinator' object")
+	} else if len(object.Items) == 1 {
+		parse("coordinator", object.Items[0], parseCoordinator)
+	}
+
+	// clusters are optional, and each needs a unique name
+	for _, object := range list.Filter("cluster").Items {
+		parse("cluster", object, parseCluster)
+	}
+
+	// log is optional, text at info level by default
+	if object := list.Filter("log"); len(object.Items) > 1 {
+		problems = append(problems, "Config allows at most one 'log' object")
+	} else if len(object.Items) == 1 {
+		parse("log", object.Items[0], parseLog)
+	}
+
+	// audit sinks are optional, and any number may be configured
+	for _, object := range list.Filter("audit").Items {
+		parse("audit", object, parseAudit)
+	}
+
+	// tracing is optional, and off unless configured
+	if object := list.Filter("tracing"); len(object.Items) > 1 {
+		problems = append(problems, "Config allows at most one 'tracing' object")
+	} else if len(object.Items) == 1 {
+		parse("tracing", object.Items[0], parseTracing)
+	}
+
+	// login limits are on by default, this only changes their thresholds
+	if object := list.Filter("login_limit"); len(object.Items) > 1 {
+		problems = append(problems, "Config allows at most one 'login_limit' object")
+	} else if len(object.Items) == 1 {
+		parse("login_limit", object.Items[0], parseLoginLimit)
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "\n"))
+	}
 	return &result, nil
 }
 
@@ -152,15 +412,40 @@ func checkHCLKeys(node ast.Node, valid []string) error {
 		validMap[v] = struct{}{}
 	}
 
-	var err error
+	problems := []string{}
+	seen := map[string]bool{}
 	for _, item := range list.Items {
 		key := item.Keys[0].Token.Value().(string)
 		if _, ok := validMap[key]; !ok {
-			err = fmt.Errorf("Invalid key '%s' on line '%d'", key, item.Assign.Line)
-			ch <- err
+			problems = append(problems, fmt.Sprintf("Invalid key '%s' %s", key, position(item)))
+			continue
+		}
+		// blocks are left to whatever parses them, as some may be repeated
+		if _, block := item.Val.(*ast.ObjectType); block {
+			continue
 		}
+		if seen[key] {
+			problems = append(problems, fmt.Sprintf("Duplicate key '%s' %s", key, position(item)))
+		}
+		seen[key] = true
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
 	}
-	return err
+	return nil
+}
+
+// where an item is in the config file. Items set by overrides have no position
+func position(item *ast.ObjectItem) string {
+	line := item.Pos().Line
+	// filtered blocks such as vault {} have no keys left, only their braces
+	if len(item.Keys) == 0 && item.Val != nil {
+		line = item.Val.Pos().Line
+	}
+	if line > 0 {
+		return fmt.Sprintf("on line '%d'", line)
+	}
+	return "set outside the config file"
 }
 
 func parseListener(result *Config, listener *ast.ObjectItem) error {
@@ -175,13 +460,37 @@ func parseListener(result *Config, listener *ast.ObjectItem) error {
 		"tls_cert_file",
 		"tls_key_file",
 		"tls_autoredirect",
+		"tls_pki_path",
+		"tls_pki_common_name",
+		"tls_pki_alt_names",
+		"tls_pki_ttl",
+		"metrics_address",
+		"shutdown_timeout",
+		"read_header_timeout",
+		"read_timeout",
+		"write_timeout",
+		"idle_timeout",
+		"max_header_bytes",
+		"http2",
+		"socket_mode",
+		"trusted_proxies",
+		"base_path",
+		"allowed_networks",
+		"denied_networks",
+		"admin_allowed_networks",
+		"admin_denied_networks",
+		"cors",
+		"headers",
+		"compression",
+		"acme",
 	}
 	if err := checkHCLKeys(listener.Val, valid); err != nil {
 		return fmt.Errorf("listener.%s: %s", key, err.Error())
 	}
 
+	// cors, headers, compression and acme are blocks rather than strings, so they are parsed on their own
 	var m map[string]string
-	if err := hcl.DecodeObject(&m, listener.Val); err != nil {
+	if err := hcl.DecodeObject(&m, withoutBlocks(listener.Val, "cors", "headers", "compression", "acme")); err != nil {
 		return fmt.Errorf("listener.%s: %s", key, err.Error())
 	}
 
@@ -208,6 +517,35 @@ func parseListener(result *Config, listener *ast.ObjectItem) error {
 			return fmt.Errorf("listener.%s: tls_disable can be 0 or 1", key)
 		}
 	}
+	if result.Listener.Tls_disable && (result.Listener.Tls_cert_file != "" || result.Listener.Tls_key_file != "") {
+		return fmt.Errorf("listener.%s: tls_cert_file and tls_key_file conflict with tls_disable", key)
+	}
+	if (result.Listener.Tls_cert_file == "") != (result.Listener.Tls_key_file == "") {
+		return fmt.Errorf("listener.%s: tls_cert_file and tls_key_file must be set together", key)
+	}
+
+	if path, ok := m["tls_pki_path"]; ok && path != "" {
+		if result.Listener.Tls_disable {
+			return fmt.Errorf("listener.%s: tls_pki_path conflicts with tls_disable", key)
+		}
+		if result.Listener.Tls_cert_file != "" || result.Listener.Tls_key_file != "" {
+			return fmt.Errorf("listener.%s: tls_pki_path conflicts with tls_cert_file and tls_key_file", key)
+		}
+		if m["tls_pki_common_name"] == "" {
+			return fmt.Errorf("listener.%s: tls_pki_common_name is required with tls_pki_path", key)
+		}
+		if ttl := m["tls_pki_ttl"]; ttl != "" {
+			if d, err := time.ParseDuration(ttl); err != nil || d <= 0 {
+				return fmt.Errorf("listener.%s: tls_pki_ttl must be a positive duration, e.g. \"72h\"", key)
+			}
+		}
+		result.Listener.Tls_pki_path = strings.Trim(path, "/")
+		result.Listener.Tls_pki_common_name = m["tls_pki_common_name"]
+		result.Listener.Tls_pki_alt_names = splitList(m["tls_pki_alt_names"])
+		result.Listener.Tls_pki_ttl = m["tls_pki_ttl"]
+	} else if m["tls_pki_common_name"] != "" || m["tls_pki_alt_names"] != "" || m["tls_pki_ttl"] != "" {
+		return fmt.Errorf("listener.%s: tls_pki_common_name, tls_pki_alt_names and tls_pki_ttl need tls_pki_path", key)
+	}
 
 	if redirect, ok := m["tls_autoredirect"]; ok {
 		if redirect == "1" {
@@ -216,13 +554,409 @@ func parseListener(result *Config, listener *ast.ObjectItem) error {
 			}
 			result.Listener.Tls_autoredirect = true
 		} else if redirect != "0" {
-			return fmt.Errorf("listener.%s: tls_autoredirect can be 0 or 1")
+			return fmt.Errorf("listener.%s: tls_autoredirect can be 0 or 1", key)
+		}
+	}
+
+	if metricsAddress, ok := m["metrics_address"]; ok {
+		if metricsAddress == result.Listener.Address {
+			return fmt.Errorf("listener.%s: metrics_address must differ from address", key)
+		}
+		result.Listener.Metrics_address = metricsAddress
+	}
+
+	result.Listener.Shutdown_timeout = 30 * time.Second
+	if timeout, ok := m["shutdown_timeout"]; ok {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("listener.%s: shutdown_timeout must be a positive duration, e.g. \"30s\"", key)
+		}
+		result.Listener.Shutdown_timeout = d
+	}
+
+	result.Listener.Read_header_timeout = defaultReadHeaderTimeout
+	result.Listener.Read_timeout = defaultReadTimeout
+	result.Listener.Write_timeout = defaultWriteTimeout
+	result.Listener.Idle_timeout = defaultIdleTimeout
+	for name, timeout := range map[string]*time.Duration{
+		"read_header_timeout": &result.Listener.Read_header_timeout,
+		"read_timeout":        &result.Listener.Read_timeout,
+		"write_timeout":       &result.Listener.Write_timeout,
+		"idle_timeout":        &result.Listener.Idle_timeout,
+	} {
+		if raw, ok := m[name]; ok {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d < 0 {
+				return fmt.Errorf("listener.%s: %s must be a duration, e.g. \"1m\", or \"0\" for no limit", key, name)
+			}
+			*timeout = d
+		}
+	}
+
+	result.Listener.Max_header_bytes = defaultMaxHeaderBytes
+	if raw, ok := m["max_header_bytes"]; ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("listener.%s: max_header_bytes must be a positive number of bytes", key)
+		}
+		result.Listener.Max_header_bytes = n
+	}
+
+	result.Listener.Http2 = true
+	if http2, ok := m["http2"]; ok {
+		if http2 == "0" {
+			result.Listener.Http2 = false
+		} else if http2 != "1" {
+			return fmt.Errorf("listener.%s: http2 can be 0 or 1", key)
+		}
+	}
+
+	if strings.HasPrefix(result.Listener.Address, UnixSocketPrefix) {
+		if strings.TrimPrefix(result.Listener.Address, UnixSocketPrefix) == "" {
+			return fmt.Errorf("listener.%s: address needs a socket path, e.g. \"unix:///run/goldfish.sock\"", key)
 		}
+		if result.Listener.Tls_autoredirect {
+			return fmt.Errorf("listener.%s: tls_autoredirect can't be used with a unix socket", key)
+		}
+		// let's encrypt needs to be reachable on port 443
+		if !result.Listener.Tls_disable && result.Listener.Tls_pki_path == "" &&
+			(result.Listener.Tls_cert_file == "" || result.Listener.Tls_key_file == "") {
+			return fmt.Errorf("listener.%s: a unix socket needs tls_disable = 1, tls_cert_file and tls_key_file, or tls_pki_path", key)
+		}
+	}
+
+	if mode, ok := m["socket_mode"]; ok {
+		if !strings.HasPrefix(result.Listener.Address, UnixSocketPrefix) {
+			return fmt.Errorf("listener.%s: socket_mode is only valid with a unix socket address", key)
+		}
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || perm == 0 || perm > 0777 {
+			return fmt.Errorf("listener.%s: socket_mode must be octal permissions, e.g. \"0660\"", key)
+		}
+		result.Listener.Socket_mode = os.FileMode(perm)
 	}
 
+	if proxies, ok := m["trusted_proxies"]; ok {
+		if _, err := ParseNetworks(proxies); err != nil {
+			return fmt.Errorf("listener.%s: trusted_proxies: %s", key, err.Error())
+		}
+		result.Listener.Trusted_proxies = proxies
+	}
+
+	for name, networks := range map[string]*string{
+		"allowed_networks":       &result.Listener.Allowed_networks,
+		"denied_networks":        &result.Listener.Denied_networks,
+		"admin_allowed_networks": &result.Listener.Admin_allowed_networks,
+		"admin_denied_networks":  &result.Listener.Admin_denied_networks,
+	} {
+		if raw, ok := m[name]; ok {
+			if _, err := ParseNetworks(raw); err != nil {
+				return fmt.Errorf("listener.%s: %s: %s", key, name, err.Error())
+			}
+			*networks = raw
+		}
+	}
+
+	if basePath, ok := m["base_path"]; ok {
+		if !strings.HasPrefix(basePath, "/") || strings.ContainsAny(basePath, "?#") {
+			return fmt.Errorf("listener.%s: base_path must be a URL path, e.g. \"/goldfish/\"", key)
+		}
+		result.Listener.Base_path = strings.TrimRight(basePath, "/")
+	}
+
+	if object, ok := listener.Val.(*ast.ObjectType); ok {
+		if cors := object.List.Filter("cors"); len(cors.Items) > 1 {
+			return fmt.Errorf("listener.%s: at most one cors block is allowed", key)
+		} else if len(cors.Items) == 1 {
+			if err := parseCORS(result, cors.Items[0]); err != nil {
+				return fmt.Errorf("listener.%s: cors: %s", key, err.Error())
+			}
+		}
+	}
+
+	result.Listener.Headers = defaultHeaders()
+	if object, ok := listener.Val.(*ast.ObjectType); ok {
+		if headers := object.List.Filter("headers"); len(headers.Items) > 1 {
+			return fmt.Errorf("listener.%s: at most one headers block is allowed", key)
+		} else if len(headers.Items) == 1 {
+			if err := parseHeaders(result, headers.Items[0]); err != nil {
+				return fmt.Errorf("listener.%s: headers: %s", key, err.Error())
+			}
+		}
+	}
+
+	if object, ok := listener.Val.(*ast.ObjectType); ok {
+		if compression := object.List.Filter("compression"); len(compression.Items) > 1 {
+			return fmt.Errorf("listener.%s: at most one compression block is allowed", key)
+		} else if len(compression.Items) == 1 {
+			if err := parseCompression(result, compression.Items[0]); err != nil {
+				return fmt.Errorf("listener.%s: compression: %s", key, err.Error())
+			}
+		}
+	}
+
+	// without certificate files, https needs certificates from an ACME CA. Without an acme
+	// block, the listener's address is the only hostname, as it always has been
+	autocert := !result.Listener.Tls_disable && result.Listener.Tls_pki_path == "" &&
+		result.Listener.Tls_cert_file == "" && result.Listener.Tls_key_file == ""
+	if object, ok := listener.Val.(*ast.ObjectType); ok {
+		if acme := object.List.Filter("acme"); len(acme.Items) > 1 {
+			return fmt.Errorf("listener.%s: at most one acme block is allowed", key)
+		} else if len(acme.Items) == 1 {
+			if !autocert {
+				return fmt.Errorf("listener.%s: acme is only used with tls on and no tls_cert_file, tls_key_file or tls_pki_path", key)
+			}
+			if err := parseAcme(result, acme.Items[0]); err != nil {
+				return fmt.Errorf("listener.%s: acme: %s", key, err.Error())
+			}
+		}
+	}
 	return nil
 }
 
+func parseAcme(result *Config, acme *ast.ObjectItem) error {
+	valid := []string{
+		"hostnames",
+		"cache_dir",
+		"email",
+		"challenge",
+		"dns_hook",
+		"directory_url",
+	}
+	if err := checkHCLKeys(acme.Val, valid); err != nil {
+		return err
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, acme.Val); err != nil {
+		return err
+	}
+
+	a := &AcmeConfig{
+		Hostnames:     splitList(strings.ToLower(m["hostnames"])),
+		Cache_dir:     "/var/www/.cache",
+		Email:         m["email"],
+		Challenge:     "http-01",
+		Dns_hook:      m["dns_hook"],
+		Directory_url: m["directory_url"],
+	}
+	if len(a.Hostnames) == 0 {
+		return errors.New("hostnames is required")
+	}
+	if dir, ok := m["cache_dir"]; ok && dir != "" {
+		a.Cache_dir = dir
+	}
+	if challenge, ok := m["challenge"]; ok {
+		a.Challenge = strings.ToLower(challenge)
+	}
+	switch a.Challenge {
+	case "http-01":
+		if a.Dns_hook != "" {
+			return errors.New("dns_hook is only used with the dns-01 challenge")
+		}
+	case "dns-01":
+		if a.Dns_hook == "" {
+			return errors.New("dns_hook is required for the dns-01 challenge")
+		}
+	default:
+		return errors.New("challenge must be http-01 or dns-01")
+	}
+	if a.Directory_url != "" {
+		if u, err := url.Parse(a.Directory_url); err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.New("directory_url must be an https URL")
+		}
+	}
+
+	result.Listener.Acme = a
+	return nil
+}
+
+// the node without the blocks of the given names
+func withoutBlocks(node ast.Node, names ...string) ast.Node {
+	object, ok := node.(*ast.ObjectType)
+	if !ok {
+		return node
+	}
+	list := &ast.ObjectList{}
+	for _, item := range object.List.Items {
+		if len(item.Keys) > 0 && stringIn(item.Keys[0].Token.Value().(string), names) {
+			continue
+		}
+		list.Add(item)
+	}
+	return &ast.ObjectType{List: list}
+}
+
+func stringIn(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func parseHeaders(result *Config, headers *ast.ObjectItem) error {
+	valid := []string{
+		"content_security_policy",
+		"frame_options",
+		"referrer_policy",
+		"hsts_max_age",
+		"hsts_include_subdomains",
+	}
+	if err := checkHCLKeys(headers.Val, valid); err != nil {
+		return err
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, headers.Val); err != nil {
+		return err
+	}
+
+	h := result.Listener.Headers
+	if csp, ok := m["content_security_policy"]; ok {
+		h.Content_security_policy = csp
+	}
+	if options, ok := m["frame_options"]; ok {
+		h.Frame_options = strings.ToUpper(options)
+		if h.Frame_options != "" && h.Frame_options != "DENY" && h.Frame_options != "SAMEORIGIN" {
+			return errors.New("frame_options can be DENY, SAMEORIGIN or empty")
+		}
+	}
+	if policy, ok := m["referrer_policy"]; ok {
+		h.Referrer_policy = policy
+	}
+	if raw, ok := m["hsts_max_age"]; ok {
+		age, err := strconv.Atoi(raw)
+		if err != nil || age < 0 {
+			return errors.New("hsts_max_age must be a number of seconds, or 0 to leave HSTS out")
+		}
+		h.Hsts_max_age = age
+	}
+	if subdomains, ok := m["hsts_include_subdomains"]; ok {
+		if subdomains == "1" {
+			h.Hsts_include_subdomains = true
+		} else if subdomains != "0" {
+			return errors.New("hsts_include_subdomains can be 0 or 1")
+		}
+	}
+	return nil
+}
+
+func parseCompression(result *Config, compression *ast.ObjectItem) error {
+	if err := checkHCLKeys(compression.Val, []string{"level"}); err != nil {
+		return err
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, compression.Val); err != nil {
+		return err
+	}
+
+	c := &CompressionConfig{Level: 6}
+	if raw, ok := m["level"]; ok {
+		level, err := strconv.Atoi(raw)
+		if err != nil || level < 1 || level > 9 {
+			return errors.New("level must be a number from 1 to 9")
+		}
+		c.Level = level
+	}
+	result.Listener.Compression = c
+	return nil
+}
+
+func parseCORS(result *Config, cors *ast.ObjectItem) error {
+	valid := []string{
+		"allowed_origins",
+		"allowed_methods",
+		"allow_credentials",
+	}
+	if err := checkHCLKeys(cors.Val, valid); err != nil {
+		return err
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, cors.Val); err != nil {
+		return err
+	}
+
+	c := &CORSConfig{
+		Allowed_origins: splitList(m["allowed_origins"]),
+		Allowed_methods: splitList(strings.ToUpper(m["allowed_methods"])),
+	}
+	if len(c.Allowed_origins) == 0 {
+		return errors.New("allowed_origins is required")
+	}
+	anyOrigin := false
+	for _, origin := range c.Allowed_origins {
+		if origin == "*" {
+			anyOrigin = true
+			continue
+		}
+		// browsers send the origin as scheme://host[:port], and it is matched exactly
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("%s is not an origin, e.g. \"https://ui.example.com\"", origin)
+		}
+	}
+	if len(c.Allowed_methods) == 0 {
+		c.Allowed_methods = []string{"GET", "HEAD", "PUT", "PATCH", "POST", "DELETE"}
+	}
+
+	if credentials, ok := m["allow_credentials"]; ok {
+		if credentials == "1" {
+			// browsers refuse credentialed responses that allow any origin
+			if anyOrigin {
+				return errors.New("allow_credentials can't be used with the origin \"*\"")
+			}
+			c.Allow_credentials = true
+		} else if credentials != "0" {
+			return errors.New("allow_credentials can be 0 or 1")
+		}
+	}
+
+	result.Listener.Cors = c
+	return nil
+}
+
+// splits a comma separated list, dropping empty entries
+func splitList(raw string) []string {
+	list := []string{}
+	for _, s := range strings.Split(raw, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// parses a comma separated list of addresses and CIDRs, e.g. "10.0.0.0/8, 127.0.0.1"
+func ParseNetworks(raw string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, s := range strings.Split(raw, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.New(s + " is not an IP address or CIDR")
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			s = fmt.Sprintf("%s/%d", s, bits)
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.New(s + " is not an IP address or CIDR")
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
 func parseVault(result *Config, vault *ast.ObjectItem) error {
 	key := "vault"
 	if len(vault.Keys) > 0 {
@@ -235,6 +969,18 @@ func parseVault(result *Config, vault *ast.ObjectItem) error {
 		"runtime_config",
 		"approle_login",
 		"approle_id",
+		"approle_relogin",
+		"auth_method",
+		"kubernetes_login",
+		"kubernetes_role",
+		"kubernetes_jwt_file",
+		"aws_login",
+		"aws_role",
+		"aws_header_value",
+		"token_file",
+		"startup_retries",
+		"startup_retry_interval",
+		"runtime_config_interval",
 	}
 	if err := checkHCLKeys(vault.Val, valid); err != nil {
 		return fmt.Errorf("vault.%s: %s", key, err.Error())
@@ -255,7 +1001,7 @@ func parseVault(result *Config, vault *ast.ObjectItem) error {
 			return fmt.Errorf("failed to set address: %v", err)
 		} else {
 			if !(url.Scheme == "http" || url.Scheme == "https") {
-				return fmt.Errorf("vault.%s: address must be prefixed with scheme i.e. http:// or https://")
+				return fmt.Errorf("vault.%s: address must be prefixed with scheme i.e. http:// or https://", key)
 			}
 			result.Vault.Address = url.String()
 		}
@@ -287,5 +1033,335 @@ func parseVault(result *Config, vault *ast.ObjectItem) error {
 		result.Vault.Approle_id = "goldfish"
 	}
 
+	if relogin, ok := m["approle_relogin"]; ok {
+		if relogin == "1" {
+			result.Vault.Approle_relogin = true
+		} else if relogin != "0" {
+			return fmt.Errorf("vault.%s: approle_relogin can be 0 or 1", key)
+		}
+	}
+
+	result.Vault.Auth_method = "approle"
+	if method, ok := m["auth_method"]; ok {
+		result.Vault.Auth_method = strings.ToLower(method)
+	}
+	if !stringIn(result.Vault.Auth_method, []string{"approle", "kubernetes", "aws", "token_file"}) {
+		return fmt.Errorf("vault.%s: auth_method must be approle, kubernetes, aws or token_file", key)
+	}
+	// the approle options have always been in the sample config, so only these are checked
+	for name := range m {
+		for _, method := range []string{"kubernetes", "aws", "token_file"} {
+			if (name == method || strings.HasPrefix(name, method+"_")) && result.Vault.Auth_method != method {
+				return fmt.Errorf("vault.%s: %s is only used with auth_method %q", key, name, method)
+			}
+		}
+	}
+
+	result.Vault.Kubernetes_login = "auth/kubernetes/login"
+	if login, ok := m["kubernetes_login"]; ok && login != "" {
+		result.Vault.Kubernetes_login = login
+	}
+	result.Vault.Kubernetes_role = "goldfish"
+	if role, ok := m["kubernetes_role"]; ok && role != "" {
+		result.Vault.Kubernetes_role = role
+	}
+	result.Vault.Kubernetes_jwt_file = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	if file, ok := m["kubernetes_jwt_file"]; ok && file != "" {
+		result.Vault.Kubernetes_jwt_file = file
+	}
+
+	result.Vault.Aws_login = "auth/aws/login"
+	if login, ok := m["aws_login"]; ok && login != "" {
+		result.Vault.Aws_login = login
+	}
+	result.Vault.Aws_role = "goldfish"
+	if role, ok := m["aws_role"]; ok && role != "" {
+		result.Vault.Aws_role = role
+	}
+	result.Vault.Aws_header_value = m["aws_header_value"]
+
+	result.Vault.Token_file = m["token_file"]
+	if result.Vault.Auth_method == "token_file" && result.Vault.Token_file == "" {
+		return fmt.Errorf("vault.%s: token_file is required with auth_method \"token_file\"", key)
+	}
+
+	result.Vault.Startup_retries = 10
+	if retries, ok := m["startup_retries"]; ok {
+		n, err := strconv.Atoi(retries)
+		if err != nil || n < 0 {
+			return fmt.Errorf("vault.%s: startup_retries must be a non-negative integer", key)
+		}
+		result.Vault.Startup_retries = n
+	}
+
+	result.Vault.Startup_retry_interval = 2 * time.Second
+	if interval, ok := m["startup_retry_interval"]; ok {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("vault.%s: startup_retry_interval must be a positive duration, e.g. \"5s\"", key)
+		}
+		result.Vault.Startup_retry_interval = d
+	}
+
+	result.Vault.Runtime_config_interval = time.Minute
+	if interval, ok := m["runtime_config_interval"]; ok {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("vault.%s: runtime_config_interval must be a positive duration, e.g. \"1m\"", key)
+		}
+		result.Vault.Runtime_config_interval = d
+	}
+
+	return nil
+}
+
+func parseCoordinator(result *Config, coordinator *ast.ObjectItem) error {
+	valid := []string{
+		"address",
+		"listen",
+		"tls_cert_file",
+		"tls_key_file",
+		"tls_ca_file",
+	}
+	if err := checkHCLKeys(coordinator.Val, valid); err != nil {
+		return fmt.Errorf("coordinator: %s", err.Error())
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, coordinator.Val); err != nil {
+		return fmt.Errorf("coordinator: %s", err.Error())
+	}
+
+	c := &CoordinatorConfig{
+		Address:       m["address"],
+		Listen:        m["listen"],
+		Tls_cert_file: m["tls_cert_file"],
+		Tls_key_file:  m["tls_key_file"],
+		Tls_ca_file:   m["tls_ca_file"],
+	}
+
+	// a node either forwards to the coordinator, or is the coordinator
+	if (c.Address == "") == (c.Listen == "") {
+		return errors.New("coordinator: exactly one of address (on replicas) or listen (on the coordinator) is required")
+	}
+	if c.Address != "" {
+		if u, err := url.Parse(c.Address); err != nil || u.Scheme != "https" {
+			return errors.New("coordinator: address must be an https:// url")
+		}
+		c.Address = strings.TrimSuffix(c.Address, "/")
+	}
+	if c.Tls_cert_file == "" || c.Tls_key_file == "" || c.Tls_ca_file == "" {
+		return errors.New("coordinator: tls_cert_file, tls_key_file and tls_ca_file are required for mutual TLS")
+	}
+
+	result.Coordinator = c
+	return nil
+}
+
+func parseLog(result *Config, object *ast.ObjectItem) error {
+	valid := []string{
+		"format",
+		"level",
+	}
+	if err := checkHCLKeys(object.Val, valid); err != nil {
+		return fmt.Errorf("log: %s", err.Error())
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, object.Val); err != nil {
+		return fmt.Errorf("log: %s", err.Error())
+	}
+
+	if format, ok := m["format"]; ok {
+		result.Log.Format = strings.ToLower(format)
+	}
+	if level, ok := m["level"]; ok {
+		result.Log.Level = strings.ToLower(level)
+	}
+	if err := logging.Validate(result.Log.Format, result.Log.Level); err != nil {
+		return fmt.Errorf("log: %s", err.Error())
+	}
+	return nil
+}
+
+func parseAudit(result *Config, object *ast.ObjectItem) error {
+	if len(object.Keys) != 1 {
+		return errors.New("audit requires a type, e.g. audit \"file\" { ... }")
+	}
+	key := strings.ToLower(object.Keys[0].Token.Value().(string))
+
+	valid := []string{
+		"path",
+		"tag",
+	}
+	if err := checkHCLKeys(object.Val, valid); err != nil {
+		return fmt.Errorf("audit.%s: %s", key, err.Error())
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, object.Val); err != nil {
+		return fmt.Errorf("audit.%s: %s", key, err.Error())
+	}
+
+	a := &AuditConfig{
+		Type: key,
+		Path: m["path"],
+		Tag:  m["tag"],
+	}
+	switch key {
+	case "file", "vault":
+		if a.Path == "" {
+			return fmt.Errorf("audit.%s: path is required", key)
+		}
+	case "syslog":
+		if a.Tag == "" {
+			a.Tag = "goldfish"
+		}
+	default:
+		return fmt.Errorf("audit.%s: type must be file, syslog or vault", key)
+	}
+
+	result.Audit = append(result.Audit, a)
+	return nil
+}
+
+func parseTracing(result *Config, object *ast.ObjectItem) error {
+	valid := []string{
+		"endpoint",
+		"service_name",
+		"sample_ratio",
+	}
+	if err := checkHCLKeys(object.Val, valid); err != nil {
+		return fmt.Errorf("tracing: %s", err.Error())
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, object.Val); err != nil {
+		return fmt.Errorf("tracing: %s", err.Error())
+	}
+
+	t := &TracingConfig{
+		Endpoint:     m["endpoint"],
+		Service_name: "goldfish",
+		Sample_ratio: 1,
+	}
+	if name, ok := m["service_name"]; ok && name != "" {
+		t.Service_name = name
+	}
+	if raw, ok := m["sample_ratio"]; ok {
+		ratio, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("tracing: sample_ratio must be a number between 0 and 1")
+		}
+		t.Sample_ratio = ratio
+	}
+	if err := tracing.Validate(t.Endpoint, t.Sample_ratio); err != nil {
+		return fmt.Errorf("tracing: %s", err.Error())
+	}
+
+	result.Tracing = t
+	return nil
+}
+
+func parseLoginLimit(result *Config, object *ast.ObjectItem) error {
+	valid := []string{
+		"ip_attempts",
+		"user_attempts",
+		"backoff",
+		"max_lockout",
+	}
+	if err := checkHCLKeys(object.Val, valid); err != nil {
+		return fmt.Errorf("login_limit: %s", err.Error())
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, object.Val); err != nil {
+		return fmt.Errorf("login_limit: %s", err.Error())
+	}
+
+	l := result.LoginLimit
+	for key, attempts := range map[string]*int{
+		"ip_attempts":   &l.Ip_attempts,
+		"user_attempts": &l.User_attempts,
+	} {
+		if raw, ok := m[key]; ok {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				return fmt.Errorf("login_limit: %s must be a number of attempts, or 0 to turn it off", key)
+			}
+			*attempts = n
+		}
+	}
+	for key, duration := range map[string]*time.Duration{
+		"backoff":     &l.Backoff,
+		"max_lockout": &l.Max_lockout,
+	} {
+		if raw, ok := m[key]; ok {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("login_limit: %s must be a positive duration, e.g. \"1s\"", key)
+			}
+			*duration = d
+		}
+	}
+	if l.Max_lockout < l.Backoff {
+		return errors.New("login_limit: max_lockout must be at least backoff")
+	}
+	return nil
+}
+
+func parseCluster(result *Config, cluster *ast.ObjectItem) error {
+	if len(cluster.Keys) != 1 {
+		return errors.New("cluster requires a name, e.g. cluster \"staging\" { ... }")
+	}
+	name := cluster.Keys[0].Token.Value().(string)
+	for _, other := range result.Clusters {
+		if other.Name == name {
+			return fmt.Errorf("cluster.%s is defined more than once", name)
+		}
+	}
+
+	valid := []string{
+		"address",
+		"tls_skip_verify",
+		"approle_login",
+		"approle_id",
+		"wrapping_token_file",
+	}
+	if err := checkHCLKeys(cluster.Val, valid); err != nil {
+		return fmt.Errorf("cluster.%s: %s", name, err.Error())
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, cluster.Val); err != nil {
+		return fmt.Errorf("cluster.%s: %s", name, err.Error())
+	}
+
+	c := &ClusterConfig{
+		Name:                name,
+		Approle_login:       "auth/approle/login",
+		Approle_id:          "goldfish",
+		Wrapping_token_file: m["wrapping_token_file"],
+	}
+	if u, err := url.Parse(m["address"]); err != nil || !(u.Scheme == "http" || u.Scheme == "https") {
+		return fmt.Errorf("cluster.%s: address must be prefixed with scheme i.e. http:// or https://", name)
+	} else {
+		c.Address = u.String()
+	}
+	if tlsSkip, ok := m["tls_skip_verify"]; ok {
+		if tlsSkip == "1" {
+			c.Tls_skip_verify = true
+		} else if tlsSkip != "0" {
+			return fmt.Errorf("cluster.%s: tls_skip_verify can be 0 or 1", name)
+		}
+	}
+	if login, ok := m["approle_login"]; ok {
+		c.Approle_login = login
+	}
+	if id, ok := m["approle_id"]; ok {
+		c.Approle_id = id
+	}
+
+	result.Clusters = append(result.Clusters, c)
 	return nil
 }
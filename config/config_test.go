@@ -0,0 +1,260 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testVault = `
+vault {
+	address = "https://127.0.0.1:8200"
+}
+`
+
+func TestParseAcme(t *testing.T) {
+	Convey("Without certificate files or an acme block, the listener's address should be the hostname", t, func(c C) {
+		cfg, err := ParseConfig(`listener "tcp" {
+	address = "goldfish.example.com"
+}` + testVault)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Listener.Acme, ShouldBeNil)
+	})
+
+	Convey("An acme block should default to the http-01 challenge", t, func(c C) {
+		cfg, err := ParseConfig(`listener "tcp" {
+	address = ":443"
+	acme {
+		hostnames = "Goldfish.example.com, ui.example.com"
+	}
+}` + testVault)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Listener.Acme.Hostnames, ShouldResemble, []string{"goldfish.example.com", "ui.example.com"})
+		c.So(cfg.Listener.Acme.Challenge, ShouldEqual, "http-01")
+		c.So(cfg.Listener.Acme.Cache_dir, ShouldEqual, "/var/www/.cache")
+	})
+
+	Convey("The dns-01 challenge should need a dns hook", t, func(c C) {
+		_, err := ParseConfig(`listener "tcp" {
+	address = ":443"
+	acme {
+		hostnames = "goldfish.example.com"
+		challenge = "dns-01"
+	}
+}` + testVault)
+		c.So(err, ShouldNotBeNil)
+
+		cfg, err := ParseConfig(`listener "tcp" {
+	address = ":443"
+	acme {
+		hostnames = "goldfish.example.com"
+		challenge = "dns-01"
+		dns_hook  = "/usr/local/bin/hook"
+	}
+}` + testVault)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Listener.Acme.Dns_hook, ShouldEqual, "/usr/local/bin/hook")
+	})
+
+	Convey("Invalid acme blocks should be rejected", t, func(c C) {
+		for _, acme := range []string{
+			`hostnames = ""`,
+			`hostnames = "goldfish.example.com"
+		challenge = "tls-sni"`,
+			`hostnames = "goldfish.example.com"
+		dns_hook  = "/usr/local/bin/hook"`,
+			`hostnames     = "goldfish.example.com"
+		directory_url = "http://acme.example.com/directory"`,
+		} {
+			_, err := ParseConfig(`listener "tcp" {
+	address = ":443"
+	acme {
+		` + acme + `
+	}
+}` + testVault)
+			c.So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("An acme block should be rejected alongside certificate files", t, func(c C) {
+		_, err := ParseConfig(`listener "tcp" {
+	address       = ":443"
+	tls_cert_file = "/etc/goldfish/cert.pem"
+	tls_key_file  = "/etc/goldfish/key.pem"
+	acme {
+		hostnames = "goldfish.example.com"
+	}
+}` + testVault)
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestParseReload(t *testing.T) {
+	Convey("The runtime config should be re-read every minute unless configured", t, func(c C) {
+		cfg, err := ParseConfig(`listener "tcp" {
+	address     = ":8000"
+	tls_disable = 1
+}` + testVault)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Vault.Runtime_config_interval, ShouldEqual, time.Minute)
+
+		cfg, err = ParseConfig(`listener "tcp" {
+	address     = ":8000"
+	tls_disable = 1
+}
+vault {
+	address                 = "https://127.0.0.1:8200"
+	runtime_config_interval = "30s"
+}`)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Vault.Runtime_config_interval, ShouldEqual, 30*time.Second)
+
+		for _, interval := range []string{"0", "-1m", "soon"} {
+			_, err = ParseConfig(`listener "tcp" {
+	address     = ":8000"
+	tls_disable = 1
+}
+vault {
+	address                 = "https://127.0.0.1:8200"
+	runtime_config_interval = "` + interval + `"
+}`)
+			c.So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("Reloading should pick up a changed file, and its certificate paths", t, func(c C) {
+		dir, err := ioutil.TempDir("", "goldfish-config")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "goldfish.hcl")
+
+		write := func(cert string) {
+			c.So(ioutil.WriteFile(path, []byte(`listener "tcp" {
+	address       = ":8443"
+	tls_cert_file = "`+cert+`"
+	tls_key_file  = "/etc/goldfish/key.pem"
+}`+testVault), 0600), ShouldBeNil)
+		}
+		write("/etc/goldfish/cert.pem")
+		cfg, err := LoadConfigFile(path, nil)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Listener.Tls_cert_file, ShouldEqual, "/etc/goldfish/cert.pem")
+
+		write("/etc/goldfish/renewed.pem")
+		cfg, err = LoadConfigFile(path, nil)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Listener.Tls_cert_file, ShouldEqual, "/etc/goldfish/renewed.pem")
+
+		// a broken file fails the reload, rather than applying part of it
+		c.So(ioutil.WriteFile(path, []byte(`listener "tcp" {`), 0600), ShouldBeNil)
+		_, err = LoadConfigFile(path, nil)
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestParseUnixSocket(t *testing.T) {
+	Convey("A unix socket address should be accepted with its file mode", t, func(c C) {
+		cfg, err := ParseConfig(`listener "tcp" {
+	address     = "unix:///run/goldfish.sock"
+	tls_disable = 1
+	socket_mode = "0660"
+}` + testVault)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Listener.Address, ShouldEqual, "unix:///run/goldfish.sock")
+		c.So(cfg.Listener.Socket_mode, ShouldEqual, os.FileMode(0660))
+
+		cfg, err = ParseConfig(`listener "tcp" {
+	address     = "unix:///run/goldfish.sock"
+	tls_disable = 1
+}` + testVault)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Listener.Socket_mode, ShouldEqual, os.FileMode(0))
+	})
+
+	Convey("Invalid unix socket listeners should be rejected", t, func(c C) {
+		for _, listener := range []string{
+			// no path
+			`address     = "unix://"
+	tls_disable = 1`,
+			// nothing to redirect from
+			`address          = "unix:///run/goldfish.sock"
+	tls_autoredirect = 1
+	tls_cert_file    = "/etc/goldfish/cert.pem"
+	tls_key_file     = "/etc/goldfish/key.pem"`,
+			// no certificate for acme to fall back on
+			`address = "unix:///run/goldfish.sock"`,
+			// modes need a socket, and must be octal permissions
+			`address     = ":8000"
+	tls_disable = 1
+	socket_mode = "0660"`,
+			`address     = "unix:///run/goldfish.sock"
+	tls_disable = 1
+	socket_mode = "0999"`,
+			`address     = "unix:///run/goldfish.sock"
+	tls_disable = 1
+	socket_mode = "01777"`,
+		} {
+			_, err := ParseConfig(`listener "tcp" {
+	` + listener + `
+}` + testVault)
+			c.So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestParseListenerLimits(t *testing.T) {
+	Convey("Listener limits should have defaults", t, func(c C) {
+		cfg, err := ParseConfig(`listener "tcp" {
+	address     = ":8000"
+	tls_disable = 1
+}` + testVault)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Listener.Read_header_timeout, ShouldEqual, 10*time.Second)
+		c.So(cfg.Listener.Read_timeout, ShouldEqual, 5*time.Minute)
+		c.So(cfg.Listener.Write_timeout, ShouldEqual, 5*time.Minute)
+		c.So(cfg.Listener.Idle_timeout, ShouldEqual, 2*time.Minute)
+		c.So(cfg.Listener.Max_header_bytes, ShouldEqual, 1<<20)
+		c.So(cfg.Listener.Http2, ShouldBeTrue)
+	})
+
+	Convey("Listener limits should be configurable, with 0 for no limit", t, func(c C) {
+		cfg, err := ParseConfig(`listener "tcp" {
+	address             = ":8000"
+	tls_disable         = 1
+	read_header_timeout = "5s"
+	read_timeout        = "0"
+	write_timeout       = "1m"
+	idle_timeout        = "30s"
+	max_header_bytes    = 4096
+	http2               = 0
+}` + testVault)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Listener.Read_header_timeout, ShouldEqual, 5*time.Second)
+		c.So(cfg.Listener.Read_timeout, ShouldEqual, time.Duration(0))
+		c.So(cfg.Listener.Write_timeout, ShouldEqual, time.Minute)
+		c.So(cfg.Listener.Idle_timeout, ShouldEqual, 30*time.Second)
+		c.So(cfg.Listener.Max_header_bytes, ShouldEqual, 4096)
+		c.So(cfg.Listener.Http2, ShouldBeFalse)
+	})
+
+	Convey("Invalid listener limits should be rejected", t, func(c C) {
+		for _, limit := range []string{
+			`read_timeout = "-1s"`,
+			`idle_timeout = "forever"`,
+			`max_header_bytes = 0`,
+			`max_header_bytes = "lots"`,
+			`http2 = 2`,
+		} {
+			_, err := ParseConfig(`listener "tcp" {
+	address     = ":8000"
+	tls_disable = 1
+	` + limit + `
+}` + testVault)
+			c.So(err, ShouldNotBeNil)
+		}
+	})
+}
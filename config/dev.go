@@ -253,21 +253,4 @@ func generateWrappedSecretID(v VaultConfig, token string) (string, error) {
 	return resp.WrapInfo.Token, nil
 }
 
-const goldfishPolicyRules = `
-# [mandatory]
-# credential transit key (stores logon tokens)
-# NO OTHER POLICY should be able to write to this key
-path "transit/encrypt/goldfish" {
-  capabilities = ["read", "update"]
-}
-path "transit/decrypt/goldfish" {
-  capabilities = ["read", "update"]
-}
-
-# [mandatory] [changable]
-# store goldfish run-time settings here
-# goldfish hot-reloads from this endpoint every minute
-path "secret/goldfish*" {
-  capabilities = ["read", "update"]
-}
-`
+var goldfishPolicyRules = goldfishPolicy("secret/goldfish", "transit", "goldfish")
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	devCAFile      = "goldfish-dev-ca.pem"
+	devCAKeyFile   = "goldfish-dev-ca-key.pem"
+	devCertFile    = "goldfish-dev.pem"
+	devKeyFile     = "goldfish-dev-key.pem"
+	devSnippetFile = "goldfish-dev-listener.hcl"
+)
+
+// the listener stanza written next to the generated files
+const devListenerSnippet = `# generated by goldfish -gen-dev-cert, for local testing only
+listener "tcp" {
+	address          = "%s"
+	tls_cert_file    = "%s"
+	tls_key_file     = "%s"
+	tls_disable      = 0
+	tls_autoredirect = 0
+}
+`
+
+// GenerateDevCert writes a certificate and key for the given hosts into dir, signed by a local
+// development CA (created on first use and reused afterwards so it only needs trusting once).
+// If install is set, the CA is added to the OS trust store. A matching listener config
+// snippet is written alongside, and its path returned
+func GenerateDevCert(dir string, hosts []string, address string, install bool) (string, error) {
+	if len(hosts) == 0 {
+		return "", errors.New("[ERROR]: At least one host is required")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	ca, caKey, err := loadOrCreateDevCA(dir)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	template, err := devCertTemplate("goldfish development certificate", 825*24*time.Hour)
+	if err != nil {
+		return "", err
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, host := range hosts {
+		if host = strings.TrimSpace(host); host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return "", err
+	}
+
+	certPath := filepath.Join(dir, devCertFile)
+	keyPath := filepath.Join(dir, devKeyFile)
+	if err := writePEM(certPath, "CERTIFICATE", der, 0644); err != nil {
+		return "", err
+	}
+	if err := writeECKey(keyPath, key); err != nil {
+		return "", err
+	}
+
+	if install {
+		if err := installDevCA(filepath.Join(dir, devCAFile)); err != nil {
+			return "", fmt.Errorf("[ERROR]: Certificate was generated, but installing the CA failed: %v", err)
+		}
+	}
+
+	// absolute paths let the snippet be used from any working directory
+	if abs, err := filepath.Abs(certPath); err == nil {
+		certPath = abs
+	}
+	if abs, err := filepath.Abs(keyPath); err == nil {
+		keyPath = abs
+	}
+	snippetPath := filepath.Join(dir, devSnippetFile)
+	snippet := fmt.Sprintf(devListenerSnippet, address, certPath, keyPath)
+	return snippetPath, ioutil.WriteFile(snippetPath, []byte(snippet), 0644)
+}
+
+func loadOrCreateDevCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caPath := filepath.Join(dir, devCAFile)
+	caKeyPath := filepath.Join(dir, devCAKeyFile)
+
+	if certPEM, err := ioutil.ReadFile(caPath); err == nil {
+		keyPEM, err := ioutil.ReadFile(caKeyPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		certBlock, _ := pem.Decode(certPEM)
+		keyBlock, _ := pem.Decode(keyPEM)
+		if certBlock == nil || keyBlock == nil {
+			return nil, nil, errors.New("[ERROR]: Could not decode existing development CA in " + dir)
+		}
+		ca, err := x509.ParseCertificate(certBlock.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		caKey, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ca, caKey, nil
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := devCertTemplate("goldfish development CA", 10*365*24*time.Hour)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.MaxPathLenZero = true
+	template.KeyUsage |= x509.KeyUsageCertSign
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(caPath, "CERTIFICATE", der, 0644); err != nil {
+		return nil, nil, err
+	}
+	if err := writeECKey(caKeyPath, caKey); err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	return ca, caKey, err
+}
+
+func devCertTemplate(commonName string, lifetime time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization:       []string{"goldfish development"},
+			OrganizationalUnit: []string{hostname},
+			CommonName:         commonName,
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(lifetime),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}, nil
+}
+
+func writePEM(path, blockType string, der []byte, mode os.FileMode) error {
+	return ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), mode)
+}
+
+func writeECKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writePEM(path, "EC PRIVATE KEY", der, 0600)
+}
+
+// adds the CA to the system trust store, the way mkcert does. This usually requires elevated privileges
+func installDevCA(caPath string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "add-trusted-cert", "-d", "-r", "trustRoot",
+			"-k", "/Library/Keychains/System.keychain", caPath)
+	case "windows":
+		cmd = exec.Command("certutil", "-addstore", "-f", "ROOT", caPath)
+	case "linux":
+		data, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return err
+		}
+		// debian-style and redhat-style trust stores respectively
+		if _, err := exec.LookPath("update-ca-certificates"); err == nil {
+			if err := ioutil.WriteFile("/usr/local/share/ca-certificates/goldfish-dev-ca.crt", data, 0644); err != nil {
+				return err
+			}
+			cmd = exec.Command("update-ca-certificates")
+		} else if _, err := exec.LookPath("update-ca-trust"); err == nil {
+			if err := ioutil.WriteFile("/etc/pki/ca-trust/source/anchors/goldfish-dev-ca.pem", data, 0644); err != nil {
+				return err
+			}
+			cmd = exec.Command("update-ca-trust", "extract")
+		} else {
+			return errors.New("no supported trust store tool found, trust " + caPath + " manually")
+		}
+	default:
+		return errors.New("installing into the trust store is unsupported on " + runtime.GOOS)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
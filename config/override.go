@@ -0,0 +1,158 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// a config value set outside the config file, by a GOLDFISH_* environment variable or a flag
+// Path is the block, the block nested in it if any, and the key
+type Override struct {
+	Path  []string
+	Value string
+}
+
+// the blocks whose keys can be overridden, with the blocks nested in them
+// clusters and audit sinks can be configured more than once, so they are only set in the file
+var overridableBlocks = map[string][]string{
+	"listener":    {"cors", "headers", "compression", "acme"},
+	"vault":       nil,
+	"coordinator": nil,
+	"log":         nil,
+	"tracing":     nil,
+	"login_limit": nil,
+}
+
+const overrideEnvPrefix = "GOLDFISH_"
+
+// overrides from variables such as GOLDFISH_VAULT_ADDRESS or GOLDFISH_LISTENER_HEADERS_HSTS_MAX_AGE,
+// given as from os.Environ. GOLDFISH_ variables that don't name a block are left alone
+func EnvOverrides(environ []string) []Override {
+	overrides := []Override{}
+	for _, pair := range environ {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], overrideEnvPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(parts[0], overrideEnvPrefix))
+		if path := envOverridePath(name); path != nil {
+			overrides = append(overrides, Override{Path: path, Value: parts[1]})
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		return strings.Join(overrides[i].Path, ".") < strings.Join(overrides[j].Path, ".")
+	})
+	return overrides
+}
+
+func envOverridePath(name string) []string {
+	for block, nested := range overridableBlocks {
+		if !strings.HasPrefix(name, block+"_") {
+			continue
+		}
+		key := strings.TrimPrefix(name, block+"_")
+		for _, inner := range nested {
+			if strings.HasPrefix(key, inner+"_") {
+				return []string{block, inner, strings.TrimPrefix(key, inner+"_")}
+			}
+		}
+		return []string{block, key}
+	}
+	return nil
+}
+
+// an override written as path=value, e.g. "vault.address=https://vault:8200"
+func ParseOverride(raw string) (Override, error) {
+	parts := strings.SplitN(raw, "=", 2)
+	if len(parts) != 2 {
+		return Override{}, fmt.Errorf("%q must be written as block.key=value", raw)
+	}
+	path := strings.Split(strings.ToLower(strings.TrimSpace(parts[0])), ".")
+	nested, ok := overridableBlocks[path[0]]
+	if !ok {
+		return Override{}, fmt.Errorf("%q: %s can't be overridden", raw, path[0])
+	}
+	if len(path) < 2 || len(path) > 3 || (len(path) == 3 && !stringIn(path[1], nested)) {
+		return Override{}, fmt.Errorf("%q must be written as block.key=value, or block.nested.key=value", raw)
+	}
+	for _, name := range path {
+		if name == "" {
+			return Override{}, fmt.Errorf("%q must be written as block.key=value", raw)
+		}
+	}
+	return Override{Path: path, Value: parts[1]}, nil
+}
+
+// sets each override's key in the parsed file, adding the blocks it is in if they are missing
+func applyOverrides(root *ast.ObjectList, overrides []Override) error {
+	for _, o := range overrides {
+		// a listener written without its type is a tcp listener
+		labels := []string{}
+		if o.Path[0] == "listener" {
+			labels = append(labels, "tcp")
+		}
+		list, err := overrideBlock(root, o.Path[0], labels)
+		if err != nil {
+			return err
+		}
+		if len(o.Path) == 3 {
+			if list, err = overrideBlock(list, o.Path[1], nil); err != nil {
+				return err
+			}
+		}
+		key := o.Path[len(o.Path)-1]
+		value := &ast.LiteralType{Token: token.Token{Type: token.STRING, Text: strconv.Quote(o.Value)}}
+
+		found := false
+		for _, item := range list.Items {
+			if len(item.Keys) == 1 && item.Keys[0].Token.Value() == key {
+				item.Val = value
+				found = true
+			}
+		}
+		if !found {
+			list.Add(&ast.ObjectItem{Keys: []*ast.ObjectKey{overrideKey(key)}, Val: value})
+		}
+	}
+	return nil
+}
+
+// the contents of the named block in list, which is added if missing
+func overrideBlock(list *ast.ObjectList, name string, labels []string) (*ast.ObjectList, error) {
+	var block *ast.ObjectItem
+	for _, item := range list.Items {
+		if len(item.Keys) > 0 && item.Keys[0].Token.Value() == name {
+			if block != nil {
+				return nil, errors.New("Can't override " + name + ", as it is configured more than once")
+			}
+			block = item
+		}
+	}
+	if block == nil {
+		block = &ast.ObjectItem{
+			Keys: []*ast.ObjectKey{overrideKey(name)},
+			Val:  &ast.ObjectType{List: &ast.ObjectList{}},
+		}
+		for _, label := range labels {
+			block.Keys = append(block.Keys, &ast.ObjectKey{
+				Token: token.Token{Type: token.STRING, Text: strconv.Quote(label)},
+			})
+		}
+		list.Add(block)
+	}
+	object, ok := block.Val.(*ast.ObjectType)
+	if !ok {
+		return nil, errors.New("Can't override " + name + ", as it is not a block")
+	}
+	return object.List, nil
+}
+
+func overrideKey(name string) *ast.ObjectKey {
+	return &ast.ObjectKey{Token: token.Token{Type: token.IDENT, Text: name}}
+}
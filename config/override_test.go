@@ -0,0 +1,82 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	Convey("Environment variables should map to the block and key they name", t, func(c C) {
+		overrides := EnvOverrides([]string{
+			"PATH=/usr/bin",
+			"GOLDFISH_VAULT_ADDRESS=https://vault:8200",
+			"GOLDFISH_LISTENER_HEADERS_HSTS_MAX_AGE=600",
+			"GOLDFISH_LOGIN_LIMIT_ATTEMPTS=5",
+			"GOLDFISH_NOSUCHBLOCK_KEY=1",
+		})
+		c.So(overrides, ShouldResemble, []Override{
+			{Path: []string{"listener", "headers", "hsts_max_age"}, Value: "600"},
+			{Path: []string{"login_limit", "attempts"}, Value: "5"},
+			{Path: []string{"vault", "address"}, Value: "https://vault:8200"},
+		})
+	})
+}
+
+func TestParseOverride(t *testing.T) {
+	Convey("Flags should be written as a path to a key", t, func(c C) {
+		o, err := ParseOverride("Vault.Address=https://vault:8200?a=b")
+		c.So(err, ShouldBeNil)
+		c.So(o, ShouldResemble, Override{Path: []string{"vault", "address"}, Value: "https://vault:8200?a=b"})
+
+		o, err = ParseOverride("listener.cors.allowed_origins=https://a.example.com")
+		c.So(err, ShouldBeNil)
+		c.So(o.Path, ShouldResemble, []string{"listener", "cors", "allowed_origins"})
+
+		for _, raw := range []string{"vault.address", "cluster.name=a", "vault=a", "vault.headers.x=1", "vault..x=1"} {
+			_, err := ParseOverride(raw)
+			c.So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestApplyOverrides(t *testing.T) {
+	Convey("A listener added by overrides should be a tcp listener", t, func(c C) {
+		cfg, err := ParseConfig(testVault,
+			Override{Path: []string{"listener", "address"}, Value: "127.0.0.1:8000"},
+			Override{Path: []string{"listener", "tls_disable"}, Value: "1"},
+		)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Listener.Type, ShouldEqual, "tcp")
+		c.So(cfg.Listener.Address, ShouldEqual, "127.0.0.1:8000")
+	})
+
+	Convey("Overrides should replace keys in the file, and add missing nested blocks", t, func(c C) {
+		cfg, err := ParseConfig(`listener "tcp" {
+	address     = "127.0.0.1:8000"
+	tls_disable = 1
+}`+testVault,
+			Override{Path: []string{"listener", "address"}, Value: "0.0.0.0:8000"},
+			Override{Path: []string{"listener", "headers", "hsts_max_age"}, Value: "600"},
+		)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Listener.Address, ShouldEqual, "0.0.0.0:8000")
+		c.So(cfg.Listener.Headers.Hsts_max_age, ShouldEqual, 600)
+	})
+
+	Convey("Blocks configured more than once should not be overridden", t, func(c C) {
+		obj, err := hcl.Parse(`vault {
+	address = "https://a:8200"
+}
+vault {
+	address = "https://b:8200"
+}`)
+		c.So(err, ShouldBeNil)
+		err = applyOverrides(obj.Node.(*ast.ObjectList), []Override{
+			{Path: []string{"vault", "address"}, Value: "https://c:8200"},
+		})
+		c.So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,405 @@
+package config
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// what provisioning does to a resource
+const (
+	provisionCreate    = "create"
+	provisionUpdate    = "update"
+	provisionUnchanged = "unchanged"
+)
+
+// defaults written into a runtime config that doesn't exist yet, or lacks these keys
+var runtimeConfigDefaults = map[string]interface{}{
+	"TransitBackend":    "transit",
+	"UserTransitKey":    "usertransit",
+	"ServerTransitKey":  "goldfish",
+	"DefaultSecretPath": "secret/",
+	"BulletinPath":      "secret/bulletins/",
+}
+
+// settings of the approle that goldfish logs in with
+var goldfishApprole = map[string]interface{}{
+	"secret_id_ttl":      "5m",
+	"secret_id_num_uses": 1,
+	"token_ttl":          "480h",
+	"policies":           "default,goldfish",
+}
+
+// one resource that goldfish needs in vault
+type ProvisionStep struct {
+	Action   string
+	Resource string
+	Detail   string
+	apply    func() error
+}
+
+// the changes needed for vault to have everything goldfish needs
+type ProvisionPlan struct {
+	Steps []ProvisionStep
+}
+
+// compares what goldfish needs with what vault has. Nothing is changed until the plan is applied
+// roleName is the approle role that the deployment config's approle_id belongs to
+func PlanProvision(cfg *Config, token, roleName string) (*ProvisionPlan, error) {
+	if cfg == nil || cfg.Vault == nil {
+		return nil, errors.New("Config has no vault section")
+	}
+	if token == "" {
+		return nil, errors.New("An admin token is required")
+	}
+	if cfg.Vault.Approle_id == "" {
+		return nil, errors.New("vault.approle_id must be set to provision the approle")
+	}
+	client, err := provisionClient(cfg.Vault, token)
+	if err != nil {
+		return nil, err
+	}
+	plan := &ProvisionPlan{}
+
+	// existing runtime config values decide which transit keys are needed
+	runtimeConfig := map[string]interface{}{}
+	resp, err := client.Logical().Read(cfg.Vault.Runtime_config)
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil && resp.Data != nil {
+		runtimeConfig = resp.Data
+	}
+	missing := map[string]interface{}{}
+	for key, value := range runtimeConfigDefaults {
+		if s, _ := runtimeConfig[key].(string); s == "" {
+			missing[key] = value
+		}
+	}
+	setting := func(key string) string {
+		if s, _ := runtimeConfig[key].(string); s != "" {
+			return s
+		}
+		return runtimeConfigDefaults[key].(string)
+	}
+	backend := strings.Trim(setting("TransitBackend"), "/")
+	serverKey := setting("ServerTransitKey")
+	userKey := setting("UserTransitKey")
+
+	// transit mount and keys
+	mounts, err := client.Sys().ListMounts()
+	if err != nil {
+		return nil, err
+	}
+	if mount, ok := mounts[backend+"/"]; !ok {
+		plan.add(provisionCreate, "mount "+backend+"/", "transit secret backend", func() error {
+			return client.Sys().Mount(backend, &api.MountInput{Type: "transit"})
+		})
+	} else if mount.Type != "transit" {
+		return nil, fmt.Errorf("%s/ is already mounted as %s, not transit", backend, mount.Type)
+	} else {
+		plan.add(provisionUnchanged, "mount "+backend+"/", "transit secret backend", nil)
+	}
+	for _, key := range []string{serverKey, userKey} {
+		key := key
+		path := backend + "/keys/" + key
+		exists := false
+		if _, ok := mounts[backend+"/"]; ok {
+			resp, err := client.Logical().Read(path)
+			if err != nil {
+				return nil, err
+			}
+			exists = resp != nil
+		}
+		if exists {
+			plan.add(provisionUnchanged, "transit key "+path, "", nil)
+		} else {
+			plan.add(provisionCreate, "transit key "+path, "", func() error {
+				_, err := client.Logical().Write(path, map[string]interface{}{})
+				return err
+			})
+		}
+	}
+
+	// goldfish's own policy
+	rules := goldfishPolicy(cfg.Vault.Runtime_config, backend, serverKey)
+	current, err := client.Sys().GetPolicy("goldfish")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case current == "":
+		plan.add(provisionCreate, "policy goldfish", "", func() error {
+			return client.Sys().PutPolicy("goldfish", rules)
+		})
+	case strings.TrimSpace(current) != strings.TrimSpace(rules):
+		plan.add(provisionUpdate, "policy goldfish", "rules differ from what this version needs", func() error {
+			return client.Sys().PutPolicy("goldfish", rules)
+		})
+	default:
+		plan.add(provisionUnchanged, "policy goldfish", "", nil)
+	}
+
+	// approle auth backend, role and role id
+	approleMount, err := approleMountPath(cfg.Vault.Approle_login)
+	if err != nil {
+		return nil, err
+	}
+	auths, err := client.Sys().ListAuth()
+	if err != nil {
+		return nil, err
+	}
+	_, approleMounted := auths[approleMount+"/"]
+	if approleMounted {
+		plan.add(provisionUnchanged, "auth "+approleMount+"/", "approle auth backend", nil)
+	} else {
+		plan.add(provisionCreate, "auth "+approleMount+"/", "approle auth backend", func() error {
+			return client.Sys().EnableAuthWithOptions(approleMount, &api.EnableAuthOptions{
+				Type: "approle",
+			})
+		})
+	}
+
+	rolePath := "auth/" + approleMount + "/role/" + roleName
+	var role map[string]interface{}
+	if approleMounted {
+		resp, err := client.Logical().Read(rolePath)
+		if err != nil {
+			return nil, err
+		}
+		if resp != nil {
+			role = resp.Data
+		}
+	}
+	writeRole := func() error {
+		_, err := client.Logical().Write(rolePath, goldfishApprole)
+		return err
+	}
+	switch {
+	case role == nil:
+		plan.add(provisionCreate, "approle role "+roleName, "", writeRole)
+	case !approleMatches(role):
+		plan.add(provisionUpdate, "approle role "+roleName, "policies or ttls differ", writeRole)
+	default:
+		plan.add(provisionUnchanged, "approle role "+roleName, "", nil)
+	}
+
+	roleID := ""
+	if role != nil {
+		resp, err := client.Logical().Read(rolePath + "/role-id")
+		if err != nil {
+			return nil, err
+		}
+		if resp != nil {
+			roleID, _ = resp.Data["role_id"].(string)
+		}
+	}
+	if roleID == cfg.Vault.Approle_id {
+		plan.add(provisionUnchanged, "approle role id "+roleName, "", nil)
+	} else {
+		action := provisionUpdate
+		if roleID == "" {
+			action = provisionCreate
+		}
+		plan.add(action, "approle role id "+roleName, "set to vault.approle_id", func() error {
+			_, err := client.Logical().Write(rolePath+"/role-id", map[string]interface{}{
+				"role_id": cfg.Vault.Approle_id,
+			})
+			return err
+		})
+	}
+
+	// runtime config. Values operators have set are never overwritten
+	switch {
+	case len(runtimeConfig) == 0:
+		plan.add(provisionCreate, "runtime config "+cfg.Vault.Runtime_config, "", func() error {
+			_, err := client.Logical().Write(cfg.Vault.Runtime_config, runtimeConfigDefaults)
+			return err
+		})
+	case len(missing) > 0:
+		plan.add(provisionUpdate, "runtime config "+cfg.Vault.Runtime_config,
+			"adds "+strings.Join(sortedKeys(missing), ", "), func() error {
+				merged := map[string]interface{}{}
+				for k, v := range runtimeConfig {
+					merged[k] = v
+				}
+				for k, v := range missing {
+					merged[k] = v
+				}
+				_, err := client.Logical().Write(cfg.Vault.Runtime_config, merged)
+				return err
+			})
+	default:
+		plan.add(provisionUnchanged, "runtime config "+cfg.Vault.Runtime_config, "", nil)
+	}
+
+	return plan, nil
+}
+
+func (plan *ProvisionPlan) add(action, resource, detail string, apply func() error) {
+	plan.Steps = append(plan.Steps, ProvisionStep{
+		Action:   action,
+		Resource: resource,
+		Detail:   detail,
+		apply:    apply,
+	})
+}
+
+// the number of steps that would change vault
+func (plan *ProvisionPlan) Changes() int {
+	n := 0
+	for _, step := range plan.Steps {
+		if step.Action != provisionUnchanged {
+			n++
+		}
+	}
+	return n
+}
+
+// writes the plan in a terraform-like format
+func (plan *ProvisionPlan) Print(w io.Writer) {
+	counts := map[string]int{}
+	for _, step := range plan.Steps {
+		symbol := map[string]string{
+			provisionCreate:    "+",
+			provisionUpdate:    "~",
+			provisionUnchanged: " ",
+		}[step.Action]
+		line := fmt.Sprintf("  %s %s", symbol, step.Resource)
+		if step.Detail != "" {
+			line += " (" + step.Detail + ")"
+		}
+		fmt.Fprintln(w, line)
+		counts[step.Action]++
+	}
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d unchanged.\n",
+		counts[provisionCreate], counts[provisionUpdate], counts[provisionUnchanged])
+}
+
+// makes the planned changes in order, stopping at the first failure
+func (plan *ProvisionPlan) Apply(w io.Writer) error {
+	for _, step := range plan.Steps {
+		if step.apply == nil {
+			continue
+		}
+		if err := step.apply(); err != nil {
+			return fmt.Errorf("%s %s: %s", step.Action, step.Resource, err.Error())
+		}
+		fmt.Fprintf(w, "  %sd %s\n", step.Action, step.Resource)
+	}
+	return nil
+}
+
+// asks for confirmation on r, as terraform does. Only "yes" is accepted
+func ConfirmProvision(r io.Reader, w io.Writer) bool {
+	fmt.Fprint(w, "\nApply these changes? Only 'yes' will be accepted: ")
+	answer, _ := bufio.NewReader(r).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
+
+func provisionClient(v *VaultConfig, token string) (*api.Client, error) {
+	config := api.DefaultConfig()
+	if v.Tls_skip_verify {
+		config.HttpClient.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SetAddress(v.Address); err != nil {
+		return nil, err
+	}
+	client.SetToken(token)
+	return client, nil
+}
+
+// the mount of the approle backend, from a login path such as "auth/approle/login"
+func approleMountPath(login string) (string, error) {
+	login = strings.Trim(login, "/")
+	if !strings.HasPrefix(login, "auth/") || !strings.HasSuffix(login, "/login") {
+		return "", errors.New("vault.approle_login must look like auth/<mount>/login")
+	}
+	mount := strings.TrimSuffix(strings.TrimPrefix(login, "auth/"), "/login")
+	if mount == "" {
+		return "", errors.New("vault.approle_login must look like auth/<mount>/login")
+	}
+	return mount, nil
+}
+
+// true if an existing role has goldfish's policies and ttls
+func approleMatches(role map[string]interface{}) bool {
+	policies := map[string]bool{}
+	switch p := role["policies"].(type) {
+	case []interface{}:
+		for _, name := range p {
+			if s, ok := name.(string); ok {
+				policies[s] = true
+			}
+		}
+	case string:
+		for _, name := range strings.Split(p, ",") {
+			policies[strings.TrimSpace(name)] = true
+		}
+	}
+	if !policies["default"] || !policies["goldfish"] {
+		return false
+	}
+	return fmt.Sprint(role["secret_id_ttl"]) == "300" &&
+		fmt.Sprint(role["secret_id_num_uses"]) == "1" &&
+		fmt.Sprint(role["token_ttl"]) == "1728000"
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// the policy goldfish's approle needs, for its runtime config path and server transit key
+func goldfishPolicy(runtimeConfig, transitBackend, serverKey string) string {
+	return fmt.Sprintf(`
+# [mandatory]
+# credential transit key (stores logon tokens)
+# NO OTHER POLICY should be able to write to this key
+path "%[2]s/encrypt/%[3]s" {
+  capabilities = ["read", "update"]
+}
+path "%[2]s/decrypt/%[3]s" {
+  capabilities = ["read", "update"]
+}
+
+# [mandatory] [changable]
+# store goldfish run-time settings here
+# goldfish hot-reloads from this endpoint every minute, and timestamps each change
+path "%[1]s*" {
+  capabilities = ["create", "read", "update"]
+}
+
+# [mandatory]
+# requests, approvals and other state goldfish keeps in its token's cubbyhole
+path "cubbyhole/*" {
+  capabilities = ["create", "read", "update", "delete", "list"]
+}
+
+# [mandatory]
+# identity lookups, for approvals and roles by entity and group
+path "identity/entity/id/*" {
+  capabilities = ["read"]
+}
+path "identity/group/id/*" {
+  capabilities = ["read"]
+}
+`, strings.Trim(runtimeConfig, "/"), transitBackend, serverKey)
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGoldfishPolicy(t *testing.T) {
+	Convey("The generated policy should cover everything goldfish's token uses", t, func(c C) {
+		var policy struct {
+			Path map[string]struct {
+				Capabilities []string
+			}
+		}
+		err := hcl.Decode(&policy, goldfishPolicy("/secret/goldfish/", "transit", "goldfish"))
+		c.So(err, ShouldBeNil)
+
+		c.So(policy.Path["transit/encrypt/goldfish"].Capabilities, ShouldResemble, []string{"read", "update"})
+		c.So(policy.Path["transit/decrypt/goldfish"].Capabilities, ShouldResemble, []string{"read", "update"})
+		c.So(policy.Path["secret/goldfish*"].Capabilities, ShouldResemble, []string{"create", "read", "update"})
+		c.So(policy.Path["cubbyhole/*"].Capabilities, ShouldResemble,
+			[]string{"create", "read", "update", "delete", "list"})
+		c.So(policy.Path["identity/entity/id/*"].Capabilities, ShouldResemble, []string{"read"})
+		c.So(policy.Path["identity/group/id/*"].Capabilities, ShouldResemble, []string{"read"})
+		c.So(len(policy.Path), ShouldEqual, 6)
+	})
+}
+
+func TestApproleMountPath(t *testing.T) {
+	Convey("The approle mount should be read from its login path", t, func(c C) {
+		mount, err := approleMountPath("/auth/approle/login")
+		c.So(err, ShouldBeNil)
+		c.So(mount, ShouldEqual, "approle")
+
+		mount, err = approleMountPath("auth/team/approle/login")
+		c.So(err, ShouldBeNil)
+		c.So(mount, ShouldEqual, "team/approle")
+
+		for _, login := range []string{"approle/login", "auth/approle", "auth//login"} {
+			_, err = approleMountPath(login)
+			c.So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestApproleMatches(t *testing.T) {
+	Convey("An existing role should only match with goldfish's policies and ttls", t, func(c C) {
+		role := map[string]interface{}{
+			"policies":           []interface{}{"default", "goldfish"},
+			"secret_id_ttl":      300,
+			"secret_id_num_uses": 1,
+			"token_ttl":          1728000,
+		}
+		c.So(approleMatches(role), ShouldBeTrue)
+
+		role["policies"] = "goldfish, default"
+		c.So(approleMatches(role), ShouldBeTrue)
+
+		role["policies"] = "goldfish"
+		c.So(approleMatches(role), ShouldBeFalse)
+
+		role["policies"] = "default,goldfish"
+		role["secret_id_num_uses"] = 0
+		c.So(approleMatches(role), ShouldBeFalse)
+	})
+}
+
+func TestProvisionPlan(t *testing.T) {
+	Convey("A plan should count, print and apply its changes in order", t, func(c C) {
+		applied := []string{}
+		apply := func(name string) func() error {
+			return func() error {
+				applied = append(applied, name)
+				return nil
+			}
+		}
+
+		plan := &ProvisionPlan{}
+		plan.add(provisionUnchanged, "transit mount transit/", "", nil)
+		plan.add(provisionCreate, "policy goldfish", "", apply("policy"))
+		plan.add(provisionUpdate, "approle role goldfish", "policies or ttls differ", apply("role"))
+		c.So(plan.Changes(), ShouldEqual, 2)
+
+		var out bytes.Buffer
+		plan.Print(&out)
+		c.So(out.String(), ShouldEqual, strings.Join([]string{
+			"    transit mount transit/",
+			"  + policy goldfish",
+			"  ~ approle role goldfish (policies or ttls differ)",
+			"",
+			"Plan: 1 to create, 1 to update, 1 unchanged.",
+			"",
+		}, "\n"))
+
+		out.Reset()
+		c.So(plan.Apply(&out), ShouldBeNil)
+		c.So(applied, ShouldResemble, []string{"policy", "role"})
+		c.So(out.String(), ShouldEqual, "  created policy goldfish\n  updated approle role goldfish\n")
+
+		c.Convey("Applying should stop at the first failure", func(c C) {
+			applied = []string{}
+			plan := &ProvisionPlan{}
+			plan.add(provisionCreate, "policy goldfish", "", func() error { return errors.New("permission denied") })
+			plan.add(provisionCreate, "approle role goldfish", "", apply("role"))
+
+			err := plan.Apply(&bytes.Buffer{})
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldEqual, "create policy goldfish: permission denied")
+			c.So(applied, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Provisioning should only be confirmed with yes", t, func(c C) {
+		c.So(ConfirmProvision(strings.NewReader("yes\n"), &bytes.Buffer{}), ShouldBeTrue)
+		c.So(ConfirmProvision(strings.NewReader("y\n"), &bytes.Buffer{}), ShouldBeFalse)
+		c.So(ConfirmProvision(strings.NewReader(""), &bytes.Buffer{}), ShouldBeFalse)
+	})
+}
@@ -1,14 +1,24 @@
+# Any value of the listener, vault, coordinator, log, tracing and login_limit blocks, including
+# blocks nested in the listener, can also be set outside this file, which takes precedence:
+#   with environment variables:  GOLDFISH_VAULT_ADDRESS="https://vault:8200"
+#                                GOLDFISH_LISTENER_HEADERS_HSTS_MAX_AGE=0
+#   with flags, which win over environment variables:
+#                                -set vault.address=https://vault:8200
+#                                -set listener.headers.hsts_max_age=0
+# With these, -config can be left out entirely. Clusters and audit sinks are only set in this file
+
 # [Required] listener defines how goldfish will listen to incoming connections
 listener "tcp" {
-	# [Required] [Format: "address", "address:port", or ":port"]
+	# [Required] [Format: "address", "address:port", ":port" or "unix:///path/to/socket"]
 	# The address and port at which goldfish will listen from
 	# For production, simply ":443" would be just fine (default https)
+	# Behind a local reverse proxy, a unix socket avoids opening a TCP port at all
 	address       = "127.0.0.1:8000"
 
-	# [Required (unless tls_disable = 1)] the certificate file
+	# [Required (unless tls_disable = 1, or an acme block is given)] the certificate file
 	tls_cert_file = ""
 
-	# [Required (unless tls_disable = 1)] the private key file
+	# [Required (unless tls_disable = 1, or an acme block is given)] the private key file
 	tls_key_file  = ""
 
 	# [Optional] [Default: 0] [Allowed values: 0, 1]
@@ -19,6 +29,147 @@ listener "tcp" {
 	# [Optional] [Default: 0] [Allowed values: 0, 1]
 	# If this is set to 1, goldfish will redirect port 80 to port 443
 	tls_autoredirect = 0
+
+	# [Optional] [Format: "mount/issue/role"]
+	# Instead of tls_cert_file and tls_key_file, goldfish can request its certificate from a vault
+	# PKI role at startup, with its own token, and renew it two thirds into its lifetime.
+	# Goldfish's policy needs update access to this path
+	# tls_pki_path        = "pki/issue/goldfish"
+
+	# [Required (if tls_pki_path is set)] the certificate's common name
+	# tls_pki_common_name = "goldfish.example.com"
+
+	# [Optional] [Format: comma separated hostnames] further names the certificate is valid for
+	# tls_pki_alt_names   = "goldfish.internal"
+
+	# [Optional] [Default: the role's ttl] how long each certificate is valid for
+	# tls_pki_ttl         = "72h"
+
+	# [Optional] [Format: "address:port" or ":port"]
+	# Prometheus metrics are served at /metrics over plain http on this address only, e.g. for an
+	# internal port. They are not served at all unless this is set, as they need no login
+	# metrics_address = "127.0.0.1:9090"
+
+	# [Optional] [Default: "30s"]
+	# On SIGTERM or SIGINT, goldfish stops accepting connections and gives in-flight requests
+	# this long to finish, then revokes its own vault token and exits
+	# shutdown_timeout = "30s"
+
+	# [Optional] [Defaults: "10s", "5m", "5m", "2m"] [Format: duration, "0" for no limit]
+	# How long a client may take to send its request headers, or its whole request, how long
+	# a response may take to write, and how long an idle keep-alive connection is kept open.
+	# Short header timeouts keep slow clients from tying up connections (slowloris), while
+	# large transit payloads or raft snapshots may need longer read and write timeouts
+	# read_header_timeout = "10s"
+	# read_timeout        = "5m"
+	# write_timeout       = "5m"
+	# idle_timeout        = "2m"
+
+	# [Optional] [Default: 1048576] the largest request headers accepted, in bytes
+	# max_header_bytes    = 1048576
+
+	# [Optional] [Default: 1] [Allowed values: 0, 1]
+	# Set this to 0 to only serve HTTP/1.1 over https
+	# http2               = 1
+
+	# [Optional] [Format: octal permissions, e.g. "0660"]
+	# Only valid when address is a unix socket. Sets the permissions of the socket file,
+	# which are otherwise left to the umask. The reverse proxy needs read and write access
+	# socket_mode = "0660"
+
+	# [Optional] [Format: comma separated addresses and CIDRs]
+	# Reverse proxies whose X-Forwarded-For, X-Real-IP and X-Forwarded-Proto headers are believed,
+	# so the client's address is logged and rate limited rather than the proxy's.
+	# These headers are dropped from any other peer. Connections over a unix socket always
+	# come from a local proxy, so their headers are believed
+	# trusted_proxies = "10.0.0.0/8, 127.0.0.1"
+
+	# [Optional] [Default: ""] [Format: "/prefix/"]
+	# Serves goldfish under a URL prefix, for a proxy routing e.g. https://example.com/goldfish/ to it
+	# without rewriting the path. Paths without the prefix keep working, e.g. for probes
+	# base_path = "/goldfish/"
+
+	# [Optional] [Format: comma separated addresses and CIDRs]
+	# Restricts which client addresses may use goldfish. A denied address is always refused, and
+	# if an allow list is set, addresses outside of it are refused too. The admin lists apply to
+	# the admin endpoints on top of the others, i.e. /api/sys/, /api/mounts, /api/auth,
+	# /api/audit, /api/settings and the others only the admin role may reach, e.g. to keep
+	# unsealing and rekeying on the corporate network. /healthz and /readyz are exempt, so
+	# probes keep working
+	# allowed_networks       = "0.0.0.0/0, ::/0"
+	# denied_networks        = "192.0.2.0/24"
+	# admin_allowed_networks = "10.0.0.0/8"
+	# admin_denied_networks  = ""
+
+	# [Optional] lets a frontend hosted on another origin call goldfish's api from the browser
+	# cors {
+		# [Required] [Format: comma separated origins, or "*"]
+		# allowed_origins   = "https://ui.example.com"
+
+		# [Optional] [Default: "GET,HEAD,PUT,PATCH,POST,DELETE"]
+		# allowed_methods   = "GET,POST,DELETE"
+
+		# [Optional] [Default: 0] [Allowed values: 0, 1]
+		# Set this to 1 to let the browser send goldfish's cookies, i.e. the session and csrf token.
+		# Cookies are not marked SameSite=None, so this works for origins on the same site,
+		# e.g. ui.example.com calling goldfish.example.com. Can't be used with "*"
+		# allow_credentials = 0
+	# }
+
+	# [Optional] security headers sent with every response. Setting one to "" leaves it out
+	# headers {
+		# [Optional] [Default: "default-src 'self'"]
+		# content_security_policy = "default-src 'self'"
+
+		# [Optional] [Default: "SAMEORIGIN"] [Allowed values: "DENY", "SAMEORIGIN", ""]
+		# frame_options           = "SAMEORIGIN"
+
+		# [Optional] [Default: "same-origin"]
+		# referrer_policy         = "same-origin"
+
+		# [Optional] [Default: 31536000] seconds browsers should only use https, 0 leaves HSTS out
+		# Only sent over https, including https terminated by a trusted proxy
+		# hsts_max_age            = 31536000
+
+		# [Optional] [Default: 0] [Allowed values: 0, 1]
+		# hsts_include_subdomains = 0
+	# }
+
+	# [Optional] gzips responses for clients that accept it, which helps with large policy lists
+	# and secret trees over slow links. Images, fonts and archives are sent as they are.
+	# Compressing responses that mix secrets with attacker-controlled input over https can leak
+	# those secrets (BREACH), so only enable this if transfer size matters more
+	# compression {
+		# [Optional] [Default: 6] [Allowed values: 1 (fastest) to 9 (smallest)]
+		# level = 6
+	# }
+
+	# [Optional] without tls_cert_file and tls_key_file, goldfish listens on :443 and gets
+	# certificates from an ACME CA such as Let's Encrypt. Without this block, the address is
+	# taken as the only hostname
+	# acme {
+		# [Required] [Format: comma separated hostnames]
+		# hostnames     = "goldfish.example.com, vault-ui.example.com"
+
+		# [Optional] [Default: "/var/www/.cache"] where the account key and certificates are kept
+		# cache_dir     = "/var/www/.cache"
+
+		# [Optional] the CA's contact for problems with the certificates
+		# email         = "ops@example.com"
+
+		# [Optional] [Default: "http-01"] [Allowed values: "http-01", "dns-01"]
+		# http-01 is answered on port 80, so it must be reachable from the CA. dns-01 is answered
+		# with a TXT record instead. Either way, one certificate covers all hostnames
+		# challenge     = "dns-01"
+
+		# [Required (if challenge = "dns-01")] the program that creates and removes TXT records.
+		# It is run as: dns_hook present|cleanup _acme-challenge.<hostname> <value>
+		# and should only exit once the record is visible to the CA
+		# dns_hook      = "/usr/local/bin/goldfish-dns-hook"
+
+		# [Optional] [Default: Let's Encrypt] the CA's ACME directory
+		# directory_url = "https://acme-v02.api.letsencrypt.org/directory"
+	# }
 }
 
 # [Required] vault defines how goldfish should bootstrap to vault
@@ -43,4 +194,158 @@ vault {
 	# [Optional] [Default: "goldfish"]
 	# You can omit this if you already customized the approle ID to be 'goldfish'
 	approle_id      = "goldfish"
+
+	# [Optional] [Default: 0] [Allowed values: 0, 1]
+	# Set this to 1 to keep the unwrapped secret_id in memory, so goldfish can log in again when
+	# its token reaches its max TTL or is revoked, instead of needing a restart with a new -token.
+	# The approle's secret_id must allow more than one use (secret_id_num_uses). Whichever way
+	# goldfish logs in again, the new token starts with an empty cubbyhole, as after a restart
+	# The kubernetes and aws auth methods below always log in again when they need to
+	approle_relogin = 0
+
+	# [Optional] [Default: "approle"] [Allowed values: "approle", "kubernetes", "aws", "token_file"]
+	# How goldfish logs in to vault for its own token. approle needs a wrapped secret_id passed
+	# with -token at every start. kubernetes and aws log in with the pod's service account, or
+	# the instance's IAM credentials, so nothing has to be handed to goldfish when it starts.
+	# token_file uses a token that something else, such as vault agent, writes to a file
+	# auth_method     = "approle"
+
+	# [Optional] [Defaults: "auth/kubernetes/login", "goldfish", the pod's service account token]
+	# Only used with auth_method "kubernetes"
+	# kubernetes_login    = "auth/kubernetes/login"
+	# kubernetes_role     = "goldfish"
+	# kubernetes_jwt_file = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	# [Optional] [Defaults: "auth/aws/login", "goldfish", ""]
+	# Only used with auth_method "aws". Logs in with the iam method, using credentials from the
+	# environment, ~/.aws/credentials or the instance profile. Set aws_header_value if the aws
+	# backend requires an X-Vault-AWS-IAM-Server-ID header
+	# aws_login           = "auth/aws/login"
+	# aws_role            = "goldfish"
+	# aws_header_value    = "vault.example.com"
+
+	# [Required with auth_method "token_file"]
+	# The file holding goldfish's token, unwrapped, e.g. a file sink of vault agent's auto-auth.
+	# It is checked every few seconds, and goldfish switches over when a new token is written.
+	# The token is renewed by whatever writes it, and not revoked when goldfish stops.
+	# goldfish keeps pending requests in its token's cubbyhole, and copies them to the new
+	# token when it switches over. The old token must still be valid then, so whatever writes
+	# the file must not revoke a token as soon as it writes the next one, or they are lost
+	# token_file          = "/var/run/vault-agent/goldfish-token"
+
+	# [Optional] [Default: 10]
+	# How many times to retry reaching vault on startup, e.g. when it is still starting or sealed
+	# Set to 0 to fail immediately. Errors vault reports about the request itself are never retried
+	startup_retries = 10
+
+	# [Optional] [Default: "2s"]
+	# The wait before the first retry. It doubles after each attempt, up to a minute
+	startup_retry_interval = "2s"
+
+	# [Optional] [Default: "1m"]
+	# How often the runtime config is re-read from vault. SIGHUP re-reads it at once
+	runtime_config_interval = "1m"
 }
+
+# [Optional] coordinator routes state mutations (policy requests, approvals, settings, cleanup)
+# of many goldfish replicas through a single one, so they can't race on shared state
+# Forwarded requests are sent over mutual TLS, and signed with the ReplicaSigningKey
+# field of the runtime config
+# coordinator {
+	# [Required on replicas] [Format: "https://address:port"]
+	# The coordinator's listen address. Set either this or listen, not both
+	# address       = "https://goldfish-coordinator:8443"
+
+	# [Required on the coordinator] [Format: "address:port" or ":port"]
+	# Where the coordinator accepts requests forwarded by replicas
+	# listen        = ":8443"
+
+	# [Required] this node's certificate and key, presented to the other side
+	# tls_cert_file = ""
+	# tls_key_file  = ""
+
+	# [Required] the CA that issued the certificates of the coordinator and every replica
+	# tls_ca_file   = ""
+# }
+
+# [Optional] log sets how goldfish logs requests and events
+# log {
+	# [Optional] [Default: "text"] [Allowed values: "text", "json"]
+	# json writes one object per line, e.g. for ELK or Loki. Requests are logged with the
+	# X-Request-ID sent to vault, which vault's audit log records once told to with
+	# vault write sys/config/auditing/request-headers/x-request-id hmac=false
+	# format = "json"
+
+	# [Optional] [Default: "info"] [Allowed values: "debug", "info", "warn", "error"]
+	# Audit and incident lines are logged whatever the level
+	# level  = "info"
+# }
+
+# [Optional] audit records every state-changing action taken through goldfish: who, which
+# endpoint, which paths, and whether it succeeded. This is independent of vault's audit devices
+# There can be any number of them. An action is never failed because it couldn't be recorded
+# audit "file" {
+	# [Required] the file is only ever appended to, with one json object per line
+	# path = "/var/log/goldfish/audit.log"
+# }
+# audit "syslog" {
+	# [Optional] [Default: "goldfish"] events are sent to the auth facility
+	# tag  = "goldfish"
+# }
+# audit "vault" {
+	# [Required] each event is written under this path with goldfish's server token,
+	# which needs create on it, e.g. path "secret/goldfish-audit/*" { capabilities = ["create"] }
+	# On a kv-v2 mount the token needs create on the data path instead,
+	# e.g. path "secret/data/goldfish-audit/*"
+	# path = "secret/goldfish-audit"
+# }
+
+# [Optional] tracing sends spans of every request, and of the vault calls made for it, to an
+# OpenTelemetry collector. Requests with a traceparent header continue the caller's trace
+# tracing {
+	# [Required] the collector's OTLP/HTTP traces endpoint. Spans are sent json encoded
+	# endpoint     = "http://otel-collector:4318/v1/traces"
+
+	# [Optional] [Default: "goldfish"]
+	# service_name = "goldfish"
+
+	# [Optional] [Default: 1] the share of new traces that are recorded, from 0 to 1
+	# sample_ratio = 1
+# }
+
+# [Optional] login_limit slows down guessing of credentials. Once a client IP or a username has
+# failed to log in more times than allowed, logins from it are locked out for backoff, doubling
+# with each further failure up to max_lockout. Failures are forgotten after max_lockout without more.
+# These limits are on by default with the values below. Each goldfish replica keeps its own count
+# login_limit {
+	# [Optional] [Default: 20] failures allowed per client IP, 0 turns the limit off
+	# ip_attempts   = 20
+
+	# [Optional] [Default: 5] failures allowed per username, 0 turns the limit off
+	# user_attempts = 5
+
+	# [Optional] [Default: "1s"]
+	# backoff       = "1s"
+
+	# [Optional] [Default: "15m"]
+	# max_lockout   = "15m"
+# }
+
+# [Optional] clusters are other vaults that users may choose when logging in, e.g. staging
+# or prod. Goldfish keeps its own state on the vault above, so these need no runtime config
+# There can be any number of them, each with a unique name
+# cluster "staging" {
+	# [Required] [Format: "protocol://address:port"]
+	# address             = "https://vault.staging:8200"
+
+	# [Optional] [Default: 0] [Allowed values: 0, 1]
+	# tls_skip_verify     = 0
+
+	# [Optional] a file holding a wrapped secret_id of this cluster's approle, like -token
+	# If set, goldfish logs in to the cluster on startup and keeps its token renewed
+	# wrapping_token_file = "/etc/goldfish/staging-token"
+
+	# [Optional] [Defaults: "auth/approle/login", "goldfish"]
+	# approle_login       = "auth/approle/login"
+	# approle_id          = "goldfish"
+# }
@@ -32,7 +32,9 @@ exports.cssLoaders = options => {
     if (options.extract) {
       return ExtractTextPlugin.extract({
         fallback: 'style-loader',
-        use: sourceLoader
+        use: sourceLoader,
+        // stylesheets are emitted to assets/css/, and reference assets relative to the root
+        publicPath: '../../'
       })
     } else {
       return ['vue-style-loader', sourceLoader].join('!')
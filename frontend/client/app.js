@@ -11,6 +11,8 @@ import Notification from 'vue-bulma-notification'
 import Message from 'vue-bulma-message'
 import hljs from 'highlight.js'
 
+// the api is served under the same path as the page, i.e. the listener's base_path, if any
+axios.defaults.baseURL = window.location.pathname.replace(/\/[^/]*$/, '')
 Vue.prototype.$http = axios
 Vue.axios = axios
 Vue.use(NProgress)
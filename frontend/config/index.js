@@ -9,7 +9,7 @@ module.exports = {
     index: path.resolve(__dirname, '../../public/index.html'),
     assetsRoot: path.resolve(__dirname, '../../public'),
     assetsSubDirectory: 'assets',
-    assetsPublicPath: '/',
+    assetsPublicPath: '',
     productionSourceMap: true,
     // Gzip off by default as many popular static hosts such as
     // Surge or Netlify already gzip all static assets for you.
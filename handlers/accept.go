@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// true if the client's Accept header prefers text/plain over JSON
+// screen readers and text-only clients can request plain alternatives of generated artifacts this way
+func prefersPlainText(c echo.Context) bool {
+	accept := c.Request().Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+	return acceptQuality(accept, "text", "plain") > acceptQuality(accept, "application", "json")
+}
+
+// returns the q-value the Accept header gives a media type, honouring wildcards
+// the most specific matching range wins, as per RFC 7231
+func acceptQuality(accept, kind, subtype string) float64 {
+	best, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		s := -1
+		switch mediaRange {
+		case kind + "/" + subtype:
+			s = 2
+		case kind + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s > specificity {
+			best, specificity = q, s
+		}
+	}
+	return best
+}
+
+// responds with the plain text alternative if the client prefers it, otherwise with JSON
+func respondArtifact(c echo.Context, rich H, plain string) error {
+	if prefersPlainText(c) {
+		return c.String(http.StatusOK, plain)
+	}
+	return c.JSON(http.StatusOK, rich)
+}
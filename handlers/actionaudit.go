@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caiyeon/goldfish/audit"
+	"github.com/labstack/echo"
+)
+
+// form values that name the vault paths an action works on. Other values may be secrets
+var auditedFormValues = []string{"path", "src", "dst"}
+
+// records every state-changing api request to the configured audit sinks
+func AuditActions() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if !audit.Enabled() || !strings.HasPrefix(req.URL.Path, "/api/") {
+				return next(c)
+			}
+			switch req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(c)
+			}
+
+			// the session is identified first, as the action may end it, e.g. by revoking its token
+			user := incidentUser(c)
+			start := time.Now()
+			err := next(c)
+			status := c.Response().Status
+			if err != nil {
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				} else {
+					status = http.StatusInternalServerError
+				}
+			}
+
+			params := map[string]string{}
+			for i, name := range c.ParamNames() {
+				if i < len(c.ParamValues()) {
+					params[name] = c.ParamValues()[i]
+				}
+			}
+			for _, name := range auditedFormValues {
+				if value := c.FormValue(name); value != "" {
+					params[name] = value
+				}
+			}
+
+			audit.Record(audit.Event{
+				Time:      start,
+				RequestID: requestID(c),
+				User:      user,
+				RemoteIP:  c.RealIP(),
+				Method:    req.Method,
+				Endpoint:  c.Path(),
+				Params:    params,
+				Reason:    actionReasonOf(c),
+				Status:    status,
+			})
+			return err
+		}
+	}
+}
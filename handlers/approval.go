@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// returns a display name, and a hash that identifies the person behind the session without
+// revealing anything usable. It is of the token's entity, so that logging in again doesn't
+// make someone else, or of the display name for tokens without one, such as those of the
+// token backend. A hash of the accessor would let anyone approve their own requests
+func sessionIdentity(auth *vault.AuthInfo) (string, string, error) {
+	self, err := auth.LookupSelf()
+	if err != nil {
+		return "", "", err
+	}
+	name, ok := self.Data["display_name"].(string)
+	if !ok {
+		return "", "", errors.New("Could not parse display name")
+	}
+	return name, identityHash(self.Data), nil
+}
+
+func identityHash(self map[string]interface{}) string {
+	if entityID, _ := self["entity_id"].(string); entityID != "" {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte("entity:"+entityID)))
+	}
+	name, _ := self["display_name"].(string)
+	return fmt.Sprintf("%x", sha256.Sum256([]byte("name:"+name)))
+}
+
+// requests are seen and approved from sessions on the cluster they were made on, whose
+// capabilities are the ones that count
+func sameCluster(auth *vault.AuthInfo, cluster string) error {
+	if auth.Cluster == cluster {
+		return nil
+	}
+	if cluster == "" {
+		return errors.New("The request was made on the default cluster, log in to it to see the request")
+	}
+	return errors.New("The request was made on cluster " + cluster + ", log in to it to see the request")
+}
+
+// Opens a request to read a secret on a two-person path
+func RequestRevealApproval() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		path := c.FormValue("path")
+		if !vault.RequiresRevealApproval(path) {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Path does not require approval",
+			})
+		}
+
+		name, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		approval, err := vault.CreateRevealApproval(path, name, hash)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		log.Println("[AUDIT]:", name, "requested approval to read", path, "approval", approval.ID)
+		return c.JSON(http.StatusOK, H{
+			"result": approval,
+		})
+	}
+}
+
+// Shows an approval request, so a second person can decide on it
+// Only those that can read the path themselves may see or approve requests for it
+func GetRevealApproval() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		approval, err := vault.GetRevealApproval(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if ok, err := canRead(auth, approval.Path); err != nil {
+			return parseError(c, err)
+		} else if !ok {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You cannot read the path of this request",
+			})
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": approval,
+		})
+	}
+}
+
+func ApproveReveal() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		approval, err := vault.GetRevealApproval(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if ok, err := canRead(auth, approval.Path); err != nil {
+			return parseError(c, err)
+		} else if !ok {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You cannot read the path of this request",
+			})
+		}
+
+		name, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		approval, err = vault.ApproveReveal(approval.ID, name, hash)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		log.Println("[AUDIT]:", name, "approved", approval.Requester, "to read", approval.Path, "approval", approval.ID)
+		return c.JSON(http.StatusOK, H{
+			"result": approval,
+		})
+	}
+}
+
+func canRead(auth *vault.AuthInfo, path string) (bool, error) {
+	capabilities, err := auth.CapabilitiesSelf(path)
+	if err != nil {
+		return false, err
+	}
+	for _, capability := range capabilities {
+		if capability == "read" || capability == "root" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// true if the session could make a secret request's change itself: update or create
+// for writes, delete for deletions. goldfish's token makes the change, so this is
+// what keeps readers from getting a path overwritten
+func canChange(auth *vault.AuthInfo, path, operation string) (bool, error) {
+	capabilities, err := auth.CapabilitiesSelf(path)
+	if err != nil {
+		return false, err
+	}
+	for _, capability := range capabilities {
+		switch {
+		case capability == "root":
+			return true, nil
+		case operation == vault.SecretRequestWrite && (capability == "update" || capability == "create"):
+			return true, nil
+		case operation == vault.SecretRequestDelete && capability == "delete":
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Attachments follow the visibility of their request: those that can read the
+// request's policy can list, add and download them
+
+// returns the policy request with the change ID, if the session may see it
+// a nil request means the change ID does not exist
+func visiblePolicyRequest(auth *vault.AuthInfo, hash string) (*PolicyRequest, error) {
+	resp, err := vault.ReadFromCubbyhole("requests/" + hash)
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	var request PolicyRequest
+	if err := mapstructure.Decode(resp.Data, &request); err != nil || request.Policy == "" {
+		return nil, nil
+	}
+	if _, err := currentPolicies(auth, request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func GetAttachments() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		if request, err := visiblePolicyRequest(auth, c.Param("id")); err != nil {
+			return parseError(c, err)
+		} else if request == nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Change ID not found",
+			})
+		}
+
+		attachments, err := vault.ListAttachments(c.Param("id"))
+		if err != nil {
+			return logError(c, err.Error(), "Could not read attachments")
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result":   attachments,
+			"max_size": vault.AttachmentMaxSize(),
+		})
+	}
+}
+
+// Attaches the uploaded 'file' to a policy request
+func AddAttachment() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		hash := c.Param("id")
+		if request, err := visiblePolicyRequest(auth, hash); err != nil {
+			return parseError(c, err)
+		} else if request == nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Change ID not found",
+			})
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "A file must be uploaded",
+			})
+		}
+		if header.Size > int64(vault.AttachmentMaxSize()) {
+			return c.JSON(http.StatusRequestEntityTooLarge, H{
+				"error": fmt.Sprintf("Attachments may be at most %d bytes", vault.AttachmentMaxSize()),
+			})
+		}
+		file, err := header.Open()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Could not read uploaded file",
+			})
+		}
+		defer file.Close()
+		content, err := ioutil.ReadAll(file)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Could not read uploaded file",
+			})
+		}
+
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		contentType := header.Header.Get(echo.HeaderContentType)
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			contentType = echo.MIMEOctetStream
+		}
+
+		attachment, err := vault.AddAttachment(hash, vault.Attachment{
+			Name:        filepath.Base(filepath.Clean("/" + header.Filename)),
+			ContentType: contentType,
+			Uploader:    name,
+		}, content)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		log.Println("[AUDIT]:", name, "attached", attachment.Name, attachment.SHA256, "to request", hash)
+		return c.JSON(http.StatusOK, H{
+			"result": attachment,
+		})
+	}
+}
+
+func DownloadAttachment() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		hash := c.Param("id")
+		if request, err := visiblePolicyRequest(auth, hash); err != nil {
+			return parseError(c, err)
+		} else if request == nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Change ID not found",
+			})
+		}
+
+		attachment, content, err := vault.ReadAttachment(hash, c.Param("sha"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, H{
+				"error": err.Error(),
+			})
+		}
+
+		// never let the browser render uploaded content in goldfish's origin
+		c.Response().Header().Set("Content-Disposition",
+			mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+		c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+		return c.Blob(http.StatusOK, attachment.ContentType, content)
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+func GetAuditDevices() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		devices, err := auth.ListAuditDevices()
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+
+		return c.JSON(http.StatusOK, H{
+			"result": devices,
+		})
+	}
+}
+
+// enables a file, syslog or socket audit device from a JSON AuditDevice
+func EnableAuditDevice() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var device vault.AuditDevice
+		if err := c.Bind(&device); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid audit device format",
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.EnableAuditDevice(device); err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "enabled", device.Type, "audit device", device.Path)
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Audit device enabled",
+		})
+	}
+}
+
+// disables an audit device. The device's path must be typed as confirmation
+func DisableAuditDevice() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		path := c.Param("path")
+		if strings.Trim(c.QueryParam("confirm"), "/") != strings.Trim(path, "/") {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Type the audit device's path to confirm disabling it",
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.DisableAuditDevice(path); err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "disabled audit device", path)
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Audit device disabled",
+		})
+	}
+}
+
+// hashes form value 'input' as the audit device would, to find it in the audit log
+func AuditHash() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		hash, err := auth.AuditHash(c.Param("path"), c.FormValue("input"))
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": hash,
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+func GetAuthMounts() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		mounts, err := auth.ListAuthMounts()
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+
+		return c.JSON(http.StatusOK, H{
+			"result": mounts,
+		})
+	}
+}
+
+func GetAuthMount() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		result, err := auth.GetAuthMount(c.Param("path"))
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// enables a new auth method from a JSON AuthMountSpec
+func EnableAuthMount() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var spec vault.AuthMountSpec
+		if err := c.Bind(&spec); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid auth method format",
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.EnableAuthMount(spec); err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "enabled", spec.Type, "auth method", spec.Path)
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Auth method enabled",
+		})
+	}
+}
+
+// tunes an auth method's TTLs, listing visibility or description from a JSON AuthTuneInput
+func TuneAuthMount() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var input vault.AuthTuneInput
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid config format",
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		path := c.Param("path")
+		if err := auth.TuneAuthMount(path, input); err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "tuned auth method", path)
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Auth method tuned",
+		})
+	}
+}
+
+// disables an auth method, revoking its tokens. The path must be typed as confirmation
+func DisableAuthMount() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		path := c.Param("path")
+		if strings.Trim(c.QueryParam("confirm"), "/") != strings.Trim(path, "/") {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Type the auth method's path to confirm disabling it. Every token issued through it will be revoked",
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.DisableAuthMount(path); err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "disabled auth method", path)
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Auth method disabled",
+		})
+	}
+}
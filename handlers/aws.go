@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Lists roles, or reads one if a name is given
+func GetAWSRoles() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var result interface{}
+		var err error
+		if name := c.QueryParam("name"); name == "" {
+			result, err = auth.ListAWSRoles(c.QueryParam("mount"))
+		} else {
+			result, err = auth.ReadAWSRole(c.QueryParam("mount"), name)
+		}
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// Generates IAM credentials for a role, or STS credentials if type=sts,
+// returning the lease alongside them so it can be revoked
+func GenerateAWSCredentials() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var sts bool
+		switch c.FormValue("type") {
+		case "", "iam":
+		case "sts":
+			sts = true
+		default:
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "type must be either iam or sts",
+			})
+		}
+
+		resp, err := auth.GenerateAWSCredentials(c.QueryParam("mount"), c.Param("role"), sts, c.FormValue("ttl"))
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": vault.LeasedSecret(resp),
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Lists roles, or reads one if a name is given
+func GetAzureRoles() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var result interface{}
+		var err error
+		if name := c.QueryParam("name"); name == "" {
+			result, err = auth.ListAzureRoles(c.QueryParam("mount"))
+		} else {
+			result, err = auth.ReadAzureRole(c.QueryParam("mount"), name)
+		}
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// Generates a service principal for a role, returning the lease alongside it
+func GenerateAzureCredentials() echo.HandlerFunc {
+	return generateCredentials("role", vault.AuthInfo.GenerateAzureCredentials)
+}
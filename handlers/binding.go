@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/labstack/echo"
+)
+
+// hashes the stable attributes of a client: its user agent, and any operator-configured headers
+func clientFingerprint(c echo.Context) string {
+	conf := vault.GetConfig()
+	h := sha256.New()
+	h.Write([]byte(c.Request().UserAgent()))
+	for _, header := range strings.Split(conf.SessionBindingHeaders, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			h.Write([]byte{0})
+			h.Write([]byte(c.Request().Header.Get(header)))
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// true if a session holding any of these policies must be bound to its client
+func bindingRequired(policies interface{}) bool {
+	conf := vault.GetConfig()
+	bound := map[string]bool{}
+	for _, p := range strings.Split(conf.SessionBindingPolicies, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			bound[p] = true
+		}
+	}
+	if len(bound) == 0 {
+		return false
+	}
+	if bound["*"] {
+		return true
+	}
+
+	list, _ := policies.([]interface{})
+	for _, p := range list {
+		if name, ok := p.(string); ok && bound[name] {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
 	"github.com/labstack/echo"
 )
 
@@ -22,13 +24,104 @@ func GetBulletins() echo.HandlerFunc {
 			return parseError(c, err)
 		}
 
-		bulletins, err := auth.GetBulletins()
+		budget, offset, err := requestBudget(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		bulletins, next, err := auth.GetBulletinsWithin(offset, budget)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, partialResult(bulletins, next))
+	}
+}
+
+// Records that the session's user has read a bulletin
+// Only bulletins the user can read can be acknowledged
+func AcknowledgeBulletin() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		bulletin := c.Param("name")
+		if data, err := auth.ReadSecret(vault.GetConfig().BulletinPath + bulletin); err != nil {
+			return parseError(c, err)
+		} else if data == nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Bulletin not found",
+			})
+		}
+
+		identity, err := auth.PreferenceIdentity()
+		if err != nil {
+			return parseError(c, err)
+		}
+		name, _, err := sessionIdentity(auth)
 		if err != nil {
 			return parseError(c, err)
 		}
 
+		ack, err := vault.AcknowledgeBulletin(bulletin, identity, name)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		log.Println("[AUDIT]:", name, "acknowledged bulletin", bulletin)
+		return c.JSON(http.StatusOK, H{
+			"result": ack,
+		})
+	}
+}
+
+// Lists who has and hasn't acknowledged a bulletin, for administrators
+func GetBulletinAcks() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if admin, err := auth.IsAdmin(); err != nil {
+			return parseError(c, err)
+		} else if !admin {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Goldfish administrator rights required",
+			})
+		}
+
+		acks, err := vault.GetBulletinAcks(c.Param("name"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
 		return c.JSON(http.StatusOK, H{
-			"result": bulletins,
+			"result": acks,
 		})
 	}
 }
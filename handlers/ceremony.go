@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// rekeying and root generation run in vault, across many requests from many share holders
+// anyone logged in can follow them and submit a share, but only administrators start or cancel them
+
+func GetRekeyStatus() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		status, err := vault.RekeyStatus(auth.Cluster)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+
+		return c.JSON(http.StatusOK, H{
+			"result": status,
+		})
+	}
+}
+
+// starts a rekey to the given number of shares and threshold. PGP keys are required,
+// one per share, and vault encrypts each new share with its holder's key
+func StartRekey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if admin, err := auth.IsAdmin(); err != nil {
+			return parseError(c, err)
+		} else if !admin {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Goldfish administrator rights required",
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		var config struct {
+			Shares    int      `json:"shares"`
+			Threshold int      `json:"threshold"`
+			PGPKeys   []string `json:"pgp_keys"`
+		}
+		if err := c.Bind(&config); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid rekey format",
+			})
+		}
+
+		status, err := vault.RekeyInit(auth.Cluster, config.Shares, config.Threshold, config.PGPKeys)
+		if err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "started a rekey to", config.Shares, "shares with threshold", config.Threshold)
+
+		return c.JSON(http.StatusOK, H{
+			"result": status,
+		})
+	}
+}
+
+// submits a share of the current key in form value 'key', for the rekey with form value 'nonce'
+func SubmitRekey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		progress, err := vault.RekeyUpdate(auth.Cluster, c.FormValue("key"), c.FormValue("nonce"))
+		if err != nil {
+			return inputError(c, err)
+		}
+		if progress.Complete {
+			log.Println("[AUDIT]:", name, "submitted the last key share, rekey complete")
+		} else {
+			log.Println("[AUDIT]:", name, "submitted a rekey key share, progress",
+				progress.Status.Progress, "of", progress.Status.Required)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": progress,
+		})
+	}
+}
+
+func CancelRekey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if admin, err := auth.IsAdmin(); err != nil {
+			return parseError(c, err)
+		} else if !admin {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Goldfish administrator rights required",
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		if err := vault.RekeyCancel(auth.Cluster); err != nil {
+			return parseError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "cancelled the rekey")
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Rekey cancelled",
+		})
+	}
+}
+
+func GetGenerateRootStatus() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		status, err := vault.GenerateRootStatus(auth.Cluster)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+
+		return c.JSON(http.StatusOK, H{
+			"result": status,
+		})
+	}
+}
+
+// starts a root generation. Vault encodes the root token with form value 'otp', a one time
+// password the initiator generated, or encrypts it with form value 'pgp_key'. Either way
+// only the initiator can decode it
+func StartGenerateRoot() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if admin, err := auth.IsAdmin(); err != nil {
+			return parseError(c, err)
+		} else if !admin {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Goldfish administrator rights required",
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		status, err := vault.StartGenerateRoot(auth.Cluster, c.FormValue("otp"), c.FormValue("pgp_key"))
+		if err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "started a root generation")
+
+		return c.JSON(http.StatusOK, H{
+			"result": status,
+		})
+	}
+}
+
+// submits an unseal key share in form value 'key', for the root generation with form value 'nonce'
+func SubmitGenerateRoot() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		progress, err := vault.SubmitGenerateRoot(auth.Cluster, c.FormValue("key"), c.FormValue("nonce"))
+		if err != nil {
+			return inputError(c, err)
+		}
+		if progress.Status.Complete {
+			log.Println("[AUDIT]:", name, "submitted the last key share, root token generated")
+		} else {
+			log.Println("[AUDIT]:", name, "submitted a root generation key share, progress",
+				progress.Status.Progress, "of", progress.Status.Required)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": progress,
+		})
+	}
+}
+
+func CancelGenerateRoot() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if admin, err := auth.IsAdmin(); err != nil {
+			return parseError(c, err)
+		} else if !admin {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Goldfish administrator rights required",
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		if err := vault.CancelGenerateRoot(auth.Cluster); err != nil {
+			return parseError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "cancelled the root generation")
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Root generation cancelled",
+		})
+	}
+}
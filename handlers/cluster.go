@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/labstack/echo"
+)
+
+// lists the vault clusters a session can log in to. Needs no login, as it is chosen at login
+func GetClusters() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, H{
+			"result": vault.ListClusters(),
+		})
+	}
+}
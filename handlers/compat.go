@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/labstack/echo"
+)
+
+// Lists goldfish features unavailable at the connected vault version, and known advisories affecting it
+func GetCompat() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		version, err := vault.VaultVersion()
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": H{
+				"version":     version,
+				"unavailable": vault.UnavailableFeatures(version),
+				"advisories":  vault.AffectingAdvisories(version),
+			},
+		})
+	}
+}
+
+// Rejects requests to routes whose feature the connected vault doesn't support,
+// instead of surfacing vault's less helpful 404s
+func CompatGuard() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !strings.HasPrefix(c.Request().URL.Path, "/api/") {
+				return next(c)
+			}
+			// if the version can't be determined, let vault decide
+			version, err := vault.VaultVersion()
+			if err != nil {
+				return next(c)
+			}
+			if feature, unavailable := vault.UnavailableFeatureForRoute(version, c.Request().URL.Path); unavailable {
+				return c.JSON(http.StatusNotImplemented, H{
+					"error": "This feature requires vault " + feature.MinVersion +
+						" or later, but the server is running " + version,
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// Lists the goldfish modules that can be switched off in the runtime config, and whether they are
+func GetToggles() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, H{
+			"result": H{
+				"toggles":   vault.Toggles(),
+				"read_only": vault.ReadOnly(),
+			},
+		})
+	}
+}
+
+// Rejects requests to routes of modules switched off in the runtime config
+func ToggleGuard() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			toggle, disabled := vault.DisabledToggleForRoute(c.Request().Method, c.Path())
+			if !disabled {
+				return next(c)
+			}
+			if toggle.Name == vault.ReadOnlyToggle {
+				return c.JSON(http.StatusForbidden, H{
+					"error": "Goldfish is in read-only mode",
+				})
+			}
+			return c.JSON(http.StatusForbidden, H{
+				"error": "This feature has been disabled by the goldfish administrator",
+			})
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"path"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+)
+
+// file types that are compressed already, so gzipping them again only costs cpu
+var compressedExtensions = map[string]bool{
+	".png":   true,
+	".jpg":   true,
+	".jpeg":  true,
+	".gif":   true,
+	".ico":   true,
+	".woff":  true,
+	".woff2": true,
+	".gz":    true,
+	".tgz":   true,
+	".zip":   true,
+}
+
+// gzips responses for clients that accept it, at the given level. Brotli isn't offered, as
+// there is no brotli encoder among goldfish's dependencies, and every browser that accepts
+// brotli accepts gzip too
+func Compress(level int) echo.MiddlewareFunc {
+	return middleware.GzipWithConfig(middleware.GzipConfig{
+		Skipper: precompressed,
+		Level:   level,
+	})
+}
+
+// raft snapshots are gzipped archives, streamed from vault as they are
+func precompressed(c echo.Context) bool {
+	p := c.Request().URL.Path
+	return compressedExtensions[strings.ToLower(path.Ext(p))] || p == "/api/raft/snapshot"
+}
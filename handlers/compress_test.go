@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompress(t *testing.T) {
+	Convey("Compression", t, func(c C) {
+		serve := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, path, nil)
+			req.Header.Set(echo.HeaderAcceptEncoding, acceptEncoding)
+			rec := httptest.NewRecorder()
+			Compress(6)(func(ctx echo.Context) error {
+				return ctx.String(200, "policies")
+			})(e.NewContext(req, rec))
+			return rec
+		}
+
+		c.Convey("Should gzip responses for clients that accept it", func(c C) {
+			c.So(serve("/api/policy", "gzip, deflate").Header().Get(echo.HeaderContentEncoding), ShouldEqual, "gzip")
+			rec := serve("/api/policy", "")
+			c.So(rec.Header().Get(echo.HeaderContentEncoding), ShouldBeEmpty)
+			c.So(rec.Body.String(), ShouldEqual, "policies")
+		})
+
+		c.Convey("Should leave compressed assets and snapshots alone", func(c C) {
+			c.So(serve("/static/img/logo.PNG", "gzip").Header().Get(echo.HeaderContentEncoding), ShouldBeEmpty)
+			c.So(serve("/static/fonts/icons.woff2", "gzip").Header().Get(echo.HeaderContentEncoding), ShouldBeEmpty)
+			c.So(serve("/api/raft/snapshot", "gzip").Header().Get(echo.HeaderContentEncoding), ShouldBeEmpty)
+		})
+	})
+}
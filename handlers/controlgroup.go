@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// a held back request, with vault's view of its authorizations if the session may see it
+type controlGroupView struct {
+	vault.ControlGroupRequest
+	Mine   bool                   `json:"mine"`
+	Status map[string]interface{} `json:"status"`
+}
+
+// lists the control group requests the user made, or can see the authorizations of
+func GetControlGroupRequests() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		identity, err := auth.PreferenceIdentity()
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		requests, err := vault.ListControlGroupRequests()
+		if err != nil {
+			return logError(c, err.Error(), "Could not read control group requests")
+		}
+		visible := []controlGroupView{}
+		for _, request := range requests {
+			view := controlGroupView{
+				ControlGroupRequest: request,
+				Mine:                request.RequesterIdentity == identity,
+			}
+			// authorizers are those who can look the request up in vault
+			status, err := auth.ControlGroupStatus(request.Accessor)
+			if err != nil && !view.Mine {
+				continue
+			}
+			view.Status = status
+			visible = append(visible, view)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": visible,
+		})
+	}
+}
+
+func AuthorizeControlGroup() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		status, err := auth.AuthorizeControlGroup(c.Param("id"))
+		if err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "authorized control group request", c.Param("id"))
+
+		return c.JSON(http.StatusOK, H{
+			"result": status,
+		})
+	}
+}
+
+// returns the held back response to its requester, once it has been authorized
+func CollectControlGroup() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		data, err := auth.CollectControlGroup(c.Param("id"))
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": data,
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// state mutations that a replica routes to the coordinator, as "METHOD route"
+var coordinatedRoutes = []string{
+	"POST /api/policy/request",
+	"POST /api/policy/from-template",
+	"POST /api/policy/request/update",
+	"POST /api/policy/request/:id/approve",
+	"DELETE /api/policy/request/:id",
+	"POST /api/policy/request/:id/attachments",
+	"POST /api/policy/request/:id/comments",
+	"POST /api/secrets/approval",
+	"POST /api/secrets/approval/:id",
+	"POST /api/mount-requests",
+	"POST /api/mount-requests/:id",
+	"DELETE /api/mount-requests/:id",
+	"POST /api/identity-requests",
+	"POST /api/identity-requests/:id",
+	"POST /api/identity-requests/:id/collect",
+	"DELETE /api/identity-requests/:id",
+	"POST /api/bulletins/:name/ack",
+	"POST /api/controlgroup/:id/collect",
+	"POST /api/secrets/requests",
+	"POST /api/secrets/requests/:id",
+	"DELETE /api/secrets/requests/:id",
+	"POST /api/maintenance/gc",
+	"POST /api/maintenance/incident",
+	"DELETE /api/maintenance/incident/:id",
+	"PUT /api/settings",
+	"POST /api/preferences",
+	"DELETE /api/preferences",
+}
+
+const (
+	headerForwardedAuth = "X-Goldfish-Forwarded-Auth"
+	headerTimestamp     = "X-Goldfish-Timestamp"
+	headerNonce         = "X-Goldfish-Nonce"
+	headerSignature     = "X-Goldfish-Signature"
+
+	// forwarded requests older or newer than this are rejected
+	forwardedRequestWindow = 30 * time.Second
+)
+
+type forwardedAuthKey struct{}
+
+var (
+	coordinatorAddress string
+	coordinatorClient  *http.Client
+
+	seenNoncesLock sync.Mutex
+	seenNonces     = map[string]time.Time{}
+)
+
+// loads mutual TLS settings for either side of the coordinator connection
+func CoordinatorTLSConfig(certFile, keyFile, caFile string, server bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("No certificates found in " + caFile)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if server {
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// makes this goldfish a replica, forwarding state mutations to the coordinator at address
+func SetCoordinator(address string, tlsConfig *tls.Config) {
+	coordinatorAddress = address
+	coordinatorClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+}
+
+func isCoordinatedRoute(method, route string) bool {
+	for _, r := range coordinatedRoutes {
+		if r == method+" "+route {
+			return true
+		}
+	}
+	return false
+}
+
+// matches a raw request path against the coordinated route patterns
+func matchesCoordinatedRoute(method, path string) bool {
+	segments := strings.Split(path, "/")
+	for _, r := range coordinatedRoutes {
+		parts := strings.SplitN(r, " ", 2)
+		if parts[0] != method {
+			continue
+		}
+		pattern := strings.Split(parts[1], "/")
+		if len(pattern) != len(segments) {
+			continue
+		}
+		match := true
+		for i := range pattern {
+			if !strings.HasPrefix(pattern[i], ":") && pattern[i] != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// On replicas, forwards state mutations to the coordinator on behalf of the session
+func ForwardToCoordinator() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if coordinatorAddress == "" || !isCoordinatedRoute(c.Request().Method, c.Path()) {
+				return next(c)
+			}
+			// never forward twice
+			if c.Request().Context().Value(forwardedAuthKey{}) != nil {
+				return next(c)
+			}
+
+			// the coordinator can't read this replica's cookies, so the session travels in the request
+			var auth = &vault.AuthInfo{}
+			defer auth.Clear()
+			if err := getSession(c, auth); err != nil {
+				return c.JSON(http.StatusForbidden, H{
+					"error": "Please login first",
+				})
+			}
+
+			key := vault.GetConfig().ReplicaSigningKey
+			if key == "" {
+				return logError(c, "ReplicaSigningKey is not set, can't forward to the coordinator",
+					"Goldfish replicas are misconfigured")
+			}
+
+			body, err := ioutil.ReadAll(c.Request().Body)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "Could not read request body",
+				})
+			}
+			req, err := signedForwardRequest(c.Request(), body, auth, key)
+			if err != nil {
+				return logError(c, err.Error(), "Could not forward request to the coordinator")
+			}
+			// so the coordinator's logs and traces continue this replica's
+			req.Header.Set(echo.HeaderXRequestID, requestID(c))
+			if span := requestSpan(c); span != nil {
+				req.Header.Set("Traceparent", span.Traceparent())
+			}
+
+			resp, err := coordinatorClient.Do(req)
+			if err != nil {
+				return logError(c, err.Error(), "Could not reach the coordinator")
+			}
+			defer resp.Body.Close()
+			respBody, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return logError(c, err.Error(), "Could not read the coordinator's response")
+			}
+
+			c.Response().Header().Set(echo.HeaderContentType, resp.Header.Get(echo.HeaderContentType))
+			c.Response().WriteHeader(resp.StatusCode)
+			_, err = c.Response().Write(respBody)
+			return err
+		}
+	}
+}
+
+func signedForwardRequest(original *http.Request, body []byte, auth *vault.AuthInfo, key string) (*http.Request, error) {
+	forwarded, err := json.Marshal(vault.AuthInfo{
+		Type:      auth.Type,
+		ID:        auth.ID,
+		Namespace: auth.Namespace,
+		Cluster:   auth.Cluster,
+	})
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(original.Method, coordinatorAddress+original.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(echo.HeaderContentType, original.Header.Get(echo.HeaderContentType))
+	req.Header.Set(headerForwardedAuth, base64.StdEncoding.EncodeToString(forwarded))
+	req.Header.Set(headerTimestamp, strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set(headerNonce, hex.EncodeToString(nonce))
+	req.Header.Set(headerSignature, forwardSignature(req, body, key))
+	return req, nil
+}
+
+// an hmac over everything the coordinator acts on, so nothing can be altered or replayed
+func forwardSignature(req *http.Request, body []byte, key string) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strings.Join([]string{
+		req.Method,
+		req.URL.RequestURI(),
+		req.Header.Get(echo.HeaderContentType),
+		req.Header.Get(headerForwardedAuth),
+		req.Header.Get(headerTimestamp),
+		req.Header.Get(headerNonce),
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checks a forwarded request's signature and freshness, returning the session it carries
+func verifyForwardedRequest(req *http.Request, body []byte, key string, now time.Time) (*vault.AuthInfo, error) {
+	if key == "" {
+		return nil, errors.New("ReplicaSigningKey is not set")
+	}
+	expected := forwardSignature(req, body, key)
+	if !hmac.Equal([]byte(expected), []byte(req.Header.Get(headerSignature))) {
+		return nil, errors.New("Invalid signature")
+	}
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(headerTimestamp), 10, 64)
+	if err != nil {
+		return nil, errors.New("Invalid timestamp")
+	}
+	if skew := now.Sub(time.Unix(timestamp, 0)); skew > forwardedRequestWindow || skew < -forwardedRequestWindow {
+		return nil, errors.New("Request is outside the accepted time window")
+	}
+
+	nonce := req.Header.Get(headerNonce)
+	seenNoncesLock.Lock()
+	for n, seen := range seenNonces {
+		if now.Sub(seen) > 2*forwardedRequestWindow {
+			delete(seenNonces, n)
+		}
+	}
+	_, replayed := seenNonces[nonce]
+	seenNonces[nonce] = now
+	seenNoncesLock.Unlock()
+	if nonce == "" || replayed {
+		return nil, errors.New("Request was replayed")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(req.Header.Get(headerForwardedAuth))
+	if err != nil {
+		return nil, errors.New("Invalid forwarded session")
+	}
+	auth := &vault.AuthInfo{}
+	if err := json.Unmarshal(raw, auth); err != nil || auth.ID == "" {
+		return nil, errors.New("Invalid forwarded session")
+	}
+	return auth, nil
+}
+
+// On the coordinator, serves signed requests forwarded by replicas over mutual TLS
+func CoordinatorHandler(e *echo.Echo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !matchesCoordinatedRoute(r.Method, r.URL.Path) {
+			http.Error(w, "Not a coordinated route", http.StatusNotFound)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			http.Error(w, "Could not read request body", http.StatusBadRequest)
+			return
+		}
+		auth, err := verifyForwardedRequest(r, body, vault.GetConfig().ReplicaSigningKey, time.Now())
+		if err != nil {
+			log.Println("[ERROR]: Rejected forwarded request from", r.RemoteAddr+":", err.Error())
+			http.Error(w, "Forwarded request rejected", http.StatusForbidden)
+			return
+		}
+
+		// the replica has already checked the session's cookie and csrf token
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), forwardedAuthKey{}, auth))
+		e.ServeHTTP(w, csrf.UnsafeSkipCheck(r))
+	})
+}
+
+// the session of a request forwarded by a replica, if this is one
+func forwardedSession(c echo.Context) (*vault.AuthInfo, bool) {
+	auth, ok := c.Request().Context().Value(forwardedAuthKey{}).(*vault.AuthInfo)
+	return auth, ok
+}
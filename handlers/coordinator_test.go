@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/caiyeon/goldfish/vault"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestForwardedRequests(t *testing.T) {
+	coordinatorAddress = "https://coordinator:8443"
+	defer func() { coordinatorAddress = "" }()
+
+	Convey("Signing a forwarded request", t, func(c C) {
+		body := []byte(`{"policy": "admin"}`)
+		original, _ := http.NewRequest("POST", "https://replica/api/policy/request?x=1", bytes.NewReader(body))
+		original.Header.Set("Content-Type", "application/json")
+
+		req, err := signedForwardRequest(original, body, &vault.AuthInfo{Type: "token", ID: "vault:v1:cipher"}, "key")
+		c.So(err, ShouldBeNil)
+		c.So(req.URL.String(), ShouldEqual, "https://coordinator:8443/api/policy/request?x=1")
+
+		c.Convey("Should carry the session to the coordinator", func(c C) {
+			auth, err := verifyForwardedRequest(req, body, "key", time.Now())
+			c.So(err, ShouldBeNil)
+			c.So(auth.Type, ShouldEqual, "token")
+			c.So(auth.ID, ShouldEqual, "vault:v1:cipher")
+		})
+
+		c.Convey("Should reject a different key, body or path", func(c C) {
+			_, err := verifyForwardedRequest(req, body, "other", time.Now())
+			c.So(err, ShouldNotBeNil)
+			_, err = verifyForwardedRequest(req, []byte(`{"policy": "root"}`), "key", time.Now())
+			c.So(err, ShouldNotBeNil)
+			req.URL.Path = "/api/policy/request/update"
+			_, err = verifyForwardedRequest(req, body, "key", time.Now())
+			c.So(err, ShouldNotBeNil)
+		})
+
+		c.Convey("Should reject stale and replayed requests", func(c C) {
+			_, err := verifyForwardedRequest(req, body, "key", time.Now().Add(time.Minute))
+			c.So(err, ShouldNotBeNil)
+			_, err = verifyForwardedRequest(req, body, "key", time.Now())
+			c.So(err, ShouldBeNil)
+			_, err = verifyForwardedRequest(req, body, "key", time.Now())
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Coordinated routes should match raw paths", t, func(c C) {
+		c.So(matchesCoordinatedRoute("DELETE", "/api/policy/request/abc"), ShouldBeTrue)
+		c.So(matchesCoordinatedRoute("POST", "/api/secrets/approval/abc"), ShouldBeTrue)
+		c.So(matchesCoordinatedRoute("GET", "/api/secrets/approval/abc"), ShouldBeFalse)
+		c.So(matchesCoordinatedRoute("POST", "/api/secrets"), ShouldBeFalse)
+		c.So(isCoordinatedRoute("POST", "/api/maintenance/gc"), ShouldBeTrue)
+		c.So(isCoordinatedRoute("PUT", "/api/settings"), ShouldBeTrue)
+		c.So(isCoordinatedRoute("POST", "/api/preferences"), ShouldBeTrue)
+		c.So(matchesCoordinatedRoute("DELETE", "/api/maintenance/incident/abc"), ShouldBeTrue)
+	})
+}
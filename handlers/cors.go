@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+)
+
+// lets browsers on the allowed origins call the api. Responses expose the headers
+// a frontend needs, i.e. the csrf token to send back and the request's ID
+func CORS(origins, methods []string, credentials bool) echo.MiddlewareFunc {
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:     origins,
+		AllowMethods:     methods,
+		AllowCredentials: credentials,
+		ExposeHeaders:    []string{"X-CSRF-Token", echo.HeaderXRequestID},
+	})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// cubbyhole paths are relative to the user's own cubbyhole
+func cubbyholePath(path string) (string, bool) {
+	path = strings.TrimPrefix(path, "/")
+	if strings.Contains(path, "..") {
+		return "", false
+	}
+	return "cubbyhole/" + path, true
+}
+
+func GetCubbyhole() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		path, ok := cubbyholePath(c.QueryParam("path"))
+		if !ok {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid path",
+			})
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+
+		if strings.HasSuffix(path, "/") {
+			// an empty cubbyhole cannot be listed, which is not an error worth showing
+			result, err := auth.ListSecret(path)
+			if err != nil && err.Error() != "Invalid path" {
+				return parseError(c, err)
+			}
+			if result == nil {
+				result = []interface{}{}
+			}
+			return c.JSON(http.StatusOK, H{
+				"result": result,
+				"path":   c.QueryParam("path"),
+			})
+		}
+
+		result, err := auth.ReadSecret(path)
+		if err != nil {
+			return parseError(c, err)
+		}
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+			"path":   c.QueryParam("path"),
+		})
+	}
+}
+
+func PostCubbyhole() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		path, ok := cubbyholePath(c.QueryParam("path"))
+		body := c.FormValue("body")
+		if !ok || path == "cubbyhole/" || body == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Path and body must not be empty",
+			})
+		}
+		if strings.HasSuffix(path, "/") {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Path must not end in '/'",
+			})
+		}
+
+		resp, err := auth.WriteSecret(path, body)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": resp,
+		})
+	}
+}
+
+func DeleteCubbyhole() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		path, ok := cubbyholePath(c.QueryParam("path"))
+		if !ok || path == "cubbyhole/" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid path",
+			})
+		}
+
+		if _, err := auth.DeleteSecret(path); err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": "success",
+		})
+	}
+}
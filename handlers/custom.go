@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Lists the custom requests the session is allowed to make
+func GetCustomRequests() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		self, err := auth.LookupSelf()
+		if err != nil {
+			return parseError(c, err)
+		}
+		policies, _ := self.Data["policies"].([]interface{})
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": vault.ListCustomRequests(policies),
+		})
+	}
+}
+
+// Makes an operator-defined vault api call, with parameters taken from the form
+func RunCustomRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		// unknown and forbidden requests look the same, so names can't be probed
+		cr, ok := vault.GetCustomRequest(c.Param("name"))
+		self, err := auth.LookupSelf()
+		if err != nil {
+			return parseError(c, err)
+		}
+		policies, _ := self.Data["policies"].([]interface{})
+		if !ok || !cr.Allowed(policies) {
+			return c.JSON(http.StatusNotFound, H{
+				"error": "No such custom request",
+			})
+		}
+
+		form, err := c.FormParams()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid parameters",
+			})
+		}
+		params := map[string]string{}
+		for k, v := range form {
+			if k != "gorilla.csrf.Token" && len(v) > 0 {
+				params[k] = v[0]
+			}
+		}
+
+		name, _ := self.Data["display_name"].(string)
+		path, resp, err := auth.RunCustomRequest(cr, params)
+		if path != "" {
+			log.Println("[AUDIT]:", name, "called custom request", cr.Name, cr.Method, path, "error:", err != nil)
+		}
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": vault.LeasedSecret(resp),
+		})
+	}
+}
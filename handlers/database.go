@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Lists connections, or reads one if a name is given
+func GetDatabaseConnections() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var result interface{}
+		var err error
+		if name := c.QueryParam("name"); name == "" {
+			result, err = auth.ListDatabaseConnections(c.QueryParam("mount"))
+		} else {
+			result, err = auth.ReadDatabaseConnection(c.QueryParam("mount"), name)
+		}
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// Lists roles, or reads one (including its creation statements) if a name is given
+func GetDatabaseRoles() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var result interface{}
+		var err error
+		if name := c.QueryParam("name"); name == "" {
+			result, err = auth.ListDatabaseRoles(c.QueryParam("mount"))
+		} else {
+			result, err = auth.ReadDatabaseRole(c.QueryParam("mount"), name)
+		}
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// Generates dynamic credentials for a role, returning the lease alongside them
+func GenerateDatabaseCredentials() echo.HandlerFunc {
+	return generateCredentials("role", vault.AuthInfo.GenerateDatabaseCredentials)
+}
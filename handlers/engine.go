@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Lists the secret engine types goldfish supports
+func GetEngines() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		type engineInfo struct {
+			vault.EngineDescription
+			Actions []vault.EngineAction
+		}
+		results := []engineInfo{}
+		for _, description := range vault.ListSecretEngines() {
+			engine, _ := vault.GetSecretEngine(description.Type)
+			results = append(results, engineInfo{description, engine.Actions()})
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": results,
+		})
+	}
+}
+
+// Lists or reads a path through the engine registered for its mount
+func GetEnginePath() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		path := c.QueryParam("path")
+		engine, mount, err := auth.EngineForPath(path)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		var result interface{}
+		relative := strings.TrimPrefix(path, mount)
+		if relative == "" || strings.HasSuffix(relative, "/") {
+			result, err = engine.List(*auth, mount, relative)
+		} else if vault.RequiresRevealApproval(path) {
+			return c.JSON(http.StatusForbidden, H{
+				"error":             "Reading this path requires a second person's approval",
+				"approval_required": true,
+			})
+		} else {
+			result, err = engine.Read(*auth, mount, relative)
+		}
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+			"engine": engine.Describe().Type,
+			"path":   path,
+		})
+	}
+}
+
+// Writes a path, or runs a named action, through the engine registered for its mount
+func PostEnginePath() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		path := c.QueryParam("path")
+		engine, mount, err := auth.EngineForPath(path)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		if vault.RequiresSecretRequest(path) {
+			return c.JSON(http.StatusForbidden, H{
+				"error":            "Changing this path requires a request approved by others",
+				"request_required": true,
+			})
+		}
+
+		data := map[string]interface{}{}
+		if body := c.FormValue("body"); body != "" {
+			if err := json.Unmarshal([]byte(body), &data); err != nil {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "Body must be a JSON object",
+				})
+			}
+		}
+
+		var result interface{}
+		relative := strings.TrimPrefix(path, mount)
+		if name := c.QueryParam("action"); name != "" {
+			action, ok := vault.FindEngineAction(engine, name)
+			if !ok {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "Unsupported action for this engine",
+				})
+			}
+			result, err = action.Run(*auth, mount, relative, data)
+		} else {
+			result, err = engine.Write(*auth, mount, relative, data)
+		}
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
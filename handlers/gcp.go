@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/hashicorp/vault/api"
+	"github.com/labstack/echo"
+)
+
+// Lists rolesets, or reads one if a name is given
+func GetGCPRolesets() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var result interface{}
+		var err error
+		if name := c.QueryParam("name"); name == "" {
+			result, err = auth.ListGCPRolesets(c.QueryParam("mount"))
+		} else {
+			result, err = auth.ReadGCPRoleset(c.QueryParam("mount"), name)
+		}
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// Generates an OAuth2 access token for a roleset, or a service account key if type=key
+func GenerateGCPCredentials() echo.HandlerFunc {
+	generate := func(key bool) echo.HandlerFunc {
+		return generateCredentials("roleset", func(auth vault.AuthInfo, mount, roleset string) (*api.Secret, error) {
+			return auth.GenerateGCPCredentials(mount, roleset, key)
+		})
+	}
+	token, key := generate(false), generate(true)
+
+	return func(c echo.Context) error {
+		switch c.FormValue("type") {
+		case "", "token":
+			return token(c)
+		case "key":
+			return key(c)
+		default:
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "type must be either token or key",
+			})
+		}
+	}
+}
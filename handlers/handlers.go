@@ -1,14 +1,20 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/caiyeon/goldfish/metrics"
 	"github.com/caiyeon/goldfish/vault"
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/securecookie"
+	"github.com/hashicorp/vault/api"
 	"github.com/labstack/echo"
 )
 
@@ -16,7 +22,11 @@ import (
 type H map[string]interface{}
 
 // for storing ciphers of user credentials
-var scookie = &securecookie.SecureCookie{}
+var (
+	scookie        = &securecookie.SecureCookie{}
+	cookieHashKey  []byte
+	cookieBlockKey []byte
+)
 
 func init() {
 	// setup cookie encryption keys
@@ -25,6 +35,17 @@ func init() {
 	if hashKey == nil || blockKey == nil {
 		panic("Failed to generate random hashkey")
 	}
+	SetSessionKeys(hashKey, blockKey)
+}
+
+// the keys that session cookies are encrypted with, for handing over to an upgraded process
+func SessionKeys() ([]byte, []byte) {
+	return cookieHashKey, cookieBlockKey
+}
+
+// replaces the session cookie keys, so cookies issued by a previous process remain valid
+func SetSessionKeys(hashKey, blockKey []byte) {
+	cookieHashKey, cookieBlockKey = hashKey, blockKey
 	scookie = securecookie.New(hashKey, blockKey)
 	scookie = scookie.MaxAge(14400) // 8 hours
 	if scookie == nil {
@@ -60,6 +81,103 @@ func parseError(c echo.Context, err error) error {
 	})
 }
 
+// errors that are either goldfish rejecting the input, or vault responding
+func inputError(c echo.Context, err error) error {
+	if strings.Contains(err.Error(), "Code:") {
+		return parseError(c, err)
+	}
+	return c.JSON(http.StatusBadRequest, H{
+		"error": err.Error(),
+	})
+}
+
+// generates dynamic credentials for the role named by the route param, returning the lease alongside them
+func generateCredentials(param string, generate func(auth vault.AuthInfo, mount, role string) (*api.Secret, error)) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		resp, err := generate(*auth, c.QueryParam("mount"), c.Param(param))
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": vault.LeasedSecret(resp),
+		})
+	}
+}
+
+// how long a handler aggregating many vault calls may run before returning partial results
+const defaultBudget = 20 * time.Second
+
+// the most a request may ask for, so no client can hold a handler fanning out indefinitely
+const maxBudget = 3 * defaultBudget
+
+// reads the optional 'budget' duration and 'continuation' offset query params
+func requestBudget(c echo.Context) (vault.Budget, int, error) {
+	budget, err := requestTimeBudget(c)
+	if err != nil {
+		return vault.Budget{}, 0, err
+	}
+
+	offset := 0
+	if raw := c.QueryParam("continuation"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return vault.Budget{}, 0, errors.New("Invalid continuation token")
+		}
+		offset = n
+	}
+	return budget, offset, nil
+}
+
+// reads the optional 'budget' duration query param, for handlers with their own continuations
+func requestTimeBudget(c echo.Context) (vault.Budget, error) {
+	budget := defaultBudget
+	if raw := c.QueryParam("budget"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 || d > maxBudget {
+			return vault.Budget{}, errors.New("Budget must be a positive duration of at most " + maxBudget.String())
+		}
+		budget = d
+	}
+	return vault.NewBudget(budget), nil
+}
+
+// result body for listings that may have been cut short by their budget
+func partialResult(result interface{}, next int) H {
+	body := H{
+		"result":    result,
+		"truncated": next >= 0,
+	}
+	if next >= 0 {
+		body["continuation"] = strconv.Itoa(next)
+	}
+	return body
+}
+
+// collects the given form values that are set, for passing through to vault
+func formParams(c echo.Context, keys ...string) map[string]interface{} {
+	params := map[string]interface{}{}
+	for _, key := range keys {
+		if value := c.FormValue(key); value != "" {
+			params[key] = value
+		}
+	}
+	return params
+}
+
 func FetchCSRF() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
@@ -76,7 +194,8 @@ func VaultHealth() echo.HandlerFunc {
 			return parseError(c, err)
 		}
 		return c.JSON(http.StatusOK, H{
-			"result": string(resp),
+			"result":       string(resp),
+			"server_token": vault.ServerTokenHealth(),
 		})
 	}
 }
@@ -97,11 +216,40 @@ func Login() echo.HandlerFunc {
 				"error": "Empty authentication",
 			})
 		}
+		auth.SetRequestID(requestID(c))
+		auth.SetSpan(requestSpan(c))
+
+		// locked out clients and usernames are refused before their credentials reach vault
+		ip, user := c.RealIP(), loginUsername(auth)
+		if wait := logins.wait(ip, user, time.Now()); wait > 0 {
+			metrics.LoginAttempts.Inc("throttled")
+			seconds := int(math.Ceil(wait.Seconds()))
+			c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+			return c.JSON(http.StatusTooManyRequests, H{
+				"error": fmt.Sprintf("Too many failed logins, try again in %d seconds", seconds),
+			})
+		}
 
 		// verify auth details and create client access token
 		data, err := auth.Login()
 		if err != nil {
-			return parseError(c, err)
+			if credentialsRejected(err) {
+				metrics.LoginAttempts.Inc("failure")
+				logins.failed(ip, user, time.Now())
+			}
+			return inputError(c, err)
+		}
+		metrics.LoginAttempts.Inc("success")
+		logins.succeeded(user)
+
+		// bulletin acknowledgements are tracked against everyone that has logged in
+		if err := vault.RecordKnownUser(data); err != nil {
+			log.Println("[ERROR]: Could not record login:", err.Error())
+		}
+
+		// sessions of designated policies only remain valid on the client that logged in
+		if bindingRequired(data["policies"]) {
+			auth.Fingerprint = clientFingerprint(c)
 		}
 
 		// encrypt auth.ID with vault's transit backend
@@ -112,14 +260,7 @@ func Login() echo.HandlerFunc {
 		}
 
 		// store auth.Type and auth.ID (now a cipher) in cookie
-		if encoded, err := scookie.Encode("auth", auth); err == nil {
-			cookie := &http.Cookie{
-				Name:  "auth",
-				Value: encoded,
-				Path:  "/",
-			}
-			http.SetCookie(c.Response().Writer, cookie)
-		} else {
+		if err := setSessionCookie(c, auth); err != nil {
 			return c.JSON(http.StatusInternalServerError, H{
 				"error": "Goldfish could not encode cookie",
 			})
@@ -132,6 +273,8 @@ func Login() echo.HandlerFunc {
 				"display_name": data["display_name"],
 				"id":           data["id"],
 				"meta":         data["meta"],
+				"namespace":    auth.Namespace,
+				"cluster":      auth.Cluster,
 				"policies":     data["policies"],
 				"renewable":    data["renewable"],
 				"ttl":          data["ttl"],
@@ -171,11 +314,79 @@ func RenewSelf() echo.HandlerFunc {
 	}
 }
 
+// Ends the session on this server. The token itself is left to expire
+func Logout() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// drop the token's cached lookup, if there is a session
+		if err := getSession(c, auth); err == nil {
+			metrics.SessionEnded(auth.ID)
+			if err := auth.DecryptAuth(); err == nil {
+				vault.InvalidateToken(auth.Cluster, auth.ID)
+			}
+		}
+
+		http.SetCookie(c.Response().Writer, &http.Cookie{
+			Name:   "auth",
+			Value:  "",
+			Path:   "/",
+			MaxAge: -1,
+		})
+		return c.JSON(http.StatusOK, H{
+			"status": "Logged out",
+		})
+	}
+}
+
+// the session cookie holds the auth type, namespace, cluster and the token's transit cipher
+func setSessionCookie(c echo.Context, auth *vault.AuthInfo) error {
+	encoded, err := scookie.Encode("auth", auth)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(c.Response().Writer, &http.Cookie{
+		Name:  "auth",
+		Value: encoded,
+		Path:  "/",
+	})
+	return nil
+}
+
 func getSession(c echo.Context, auth *vault.AuthInfo) error {
+	auth.SetRequestID(requestID(c))
+	auth.SetSpan(requestSpan(c))
+
+	// requests forwarded by a replica carry their session
+	if forwarded, ok := forwardedSession(c); ok {
+		auth.Type = forwarded.Type
+		auth.ID = forwarded.ID
+		auth.Namespace = forwarded.Namespace
+		auth.Cluster = forwarded.Cluster
+		return nil
+	}
+
 	// fetch auth from cookie
 	cookie, err := c.Request().Cookie("auth")
 	if err != nil {
 		return err
 	}
-	return scookie.Decode("auth", cookie.Value, &auth)
+	if err := scookie.Decode("auth", cookie.Value, &auth); err != nil {
+		return err
+	}
+
+	// a bound session presented by a different client is treated as replayed
+	if auth.Fingerprint != "" && auth.Fingerprint != clientFingerprint(c) {
+		auth.Clear()
+		http.SetCookie(c.Response().Writer, &http.Cookie{
+			Name:   "auth",
+			Value:  "",
+			Path:   "/",
+			MaxAge: -1,
+		})
+		return errors.New("Session is bound to a different client")
+	}
+	metrics.SessionSeen(auth.ID)
+	return nil
 }
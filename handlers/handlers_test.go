@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequestBudget(t *testing.T) {
+	Convey("A request's budget and continuation should be read from its query", t, func(c C) {
+		e := echo.New()
+		budget := func(query string) (int, error) {
+			ctx := e.NewContext(httptest.NewRequest(echo.GET, "/api/users?"+query, nil), httptest.NewRecorder())
+			_, offset, err := requestBudget(ctx)
+			return offset, err
+		}
+
+		offset, err := budget("budget=5s&continuation=40")
+		c.So(err, ShouldBeNil)
+		c.So(offset, ShouldEqual, 40)
+
+		_, err = budget("")
+		c.So(err, ShouldBeNil)
+
+		c.Convey("Budgets beyond the cap should be refused", func(c C) {
+			_, err := budget("budget=" + (maxBudget + 1).String())
+			c.So(err, ShouldNotBeNil)
+			_, err = budget("budget=" + maxBudget.String())
+			c.So(err, ShouldBeNil)
+			_, err = budget("budget=-1s")
+			c.So(err, ShouldNotBeNil)
+		})
+
+		c.Convey("Continuations must be offsets", func(c C) {
+			_, err := budget("continuation=-1")
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo"
+)
+
+// security headers for every response. Empty values leave the header out
+type SecurityHeaders struct {
+	ContentSecurityPolicy string
+	FrameOptions          string
+	ReferrerPolicy        string
+	HSTSMaxAge            int
+	HSTSIncludeSubdomains bool
+}
+
+// sets the security headers. HSTS is only sent over https, which includes https
+// terminated by a trusted proxy, as browsers ignore it otherwise
+func Secure(headers SecurityHeaders) echo.MiddlewareFunc {
+	hsts := ""
+	if headers.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(headers.HSTSMaxAge)
+		if headers.HSTSIncludeSubdomains {
+			hsts += "; includeSubdomains"
+		}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			h := c.Response().Header()
+			h.Set(echo.HeaderXXSSProtection, "1; mode=block")
+			h.Set(echo.HeaderXContentTypeOptions, "nosniff")
+			if headers.FrameOptions != "" {
+				h.Set(echo.HeaderXFrameOptions, headers.FrameOptions)
+			}
+			if headers.ContentSecurityPolicy != "" {
+				h.Set(echo.HeaderContentSecurityPolicy, headers.ContentSecurityPolicy)
+			}
+			if headers.ReferrerPolicy != "" {
+				h.Set("Referrer-Policy", headers.ReferrerPolicy)
+			}
+			if hsts != "" && c.Scheme() == "https" {
+				h.Set(echo.HeaderStrictTransportSecurity, hsts)
+			}
+			return next(c)
+		}
+	}
+}
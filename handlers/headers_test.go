@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	Convey("Security headers", t, func(c C) {
+		headers := SecurityHeaders{
+			ContentSecurityPolicy: "default-src 'self'",
+			ReferrerPolicy:        "same-origin",
+			HSTSMaxAge:            600,
+		}
+
+		serve := func(proto string) *httptest.ResponseRecorder {
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, "/", nil)
+			req.Header.Set(echo.HeaderXForwardedProto, proto)
+			rec := httptest.NewRecorder()
+			Secure(headers)(func(ctx echo.Context) error {
+				return nil
+			})(e.NewContext(req, rec))
+			return rec
+		}
+
+		c.Convey("Should be set as configured, leaving out empty ones", func(c C) {
+			rec := serve("http")
+			c.So(rec.Header().Get(echo.HeaderContentSecurityPolicy), ShouldEqual, "default-src 'self'")
+			c.So(rec.Header().Get("Referrer-Policy"), ShouldEqual, "same-origin")
+			c.So(rec.Header().Get(echo.HeaderXFrameOptions), ShouldBeEmpty)
+		})
+
+		c.Convey("Should only include HSTS over https", func(c C) {
+			c.So(serve("http").Header().Get(echo.HeaderStrictTransportSecurity), ShouldBeEmpty)
+			c.So(serve("https").Header().Get(echo.HeaderStrictTransportSecurity), ShouldEqual, "max-age=600")
+		})
+	})
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Identity requests are seen by their requester and by members of approver groups,
+// who may approve or reject them. The requester may withdraw their own request
+
+// the request as shown to users. The encrypted wrapping token never leaves goldfish
+func identityRequestView(request vault.IdentityRequest) vault.IdentityRequest {
+	request.WrappingToken = ""
+	return request
+}
+
+// true if the session made the request or may approve it
+func canSeeIdentityRequest(auth *vault.AuthInfo, hash string, request *vault.IdentityRequest) (bool, error) {
+	if request.RequesterHash == hash {
+		return true, nil
+	}
+	groups, err := auth.ApproverGroupsOf()
+	return len(groups) > 0, err
+}
+
+// responds to the direct form of an operation that must go through a request
+func identityRequestRequired(c echo.Context) error {
+	return c.JSON(http.StatusForbidden, H{
+		"error":            "This operation requires a request approved by others",
+		"request_required": true,
+	})
+}
+
+func GetIdentityRequests() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		_, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+		requests, err := vault.ListIdentityRequests()
+		if err != nil {
+			return logError(c, err.Error(), "Could not read identity requests")
+		}
+		visible := []vault.IdentityRequest{}
+		for _, request := range requests {
+			ok, err := canSeeIdentityRequest(auth, hash, &request)
+			if err != nil {
+				return parseError(c, err)
+			}
+			if ok {
+				visible = append(visible, identityRequestView(request))
+			}
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": visible,
+		})
+	}
+}
+
+// Submits a user or role change that must be approved by the approver groups
+func AddIdentityRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var body struct {
+			Operation string                 `json:"operation"`
+			Backend   string                 `json:"backend"`
+			Target    string                 `json:"target"`
+			Params    map[string]interface{} `json:"params"`
+			WrapTTL   string                 `json:"wrap_ttl"`
+		}
+		if err := c.Bind(&body); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid request format",
+			})
+		}
+
+		name, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		request, err := auth.CreateIdentityRequest(vault.IdentityRequest{
+			Operation:     body.Operation,
+			Backend:       body.Backend,
+			Target:        body.Target,
+			Params:        body.Params,
+			WrapTTL:       body.WrapTTL,
+			Requester:     name,
+			RequesterHash: hash,
+		})
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		log.Println("[AUDIT]:", name, "requested", request.Operation, request.Target, "request", request.ID)
+		return c.JSON(http.StatusOK, H{
+			"result": identityRequestView(*request),
+		})
+	}
+}
+
+func GetIdentityRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		request, err := vault.GetIdentityRequest(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		_, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+		if ok, err := canSeeIdentityRequest(auth, hash, request); err != nil {
+			return parseError(c, err)
+		} else if !ok {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You are not the requester or in an approver group",
+			})
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result":          identityRequestView(*request),
+			"approver_groups": vault.PolicyApprovalProgress(request.Approvals),
+		})
+	}
+}
+
+// Approves an identity request on behalf of the approver groups the session belongs to
+// The last required approval makes the change
+func ApproveIdentityRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		// the change is made on the request's cluster, so it is approved from there
+		request, err := vault.GetIdentityRequest(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if err := sameCluster(auth, request.Cluster); err != nil {
+			return inputError(c, err)
+		}
+
+		name, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+		groups, err := auth.ApproverGroupsOf()
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		request, applied, err := vault.ApproveIdentityRequest(c.Param("id"), vault.PolicyApproval{
+			Approver:     name,
+			ApproverHash: hash,
+			Groups:       groups,
+		})
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		log.Println("[AUDIT]:", name, "approved", request.Operation, request.Target, "as", groups, "request", request.ID)
+		if applied {
+			log.Println("[AUDIT]:", request.Operation, request.Target, "applied, requested by", request.Requester, "request", request.ID)
+		}
+		return c.JSON(http.StatusOK, H{
+			"result":          identityRequestView(*request),
+			"applied":         applied,
+			"approver_groups": vault.PolicyApprovalProgress(request.Approvals),
+		})
+	}
+}
+
+// Hands the wrapped credentials of an applied request to its requester
+func CollectIdentityRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		name, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+		wrappingToken, err := vault.CollectIdentityRequest(c.Param("id"), hash)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		log.Println("[AUDIT]:", name, "collected the credentials of request", c.Param("id"))
+		return c.JSON(http.StatusOK, H{
+			"result": wrappingToken,
+		})
+	}
+}
+
+// Approver group members may reject a request, and requesters may withdraw their own
+func DeleteIdentityRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		request, err := vault.GetIdentityRequest(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		name, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+		if ok, err := canSeeIdentityRequest(auth, hash, request); err != nil {
+			return parseError(c, err)
+		} else if !ok {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You are not the requester or in an approver group",
+			})
+		}
+		if request.Applied != "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Request has already been applied",
+			})
+		}
+
+		if err := vault.DeleteIdentityRequest(request.ID); err != nil {
+			return parseError(c, err)
+		}
+
+		log.Println("[AUDIT]:", name, "rejected", request.Operation, request.Target, "request", request.ID)
+		return c.JSON(http.StatusOK, H{
+			"result": "Request deleted",
+		})
+	}
+}
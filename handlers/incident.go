@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caiyeon/goldfish/logging"
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/hashicorp/go-uuid"
+	"github.com/labstack/echo"
+)
+
+// incident mode never outlives this, so verbose capture can't be left on by mistake
+const maxIncidentDuration = 24 * time.Hour
+
+// how often incident mode is re-read from vault, so that an incident started or ended
+// on another replica applies here too
+const incidentSyncInterval = 10 * time.Second
+
+// an admin-triggered window of request capture for forensic investigation
+type Incident struct {
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"`
+	StartedBy string    `json:"started_by"`
+	Started   time.Time `json:"started"`
+	Expires   time.Time `json:"expires"`
+	// display names and path prefixes to capture, everything if both are empty
+	Users []string `json:"users"`
+	Paths []string `json:"paths"`
+
+	// parameter values are captured as hmacs with this key, so investigators can
+	// search for known values without the log holding any secrets
+	key   []byte
+	timer *time.Timer
+}
+
+// an incident as kept in vault, with its hmac key, so that every replica redacts alike
+type storedIncident struct {
+	Incident
+	Key string `json:"key"`
+}
+
+// one captured request
+type IncidentEvent struct {
+	Incident  string            `json:"incident"`
+	Time      time.Time         `json:"time"`
+	User      string            `json:"user,omitempty"`
+	Method    string            `json:"method"`
+	Route     string            `json:"route"`
+	Path      string            `json:"path"`
+	Params    map[string]string `json:"params"`
+	Status    int               `json:"status"`
+	Latency   string            `json:"latency"`
+	RemoteIP  string            `json:"remote_ip"`
+	UserAgent string            `json:"user_agent"`
+}
+
+var (
+	incidentLock sync.RWMutex
+	incident     *Incident
+
+	// events are shipped to the sink in the background, and dropped if it can't keep up
+	incidentEvents = make(chan IncidentEvent, 1000)
+	incidentSink   = &http.Client{Timeout: 5 * time.Second}
+)
+
+func init() {
+	go shipIncidentEvents()
+}
+
+func currentIncident() *Incident {
+	incidentLock.RLock()
+	defer incidentLock.RUnlock()
+	return incident
+}
+
+func startIncident(i *Incident, duration time.Duration) {
+	incidentLock.Lock()
+	defer incidentLock.Unlock()
+	if incident != nil {
+		incident.timer.Stop()
+	}
+	i.timer = time.AfterFunc(duration, func() {
+		endIncident(i.ID, "expired")
+	})
+	incident = i
+	// everything goldfish logs may help the investigation
+	logging.Verbose(true)
+	log.Println("[INCIDENT]: incident mode", i.ID, "started by", i.StartedBy, "until", i.Expires.Format(time.RFC3339)+":", i.Reason)
+}
+
+// ends the incident if it is still the current one
+func endIncident(id, why string) bool {
+	incidentLock.Lock()
+	defer incidentLock.Unlock()
+	if incident == nil || incident.ID != id {
+		return false
+	}
+	incident.timer.Stop()
+	incident = nil
+	logging.Verbose(false)
+	log.Println("[INCIDENT]: incident mode", id, why)
+	return true
+}
+
+// re-reads incident mode from vault, starting or ending it here to match
+func syncIncident() error {
+	raw, err := vault.ReadIncident()
+	if err != nil {
+		return err
+	}
+	current := currentIncident()
+	if raw == nil {
+		if current != nil {
+			endIncident(current.ID, "ended on another replica")
+		}
+		return nil
+	}
+
+	var stored storedIncident
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return err
+	}
+	if current != nil && current.ID == stored.ID {
+		return nil
+	}
+	// an expired incident is left for the next one to replace
+	duration := time.Until(stored.Expires)
+	if duration <= 0 {
+		return nil
+	}
+	key, err := hex.DecodeString(stored.Key)
+	if err != nil {
+		return err
+	}
+	i := stored.Incident
+	i.key = key
+	startIncident(&i, duration)
+	return nil
+}
+
+// keeps this goldfish's incident mode in line with the other replicas'
+func SyncIncidentMode() {
+	for {
+		time.Sleep(incidentSyncInterval)
+		if err := syncIncident(); err != nil {
+			log.Println("[ERROR]: Could not read incident mode:", err.Error())
+		}
+	}
+}
+
+func (i *Incident) redact(value string) string {
+	mac := hmac.New(sha256.New, i.key)
+	mac.Write([]byte(value))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// true if a request touching these paths should be captured
+func (i *Incident) capturesPaths(paths []string) bool {
+	if len(i.Paths) == 0 {
+		return true
+	}
+	for _, path := range paths {
+		for _, prefix := range i.Paths {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (i *Incident) capturesUser(user string) bool {
+	if len(i.Users) == 0 {
+		return true
+	}
+	for _, u := range i.Users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
+
+// While incident mode is on, captures metadata of matching api requests with parameter values redacted
+func IncidentCapture() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			i := currentIncident()
+			if i == nil || !strings.HasPrefix(c.Request().URL.Path, "/api/") {
+				return next(c)
+			}
+
+			// vault paths are in the route or in parameters
+			params := map[string]string{}
+			paths := []string{strings.TrimPrefix(c.Request().URL.Path, "/api/")}
+			if form, err := c.FormParams(); err == nil {
+				for k, v := range form {
+					if k == "gorilla.csrf.Token" || len(v) == 0 {
+						continue
+					}
+					params[k] = i.redact(v[0])
+					if k == "path" || k == "src" || k == "dst" {
+						paths = append(paths, v[0])
+					}
+				}
+			}
+			if !i.capturesPaths(paths) {
+				return next(c)
+			}
+
+			user := incidentUser(c)
+			if !i.capturesUser(user) {
+				return next(c)
+			}
+
+			start := time.Now()
+			err := next(c)
+			status := c.Response().Status
+			if err != nil {
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				}
+			}
+
+			event := IncidentEvent{
+				Incident:  i.ID,
+				Time:      start,
+				User:      user,
+				Method:    c.Request().Method,
+				Route:     c.Path(),
+				Path:      c.Request().URL.Path,
+				Params:    params,
+				Status:    status,
+				Latency:   time.Since(start).String(),
+				RemoteIP:  c.RealIP(),
+				UserAgent: c.Request().UserAgent(),
+			}
+			if raw, jsonErr := json.Marshal(event); jsonErr == nil {
+				log.Println("[INCIDENT]:", string(raw))
+			}
+			select {
+			case incidentEvents <- event:
+			default:
+				log.Println("[INCIDENT]: sink is falling behind, event dropped")
+			}
+			return err
+		}
+	}
+}
+
+func incidentUser(c echo.Context) string {
+	var auth = &vault.AuthInfo{}
+	defer auth.Clear()
+	if err := getSession(c, auth); err != nil {
+		return ""
+	}
+	if err := auth.DecryptAuth(); err != nil {
+		return ""
+	}
+	name, _, err := sessionIdentity(auth)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+func shipIncidentEvents() {
+	for event := range incidentEvents {
+		sink := vault.GetConfig().IncidentSinkURL
+		if sink == "" {
+			continue
+		}
+		raw, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		resp, err := incidentSink.Post(sink, "application/json", bytes.NewReader(raw))
+		if err != nil {
+			log.Println("[ERROR]: Could not ship incident event:", err.Error())
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Println("[ERROR]: Incident sink responded with", resp.Status)
+		}
+	}
+}
+
+// Reports the current incident, if any
+func GetIncident() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if admin, err := auth.IsAdmin(); err != nil {
+			return parseError(c, err)
+		} else if !admin {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Goldfish administrator rights required",
+			})
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": currentIncident(),
+		})
+	}
+}
+
+// Starts incident mode for a bounded duration, replacing any current incident.
+// The hmac key is only returned here
+func StartIncident() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if admin, err := auth.IsAdmin(); err != nil {
+			return parseError(c, err)
+		} else if !admin {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Goldfish administrator rights required",
+			})
+		}
+
+		duration, err := time.ParseDuration(c.FormValue("duration"))
+		if err != nil || duration <= 0 || duration > maxIncidentDuration {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "duration must be a positive duration of at most " + maxIncidentDuration.String(),
+			})
+		}
+		reason := c.FormValue("reason")
+		if reason == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "A reason is required",
+			})
+		}
+
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			return logError(c, err.Error(), "Could not generate incident id")
+		}
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return logError(c, err.Error(), "Could not generate incident key")
+		}
+
+		i := &Incident{
+			ID:        id,
+			Reason:    reason,
+			StartedBy: name,
+			Started:   time.Now(),
+			Expires:   time.Now().Add(duration),
+			Users:     splitList(c.FormValue("users")),
+			Paths:     splitList(c.FormValue("paths")),
+			key:       key,
+		}
+		raw, err := json.Marshal(storedIncident{Incident: *i, Key: hex.EncodeToString(key)})
+		if err != nil {
+			return logError(c, err.Error(), "Could not store incident")
+		}
+		if err := vault.WriteIncident(raw); err != nil {
+			return parseError(c, err)
+		}
+		startIncident(i, duration)
+
+		return c.JSON(http.StatusOK, H{
+			"result": H{
+				"incident": i,
+				"hmac_key": hex.EncodeToString(key),
+			},
+		})
+	}
+}
+
+// Ends the current incident early
+func EndIncident() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if admin, err := auth.IsAdmin(); err != nil {
+			return parseError(c, err)
+		} else if !admin {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Goldfish administrator rights required",
+			})
+		}
+
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+		// the incident may have been started on another replica, so vault decides whether it is on
+		raw, err := vault.ReadIncident()
+		if err != nil {
+			return parseError(c, err)
+		}
+		var stored storedIncident
+		if raw != nil {
+			if err := json.Unmarshal(raw, &stored); err != nil {
+				return logError(c, err.Error(), "Could not read incident")
+			}
+		}
+		if stored.ID == "" || stored.ID != c.Param("id") || !time.Now().Before(stored.Expires) {
+			return c.JSON(http.StatusNotFound, H{
+				"error": "No such incident in progress",
+			})
+		}
+		if err := vault.DeleteIncident(); err != nil {
+			return parseError(c, err)
+		}
+		endIncident(stored.ID, "ended by "+name)
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Incident mode ended",
+		})
+	}
+}
+
+// splits a comma separated list, dropping empty entries
+func splitList(raw string) []string {
+	results := []string{}
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			results = append(results, item)
+		}
+	}
+	return results
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIncidentMode(t *testing.T) {
+	Convey("An incident", t, func(c C) {
+		i := &Incident{
+			ID:    "test",
+			Users: []string{"userpass-bob"},
+			Paths: []string{"secret/payments/"},
+			key:   []byte("key"),
+		}
+
+		c.Convey("Should only capture matching users and paths", func(c C) {
+			c.So(i.capturesPaths([]string{"secrets", "secret/payments/db"}), ShouldBeTrue)
+			c.So(i.capturesPaths([]string{"secrets", "secret/other"}), ShouldBeFalse)
+			c.So(i.capturesUser("userpass-bob"), ShouldBeTrue)
+			c.So(i.capturesUser("userpass-alice"), ShouldBeFalse)
+		})
+
+		c.Convey("Should redact values consistently", func(c C) {
+			c.So(i.redact("hunter2"), ShouldEqual, i.redact("hunter2"))
+			c.So(i.redact("hunter2"), ShouldNotContainSubstring, "hunter2")
+			c.So(i.redact("hunter2"), ShouldNotEqual, i.redact("hunter3"))
+		})
+
+		c.Convey("Should end by itself", func(c C) {
+			startIncident(i, 10*time.Millisecond)
+			c.So(currentIncident(), ShouldEqual, i)
+			time.Sleep(50 * time.Millisecond)
+			c.So(currentIncident(), ShouldBeNil)
+			c.So(endIncident("test", "ended"), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// lists the leases under query param 'prefix' with their TTLs, possibly partially
+func GetLeases() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		budget, offset, err := requestBudget(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		// fetch results, possibly partial if budget runs out
+		result, next, err := auth.ListLeasesWithin(c.QueryParam("prefix"), offset, budget)
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, partialResult(result, next))
+	}
+}
+
+// renews the lease in form value 'lease_id' by form value 'increment' seconds, if given
+func RenewLease() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		increment := 0
+		if raw := c.FormValue("increment"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "Increment must be a number of seconds",
+				})
+			}
+			increment = n
+		}
+
+		lease, err := auth.RenewLease(c.FormValue("lease_id"), increment)
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": lease,
+		})
+	}
+}
+
+// Revokes a lease, such as one returned alongside dynamic credentials
+func RevokeLease() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		leaseID := c.FormValue("lease_id")
+		if leaseID == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "lease_id must not be empty",
+			})
+		}
+
+		if err := auth.RevokeLease(leaseID); err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Lease revoked",
+		})
+	}
+}
+
+// revokes every lease under form value 'prefix', which must be repeated in 'confirm'
+// with 'force' set to true, leases are removed even if their backend fails to revoke them
+func RevokeLeasePrefix() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		prefix := c.FormValue("prefix")
+		if strings.Trim(c.FormValue("confirm"), "/") != strings.Trim(prefix, "/") {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Type the prefix to confirm revoking every lease under it",
+			})
+		}
+		if err := requireReason(c, c.FormValue("reason")); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		force := c.FormValue("force") == "true"
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.RevokeLeasePrefix(prefix, force); err != nil {
+			return inputError(c, err)
+		}
+		if force {
+			log.Println("[AUDIT]:", name, "force revoked leases under", prefix, "reason:", actionReasonOf(c))
+			announceAction(c, name, "force revoked leases under "+prefix)
+		} else {
+			log.Println("[AUDIT]:", name, "revoked leases under", prefix, "reason:", actionReasonOf(c))
+			announceAction(c, name, "revoked leases under "+prefix)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Leases revoked",
+		})
+	}
+}
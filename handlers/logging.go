@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/caiyeon/goldfish/logging"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/random"
+)
+
+// IDs set by a proxy are kept if they are safe to log and to pass on to vault
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// tags each request with an ID, returned to the client as X-Request-ID. Vault is sent
+// the same ID, so goldfish's logs can be matched with vault's audit log
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if !requestIDPattern.MatchString(id) {
+				id = random.String(32)
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			return next(c)
+		}
+	}
+}
+
+// the ID RequestID gave the current request
+func requestID(c echo.Context) string {
+	return c.Response().Header().Get(echo.HeaderXRequestID)
+}
+
+// logs every request once it has been served, in the configured log format
+func RequestLogger() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			// the error handler writes the response, so the status is known when logging
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			req := c.Request()
+			logging.Request(req.Method, req.RequestURI, c.Response().Status, time.Since(start), map[string]interface{}{
+				"route":      c.Path(),
+				"remote_ip":  c.RealIP(),
+				"user_agent": req.UserAgent(),
+				"bytes_out":  c.Response().Size,
+				"request_id": requestID(c),
+			})
+			return nil
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caiyeon/goldfish/metrics"
+	"github.com/caiyeon/goldfish/vault"
+)
+
+// a client IP's or username's recent failed logins, and until when it is locked out
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// slows down guessing of credentials, per client IP and per username.
+// Past the allowed failures, each further one locks out for backoff, doubling up to maxLockout
+type loginLimiter struct {
+	sync.Mutex
+	ipAttempts   int
+	userAttempts int
+	backoff      time.Duration
+	maxLockout   time.Duration
+	failures     map[string]*loginFailures
+	// failures are pruned once the map reaches this size
+	pruneAt int
+}
+
+// the least size the failures map is pruned at
+const loginPruneSize = 1000
+
+var logins = &loginLimiter{
+	ipAttempts:   20,
+	userAttempts: 5,
+	backoff:      time.Second,
+	maxLockout:   15 * time.Minute,
+	failures:     map[string]*loginFailures{},
+	pruneAt:      loginPruneSize,
+}
+
+// sets the login limits. Zero attempts turns that limit off
+func SetLoginLimits(ipAttempts, userAttempts int, backoff, maxLockout time.Duration) {
+	logins.Lock()
+	defer logins.Unlock()
+	logins.ipAttempts = ipAttempts
+	logins.userAttempts = userAttempts
+	logins.backoff = backoff
+	logins.maxLockout = maxLockout
+}
+
+// the username a login is for. Empty for auth types whose ID is a secret, e.g. a token
+func loginUsername(auth *vault.AuthInfo) string {
+	if auth.Type != "userpass" && auth.Type != "ldap" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", auth.Cluster, auth.Namespace, auth.Type, strings.ToLower(auth.ID))
+}
+
+type loginKey struct {
+	scope   string
+	key     string
+	allowed int
+}
+
+func (l *loginLimiter) keys(ip, user string) []loginKey {
+	keys := []loginKey{}
+	if l.ipAttempts > 0 && ip != "" {
+		keys = append(keys, loginKey{"ip", "ip:" + ip, l.ipAttempts})
+	}
+	if l.userAttempts > 0 && user != "" {
+		keys = append(keys, loginKey{"user", "user:" + user, l.userAttempts})
+	}
+	return keys
+}
+
+// how long until a login from the client IP for the username may be tried, zero if it may now
+func (l *loginLimiter) wait(ip, user string, now time.Time) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	wait := time.Duration(0)
+	for _, k := range l.keys(ip, user) {
+		if f, ok := l.failures[k.key]; ok && f.lockedUntil.Sub(now) > wait {
+			wait = f.lockedUntil.Sub(now)
+		}
+	}
+	return wait
+}
+
+// counts a failed login against the client IP and the username, locking them out past their allowance
+func (l *loginLimiter) failed(ip, user string, now time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	for _, k := range l.keys(ip, user) {
+		f, ok := l.failures[k.key]
+		if !ok || now.Sub(f.last) > l.maxLockout {
+			f = &loginFailures{}
+			l.failures[k.key] = f
+		}
+		f.count++
+		f.last = now
+		if f.count > k.allowed {
+			f.lockedUntil = now.Add(l.lockout(f.count - k.allowed))
+			metrics.LoginLockouts.Inc(k.scope)
+		}
+	}
+	// keeps the map bounded however many IPs and usernames are tried. The next prune waits for
+	// the map to double, so pruning costs about as much as the failures that grew it
+	if len(l.failures) >= l.pruneAt {
+		l.prune(now)
+		l.pruneAt = 2 * len(l.failures)
+		if l.pruneAt < loginPruneSize {
+			l.pruneAt = loginPruneSize
+		}
+	}
+}
+
+// a successful login clears the username's failures, but not the client IP's,
+// so that an attacker with one valid account can't keep resetting its count
+func (l *loginLimiter) succeeded(user string) {
+	if user == "" {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	delete(l.failures, "user:"+user)
+}
+
+// the lockout after the nth failure past the allowance
+func (l *loginLimiter) lockout(n int) time.Duration {
+	d := float64(l.backoff) * math.Pow(2, float64(n-1))
+	if d > float64(l.maxLockout) {
+		return l.maxLockout
+	}
+	return time.Duration(d)
+}
+
+func (l *loginLimiter) prune(now time.Time) {
+	for key, f := range l.failures {
+		if now.Sub(f.last) > l.maxLockout && !now.Before(f.lockedUntil) {
+			delete(l.failures, key)
+		}
+	}
+}
+
+// whether vault rejected the credentials, rather than goldfish or vault failing otherwise
+func credentialsRejected(err error) bool {
+	parts := strings.Split(err.Error(), "Code: ")
+	if len(parts) < 2 {
+		return false
+	}
+	end := strings.IndexAny(parts[1], ". ")
+	if end < 0 {
+		end = len(parts[1])
+	}
+	code, _ := strconv.Atoi(parts[1][:end])
+	return code == 400 || code == 401 || code == 403
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	Convey("A login limiter", t, func(c C) {
+		l := &loginLimiter{
+			ipAttempts:   4,
+			userAttempts: 2,
+			backoff:      time.Second,
+			maxLockout:   time.Minute,
+			failures:     map[string]*loginFailures{},
+		}
+		now := time.Now()
+
+		c.Convey("Should allow a username its attempts, then back off exponentially", func(c C) {
+			l.failed("192.0.2.1", "userpass/alice", now)
+			l.failed("192.0.2.1", "userpass/alice", now)
+			c.So(l.wait("192.0.2.1", "userpass/alice", now), ShouldEqual, 0)
+			l.failed("192.0.2.1", "userpass/alice", now)
+			c.So(l.wait("192.0.2.1", "userpass/alice", now), ShouldEqual, time.Second)
+			l.failed("192.0.2.1", "userpass/alice", now)
+			c.So(l.wait("192.0.2.1", "userpass/alice", now), ShouldEqual, 2*time.Second)
+			// other usernames are only held back by the client IP's count
+			c.So(l.wait("192.0.2.1", "userpass/bob", now), ShouldEqual, 0)
+		})
+
+		c.Convey("Should lock out a client IP trying many usernames", func(c C) {
+			for _, user := range []string{"a", "b", "c", "d", "e"} {
+				l.failed("192.0.2.1", user, now)
+			}
+			c.So(l.wait("192.0.2.1", "f", now), ShouldEqual, time.Second)
+			c.So(l.wait("192.0.2.2", "f", now), ShouldEqual, 0)
+		})
+
+		c.Convey("Should cap the lockout", func(c C) {
+			for i := 0; i < 50; i++ {
+				l.failed("", "userpass/alice", now)
+			}
+			c.So(l.wait("", "userpass/alice", now), ShouldEqual, time.Minute)
+		})
+
+		c.Convey("Should forget failures after a quiet period, or a successful login", func(c C) {
+			for i := 0; i < 3; i++ {
+				l.failed("", "userpass/alice", now)
+			}
+			l.failed("", "userpass/alice", now.Add(2*time.Minute))
+			c.So(l.wait("", "userpass/alice", now.Add(2*time.Minute)), ShouldEqual, 0)
+
+			l.failed("", "userpass/alice", now.Add(2*time.Minute))
+			l.failed("", "userpass/alice", now.Add(2*time.Minute))
+			l.succeeded("userpass/alice")
+			c.So(l.wait("", "userpass/alice", now.Add(2*time.Minute)), ShouldEqual, 0)
+		})
+
+		c.Convey("Should prune stale failures once the map grows past its threshold", func(c C) {
+			l.pruneAt = loginPruneSize
+			for i := 0; i < loginPruneSize-1; i++ {
+				l.failed("", fmt.Sprintf("userpass/stale%d", i), now)
+			}
+			c.So(len(l.failures), ShouldEqual, loginPruneSize-1)
+			l.failed("", "userpass/fresh", now.Add(2*time.Minute))
+			c.So(len(l.failures), ShouldEqual, 1)
+			c.So(l.pruneAt, ShouldEqual, loginPruneSize)
+		})
+	})
+
+	Convey("Rejected credentials", t, func(c C) {
+		c.So(credentialsRejected(errors.New("Error making API request.\n\nCode: 400. Errors:\n\n* invalid username or password")), ShouldBeTrue)
+		c.So(credentialsRejected(errors.New("Error making API request.\n\nCode: 503. Errors:\n\n* Vault is sealed")), ShouldBeFalse)
+		c.So(credentialsRejected(errors.New("dial tcp: connection refused")), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Reports goldfish state that is orphaned or expired
+// Only goldfish's cubbyhole entries are scanned. Request history is kept on purpose, and the
+// runtime config at config_path is rewritten whole on every change, so nothing is left behind in it
+func GetOrphanedState() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if admin, err := auth.IsAdmin(); err != nil {
+			return parseError(c, err)
+		} else if !admin {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Goldfish administrator rights required",
+			})
+		}
+
+		orphans, err := vault.FindOrphanedState()
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": orphans,
+		})
+	}
+}
+
+// Deletes the listed entries, but only if they are still orphaned
+func DeleteOrphanedState() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if admin, err := auth.IsAdmin(); err != nil {
+			return parseError(c, err)
+		} else if !admin {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Goldfish administrator rights required",
+			})
+		}
+
+		if c.FormValue("confirm") != "true" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Deletion must be confirmed",
+			})
+		}
+
+		// re-scan, so that entries which became live again are not deleted
+		orphans, err := vault.FindOrphanedState()
+		if err != nil {
+			return parseError(c, err)
+		}
+		current := make(map[string]bool, len(orphans))
+		for _, orphan := range orphans {
+			current[orphan.Path] = true
+		}
+
+		deleted := []string{}
+		for _, path := range strings.Split(c.FormValue("paths"), ",") {
+			if path = strings.TrimSpace(path); current[path] {
+				deleted = append(deleted, path)
+			}
+		}
+		if err := vault.DeleteOrphanedState(deleted); err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": deleted,
+		})
+	}
+}
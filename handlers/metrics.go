@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caiyeon/goldfish/metrics"
+	"github.com/labstack/echo"
+)
+
+// counts and times every request by its route, rather than its path, to keep labels bounded
+func Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			status := c.Response().Status
+			if err != nil {
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				} else {
+					status = http.StatusInternalServerError
+				}
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			method := c.Request().Method
+			metrics.HTTPRequests.Inc(method, route, strconv.Itoa(status))
+			metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(), method, route)
+			return err
+		}
+	}
+}
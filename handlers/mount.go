@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
+	"strings"
 
 	"github.com/caiyeon/goldfish/vault"
 	"github.com/gorilla/csrf"
@@ -79,6 +81,14 @@ func ConfigMount() echo.HandlerFunc {
 			return parseError(c, err)
 		}
 
+		// tuning these mounts needs approver groups' approval, see AddMountRequest
+		if vault.RequiresMountRequest(c.Param("mountname")) {
+			return c.JSON(http.StatusForbidden, H{
+				"error":            "Tuning this mount requires a request approved by others",
+				"request_required": true,
+			})
+		}
+
 		var config *vaultapi.MountConfigInput
 		if err := c.Bind(&config); err != nil {
 			return c.JSON(http.StatusBadRequest, H{
@@ -97,3 +107,133 @@ func ConfigMount() echo.HandlerFunc {
 		})
 	}
 }
+
+// enables a new secret backend from a JSON MountSpec
+func EnableMount() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var spec vault.MountSpec
+		if err := c.Bind(&spec); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid mount format",
+			})
+		}
+		if vault.RequiresMountRequest(spec.Path) {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "This mount is protected by approver groups, and cannot be enabled from goldfish",
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.EnableMount(spec); err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "enabled", spec.Type, "mount", spec.Path)
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Mount enabled",
+		})
+	}
+}
+
+// disables a mount, deleting its data. The mount's path must be typed as confirmation
+func DisableMount() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		mount := c.Param("mountname")
+		if vault.RequiresMountRequest(mount) {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "This mount is protected by approver groups, and cannot be disabled from goldfish",
+			})
+		}
+		if strings.Trim(c.QueryParam("confirm"), "/") != strings.Trim(mount, "/") {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Type the mount's path to confirm disabling it. All of its data will be deleted",
+			})
+		}
+		if err := requireReason(c, c.FormValue("reason")); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.DisableMount(mount); err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "disabled mount", mount, "reason:", actionReasonOf(c))
+		announceAction(c, name, "disabled mount "+mount)
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Mount disabled",
+		})
+	}
+}
+
+// moves a mount to the path in form value 'to'
+func MoveMount() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		mount, to := c.Param("mountname"), c.FormValue("to")
+		if vault.RequiresMountRequest(mount) || vault.RequiresMountRequest(to) {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "This mount is protected by approver groups, and cannot be moved from goldfish",
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.MoveMount(mount, to); err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "moved mount", mount, "to", to)
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Mount moved",
+		})
+	}
+}
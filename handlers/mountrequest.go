@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Mount requests follow the visibility of the mount's config: those that can read
+// it can see and reject requests to tune it. Approvers must also be in an approver group
+
+// true if the session can read the mount's config
+func canReadMount(auth *vault.AuthInfo, mount string) bool {
+	_, err := auth.GetMount(mount)
+	return err == nil
+}
+
+func GetMountRequests() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		requests, err := vault.ListMountRequests()
+		if err != nil {
+			return logError(c, err.Error(), "Could not read mount requests")
+		}
+		visible := []vault.MountRequest{}
+		for _, request := range requests {
+			// requests on other clusters are listed from sessions on them
+			if request.Cluster == auth.Cluster && canReadMount(auth, request.Mount) {
+				visible = append(visible, request)
+			}
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": visible,
+		})
+	}
+}
+
+// Submits a change to a mount's ttls or description
+func AddMountRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var settings vault.MountSettings
+		if err := c.Bind(&settings); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid config format",
+			})
+		}
+
+		mount := c.QueryParam("mount")
+		if _, err := auth.GetMount(mount); err != nil {
+			return parseError(c, err)
+		}
+
+		name, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		request, err := vault.CreateMountRequest(auth.Cluster, mount, settings, name, hash)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		log.Println("[AUDIT]:", name, "requested to tune mount", request.Mount, "request", request.ID)
+		return c.JSON(http.StatusOK, H{
+			"result": request,
+		})
+	}
+}
+
+func GetMountRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		request, err := vault.GetMountRequest(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if err := sameCluster(auth, request.Cluster); err != nil {
+			return inputError(c, err)
+		}
+		if !canReadMount(auth, request.Mount) {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You cannot read the config of this mount",
+			})
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result":          request,
+			"approver_groups": vault.PolicyApprovalProgress(request.Approvals),
+		})
+	}
+}
+
+// Approves a mount request on behalf of the approver groups the session belongs to
+// The last required approval tunes the mount
+func ApproveMountRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		request, err := vault.GetMountRequest(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if err := sameCluster(auth, request.Cluster); err != nil {
+			return inputError(c, err)
+		}
+		if !canReadMount(auth, request.Mount) {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You cannot read the config of this mount",
+			})
+		}
+
+		name, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+		groups, err := auth.ApproverGroupsOf()
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		request, applied, err := vault.ApproveMountRequest(request.ID, vault.PolicyApproval{
+			Approver:     name,
+			ApproverHash: hash,
+			Groups:       groups,
+		})
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		log.Println("[AUDIT]:", name, "approved tuning mount", request.Mount, "as", groups, "request", request.ID)
+		if applied {
+			log.Println("[AUDIT]:", "mount", request.Mount, "tuned, requested by", request.Requester, "request", request.ID)
+		}
+		return c.JSON(http.StatusOK, H{
+			"result":          request,
+			"applied":         applied,
+			"approver_groups": vault.PolicyApprovalProgress(request.Approvals),
+		})
+	}
+}
+
+// Anyone that is able to read the mount's config is able to reject requests for it
+func DeleteMountRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		request, err := vault.GetMountRequest(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if err := sameCluster(auth, request.Cluster); err != nil {
+			return inputError(c, err)
+		}
+		if !canReadMount(auth, request.Mount) {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You cannot read the config of this mount",
+			})
+		}
+
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+		if err := vault.DeleteMountRequest(request.ID); err != nil {
+			return parseError(c, err)
+		}
+
+		log.Println("[AUDIT]:", name, "rejected tuning mount", request.Mount, "request", request.ID)
+		return c.JSON(http.StatusOK, H{
+			"result": "Request deleted",
+		})
+	}
+}
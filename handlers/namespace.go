@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// lists the namespaces within the session's namespace
+func GetNamespaces() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		namespaces, err := auth.ListNamespaces()
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result":    namespaces,
+			"namespace": auth.Namespace,
+		})
+	}
+}
+
+// creates a namespace within the session's namespace
+func CreateNamespace() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.CreateNamespace(c.FormValue("name")); err != nil {
+			return inputError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Namespace created",
+		})
+	}
+}
+
+// switches the namespace the session works in. Empty switches to the root namespace
+func SetSessionNamespace() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		// the cookie keeps the token's cipher, not the token
+		session := *auth
+		defer session.Clear()
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.SetNamespace(c.FormValue("namespace")); err != nil {
+			return inputError(c, err)
+		}
+		session.Namespace = auth.Namespace
+		if err := setSessionCookie(c, &session); err != nil {
+			return c.JSON(http.StatusInternalServerError, H{
+				"error": "Goldfish could not encode cookie",
+			})
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": auth.Namespace,
+		})
+	}
+}
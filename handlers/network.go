@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/labstack/echo"
+)
+
+// which client addresses may use goldfish, and which may use its admin endpoints, those
+// only the admin role may reach, see vault.AdminRoute
+type NetworkRules struct {
+	Allowed      []*net.IPNet
+	Denied       []*net.IPNet
+	AdminAllowed []*net.IPNet
+	AdminDenied  []*net.IPNet
+}
+
+// refuses clients whose address the rules don't allow. Runs before routing, after TrustProxies
+// and BasePath, so the address and path are the client's rather than the proxy's
+func RestrictNetworks(rules NetworkRules) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			path := c.Request().URL.Path
+			// probes come from the orchestrator's network, and reveal nothing
+			if path == "/healthz" || path == "/readyz" {
+				return next(c)
+			}
+			ip := net.ParseIP(c.RealIP())
+			allowed := networkAllowed(ip, rules.Allowed, rules.Denied)
+			if allowed && vault.AdminRoute(c.Request().Method, path) {
+				allowed = networkAllowed(ip, rules.AdminAllowed, rules.AdminDenied)
+			}
+			if !allowed {
+				return c.JSON(http.StatusForbidden, H{
+					"error": "Goldfish can't be used from this network",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// a denied address is refused, as is one outside of a non-empty allow list.
+// A client without an address, i.e. over a unix socket without forwarded headers, can't be
+// shown to be allowed, so is only let through when there is no allow list
+func networkAllowed(ip net.IP, allowed, denied []*net.IPNet) bool {
+	if ip == nil {
+		return len(allowed) == 0
+	}
+	if inNetworks(ip, denied) {
+		return false
+	}
+	return len(allowed) == 0 || inNetworks(ip, allowed)
+}
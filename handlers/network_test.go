@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRestrictNetworks(t *testing.T) {
+	Convey("Network rules", t, func(c C) {
+		parse := func(cidr string) []*net.IPNet {
+			_, n, _ := net.ParseCIDR(cidr)
+			return []*net.IPNet{n}
+		}
+		rules := NetworkRules{
+			Denied:       parse("10.9.0.0/16"),
+			AdminAllowed: parse("10.0.0.0/8"),
+		}
+
+		status := func(remoteAddr, path string) int {
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, path, nil)
+			req.RemoteAddr = remoteAddr
+			rec := httptest.NewRecorder()
+			RestrictNetworks(rules)(func(ctx echo.Context) error {
+				return ctx.NoContent(http.StatusOK)
+			})(e.NewContext(req, rec))
+			return rec.Code
+		}
+
+		c.Convey("Should refuse denied addresses", func(c C) {
+			c.So(status("10.9.1.1:1234", "/api/secrets"), ShouldEqual, http.StatusForbidden)
+			c.So(status("198.51.100.7:1234", "/api/secrets"), ShouldEqual, http.StatusOK)
+		})
+
+		c.Convey("Should keep admin endpoints to their own networks", func(c C) {
+			c.So(status("198.51.100.7:1234", "/api/sys/unseal"), ShouldEqual, http.StatusForbidden)
+			c.So(status("10.1.1.1:1234", "/api/sys/unseal"), ShouldEqual, http.StatusOK)
+			c.So(status("10.9.1.1:1234", "/api/sys/unseal"), ShouldEqual, http.StatusForbidden)
+			c.So(status("198.51.100.7:1234", "/api/mounts/secret"), ShouldEqual, http.StatusForbidden)
+			c.So(status("198.51.100.7:1234", "/api/settings"), ShouldEqual, http.StatusForbidden)
+			c.So(status("10.1.1.1:1234", "/api/settings"), ShouldEqual, http.StatusOK)
+		})
+
+		c.Convey("Should leave probes alone", func(c C) {
+			c.So(status("10.9.1.1:1234", "/healthz"), ShouldEqual, http.StatusOK)
+		})
+	})
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Lists roles, or reads one if a name is given
+func GetPKIRoles() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var result interface{}
+		var err error
+		if name := c.QueryParam("name"); name == "" {
+			result, err = auth.ListPKIRoles(c.QueryParam("mount"))
+		} else {
+			result, err = auth.ReadPKIRole(c.QueryParam("mount"), name)
+		}
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// Issues a certificate against a role. If a csr is provided, it is signed instead
+func IssuePKICert() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		commonName := c.FormValue("common_name")
+		if commonName == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "common_name must not be empty",
+			})
+		}
+
+		params := map[string]interface{}{
+			"common_name": commonName,
+		}
+		for _, key := range []string{"alt_names", "ip_sans", "ttl", "format", "exclude_cn_from_sans"} {
+			if value := c.FormValue(key); value != "" {
+				params[key] = value
+			}
+		}
+
+		result, err := auth.IssuePKICert(c.QueryParam("mount"), c.Param("role"), c.FormValue("csr"), params)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// Lists issued certificate serials, or reads one certificate if a serial is given
+func GetPKICerts() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var result interface{}
+		var err error
+		if serial := c.QueryParam("serial"); serial == "" {
+			result, err = auth.ListPKICerts(c.QueryParam("mount"))
+		} else {
+			result, err = auth.ReadPKICert(c.QueryParam("mount"), serial)
+		}
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+func RevokePKICert() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		serial := c.FormValue("serial")
+		if serial == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "serial must not be empty",
+			})
+		}
+
+		result, err := auth.RevokePKICert(c.QueryParam("mount"), serial)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// Returns the CA certificate and chain
+func GetPKICA() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		result, err := auth.ReadPKICA(c.QueryParam("mount"))
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// Returns the current CRL
+func GetPKICRL() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		result, err := auth.ReadPKICRL(c.QueryParam("mount"))
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+func RotatePKICRL() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		result, err := auth.RotatePKICRL(c.QueryParam("mount"))
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+func TidyPKI() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		params := map[string]interface{}{
+			"tidy_cert_store":      c.FormValue("tidy_cert_store") == "true",
+			"tidy_revocation_list": c.FormValue("tidy_revocation_list") == "true",
+		}
+		if buffer := c.FormValue("safety_buffer"); buffer != "" {
+			params["safety_buffer"] = buffer
+		}
+
+		if err := auth.TidyPKI(c.QueryParam("mount"), params); err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Tidy started",
+		})
+	}
+}
+
+// Reads the issuing certificate, CRL distribution point and OCSP URLs
+func GetPKIURLs() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		result, err := auth.ReadPKIURLs(c.QueryParam("mount"))
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+func ConfigPKIURLs() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		// each field is a comma separated list of urls. Fields left out keep their urls
+		form, err := c.FormParams()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid parameters",
+			})
+		}
+		params := map[string]interface{}{}
+		for _, key := range []string{"issuing_certificates", "crl_distribution_points", "ocsp_servers"} {
+			if values, ok := form[key]; ok && len(values) > 0 {
+				params[key] = values[0]
+			}
+		}
+		if len(params) == 0 {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "No urls were given",
+			})
+		}
+
+		if err := auth.WritePKIURLs(c.QueryParam("mount"), params); err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": "URLs updated",
+		})
+	}
+}
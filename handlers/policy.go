@@ -1,15 +1,19 @@
 package handlers
 
 import (
-	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/caiyeon/goldfish/github"
+	gpolicy "github.com/caiyeon/goldfish/policy"
 	"github.com/caiyeon/goldfish/slack"
 	"github.com/caiyeon/goldfish/vault"
 
@@ -36,12 +40,71 @@ type PolicyRequest struct {
 	RequesterHash string
 	Required      int
 	Progress      int    `hash:"ignore"`
+	// optional RFC3339 window the change may be applied in. Kept out of the hash,
+	// so that requests made before windows existed still verify
+	ApplyAfter    string `hash:"ignore"`
+	ApplyBefore   string `hash:"ignore"`
+	// when the request was made, for expiry. Kept out of the hash like the window
+	Created       string `hash:"ignore"`
+	// further policies changed together with this one, see vault.EncodePolicyBundle
+	Bundle        string
+	// the cluster the policies are on, empty for the default cluster
+	Cluster       string
+	// the namespace the policies are in, empty for the root namespace
+	Namespace     string
+}
+
+// requests for a single policy in the default cluster's root namespace have no bundle,
+// cluster or namespace, and hash as they did before any of them existed
+func (request PolicyRequest) HashInclude(field string, v interface{}) (bool, error) {
+	switch field {
+	case "Bundle":
+		return request.Bundle != "", nil
+	case "Cluster":
+		return request.Cluster != "", nil
+	case "Namespace":
+		return request.Namespace != "", nil
+	}
+	return true, nil
+}
+
+// every policy the request changes, the first one included
+func (request PolicyRequest) changes() ([]vault.PolicyChange, error) {
+	bundle, err := vault.DecodePolicyBundle(request.Bundle)
+	if err != nil {
+		return nil, err
+	}
+	first := vault.PolicyChange{Policy: request.Policy, Current: request.Current, New: request.New}
+	return append([]vault.PolicyChange{first}, bundle...), nil
+}
+
+// reads the current rules of every policy the request changes
+// this also verifies the user has rights to see each of them
+func currentPolicies(auth *vault.AuthInfo, request PolicyRequest) (map[string]string, error) {
+	if err := sameCluster(auth, request.Cluster); err != nil {
+		return nil, err
+	}
+	if auth.Namespace != request.Namespace {
+		return nil, errors.New("The request was made in namespace '" + request.Namespace + "', switch to it to see the request")
+	}
+	changes, err := request.changes()
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]string{}
+	for _, change := range changes {
+		if current[change.Policy], err = auth.GetPolicy(change.Policy); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
 }
 
 type PolicyDiff struct {
 	Policy  string
 	Current string
 	New     string
+	Hunks   []gpolicy.Hunk
 }
 
 func GetPolicy() echo.HandlerFunc {
@@ -95,10 +158,22 @@ func DeletePolicy() echo.HandlerFunc {
 			return parseError(c, err)
 		}
 
+		policy := c.QueryParam("policy")
+		if err := requireReason(c, c.FormValue("reason")); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
 		// fetch results
-		if err := auth.DeletePolicy(c.QueryParam("policy")); err != nil {
+		if err := auth.DeletePolicy(policy); err != nil {
 			return parseError(c, err)
 		}
+		announceAction(c, name, "deleted policy "+policy)
 
 		return c.JSON(http.StatusOK, H{
 			"result": "Policy deleted",
@@ -106,6 +181,120 @@ func DeletePolicy() echo.HandlerFunc {
 	}
 }
 
+// counts the live tokens, entities and groups that reference each policy
+func GetPolicyUsage() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		budget, offset, err := requestBudget(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		// fetch results, possibly partial if budget runs out
+		result, next, err := auth.GetPolicyUsageWithin(offset, budget)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, partialResult(result, next))
+	}
+}
+
+// checks policy rules for syntax errors and risky grants before they are requested
+func ValidatePolicy() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		rules := c.FormValue("rules")
+		if rules == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Policy rules are required",
+			})
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": gpolicy.Lint(rules),
+		})
+	}
+}
+
+// shows what a token, or a set of policies, can do on each of a list of paths
+func SimulatePolicy() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if admin, err := auth.IsAdmin(); err != nil {
+			return parseError(c, err)
+		} else if !admin {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Goldfish administrator rights required",
+			})
+		}
+
+		// one path per line, or comma separated
+		paths := strings.FieldsFunc(c.FormValue("paths"), func(r rune) bool {
+			return r == '\n' || r == ','
+		})
+
+		var result []vault.PathCapabilities
+		var err error
+		if accessor := c.FormValue("accessor"); accessor != "" {
+			result, err = auth.SimulateAccessor(accessor, paths)
+		} else {
+			policies := []string{}
+			for _, policy := range strings.Split(c.FormValue("policies"), ",") {
+				if policy = strings.TrimSpace(policy); policy != "" {
+					policies = append(policies, policy)
+				}
+			}
+			result, err = auth.SimulatePolicies(policies, paths)
+		}
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
 // Adds a policy request to cubbyhole, that can be rejected/approved later
 // Requires requester to have read access to the policy's rule
 func AddPolicyRequest() echo.HandlerFunc {
@@ -145,79 +334,324 @@ func AddPolicyRequest() echo.HandlerFunc {
 			})
 		}
 
-		// collect non-dangerous identifying data on requester
-		self, err := auth.LookupSelf()
+		// changes to further policies may be bundled in, as a JSON object of names to rules
+		// they are applied together with the first policy, or not at all
+		bundle := []vault.PolicyChange{}
+		if raw := c.FormValue("bundle"); raw != "" {
+			var proposed map[string]string
+			if err := json.Unmarshal([]byte(raw), &proposed); err != nil {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "Bundle must be a JSON object of policy names to rules",
+				})
+			}
+			names := []string{}
+			for name := range proposed {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				if name == policy {
+					return c.JSON(http.StatusBadRequest, H{
+						"error": "Bundle cannot change " + name + " twice",
+					})
+				}
+				current, err := auth.GetPolicy(name)
+				if err != nil {
+					return parseError(c, err)
+				}
+				if _, err := hcl.Parse(proposed[name]); err != nil {
+					return c.JSON(http.StatusBadRequest, H{
+						"error": "Policy " + name + " must be HCL formatted",
+					})
+				}
+				if current == proposed[name] {
+					return c.JSON(http.StatusBadRequest, H{
+						"error": "Policy request for " + name + " is identical to current",
+					})
+				}
+				bundle = append(bundle, vault.PolicyChange{Policy: name, Current: current, New: proposed[name]})
+			}
+		}
+		encodedBundle, err := vault.EncodePolicyBundle(bundle)
 		if err != nil {
 			return parseError(c, err)
 		}
 
-		// get number of unseal keys required to generate root token
-		status, err := vault.GenerateRootStatus()
+		// change freezes can be respected by scheduling when the change may be applied
+		applyAfter, applyBefore := c.FormValue("apply_after"), c.FormValue("apply_before")
+		if err := vault.ValidateApplyWindow(applyAfter, applyBefore, time.Now()); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		return submitPolicyRequest(c, auth, PolicyRequest{
+			Policy:      policy,
+			Current:     policyOld,
+			New:         policyNew,
+			ApplyAfter:  applyAfter,
+			ApplyBefore: applyBefore,
+			Bundle:      encodedBundle,
+		})
+	}
+}
+
+// explains a policy in plain language, either an existing one by name or posted rules
+func GetPolicySummary() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		rules := c.FormValue("rules")
+		if name := c.QueryParam("policy"); name != "" {
+			var err error
+			if rules, err = auth.GetPolicy(name); err != nil {
+				return parseError(c, err)
+			}
+		}
+		if rules == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Either a policy name or policy rules are required",
+			})
+		}
+
+		summary, err := gpolicy.Summarize(rules)
 		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid policy: " + err.Error(),
+			})
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": summary,
+		})
+	}
+}
+
+// lists the policy templates the user can read, or one template with ?template=
+func GetPolicyTemplates() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
 			return parseError(c, err)
 		}
 
-		// construct request
-		requester, ok := self.Data["display_name"].(string)
-		if !ok {
-			return c.JSON(http.StatusInternalServerError, H{
-				"error": "Could not parse requester display name",
+		var result interface{}
+		var err error
+		if name := c.QueryParam("template"); name != "" {
+			result, err = auth.GetPolicyTemplate(name)
+		} else {
+			result, err = auth.ListPolicyTemplates()
+		}
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// renders a policy template with the given variables, and requests the resulting policy
+func AddPolicyRequestFromTemplate() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
 			})
 		}
-		accessor, ok := self.Data["accessor"].(string)
-		if !ok {
-			return c.JSON(http.StatusInternalServerError, H{
-				"error": "Could not hash requester token accessor",
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		template, err := auth.GetPolicyTemplate(c.FormValue("template"))
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		// variables are a JSON object of names to values
+		values := map[string]string{}
+		if raw := c.FormValue("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &values); err != nil {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "Variables must be a JSON object of names to values",
+				})
+			}
+		}
+		policy, policyNew, err := template.Render(values)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
 			})
 		}
-		request := PolicyRequest{
-			Policy:        policy,
-			Current:       policyOld,
-			New:           policyNew,
-			Requester:     requester,
-			RequesterHash: fmt.Sprintf("%x", sha256.Sum256([]byte(accessor))),
-			Required:      status.Required,
-			Progress:      0,
+		if report := gpolicy.Lint(policyNew); !report.Valid {
+			return c.JSON(http.StatusBadRequest, H{
+				"error":  "Template " + template.Name + " renders an invalid policy",
+				"result": report,
+			})
 		}
 
-		// hash request structure
-		hash_uint64, err := hashstructure.Hash(request, nil)
+		// check if user has access to policy
+		policyOld, err := auth.GetPolicy(policy)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, H{
-				"error": "Could not hash request",
+			return parseError(c, err)
+		}
+		if policyOld == policyNew {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Policy request is identical to current",
 			})
 		}
-		hash := strconv.FormatUint(hash_uint64, 16)
 
-		// write to cubbyhole with details
-		_, err = vault.WriteToCubbyhole("requests/" + hash, structs.Map(request))
+		applyAfter, applyBefore := c.FormValue("apply_after"), c.FormValue("apply_before")
+		if err := vault.ValidateApplyWindow(applyAfter, applyBefore, time.Now()); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		return submitPolicyRequest(c, auth, PolicyRequest{
+			Policy:      policy,
+			Current:     policyOld,
+			New:         policyNew,
+			ApplyAfter:  applyAfter,
+			ApplyBefore: applyBefore,
+		})
+	}
+}
+
+// fills in the requester of a policy request, stores it and lets approvers know about it
+func submitPolicyRequest(c echo.Context, auth *vault.AuthInfo, request PolicyRequest) error {
+	// collect non-dangerous identifying data on requester
+	self, err := auth.LookupSelf()
+	if err != nil {
+		return parseError(c, err)
+	}
+
+	// get number of unseal keys required to generate root token
+	status, err := vault.GenerateRootStatus(auth.Cluster)
+	if err != nil {
+		return parseError(c, err)
+	}
+
+	// construct request
+	requester, ok := self.Data["display_name"].(string)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, H{
+			"error": "Could not parse requester display name",
+		})
+	}
+	request.Requester = requester
+	request.Cluster = auth.Cluster
+	request.Namespace = auth.Namespace
+	// by entity, like approvers, so the requester can't approve from another login
+	request.RequesterHash = identityHash(self.Data)
+	request.Required = status.Required
+	request.Progress = 0
+	request.Created = time.Now().UTC().Format(time.RFC3339)
+
+	// hash request structure
+	hash_uint64, err := hashstructure.Hash(request, nil)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"error": "Could not hash request",
+		})
+	}
+	hash := strconv.FormatUint(hash_uint64, 16)
+
+	// write to cubbyhole with details
+	_, err = vault.WriteToCubbyhole("requests/" + hash, structs.Map(request))
+	if err != nil {
+		return parseError(c, err)
+	}
+	// the requester is emailed once it is applied, if their email is known
+	if err := vault.SetRequestContact(hash, request.Policy, vault.RequesterEmail(self)); err != nil {
+		log.Println("[ERROR]: Could not record requester email for", hash+":", err.Error())
+	}
+	recordPolicyEvent(hash, request.Policy, vault.RequestCreated, requester, "")
+
+	// if config has a slack webhook, send the hash (aka change ID) to the channel
+	conf := vault.GetConfig()
+	if conf.SlackWebhook != "" {
+		// send a message using webhook
+		err = slack.PostMessageWebhook(
+			conf.SlackChannel,
+			"A new policy change request has been submitted",
+			"Change ID: \n*" + hash + "*",
+			conf.SlackWebhook,
+		)
+		// change request is fine, just let the frontend know it wasn't slack'd
 		if err != nil {
+			return c.JSON(http.StatusOK, H{
+				"result": hash,
+				"error": "Could not send to slack webhook",
+			})
+		}
+	}
+
+	// return hash
+	return c.JSON(http.StatusOK, H{
+		"result": hash,
+		"error": "",
+	})
+}
+
+// Lists policy requests that were rejected because they expired
+// Only requests for policies the user can read are listed
+func GetExpiredPolicyRequests() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
 			return parseError(c, err)
 		}
 
-		// if config has a slack webhook, send the hash (aka change ID) to the channel
-		conf := vault.GetConfig()
-		if conf.SlackWebhook != "" {
-			// send a message using webhook
-			err = slack.PostMessageWebhook(
-				conf.SlackChannel,
-				"A new policy change request has been submitted",
-				"Change ID: \n*" + hash + "*",
-				conf.SlackWebhook,
-			)
-			// change request is fine, just let the frontend know it wasn't slack'd
-			if err != nil {
-				return c.JSON(http.StatusOK, H{
-					"result": hash,
-					"error": "Could not send to slack webhook",
-				})
+		expired, err := vault.ListExpiredRequests()
+		if err != nil {
+			return logError(c, err.Error(), "Could not read expired requests")
+		}
+		visible := []vault.ExpiredRequest{}
+		for _, request := range expired {
+			if _, err := auth.GetPolicy(request.Policy); err == nil {
+				visible = append(visible, request)
 			}
 		}
 
-		// return hash
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
 		return c.JSON(http.StatusOK, H{
-			"result": hash,
-			"error": "",
+			"result": visible,
 		})
 	}
 }
@@ -285,10 +719,10 @@ func getPolicyRequestByChangeID(c echo.Context, auth *vault.AuthInfo, hash strin
 		})
 	}
 
-	// verify current user has rights to see policy
-	policyCurrent, err := auth.GetPolicy(request.Policy)
+	// verify current user has rights to see every policy
+	policyCurrent, err := currentPolicies(auth, request)
 	if err != nil {
-		return parseError(c, err)
+		return inputError(c, err)
 	}
 
 	// verify hash
@@ -300,7 +734,7 @@ func getPolicyRequestByChangeID(c echo.Context, auth *vault.AuthInfo, hash strin
 	}
 
 	// if vault has been re-keyed, the request is invalid
-	status, err := vault.GenerateRootStatus()
+	status, err := vault.GenerateRootStatus(request.Cluster)
 	if err != nil {
 		return parseError(c, err)
 	}
@@ -310,13 +744,38 @@ func getPolicyRequestByChangeID(c echo.Context, auth *vault.AuthInfo, hash strin
 		})
 	}
 
-	// return request
-	c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
-	return c.JSON(http.StatusOK, H{
+	// verifyRequest already decoded the bundle, so this cannot fail
+	changes, _ := request.changes()
+	diffs := []PolicyDiff{}
+	for _, change := range changes {
+		diffs = append(diffs, PolicyDiff{
+			Policy:  change.Policy,
+			Current: change.Current,
+			New:     change.New,
+			Hunks:   gpolicy.Diff(change.Current, change.New, diffContext(c)),
+		})
+	}
+
+	result := H{
 		"result": request,
 		"progress": request.Progress,
 		"required": request.Required,
-	})
+		"apply_window": vault.ApplyWindowState(request.ApplyAfter, request.ApplyBefore, time.Now()),
+		"diff": diffs[0].Hunks,
+		"changes": diffs,
+	}
+	if vault.ApproverGroupsEnabled() {
+		approvals, err := vault.ListPolicyApprovals(hash)
+		if err != nil {
+			return parseError(c, err)
+		}
+		result["approvals"] = approvals
+		result["approver_groups"] = vault.PolicyApprovalProgress(approvals)
+	}
+
+	// return request
+	c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+	return c.JSON(http.StatusOK, result)
 }
 
 func getPolicyRequestByCommitHash(c echo.Context, auth *vault.AuthInfo, hash string) error {
@@ -327,8 +786,12 @@ func getPolicyRequestByCommitHash(c echo.Context, auth *vault.AuthInfo, hash str
 		})
 	}
 
+	for i := range changes {
+		changes[i].Hunks = gpolicy.Diff(changes[i].Current, changes[i].New, diffContext(c))
+	}
+
 	// check progress and total unseals required
-	status, err := vault.GenerateRootStatus()
+	status, err := vault.GenerateRootStatus(auth.Cluster)
 	if err != nil {
 		return parseError(c, err)
 	}
@@ -466,6 +929,138 @@ func UpdatePolicyRequest() echo.HandlerFunc {
 	}
 }
 
+// Approves a policy request on behalf of the approver groups the session belongs to
+// Once every group has given its required approvals, goldfish applies the change itself
+func ApprovePolicyRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		if !vault.ApproverGroupsEnabled() {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "No approver groups are configured, requests must be approved with unseal keys",
+			})
+		}
+
+		// fetch change from cubbyhole
+		hash := c.Param("id")
+		resp, err := vault.ReadFromCubbyhole("requests/" + hash)
+		if err != nil {
+			return parseError(c, err)
+		}
+		if resp == nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Change ID not found",
+			})
+		}
+		var request PolicyRequest
+		if err := mapstructure.Decode(resp.Data, &request); err != nil {
+			return c.JSON(http.StatusInternalServerError, H{
+				"error": "Change appears to be malformed",
+			})
+		}
+
+		// verify current user has rights to see every policy
+		policyCurrent, err := currentPolicies(auth, request)
+		if err != nil {
+			return inputError(c, err)
+		}
+		if statusCode, err := verifyRequest(request, hash, policyCurrent); err != nil {
+			return c.JSON(statusCode, H{
+				"error": err.Error(),
+			})
+		}
+
+		window := vault.ApplyWindowState(request.ApplyAfter, request.ApplyBefore, time.Now())
+		if window == vault.ApplyWindowClosed {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Request could only be applied before " + request.ApplyBefore,
+			})
+		}
+
+		name, approverHash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+		if approverHash == request.RequesterHash {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Requester cannot approve their own request",
+			})
+		}
+		groups, err := auth.ApproverGroupsOf()
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		approvals, err := vault.AddPolicyApproval(hash, vault.PolicyApproval{
+			Approver:     name,
+			ApproverHash: approverHash,
+			Groups:       groups,
+		})
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		log.Println("[AUDIT]:", name, "approved policy request", hash, "for", request.Policy, "as", groups)
+		recordPolicyEvent(hash, request.Policy, vault.RequestApproved, name, "as "+strings.Join(groups, ", "))
+
+		if !vault.PolicyApprovalsSatisfied(approvals) {
+			return c.JSON(http.StatusOK, H{
+				"approvals":       approvals,
+				"approver_groups": vault.PolicyApprovalProgress(approvals),
+			})
+		}
+
+		// every group has approved. Goldfish applies it itself once its window opens
+		if window == vault.ApplyWindowPending {
+			if err := vault.SchedulePolicyRequest(hash); err != nil {
+				return parseError(c, err)
+			}
+			recordPolicyEvent(hash, request.Policy, vault.RequestScheduled, "goldfish", "to be applied after "+request.ApplyAfter)
+			return c.JSON(http.StatusOK, H{
+				"approvals":       approvals,
+				"approver_groups": vault.PolicyApprovalProgress(approvals),
+				"scheduled":       request.ApplyAfter,
+			})
+		}
+
+		// the request is done with either way
+		defer vault.DeleteFromCubbyhole("unseal_wrapping_tokens/" + hash)
+		defer vault.DeleteFromCubbyhole("requests/" + hash)
+		defer vault.DeleteAttachments(hash)
+		defer vault.DeletePolicyApprovals(hash)
+
+		changes, _ := request.changes()
+		if err := vault.ApplyApprovedPolicyChanges(request.Cluster, request.Namespace, changes); err != nil {
+			return parseError(c, err)
+		}
+		log.Println("[AUDIT]:", "policy request", hash, "for", request.Policy, "applied, requested by", request.Requester)
+		recordPolicyEvent(hash, request.Policy, vault.RequestApplied, "goldfish", "approved by every approver group")
+
+		// confirm changes have been applied
+		policyNow, err := auth.GetPolicy(request.Policy)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": policyNow,
+		})
+	}
+}
+
 func updatePolicyRequestByChangeID(c echo.Context, auth *vault.AuthInfo, hash string, unsealKey string) error {
 	// fetch change from cubbyhole
 	resp, err := vault.ReadFromCubbyhole("requests/" + hash)
@@ -487,10 +1082,10 @@ func updatePolicyRequestByChangeID(c echo.Context, auth *vault.AuthInfo, hash st
 		})
 	}
 
-	// verify current user has rights to see policy
-	policyCurrent, err := auth.GetPolicy(request.Policy)
+	// verify current user has rights to see every policy
+	policyCurrent, err := currentPolicies(auth, request)
 	if err != nil {
-		return parseError(c, err)
+		return inputError(c, err)
 	}
 
 	// verify hash
@@ -502,7 +1097,7 @@ func updatePolicyRequestByChangeID(c echo.Context, auth *vault.AuthInfo, hash st
 	}
 
 	// if vault has been re-keyed, the request is invalid
-	status, err := vault.GenerateRootStatus()
+	status, err := vault.GenerateRootStatus(request.Cluster)
 	if err != nil {
 		return parseError(c, err)
 	}
@@ -512,6 +1107,18 @@ func updatePolicyRequestByChangeID(c echo.Context, auth *vault.AuthInfo, hash st
 		})
 	}
 
+	// a generated root token can't wait for a window, so unseal keys are only taken while it is open
+	switch vault.ApplyWindowState(request.ApplyAfter, request.ApplyBefore, time.Now()) {
+	case vault.ApplyWindowPending:
+		return c.JSON(http.StatusBadRequest, H{
+			"error": "Request may not be applied before " + request.ApplyAfter + ", submit unseal keys then",
+		})
+	case vault.ApplyWindowClosed:
+		return c.JSON(http.StatusBadRequest, H{
+			"error": "Request could only be applied before " + request.ApplyBefore,
+		})
+	}
+
 	// count how many unseals are entered so far
 	wrappingTokens := []string{}
 	if request.Progress > 0 {
@@ -532,6 +1139,10 @@ func updatePolicyRequestByChangeID(c echo.Context, auth *vault.AuthInfo, hash st
 
 	// add the new wrapping token to the slice
 	wrappingTokens = append(wrappingTokens, newWrappingToken)
+	if name, _, err := sessionIdentity(auth); err == nil {
+		recordPolicyEvent(hash, request.Policy, vault.RequestApproved, name,
+			fmt.Sprintf("unseal key %d of %d", len(wrappingTokens), request.Required))
+	}
 
 	// if there aren't enough unseals yet
 	if len(wrappingTokens) < request.Required {
@@ -581,7 +1192,7 @@ func updatePolicyRequestByChangeID(c echo.Context, auth *vault.AuthInfo, hash st
 
 	// start a root generation
 	otp := base64.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(16))
-	status, err = vault.GenerateRootInit(otp)
+	status, err = vault.GenerateRootInit(request.Cluster, otp)
 	if err != nil {
 		return parseError(c, err)
 	}
@@ -589,11 +1200,11 @@ func updatePolicyRequestByChangeID(c echo.Context, auth *vault.AuthInfo, hash st
 	// feed unseal tokens
 	if status.EncodedRootToken == "" {
 		for _, s := range(unseals) {
-			status, err = vault.GenerateRootUpdate(s, status.Nonce)
+			status, err = vault.GenerateRootUpdate(request.Cluster, s, status.Nonce)
 			// an error likely means one of the unseals was not valid
 			if err != nil {
 				// delete root generation process
-				if err := vault.GenerateRootCancel(); err != nil {
+				if err := vault.GenerateRootCancel(request.Cluster); err != nil {
 					return parseError(c, err)
 				}
 				// inform user that request unseals have been reset
@@ -627,19 +1238,25 @@ func updatePolicyRequestByChangeID(c echo.Context, auth *vault.AuthInfo, hash st
 
 	// perform policy change with generated root token
 	var rootauth = &vault.AuthInfo{
-		Type: "token",
-		ID:   token,
+		Type:      "token",
+		ID:        token,
+		Cluster:   request.Cluster,
+		Namespace: request.Namespace,
 	}
 
 	// ensure generated root token is revoked, and cubbyhole data is purged
 	defer vault.DeleteFromCubbyhole("requests/" + hash)
+	defer vault.DeleteAttachments(hash)
+	defer vault.DeletePolicyApprovals(hash)
 	defer rootauth.RevokeSelf()
 
-	// make requested change
-	err = rootauth.PutPolicy(request.Policy, request.New)
+	// make requested changes, all of them or none
+	changes, _ := request.changes()
+	err = vault.ApplyPolicyChanges(rootauth, changes)
 	if err != nil {
 		return parseError(c, err)
 	}
+	recordPolicyEvent(hash, request.Policy, vault.RequestApplied, "goldfish", "with a generated root token")
 
 	// confirm changes have been applied
 	policyNow, err := auth.GetPolicy(request.Policy)
@@ -689,7 +1306,7 @@ func updatePolicyRequestByCommitHash(c echo.Context, auth *vault.AuthInfo, hash
 	wrappingTokens = append(wrappingTokens, newWrappingToken)
 
 	// if there aren't enough unseals yet, store them all and return progress and required
-	status, err := vault.GenerateRootStatus()
+	status, err := vault.GenerateRootStatus(auth.Cluster)
 	if err != nil {
 		return parseError(c, err)
 	}
@@ -729,7 +1346,7 @@ func updatePolicyRequestByCommitHash(c echo.Context, auth *vault.AuthInfo, hash
 
 	// start a root generation
 	otp := base64.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(16))
-	status, err = vault.GenerateRootInit(otp)
+	status, err = vault.GenerateRootInit(auth.Cluster, otp)
 	if err != nil {
 		return parseError(c, err)
 	}
@@ -737,11 +1354,11 @@ func updatePolicyRequestByCommitHash(c echo.Context, auth *vault.AuthInfo, hash
 	// feed unseal tokens
 	if status.EncodedRootToken == "" {
 		for _, s := range(unseals) {
-			status, err = vault.GenerateRootUpdate(s, status.Nonce)
+			status, err = vault.GenerateRootUpdate(auth.Cluster, s, status.Nonce)
 			// an error likely means one of the unseals was not valid
 			if err != nil {
 				// delete root generation process
-				if err := vault.GenerateRootCancel(); err != nil {
+				if err := vault.GenerateRootCancel(auth.Cluster); err != nil {
 					return parseError(c, err)
 				}
 				// inform user that request unseals have been reset
@@ -775,8 +1392,10 @@ func updatePolicyRequestByCommitHash(c echo.Context, auth *vault.AuthInfo, hash
 
 	// perform policy change with generated root token
 	var rootauth = &vault.AuthInfo{
-		Type: "token",
-		ID:   token,
+		Type:      "token",
+		ID:        token,
+		Cluster:   auth.Cluster,
+		Namespace: auth.Namespace,
 	}
 
 	// ensure generated root token is revoked
@@ -825,29 +1444,42 @@ func DeletePolicyRequest() echo.HandlerFunc {
 			})
 		}
 
-		// fetch policy name from change
-		policyName, ok := resp.Data["Policy"]
-		if !ok {
+		// fetch policy names from change
+		var request PolicyRequest
+		if err := mapstructure.Decode(resp.Data, &request); err != nil || request.Policy == "" {
 			return c.JSON(http.StatusBadRequest, H{
 				"error": "Change appears to be malformed",
 			})
 		}
 
-		// verify current user has rights to see policy
-		_, err = auth.GetPolicy(policyName.(string))
+		// verify current user has rights to see every policy
+		if _, err := currentPolicies(auth, request); err != nil {
+			return inputError(c, err)
+		}
+		name, _, err := sessionIdentity(auth)
 		if err != nil {
 			return parseError(c, err)
 		}
 
 		// purge change related data from cubbyhole
-		_, err = vault.DeleteFromCubbyhole("unseals/" + hash)
+		_, err = vault.DeleteFromCubbyhole("unseal_wrapping_tokens/" + hash)
 		if err != nil {
 			return parseError(c, err)
 		}
+		if err := vault.DeleteAttachments(hash); err != nil {
+			return parseError(c, err)
+		}
+		if err := vault.DeletePolicyApprovals(hash); err != nil {
+			return parseError(c, err)
+		}
+		if err := vault.UnschedulePolicyRequest(hash); err != nil {
+			return parseError(c, err)
+		}
 		_, err = vault.DeleteFromCubbyhole("requests/" + hash)
 		if err != nil {
 			return parseError(c, err)
 		}
+		recordPolicyEvent(hash, request.Policy, vault.RequestRejected, name, "")
 
 		return c.JSON(http.StatusOK, H{
 			"result": "Request deleted",
@@ -855,25 +1487,50 @@ func DeletePolicyRequest() echo.HandlerFunc {
 	}
 }
 
-func verifyRequest(request PolicyRequest, hash string, policyCurrent string) (int, error) {
+// the number of context lines diffs are rendered with, from the optional 'context' query param
+func diffContext(c echo.Context) int {
+	if n, err := strconv.Atoi(c.QueryParam("context")); err == nil && n >= 0 && n <= 100 {
+		return n
+	}
+	return gpolicy.DefaultDiffContext
+}
+
+// policyCurrent maps each policy in the request to its current rules, see currentPolicies
+func verifyRequest(request PolicyRequest, hash string, policyCurrent map[string]string) (int, error) {
 	hash_uint64, err := hashstructure.Hash(request, nil)
 	if err != nil || strconv.FormatUint(hash_uint64, 16) != hash {
 		return http.StatusBadRequest, errors.New("Hashes do not match")
 	}
 
-	// verify that policy has not been changed since change was requested
-	if policyCurrent != request.Current {
-		return http.StatusBadRequest, errors.New("Policy has been changed since request was made")
+	if vault.PolicyRequestExpired(request.Created, time.Now()) {
+		return http.StatusBadRequest, errors.New("Request has expired")
 	}
 
-	// verify new policy conforms to HCL formatting
-	if _, err := hcl.Parse(request.New); err != nil {
-		return http.StatusBadRequest, errors.New("Policy details cannot be parsed as HCL")
+	changes, err := request.changes()
+	if err != nil {
+		return http.StatusBadRequest, err
 	}
+	for _, change := range changes {
+		// bundled changes name the policy at fault
+		prefix := "Policy"
+		if len(changes) > 1 {
+			prefix = "Policy " + change.Policy
+		}
 
-	// verify change is still... well, a change.
-	if policyCurrent == request.New {
-		return http.StatusBadRequest, errors.New("Policy details already match proposed change")
+		// verify that policy has not been changed since change was requested
+		if policyCurrent[change.Policy] != change.Current {
+			return http.StatusBadRequest, errors.New(prefix + " has been changed since request was made")
+		}
+
+		// verify new policy conforms to HCL formatting
+		if _, err := hcl.Parse(change.New); err != nil {
+			return http.StatusBadRequest, errors.New(prefix + " details cannot be parsed as HCL")
+		}
+
+		// verify change is still... well, a change.
+		if policyCurrent[change.Policy] == change.New {
+			return http.StatusBadRequest, errors.New(prefix + " details already match proposed change")
+		}
 	}
 
 	return http.StatusOK, nil
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Returns the user's saved ui preferences
+func GetPreferences() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		identity, err := auth.PreferenceIdentity()
+		if err != nil {
+			return parseError(c, err)
+		}
+		prefs, err := vault.GetPreferences(identity)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": prefs,
+		})
+	}
+}
+
+// Replaces the user's ui preferences with the JSON body
+func SetPreferences() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var prefs vault.Preferences
+		if err := c.Bind(&prefs); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid preferences format",
+			})
+		}
+		if err := prefs.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		identity, err := auth.PreferenceIdentity()
+		if err != nil {
+			return parseError(c, err)
+		}
+		if err := vault.SetPreferences(identity, prefs); err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": prefs,
+		})
+	}
+}
+
+// Resets the user's ui preferences to defaults
+func DeletePreferences() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		identity, err := auth.PreferenceIdentity()
+		if err != nil {
+			return parseError(c, err)
+		}
+		if err := vault.DeletePreferences(identity); err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Preferences reset",
+		})
+	}
+}
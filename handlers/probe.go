@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/labstack/echo"
+)
+
+// liveness: the process is up and serving. Needs no login, and never calls vault
+func Healthz() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, H{
+			"status": "ok",
+		})
+	}
+}
+
+// readiness: vault is reachable and unsealed, the server token is valid and the runtime
+// config is loaded. Responds 503 otherwise, so orchestrators hold traffic back
+func Readyz() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		readiness := vault.CheckReadiness()
+		status := http.StatusOK
+		if !readiness.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		return c.JSON(status, H{
+			"result": readiness,
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// headers a reverse proxy sets about the client. echo believes them when working out
+// c.RealIP() and c.Scheme(), so they must not be taken from just anyone
+var forwardedHeaders = []string{
+	echo.HeaderXForwardedFor,
+	echo.HeaderXRealIP,
+	echo.HeaderXForwardedProto,
+	echo.HeaderXForwardedProtocol,
+	echo.HeaderXForwardedSsl,
+	echo.HeaderXUrlScheme,
+	"X-Forwarded-Host",
+}
+
+// drops the X-Forwarded-* headers of requests that didn't come from a trusted proxy.
+// From a trusted proxy, X-Forwarded-For is reduced to the client it names, so c.RealIP()
+// is the address the nearest trusted proxy was connected to by
+func TrustProxies(trusted []*net.IPNet) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			if !trustedPeer(r.RemoteAddr, trusted) {
+				for _, header := range forwardedHeaders {
+					r.Header.Del(header)
+				}
+				return next(c)
+			}
+			if values := r.Header[echo.HeaderXForwardedFor]; len(values) > 0 {
+				r.Header.Set(echo.HeaderXForwardedFor, forwardedClient(strings.Join(values, ","), trusted))
+			}
+			return next(c)
+		}
+	}
+}
+
+// a peer that isn't an IP address is on the other end of a unix socket, i.e. a local proxy
+func trustedPeer(remoteAddr string, trusted []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return true
+	}
+	return inNetworks(ip, trusted)
+}
+
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// each proxy appends the address it was connected to by, so the client is the rightmost
+// address not added by a trusted proxy. Anything further left was sent by the client itself
+func forwardedClient(header string, trusted []*net.IPNet) string {
+	addresses := strings.Split(header, ",")
+	for i := len(addresses) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(addresses[i])
+		ip := net.ParseIP(address)
+		if ip == nil {
+			// not something a proxy of ours would have written
+			return address
+		}
+		if i == 0 || !inNetworks(ip, trusted) {
+			return address
+		}
+	}
+	return ""
+}
+
+// serves goldfish under a URL prefix, by removing it before routing.
+// Paths without the prefix are served as they are, e.g. probes and requests forwarded by replicas
+func BasePath(prefix string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if prefix == "" {
+				return next(c)
+			}
+			r := c.Request()
+			// the frontend's assets are relative to the page, so it must be loaded from prefix/
+			if r.URL.Path == prefix {
+				return c.Redirect(http.StatusMovedPermanently, prefix+"/")
+			}
+			if strings.HasPrefix(r.URL.Path, prefix+"/") {
+				r.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+				r.URL.RawPath = ""
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProxyHeaders(t *testing.T) {
+	Convey("Forwarded headers", t, func(c C) {
+		_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+		trusted := []*net.IPNet{proxies}
+
+		realIP := func(remoteAddr, forwardedFor string) string {
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, "/", nil)
+			req.RemoteAddr = remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+			ctx := e.NewContext(req, httptest.NewRecorder())
+			ip := ""
+			TrustProxies(trusted)(func(ctx echo.Context) error {
+				ip = ctx.RealIP()
+				return nil
+			})(ctx)
+			return ip
+		}
+
+		c.Convey("Should be ignored from untrusted peers", func(c C) {
+			c.So(realIP("192.0.2.1:1234", "198.51.100.7"), ShouldEqual, "192.0.2.1")
+		})
+
+		c.Convey("Should name the client from trusted proxies", func(c C) {
+			c.So(realIP("10.0.0.2:1234", "198.51.100.7"), ShouldEqual, "198.51.100.7")
+			c.So(realIP("10.0.0.2:1234", "203.0.113.9, 198.51.100.7, 10.0.0.3"), ShouldEqual, "198.51.100.7")
+			c.So(realIP("10.0.0.2:1234", "10.0.0.4, 10.0.0.3"), ShouldEqual, "10.0.0.4")
+		})
+
+		c.Convey("Should be believed over a unix socket", func(c C) {
+			c.So(realIP("@", "198.51.100.7"), ShouldEqual, "198.51.100.7")
+		})
+	})
+
+	Convey("A base path", t, func(c C) {
+		serve := func(path string) (int, string) {
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, path, nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			seen := ""
+			BasePath("/goldfish")(func(ctx echo.Context) error {
+				seen = ctx.Request().URL.Path
+				return nil
+			})(ctx)
+			return rec.Code, seen
+		}
+
+		c.Convey("Should be removed before routing", func(c C) {
+			_, path := serve("/goldfish/api/health")
+			c.So(path, ShouldEqual, "/api/health")
+			_, path = serve("/goldfish/")
+			c.So(path, ShouldEqual, "/")
+		})
+
+		c.Convey("Should redirect to the frontend", func(c C) {
+			code, _ := serve("/goldfish")
+			c.So(code, ShouldEqual, http.StatusMovedPermanently)
+		})
+
+		c.Convey("Should leave other paths alone", func(c C) {
+			_, path := serve("/healthz")
+			c.So(path, ShouldEqual, "/healthz")
+			_, path = serve("/goldfishes")
+			c.So(path, ShouldEqual, "/goldfishes")
+		})
+	})
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// the servers of the integrated storage cluster, and autopilot's view of their health
+func GetRaftStatus() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		peers, err := auth.GetRaftPeers()
+		if err != nil {
+			return inputError(c, err)
+		}
+		// autopilot is only in newer vaults, so the peers are shown without it
+		autopilot, err := auth.GetAutopilotState()
+		if err != nil {
+			log.Println("[ERROR]: Could not read autopilot state:", err.Error())
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+
+		return c.JSON(http.StatusOK, H{
+			"result": H{
+				"peers":     peers,
+				"autopilot": autopilot,
+			},
+		})
+	}
+}
+
+// streams a snapshot of the integrated storage cluster as a download
+func DownloadRaftSnapshot() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		snapshot, err := auth.RaftSnapshot()
+		if err != nil {
+			return parseError(c, err)
+		}
+		defer snapshot.Close()
+		log.Println("[AUDIT]:", name, "downloaded a raft snapshot")
+
+		c.Response().Header().Set("Content-Disposition",
+			`attachment; filename="vault-`+time.Now().UTC().Format("20060102-150405")+`.snap"`)
+		return c.Stream(http.StatusOK, "application/octet-stream", snapshot)
+	}
+}
+
+// restores the snapshot uploaded as form file 'file', replacing all of vault's data
+// form value 'confirm' must be "restore", and 'force' true restores another cluster's snapshot
+func RestoreRaftSnapshot() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		if c.FormValue("confirm") != "restore" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Type restore to confirm. All of vault's data will be replaced by the snapshot",
+			})
+		}
+		header, err := c.FormFile("file")
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "A snapshot file is required",
+			})
+		}
+		file, err := header.Open()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Could not read the snapshot",
+			})
+		}
+		defer file.Close()
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		force := c.FormValue("force") == "true"
+		if err := auth.RestoreRaftSnapshot(file, header.Size, force); err != nil {
+			return parseError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "restored raft snapshot", header.Filename, "force:", force)
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Snapshot restored",
+		})
+	}
+}
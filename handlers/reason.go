@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/labstack/echo"
+)
+
+const reasonKey = "reason"
+
+// reasons end up in audit logs and chat messages, so they are kept short
+const maxReasonLength = 500
+
+// checks the reason given for a destructive action, and keeps it for the audit log
+func requireReason(c echo.Context, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return errors.New("A reason is required for this action, and is recorded in the audit log")
+	}
+	if len(reason) > maxReasonLength {
+		return fmt.Errorf("The reason may be at most %d characters", maxReasonLength)
+	}
+	c.Set(reasonKey, reason)
+	return nil
+}
+
+// the reason given for the request's action, empty if it didn't need one
+func actionReasonOf(c echo.Context) string {
+	reason, _ := c.Get(reasonKey).(string)
+	return reason
+}
+
+// tells chat channels that a destructive action was taken, with the reason given for it
+func announceAction(c echo.Context, actor, action string) {
+	vault.NotifyDestructiveAction(action, actor, actionReasonOf(c))
+}
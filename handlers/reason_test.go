@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequireReason(t *testing.T) {
+	Convey("Reasons for destructive actions", t, func(c C) {
+		e := echo.New()
+		ctx := e.NewContext(httptest.NewRequest(echo.DELETE, "/api/policy", nil), httptest.NewRecorder())
+
+		c.Convey("Should be required, and not too long", func(c C) {
+			c.So(requireReason(ctx, "  "), ShouldNotBeNil)
+			c.So(requireReason(ctx, strings.Repeat("a", maxReasonLength+1)), ShouldNotBeNil)
+			c.So(actionReasonOf(ctx), ShouldBeEmpty)
+		})
+
+		c.Convey("Should be kept for the audit log", func(c C) {
+			c.So(requireReason(ctx, " rotating credentials "), ShouldBeNil)
+			c.So(actionReasonOf(ctx), ShouldEqual, "rotating credentials")
+		})
+	})
+}
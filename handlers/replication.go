@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// how long a secondary activation token can be unwrapped for, unless another ttl is given
+const defaultSecondaryTokenTTL = 30 * time.Minute
+
+// performance and dr replication status of the cluster the session works on
+func GetReplicationStatus() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		status, err := auth.GetReplicationStatus()
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+
+		return c.JSON(http.StatusOK, H{
+			"result": status,
+		})
+	}
+}
+
+// generates a wrapped activation token for the secondary named in form value 'id'
+// only sessions holding one of the ReplicationOperatorPolicies may do this
+func GenerateSecondaryToken() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		if operator, err := auth.IsReplicationOperator(); err != nil {
+			return parseError(c, err)
+		} else if !operator {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "A replication operator policy is required",
+			})
+		}
+
+		ttl := defaultSecondaryTokenTTL
+		if raw := c.FormValue("ttl"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "ttl must be a duration, e.g. 30m",
+				})
+			}
+			ttl = d
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		kind, id := c.Param("kind"), c.FormValue("id")
+		token, err := auth.GenerateSecondaryToken(kind, id, ttl)
+		if err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "generated a", kind, "replication activation token for secondary", id)
+
+		return c.JSON(http.StatusOK, H{
+			"result": token,
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// History follows the visibility of the request's policy, and remains readable
+// after the request has been applied or rejected
+
+// the audit trail must not block a decision, so failures to record it are only logged
+func recordPolicyEvent(hash, policy, event, actor, detail string) {
+	if err := vault.RecordRequestEvent(hash, policy, event, actor, detail); err != nil {
+		log.Println("[ERROR]: Could not record", event, "of policy request", hash+":", err.Error())
+	}
+}
+
+func GetRequestHistory() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		history, err := vault.GetRequestHistory(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if history == nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Change ID not found",
+			})
+		}
+		if _, err := auth.GetPolicy(history.Policy); err != nil {
+			return parseError(c, err)
+		}
+		// the requester's email address is only for notifying them, not for everyone who can see the policy
+		history.Contact = ""
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": history,
+		})
+	}
+}
+
+// Comments on an open policy request, optionally replying to another comment
+func AddRequestComment() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		hash := c.Param("id")
+		request, err := visiblePolicyRequest(auth, hash)
+		if err != nil {
+			return parseError(c, err)
+		} else if request == nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Change ID not found",
+			})
+		}
+
+		name, authorHash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		comment, err := vault.AddRequestComment(hash, request.Policy, c.FormValue("parent"),
+			name, authorHash, c.FormValue("body"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": comment,
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/labstack/echo"
+)
+
+// Returns the session's goldfish role, so the UI can hide what it may not reach
+func GetSessionRole() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		if !vault.RolesEnabled() {
+			return c.JSON(http.StatusOK, H{
+				"result": H{"enabled": false, "role": ""},
+			})
+		}
+		role, err := auth.GoldfishRole()
+		if err != nil {
+			return parseError(c, err)
+		}
+		return c.JSON(http.StatusOK, H{
+			"result": H{"enabled": true, "role": role},
+		})
+	}
+}
+
+// Rejects requests from sessions whose goldfish role doesn't allow the route,
+// once roles are configured. Requests without a session are left to the handlers
+func RoleGuard() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			required := vault.RequiredRole(c.Request().Method, c.Path())
+			if required == "" || !vault.RolesEnabled() {
+				return next(c)
+			}
+
+			var auth = &vault.AuthInfo{}
+			defer auth.Clear()
+			if err := getSession(c, auth); err != nil {
+				return next(c)
+			}
+			if err := auth.DecryptAuth(); err != nil {
+				return parseError(c, err)
+			}
+			role, err := auth.GoldfishRole()
+			if err != nil {
+				return parseError(c, err)
+			}
+			if !vault.RoleAllows(role, required) {
+				return c.JSON(http.StatusForbidden, H{
+					"error": "Goldfish " + required + " role required",
+				})
+			}
+			return next(c)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"encoding/json"
+	"log"
 	"net/http"
+	"strings"
 
 	"github.com/caiyeon/goldfish/vault"
 	"github.com/gorilla/csrf"
@@ -42,6 +45,27 @@ func GetSecrets() echo.HandlerFunc {
 				})
 			}
 		} else {
+			// two-person paths can only be read with a second person's approval
+			if vault.RequiresRevealApproval(path) {
+				if c.QueryParam("approval") == "" {
+					return c.JSON(http.StatusForbidden, H{
+						"error":             "Reading this path requires a second person's approval",
+						"approval_required": true,
+					})
+				}
+				name, hash, err := sessionIdentity(auth)
+				if err != nil {
+					return parseError(c, err)
+				}
+				approval, err := vault.ConsumeRevealApproval(c.QueryParam("approval"), path, hash)
+				if err != nil {
+					return c.JSON(http.StatusForbidden, H{
+						"error": err.Error(),
+					})
+				}
+				log.Println("[AUDIT]:", name, "read", path, "approved by", approval.Approver, "approval", approval.ID)
+			}
+
 			// reading a specific secret's key value pairs
 			if result, err := auth.ReadSecret(path); err != nil {
 				return parseError(c, err)
@@ -85,11 +109,58 @@ func PostSecrets() echo.HandlerFunc {
 			})
 		}
 
+		// changes to these paths need others' approval, see AddSecretRequest
+		if vault.RequiresSecretRequest(path) {
+			return c.JSON(http.StatusForbidden, H{
+				"error":            "Changing this path requires a request approved by others",
+				"request_required": true,
+			})
+		}
+
+		// any JSON object is accepted, including nested values
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &data); err != nil || data == nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Body must be a JSON object",
+			})
+		}
+
+		// if operators configured a schema for this path, the secret must conform to it
+		if s := vault.SecretSchema(path); s != nil {
+			if errs := s.Validate(data); errs != nil {
+				return c.JSON(http.StatusBadRequest, H{
+					"error":  "Secret does not conform to the schema for this path",
+					"schema": errs,
+				})
+			}
+		}
+
 		resp, err := auth.WriteSecret(path, body)
 		if err != nil {
 			return parseError(c, err)
 		}
 
+		// new bulletins are announced in chat channels subscribed to them
+		if bulletins := vault.GetConfig().BulletinPath; bulletins != "" && strings.HasPrefix(path, bulletins) {
+			title, _ := data["title"].(string)
+			message, _ := data["message"].(string)
+			author, _, _ := sessionIdentity(auth)
+			vault.NotifyBulletin(title, message, author)
+		}
+
+		// with a wrap_ttl, the secret is also handed back as a one-time wrapping token
+		// so it can be delivered to someone that can't read the path
+		if wrapttl := c.FormValue("wrap_ttl"); wrapttl != "" {
+			wrappingToken, err := auth.WrapData(wrapttl, body)
+			if err != nil {
+				return parseError(c, err)
+			}
+			return respondArtifact(c, H{
+				"result":         resp,
+				"wrapping_token": wrappingToken,
+			}, "Wrapping token: "+wrappingToken+"\nValid for: "+wrapttl+"\n")
+		}
+
 		return c.JSON(http.StatusOK, H{
 			"result": resp,
 		})
@@ -111,7 +182,15 @@ func DeleteSecrets() echo.HandlerFunc {
 			return parseError(c, err)
 		}
 
-		_, err := auth.DeleteSecret(c.QueryParam("path"))
+		path := c.QueryParam("path")
+		if vault.RequiresSecretRequest(path) {
+			return c.JSON(http.StatusForbidden, H{
+				"error":            "Changing this path requires a request approved by others",
+				"request_required": true,
+			})
+		}
+
+		_, err := auth.DeleteSecret(path)
 		if err != nil {
 			return parseError(c, err)
 		}
@@ -121,3 +200,250 @@ func DeleteSecrets() echo.HandlerFunc {
 		})
 	}
 }
+
+func CopySecrets() echo.HandlerFunc {
+	return transferSecrets(false)
+}
+
+func MoveSecrets() echo.HandlerFunc {
+	return transferSecrets(true)
+}
+
+// copies (or moves) a secret, or every secret under a prefix
+// prefix operations must be confirmed, otherwise the affected paths are returned as a preview
+func transferSecrets(move bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		source := c.FormValue("source")
+		destination := c.FormValue("destination")
+		if source == "" || destination == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Source and destination must not be empty",
+			})
+		}
+		if source == destination {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Source and destination must differ",
+			})
+		}
+		if vault.TouchesRevealApproval(source) {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Source contains paths that require approval to read",
+			})
+		}
+		if vault.TouchesSecretRequest(destination) || (move && vault.TouchesSecretRequest(source)) {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Paths that can only be changed through a request are affected",
+			})
+		}
+
+		// single secret
+		if !strings.HasSuffix(source, "/") {
+			if strings.HasSuffix(destination, "/") {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "Destination must not end in '/'",
+				})
+			}
+			transfer := auth.CopySecret
+			if move {
+				transfer = auth.MoveSecret
+			}
+			if err := transfer(source, destination); err != nil {
+				return inputError(c, err)
+			}
+			return c.JSON(http.StatusOK, H{
+				"result": []string{source},
+			})
+		}
+
+		// whole prefix
+		if !strings.HasSuffix(destination, "/") {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Destination must end in '/' when source is a prefix",
+			})
+		}
+		if strings.HasPrefix(destination, source) {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Destination must not be inside source",
+			})
+		}
+		if c.FormValue("confirm") != "true" {
+			budget, err := requestTimeBudget(c)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": err.Error(),
+				})
+			}
+			// the preview may be cut short by its budget, and continued after its last key
+			keys, after, err := auth.ListSecretRecursiveWithin(source, c.QueryParam("continuation"), budget)
+			if err != nil {
+				return parseError(c, err)
+			}
+			body := H{
+				"preview":   keys,
+				"truncated": after != "",
+				"confirm":   "Resubmit with confirm=true to proceed",
+			}
+			if after != "" {
+				body["continuation"] = after
+			}
+			return c.JSON(http.StatusOK, body)
+		}
+
+		transfer := auth.CopyPrefix
+		if move {
+			transfer = auth.MovePrefix
+		}
+		transferred, err := transfer(source, destination)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, H{
+				"error":  "Transfer interrupted: " + err.Error(),
+				"result": transferred,
+			})
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": transferred,
+		})
+	}
+}
+
+// Exports a subtree of secrets as an encrypted archive
+// The archive is encrypted with either a transit key or a user-supplied passphrase
+func ExportSecrets() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		path := c.FormValue("path")
+		if path == "" || !strings.HasSuffix(path, "/") {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Path must end in '/'",
+			})
+		}
+
+		if vault.TouchesRevealApproval(path) {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Path contains secrets that require approval to read",
+			})
+		}
+
+		archive, err := auth.ExportSecrets(path)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		var sealed *vault.SealedArchive
+		switch c.FormValue("encryption") {
+		case "transit":
+			sealed, err = auth.SealArchiveTransit(archive, c.FormValue("key"))
+			if err != nil {
+				return parseError(c, err)
+			}
+
+		case "passphrase":
+			sealed, err = vault.SealArchivePassphrase(archive, c.FormValue("passphrase"))
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": err.Error(),
+				})
+			}
+
+		default:
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Encryption must be either transit or passphrase",
+			})
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": sealed,
+			"count":  len(archive.Secrets),
+		})
+	}
+}
+
+// Restores an encrypted archive produced by ExportSecrets
+// Secrets are written under the original path, unless another path is given
+func ImportSecrets() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var sealed vault.SealedArchive
+		if err := json.Unmarshal([]byte(c.FormValue("archive")), &sealed); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid archive format",
+			})
+		}
+
+		archive, err := auth.OpenArchive(&sealed, c.FormValue("passphrase"))
+		if err != nil {
+			if sealed.Encryption == "transit" {
+				return parseError(c, err)
+			}
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		path := c.FormValue("path")
+		if path == "" {
+			path = archive.Path
+		}
+		if !strings.HasSuffix(path, "/") {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Path must end in '/'",
+			})
+		}
+
+		if vault.TouchesSecretRequest(path) {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Path contains secrets that can only be changed through a request",
+			})
+		}
+
+		written, err := auth.ImportSecrets(path, archive)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, H{
+				"error":  "Import interrupted: " + err.Error(),
+				"result": written,
+			})
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": written,
+		})
+	}
+}
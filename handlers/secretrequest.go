@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Secret requests follow the visibility of their path: those that can read the
+// path can see, approve and reject requests to change it
+
+// the request as shown to users. The encrypted data never leaves goldfish
+func secretRequestView(request vault.SecretRequest) vault.SecretRequest {
+	request.Data = ""
+	return request
+}
+
+func GetSecretRequests() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		requests, err := vault.ListSecretRequests()
+		if err != nil {
+			return logError(c, err.Error(), "Could not read secret requests")
+		}
+		visible := []vault.SecretRequest{}
+		for _, request := range requests {
+			// requests on other clusters are listed from sessions on them
+			if request.Cluster != auth.Cluster {
+				continue
+			}
+			if ok, err := canRead(auth, request.Path); err != nil {
+				return parseError(c, err)
+			} else if ok {
+				visible = append(visible, secretRequestView(request))
+			}
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": visible,
+		})
+	}
+}
+
+// Submits a write or delete on a path that requires approvals
+func AddSecretRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		path := c.FormValue("path")
+		if !vault.RequiresSecretRequest(path) {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Path does not require a request",
+			})
+		}
+		if ok, err := canRead(auth, path); err != nil {
+			return parseError(c, err)
+		} else if !ok {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You cannot read this path",
+			})
+		}
+
+		var data map[string]interface{}
+		operation := c.FormValue("operation")
+		if operation != vault.SecretRequestWrite && operation != vault.SecretRequestDelete {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Operation must be write or delete",
+			})
+		}
+		if ok, err := canChange(auth, path, operation); err != nil {
+			return parseError(c, err)
+		} else if !ok {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You cannot " + operation + " this path",
+			})
+		}
+		if operation == vault.SecretRequestWrite {
+			if err := json.Unmarshal([]byte(c.FormValue("body")), &data); err != nil || data == nil {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "Body must be a JSON object",
+				})
+			}
+			// the schema is checked now, so approvers never approve a change that can't be made
+			if s := vault.SecretSchema(path); s != nil {
+				if errs := s.Validate(data); errs != nil {
+					return c.JSON(http.StatusBadRequest, H{
+						"error":  "Secret does not conform to the schema for this path",
+						"schema": errs,
+					})
+				}
+			}
+		}
+
+		name, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		request, err := vault.CreateSecretRequest(auth.Cluster, path, operation, data, name, hash)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		log.Println("[AUDIT]:", name, "requested to", operation, path, "request", request.ID)
+		return c.JSON(http.StatusOK, H{
+			"result": secretRequestView(*request),
+		})
+	}
+}
+
+// Shows a secret request and the data it proposes, so others can decide on it
+func GetSecretRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		request, err := vault.GetSecretRequest(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if err := sameCluster(auth, request.Cluster); err != nil {
+			return inputError(c, err)
+		}
+		if ok, err := canRead(auth, request.Path); err != nil {
+			return parseError(c, err)
+		} else if !ok {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You cannot read the path of this request",
+			})
+		}
+
+		// proposed values on two-person paths are not shown, as they could be read without approval
+		result := H{
+			"result": secretRequestView(*request),
+		}
+		if !vault.RequiresRevealApproval(request.Path) {
+			data, err := request.ProposedData()
+			if err != nil {
+				return logError(c, err.Error(), "Could not decrypt proposed data")
+			}
+			result["data"] = data
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+// Approves a secret request. The last required approval makes the change
+func ApproveSecretRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		request, err := vault.GetSecretRequest(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if err := sameCluster(auth, request.Cluster); err != nil {
+			return inputError(c, err)
+		}
+		if ok, err := canRead(auth, request.Path); err != nil {
+			return parseError(c, err)
+		} else if !ok {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You cannot read the path of this request",
+			})
+		}
+		if ok, err := canChange(auth, request.Path, request.Operation); err != nil {
+			return parseError(c, err)
+		} else if !ok {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You cannot " + request.Operation + " the path of this request",
+			})
+		}
+
+		name, hash, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		request, applied, err := vault.ApproveSecretRequest(request.ID, name, hash)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		log.Println("[AUDIT]:", name, "approved", request.Requester, "to", request.Operation, request.Path, "request", request.ID)
+		if applied {
+			log.Println("[AUDIT]:", request.Operation, request.Path, "applied, requested by", request.Requester,
+				"and approved by", request.Approvers, "request", request.ID)
+		}
+		return c.JSON(http.StatusOK, H{
+			"result":   secretRequestView(*request),
+			"applied":  applied,
+			"progress": len(request.Approvers),
+			"required": request.Required,
+		})
+	}
+}
+
+// Anyone that is able to read the path is able to reject requests for it
+func DeleteSecretRequest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		request, err := vault.GetSecretRequest(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if err := sameCluster(auth, request.Cluster); err != nil {
+			return inputError(c, err)
+		}
+		if ok, err := canRead(auth, request.Path); err != nil {
+			return parseError(c, err)
+		} else if !ok {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "You cannot read the path of this request",
+			})
+		}
+
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+		if err := vault.DeleteSecretRequest(request.ID); err != nil {
+			return parseError(c, err)
+		}
+
+		log.Println("[AUDIT]:", name, "rejected", request.Requester, "to", request.Operation, request.Path, "request", request.ID)
+		return c.JSON(http.StatusOK, H{
+			"result": "Request deleted",
+		})
+	}
+}
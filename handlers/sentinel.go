@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// lists the sentinel policies of a type, or reads one if a name is given
+func GetSentinelPolicies() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var result interface{}
+		var err error
+		if name := c.Param("name"); name != "" {
+			result, err = auth.GetSentinelPolicy(c.Param("type"), name)
+		} else {
+			result, err = auth.ListSentinelPolicies(c.Param("type"))
+		}
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+func PutSentinelPolicy() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		policy := vault.SentinelPolicy{
+			Name:             c.Param("name"),
+			Type:             c.Param("type"),
+			Policy:           c.FormValue("policy"),
+			EnforcementLevel: c.FormValue("enforcement_level"),
+		}
+		for _, path := range strings.Split(c.FormValue("paths"), ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				policy.Paths = append(policy.Paths, path)
+			}
+		}
+		if err := auth.PutSentinelPolicy(policy); err != nil {
+			return inputError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Sentinel policy written",
+		})
+	}
+}
+
+func DeleteSentinelPolicy() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.DeleteSentinelPolicy(c.Param("type"), c.Param("name")); err != nil {
+			return inputError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Sentinel policy deleted",
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// vault's seal status, including unseal progress. Needs no login, as logging in needs vault unsealed
+func GetSealStatus() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		status, err := vault.SealStatus()
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+
+		return c.JSON(http.StatusOK, H{
+			"result": status,
+		})
+	}
+}
+
+// submits the unseal key share in form value 'key', or discards the progress if 'reset' is true
+// like vault's own unseal endpoint, submitting a share needs no login. Discarding the progress
+// needs a goldfish session, so that anyone who can reach goldfish can't keep undoing an unseal.
+// The session can't be decrypted while vault is sealed, so only its cookie is checked
+func Unseal() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.FormValue("reset") == "true" {
+			var auth = &vault.AuthInfo{}
+			defer auth.Clear()
+
+			// fetch auth from cookie
+			if err := getSession(c, auth); err != nil {
+				return c.JSON(http.StatusForbidden, H{
+					"error": "Please login first",
+				})
+			}
+
+			status, err := vault.ResetUnseal()
+			if err != nil {
+				return parseError(c, err)
+			}
+			log.Println("[AUDIT]:", c.RealIP(), "reset unseal progress")
+			return c.JSON(http.StatusOK, H{
+				"result": status,
+			})
+		}
+
+		status, err := vault.Unseal(c.FormValue("key"))
+		if err != nil {
+			return inputError(c, err)
+		}
+		log.Println("[AUDIT]:", c.RealIP(), "submitted an unseal key share, progress",
+			status.Progress, "of", status.T, "sealed:", status.Sealed)
+
+		return c.JSON(http.StatusOK, H{
+			"result": status,
+		})
+	}
+}
+
+func GetKeyStatus() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		status, err := auth.KeyStatus()
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+
+		return c.JSON(http.StatusOK, H{
+			"result": status,
+		})
+	}
+}
+
+// rotates the barrier encryption key, if the session's policies allow it
+func RotateKey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		status, err := auth.RotateKey()
+		if err != nil {
+			return parseError(c, err)
+		}
+		log.Println("[AUDIT]:", name, "rotated the barrier key to term", status.Term)
+
+		return c.JSON(http.StatusOK, H{
+			"result": status,
+		})
+	}
+}
+
+// seal, HA, replication and version status of the cluster in one call
+// like /api/health, this needs no login, so it can be shown while vault is sealed
+func GetClusterStatus() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		budget, err := requestTimeBudget(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		// a truncated status has no continuation, it is gathered again from the start
+		status, complete, err := vault.GetClusterStatusWithin(budget)
+		if err != nil {
+			return parseError(c, err)
+		}
+		return c.JSON(http.StatusOK, H{
+			"result":    status,
+			"truncated": !complete,
+		})
+	}
+}
+
+// the vault enterprise license's expiry and features, flagged if it expires soon
+func GetLicense() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		license, err := auth.GetLicense()
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+
+		return c.JSON(http.StatusOK, H{
+			"result": license,
+		})
+	}
+}
+
+// vault's telemetry, as json or, with ?format=prometheus, as prometheus text
+func GetVaultMetrics() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		result, err := auth.GetVaultMetrics(c.QueryParam("format"))
+		if err != nil {
+			return inputError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+
+		if result.Format == "prometheus" {
+			return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", result.Body)
+		}
+		return c.JSON(http.StatusOK, H{
+			"result": json.RawMessage(result.Body),
+		})
+	}
+}
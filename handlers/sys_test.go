@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnsealReset(t *testing.T) {
+	Convey("Resetting unseal progress should need a session", t, func(c C) {
+		e := echo.New()
+		form := url.Values{"reset": {"true"}}
+		req := httptest.NewRequest(echo.POST, "/api/sys/unseal", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+
+		c.So(Unseal()(e.NewContext(req, rec)), ShouldBeNil)
+		c.So(rec.Code, ShouldEqual, http.StatusForbidden)
+	})
+}
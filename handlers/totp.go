@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/gorilla/csrf"
+	"github.com/labstack/echo"
+)
+
+// Lists keys, or reads one if a name is given
+func GetTOTPKeys() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		var result interface{}
+		var err error
+		if name := c.QueryParam("name"); name == "" {
+			result, err = auth.ListTOTPKeys(c.QueryParam("mount"))
+		} else {
+			result, err = auth.ReadTOTPKey(c.QueryParam("mount"), name)
+		}
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// Creates a key. Without a url or key to import, vault generates one and the
+// provisioning url and barcode are returned, which is the only time they are shown
+func CreateTOTPKey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		params := map[string]interface{}{}
+		for _, key := range []string{"url", "key", "issuer", "account_name", "period", "algorithm", "digits", "skew", "qr_size"} {
+			if value := c.FormValue(key); value != "" {
+				params[key] = value
+			}
+		}
+		_, hasURL := params["url"]
+		_, hasKey := params["key"]
+		if !hasURL && !hasKey {
+			if params["issuer"] == nil || params["account_name"] == nil {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "issuer and account_name are required to generate a key",
+				})
+			}
+			params["generate"] = true
+		}
+
+		result, err := auth.CreateTOTPKey(c.QueryParam("mount"), c.Param("name"), params)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		if url, ok := result["url"].(string); ok {
+			return respondArtifact(c, H{"result": result}, url+"\n")
+		}
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+func DeleteTOTPKey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		if err := auth.DeleteTOTPKey(c.QueryParam("mount"), c.Param("name")); err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Key deleted",
+		})
+	}
+}
+
+// Returns the current code of a key
+func GenerateTOTPCode() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		code, err := auth.GenerateTOTPCode(c.QueryParam("mount"), c.Param("name"))
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
+		return respondArtifact(c, H{"result": code}, code+"\n")
+	}
+}
+
+// Checks a code against a key
+func ValidateTOTPCode() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		code := c.FormValue("code")
+		if code == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "code must not be empty",
+			})
+		}
+
+		valid, err := auth.ValidateTOTPCode(c.QueryParam("mount"), c.Param("name"), code)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": valid,
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/caiyeon/goldfish/tracing"
+	"github.com/labstack/echo"
+)
+
+// where the request's span is kept in the echo context
+const spanKey = "span"
+
+// traces each request as a span, continuing the trace of a traceparent header if there is one
+// vault requests made for the session are traced within it, see vault.AuthInfo.SetSpan
+func Tracing() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !tracing.Enabled() {
+				return next(c)
+			}
+			req := c.Request()
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			span := tracing.StartFromHeader(req.Header.Get("Traceparent"), req.Method+" "+route, tracing.KindServer)
+			defer span.Finish()
+			span.SetAttribute("http.method", req.Method)
+			span.SetAttribute("http.route", route)
+			span.SetAttribute("http.target", req.URL.Path)
+			span.SetAttribute("http.request_id", requestID(c))
+			c.Set(spanKey, span)
+
+			err := next(c)
+			status := c.Response().Status
+			if err != nil {
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				} else {
+					status = http.StatusInternalServerError
+				}
+			}
+			span.SetAttribute("http.status_code", status)
+			if status >= http.StatusInternalServerError {
+				span.SetError(http.StatusText(status))
+			}
+			return err
+		}
+	}
+}
+
+// the span Tracing started for the request, nil if tracing is off
+func requestSpan(c echo.Context) *tracing.Span {
+	span, _ := c.Get(spanKey).(*tracing.Span)
+	return span
+}
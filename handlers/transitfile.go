@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/labstack/echo"
+)
+
+// reads the uploaded 'file', refusing anything larger than vault.TransitFileMaxSize
+func uploadedFile(c echo.Context) (string, []byte, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return "", nil, errors.New("A file must be uploaded")
+	}
+	if header.Size > vault.TransitFileMaxSize {
+		return "", nil, fmt.Errorf("Files may be at most %d bytes", vault.TransitFileMaxSize)
+	}
+	file, err := header.Open()
+	if err != nil {
+		return "", nil, errors.New("Could not read uploaded file")
+	}
+	defer file.Close()
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return "", nil, errors.New("Could not read uploaded file")
+	}
+	return filepath.Base(filepath.Clean("/" + header.Filename)), content, nil
+}
+
+// sends content as a file download
+func downloadFile(c echo.Context, name string, content []byte) error {
+	c.Response().Header().Set("Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	return c.Blob(http.StatusOK, echo.MIMEOctetStream, content)
+}
+
+// Encrypts an uploaded file with a data key from a transit key
+func EncryptFile() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		name, content, err := uploadedFile(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		sealed, err := auth.EncryptFile(c.FormValue("key"), name, content)
+		if err != nil {
+			return parseError(c, err)
+		}
+		return downloadFile(c, name+".goldfish", sealed)
+	}
+}
+
+// Decrypts a file produced by EncryptFile, restoring its original name
+func DecryptFile() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		uploaded, sealed, err := uploadedFile(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		name, content, err := auth.DecryptFile(sealed)
+		if err != nil {
+			if strings.Contains(err.Error(), "Code:") {
+				return parseError(c, err)
+			}
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if name == "" {
+			name = strings.TrimSuffix(uploaded, ".goldfish")
+		}
+		return downloadFile(c, filepath.Base(filepath.Clean("/"+name)), content)
+	}
+}
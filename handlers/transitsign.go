@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/labstack/echo"
+)
+
+// reads the data to sign or hmac, given as text in 'input' or as binary in 'input_base64'
+func transitInput(c echo.Context) ([]byte, error) {
+	if raw := c.FormValue("input_base64"); raw != "" {
+		input, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, errors.New("input_base64 is not valid base64")
+		}
+		return input, nil
+	}
+	if input := c.FormValue("input"); input != "" {
+		return []byte(input), nil
+	}
+	return nil, errors.New("Input must not be empty")
+}
+
+// Signs input with an asymmetric transit key, optionally with a hash algorithm and key version
+func SignTransit() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		input, err := transitInput(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		signature, err := auth.SignTransit(c.Param("key"), c.FormValue("algorithm"), input,
+			formParams(c, "key_version", "prehashed", "signature_algorithm"))
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": signature,
+		})
+	}
+}
+
+// Checks a signature of input
+func VerifyTransitSignature() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		input, err := transitInput(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		signature := c.FormValue("signature")
+		if signature == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Signature must not be empty",
+			})
+		}
+
+		valid, err := auth.VerifyTransitSignature(c.Param("key"), c.FormValue("algorithm"), input, signature)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": valid,
+		})
+	}
+}
+
+// Computes an hmac of input, optionally with a hash algorithm and key version
+func HMACTransit() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		input, err := transitInput(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+
+		hmac, err := auth.HMACTransit(c.Param("key"), c.FormValue("algorithm"), input,
+			formParams(c, "key_version"))
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": hmac,
+		})
+	}
+}
+
+// Checks an hmac of input
+func VerifyTransitHMAC() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		input, err := transitInput(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		hmac := c.FormValue("hmac")
+		if hmac == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Hmac must not be empty",
+			})
+		}
+
+		valid, err := auth.VerifyTransitHMAC(c.Param("key"), c.FormValue("algorithm"), input, hmac)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": valid,
+		})
+	}
+}
+
+// Generates a data key from a transit key. With type 'wrapped', only its ciphertext is returned
+func GenerateTransitDataKey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		keyType := c.FormValue("type")
+		if keyType == "" {
+			keyType = "plaintext"
+		}
+		if keyType != "plaintext" && keyType != "wrapped" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Type must be either plaintext or wrapped",
+			})
+		}
+
+		result, err := auth.GenerateTransitDataKey(c.FormValue("key"), keyType,
+			formParams(c, "bits", "context", "nonce"))
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/caiyeon/goldfish/vault"
 	"github.com/gorilla/csrf"
@@ -25,11 +27,13 @@ func GetUsers() echo.HandlerFunc {
 			return parseError(c, err)
 		}
 
-		var offset int
-		var err error
-		if c.QueryParam("offset") == "" {
-			offset = 0
-		} else {
+		budget, offset, err := requestBudget(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
+		if c.QueryParam("offset") != "" {
 			offset, err = strconv.Atoi(c.QueryParam("offset"))
 			if err != nil {
 				return c.JSON(http.StatusBadRequest, H{
@@ -38,17 +42,15 @@ func GetUsers() echo.HandlerFunc {
 			}
 		}
 
-		// fetch results
-		result, err := auth.ListUsers(c.QueryParam("type"), offset)
+		// fetch results, possibly partial if budget runs out
+		result, next, err := auth.ListUsersWithin(c.QueryParam("type"), offset, budget)
 		if err != nil {
 			return parseError(c, err)
 		}
 
 		c.Response().Writer.Header().Set("X-CSRF-Token", csrf.Token(c.Request()))
 
-		return c.JSON(http.StatusOK, H{
-			"result": result,
-		})
+		return c.JSON(http.StatusOK, partialResult(result, next))
 	}
 }
 
@@ -87,7 +89,11 @@ func DeleteUser() echo.HandlerFunc {
 		defer auth.Clear()
 
 		// verify form data
-		var deleteTarget = &vault.AuthInfo{}
+		var deleteTarget = &struct {
+			Type   string `json:"Type" form:"Type" query:"Type"`
+			ID     string `json:"ID" form:"ID" query:"ID"`
+			Reason string `json:"reason" form:"reason" query:"reason"`
+		}{}
 		if err := c.Bind(deleteTarget); err != nil {
 			return c.JSON(http.StatusBadRequest, H{
 				"error": "Invalid format for deletion target",
@@ -98,6 +104,11 @@ func DeleteUser() echo.HandlerFunc {
 				"error": "Deletion target cannot be empty",
 			})
 		}
+		if err := requireReason(c, deleteTarget.Reason); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": err.Error(),
+			})
+		}
 
 		// fetch auth from cookie
 		if err := getSession(c, auth); err != nil {
@@ -109,10 +120,21 @@ func DeleteUser() echo.HandlerFunc {
 			return parseError(c, err)
 		}
 
+		// user deletions may need approver groups' approval, see AddIdentityRequest
+		if vault.RequiresIdentityRequest(vault.IdentityDeleteUser) {
+			return identityRequestRequired(c)
+		}
+
+		name, _, err := sessionIdentity(auth)
+		if err != nil {
+			return parseError(c, err)
+		}
+
 		// delete user
 		if err := auth.DeleteUser(deleteTarget.Type, deleteTarget.ID); err != nil {
 			return parseError(c, err)
 		}
+		announceAction(c, name, "deleted "+deleteTarget.Type+" "+deleteTarget.ID)
 
 		return c.JSON(http.StatusOK, H{
 			"result": "User deleted successfully",
@@ -135,6 +157,12 @@ func CreateUser() echo.HandlerFunc {
 			return parseError(c, err)
 		}
 
+		// if set, the response is wrapped and only the wrapping token is returned
+		wrapttl := c.QueryParam("wrap_ttl")
+		if wrapttl == "" {
+			wrapttl = c.QueryParam("wrap-ttl")
+		}
+
 		var resp *api.Secret
 		switch c.QueryParam("type") {
 		case "":
@@ -143,6 +171,10 @@ func CreateUser() echo.HandlerFunc {
 			})
 
 		case "token":
+			// token and secret id creation may need approver groups' approval, see AddIdentityRequest
+			if vault.RequiresIdentityRequest(vault.IdentityCreateToken) {
+				return identityRequestRequired(c)
+			}
 			var request = &api.TokenCreateRequest{}
 			err := c.Bind(request)
 			if err != nil {
@@ -151,7 +183,18 @@ func CreateUser() echo.HandlerFunc {
 				})
 			}
 
-			resp, err = auth.CreateToken(request, c.QueryParam("wrap-ttl"))
+			resp, err = auth.CreateToken(request, wrapttl)
+			if err != nil {
+				return parseError(c, err)
+			}
+
+		case "secret_id":
+			if vault.RequiresIdentityRequest(vault.IdentityCreateSecretID) {
+				return identityRequestRequired(c)
+			}
+			var err error
+			resp, err = auth.GenerateSecretID(c.QueryParam("role"),
+				formParams(c, "metadata", "cidr_list"), wrapttl)
 			if err != nil {
 				return parseError(c, err)
 			}
@@ -240,3 +283,137 @@ func GetRole() echo.HandlerFunc {
 		})
 	}
 }
+
+// Creates or updates an approle (type=approle) or token role (type=token)
+// the request body holds the role's parameters, as vault expects them
+func WriteRole() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		backend := c.QueryParam("type")
+		operation := vault.IdentityWriteAppRole
+		if backend == "token" {
+			operation = vault.IdentityWriteTokenRole
+		}
+		// role changes may need approver groups' approval, see AddIdentityRequest
+		if vault.RequiresIdentityRequest(operation) {
+			return identityRequestRequired(c)
+		}
+
+		params := map[string]interface{}{}
+		if err := c.Bind(&params); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Invalid role format",
+			})
+		}
+		if err := auth.WriteRole(backend, c.QueryParam("rolename"), params); err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": "Role written successfully",
+		})
+	}
+}
+
+const (
+	cliTokenDefaultTTL  = 5 * time.Minute
+	cliTokenMaxTTL      = 15 * time.Minute
+	cliTokenDefaultUses = 10
+	cliTokenMaxUses     = 100
+)
+
+// Mints a narrowly-scoped child token from the session, and returns shell-ready exports
+// so the user can continue in the vault CLI without copying their own session token
+func ExchangeToken() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		ttl := cliTokenDefaultTTL
+		if raw := c.FormValue("ttl"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 || d > cliTokenMaxTTL {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "ttl must be a duration up to " + cliTokenMaxTTL.String(),
+				})
+			}
+			ttl = d
+		}
+
+		uses := cliTokenDefaultUses
+		if raw := c.FormValue("num_uses"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > cliTokenMaxUses {
+				return c.JSON(http.StatusBadRequest, H{
+					"error": "num_uses must be between 1 and " + strconv.Itoa(cliTokenMaxUses),
+				})
+			}
+			uses = n
+		}
+
+		// the policies must be listed, so the token never silently gets all of the session's
+		policies := []string{}
+		for _, p := range strings.Split(c.FormValue("policies"), ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				policies = append(policies, p)
+			}
+		}
+
+		resp, err := auth.CreateCLIToken(ttl.String(), uses, policies)
+		if err != nil {
+			return inputError(c, err)
+		}
+		if resp.Auth == nil {
+			return c.JSON(http.StatusInternalServerError, H{
+				"error": "Unable to parse vault response",
+			})
+		}
+
+		exports := "export VAULT_ADDR=" + shellQuote(auth.ClusterAddress()) + "\n" +
+			"export VAULT_TOKEN=" + shellQuote(resp.Auth.ClientToken) + "\n"
+
+		return respondArtifact(c, H{
+			"result": H{
+				"accessor": resp.Auth.Accessor,
+				"policies": resp.Auth.Policies,
+				"ttl":      resp.Auth.LeaseDuration,
+				"num_uses": uses,
+				"exports":  exports,
+				"exports_powershell": "$env:VAULT_ADDR = " + powershellQuote(auth.ClusterAddress()) + "\n" +
+					"$env:VAULT_TOKEN = " + powershellQuote(resp.Auth.ClientToken) + "\n",
+			},
+		}, exports)
+	}
+}
+
+// single-quotes a string for posix shells
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// single-quotes a string for powershell
+func powershellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/caiyeon/goldfish/vault"
 	"github.com/labstack/echo"
@@ -37,9 +38,9 @@ func WrapHandler() echo.HandlerFunc {
 			return parseError(c, err)
 		}
 
-		return c.JSON(http.StatusOK, H{
+		return respondArtifact(c, H{
 			"result": wrappingToken,
-		})
+		}, "Wrapping token: "+wrappingToken+"\nValid for: "+wrapttl+"\n")
 	}
 }
 
@@ -76,3 +77,71 @@ func UnwrapHandler() echo.HandlerFunc {
 		})
 	}
 }
+
+// Shows how old a wrapping token is and what created it, without consuming it
+func LookupWrappingToken() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		wrappingToken := c.FormValue("wrappingToken")
+		if wrappingToken == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Wrapping token cannot be empty",
+			})
+		}
+
+		result, err := auth.LookupWrappingToken(wrappingToken)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, H{
+			"result": result,
+		})
+	}
+}
+
+// Replaces a wrapping token with a new one. The old token stops working
+func RewrapHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var auth = &vault.AuthInfo{}
+		defer auth.Clear()
+
+		// fetch auth from cookie
+		if err := getSession(c, auth); err != nil {
+			return c.JSON(http.StatusForbidden, H{
+				"error": "Please login first",
+			})
+		}
+		if err := auth.DecryptAuth(); err != nil {
+			return parseError(c, err)
+		}
+
+		wrappingToken := c.FormValue("wrappingToken")
+		if wrappingToken == "" {
+			return c.JSON(http.StatusBadRequest, H{
+				"error": "Wrapping token cannot be empty",
+			})
+		}
+
+		wrapInfo, err := auth.RewrapData(wrappingToken)
+		if err != nil {
+			return parseError(c, err)
+		}
+
+		return respondArtifact(c, H{
+			"result": wrapInfo,
+		}, "Wrapping token: "+wrapInfo.Token+"\nValid for: "+strconv.Itoa(wrapInfo.TTL)+"s\n")
+	}
+}
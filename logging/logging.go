@@ -0,0 +1,171 @@
+// Package logging formats goldfish's log output, as text or as JSON lines for log shippers.
+// Goldfish logs through the standard log package, with the level as a prefix such as [ERROR]:,
+// so lines are parsed here rather than every call site changing
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// levels in increasing severity
+var levels = []string{"debug", "info", "warn", "error"}
+
+// prefixes that goldfish's log lines start with, by the level or type they mark
+var prefixLevels = map[string]string{
+	"DEBUG": "debug",
+	"INFO":  "info",
+	"WARN":  "warn",
+	"ERR":   "error",
+	"ERROR": "error",
+}
+
+// audit and incident lines are security records, so they are never filtered out
+var prefixTypes = map[string]string{
+	"AUDIT":    "audit",
+	"INCIDENT": "incident",
+}
+
+var prefix = regexp.MustCompile(`^\[([A-Z]+) ?\]: ?`)
+
+var (
+	lock               = sync.Mutex{}
+	output   io.Writer = os.Stderr
+	format             = FormatText
+	minLevel           = 1
+	// while set, every level is logged whatever the configured level, e.g. during an incident
+	verbose = false
+)
+
+// checks a log format and level, as given in the config file
+func Validate(f, level string) error {
+	if f != FormatText && f != FormatJSON {
+		return errors.New("format must be text or json")
+	}
+	if levelIndex(level) < 0 {
+		return errors.New("level must be one of " + strings.Join(levels, ", "))
+	}
+	return nil
+}
+
+// routes the standard logger through goldfish's formatting, dropping lines below level
+func Configure(f, level string) error {
+	if err := Validate(f, level); err != nil {
+		return err
+	}
+	lock.Lock()
+	format = f
+	minLevel = levelIndex(level)
+	lock.Unlock()
+
+	// timestamps are added here, so json lines can carry them as a field
+	log.SetFlags(0)
+	log.SetOutput(writer{})
+	return nil
+}
+
+// logs every level while on, until it is turned off again
+func Verbose(on bool) {
+	lock.Lock()
+	verbose = on
+	lock.Unlock()
+}
+
+func levelIndex(level string) int {
+	for i, l := range levels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+func currentFormat() string {
+	lock.Lock()
+	defer lock.Unlock()
+	return format
+}
+
+// receives each line of the standard logger
+type writer struct{}
+
+func (writer) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+	level, kind, msg := "info", "", line
+	if m := prefix.FindStringSubmatch(line); m != nil {
+		if l, ok := prefixLevels[m[1]]; ok {
+			level = l
+		} else if t, ok := prefixTypes[m[1]]; ok {
+			kind = t
+		}
+		// json lines carry the level as a field instead
+		if currentFormat() == FormatJSON {
+			msg = line[len(m[0]):]
+		}
+	}
+	entry := map[string]interface{}{}
+	if kind != "" {
+		entry["type"] = kind
+	}
+	if err := write(level, kind != "", msg, entry); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logs a served request. Text lines are kept short, json lines carry every field
+func Request(method, uri string, status int, latency time.Duration, fields map[string]interface{}) {
+	msg := fmt.Sprintf("%s %s", method, uri)
+	if currentFormat() != FormatJSON {
+		msg = fmt.Sprintf("[INFO ]: %s %s %d %s", method, uri, status, latency)
+		if id, ok := fields["request_id"].(string); ok && id != "" {
+			msg += " request_id=" + id
+		}
+	}
+	entry := map[string]interface{}{
+		"type":       "request",
+		"method":     method,
+		"uri":        uri,
+		"status":     status,
+		"latency_ms": float64(latency) / float64(time.Millisecond),
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	write("info", false, msg, entry)
+}
+
+func write(level string, always bool, msg string, entry map[string]interface{}) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if !always && !verbose && levelIndex(level) < minLevel {
+		return nil
+	}
+	now := time.Now()
+	if format != FormatJSON {
+		_, err := fmt.Fprintln(output, now.Format("2006/01/02 15:04:05"), msg)
+		return err
+	}
+	entry["time"] = now.UTC().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["msg"] = msg
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = output.Write(append(b, '\n'))
+	return err
+}
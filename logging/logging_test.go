@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// configures logging to write into a buffer, returning the lines written by f
+func capture(format, level string, f func()) []string {
+	var b bytes.Buffer
+	lock.Lock()
+	output = &b
+	lock.Unlock()
+	Configure(format, level)
+	f()
+	return strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+}
+
+func TestValidate(t *testing.T) {
+	Convey("Known formats and levels should be accepted", t, func(c C) {
+		c.So(Validate("json", "warn"), ShouldBeNil)
+		c.So(Validate("text", "debug"), ShouldBeNil)
+	})
+
+	Convey("Unknown formats and levels should be rejected", t, func(c C) {
+		c.So(Validate("xml", "info"), ShouldNotBeNil)
+		c.So(Validate("json", "trace"), ShouldNotBeNil)
+	})
+}
+
+func TestJSON(t *testing.T) {
+	Convey("Prefixed lines should become json with their level", t, func(c C) {
+		lines := capture("json", "info", func() {
+			log.Println("[ERROR]: Could not renew token")
+		})
+		c.So(lines, ShouldHaveLength, 1)
+		var entry map[string]interface{}
+		c.So(json.Unmarshal([]byte(lines[0]), &entry), ShouldBeNil)
+		c.So(entry["level"], ShouldEqual, "error")
+		c.So(entry["msg"], ShouldEqual, "Could not renew token")
+		c.So(entry["time"], ShouldNotBeEmpty)
+	})
+
+	Convey("Audit lines should be typed, and kept whatever the level", t, func(c C) {
+		lines := capture("json", "error", func() {
+			log.Println("[INFO ]: dropped")
+			log.Println("[AUDIT]:", "alice", "deleted policy", "dev")
+		})
+		c.So(lines, ShouldHaveLength, 1)
+		var entry map[string]interface{}
+		c.So(json.Unmarshal([]byte(lines[0]), &entry), ShouldBeNil)
+		c.So(entry["type"], ShouldEqual, "audit")
+		c.So(entry["msg"], ShouldEqual, "alice deleted policy dev")
+	})
+
+	Convey("Requests should carry their fields", t, func(c C) {
+		lines := capture("json", "info", func() {
+			Request("GET", "/api/users", 200, 1500*time.Microsecond, map[string]interface{}{
+				"request_id": "abc",
+			})
+		})
+		var entry map[string]interface{}
+		c.So(json.Unmarshal([]byte(lines[0]), &entry), ShouldBeNil)
+		c.So(entry["type"], ShouldEqual, "request")
+		c.So(entry["status"], ShouldEqual, 200)
+		c.So(entry["latency_ms"], ShouldEqual, 1.5)
+		c.So(entry["request_id"], ShouldEqual, "abc")
+	})
+}
+
+func TestText(t *testing.T) {
+	Convey("Text lines should keep their prefix, behind a timestamp", t, func(c C) {
+		lines := capture("text", "info", func() {
+			log.Println("[DEBUG]: dropped")
+			log.Println("[WARN ]: vault is sealed")
+			Request("POST", "/api/login", 403, time.Millisecond, map[string]interface{}{
+				"request_id": "abc",
+			})
+		})
+		c.So(lines, ShouldHaveLength, 2)
+		c.So(lines[0], ShouldEndWith, " [WARN ]: vault is sealed")
+		c.So(lines[1], ShouldEndWith, " [INFO ]: POST /api/login 403 1ms request_id=abc")
+	})
+}
+
+func TestVerbose(t *testing.T) {
+	Convey("Every level should be logged while verbose", t, func(c C) {
+		Verbose(true)
+		lines := capture("text", "error", func() {
+			log.Println("[DEBUG]: kept")
+		})
+		Verbose(false)
+		c.So(lines, ShouldHaveLength, 1)
+
+		lines = capture("text", "error", func() {
+			log.Println("[DEBUG]: dropped")
+			log.Println("[ERROR]: kept")
+		})
+		c.So(lines, ShouldHaveLength, 1)
+		c.So(lines[0], ShouldEndWith, " [ERROR]: kept")
+	})
+}
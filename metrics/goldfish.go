@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// sessions live in cookies, so a session counts as active while it keeps making requests
+const sessionIdleTimeout = 15 * time.Minute
+
+var (
+	HTTPRequests = NewCounterVec(
+		"goldfish_http_requests_total",
+		"HTTP requests served, by method, route and status code.",
+		"method", "route", "code",
+	)
+	HTTPRequestDuration = NewHistogramVec(
+		"goldfish_http_request_duration_seconds",
+		"Time taken to serve HTTP requests, by method and route.",
+		DefaultBuckets,
+		"method", "route",
+	)
+	VaultRequestDuration = NewHistogramVec(
+		"goldfish_vault_request_duration_seconds",
+		"Round-trip time of requests to vault, by method.",
+		DefaultBuckets,
+		"method",
+	)
+	TokenRenewalFailures = NewCounterVec(
+		"goldfish_token_renewal_failures_total",
+		"Failed renewals of goldfish's server tokens, by cluster. The default cluster has an empty name.",
+		"cluster",
+	)
+	PolicyRequests = NewCounterVec(
+		"goldfish_policy_requests_total",
+		"Policy request events, such as created, approved or applied.",
+		"event",
+	)
+	LoginAttempts = NewCounterVec(
+		"goldfish_login_attempts_total",
+		"Login attempts, by result: success, failure, or throttled when refused during a lockout.",
+		"result",
+	)
+	LoginLockouts = NewCounterVec(
+		"goldfish_login_lockouts_total",
+		"Lockouts started by failed logins, by whether a client IP or a username was locked out.",
+		"scope",
+	)
+	_ = NewGaugeFunc(
+		"goldfish_active_sessions",
+		"Sessions that made a request in the last 15 minutes.",
+		func() float64 {
+			return float64(activeSessions(time.Now()))
+		},
+	)
+)
+
+var (
+	sessionsLock = sync.Mutex{}
+	// when each session was last seen, by a hash of its token's cipher
+	sessions = map[[sha256.Size]byte]time.Time{}
+)
+
+// records a request made by a session, identified by its encrypted token
+func SessionSeen(id string) {
+	now := time.Now()
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	sessions[sha256.Sum256([]byte(id))] = now
+	// keeps the map bounded even if metrics are never scraped
+	if len(sessions)%1000 == 0 {
+		pruneSessions(now)
+	}
+}
+
+func SessionEnded(id string) {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	delete(sessions, sha256.Sum256([]byte(id)))
+}
+
+func activeSessions(now time.Time) int {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	pruneSessions(now)
+	return len(sessions)
+}
+
+func pruneSessions(now time.Time) {
+	for key, seen := range sessions {
+		if now.Sub(seen) > sessionIdleTimeout {
+			delete(sessions, key)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func render(c collector) string {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	c.write(w)
+	w.Flush()
+	return b.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	Convey("Counters should be written per label combination, sorted", t, func(c C) {
+		counter := &CounterVec{name: "test_total", help: "Test.", labels: []string{"route", "code"}, values: map[string]float64{}}
+		counter.Inc("/api/users", "200")
+		counter.Inc("/api/users", "200")
+		counter.Inc("/api/\"quoted\"", "403")
+		c.So(render(counter), ShouldEqual, "# HELP test_total Test.\n"+
+			"# TYPE test_total counter\n"+
+			"test_total{route=\"/api/\\\"quoted\\\"\",code=\"403\"} 1\n"+
+			"test_total{route=\"/api/users\",code=\"200\"} 2\n")
+	})
+}
+
+func TestHistogramVec(t *testing.T) {
+	Convey("Histograms should write cumulative buckets, the sum and the count", t, func(c C) {
+		h := &HistogramVec{name: "test_seconds", help: "Test.", labels: []string{"method"},
+			buckets: []float64{0.1, 1}, series: map[string]*histogram{}}
+		h.Observe(0.05, "GET")
+		h.Observe(0.5, "GET")
+		h.Observe(2, "GET")
+		c.So(render(h), ShouldEqual, "# HELP test_seconds Test.\n"+
+			"# TYPE test_seconds histogram\n"+
+			"test_seconds_bucket{method=\"GET\",le=\"0.1\"} 1\n"+
+			"test_seconds_bucket{method=\"GET\",le=\"1\"} 2\n"+
+			"test_seconds_bucket{method=\"GET\",le=\"+Inf\"} 3\n"+
+			"test_seconds_sum{method=\"GET\"} 2.55\n"+
+			"test_seconds_count{method=\"GET\"} 3\n")
+	})
+}
+
+func TestActiveSessions(t *testing.T) {
+	Convey("Sessions should count as active until they end or go idle", t, func(c C) {
+		SessionSeen("first")
+		SessionSeen("second")
+		SessionSeen("second")
+		c.So(activeSessions(time.Now()), ShouldEqual, 2)
+
+		SessionEnded("first")
+		c.So(activeSessions(time.Now()), ShouldEqual, 1)
+
+		c.So(activeSessions(time.Now().Add(sessionIdleTimeout+time.Minute)), ShouldEqual, 0)
+	})
+}
+
+func TestHandler(t *testing.T) {
+	Convey("The handler should serve goldfish's metrics as prometheus text", t, func(c C) {
+		PolicyRequests.Inc("created")
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		c.So(rec.Header().Get("Content-Type"), ShouldStartWith, "text/plain; version=0.0.4")
+		c.So(rec.Body.String(), ShouldContainSubstring, "goldfish_policy_requests_total{event=\"created\"} 1\n")
+		c.So(strings.Count(rec.Body.String(), "# TYPE goldfish_active_sessions gauge\n"), ShouldEqual, 1)
+	})
+}
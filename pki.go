@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"time"
+
+	"github.com/caiyeon/goldfish/config"
+	"github.com/caiyeon/goldfish/vault"
+)
+
+// how soon a failed renewal of the listener's certificate is retried
+const pkiRetryInterval = time.Minute
+
+// issues the listener's certificate from vault's PKI, and keeps renewing it in the background
+func startPKICertificate(listener *config.ListenerConfig) (*certReloader, error) {
+	issue := func() (*tls.Certificate, error) {
+		return vault.IssueServerCertificate(
+			listener.Tls_pki_path,
+			listener.Tls_pki_common_name,
+			listener.Tls_pki_alt_names,
+			listener.Tls_pki_ttl,
+		)
+	}
+	cert, err := issue()
+	if err != nil {
+		return nil, err
+	}
+	r := &certReloader{cert: cert}
+
+	go func() {
+		leaf := cert.Leaf
+		wait := pkiRenewalWait(leaf.NotBefore, leaf.NotAfter, time.Now())
+		for {
+			time.Sleep(wait)
+			next, err := issue()
+			if err != nil {
+				// the current certificate is served until a renewal succeeds, even once expired
+				log.Println("[ERROR]: Could not renew the listener's certificate:", err)
+				wait = pkiRetryInterval
+				continue
+			}
+			r.set(next)
+			leaf = next.Leaf
+			wait = pkiRenewalWait(leaf.NotBefore, leaf.NotAfter, time.Now())
+			log.Println("[INFO ]: Renewed the listener's certificate, valid until", leaf.NotAfter.UTC().Format(time.RFC3339))
+		}
+	}()
+	return r, nil
+}
+
+// certificates are renewed two thirds into their lifetime, leaving time to retry failures
+func pkiRenewalWait(notBefore, notAfter, now time.Time) time.Duration {
+	renewAt := notBefore.Add(notAfter.Sub(notBefore) * 2 / 3)
+	if wait := renewAt.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
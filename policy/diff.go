@@ -0,0 +1,298 @@
+package policy
+
+import (
+	"strings"
+)
+
+// the number of unchanged lines shown around each change
+const DefaultDiffContext = 3
+
+// a line of a diff. Op is " " for context, "-" for removed and "+" for added lines
+// line numbers are 1-based, and zero on the side the line does not appear on
+type DiffLine struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+}
+
+// a run of changes and the context around them, as in a unified diff
+// Stanzas lists the top level blocks the changed lines belong to, e.g. path "secret/*"
+type Hunk struct {
+	OldStart int        `json:"old_start"`
+	OldLines int        `json:"old_lines"`
+	NewStart int        `json:"new_start"`
+	NewLines int        `json:"new_lines"`
+	Stanzas  []string   `json:"stanzas"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+// compares two versions of a policy line by line, grouping changes into hunks with
+// the given number of context lines. Identical policies have no hunks
+func Diff(current, proposed string, context int) []Hunk {
+	a, b := splitLines(current), splitLines(proposed)
+	script := editScript(a, b)
+	oldStanzas, newStanzas := stanzas(a), stanzas(b)
+
+	hunks := []Hunk{}
+	for i := 0; i < len(script); {
+		if script[i].Op == " " {
+			i++
+			continue
+		}
+
+		// extend the hunk while the next change is close enough to share context
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(script); j++ {
+			if script[j].Op != " " {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		stop := end + context + 1
+		if stop > len(script) {
+			stop = len(script)
+		}
+
+		hunk := Hunk{Stanzas: []string{}, Lines: script[start:stop]}
+		seen := map[string]bool{}
+		for _, line := range hunk.Lines {
+			if line.OldLine > 0 && hunk.OldStart == 0 {
+				hunk.OldStart = line.OldLine
+			}
+			if line.NewLine > 0 && hunk.NewStart == 0 {
+				hunk.NewStart = line.NewLine
+			}
+			if line.Op != "+" {
+				hunk.OldLines++
+			}
+			if line.Op != "-" {
+				hunk.NewLines++
+			}
+
+			stanza := ""
+			switch line.Op {
+			case "-":
+				stanza = oldStanzas[line.OldLine-1]
+			case "+":
+				stanza = newStanzas[line.NewLine-1]
+			}
+			if stanza != "" && !seen[stanza] {
+				seen[stanza] = true
+				hunk.Stanzas = append(hunk.Stanzas, stanza)
+			}
+		}
+		// like unified diffs, an empty side starts at the line before the change
+		if hunk.OldLines == 0 {
+			hunk.OldStart = linesBefore(script[:start], "+")
+		}
+		if hunk.NewLines == 0 {
+			hunk.NewStart = linesBefore(script[:start], "-")
+		}
+
+		hunks = append(hunks, hunk)
+		i = stop
+	}
+	return hunks
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// the shortest sequence of kept, removed and added lines turning a into b. Myers' algorithm
+// finds it in O((n+m)·d) time, where d is the number of changed lines, and, by splitting the
+// lines at the middle of the shortest path rather than keeping every step of it, linear space
+func editScript(a, b []string) []DiffLine {
+	script := make([]DiffLine, 0, len(a)+len(b))
+	script = diffLines(script, a, b, 0, 0)
+
+	// within a run of changes, list removed lines before added ones as unified diffs do
+	for i := 0; i < len(script); {
+		if script[i].Op == " " {
+			i++
+			continue
+		}
+		j := i
+		for j < len(script) && script[j].Op != " " {
+			j++
+		}
+		run := append([]DiffLine{}, script[i:j]...)
+		k := i
+		for _, op := range []string{"-", "+"} {
+			for _, line := range run {
+				if line.Op == op {
+					script[k] = line
+					k++
+				}
+			}
+		}
+		i = j
+	}
+	return script
+}
+
+// appends the edit script of a and b, which start at the given 0-based lines of each policy
+func diffLines(script []DiffLine, a, b []string, aStart, bStart int) []DiffLine {
+	// lines the two share at either end are kept as they are
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for i := 0; i < prefix; i++ {
+		script = append(script, DiffLine{Op: " ", Text: a[i], OldLine: aStart + i + 1, NewLine: bStart + i + 1})
+	}
+	a, b = a[prefix:], b[prefix:]
+	aStart, bStart = aStart+prefix, bStart+prefix
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-suffix-1] == b[len(b)-suffix-1] {
+		suffix++
+	}
+	aMid, bMid := a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(aMid) == 0:
+		for j, line := range bMid {
+			script = append(script, DiffLine{Op: "+", Text: line, NewLine: bStart + j + 1})
+		}
+	case len(bMid) == 0:
+		for i, line := range aMid {
+			script = append(script, DiffLine{Op: "-", Text: line, OldLine: aStart + i + 1})
+		}
+	default:
+		if x, y, ok := middleSnake(aMid, bMid); ok {
+			script = diffLines(script, aMid[:x], bMid[:y], aStart, bStart)
+			script = diffLines(script, aMid[x:], bMid[y:], aStart+x, bStart+y)
+			break
+		}
+		// nothing in common, so every line is changed
+		for i, line := range aMid {
+			script = append(script, DiffLine{Op: "-", Text: line, OldLine: aStart + i + 1})
+		}
+		for j, line := range bMid {
+			script = append(script, DiffLine{Op: "+", Text: line, NewLine: bStart + j + 1})
+		}
+	}
+
+	for i := len(a) - suffix; i < len(a); i++ {
+		j := i - len(a) + len(b)
+		script = append(script, DiffLine{Op: " ", Text: a[i], OldLine: aStart + i + 1, NewLine: bStart + j + 1})
+	}
+	return script
+}
+
+// searches for the shortest edit path from both ends of a and b at once, returning the point
+// where the two searches meet. Everything before it, and everything after, is then diffed on
+// its own. a and b must both be non-empty, and differ in their first and last lines. If they
+// have no lines in common at all, the searches don't meet and ok is false
+func middleSnake(a, b []string) (int, int, bool) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	// forward[offset+k] is the furthest x reached from the start on diagonal k = x - y, and
+	// backward[offset+k] the furthest reached from the end, counting both x and y back from it
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	// diagonal k of one search is diagonal delta - k of the other. With an odd delta the
+	// searches meet on a forward step, otherwise on a backward one
+	delta := n - m
+	odd := delta%2 != 0
+	// diagonals that have run off the edges are skipped on later steps
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			x := 0
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				i := offset + delta - k
+				if i >= 0 && i < len(backward) && backward[i] != -1 && x >= n-backward[i] {
+					return x, y, true
+				}
+			}
+		}
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			x := 0
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				i := offset + delta - k
+				if i >= 0 && i < len(forward) && forward[i] != -1 && forward[i] >= n-x {
+					return forward[i], forward[i] - (delta - k), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// the top level block each line belongs to, named by its opening line without the brace
+func stanzas(lines []string) []string {
+	results := make([]string, len(lines))
+	current, depth := "", 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if depth == 0 && strings.Contains(trimmed, "{") {
+			current = strings.TrimSpace(trimmed[:strings.Index(trimmed, "{")])
+		}
+		results[i] = current
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if depth <= 0 {
+			depth, current = 0, ""
+		}
+	}
+	return results
+}
+
+// counts the lines of one side that precede a position in the script
+func linesBefore(script []DiffLine, otherSide string) int {
+	n := 0
+	for _, line := range script {
+		if line.Op != otherSide {
+			n++
+		}
+	}
+	return n
+}
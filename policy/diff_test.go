@@ -0,0 +1,159 @@
+package policy
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiff(t *testing.T) {
+	current := `path "secret/a" {
+  capabilities = ["read"]
+}
+
+path "secret/b" {
+  capabilities = ["read"]
+}
+
+path "secret/c" {
+  capabilities = ["read"]
+}
+`
+
+	Convey("Identical policies should have no hunks", t, func(c C) {
+		c.So(Diff(current, current, DefaultDiffContext), ShouldBeEmpty)
+	})
+
+	Convey("A changed line should be shown with its context and stanza", t, func(c C) {
+		proposed := `path "secret/a" {
+  capabilities = ["read"]
+}
+
+path "secret/b" {
+  capabilities = ["read", "list"]
+}
+
+path "secret/c" {
+  capabilities = ["read"]
+}
+`
+		hunks := Diff(current, proposed, 1)
+		c.So(len(hunks), ShouldEqual, 1)
+		c.So(hunks[0].OldStart, ShouldEqual, 5)
+		c.So(hunks[0].OldLines, ShouldEqual, 3)
+		c.So(hunks[0].NewStart, ShouldEqual, 5)
+		c.So(hunks[0].NewLines, ShouldEqual, 3)
+		c.So(hunks[0].Stanzas, ShouldResemble, []string{`path "secret/b"`})
+		c.So(hunks[0].Lines, ShouldResemble, []DiffLine{
+			{Op: " ", Text: `path "secret/b" {`, OldLine: 5, NewLine: 5},
+			{Op: "-", Text: `  capabilities = ["read"]`, OldLine: 6},
+			{Op: "+", Text: `  capabilities = ["read", "list"]`, NewLine: 6},
+			{Op: " ", Text: `}`, OldLine: 7, NewLine: 7},
+		})
+	})
+
+	Convey("Distant changes should be in separate hunks", t, func(c C) {
+		proposed := `path "secret/a" {
+  capabilities = ["deny"]
+}
+
+path "secret/b" {
+  capabilities = ["read"]
+}
+
+path "secret/c" {
+  capabilities = ["deny"]
+}
+`
+		hunks := Diff(current, proposed, 1)
+		c.So(len(hunks), ShouldEqual, 2)
+		c.So(hunks[0].Stanzas, ShouldResemble, []string{`path "secret/a"`})
+		c.So(hunks[1].Stanzas, ShouldResemble, []string{`path "secret/c"`})
+
+		c.Convey("But share a hunk with enough context", func(c C) {
+			c.So(len(Diff(current, proposed, 4)), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Added stanzas should be attributed to the new stanza", t, func(c C) {
+		proposed := current + `
+path "secret/d" { capabilities = ["read"] }
+`
+		hunks := Diff(current, proposed, 0)
+		c.So(len(hunks), ShouldEqual, 1)
+		c.So(hunks[0].OldStart, ShouldEqual, 11)
+		c.So(hunks[0].OldLines, ShouldEqual, 0)
+		c.So(hunks[0].NewStart, ShouldEqual, 12)
+		c.So(hunks[0].NewLines, ShouldEqual, 2)
+		c.So(hunks[0].Stanzas, ShouldResemble, []string{`path "secret/d"`})
+	})
+}
+
+// the length of the longest common subsequence of a and b, by the quadratic table
+func lcsLength(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				cur[j] = prev[j+1] + 1
+			} else if prev[j] >= cur[j+1] {
+				cur[j] = prev[j]
+			} else {
+				cur[j] = cur[j+1]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[0]
+}
+
+func TestEditScript(t *testing.T) {
+	Convey("Edit scripts should be the shortest that turn one policy into the other", t, func(c C) {
+		random := rand.New(rand.NewSource(1))
+		lines := func() []string {
+			results := make([]string, random.Intn(30))
+			for i := range results {
+				results[i] = strconv.Itoa(random.Intn(5))
+			}
+			return results
+		}
+		for n := 0; n < 500; n++ {
+			a, b := lines(), lines()
+			script := editScript(a, b)
+
+			kept, before, after := 0, []string{}, []string{}
+			for _, line := range script {
+				if line.Op != "+" {
+					c.So(line.OldLine, ShouldEqual, len(before)+1)
+					before = append(before, line.Text)
+				}
+				if line.Op != "-" {
+					c.So(line.NewLine, ShouldEqual, len(after)+1)
+					after = append(after, line.Text)
+				}
+				if line.Op == " " {
+					kept++
+				}
+			}
+			c.So(before, ShouldResemble, a)
+			c.So(after, ShouldResemble, b)
+			c.So(kept, ShouldEqual, lcsLength(a, b))
+		}
+	})
+
+	Convey("Large policies with few changes should diff quickly", t, func(c C) {
+		a := make([]string, 20000)
+		for i := range a {
+			a[i] = `path "secret/` + strconv.Itoa(i) + `" { capabilities = ["read"] }`
+		}
+		b := append([]string{}, a...)
+		b[100], b[15000] = "# changed", "# changed"
+		b = append(b[:5000], b[5001:]...)
+
+		hunks := Diff(strings.Join(a, "\n"), strings.Join(b, "\n"), 0)
+		c.So(len(hunks), ShouldEqual, 3)
+	})
+}
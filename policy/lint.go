@@ -0,0 +1,140 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/parser"
+)
+
+// a problem found in a policy. Line is 0 when it can't be pinned to a line
+type Finding struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+// the outcome of linting a policy. Errors would make vault reject the policy,
+// warnings are grants that are valid but probably broader than intended
+type Report struct {
+	Valid    bool
+	Errors   []Finding
+	Warnings []Finding
+}
+
+// checks a policy for syntax errors and risky grants, without writing it to vault
+func Lint(rules string) Report {
+	report := Report{
+		Errors:   []Finding{},
+		Warnings: []Finding{},
+	}
+
+	if _, err := hcl.Parse(rules); err != nil {
+		report.Errors = append(report.Errors, syntaxFinding(rules, err))
+		return report
+	}
+	parsed, err := Parse(rules)
+	if err != nil {
+		report.Errors = append(report.Errors, syntaxFinding(rules, err))
+		return report
+	}
+
+	for _, rule := range parsed {
+		for _, c := range rule.Capabilities {
+			if !has(capabilityOrder, c) {
+				report.Errors = append(report.Errors, Finding{
+					Line:    rule.Line,
+					Path:    rule.pattern(),
+					Message: fmt.Sprintf("%q is not a capability", c),
+				})
+			}
+		}
+		for _, message := range risks(rule) {
+			report.Warnings = append(report.Warnings, Finding{
+				Line:    rule.Line,
+				Path:    rule.pattern(),
+				Message: message,
+			})
+		}
+	}
+
+	sort.SliceStable(report.Warnings, func(i, j int) bool {
+		return report.Warnings[i].Line < report.Warnings[j].Line
+	})
+	report.Valid = len(report.Errors) == 0
+	return report
+}
+
+func syntaxFinding(rules string, err error) Finding {
+	switch e := err.(type) {
+	case *parser.PosError:
+		return Finding{Line: e.Pos.Line, Message: e.Err.Error()}
+	case *LineError:
+		return Finding{Line: e.Line, Message: e.Message}
+	}
+	// the parser doesn't give a position when it runs out of input, e.g. on a missing brace
+	if strings.HasSuffix(err.Error(), "EOF") {
+		return Finding{
+			Line:    strings.Count(strings.TrimRight(rules, "\n"), "\n") + 1,
+			Message: err.Error(),
+		}
+	}
+	return Finding{Message: err.Error()}
+}
+
+// the path as it was written in the policy
+func (rule Rule) pattern() string {
+	if rule.Glob {
+		return rule.Path + "*"
+	}
+	return rule.Path
+}
+
+// true if the rule's path, or any path its glob matches, is under prefix
+func (rule Rule) covers(prefix string) bool {
+	if strings.HasPrefix(rule.Path, prefix) {
+		return true
+	}
+	return rule.Glob && strings.HasPrefix(prefix, rule.Path)
+}
+
+// explains what is risky about a rule, if anything
+func risks(rule Rule) []string {
+	results := []string{}
+	caps := rule.Capabilities
+	writes := has(caps, "create") || has(caps, "update")
+
+	if has(caps, "deny") {
+		if len(caps) > 1 {
+			results = append(results, "deny overrides every other capability on this path")
+		}
+		// denying broadly is never a risky grant
+		return results
+	}
+	if len(caps) == 0 {
+		results = append(results, "grants no capabilities")
+		return results
+	}
+
+	if rule.Glob && rule.Path == "" {
+		// everything below is implied by this
+		results = append(results, "grants "+join(verbs(caps))+" on every path in vault")
+		return results
+	}
+	if has(caps, "sudo") && rule.Glob && rule.covers("sys/") {
+		results = append(results, "grants sudo on every root-protected path under "+rule.pattern())
+	}
+	// sys/policy is the older path for managing acl policies, sys/policies/acl the current one
+	if writes && (rule.covers("sys/policy") || rule.covers("sys/policies/acl")) {
+		results = append(results, "can rewrite policies, including its own, to grant any access")
+	}
+	if writes && rule.covers("auth/token/create") && rule.Glob {
+		results = append(results, "can create tokens with any role, including orphan and periodic ones")
+	}
+	if writes && rule.Glob && strings.HasPrefix("auth/", rule.Path) {
+		results = append(results, "can reconfigure every auth backend, e.g. to let anyone log in")
+	}
+	return results
+}
@@ -0,0 +1,72 @@
+package policy
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLint(t *testing.T) {
+	Convey("Syntax errors should be reported with their line", t, func(c C) {
+		report := Lint("path \"secret/*\" {\n  capabilities = [\"read\"\n}\n")
+		c.So(report.Valid, ShouldBeFalse)
+		c.So(len(report.Errors), ShouldEqual, 1)
+		c.So(report.Errors[0].Line, ShouldEqual, 3)
+
+		report = Lint("path \"secret/*\" {\n  capabilities = [\"read\"]\n}\n\npath \"secret/foo\" {\n  capabilities = [\"read\"] =\n}\n")
+		c.So(report.Valid, ShouldBeFalse)
+		c.So(report.Errors[0].Line, ShouldEqual, 6)
+
+		report = Lint("path \"secret/*\" {\n  policy = \"write\"\n}\npath \"secret/foo\" {\n  policy = \"everything\"\n}\n")
+		c.So(report.Valid, ShouldBeFalse)
+		c.So(report.Errors[0].Line, ShouldEqual, 4)
+	})
+
+	Convey("Unknown capabilities should be errors", t, func(c C) {
+		report := Lint(`path "secret/*" { capabilities = ["read", "write"] }`)
+		c.So(report.Valid, ShouldBeFalse)
+		c.So(report.Errors[0].Path, ShouldEqual, "secret/*")
+		c.So(report.Errors[0].Message, ShouldContainSubstring, `"write"`)
+	})
+
+	Convey("Risky grants should be warned about", t, func(c C) {
+		report := Lint(samplePolicy + `
+path "*" {
+  capabilities = ["read", "list"]
+}
+path "sys/policy/*" {
+  capabilities = ["update"]
+}
+path "secret/mixed" {
+  capabilities = ["read", "deny"]
+}
+`)
+		c.So(report.Valid, ShouldBeTrue)
+		c.So(report.Errors, ShouldBeEmpty)
+
+		paths := []string{}
+		for _, w := range report.Warnings {
+			paths = append(paths, w.Path)
+		}
+		c.So(paths, ShouldResemble, []string{"sys/mounts/*", "*", "sys/policy/*", "secret/mixed"})
+		c.So(report.Warnings[0].Message, ShouldContainSubstring, "sudo")
+		c.So(report.Warnings[1].Message, ShouldEqual, "grants read and list on every path in vault")
+	})
+
+	Convey("Both paths for managing policies should be warned about", t, func(c C) {
+		for _, path := range []string{"sys/policy/admin", "sys/policies/acl/*", "sys/policies/*", "sys/p*"} {
+			report := Lint(`path "` + path + `" { capabilities = ["create", "update"] }`)
+			c.So(len(report.Warnings), ShouldEqual, 1)
+			c.So(report.Warnings[0].Message, ShouldContainSubstring, "rewrite policies")
+		}
+
+		report := Lint(`path "sys/policies/acl/*" { capabilities = ["read", "list"] }`)
+		c.So(report.Warnings, ShouldBeEmpty)
+	})
+
+	Convey("Narrow grants should pass cleanly", t, func(c C) {
+		report := Lint(`path "secret/app1/*" { capabilities = ["read", "list"] }`)
+		c.So(report.Valid, ShouldBeTrue)
+		c.So(report.Warnings, ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,120 @@
+// Package policy inspects vault ACL policies without a round trip to vault.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+// capabilities in the order vault documents them
+var capabilityOrder = []string{"create", "read", "update", "delete", "list", "sudo", "deny"}
+
+// the pre-0.5 policy values, expressed as capabilities
+var oldPolicies = map[string][]string{
+	"deny":  {"deny"},
+	"read":  {"read", "list"},
+	"write": {"create", "read", "update", "delete", "list"},
+	"sudo":  {"create", "read", "update", "delete", "list", "sudo"},
+}
+
+// an error in a particular line of a policy
+type LineError struct {
+	Line    int
+	Message string
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// a single path stanza of a policy
+type Rule struct {
+	Path         string
+	Glob         bool
+	Capabilities []string
+	Line         int
+}
+
+// parses the path stanzas of a policy, normalizing old-style policy values into capabilities
+func Parse(rules string) ([]Rule, error) {
+	root, err := hcl.Parse(rules)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := root.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, errors.New("Policy doesn't have a root object")
+	}
+
+	results := []Rule{}
+	for _, item := range list.Filter("path").Items {
+		if len(item.Keys) == 0 {
+			return nil, &LineError{item.Pos().Line, "path stanza is missing its path"}
+		}
+		key, ok := item.Keys[0].Token.Value().(string)
+		if !ok {
+			return nil, &LineError{item.Pos().Line, "path must be a string"}
+		}
+
+		var stanza struct {
+			Policy       string   `hcl:"policy"`
+			Capabilities []string `hcl:"capabilities"`
+		}
+		if err := hcl.DecodeObject(&stanza, item.Val); err != nil {
+			return nil, &LineError{item.Pos().Line, err.Error()}
+		}
+
+		rule := Rule{
+			Path:         strings.TrimSuffix(key, "*"),
+			Glob:         strings.HasSuffix(key, "*"),
+			Capabilities: stanza.Capabilities,
+			Line:         item.Pos().Line,
+		}
+		if stanza.Policy != "" {
+			caps, ok := oldPolicies[stanza.Policy]
+			if !ok {
+				return nil, &LineError{rule.Line, fmt.Sprintf("invalid policy %q", stanza.Policy)}
+			}
+			rule.Capabilities = append(rule.Capabilities, caps...)
+		}
+		rule.Capabilities = normalize(rule.Capabilities)
+		results = append(results, rule)
+	}
+	return results, nil
+}
+
+// removes duplicates and sorts capabilities in documented order
+func normalize(caps []string) []string {
+	seen := map[string]bool{}
+	for _, c := range caps {
+		seen[c] = true
+	}
+	results := []string{}
+	for _, c := range capabilityOrder {
+		if seen[c] {
+			results = append(results, c)
+			delete(seen, c)
+		}
+	}
+	// unknown capabilities are kept so they can be linted, after the known ones
+	rest := []string{}
+	for c := range seen {
+		rest = append(rest, c)
+	}
+	sort.Strings(rest)
+	return append(results, rest...)
+}
+
+func has(caps []string, c string) bool {
+	for _, each := range caps {
+		if each == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package policy
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const samplePolicy = `
+path "secret/app1/*" {
+  capabilities = ["list", "read"]
+}
+path "secret/app2/config" {
+  policy = "write"
+}
+path "auth/token/create/deployer" {
+  capabilities = ["update"]
+}
+path "secret/super-secret/*" {
+  capabilities = ["deny"]
+}
+path "sys/mounts/*" {
+  capabilities = ["create", "update", "sudo"]
+}
+`
+
+func TestSummarize(t *testing.T) {
+	Convey("Summarizing a policy", t, func(c C) {
+		summaries, err := Summarize(samplePolicy)
+		c.So(err, ShouldBeNil)
+		c.So(len(summaries), ShouldEqual, 5)
+
+		c.Convey("Capabilities should be normalized and explained", func(c C) {
+			c.So(summaries[0].Capabilities, ShouldResemble, []string{"read", "list"})
+			c.So(summaries[0].Summary, ShouldEqual, "can read and list everything under secret/app1/")
+		})
+
+		c.Convey("Old-style policies should be expanded", func(c C) {
+			c.So(summaries[1].Capabilities, ShouldResemble, []string{"create", "read", "update", "delete", "list"})
+			c.So(summaries[1].Summary, ShouldEqual, "can create, read, update, delete and list secret/app2/config")
+		})
+
+		c.Convey("Well-known paths should get specific explanations", func(c C) {
+			c.So(summaries[2].Summary, ShouldEqual, "can create tokens with role deployer")
+			c.So(summaries[3].Summary, ShouldEqual, "is denied all access to everything under secret/super-secret/")
+			c.So(summaries[4].Summary, ShouldEqual, "can manage secret backend mounts (create and update) at everything under sys/mounts/")
+		})
+	})
+
+	Convey("Invalid policies should be rejected", t, func(c C) {
+		_, err := Summarize(`path "secret/*" { policy = "readwrite" }`)
+		c.So(err, ShouldNotBeNil)
+
+		_, err = Summarize(`path "secret/*" {`)
+		c.So(err, ShouldNotBeNil)
+	})
+}
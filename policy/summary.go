@@ -0,0 +1,93 @@
+package policy
+
+import (
+	"strings"
+)
+
+// a plain-language explanation of one rule
+type RuleSummary struct {
+	Rule
+	Summary string
+}
+
+// explains each rule of a policy in plain language, e.g.
+// "can read and list everything under secret/app1/"
+func Summarize(rules string) ([]RuleSummary, error) {
+	parsed, err := Parse(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RuleSummary, 0, len(parsed))
+	for _, rule := range parsed {
+		results = append(results, RuleSummary{
+			Rule:    rule,
+			Summary: describe(rule),
+		})
+	}
+	return results, nil
+}
+
+func describe(rule Rule) string {
+	target := rule.Path
+	if rule.Glob {
+		if rule.Path == "" {
+			target = "every path in vault"
+		} else {
+			target = "everything under " + rule.Path
+		}
+	}
+
+	if has(rule.Capabilities, "deny") {
+		return "is denied all access to " + target
+	}
+	if len(rule.Capabilities) == 0 {
+		return "grants nothing on " + target
+	}
+
+	// a few paths are common enough to deserve a specific explanation
+	writes := has(rule.Capabilities, "create") || has(rule.Capabilities, "update")
+	switch {
+	case writes && rule.Path == "auth/token/create" && !rule.Glob:
+		return "can create child tokens"
+	case writes && strings.HasPrefix(rule.Path, "auth/token/create/") && !rule.Glob:
+		return "can create tokens with role " + strings.TrimPrefix(rule.Path, "auth/token/create/")
+	case writes && rule.Path == "auth/token/create/" && rule.Glob:
+		return "can create tokens with any role"
+	case writes && strings.HasPrefix(rule.Path, "sys/policy"):
+		return "can manage policies (" + join(verbs(rule.Capabilities)) + ") at " + target
+	case writes && strings.HasPrefix(rule.Path, "sys/mounts"):
+		return "can manage secret backend mounts (" + join(verbs(rule.Capabilities)) + ") at " + target
+	}
+
+	summary := "can " + join(verbs(rule.Capabilities)) + " " + target
+	if has(rule.Capabilities, "sudo") {
+		summary += ", including root-protected operations"
+	}
+	return summary
+}
+
+func verbs(caps []string) []string {
+	results := []string{}
+	for _, c := range caps {
+		if c != "sudo" {
+			results = append(results, c)
+		}
+	}
+	if len(results) == 0 {
+		results = append(results, "access")
+	}
+	return results
+}
+
+// joins words as an english list: "a", "a and b", "a, b and c"
+func join(words []string) string {
+	switch len(words) {
+	case 0:
+		return ""
+	case 1:
+		return words[0]
+	default:
+		return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/caiyeon/goldfish/config"
+)
+
+const provisionUsage = `Usage: goldfish provision -config <path> [options]
+
+  Creates or updates everything goldfish needs in vault: the transit mount and keys,
+  the goldfish policy, the approle, and the runtime config. A plan is shown first,
+  and nothing is changed until it is confirmed. Running it again changes nothing,
+  unless a newer goldfish needs more.
+
+  The admin token is read from -token, or VAULT_TOKEN.
+
+`
+
+// provisions vault for the goldfish deployment in -config, returning the exit code
+func runProvision(args []string) int {
+	flags := flag.NewFlagSet("provision", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, provisionUsage)
+		flags.PrintDefaults()
+	}
+	cfgPath := flags.String("config", "", "The path of the deployment config HCL file")
+	var sets overrideFlags
+	flags.Var(&sets, "set", "Override a config value, e.g. -set vault.address=https://vault:8200. May be repeated")
+	token := flags.String("token", os.Getenv("VAULT_TOKEN"), "A vault token allowed to manage mounts, policies and auth backends")
+	roleName := flags.String("role-name", "goldfish", "The name of the approle role whose role_id is vault.approle_id")
+	autoApprove := flags.Bool("auto-approve", false, "Apply the plan without asking for confirmation")
+	planOnly := flags.Bool("plan", false, "Only show the plan")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadConfigFile(*cfgPath, configOverrides(sets))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	plan, err := config.PlanProvision(cfg, *token, *roleName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "[ERROR]: Could not plan:", err)
+		return 1
+	}
+
+	plan.Print(os.Stdout)
+	if plan.Changes() == 0 {
+		fmt.Println("\nVault already has everything goldfish needs.")
+		return 0
+	}
+	if *planOnly {
+		return 0
+	}
+	if !*autoApprove && !config.ConfirmProvision(os.Stdin, os.Stdout) {
+		fmt.Println("Nothing was changed.")
+		return 1
+	}
+
+	if err := plan.Apply(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "[ERROR]:", err)
+		return 1
+	}
+	fmt.Println("\nProvisioned. Generate a wrapped secret_id for the role to start goldfish.")
+	return 0
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/caiyeon/goldfish/config"
+	"github.com/caiyeon/goldfish/handlers"
+	"github.com/caiyeon/goldfish/logging"
+	"github.com/caiyeon/goldfish/vault"
+)
+
+// serves the listener's certificate, which SIGHUP can swap without dropping connections
+type certReloader struct {
+	lock sync.RWMutex
+	cert *tls.Certificate
+}
+
+// nil unless the listener serves certificate files of its own
+var listenerCerts *certReloader
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{}
+	return r, r.load(certFile, keyFile)
+}
+
+// a certificate that can't be loaded leaves the current one in place
+func (r *certReloader) load(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	r.set(&cert)
+	return nil
+}
+
+func (r *certReloader) set(cert *tls.Certificate) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cert = cert
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+// on SIGHUP, re-reads the config file and the runtime config. Sessions are unaffected
+func watchReloads() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		log.Println("[INFO ]: Reload requested")
+		if err := reload(); err != nil {
+			log.Println("[ERROR]: Reload failed:", err)
+			continue
+		}
+		log.Println("[INFO ]: Reload complete")
+	}
+}
+
+func reload() error {
+	// the dev config isn't read from a file
+	if !devMode {
+		next, err := config.LoadConfigFile(cfgPath, configOverrides(cfgSets))
+		if err != nil {
+			return err
+		}
+		if err := applyConfig(next); err != nil {
+			return err
+		}
+	}
+	return vault.ReloadRuntimeConfig()
+}
+
+// applies the settings that can change while serving. The rest are only read on startup
+func applyConfig(next *config.Config) error {
+	if listenerCerts != nil {
+		if err := listenerCerts.load(next.Listener.Tls_cert_file, next.Listener.Tls_key_file); err != nil {
+			return err
+		}
+	}
+	if err := logging.Configure(next.Log.Format, next.Log.Level); err != nil {
+		return err
+	}
+	if next.Listener.Address == cfg.Listener.Address {
+		if err := chmodSocket(next.Listener.Address, next.Listener.Socket_mode); err != nil {
+			return err
+		}
+	}
+	setShutdownTimeout(next.Listener.Shutdown_timeout)
+	limit := next.LoginLimit
+	handlers.SetLoginLimits(limit.Ip_attempts, limit.User_attempts, limit.Backoff, limit.Max_lockout)
+	vault.SetRuntimeConfigInterval(next.Vault.Runtime_config_interval)
+
+	if changed := restartRequired(cfg, next); len(changed) > 0 {
+		log.Println("[WARN ]: Changes to", strings.Join(changed, ", "), "take effect after a restart")
+	}
+	return nil
+}
+
+// the config sections that differ in ways reloading can't apply
+func restartRequired(current, next *config.Config) []string {
+	changed := []string{}
+
+	listener, nextListener := *current.Listener, *next.Listener
+	// certificate files can only be reloaded if the listener served some to begin with
+	if listenerCerts != nil {
+		listener.Tls_cert_file, listener.Tls_key_file = "", ""
+		nextListener.Tls_cert_file, nextListener.Tls_key_file = "", ""
+	}
+	listener.Shutdown_timeout, nextListener.Shutdown_timeout = 0, 0
+	if listener.Address == nextListener.Address {
+		listener.Socket_mode, nextListener.Socket_mode = 0, 0
+	}
+	if !reflect.DeepEqual(listener, nextListener) {
+		changed = append(changed, "listener")
+	}
+
+	vaultConfig, nextVault := *current.Vault, *next.Vault
+	vaultConfig.Runtime_config_interval, nextVault.Runtime_config_interval = 0, 0
+	if vaultConfig != nextVault {
+		changed = append(changed, "vault")
+	}
+
+	if !reflect.DeepEqual(current.Coordinator, next.Coordinator) {
+		changed = append(changed, "coordinator")
+	}
+	if !reflect.DeepEqual(current.Clusters, next.Clusters) {
+		changed = append(changed, "cluster")
+	}
+	if !reflect.DeepEqual(current.Audit, next.Audit) {
+		changed = append(changed, "audit")
+	}
+	if !reflect.DeepEqual(current.Tracing, next.Tracing) {
+		changed = append(changed, "tracing")
+	}
+	return changed
+}
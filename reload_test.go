@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/caiyeon/goldfish/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// writes a self-signed certificate and its key for the host into dir
+func writeTestCert(dir, host string) (string, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	certFile, keyFile := filepath.Join(dir, host+".crt"), filepath.Join(dir, host+".key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		return "", "", err
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile, err
+}
+
+func TestCertReloader(t *testing.T) {
+	Convey("Reloading should swap the served certificate", t, func(c C) {
+		dir, err := ioutil.TempDir("", "goldfish-certs")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		served := func(r *certReloader) string {
+			cert, err := r.GetCertificate(nil)
+			c.So(err, ShouldBeNil)
+			leaf, err := x509.ParseCertificate(cert.Certificate[0])
+			c.So(err, ShouldBeNil)
+			return leaf.Subject.CommonName
+		}
+
+		oldCert, oldKey, err := writeTestCert(dir, "old.example.com")
+		c.So(err, ShouldBeNil)
+		newCert, newKey, err := writeTestCert(dir, "new.example.com")
+		c.So(err, ShouldBeNil)
+
+		r, err := newCertReloader(oldCert, oldKey)
+		c.So(err, ShouldBeNil)
+		c.So(served(r), ShouldEqual, "old.example.com")
+
+		c.So(r.load(newCert, newKey), ShouldBeNil)
+		c.So(served(r), ShouldEqual, "new.example.com")
+
+		c.Convey("But keep the current one if the new one can't be loaded", func(c C) {
+			c.So(r.load(newCert, oldKey), ShouldNotBeNil)
+			c.So(r.load(filepath.Join(dir, "missing.crt"), newKey), ShouldNotBeNil)
+			c.So(served(r), ShouldEqual, "new.example.com")
+		})
+	})
+}
+
+func TestRestartRequired(t *testing.T) {
+	parse := func(c C, listener, vault string) *config.Config {
+		cfg, err := config.ParseConfig(`listener "tcp" {
+	address       = "unix:///run/goldfish.sock"
+	tls_cert_file = "/etc/goldfish/cert.pem"
+	tls_key_file  = "/etc/goldfish/key.pem"
+	` + listener + `
+}
+vault {
+	address = "https://127.0.0.1:8200"
+	` + vault + `
+}`)
+		c.So(err, ShouldBeNil)
+		return cfg
+	}
+
+	Convey("Settings that reloading applies should not need a restart", t, func(c C) {
+		current := parse(c, `socket_mode = "0660"`, "")
+		listenerCerts = &certReloader{}
+		defer func() { listenerCerts = nil }()
+
+		c.So(restartRequired(current, parse(c, `socket_mode      = "0600"
+	shutdown_timeout = "1m"`, `runtime_config_interval = "10s"`)), ShouldBeEmpty)
+		next := parse(c, `socket_mode = "0660"`, "")
+		next.Listener.Tls_cert_file = "/etc/goldfish/renewed.pem"
+		c.So(restartRequired(current, next), ShouldBeEmpty)
+	})
+
+	Convey("Other changes should be reported as needing a restart", t, func(c C) {
+		current := parse(c, "", "")
+		c.So(restartRequired(current, parse(c, `read_timeout = "1s"`, "")), ShouldResemble, []string{"listener"})
+		c.So(restartRequired(current, parse(c, "", `tls_skip_verify = 1`)), ShouldResemble, []string{"vault"})
+
+		// without certificates served to begin with, there is nothing to swap
+		next := parse(c, "", "")
+		next.Listener.Tls_cert_file = "/etc/goldfish/renewed.pem"
+		c.So(restartRequired(current, next), ShouldResemble, []string{"listener"})
+	})
+}
@@ -0,0 +1,199 @@
+// Package schema validates decoded JSON documents against a subset of JSON Schema.
+//
+// Supported keywords: type, properties, required, additionalProperties (boolean),
+// items, enum, minLength, maxLength, pattern, minimum, maximum, minItems, maxItems.
+// Unknown keywords are ignored, so schemas written for full validators still load.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
+type Schema struct {
+	Type                 interface{}        `json:"type"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+
+	pattern *regexp.Regexp
+}
+
+// parses a schema, compiling any patterns so that validation cannot fail on them later
+func Parse(raw []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	for _, child := range s.Properties {
+		if child == nil {
+			continue
+		}
+		if err := child.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// returns every violation found in the document, or nil if it is valid
+func (s *Schema) Validate(doc interface{}) []string {
+	return s.validate("$", doc)
+}
+
+func (s *Schema) validate(at string, v interface{}) []string {
+	if s == nil {
+		return nil
+	}
+	errs := []string{}
+
+	if !s.typeMatches(v) {
+		return append(errs, fmt.Sprintf("%s: expected type %v, got %s", at, s.Type, typeOf(v)))
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: value is not one of %v", at, s.Enum))
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := val[key]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing required key %q", at, key))
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if child, ok := s.Properties[key]; ok {
+				errs = append(errs, child.validate(at+"."+key, val[key])...)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				errs = append(errs, fmt.Sprintf("%s: key %q is not allowed", at, key))
+			}
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			errs = append(errs, fmt.Sprintf("%s: must have at least %d items", at, *s.MinItems))
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			errs = append(errs, fmt.Sprintf("%s: must have at most %d items", at, *s.MaxItems))
+		}
+		for i, item := range val {
+			errs = append(errs, s.Items.validate(fmt.Sprintf("%s[%d]", at, i), item)...)
+		}
+
+	case string:
+		if s.MinLength != nil && len(val) < *s.MinLength {
+			errs = append(errs, fmt.Sprintf("%s: must be at least %d characters", at, *s.MinLength))
+		}
+		if s.MaxLength != nil && len(val) > *s.MaxLength {
+			errs = append(errs, fmt.Sprintf("%s: must be at most %d characters", at, *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			errs = append(errs, fmt.Sprintf("%s: does not match pattern %q", at, s.Pattern))
+		}
+
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			errs = append(errs, fmt.Sprintf("%s: must be at least %v", at, *s.Minimum))
+		}
+		if s.Maximum != nil && val > *s.Maximum {
+			errs = append(errs, fmt.Sprintf("%s: must be at most %v", at, *s.Maximum))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (s *Schema) typeMatches(v interface{}) bool {
+	switch t := s.Type.(type) {
+	case nil:
+		return true
+	case string:
+		return typeIs(t, v)
+	case []interface{}:
+		for _, each := range t {
+			if name, ok := each.(string); ok && typeIs(name, v) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func typeIs(name string, v interface{}) bool {
+	actual := typeOf(v)
+	if name == "number" && actual == "integer" {
+		return true
+	}
+	return name == actual
+}
+
+func typeOf(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if val == float64(int64(val)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
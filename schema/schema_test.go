@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func decode(raw string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	Convey("Given a schema for a database secret", t, func(c C) {
+		s, err := Parse([]byte(`{
+			"type": "object",
+			"required": ["username", "password"],
+			"additionalProperties": false,
+			"properties": {
+				"username": {"type": "string", "minLength": 1},
+				"password": {"type": "string", "minLength": 12},
+				"port":     {"type": "integer", "minimum": 1, "maximum": 65535},
+				"tags":     {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}},
+				"tier":     {"enum": ["dev", "prod"]}
+			}
+		}`))
+		c.So(err, ShouldBeNil)
+
+		c.Convey("A conforming document should pass", func(c C) {
+			c.So(s.Validate(decode(`{
+				"username": "app", "password": "correcthorsebattery",
+				"port": 5432, "tags": ["db"], "tier": "prod"
+			}`)), ShouldBeNil)
+		})
+
+		c.Convey("Missing and unknown keys should be reported", func(c C) {
+			errs := s.Validate(decode(`{"username": "app", "extra": 1}`))
+			c.So(errs, ShouldContain, `$: missing required key "password"`)
+			c.So(errs, ShouldContain, `$: key "extra" is not allowed`)
+		})
+
+		c.Convey("Nested constraints should be reported with their location", func(c C) {
+			errs := s.Validate(decode(`{
+				"username": "app", "password": "short",
+				"port": 70000, "tags": ["DB"], "tier": "qa"
+			}`))
+			c.So(len(errs), ShouldEqual, 4)
+			c.So(errs, ShouldContain, `$.tags[0]: does not match pattern "^[a-z]+$"`)
+		})
+
+		c.Convey("Type mismatches should be reported", func(c C) {
+			c.So(s.Validate(decode(`{"username": 1, "password": "correcthorsebattery"}`)),
+				ShouldResemble, []string{"$.username: expected type string, got integer"})
+		})
+	})
+
+	Convey("Invalid patterns should be rejected at parse time", t, func(c C) {
+		_, err := Parse([]byte(`{"properties": {"a": {"pattern": "("}}}`))
+		c.So(err, ShouldNotBeNil)
+	})
+}
@@ -1,33 +1,46 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"time"
+	"net"
+	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 
 	"github.com/caiyeon/goldfish/config"
 	"github.com/caiyeon/goldfish/handlers"
+	"github.com/caiyeon/goldfish/logging"
+	"github.com/caiyeon/goldfish/metrics"
+	"github.com/caiyeon/goldfish/tracing"
 	"github.com/caiyeon/goldfish/vault"
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/securecookie"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
-
-	"golang.org/x/crypto/acme/autocert"
 )
 
 var (
 	devMode       bool
 	wrappingToken string
 	cfgPath       string
+	cfgSets       overrideFlags
+	validateCfg   bool
 	cfg           *config.Config
 	devVaultCh    chan struct{}
 	err           error
 	printVersion  bool
+	genDevCert    bool
+	devCertDir    string
+	devCertHosts  string
+	devCertAddr   string
+	devCertTrust  bool
+	pidFile       string
+	assetsDir     string
+	csrfKey       []byte
 )
 
 func init() {
@@ -35,20 +48,23 @@ func init() {
 	flag.BoolVar(&printVersion, "version", false, "Display goldfish's version and exit")
 	flag.StringVar(&wrappingToken, "token", "", "Token generated from approle (must be wrapped!)")
 	flag.StringVar(&cfgPath, "config", "", "The path of the deployment config HCL file")
-
-	// if vault dev core is active, relay shutdown signal
-	shutdownCh := make(chan os.Signal, 4)
-	signal.Notify(shutdownCh, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<- shutdownCh
-		log.Println("\n\n==> Goldfish shutdown triggered")
-		if devVaultCh != nil { close(devVaultCh) }
-		time.Sleep(time.Second)
-		os.Exit(0)
-	}()
+	flag.BoolVar(&validateCfg, "validate-config", false, "Check the config file and overrides, print every problem found, and exit non-zero if there are any")
+	flag.Var(&cfgSets, "set", "Override a config value, e.g. -set vault.address=https://vault:8200. May be repeated, and takes precedence over GOLDFISH_* environment variables")
+	flag.BoolVar(&genDevCert, "gen-dev-cert", false, "Generate a local development TLS certificate and listener config, then exit")
+	flag.StringVar(&devCertDir, "dev-cert-dir", ".", "Directory to write the development certificate into")
+	flag.StringVar(&devCertHosts, "dev-cert-hosts", "localhost,127.0.0.1,::1", "Comma-separated hostnames and IPs of the development certificate")
+	flag.StringVar(&devCertAddr, "dev-cert-address", "127.0.0.1:8000", "Listener address written into the generated config snippet")
+	flag.BoolVar(&devCertTrust, "dev-cert-install", false, "Install the development CA into the OS trust store (usually requires sudo)")
+	flag.StringVar(&pidFile, "pid-file", "", "Write goldfish's pid to this file. It changes when goldfish upgrades itself on SIGUSR2")
+	flag.StringVar(&assetsDir, "assets-dir", "", "Serve the frontend from this directory instead of the copy built into the binary, e.g. 'public' during development")
 }
 
 func main() {
+	// 'goldfish provision' sets up vault for goldfish, and exits
+	if len(os.Args) > 1 && os.Args[1] == "provision" {
+		os.Exit(runProvision(os.Args[2:]))
+	}
+
 	// if --version, print and exit success
 	flag.Parse()
 	if printVersion {
@@ -56,31 +72,94 @@ func main() {
 		os.Exit(0)
 	}
 
+	// if --validate-config, check the config without starting goldfish, e.g. in CI pipelines
+	if validateCfg {
+		if _, err := config.LoadConfigFile(cfgPath, configOverrides(cfgSets)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("Config is valid")
+		os.Exit(0)
+	}
+
+	// if --gen-dev-cert, write a development certificate and listener config, and exit
+	if genDevCert {
+		snippet, err := config.GenerateDevCert(devCertDir, strings.Split(devCertHosts, ","), devCertAddr, devCertTrust)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Println("Development certificate generated, listener config written to " + snippet)
+		os.Exit(0)
+	}
+
+	// from here on, shutting down drains whatever is serving and revokes goldfish's tokens
+	go watchShutdown()
+
 	// if dev mode, run a localhost dev vault instance
 	if devMode {
 		cfg, devVaultCh, wrappingToken, err = config.LoadConfigDev()
 	} else {
-		cfg, err = config.LoadConfigFile(cfgPath)
+		cfg, err = config.LoadConfigFile(cfgPath, configOverrides(cfgSets))
 	}
 	if err != nil {
 		panic(err)
 	}
+	if err := logging.Configure(cfg.Log.Format, cfg.Log.Level); err != nil {
+		log.Fatalln("[ERROR]: Could not configure logging:", err)
+	}
+
+	// if this process is an upgrade, it carries on with the previous process's token and keys
+	handover, err := inheritHandover()
+	if err != nil {
+		log.Fatalln("[ERROR]: Could not take over from the previous goldfish process:", err)
+	}
 
-	// if API wrapper can't start, panic is justified
+	// transient errors are retried, so if API wrapper still can't start, exiting is justified
 	vault.VaultAddress = cfg.Vault.Address
 	vault.VaultSkipTLS = cfg.Vault.Tls_skip_verify
-	if err := vault.StartGoldfishWrapper(
-		wrappingToken,
-		cfg.Vault.Approle_login,
-		cfg.Vault.Approle_id,
-	); err != nil {
-		panic(err)
+	vault.StartupRetries = cfg.Vault.Startup_retries
+	vault.StartupRetryInterval = cfg.Vault.Startup_retry_interval
+	vault.SetRuntimeConfigInterval(cfg.Vault.Runtime_config_interval)
+	if handover != nil {
+		handlers.SetSessionKeys(handover.CookieHashKey, handover.CookieBlockKey)
+		csrfKey = handover.CSRFKey
+		// the token file is kept current by its owner, so it is read rather than the handed over token
+		if cfg.Vault.Auth_method == "token_file" {
+			err = startGoldfish(cfg.Vault)
+		} else {
+			err = vault.ResumeGoldfishWrapper(handover.VaultToken)
+		}
+	} else {
+		// Generate a new encryption key for cookies each launch
+		// invalidating previous goldfish instance's cookies is purposeful
+		csrfKey = securecookie.GenerateRandomKey(32)
+		err = startGoldfish(cfg.Vault)
+	}
+	if err != nil {
+		log.Fatalln("[ERROR]: Could not start goldfish:", err)
+	}
+
+	// other clusters users may log in to, each with its own server token if configured
+	if err := startClusters(cfg.Clusters, handover); err != nil {
+		log.Fatalln("[ERROR]: Could not start goldfish:", err)
+	}
+
+	if cfg.Tracing != nil {
+		if err := tracing.Configure(cfg.Tracing.Endpoint, cfg.Tracing.Service_name, cfg.Tracing.Sample_ratio); err != nil {
+			log.Fatalln("[ERROR]: Could not configure tracing:", err)
+		}
+	}
+
+	// goldfish's own record of the actions taken through it
+	if err := startAudit(cfg.Audit); err != nil {
+		log.Fatalln("[ERROR]: Could not open audit sink:", err)
 	}
 
 	// load config from vault and start goroutines
 	if err := vault.LoadRuntimeConfig(cfg.Vault.Runtime_config); err != nil {
-		panic(err)
+		log.Fatalln("[ERROR]: Could not load runtime config:", err)
 	}
+	go handlers.SyncIncidentMode()
 
 	// if we got here, goldfish has hooked up to vault successfully
 	if devMode {
@@ -91,41 +170,76 @@ func main() {
 	// instantiate echo web server
 	e := echo.New()
 	e.HideBanner = true
+	limitServer(e.Server, cfg.Listener)
+	limitServer(e.TLSServer, cfg.Listener)
+
+	limit := cfg.LoginLimit
+	handlers.SetLoginLimits(limit.Ip_attempts, limit.User_attempts, limit.Backoff, limit.Max_lockout)
+
+	// before routing, so the path and the client's address are those seen by the reverse proxy
+	trustedProxies, err := config.ParseNetworks(cfg.Listener.Trusted_proxies)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	e.Pre(handlers.TrustProxies(trustedProxies))
+	e.Pre(handlers.BasePath(cfg.Listener.Base_path))
+	e.Pre(handlers.RestrictNetworks(networkRules(cfg.Listener)))
 
 	// setup middleware
-	e.Use(middleware.Logger())
+	e.Use(handlers.RequestID())
+	e.Use(handlers.Tracing())
+	e.Use(handlers.RequestLogger())
 	e.Use(middleware.Recover())
+	headers := cfg.Listener.Headers
+	e.Use(handlers.Secure(handlers.SecurityHeaders{
+		ContentSecurityPolicy: headers.Content_security_policy,
+		FrameOptions:          headers.Frame_options,
+		ReferrerPolicy:        headers.Referrer_policy,
+		HSTSMaxAge:            headers.Hsts_max_age,
+		HSTSIncludeSubdomains: headers.Hsts_include_subdomains,
+	}))
+	// before csrf, so preflight requests are answered without a token
+	if cors := cfg.Listener.Cors; cors != nil {
+		e.Use(handlers.CORS(cors.Allowed_origins, cors.Allowed_methods, cors.Allow_credentials))
+	}
+	e.Use(handlers.Metrics())
+	e.Use(handlers.CompatGuard())
+	e.Use(handlers.ToggleGuard())
+	e.Use(handlers.RoleGuard())
+	e.Use(handlers.IncidentCapture())
 	e.Use(echo.WrapMiddleware(
 		csrf.Protect(
-			// Generate a new encryption key for cookies each launch
-			// invalidating previous goldfish instance's cookies is purposeful
-			[]byte(securecookie.GenerateRandomKey(32)),
+			csrfKey,
 			// https-only unless tls_disable
 			csrf.Secure(!cfg.Listener.Tls_disable),
 		)))
+	// after csrf, so replicas check the token before forwarding
+	e.Use(handlers.ForwardToCoordinator())
+	// after forwarding, so actions are recorded where they are carried out
+	e.Use(handlers.AuditActions())
+	// after forwarding, so responses from the coordinator aren't compressed twice
+	if compression := cfg.Listener.Compression; compression != nil {
+		e.Use(handlers.Compress(compression.Level))
+	}
 
 	// unless explicitly disabled, some extra https configurations need to be set
 	if !cfg.Listener.Tls_disable {
-		// add extra security headers
-		e.Use(middleware.SecureWithConfig(middleware.SecureConfig{
-			XSSProtection:         "1; mode=block",
-			ContentTypeNosniff:    "nosniff",
-			XFrameOptions:         "SAMEORIGIN",
-			ContentSecurityPolicy: "default-src 'self'",
-		}))
-
 		// if redirect is set, forward port 80 to port 443
-		if cfg.Listener.Tls_autoredirect {
+		// http-01 challenges are answered on port 80, which then redirects by itself
+		if cfg.Listener.Tls_autoredirect && !acmeHTTPChallenge(cfg.Listener) {
 			e.Pre(middleware.HTTPSRedirect())
-			go func(c *echo.Echo){
-				e.Logger.Fatal(e.Start(":80"))
-			}(e)
+			redirect, err := listen("redirect", ":80")
+			if err != nil {
+				log.Fatalln(err)
+			}
+			e.Listener = redirect
+			go serve(func() error {
+				return e.Start(":80")
+			})
 		}
 
 		// if cert file and key file are not provided, try using let's encrypt
-		if cfg.Listener.Tls_cert_file == "" && cfg.Listener.Tls_key_file == "" {
-			e.AutoTLSManager.Cache = autocert.DirCache("/var/www/.cache")
-			e.AutoTLSManager.HostPolicy = autocert.HostWhitelist(cfg.Listener.Address)
+		if acmeListener(cfg.Listener) {
 			e.Use(middleware.HTTPSRedirectWithConfig(middleware.RedirectConfig{
 				Code: 301,
 			}))
@@ -133,63 +247,437 @@ func main() {
 	}
 
 	// static routing of webpack'd folder
-	e.Static("/", "public")
+	serveAssets(e, assetsDir)
+
+	registerRoutes(e)
+
+	// servers to drain when a new process takes over
+	servers := []*http.Server{e.Server, e.TLSServer}
+
+	// replicas forward state mutations to the coordinator, which listens for them over mutual TLS
+	if cfg.Coordinator != nil {
+		tlsConfig, err := handlers.CoordinatorTLSConfig(
+			cfg.Coordinator.Tls_cert_file,
+			cfg.Coordinator.Tls_key_file,
+			cfg.Coordinator.Tls_ca_file,
+			cfg.Coordinator.Listen != "",
+		)
+		if err != nil {
+			log.Fatalln("[ERROR]: Could not load coordinator TLS config:", err)
+		}
+		if cfg.Coordinator.Address != "" {
+			handlers.SetCoordinator(cfg.Coordinator.Address, tlsConfig)
+		} else {
+			l, err := listen("coordinator", cfg.Coordinator.Listen)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			coordinator := limitServer(&http.Server{
+				Handler:   handlers.CoordinatorHandler(e),
+				TLSConfig: tlsConfig,
+			}, cfg.Listener)
+			servers = append(servers, coordinator)
+			go serve(func() error {
+				return coordinator.Serve(tls.NewListener(l, tlsConfig))
+			})
+		}
+	}
+
+	// metrics are served over plain http without authentication, so only on their own
+	// listener, which should not be public
+	if cfg.Listener.Metrics_address != "" {
+		l, err := listen("metrics", cfg.Listener.Metrics_address)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer := limitServer(&http.Server{Handler: mux}, cfg.Listener)
+		servers = append(servers, metricsServer)
+		go serve(func() error {
+			return metricsServer.Serve(l)
+		})
+	}
+
+	// serving both static folder and API
+	// listeners are opened here rather than by echo, so they can be handed over on upgrade
+	if (cfg.Listener.Tls_disable) {
+		// launch http-only listener
+		l, err := listen("listener", cfg.Listener.Address)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := chmodSocket(cfg.Listener.Address, cfg.Listener.Socket_mode); err != nil {
+			log.Fatalln(err)
+		}
+		e.Listener = l
+		go serve(func() error {
+			return e.Start(cfg.Listener.Address)
+		})
+	} else {
+		address := cfg.Listener.Address
+		tlsConfig := &tls.Config{}
+		if acmeListener(cfg.Listener) {
+			// if https is enabled, but no cert provided, try let's encrypt
+			address = ":443"
+			getCertificate, challenges := acmeCertificates(cfg.Listener, &e.AutoTLSManager)
+			tlsConfig.GetCertificate = getCertificate
+			if challenges != nil {
+				l, err := listen("acme", ":80")
+				if err != nil {
+					log.Fatalln(err)
+				}
+				acmeServer := limitServer(&http.Server{Handler: challenges}, cfg.Listener)
+				servers = append(servers, acmeServer)
+				go serve(func() error {
+					return acmeServer.Serve(l)
+				})
+			}
+		} else if cfg.Listener.Tls_pki_path != "" {
+			// a certificate issued by vault, and renewed before it expires
+			pkiCerts, err := startPKICertificate(cfg.Listener)
+			if err != nil {
+				log.Fatalln("[ERROR]: Could not issue a certificate from vault:", err)
+			}
+			tlsConfig.GetCertificate = pkiCerts.GetCertificate
+		} else {
+			// launch listener in https, with a certificate that SIGHUP reloads
+			listenerCerts, err = newCertReloader(cfg.Listener.Tls_cert_file, cfg.Listener.Tls_key_file)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			tlsConfig.GetCertificate = listenerCerts.GetCertificate
+		}
+		tlsConfig.NextProtos = []string{"http/1.1"}
+		if cfg.Listener.Http2 {
+			tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+		} else {
+			// a non-nil map stops net/http from adding HTTP/2 support by itself
+			e.TLSServer.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+
+		l, err := listen("listener", address)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := chmodSocket(address, cfg.Listener.Socket_mode); err != nil {
+			log.Fatalln(err)
+		}
+		e.TLSServer.TLSConfig = tlsConfig
+		e.TLSListener = tls.NewListener(l, tlsConfig)
+		go serve(func() error {
+			return e.StartServer(e.TLSServer)
+		})
+	}
+
+	signalReady()
+	if err := writePIDFile(pidFile); err != nil {
+		log.Println("[ERROR]: Could not write pid file:", err)
+	}
+
+	drainOnShutdown(servers, cfg.Listener.Shutdown_timeout)
+	go watchReloads()
+
+	// the dev vault instance belongs to this process, so it can't be handed over
+	if devMode {
+		select {}
+	}
+	watchUpgrades(servers...)
+}
+
+// the api routes, and the probes for orchestrators
+func registerRoutes(e *echo.Echo) {
+	// probes for orchestrators such as kubernetes
+	e.GET("/healthz", handlers.Healthz())
+	e.GET("/readyz", handlers.Readyz())
 
 	// API routing
 	e.GET("/api/health", handlers.VaultHealth())
+	e.GET("/api/compat", handlers.GetCompat())
+	e.GET("/api/toggles", handlers.GetToggles())
+	e.GET("/api/role", handlers.GetSessionRole())
+	e.GET("/api/clusters", handlers.GetClusters())
+	e.GET("/api/sys/status", handlers.GetClusterStatus())
+	e.GET("/api/sys/seal-status", handlers.GetSealStatus())
+	e.POST("/api/sys/unseal", handlers.Unseal())
+	e.GET("/api/sys/key-status", handlers.GetKeyStatus())
+	e.POST("/api/sys/rotate", handlers.RotateKey())
+	e.GET("/api/sys/license", handlers.GetLicense())
+	e.GET("/api/sys/metrics", handlers.GetVaultMetrics())
+	e.GET("/api/sys/rekey", handlers.GetRekeyStatus())
+	e.POST("/api/sys/rekey", handlers.StartRekey())
+	e.POST("/api/sys/rekey/update", handlers.SubmitRekey())
+	e.DELETE("/api/sys/rekey", handlers.CancelRekey())
+	e.GET("/api/sys/generate-root", handlers.GetGenerateRootStatus())
+	e.POST("/api/sys/generate-root", handlers.StartGenerateRoot())
+	e.POST("/api/sys/generate-root/update", handlers.SubmitGenerateRoot())
+	e.DELETE("/api/sys/generate-root", handlers.CancelGenerateRoot())
 
 	e.GET("/api/login/csrf", handlers.FetchCSRF())
 	e.POST("/api/login", handlers.Login())
 	e.POST("/api/login/renew-self", handlers.RenewSelf())
+	e.POST("/api/login/namespace", handlers.SetSessionNamespace())
+	e.POST("/api/logout", handlers.Logout())
 
 	e.GET("/api/users", handlers.GetUsers())
 	e.GET("/api/users/csrf", handlers.FetchCSRF())
 	e.GET("/api/tokencount", handlers.GetTokenCount())
 	e.GET("/api/users/role", handlers.GetRole())
+	e.POST("/api/users/role", handlers.WriteRole())
 	e.GET("/api/users/listroles", handlers.ListRoles())
 	e.POST("/api/users/revoke", handlers.DeleteUser())
 	e.POST("/api/users/create", handlers.CreateUser())
+	e.POST("/api/users/exchange", handlers.ExchangeToken())
+
+	e.GET("/api/preferences", handlers.GetPreferences())
+	e.POST("/api/preferences", handlers.SetPreferences())
+	e.DELETE("/api/preferences", handlers.DeletePreferences())
 
 	e.GET("/api/policy", handlers.GetPolicy())
 	e.DELETE("/api/policy", handlers.DeletePolicy())
+	e.GET("/api/policy/summary", handlers.GetPolicySummary())
+	e.POST("/api/policy/summary", handlers.GetPolicySummary())
+	e.GET("/api/policy/usage", handlers.GetPolicyUsage())
+	e.POST("/api/policy/validate", handlers.ValidatePolicy())
+	e.POST("/api/policy/simulate", handlers.SimulatePolicy())
+	e.GET("/api/capabilities", handlers.GetCapabilities())
 
 	e.GET("/api/policy/request", handlers.GetPolicyRequest())
 	e.POST("/api/policy/request", handlers.AddPolicyRequest())
+	e.GET("/api/policy/templates", handlers.GetPolicyTemplates())
+	e.POST("/api/policy/from-template", handlers.AddPolicyRequestFromTemplate())
+	e.GET("/api/policy/request/expired", handlers.GetExpiredPolicyRequests())
 	e.POST("/api/policy/request/update", handlers.UpdatePolicyRequest())
+	e.POST("/api/policy/request/:id/approve", handlers.ApprovePolicyRequest())
 	e.DELETE("/api/policy/request/:id", handlers.DeletePolicyRequest())
+	e.GET("/api/policy/request/:id/attachments", handlers.GetAttachments())
+	e.POST("/api/policy/request/:id/attachments", handlers.AddAttachment())
+	e.GET("/api/policy/request/:id/attachments/:sha", handlers.DownloadAttachment())
+	e.GET("/api/policy/request/:id/history", handlers.GetRequestHistory())
+	e.POST("/api/policy/request/:id/comments", handlers.AddRequestComment())
+
+	e.GET("/api/namespaces", handlers.GetNamespaces())
+	e.POST("/api/namespaces", handlers.CreateNamespace())
+
+	e.GET("/api/controlgroup", handlers.GetControlGroupRequests())
+	e.POST("/api/controlgroup/:id/authorize", handlers.AuthorizeControlGroup())
+	e.POST("/api/controlgroup/:id/collect", handlers.CollectControlGroup())
+
+	e.GET("/api/sentinel/:type", handlers.GetSentinelPolicies())
+	e.GET("/api/sentinel/:type/:name", handlers.GetSentinelPolicies())
+	e.POST("/api/sentinel/:type/:name", handlers.PutSentinelPolicy())
+	e.DELETE("/api/sentinel/:type/:name", handlers.DeleteSentinelPolicy())
 
 	e.GET("/api/transit", handlers.TransitInfo())
 	e.POST("/api/transit/encrypt", handlers.EncryptString())
 	e.POST("/api/transit/decrypt", handlers.DecryptString())
+	e.GET("/api/transit/keys", handlers.GetTransitKeys())
+	e.POST("/api/transit/keys/:name", handlers.CreateTransitKey())
+	e.DELETE("/api/transit/keys/:name", handlers.DeleteTransitKey())
+	e.POST("/api/transit/keys/:name/rotate", handlers.RotateTransitKey())
+	e.POST("/api/transit/keys/:name/config", handlers.ConfigTransitKey())
+	e.POST("/api/transit/keys/:name/trim", handlers.TrimTransitKey())
+	e.POST("/api/transit/sign/:key", handlers.SignTransit())
+	e.POST("/api/transit/verify/:key", handlers.VerifyTransitSignature())
+	e.POST("/api/transit/hmac/:key", handlers.HMACTransit())
+	e.POST("/api/transit/verify-hmac/:key", handlers.VerifyTransitHMAC())
+	e.POST("/api/transit/datakey", handlers.GenerateTransitDataKey())
+	e.POST("/api/transit/encrypt-file", handlers.EncryptFile())
+	e.POST("/api/transit/decrypt-file", handlers.DecryptFile())
 
 	e.GET("/api/mounts", handlers.GetMounts())
 	e.GET("/api/mounts/:mountname", handlers.GetMount())
+	e.POST("/api/mounts", handlers.EnableMount())
 	e.POST("/api/mounts/:mountname", handlers.ConfigMount())
+	e.DELETE("/api/mounts/:mountname", handlers.DisableMount())
+	e.POST("/api/mounts/:mountname/move", handlers.MoveMount())
+
+	e.GET("/api/auth", handlers.GetAuthMounts())
+	e.GET("/api/auth/:path", handlers.GetAuthMount())
+	e.POST("/api/auth", handlers.EnableAuthMount())
+	e.POST("/api/auth/:path", handlers.TuneAuthMount())
+	e.DELETE("/api/auth/:path", handlers.DisableAuthMount())
+
+	e.GET("/api/audit", handlers.GetAuditDevices())
+	e.POST("/api/audit", handlers.EnableAuditDevice())
+	e.DELETE("/api/audit/:path", handlers.DisableAuditDevice())
+	e.POST("/api/audit/:path/hash", handlers.AuditHash())
+
+	e.GET("/api/replication", handlers.GetReplicationStatus())
+	e.POST("/api/replication/:kind/secondary-token", handlers.GenerateSecondaryToken())
+
+	e.GET("/api/raft", handlers.GetRaftStatus())
+	e.GET("/api/raft/snapshot", handlers.DownloadRaftSnapshot())
+	e.POST("/api/raft/snapshot", handlers.RestoreRaftSnapshot())
+	e.GET("/api/mount-requests", handlers.GetMountRequests())
+	e.POST("/api/mount-requests", handlers.AddMountRequest())
+	e.GET("/api/mount-requests/:id", handlers.GetMountRequest())
+	e.POST("/api/mount-requests/:id", handlers.ApproveMountRequest())
+	e.DELETE("/api/mount-requests/:id", handlers.DeleteMountRequest())
+	e.GET("/api/identity-requests", handlers.GetIdentityRequests())
+	e.POST("/api/identity-requests", handlers.AddIdentityRequest())
+	e.GET("/api/identity-requests/:id", handlers.GetIdentityRequest())
+	e.POST("/api/identity-requests/:id", handlers.ApproveIdentityRequest())
+	e.POST("/api/identity-requests/:id/collect", handlers.CollectIdentityRequest())
+	e.DELETE("/api/identity-requests/:id", handlers.DeleteIdentityRequest())
 
 	e.GET("/api/secrets", handlers.GetSecrets())
 	e.POST("/api/secrets", handlers.PostSecrets())
 	e.DELETE("/api/secrets", handlers.DeleteSecrets())
+	e.POST("/api/secrets/copy", handlers.CopySecrets())
+	e.POST("/api/secrets/move", handlers.MoveSecrets())
+	e.POST("/api/secrets/approval", handlers.RequestRevealApproval())
+	e.GET("/api/secrets/approval/:id", handlers.GetRevealApproval())
+	e.POST("/api/secrets/approval/:id", handlers.ApproveReveal())
+	e.GET("/api/secrets/requests", handlers.GetSecretRequests())
+	e.POST("/api/secrets/requests", handlers.AddSecretRequest())
+	e.GET("/api/secrets/requests/:id", handlers.GetSecretRequest())
+	e.POST("/api/secrets/requests/:id", handlers.ApproveSecretRequest())
+	e.DELETE("/api/secrets/requests/:id", handlers.DeleteSecretRequest())
+	e.POST("/api/secrets/export", handlers.ExportSecrets())
+	e.POST("/api/secrets/import", handlers.ImportSecrets())
+
+	e.GET("/api/database/connections", handlers.GetDatabaseConnections())
+	e.GET("/api/database/roles", handlers.GetDatabaseRoles())
+	e.POST("/api/database/creds/:role", handlers.GenerateDatabaseCredentials())
+
+	e.GET("/api/pki/roles", handlers.GetPKIRoles())
+	e.POST("/api/pki/issue/:role", handlers.IssuePKICert())
+	e.GET("/api/pki/certs", handlers.GetPKICerts())
+	e.POST("/api/pki/revoke", handlers.RevokePKICert())
+	e.GET("/api/pki/ca", handlers.GetPKICA())
+	e.GET("/api/pki/crl", handlers.GetPKICRL())
+	e.POST("/api/pki/crl/rotate", handlers.RotatePKICRL())
+	e.POST("/api/pki/tidy", handlers.TidyPKI())
+	e.GET("/api/pki/urls", handlers.GetPKIURLs())
+	e.POST("/api/pki/urls", handlers.ConfigPKIURLs())
+
+	e.GET("/api/ssh/roles", handlers.GetSSHRoles())
+	e.GET("/api/ssh/ca", handlers.GetSSHCAPublicKey())
+	e.POST("/api/ssh/sign/:role", handlers.SignSSHKey())
+	e.POST("/api/ssh/creds/:role", handlers.GenerateSSHOTP())
+
+	e.GET("/api/aws/roles", handlers.GetAWSRoles())
+	e.POST("/api/aws/creds/:role", handlers.GenerateAWSCredentials())
+
+	e.GET("/api/gcp/rolesets", handlers.GetGCPRolesets())
+	e.POST("/api/gcp/creds/:roleset", handlers.GenerateGCPCredentials())
+
+	e.GET("/api/azure/roles", handlers.GetAzureRoles())
+	e.POST("/api/azure/creds/:role", handlers.GenerateAzureCredentials())
+
+	e.GET("/api/consul/roles", handlers.GetConsulRoles())
+	e.POST("/api/consul/creds/:role", handlers.GenerateConsulCredentials())
+
+	e.GET("/api/nomad/roles", handlers.GetNomadRoles())
+	e.POST("/api/nomad/creds/:role", handlers.GenerateNomadCredentials())
+
+	e.GET("/api/rabbitmq/roles", handlers.GetRabbitMQRoles())
+	e.POST("/api/rabbitmq/creds/:role", handlers.GenerateRabbitMQCredentials())
+
+	e.GET("/api/totp/keys", handlers.GetTOTPKeys())
+	e.POST("/api/totp/keys/:name", handlers.CreateTOTPKey())
+	e.DELETE("/api/totp/keys/:name", handlers.DeleteTOTPKey())
+	e.GET("/api/totp/code/:name", handlers.GenerateTOTPCode())
+	e.POST("/api/totp/code/:name", handlers.ValidateTOTPCode())
+
+	e.GET("/api/leases", handlers.GetLeases())
+	e.POST("/api/leases/renew", handlers.RenewLease())
+	e.POST("/api/leases/revoke", handlers.RevokeLease())
+	e.POST("/api/leases/revoke-prefix", handlers.RevokeLeasePrefix())
+
+	e.GET("/api/custom", handlers.GetCustomRequests())
+	e.POST("/api/custom/:name", handlers.RunCustomRequest())
+
+	e.GET("/api/engines", handlers.GetEngines())
+	e.GET("/api/engines/path", handlers.GetEnginePath())
+	e.POST("/api/engines/path", handlers.PostEnginePath())
+
+	e.GET("/api/cubbyhole", handlers.GetCubbyhole())
+	e.POST("/api/cubbyhole", handlers.PostCubbyhole())
+	e.DELETE("/api/cubbyhole", handlers.DeleteCubbyhole())
 
 	e.GET("/api/bulletins", handlers.GetBulletins())
+	e.POST("/api/bulletins/:name/ack", handlers.AcknowledgeBulletin())
+	e.GET("/api/bulletins/:name/acks", handlers.GetBulletinAcks())
+
+	e.GET("/api/maintenance/gc", handlers.GetOrphanedState())
+	e.POST("/api/maintenance/gc", handlers.DeleteOrphanedState())
+	e.GET("/api/maintenance/incident", handlers.GetIncident())
+	e.POST("/api/maintenance/incident", handlers.StartIncident())
+	e.DELETE("/api/maintenance/incident/:id", handlers.EndIncident())
+
+	e.GET("/api/settings", handlers.GetSettings())
+	e.PUT("/api/settings", handlers.UpdateSettings())
 
 	e.GET("/api/wrapping", handlers.FetchCSRF())
 	e.POST("/api/wrapping/wrap", handlers.WrapHandler())
 	e.POST("/api/wrapping/unwrap", handlers.UnwrapHandler())
+	e.POST("/api/wrapping/lookup", handlers.LookupWrappingToken())
+	e.POST("/api/wrapping/rewrap", handlers.RewrapHandler())
+}
 
-	// serving both static folder and API
-	if (cfg.Listener.Tls_disable) {
-		// launch http-only listener
-		e.Logger.Fatal(e.Start(cfg.Listener.Address))
-	} else if cfg.Listener.Tls_cert_file == "" && cfg.Listener.Tls_key_file == "" {
-		// if https is enabled, but no cert provided, try let's encrypt
-		e.Logger.Fatal(e.StartAutoTLS(":443"))
-	} else {
-		// launch listener in https
-		e.Logger.Fatal(e.StartTLS(
-			cfg.Listener.Address,
-			cfg.Listener.Tls_cert_file,
-			cfg.Listener.Tls_key_file,
-		))
+// repeatable -set flags, each overriding one config value
+type overrideFlags []config.Override
+
+func (o *overrideFlags) String() string {
+	return ""
+}
+
+func (o *overrideFlags) Set(raw string) error {
+	override, err := config.ParseOverride(raw)
+	if err != nil {
+		return err
+	}
+	*o = append(*o, override)
+	return nil
+}
+
+// GOLDFISH_* environment variables override the config file, and flags override both
+func configOverrides(sets overrideFlags) []config.Override {
+	return append(config.EnvOverrides(os.Environ()), sets...)
+}
+
+// logs in to vault for goldfish's server token, with the configured auth method
+func startGoldfish(v *config.VaultConfig) error {
+	if v.Auth_method != "approle" && wrappingToken != "" {
+		return errors.New("-token is only used with auth_method \"approle\"")
+	}
+	switch v.Auth_method {
+	case "kubernetes":
+		return vault.StartGoldfishKubernetes(v.Kubernetes_login, v.Kubernetes_role, v.Kubernetes_jwt_file)
+	case "aws":
+		return vault.StartGoldfishAWS(v.Aws_login, v.Aws_role, v.Aws_header_value)
+	case "token_file":
+		return vault.StartGoldfishTokenFile(v.Token_file)
+	}
+	return vault.StartGoldfishWrapper(wrappingToken, v.Approle_login, v.Approle_id, v.Approle_relogin)
+}
+
+// applies the listener's timeouts and header limit to a server goldfish runs
+func limitServer(server *http.Server, listener *config.ListenerConfig) *http.Server {
+	server.ReadHeaderTimeout = listener.Read_header_timeout
+	server.ReadTimeout = listener.Read_timeout
+	server.WriteTimeout = listener.Write_timeout
+	server.IdleTimeout = listener.Idle_timeout
+	server.MaxHeaderBytes = listener.Max_header_bytes
+	return server
+}
+
+// the listener's network lists, which were validated when the config was parsed
+func networkRules(listener *config.ListenerConfig) handlers.NetworkRules {
+	parse := func(raw string) []*net.IPNet {
+		networks, err := config.ParseNetworks(raw)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return networks
+	}
+	return handlers.NetworkRules{
+		Allowed:      parse(listener.Allowed_networks),
+		Denied:       parse(listener.Denied_networks),
+		AdminAllowed: parse(listener.Admin_allowed_networks),
+		AdminDenied:  parse(listener.Admin_denied_networks),
 	}
 }
 
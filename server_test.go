@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/caiyeon/goldfish/vault"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegisteredRoutes(t *testing.T) {
+	Convey("Every route toggles and exemptions name should be registered", t, func(c C) {
+		e := echo.New()
+		registerRoutes(e)
+		registered := map[string]bool{}
+		for _, route := range e.Routes() {
+			registered[route.Method+" "+route.Path] = true
+		}
+
+		for _, toggle := range vault.Toggles() {
+			for _, route := range toggle.Routes {
+				c.So(registered[route], ShouldBeTrue)
+			}
+		}
+		for _, route := range vault.ExemptRoutes() {
+			c.So(registered[route], ShouldBeTrue)
+		}
+	})
+}
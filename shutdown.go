@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/caiyeon/goldfish/vault"
+)
+
+var (
+	shutdownLock    = sync.Mutex{}
+	shutdownServers = []*http.Server{}
+	shutdownTimeout time.Duration
+)
+
+// the servers to drain on shutdown, and how long in-flight requests are given to finish
+func drainOnShutdown(servers []*http.Server, timeout time.Duration) {
+	shutdownLock.Lock()
+	defer shutdownLock.Unlock()
+	shutdownServers = servers
+	shutdownTimeout = timeout
+}
+
+// a reloaded config may change the timeout, but not the servers
+func setShutdownTimeout(timeout time.Duration) {
+	shutdownLock.Lock()
+	defer shutdownLock.Unlock()
+	shutdownTimeout = timeout
+}
+
+// on SIGINT or SIGTERM, stops accepting connections, lets in-flight requests finish, revokes
+// goldfish's own tokens and exits. A second signal exits at once
+func watchShutdown() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	log.Println("[INFO ]: Goldfish shutdown triggered, draining in-flight requests")
+	go func() {
+		<-signals
+		log.Println("[INFO ]: Shutdown forced")
+		os.Exit(1)
+	}()
+
+	shutdownLock.Lock()
+	servers, timeout := shutdownServers, shutdownTimeout
+	shutdownLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	wg := sync.WaitGroup{}
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				log.Println("[WARN ]: Requests were still in flight after", timeout.String()+":", err)
+			}
+		}(server)
+	}
+	wg.Wait()
+	cancel()
+
+	// only once no request can use them any more, and only if goldfish got as far as logging in
+	if vault.ServerToken() != "" {
+		if err := vault.RevokeServerTokens(); err != nil {
+			log.Println("[ERROR]: Could not revoke goldfish's tokens:", err)
+		}
+	}
+
+	// if vault dev core is active, relay shutdown signal
+	if devVaultCh != nil {
+		close(devVaultCh)
+		time.Sleep(time.Second)
+	}
+	os.Exit(0)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -19,6 +20,7 @@ func PostMessageWebhook(channel, main_text, attachment_text, webhook string) (er
 			"attachments": []interface{} {
 				map[string]interface{}{
 					"mrkdwn_in": []string{"text"},
+					"fallback": plainText(main_text + "\n" + attachment_text),
 					"text": attachment_text,
 		    		"footer": "<https://github.com/Caiyeon/goldfish|Goldfish Vault UI>",
 		            "footer_icon": icon_url,
@@ -32,3 +34,8 @@ func PostMessageWebhook(channel, main_text, attachment_text, webhook string) (er
 	}
 	return
 }
+
+// strips slack's markdown so the text reads cleanly in notifications and screen readers
+func plainText(s string) string {
+	return strings.NewReplacer("*", "", "~", "", "`", "").Replace(s)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/caiyeon/goldfish/config"
+)
+
+// opens a listener on addr, which is either a tcp address or unix:///path/to/socket
+func listenAddress(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, config.UnixSocketPrefix) {
+		return net.Listen("tcp", addr)
+	}
+	path := strings.TrimPrefix(addr, config.UnixSocketPrefix)
+
+	// a socket left behind by a previous process would make listening fail
+	// anything other than a socket at the path is left alone, and reported by net.Listen
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// the socket file must outlive the listener, for a process taking over on upgrade.
+	// it is removed at the next start instead
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	return l, nil
+}
+
+// sets the permissions of the listener's socket file, if it is one and a mode is configured
+func chmodSocket(addr string, mode os.FileMode) error {
+	if mode == 0 || !strings.HasPrefix(addr, config.UnixSocketPrefix) {
+		return nil
+	}
+	return os.Chmod(strings.TrimPrefix(addr, config.UnixSocketPrefix), mode)
+}
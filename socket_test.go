@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caiyeon/goldfish/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnixSocketListener(t *testing.T) {
+	Convey("A unix socket listener", t, func(c C) {
+		dir, err := ioutil.TempDir("", "goldfish-socket")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "goldfish.sock")
+		addr := config.UnixSocketPrefix + path
+
+		l, err := listenAddress(addr)
+		c.So(err, ShouldBeNil)
+		c.So(l.Addr().Network(), ShouldEqual, "unix")
+
+		c.Convey("Should leave its socket file behind for a process taking over", func(c C) {
+			c.So(l.Close(), ShouldBeNil)
+			info, err := os.Lstat(path)
+			c.So(err, ShouldBeNil)
+			c.So(info.Mode()&os.ModeSocket, ShouldNotEqual, 0)
+
+			c.Convey("Which the next start replaces", func(c C) {
+				l, err := listenAddress(addr)
+				c.So(err, ShouldBeNil)
+				c.So(l.Close(), ShouldBeNil)
+			})
+		})
+
+		c.Convey("Should get the configured permissions", func(c C) {
+			defer l.Close()
+			c.So(chmodSocket(addr, 0600), ShouldBeNil)
+			info, err := os.Stat(path)
+			c.So(err, ShouldBeNil)
+			c.So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+
+			// no mode leaves the permissions alone
+			c.So(chmodSocket(addr, 0), ShouldBeNil)
+			info, err = os.Stat(path)
+			c.So(err, ShouldBeNil)
+			c.So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+		})
+	})
+
+	Convey("Files other than sockets should not be removed to listen", t, func(c C) {
+		dir, err := ioutil.TempDir("", "goldfish-socket")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "goldfish.sock")
+		c.So(ioutil.WriteFile(path, []byte("not a socket"), 0600), ShouldBeNil)
+
+		_, err = listenAddress(config.UnixSocketPrefix + path)
+		c.So(err, ShouldNotBeNil)
+		raw, err := ioutil.ReadFile(path)
+		c.So(err, ShouldBeNil)
+		c.So(string(raw), ShouldEqual, "not a socket")
+	})
+
+	Convey("Tcp addresses should be listened on as before, and never chmodded", t, func(c C) {
+		l, err := listenAddress("127.0.0.1:0")
+		c.So(err, ShouldBeNil)
+		defer l.Close()
+		_, ok := l.(*net.TCPListener)
+		c.So(ok, ShouldBeTrue)
+		c.So(chmodSocket("127.0.0.1:0", 0600), ShouldBeNil)
+	})
+}
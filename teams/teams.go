@@ -0,0 +1,41 @@
+package teams
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// goldfish's accent, used for the bar along the side of each card
+var themeColor = "F7931E"
+
+// posts a message card to a Microsoft Teams incoming webhook. Text may use markdown
+func PostMessageWebhook(title, text, webhook string) error {
+	payload, err := json.Marshal(
+		map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    title,
+			"themeColor": themeColor,
+			"title":      title,
+			"text":       text,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New("Teams responded with " + resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// spans are sent in batches of at most this many, or every exportInterval
+	exportBatchSize = 256
+	exportInterval  = 5 * time.Second
+	// spans beyond this many waiting for export are dropped, rather than slowing requests
+	exportQueueSize = 4096
+)
+
+var (
+	configLock  = sync.RWMutex{}
+	endpoint    = ""
+	serviceName = "goldfish"
+	sampleRatio = 1.0
+
+	queue  = make(chan *Span, exportQueueSize)
+	client = &http.Client{Timeout: 10 * time.Second}
+)
+
+// starts exporting spans to an OTLP/HTTP endpoint, e.g. http://collector:4318/v1/traces
+// ratio is the share of new traces that are recorded, from 0 to 1
+func Configure(otlpEndpoint, service string, ratio float64) error {
+	if err := Validate(otlpEndpoint, ratio); err != nil {
+		return err
+	}
+	configLock.Lock()
+	endpoint = otlpEndpoint
+	if service != "" {
+		serviceName = service
+	}
+	sampleRatio = ratio
+	configLock.Unlock()
+
+	go exportEvery(exportInterval)
+	return nil
+}
+
+// checks an endpoint and sample ratio, as given in the config file
+func Validate(otlpEndpoint string, ratio float64) error {
+	if u, err := url.Parse(otlpEndpoint); err != nil || !(u.Scheme == "http" || u.Scheme == "https") {
+		return errors.New("endpoint must be an http:// or https:// url")
+	}
+	if ratio < 0 || ratio > 1 {
+		return errors.New("sample_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// true once Configure has been called, so callers can skip recording spans nobody exports
+func Enabled() bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return endpoint != ""
+}
+
+func currentSampleRatio() float64 {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return sampleRatio
+}
+
+func export(s *Span) {
+	select {
+	case queue <- s:
+	default:
+	}
+}
+
+func exportEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	batch := []*Span{}
+	for {
+		select {
+		case s := <-queue:
+			batch = append(batch, s)
+			if len(batch) < exportBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := send(batch); err != nil {
+			log.Println("[ERROR]: Could not export", len(batch), "spans:", err.Error())
+		}
+		batch = []*Span{}
+	}
+}
+
+func send(spans []*Span) error {
+	configLock.RLock()
+	target, service := endpoint, serviceName
+	configLock.RUnlock()
+
+	raw, err := json.Marshal(encode(service, spans))
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(target, "application/json", bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// the OTLP json encoding of an ExportTraceServiceRequest
+func encode(service string, spans []*Span) map[string]interface{} {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		encoded = append(encoded, encodeSpan(s))
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": encodeAttributes(map[string]interface{}{"service.name": service}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "goldfish"},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+func encodeSpan(s *Span) map[string]interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	span := map[string]interface{}{
+		"traceId":           hex.EncodeToString(s.TraceID[:]),
+		"spanId":            hex.EncodeToString(s.SpanID[:]),
+		"name":              s.Name,
+		"kind":              s.Kind,
+		"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+		"attributes":        encodeAttributes(s.attributes),
+		"status":            map[string]interface{}{"code": statusOK},
+	}
+	if s.ParentID != [8]byte{} {
+		span["parentSpanId"] = hex.EncodeToString(s.ParentID[:])
+	}
+	if s.err != "" {
+		span["status"] = map[string]interface{}{"code": statusError, "message": s.err}
+	}
+	return span
+}
+
+func encodeAttributes(attributes map[string]interface{}) []interface{} {
+	encoded := make([]interface{}, 0, len(attributes))
+	for key, value := range attributes {
+		var v map[string]interface{}
+		switch t := value.(type) {
+		case bool:
+			v = map[string]interface{}{"boolValue": t}
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(t)}
+		case int64:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(t, 10)}
+		case float64:
+			v = map[string]interface{}{"doubleValue": t}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(t)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": key, "value": v})
+	}
+	return encoded
+}
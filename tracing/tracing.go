@@ -0,0 +1,117 @@
+// Package tracing records spans of goldfish's requests and the vault calls they make, and
+// exports them to an OpenTelemetry collector over OTLP/HTTP with json encoding.
+// The OpenTelemetry SDK is not vendored, and goldfish needs little of it
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// what a span stands for, as OTLP numbers them
+const (
+	KindServer = 2
+	KindClient = 3
+)
+
+// OTLP status codes
+const (
+	statusOK    = 1
+	statusError = 2
+)
+
+// a timed operation, in a tree of operations sharing a trace ID
+type Span struct {
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte
+	Name     string
+	Kind     int
+	Start    time.Time
+	End      time.Time
+	// unsampled spans only pass their trace on, and are never exported
+	Sampled bool
+
+	lock       sync.Mutex
+	attributes map[string]interface{}
+	err        string
+}
+
+// W3C trace context, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// starts a span as the child of the trace in a traceparent header, or of a new trace
+func StartFromHeader(traceparent, name string, kind int) *Span {
+	span := &Span{Name: name, Kind: kind, Start: time.Now(), attributes: map[string]interface{}{}}
+	if m := traceparentPattern.FindStringSubmatch(traceparent); m != nil {
+		hex.Decode(span.TraceID[:], []byte(m[1]))
+		hex.Decode(span.ParentID[:], []byte(m[2]))
+		flags, _ := hex.DecodeString(m[3])
+		span.Sampled = flags[0]&1 == 1
+	}
+	if span.TraceID == [16]byte{} {
+		rand.Read(span.TraceID[:])
+		span.Sampled = sampled(span.TraceID)
+	}
+	rand.Read(span.SpanID[:])
+	return span
+}
+
+// starts a span within this one
+func (s *Span) Child(name string, kind int) *Span {
+	child := &Span{
+		TraceID:    s.TraceID,
+		ParentID:   s.SpanID,
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Sampled:    s.Sampled,
+		attributes: map[string]interface{}{},
+	}
+	rand.Read(child.SpanID[:])
+	return child
+}
+
+// the traceparent header that continues the trace from this span
+func (s *Span) Traceparent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(s.TraceID[:]) + "-" + hex.EncodeToString(s.SpanID[:]) + "-" + flags
+}
+
+// values may be strings, ints, floats or bools
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.attributes[key] = value
+}
+
+// marks the span as failed
+func (s *Span) SetError(message string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.err = message
+}
+
+// ends the span, queueing it for export if it is sampled
+func (s *Span) Finish() {
+	s.End = time.Now()
+	if s.Sampled && Enabled() {
+		export(s)
+	}
+}
+
+// whether a new trace is recorded. Trace IDs are random, so their low bits decide
+func sampled(traceID [16]byte) bool {
+	ratio := currentSampleRatio()
+	if ratio >= 1 {
+		return true
+	}
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>11)/float64(1<<53) < ratio
+}
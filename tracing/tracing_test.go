@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTraceparent(t *testing.T) {
+	Convey("Spans should continue the trace of a traceparent header", t, func(c C) {
+		span := StartFromHeader("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "GET /api/users", KindServer)
+		c.So(span.Sampled, ShouldBeTrue)
+		traceparent := span.Traceparent()
+		c.So(traceparent[:36], ShouldEqual, "00-4bf92f3577b34da6a3ce929d0e0e4736-")
+		c.So(traceparent, ShouldNotContainSubstring, "00f067aa0ba902b7")
+		c.So(traceparent[len(traceparent)-3:], ShouldEqual, "-01")
+
+		child := span.Child("vault GET /v1/sys/health", KindClient)
+		c.So(child.TraceID, ShouldEqual, span.TraceID)
+		c.So(child.ParentID, ShouldEqual, span.SpanID)
+	})
+
+	Convey("Unsampled traces should stay unsampled", t, func(c C) {
+		span := StartFromHeader("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "GET /", KindServer)
+		c.So(span.Sampled, ShouldBeFalse)
+		c.So(span.Child("vault", KindClient).Sampled, ShouldBeFalse)
+	})
+
+	Convey("Malformed headers should start a new trace", t, func(c C) {
+		span := StartFromHeader("01-zz-00", "GET /", KindServer)
+		c.So(span.TraceID, ShouldNotEqual, [16]byte{})
+		c.So(span.ParentID, ShouldEqual, [8]byte{})
+	})
+}
+
+func TestSend(t *testing.T) {
+	Convey("Spans should be posted to the collector as OTLP json", t, func(c C) {
+		var body map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(raw, &body)
+		}))
+		defer server.Close()
+		configLock.Lock()
+		endpoint = server.URL
+		configLock.Unlock()
+
+		span := StartFromHeader("", "POST /api/policy", KindServer)
+		span.SetAttribute("http.status_code", 500)
+		span.SetError("Internal Server Error")
+		span.Finish()
+		c.So(send([]*Span{span}), ShouldBeNil)
+
+		resource := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+		scope := resource["scopeSpans"].([]interface{})[0].(map[string]interface{})
+		encoded := scope["spans"].([]interface{})[0].(map[string]interface{})
+		c.So(encoded["name"], ShouldEqual, "POST /api/policy")
+		c.So(encoded["traceId"], ShouldHaveLength, 32)
+		c.So(encoded["status"].(map[string]interface{})["code"], ShouldEqual, statusError)
+		attribute := encoded["attributes"].([]interface{})[0].(map[string]interface{})
+		c.So(attribute["value"], ShouldResemble, map[string]interface{}{"intValue": "500"})
+	})
+}
+
+func TestValidate(t *testing.T) {
+	Convey("Endpoints must be urls, and ratios between 0 and 1", t, func(c C) {
+		c.So(Validate("http://collector:4318/v1/traces", 0.5), ShouldBeNil)
+		c.So(Validate("collector:4318", 1), ShouldNotBeNil)
+		c.So(Validate("http://collector:4318/v1/traces", 2), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/caiyeon/goldfish/handlers"
+	"github.com/caiyeon/goldfish/vault"
+)
+
+// Zero-downtime upgrades: on SIGUSR2, goldfish starts the binary at its own path and hands
+// it the listening sockets, its vault token and its session keys. Once the new process is
+// serving, the old one finishes its in-flight requests and exits. Sessions survive, but
+// in-memory state such as an active incident or cached token lookups starts afresh
+
+// what an upgraded process needs to carry on where the previous one left off
+type handoverState struct {
+	VaultToken     string
+	ClusterTokens  map[string]string
+	CookieHashKey  []byte
+	CookieBlockKey []byte
+	CSRFKey        []byte
+}
+
+func currentHandoverState() handoverState {
+	hashKey, blockKey := handlers.SessionKeys()
+	return handoverState{
+		VaultToken:     vault.ServerToken(),
+		ClusterTokens:  vault.ClusterTokens(),
+		CookieHashKey:  hashKey,
+		CookieBlockKey: blockKey,
+		CSRFKey:        csrfKey,
+	}
+}
+
+// runs a server until it fails, or is shut down because a new process took over
+func serve(start func() error) {
+	if err := start(); err != nil && err != http.ErrServerClosed {
+		log.Fatalln(err)
+	}
+}
+
+// the pid changes with every upgrade, so service managers should track it through this file
+func writePIDFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
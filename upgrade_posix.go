@@ -0,0 +1,201 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// lists the names of inherited listeners, which start at fd 3 in this order
+	// the handover state pipe and the ready pipe follow them
+	envUpgradeListeners = "GOLDFISH_UPGRADE_LISTENERS"
+
+	upgradeReadyTimeout = time.Minute
+	upgradeDrainTimeout = 30 * time.Second
+)
+
+var (
+	listenersLock  = sync.Mutex{}
+	listenerNames  = []string{}
+	listenerFiles  = map[string]*os.File{}
+	inheritedFiles = map[string]*os.File{}
+
+	// written to once this process is serving, if it took over from another
+	readyPipe *os.File
+)
+
+// reads what the previous process handed over. Returns nil if this process was started normally
+func inheritHandover() (*handoverState, error) {
+	names := os.Getenv(envUpgradeListeners)
+	if names == "" {
+		return nil, nil
+	}
+	os.Unsetenv(envUpgradeListeners)
+
+	fd := uintptr(3)
+	for _, name := range strings.Split(names, ",") {
+		if name != "" {
+			inheritedFiles[name] = os.NewFile(fd, name)
+			fd++
+		}
+	}
+	statePipe := os.NewFile(fd, "handover state")
+	readyPipe = os.NewFile(fd+1, "handover ready")
+	defer statePipe.Close()
+
+	state := &handoverState{}
+	if err := json.NewDecoder(statePipe).Decode(state); err != nil {
+		return nil, errors.New("Could not read handover state: " + err.Error())
+	}
+	return state, nil
+}
+
+// listens on addr, unless the previous process handed over a listener of the same name
+func listen(name, addr string) (net.Listener, error) {
+	var l net.Listener
+	var err error
+	if f, ok := inheritedFiles[name]; ok {
+		delete(inheritedFiles, name)
+		l, err = net.FileListener(f)
+		f.Close()
+	} else {
+		l, err = listenAddress(addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// keep a copy of the socket to pass on at the next upgrade
+	var f *os.File
+	switch socket := l.(type) {
+	case *net.TCPListener:
+		f, err = socket.File()
+	case *net.UnixListener:
+		socket.SetUnlinkOnClose(false)
+		f, err = socket.File()
+	default:
+		return l, nil
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+	listenerNames = append(listenerNames, name)
+	listenerFiles[name] = f
+	return l, nil
+}
+
+// tells the previous process that this one is serving, so it can drain and exit
+func signalReady() {
+	if readyPipe == nil {
+		return
+	}
+	readyPipe.Write([]byte{1})
+	readyPipe.Close()
+	readyPipe = nil
+}
+
+// upgrades on SIGUSR2. Once a new process is serving, drains the servers and exits
+// A failed upgrade leaves this process serving as before
+func watchUpgrades(servers ...*http.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+	for range signals {
+		log.Println("[INFO ]: Upgrade requested, starting a new goldfish process")
+		if err := upgrade(currentHandoverState()); err != nil {
+			log.Println("[ERROR]: Upgrade failed, this process keeps serving:", err)
+			continue
+		}
+
+		log.Println("[INFO ]: New goldfish process is serving, draining this one")
+		ctx, cancel := context.WithTimeout(context.Background(), upgradeDrainTimeout)
+		for _, server := range servers {
+			server.Shutdown(ctx)
+		}
+		cancel()
+		os.Exit(0)
+	}
+}
+
+// starts the binary at this process's path with its listeners, and waits until it is serving
+func upgrade(state handoverState) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	stateR, stateW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer stateW.Close()
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		stateR.Close()
+		return err
+	}
+	defer readyR.Close()
+
+	listenersLock.Lock()
+	files := []*os.File{}
+	for _, name := range listenerNames {
+		files = append(files, listenerFiles[name])
+	}
+	names := strings.Join(listenerNames, ",")
+	listenersLock.Unlock()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), envUpgradeListeners+"="+names)
+	cmd.ExtraFiles = append(files, stateR, readyW)
+	err = cmd.Start()
+	// the new process holds its own copies of these
+	stateR.Close()
+	readyW.Close()
+	if err != nil {
+		return err
+	}
+
+	// secrets travel over a pipe, never through the environment or arguments
+	if err := json.NewEncoder(stateW).Encode(state); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	stateW.Close()
+
+	// the read fails if the new process exits before it is ready
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Wait()
+			return errors.New("New process exited before it was ready")
+		}
+		return cmd.Process.Release()
+	case <-time.After(upgradeReadyTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return errors.New("New process did not become ready in time")
+	}
+}
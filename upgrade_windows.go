@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net"
+	"net/http"
+)
+
+// sockets can't be handed over on windows, so upgrades are not supported there
+
+func inheritHandover() (*handoverState, error) {
+	return nil, nil
+}
+
+func listen(name, addr string) (net.Listener, error) {
+	return listenAddress(addr)
+}
+
+func signalReady() {}
+
+func watchUpgrades(servers ...*http.Server) {
+	select {}
+}
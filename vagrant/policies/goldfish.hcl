@@ -10,7 +10,22 @@ path "transit/decrypt/goldfish" {
 
 # [mandatory] [changable]
 # store goldfish run-time settings here
-# goldfish hot-reloads from this endpoint every minute
+# goldfish hot-reloads from this endpoint every minute, and timestamps each change
 path "secret/goldfish*" {
-  capabilities = ["read", "update"]
+  capabilities = ["create", "read", "update"]
+}
+
+# [mandatory]
+# requests, approvals and other state goldfish keeps in its token's cubbyhole
+path "cubbyhole/*" {
+  capabilities = ["create", "read", "update", "delete", "list"]
+}
+
+# [mandatory]
+# identity lookups, for approvals and roles by entity and group
+path "identity/entity/id/*" {
+  capabilities = ["read"]
+}
+path "identity/group/id/*" {
+  capabilities = ["read"]
 }
\ No newline at end of file
@@ -0,0 +1,141 @@
+package vault
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/hashicorp/go-uuid"
+	"github.com/mitchellh/mapstructure"
+)
+
+// how long a second person has to approve a reveal, and the requester to use it
+const revealApprovalTTL = 10 * time.Minute
+
+// a request to read a secret on a path that requires a second person's approval
+type RevealApproval struct {
+	ID            string
+	Path          string
+	Requester     string
+	RequesterHash string
+	Approver      string
+	ApproverHash  string
+	Created       string
+	Expires       string
+}
+
+// true if the path falls under a prefix designated by operators as two-person
+// kv-v2 paths, e.g. secret/data/foo, are matched by their kv-v1 form too
+func RequiresRevealApproval(path string) bool {
+	return matchesApprovalPaths(path, false)
+}
+
+// true if the path or anything beneath it requires approval
+// bulk operations on such paths would bypass the two-person rule, and must be refused
+func TouchesRevealApproval(path string) bool {
+	return matchesApprovalPaths(path, true)
+}
+
+func matchesApprovalPaths(path string, beneath bool) bool {
+	for _, raw := range strings.Split(GetConfig().ApprovalPaths, ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		for _, prefix := range unversionedPaths(raw) {
+			for _, candidate := range unversionedPaths(path) {
+				if strings.HasPrefix(candidate, prefix) || (beneath && strings.HasPrefix(prefix, candidate)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func CreateRevealApproval(path, requester, requesterHash string) (*RevealApproval, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	approval := &RevealApproval{
+		ID:            id,
+		Path:          path,
+		Requester:     requester,
+		RequesterHash: requesterHash,
+		Created:       now.Format(time.RFC3339),
+		Expires:       now.Add(revealApprovalTTL).Format(time.RFC3339),
+	}
+	if _, err := WriteToCubbyhole("reveal_approvals/"+id, structs.Map(approval)); err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// returns an unexpired approval request
+func GetRevealApproval(id string) (*RevealApproval, error) {
+	if id == "" || strings.Contains(id, "/") {
+		return nil, errors.New("Invalid approval ID")
+	}
+	resp, err := ReadFromCubbyhole("reveal_approvals/" + id)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Approval not found")
+	}
+
+	var approval RevealApproval
+	if err := mapstructure.Decode(resp.Data, &approval); err != nil {
+		return nil, errors.New("Approval appears to be malformed")
+	}
+	if approval.expired() {
+		DeleteFromCubbyhole("reveal_approvals/" + id)
+		return nil, errors.New("Approval has expired")
+	}
+	return &approval, nil
+}
+
+// records the approver. The approver must be a different identity than the requester
+func ApproveReveal(id, approver, approverHash string) (*RevealApproval, error) {
+	approval, err := GetRevealApproval(id)
+	if err != nil {
+		return nil, err
+	}
+	if approval.RequesterHash == approverHash {
+		return nil, errors.New("Requester cannot approve their own request")
+	}
+	if approval.ApproverHash != "" {
+		return nil, errors.New("Request has already been approved")
+	}
+	approval.Approver = approver
+	approval.ApproverHash = approverHash
+	if _, err := WriteToCubbyhole("reveal_approvals/"+id, structs.Map(approval)); err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// verifies the approval allows this requester to read this path, then deletes it so it is single use
+func ConsumeRevealApproval(id, path, requesterHash string) (*RevealApproval, error) {
+	approval, err := GetRevealApproval(id)
+	if err != nil {
+		return nil, err
+	}
+	if approval.Path != path || approval.RequesterHash != requesterHash {
+		return nil, errors.New("Approval does not match this request")
+	}
+	if approval.ApproverHash == "" {
+		return nil, errors.New("Request has not been approved yet")
+	}
+	if _, err := DeleteFromCubbyhole("reveal_approvals/" + id); err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+func (approval RevealApproval) expired() bool {
+	expires, err := time.Parse(time.RFC3339, approval.Expires)
+	return err != nil || time.Now().After(expires)
+}
@@ -0,0 +1,41 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRevealApprovalPaths(t *testing.T) {
+	Convey("With approval paths configured", t, func(c C) {
+		configLock.Lock()
+		previous := config
+		config.ApprovalPaths = "secret/prod/, kv/data/payments/"
+		configLock.Unlock()
+		defer func() {
+			configLock.Lock()
+			config = previous
+			configLock.Unlock()
+		}()
+
+		c.Convey("Paths under a prefix should require approval", func(c C) {
+			c.So(RequiresRevealApproval("secret/prod/db"), ShouldBeTrue)
+			c.So(RequiresRevealApproval("secret/dev/db"), ShouldBeFalse)
+		})
+
+		c.Convey("kv-v2 paths should be matched by their kv-v1 form", func(c C) {
+			c.So(RequiresRevealApproval("secret/data/prod/db"), ShouldBeTrue)
+			c.So(RequiresRevealApproval("secret/metadata/prod/db"), ShouldBeTrue)
+			c.So(RequiresRevealApproval("kv/payments/stripe"), ShouldBeTrue)
+			c.So(RequiresRevealApproval("kv/data/payments/stripe"), ShouldBeTrue)
+			c.So(RequiresRevealApproval("secret/data/dev/db"), ShouldBeFalse)
+		})
+
+		c.Convey("Parents of a prefix should be touched by it", func(c C) {
+			c.So(TouchesRevealApproval("secret/"), ShouldBeTrue)
+			c.So(TouchesRevealApproval("secret/data/"), ShouldBeTrue)
+			c.So(TouchesRevealApproval("kv/"), ShouldBeTrue)
+			c.So(TouchesRevealApproval("secret/dev/"), ShouldBeFalse)
+		})
+	})
+}
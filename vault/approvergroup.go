@@ -0,0 +1,207 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// people that may approve policy requests. Sessions belong to the group if they hold
+// any of its policies or are members of any of its identity groups. A request is
+// applied once every group has given its required number of approvals, which lets
+// vaults without unseal key holders (e.g. auto-unsealed ones) use change requests
+type ApproverGroup struct {
+	Name     string   `json:"-"`
+	Groups   []string `json:"groups"`
+	Policies []string `json:"policies"`
+	Required int      `json:"required"`
+}
+
+// one person's approval of a policy request
+type PolicyApproval struct {
+	Approver     string   `json:"approver"`
+	ApproverHash string   `json:"approver_hash"`
+	Groups       []string `json:"groups"`
+	Approved     string   `json:"approved"`
+}
+
+// how close a request is to satisfying one approver group
+type ApprovalProgress struct {
+	Group     string `json:"group"`
+	Approvals int    `json:"approvals"`
+	Required  int    `json:"required"`
+}
+
+// approvals are read, added to and written back, so two approvals must not interleave
+var policyApprovalsLock = sync.Mutex{}
+
+func parseApproverGroups(raw string) (map[string]*ApproverGroup, error) {
+	groups := map[string]*ApproverGroup{}
+	if raw == "" {
+		return groups, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &groups); err != nil {
+		return nil, errors.New("ApproverGroups must be a JSON object of group names to members")
+	}
+	for name, g := range groups {
+		if g == nil || (len(g.Groups) == 0 && len(g.Policies) == 0) {
+			return nil, errors.New("ApproverGroups: " + name + " must list the groups or policies of its members")
+		}
+		if g.Required <= 0 {
+			return nil, errors.New("ApproverGroups: " + name + " must require at least one approval")
+		}
+		g.Name = name
+	}
+	return groups, nil
+}
+
+// true if policy requests can be approved by approver groups, instead of only with unseal keys
+func ApproverGroupsEnabled() bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return len(approverGroups) > 0
+}
+
+// the names of the approver groups the session belongs to
+func (auth AuthInfo) ApproverGroupsOf() ([]string, error) {
+	self, err := auth.LookupSelf()
+	if err != nil {
+		return nil, err
+	}
+	return approverGroupsFor(self.Data)
+}
+
+func approverGroupsFor(self map[string]interface{}) ([]string, error) {
+	configLock.RLock()
+	approvers := approverGroups
+	configLock.RUnlock()
+
+	policies := map[string]bool{}
+	list, _ := self["policies"].([]interface{})
+	for _, p := range list {
+		if name, ok := p.(string); ok {
+			policies[name] = true
+		}
+	}
+
+	var groups map[string]bool
+	names := []string{}
+	for _, g := range approvers {
+		member := false
+		for _, p := range g.Policies {
+			member = member || policies[p]
+		}
+		if !member && len(g.Groups) > 0 {
+			if groups == nil {
+				entityID, _ := self["entity_id"].(string)
+				var err error
+				if groups, err = entityGroups(entityID); err != nil {
+					return nil, err
+				}
+			}
+			for _, name := range g.Groups {
+				member = member || groups[name]
+			}
+		}
+		if member {
+			names = append(names, g.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func ListPolicyApprovals(changeID string) ([]PolicyApproval, error) {
+	resp, err := ReadFromCubbyhole("request_approvals/" + changeID)
+	if err != nil {
+		return nil, err
+	}
+	approvals := []PolicyApproval{}
+	if resp == nil || resp.Data == nil {
+		return approvals, nil
+	}
+	raw, _ := resp.Data["approvals"].(string)
+	if err := json.Unmarshal([]byte(raw), &approvals); err != nil {
+		return nil, errors.New("Approvals appear to be malformed")
+	}
+	return approvals, nil
+}
+
+// records an approval of a policy request, returning all approvals so far
+// each person approves once, on behalf of every approver group they belong to
+func AddPolicyApproval(changeID string, approval PolicyApproval) ([]PolicyApproval, error) {
+	if len(approval.Groups) == 0 {
+		return nil, errors.New("You are not in any approver group")
+	}
+
+	policyApprovalsLock.Lock()
+	defer policyApprovalsLock.Unlock()
+
+	approvals, err := ListPolicyApprovals(changeID)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range approvals {
+		if existing.ApproverHash == approval.ApproverHash {
+			return nil, errors.New("You have already approved this request")
+		}
+	}
+	approval.Approved = time.Now().UTC().Format(time.RFC3339)
+	approvals = append(approvals, approval)
+
+	raw, err := json.Marshal(approvals)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := WriteToCubbyhole("request_approvals/"+changeID, map[string]interface{}{
+		"approvals": string(raw),
+	}); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+func DeletePolicyApprovals(changeID string) error {
+	policyApprovalsLock.Lock()
+	defer policyApprovalsLock.Unlock()
+	_, err := DeleteFromCubbyhole("request_approvals/" + changeID)
+	return err
+}
+
+// the progress of every configured approver group, sorted by name
+func PolicyApprovalProgress(approvals []PolicyApproval) []ApprovalProgress {
+	configLock.RLock()
+	approvers := approverGroups
+	configLock.RUnlock()
+
+	progress := []ApprovalProgress{}
+	for name, g := range approvers {
+		p := ApprovalProgress{Group: name, Required: g.Required}
+		for _, approval := range approvals {
+			for _, group := range approval.Groups {
+				if group == name {
+					p.Approvals++
+				}
+			}
+		}
+		progress = append(progress, p)
+	}
+	sort.Slice(progress, func(i, j int) bool {
+		return progress[i].Group < progress[j].Group
+	})
+	return progress
+}
+
+// true if every approver group has given its required approvals
+func PolicyApprovalsSatisfied(approvals []PolicyApproval) bool {
+	progress := PolicyApprovalProgress(approvals)
+	for _, p := range progress {
+		if p.Approvals < p.Required {
+			return false
+		}
+	}
+	return len(progress) > 0
+}
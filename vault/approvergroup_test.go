@@ -0,0 +1,67 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestApproverGroups(t *testing.T) {
+	Convey("ApproverGroups should be validated", t, func(c C) {
+		groups, err := parseApproverGroups(`{"security": {"policies": ["security"], "required": 2}}`)
+		c.So(err, ShouldBeNil)
+		c.So(groups["security"].Name, ShouldEqual, "security")
+
+		_, err = parseApproverGroups(`{"security": {"required": 2}}`)
+		c.So(err, ShouldNotBeNil)
+		_, err = parseApproverGroups(`{"security": {"policies": ["security"]}}`)
+		c.So(err, ShouldNotBeNil)
+		_, err = parseApproverGroups(`["security"]`)
+		c.So(err, ShouldNotBeNil)
+	})
+
+	Convey("With approver groups configured", t, func(c C) {
+		groups, err := parseApproverGroups(`{
+			"security": {"policies": ["security"], "required": 2},
+			"platform": {"policies": ["platform", "admin"], "required": 1}
+		}`)
+		c.So(err, ShouldBeNil)
+		configLock.Lock()
+		previous := approverGroups
+		approverGroups = groups
+		configLock.Unlock()
+		defer func() {
+			configLock.Lock()
+			approverGroups = previous
+			configLock.Unlock()
+		}()
+
+		c.Convey("Sessions should belong to groups by policy", func(c C) {
+			names, err := approverGroupsFor(map[string]interface{}{
+				"policies": []interface{}{"default", "admin", "security"},
+			})
+			c.So(err, ShouldBeNil)
+			c.So(names, ShouldResemble, []string{"platform", "security"})
+
+			names, err = approverGroupsFor(map[string]interface{}{
+				"policies": []interface{}{"default"},
+			})
+			c.So(err, ShouldBeNil)
+			c.So(names, ShouldBeEmpty)
+		})
+
+		c.Convey("Requests should need every group's approvals", func(c C) {
+			approvals := []PolicyApproval{
+				{ApproverHash: "a", Groups: []string{"platform", "security"}},
+			}
+			c.So(PolicyApprovalsSatisfied(approvals), ShouldBeFalse)
+			c.So(PolicyApprovalProgress(approvals), ShouldResemble, []ApprovalProgress{
+				{Group: "platform", Approvals: 1, Required: 1},
+				{Group: "security", Approvals: 1, Required: 2},
+			})
+
+			approvals = append(approvals, PolicyApproval{ApproverHash: "b", Groups: []string{"security"}})
+			c.So(PolicyApprovalsSatisfied(approvals), ShouldBeTrue)
+		})
+	})
+}
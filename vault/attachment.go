@@ -0,0 +1,229 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// used when AttachmentMaxSize is not configured. Attachments live in the cubbyhole,
+// so this stays well below the storage entry limits of common vault backends
+const defaultAttachmentMaxSize = 256 * 1024
+
+// a file attached to a policy request. The content is stored once per sha256,
+// encrypted with the server transit key, and shared by every request that attaches it
+type Attachment struct {
+	Name        string `json:"name"`
+	SHA256      string `json:"sha256"`
+	Size        int    `json:"size"`
+	ContentType string `json:"content_type"`
+	Uploader    string `json:"uploader"`
+	Uploaded    string `json:"uploaded"`
+}
+
+// the largest attachment, in bytes, that may be stored
+func AttachmentMaxSize() int {
+	if n, err := strconv.Atoi(GetConfig().AttachmentMaxSize); err == nil && n > 0 {
+		return n
+	}
+	return defaultAttachmentMaxSize
+}
+
+func parseAttachmentMaxSize(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(raw); err != nil || n <= 0 {
+		return errors.New("AttachmentMaxSize must be a positive number of bytes")
+	}
+	return nil
+}
+
+// stores the content of an attachment and adds it to the request's attachment list
+func AddAttachment(changeID string, attachment Attachment, content []byte) (*Attachment, error) {
+	if len(content) == 0 {
+		return nil, errors.New("Attachment is empty")
+	}
+	if len(content) > AttachmentMaxSize() {
+		return nil, fmt.Errorf("Attachment exceeds the maximum size of %d bytes", AttachmentMaxSize())
+	}
+
+	attachment.SHA256 = fmt.Sprintf("%x", sha256.Sum256(content))
+	attachment.Size = len(content)
+	attachment.Uploaded = time.Now().UTC().Format(time.RFC3339)
+
+	attachments, err := ListAttachments(changeID)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range attachments {
+		if existing.SHA256 == attachment.SHA256 {
+			return nil, errors.New("This file is already attached as " + existing.Name)
+		}
+	}
+
+	// identical content is only stored once
+	resp, err := ReadFromCubbyhole("attachments/" + attachment.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		ciphertext, err := encryptServer(content)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := WriteToCubbyhole("attachments/"+attachment.SHA256, map[string]interface{}{
+			"ciphertext": ciphertext,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	attachments = append(attachments, attachment)
+	if err := writeAttachmentList(changeID, attachments); err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// lists the attachments of a request
+func ListAttachments(changeID string) ([]Attachment, error) {
+	attachments := []Attachment{}
+	resp, err := ReadFromCubbyhole("request_attachments/" + changeID)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Data == nil {
+		return attachments, nil
+	}
+	raw, _ := resp.Data["attachments"].(string)
+	if err := json.Unmarshal([]byte(raw), &attachments); err != nil {
+		return nil, errors.New("Attachment list is malformed")
+	}
+	return attachments, nil
+}
+
+// returns an attachment of a request and its decrypted content
+// content is only reachable through a request that attached it
+func ReadAttachment(changeID, sha string) (*Attachment, []byte, error) {
+	attachments, err := ListAttachments(changeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var attachment *Attachment
+	for i := range attachments {
+		if attachments[i].SHA256 == sha {
+			attachment = &attachments[i]
+		}
+	}
+	if attachment == nil {
+		return nil, nil, errors.New("Attachment not found")
+	}
+
+	resp, err := ReadFromCubbyhole("attachments/" + sha)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, nil, errors.New("Attachment content is missing")
+	}
+	ciphertext, _ := resp.Data["ciphertext"].(string)
+	content, err := decryptServer(ciphertext)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fmt.Sprintf("%x", sha256.Sum256(content)) != sha {
+		return nil, nil, errors.New("Attachment content does not match its hash")
+	}
+	return attachment, content, nil
+}
+
+// removes a request's attachment list, and any content no other request refers to
+func DeleteAttachments(changeID string) error {
+	attachments, err := ListAttachments(changeID)
+	if err != nil {
+		return err
+	}
+	if len(attachments) == 0 {
+		return nil
+	}
+	if _, err := DeleteFromCubbyhole("request_attachments/" + changeID); err != nil {
+		return err
+	}
+
+	referenced, err := referencedAttachments()
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		if !referenced[attachment.SHA256] {
+			if _, err := DeleteFromCubbyhole("attachments/" + attachment.SHA256); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// the set of content hashes attached to any request
+func referencedAttachments() (map[string]bool, error) {
+	referenced := map[string]bool{}
+	ids, err := listCubbyhole("request_attachments/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		attachments, err := ListAttachments(id)
+		if err != nil {
+			continue
+		}
+		for _, attachment := range attachments {
+			referenced[attachment.SHA256] = true
+		}
+	}
+	return referenced, nil
+}
+
+func writeAttachmentList(changeID string, attachments []Attachment) error {
+	raw, err := json.Marshal(attachments)
+	if err != nil {
+		return err
+	}
+	_, err = WriteToCubbyhole("request_attachments/"+changeID, map[string]interface{}{
+		"attachments": string(raw),
+	})
+	return err
+}
+
+// encrypts data with the server transit key
+func encryptServer(plaintext []byte) (string, error) {
+	c := GetConfig()
+	resp, err := serverVaultClient().Logical().Write(
+		c.TransitBackend+"/encrypt/"+c.ServerTransitKey,
+		map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+		})
+	if err != nil {
+		return "", err
+	}
+	cipher, ok := resp.Data["ciphertext"].(string)
+	if !ok {
+		return "", errors.New("Failed type assertion of response to string")
+	}
+	return cipher, nil
+}
+
+// decrypts data that was encrypted with the server transit key
+func decryptServer(ciphertext string) ([]byte, error) {
+	c := GetConfig()
+	b64, err := decryptWithKeys(serverVaultClient(), c.TransitBackend,
+		transitKeys(c.ServerTransitKey, c.PreviousServerTransitKeys), ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(b64)
+}
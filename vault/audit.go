@@ -0,0 +1,113 @@
+package vault
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// an enabled audit device
+type AuditDevice struct {
+	Path        string            `json:"path"`
+	Type        string            `json:"type"`
+	Description string            `json:"description"`
+	Options     map[string]string `json:"options"`
+	Local       bool              `json:"local"`
+}
+
+// the options each kind of audit device can't do without
+var requiredAuditOptions = map[string][]string{
+	"file":   {"file_path"},
+	"syslog": {},
+	"socket": {"address"},
+}
+
+func (device AuditDevice) validate() error {
+	required, ok := requiredAuditOptions[device.Type]
+	if !ok {
+		return errors.New("Audit device type must be file, syslog or socket")
+	}
+	for _, option := range required {
+		if device.Options[option] == "" {
+			return errors.New("A " + device.Type + " audit device needs the " + option + " option")
+		}
+	}
+	return nil
+}
+
+// returns the enabled audit devices, sorted by path
+func (auth AuthInfo) ListAuditDevices() ([]AuditDevice, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	audits, err := client.Sys().ListAudit()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]AuditDevice, 0, len(audits))
+	for path, audit := range audits {
+		devices = append(devices, AuditDevice{
+			Path:        path,
+			Type:        audit.Type,
+			Description: audit.Description,
+			Options:     audit.Options,
+			Local:       audit.Local,
+		})
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Path < devices[j].Path
+	})
+	return devices, nil
+}
+
+func (auth AuthInfo) EnableAuditDevice(device AuditDevice) error {
+	path, err := cleanMountPath(device.Path)
+	if err != nil {
+		return err
+	}
+	if err := device.validate(); err != nil {
+		return err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	return client.Sys().EnableAuditWithOptions(path, &api.EnableAuditOptions{
+		Type:        device.Type,
+		Description: device.Description,
+		Options:     device.Options,
+		Local:       device.Local,
+	})
+}
+
+// disables an audit device. If it was the last one, vault stops refusing requests it can't audit
+func (auth AuthInfo) DisableAuditDevice(path string) error {
+	path, err := cleanMountPath(path)
+	if err != nil {
+		return err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	return client.Sys().DisableAudit(path)
+}
+
+// hashes input with the audit device's salt, so it can be compared against the audit log
+func (auth AuthInfo) AuditHash(path, input string) (string, error) {
+	path, err := cleanMountPath(path)
+	if err != nil {
+		return "", err
+	}
+	if input == "" {
+		return "", errors.New("Input to hash is required")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return "", err
+	}
+	return client.Sys().AuditHash(path, input)
+}
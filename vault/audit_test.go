@@ -0,0 +1,23 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuditDeviceValidate(t *testing.T) {
+	Convey("Only file, syslog and socket audit devices should be accepted", t, func(c C) {
+		c.So(AuditDevice{Type: "syslog"}.validate(), ShouldBeNil)
+		c.So(AuditDevice{Type: "http"}.validate(), ShouldNotBeNil)
+	})
+
+	Convey("Audit devices should need the options their type requires", t, func(c C) {
+		c.So(AuditDevice{Type: "file"}.validate(), ShouldNotBeNil)
+		c.So(AuditDevice{Type: "socket", Options: map[string]string{"address": ""}}.validate(), ShouldNotBeNil)
+		c.So(AuditDevice{
+			Type:    "file",
+			Options: map[string]string{"file_path": "/var/log/vault_audit.log"},
+		}.validate(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,70 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/caiyeon/goldfish/audit"
+	"github.com/hashicorp/vault/api"
+)
+
+// writes goldfish's audit events as secrets under a path, with goldfish's server token
+// each event is its own secret, named by its date, time and request ID, so none is overwritten
+// the path may be on a kv-v1 or kv-v2 mount
+type AuditKVSink struct {
+	path string
+
+	// the mount the path is on and its kv version, looked up on the first write
+	lock    sync.Mutex
+	mount   string
+	version int
+}
+
+func NewAuditKVSink(path string) (*AuditKVSink, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, errors.New("Audit path is required")
+	}
+	return &AuditKVSink{path: path}, nil
+}
+
+func (s *AuditKVSink) Write(e audit.Event) error {
+	client := serverVaultClient()
+	mount, version, err := s.kvMount(client)
+	if err != nil {
+		return err
+	}
+
+	t := e.Time.UTC()
+	key := s.path + "/" + t.Format("2006-01-02") + "/" + strconv.FormatInt(t.UnixNano(), 10)
+	if e.RequestID != "" {
+		key += "-" + e.RequestID
+	}
+	// stored with the same field names as in the other sinks
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return err
+	}
+	return writeKV(client, mount, key, version, data)
+}
+
+// mounts are only remembered once found, so a failed lookup is retried on the next write
+func (s *AuditKVSink) kvMount(client *api.Client) (string, int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.mount == "" {
+		mount, version, err := kvMount(client, "", s.path+"/")
+		if err != nil {
+			return "", 0, err
+		}
+		s.mount, s.version = mount, version
+	}
+	return s.mount, s.version, nil
+}
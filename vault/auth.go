@@ -3,6 +3,8 @@ package vault
 import (
 	"encoding/base64"
 	"errors"
+
+	"github.com/caiyeon/goldfish/tracing"
 )
 
 // zeros out credentials, call by defer
@@ -10,6 +12,20 @@ func (auth *AuthInfo) Clear() {
 	auth.Type = ""
 	auth.ID = ""
 	auth.Pass = ""
+	auth.Namespace = ""
+	auth.Cluster = ""
+	auth.Fingerprint = ""
+	auth.request = requestContext{}
+}
+
+// tags the session's vault requests with the ID of the goldfish request being served
+func (auth *AuthInfo) SetRequestID(id string) {
+	auth.request.id = id
+}
+
+// traces the session's vault requests within the span of the goldfish request being served
+func (auth *AuthInfo) SetSpan(span *tracing.Span) {
+	auth.request.span = span
 }
 
 func (auth AuthInfo) RevokeSelf() error {
@@ -17,6 +33,7 @@ func (auth AuthInfo) RevokeSelf() error {
 	if err != nil {
 		return err
 	}
+	defer InvalidateToken(auth.Cluster, auth.ID)
 	return client.Auth().Token().RevokeSelf("")
 }
 
@@ -24,7 +41,7 @@ func (auth AuthInfo) RevokeSelf() error {
 func (auth *AuthInfo) EncryptAuth() error {
 	c := GetConfig()
 
-	resp, err := vaultClient.Logical().Write(
+	resp, err := serverVaultClient().Logical().Write(
 		c.TransitBackend+"/encrypt/"+c.ServerTransitKey,
 		map[string]interface{}{
 			"plaintext": base64.StdEncoding.EncodeToString([]byte(auth.ID)),
@@ -46,20 +63,13 @@ func (auth *AuthInfo) EncryptAuth() error {
 func (auth *AuthInfo) DecryptAuth() error {
 	c := GetConfig()
 
-	resp, err := vaultClient.Logical().Write(
-		c.TransitBackend+"/decrypt/"+c.ServerTransitKey,
-		map[string]interface{}{
-			"ciphertext": auth.ID,
-		})
+	// sessions from before the server transit key was changed are still decrypted with the old key
+	b64, err := decryptWithKeys(serverVaultClient(), c.TransitBackend,
+		transitKeys(c.ServerTransitKey, c.PreviousServerTransitKeys), auth.ID)
 	if err != nil {
 		return err
 	}
 
-	b64, ok := resp.Data["plaintext"].(string)
-	if !ok {
-		return errors.New("Failed type assertion of response to string")
-	}
-
 	rawbytes, err := base64.StdEncoding.DecodeString(b64)
 	if err != nil {
 		return err
@@ -77,3 +87,62 @@ func (auth *AuthInfo) CapabilitiesSelf(path string) ([]string, error) {
 	}
 	return client.Sys().CapabilitiesSelf(path)
 }
+
+// the capabilities the session's own token has on each path, so the UI can hide what it can't do
+func (auth *AuthInfo) CapabilitiesSelfBatch(paths []string) ([]PathCapabilities, error) {
+	results, _, err := auth.CapabilitiesSelfBatchWithin(paths, 0, Budget{})
+	return results, err
+}
+
+// looks up the capabilities on each path, starting at offset, until the budget runs out
+// if the lookups stopped early, the offset to continue from is returned, otherwise -1
+func (auth *AuthInfo) CapabilitiesSelfBatchWithin(paths []string, offset int, budget Budget) ([]PathCapabilities, int, error) {
+	paths, err := simulationPaths(paths)
+	if err != nil {
+		return nil, -1, err
+	}
+	if offset > len(paths) {
+		return nil, -1, errors.New("Offset out of bound")
+	}
+
+	results := make([]PathCapabilities, 0, len(paths)-offset)
+	for i, path := range paths[offset:] {
+		if budget.Exceeded() {
+			return results, offset + i, nil
+		}
+		caps, err := auth.CapabilitiesSelf(path)
+		if err != nil {
+			return nil, -1, err
+		}
+		results = append(results, PathCapabilities{Path: path, Capabilities: caps})
+	}
+	return results, -1, nil
+}
+
+// goldfish administrators are those who may update goldfish's runtime config
+func (auth *AuthInfo) IsAdmin() (bool, error) {
+	capabilities, err := auth.CapabilitiesSelf(runtimeConfigPath)
+	if err != nil {
+		return false, err
+	}
+	for _, capability := range capabilities {
+		if capability == "update" || capability == "root" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// the policies a token holds, directly and through its identity entity and groups
+func policiesOf(self map[string]interface{}) map[string]bool {
+	policies := map[string]bool{}
+	for _, key := range []string{"policies", "identity_policies"} {
+		list, _ := self[key].([]interface{})
+		for _, p := range list {
+			if name, ok := p.(string); ok {
+				policies[name] = true
+			}
+		}
+	}
+	return policies
+}
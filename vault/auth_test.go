@@ -0,0 +1,67 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCapabilitiesSelfBatch(t *testing.T) {
+	Convey("The session's capabilities should be looked up on each path once", t, func(c C) {
+		asked := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/auth/token/lookup-self":
+				w.Write([]byte(`{"data": {"policies": ["default"]}}`))
+			case "/v1/sys/capabilities-self":
+				var body struct {
+					Path string `json:"path"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				asked = append(asked, body.Path)
+				caps := []string{"deny"}
+				if body.Path == "secret/foo" {
+					caps = []string{"read", "list"}
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"capabilities": caps})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		address := VaultAddress
+		VaultAddress = server.URL
+		defer func() { VaultAddress = address }()
+
+		auth := &AuthInfo{Type: "token", ID: "batch-test-token"}
+		results, err := auth.CapabilitiesSelfBatch([]string{"/secret/foo", "secret/foo", "sys/mounts"})
+		c.So(err, ShouldBeNil)
+		c.So(results, ShouldResemble, []PathCapabilities{
+			{Path: "secret/foo", Capabilities: []string{"read", "list"}},
+			{Path: "sys/mounts", Capabilities: []string{"deny"}},
+		})
+		c.So(asked, ShouldResemble, []string{"secret/foo", "sys/mounts"})
+
+		_, err = auth.CapabilitiesSelfBatch([]string{""})
+		c.So(err, ShouldNotBeNil)
+
+		c.Convey("Lookups should stop when the budget runs out, and continue from the offset", func(c C) {
+			exhausted := NewBudget(time.Nanosecond)
+			time.Sleep(time.Millisecond)
+			results, next, err := auth.CapabilitiesSelfBatchWithin([]string{"secret/foo", "sys/mounts"}, 1, exhausted)
+			c.So(err, ShouldBeNil)
+			c.So(results, ShouldBeEmpty)
+			c.So(next, ShouldEqual, 1)
+
+			results, next, err = auth.CapabilitiesSelfBatchWithin([]string{"secret/foo", "sys/mounts"}, 1, Budget{})
+			c.So(err, ShouldBeNil)
+			c.So(results, ShouldResemble, []PathCapabilities{{Path: "sys/mounts", Capabilities: []string{"deny"}}})
+			c.So(next, ShouldEqual, -1)
+		})
+	})
+}
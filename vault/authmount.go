@@ -0,0 +1,161 @@
+package vault
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fatih/structs"
+	"github.com/hashicorp/vault/api"
+)
+
+// an auth method, as listed by vault, along with its tuning
+// listing visibility is only returned by vault's tune endpoint, so it is read from there
+type AuthMountOutput struct {
+	Type              string `json:"type"`
+	Description       string `json:"description"`
+	Local             bool   `json:"local"`
+	DefaultLeaseTTL   int    `json:"default_lease_ttl"`
+	MaxLeaseTTL       int    `json:"max_lease_ttl"`
+	ListingVisibility string `json:"listing_visibility"`
+}
+
+// a new auth method
+type AuthMountSpec struct {
+	Path        string               `json:"path"`
+	Type        string               `json:"type"`
+	Description string               `json:"description"`
+	Local       bool                 `json:"local"`
+	Config      api.MountConfigInput `json:"config"`
+}
+
+// the settings of an auth method that can be changed after it is enabled
+// empty fields are left as they are
+type AuthTuneInput struct {
+	DefaultLeaseTTL   string `json:"default_lease_ttl" structs:"default_lease_ttl,omitempty"`
+	MaxLeaseTTL       string `json:"max_lease_ttl" structs:"max_lease_ttl,omitempty"`
+	ListingVisibility string `json:"listing_visibility" structs:"listing_visibility,omitempty"`
+	Description       string `json:"description" structs:"description,omitempty"`
+}
+
+func (input AuthTuneInput) validate() error {
+	switch input.ListingVisibility {
+	case "", "hidden", "unauth":
+	default:
+		return errors.New("Listing visibility must be hidden or unauth")
+	}
+	if input == (AuthTuneInput{}) {
+		return errors.New("Nothing to tune")
+	}
+	return nil
+}
+
+// returns the enabled auth methods with their configs, keyed by path
+func (auth AuthInfo) ListAuthMounts() (map[string]*AuthMountOutput, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := client.Sys().ListAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]*AuthMountOutput, len(mounts))
+	for path, mount := range mounts {
+		result := &AuthMountOutput{
+			Type:            mount.Type,
+			Description:     mount.Description,
+			Local:           mount.Local,
+			DefaultLeaseTTL: mount.Config.DefaultLeaseTTL,
+			MaxLeaseTTL:     mount.Config.MaxLeaseTTL,
+		}
+		// older vaults have no listing visibility, which is the same as hidden
+		// listed paths already end with a slash
+		if resp, err := client.Logical().Read("sys/auth/" + path + "tune"); err == nil && resp != nil {
+			result.ListingVisibility, _ = resp.Data["listing_visibility"].(string)
+		}
+		results[path] = result
+	}
+	return results, nil
+}
+
+// returns the tuning of an auth method
+func (auth AuthInfo) GetAuthMount(path string) (map[string]interface{}, error) {
+	path, err := cleanMountPath(path)
+	if err != nil {
+		return nil, err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Read("sys/auth/" + path + "/tune")
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Auth method not found")
+	}
+	return resp.Data, nil
+}
+
+func (auth AuthInfo) EnableAuthMount(spec AuthMountSpec) error {
+	path, err := cleanMountPath(spec.Path)
+	if err != nil {
+		return err
+	}
+	if spec.Type == "" {
+		return errors.New("Auth method type is required")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+
+	// the api client's auth input has no config, so the request is made directly
+	_, err = client.Logical().Write("sys/auth/"+path, map[string]interface{}{
+		"type":        spec.Type,
+		"description": spec.Description,
+		"local":       spec.Local,
+		"config":      structs.Map(spec.Config),
+	})
+	return err
+}
+
+func (auth AuthInfo) TuneAuthMount(path string, input AuthTuneInput) error {
+	path, err := cleanMountPath(path)
+	if err != nil {
+		return err
+	}
+	if err := input.validate(); err != nil {
+		return err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().Write("sys/auth/"+path+"/tune", structs.Map(input))
+	return err
+}
+
+// disables an auth method, revoking every token that was issued through it
+func (auth AuthInfo) DisableAuthMount(path string) error {
+	path, err := cleanMountPath(path)
+	if err != nil {
+		return err
+	}
+	if serverLoginMount != "" && path == serverLoginMount {
+		return errors.New("Goldfish logs in through this auth method, so it can't be disabled through goldfish")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	return client.Sys().DisableAuth(path)
+}
+
+// the mount of an auth method's login path, e.g. approle for auth/approle/login
+func loginMount(login string) string {
+	login = strings.TrimSuffix(strings.Trim(login, "/"), "/login")
+	return strings.TrimPrefix(login, "auth/")
+}
@@ -0,0 +1,40 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/fatih/structs"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthTuneInput(t *testing.T) {
+	Convey("Listing visibility should only be hidden or unauth", t, func(c C) {
+		c.So(AuthTuneInput{ListingVisibility: "unauth"}.validate(), ShouldBeNil)
+		c.So(AuthTuneInput{ListingVisibility: "hidden"}.validate(), ShouldBeNil)
+		c.So(AuthTuneInput{ListingVisibility: "public"}.validate(), ShouldNotBeNil)
+	})
+
+	Convey("Tuning nothing should be rejected", t, func(c C) {
+		c.So(AuthTuneInput{}.validate(), ShouldNotBeNil)
+	})
+
+	Convey("Empty fields should be left out of the request", t, func(c C) {
+		data := structs.Map(AuthTuneInput{MaxLeaseTTL: "24h"})
+		c.So(data, ShouldResemble, map[string]interface{}{"max_lease_ttl": "24h"})
+	})
+}
+
+func TestOwnAuthMount(t *testing.T) {
+	Convey("Login paths should give their auth mount", t, func(c C) {
+		c.So(loginMount("auth/approle/login"), ShouldEqual, "approle")
+		c.So(loginMount("/auth/team/k8s/login/"), ShouldEqual, "team/k8s")
+	})
+
+	Convey("The auth method goldfish logs in through should not be disabled", t, func(c C) {
+		previous := serverLoginMount
+		serverLoginMount = "approle"
+		defer func() { serverLoginMount = previous }()
+
+		c.So(AuthInfo{}.DisableAuthMount("/approle/"), ShouldNotBeNil)
+	})
+}
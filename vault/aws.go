@@ -0,0 +1,68 @@
+package vault
+
+import (
+	"errors"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func init() {
+	RegisterSecretEngine("aws", credentialEngine{
+		description: EngineDescription{
+			Type:        "aws",
+			Name:        "AWS",
+			Description: "Dynamic AWS IAM and STS credentials",
+		},
+		rolesPath: "roles",
+		credsPath: "creds",
+	})
+}
+
+func (auth AuthInfo) ListAWSRoles(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "aws") + "roles")
+}
+
+// role details include the attached policy document or arn
+func (auth AuthInfo) ReadAWSRole(mount, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "aws") + "roles/" + name)
+}
+
+// generates credentials for the role. IAM users are created via creds/,
+// STS federation tokens or assumed roles via sts/, which honours the optional ttl
+func (auth AuthInfo) GenerateAWSCredentials(mount, role string, sts bool, ttl string) (*api.Secret, error) {
+	if role == "" {
+		return nil, errors.New("Empty role name")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := "creds/"
+	if sts {
+		endpoint = "sts/"
+	}
+	r := client.NewRequest("GET", "/v1/"+mountPrefix(mount, "aws")+endpoint+role)
+	if sts && ttl != "" {
+		r.Params.Set("ttl", ttl)
+	}
+	resp, err := client.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := api.ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, errors.New("Invalid path")
+	}
+	return secret, nil
+}
@@ -0,0 +1,39 @@
+package vault
+
+import (
+	"errors"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func init() {
+	RegisterSecretEngine("azure", credentialEngine{
+		description: EngineDescription{
+			Type:        "azure",
+			Name:        "Azure",
+			Description: "Dynamic Azure service principals",
+		},
+		rolesPath: "roles",
+		credsPath: "creds",
+	})
+}
+
+func (auth AuthInfo) ListAzureRoles(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "azure") + "roles")
+}
+
+// role details include the azure roles and scopes assigned to generated principals
+func (auth AuthInfo) ReadAzureRole(mount, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "azure") + "roles/" + name)
+}
+
+// generates a service principal for the role. The secret carries the lease
+func (auth AuthInfo) GenerateAzureCredentials(mount, role string) (*api.Secret, error) {
+	if role == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.readCreds(mountPrefix(mount, "azure"), "creds/"+role)
+}
@@ -0,0 +1,170 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/awsutil"
+)
+
+// logs in with the kubernetes auth backend, using the pod's service account token
+func StartGoldfishKubernetes(login, role, jwtFile string) error {
+	serverLoginMount = loginMount(login)
+	return startGoldfish(func(client *api.Client) (*api.SecretAuth, error) {
+		raw, err := ioutil.ReadFile(jwtFile)
+		if err != nil {
+			return nil, errors.New("Could not read the service account token: " + err.Error())
+		}
+		return loginWith(client, "Logging in with kubernetes", login, map[string]interface{}{
+			"role": role,
+			"jwt":  strings.TrimSpace(string(raw)),
+		})
+	}, true)
+}
+
+// logs in with the aws auth backend's iam method, using whichever credentials the aws sdk finds
+func StartGoldfishAWS(login, role, headerValue string) error {
+	serverLoginMount = loginMount(login)
+	return startGoldfish(func(client *api.Client) (*api.SecretAuth, error) {
+		data, err := awsLoginData(role, headerValue)
+		if err != nil {
+			return nil, err
+		}
+		return loginWith(client, "Logging in with aws", login, data)
+	}, true)
+}
+
+func loginWith(client *api.Client, step, login string, data map[string]interface{}) (*api.SecretAuth, error) {
+	var resp *api.Secret
+	err := retryStartup(step, func() error {
+		var err error
+		client.SetToken("")
+		resp, err = client.Logical().Write(login, data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Auth == nil {
+		return nil, errors.New("Login response from vault did not contain a token")
+	}
+	return resp.Auth, nil
+}
+
+// a signed sts:GetCallerIdentity request, which vault makes to confirm goldfish's iam identity
+// credentials come from the environment, shared credentials, or the instance profile
+func awsLoginData(role, headerValue string) (map[string]interface{}, error) {
+	creds, err := (&awsutil.CredentialsConfig{}).GenerateCredentialChain()
+	if err != nil {
+		return nil, err
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{Credentials: creds},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	request, _ := sts.New(sess).GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	if headerValue != "" {
+		request.HTTPRequest.Header.Add("X-Vault-AWS-IAM-Server-ID", headerValue)
+	}
+	if err := request.Sign(); err != nil {
+		return nil, errors.New("Could not sign the aws login request: " + err.Error())
+	}
+
+	headers, err := json.Marshal(request.HTTPRequest.Header)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(request.HTTPRequest.Body)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"role":                    role,
+		"iam_http_request_method": request.HTTPRequest.Method,
+		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(request.HTTPRequest.URL.String())),
+		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+		"iam_request_body":        base64.StdEncoding.EncodeToString(body),
+	}, nil
+}
+
+// how often the token file is checked for a new token
+const tokenFileInterval = 5 * time.Second
+
+// uses the token in a file that something else keeps current, such as vault agent's auto-auth
+// sink, and switches to a new token whenever the file changes. Goldfish doesn't revoke the
+// token when it stops, as the token belongs to whatever writes the file
+func StartGoldfishTokenFile(path string) error {
+	serverTokenShared = true
+	if err := startGoldfish(tokenFileLogin(path), true); err != nil {
+		return err
+	}
+	go watchTokenFile(path)
+	return nil
+}
+
+func tokenFileLogin(path string) func(*api.Client) (*api.SecretAuth, error) {
+	return func(client *api.Client) (*api.SecretAuth, error) {
+		token, err := readTokenFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var resp *api.Secret
+		err = retryStartup("Looking up the token in the token file", func() error {
+			var err error
+			client.SetToken(token)
+			resp, err = client.Auth().Token().LookupSelf()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			return nil, errors.New("Vault did not return the token file's token")
+		}
+		accessor, _ := resp.Data["accessor"].(string)
+		ttl, _ := strconv.Atoi(fmt.Sprint(resp.Data["ttl"]))
+		return &api.SecretAuth{ClientToken: token, Accessor: accessor, LeaseDuration: ttl}, nil
+	}
+}
+
+func readTokenFile(path string) (string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.New("Could not read the token file: " + err.Error())
+	}
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", errors.New("The token file " + path + " is empty")
+	}
+	return token, nil
+}
+
+// a missing or empty file is left alone, e.g. while vault agent is restarting
+// goldfish's state is copied from the old token when switching, see reloginServerToken
+func watchTokenFile(path string) {
+	for {
+		time.Sleep(tokenFileInterval)
+		token, err := readTokenFile(path)
+		if err != nil || token == ServerToken() {
+			continue
+		}
+		log.Println("[INFO ]: The token file changed, switching to its token")
+		ttl, err := reloginServerToken()
+		recordServerToken(ttl, true, err)
+		errorChannel <- err
+	}
+}
@@ -0,0 +1,60 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAWSLoginData(t *testing.T) {
+	Convey("The aws login data", t, func(c C) {
+		os.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE")
+		os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+		defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+		data, err := awsLoginData("goldfish", "vault.example.com")
+		c.So(err, ShouldBeNil)
+		c.So(data["role"], ShouldEqual, "goldfish")
+		c.So(data["iam_http_request_method"], ShouldEqual, "POST")
+
+		url, _ := base64.StdEncoding.DecodeString(data["iam_request_url"].(string))
+		c.So(string(url), ShouldStartWith, "https://sts.amazonaws.com")
+		body, _ := base64.StdEncoding.DecodeString(data["iam_request_body"].(string))
+		c.So(string(body), ShouldContainSubstring, "Action=GetCallerIdentity")
+
+		raw, _ := base64.StdEncoding.DecodeString(data["iam_request_headers"].(string))
+		var headers http.Header
+		c.So(json.Unmarshal(raw, &headers), ShouldBeNil)
+		c.So(headers.Get("X-Vault-AWS-IAM-Server-ID"), ShouldEqual, "vault.example.com")
+		c.So(headers.Get("Authorization"), ShouldContainSubstring, "AKIAEXAMPLE")
+		c.So(headers.Get("Authorization"), ShouldContainSubstring, "x-vault-aws-iam-server-id")
+	})
+}
+
+func TestReadTokenFile(t *testing.T) {
+	Convey("Reading the token file", t, func(c C) {
+		file, err := ioutil.TempFile("", "goldfish-token")
+		c.So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+
+		c.Convey("Should trim the token", func(c C) {
+			ioutil.WriteFile(file.Name(), []byte("s.token\n"), 0600)
+			token, err := readTokenFile(file.Name())
+			c.So(err, ShouldBeNil)
+			c.So(token, ShouldEqual, "s.token")
+		})
+
+		c.Convey("Should fail on empty or missing files", func(c C) {
+			_, err := readTokenFile(file.Name())
+			c.So(err, ShouldNotBeNil)
+			_, err = readTokenFile(file.Name() + "-missing")
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,23 @@
+package vault
+
+import (
+	"time"
+)
+
+// a time budget for operations that aggregate many vault calls
+// the zero value is an unlimited budget
+type Budget struct {
+	deadline time.Time
+}
+
+func NewBudget(d time.Duration) Budget {
+	if d <= 0 {
+		return Budget{}
+	}
+	return Budget{deadline: time.Now().Add(d)}
+}
+
+// true if the operation should stop and return what it has so far
+func (b Budget) Exceeded() bool {
+	return !b.deadline.IsZero() && time.Now().After(b.deadline)
+}
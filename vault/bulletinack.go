@@ -0,0 +1,192 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// someone that has logged in to goldfish, and so is expected to read bulletins
+// Identity is the same hash that preferences are saved under
+type KnownUser struct {
+	Identity  string `json:"identity"`
+	Name      string `json:"name"`
+	LastLogin string `json:"last_login"`
+}
+
+// one person's acknowledgement of a bulletin
+type BulletinAck struct {
+	Identity     string `json:"identity"`
+	Name         string `json:"name"`
+	Acknowledged string `json:"acknowledged"`
+}
+
+// who has and hasn't acknowledged a bulletin. Pending only lists people that have
+// logged in to goldfish, as nobody else could have seen it
+type BulletinAcks struct {
+	Acknowledged []BulletinAck `json:"acknowledged"`
+	Pending      []KnownUser   `json:"pending"`
+}
+
+// people that haven't logged in for this long are no longer expected to read bulletins,
+// and are cleaned up by the GC pass
+const knownUserRetention = 90 * 24 * time.Hour
+
+// true if the person hasn't logged in within knownUserRetention of now
+func knownUserStale(user KnownUser, now time.Time) bool {
+	last, err := time.Parse(time.RFC3339, user.LastLogin)
+	return err != nil || now.Sub(last) > knownUserRetention
+}
+
+// acknowledgements are read, added to and written back, so two must not interleave
+var bulletinAcksLock = sync.Mutex{}
+
+func validBulletinName(name string) error {
+	if name == "" || strings.ContainsAny(name, "/?#") {
+		return errors.New("Invalid bulletin name")
+	}
+	return nil
+}
+
+// remembers that the token described by lookup-self data logged in
+func RecordKnownUser(self map[string]interface{}) error {
+	identity, err := preferenceIdentityOf(self)
+	if err != nil {
+		return err
+	}
+	name, _ := self["display_name"].(string)
+	raw, err := json.Marshal(KnownUser{
+		Identity:  identity,
+		Name:      name,
+		LastLogin: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = WriteToCubbyhole("known_users/"+identity, map[string]interface{}{
+		"user": string(raw),
+	})
+	return err
+}
+
+func listKnownUsers() ([]KnownUser, error) {
+	ids, err := listCubbyhole("known_users/")
+	if err != nil {
+		return nil, err
+	}
+	users := []KnownUser{}
+	for _, id := range ids {
+		resp, err := ReadFromCubbyhole("known_users/" + id)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			continue
+		}
+		raw, _ := resp.Data["user"].(string)
+		var user KnownUser
+		if json.Unmarshal([]byte(raw), &user) == nil && user.Identity != "" {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func readBulletinAcks(bulletin string) (map[string]BulletinAck, error) {
+	acks := map[string]BulletinAck{}
+	resp, err := ReadFromCubbyhole("bulletin_acks/" + bulletin)
+	if err != nil || resp == nil {
+		return acks, err
+	}
+	raw, _ := resp.Data["acks"].(string)
+	if err := json.Unmarshal([]byte(raw), &acks); err != nil {
+		return nil, errors.New("Bulletin acknowledgements appear to be malformed")
+	}
+	return acks, nil
+}
+
+// records that a person has read a bulletin. Acknowledging again keeps the first time
+func AcknowledgeBulletin(bulletin, identity, name string) (*BulletinAck, error) {
+	if err := validBulletinName(bulletin); err != nil {
+		return nil, err
+	}
+
+	bulletinAcksLock.Lock()
+	defer bulletinAcksLock.Unlock()
+
+	acks, err := readBulletinAcks(bulletin)
+	if err != nil {
+		return nil, err
+	}
+	if ack, ok := acks[identity]; ok {
+		return &ack, nil
+	}
+	ack := BulletinAck{
+		Identity:     identity,
+		Name:         name,
+		Acknowledged: time.Now().UTC().Format(time.RFC3339),
+	}
+	acks[identity] = ack
+
+	raw, err := json.Marshal(acks)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := WriteToCubbyhole("bulletin_acks/"+bulletin, map[string]interface{}{
+		"acks": string(raw),
+	}); err != nil {
+		return nil, err
+	}
+	return &ack, nil
+}
+
+// true if the person has acknowledged the bulletin
+func BulletinAcknowledged(bulletin, identity string) (bool, error) {
+	if err := validBulletinName(bulletin); err != nil {
+		return false, err
+	}
+	acks, err := readBulletinAcks(bulletin)
+	if err != nil {
+		return false, err
+	}
+	_, ok := acks[identity]
+	return ok, nil
+}
+
+// lists who has acknowledged a bulletin, oldest first, and who has logged in but not yet
+func GetBulletinAcks(bulletin string) (*BulletinAcks, error) {
+	if err := validBulletinName(bulletin); err != nil {
+		return nil, err
+	}
+	acks, err := readBulletinAcks(bulletin)
+	if err != nil {
+		return nil, err
+	}
+	users, err := listKnownUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BulletinAcks{
+		Acknowledged: []BulletinAck{},
+		Pending:      []KnownUser{},
+	}
+	for _, ack := range acks {
+		result.Acknowledged = append(result.Acknowledged, ack)
+	}
+	sort.Slice(result.Acknowledged, func(i, j int) bool {
+		return result.Acknowledged[i].Acknowledged < result.Acknowledged[j].Acknowledged
+	})
+	for _, user := range users {
+		if _, ok := acks[user.Identity]; !ok {
+			result.Pending = append(result.Pending, user)
+		}
+	}
+	sort.Slice(result.Pending, func(i, j int) bool {
+		return result.Pending[i].Name < result.Pending[j].Name
+	})
+	return result, nil
+}
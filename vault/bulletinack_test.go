@@ -0,0 +1,43 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBulletinAckIdentity(t *testing.T) {
+	Convey("Logins of the same entity should share an identity", t, func(c C) {
+		a, err := preferenceIdentityOf(map[string]interface{}{"entity_id": "e1", "display_name": "ldap-alice"})
+		c.So(err, ShouldBeNil)
+		b, err := preferenceIdentityOf(map[string]interface{}{"entity_id": "e1", "display_name": "userpass-alice"})
+		c.So(err, ShouldBeNil)
+		c.So(a, ShouldEqual, b)
+	})
+
+	Convey("Tokens without an entity should be told apart by accessor, not display name", t, func(c C) {
+		a, err := preferenceIdentityOf(map[string]interface{}{"accessor": "a1", "display_name": "token"})
+		c.So(err, ShouldBeNil)
+		b, err := preferenceIdentityOf(map[string]interface{}{"accessor": "a2", "display_name": "token"})
+		c.So(err, ShouldBeNil)
+		c.So(a, ShouldNotEqual, b)
+		_, err = preferenceIdentityOf(map[string]interface{}{"path": "auth/userpass/login/alice", "display_name": "userpass-alice"})
+		c.So(err, ShouldNotBeNil)
+	})
+
+	Convey("Known users should go stale once they stop logging in", t, func(c C) {
+		now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+		recent := KnownUser{Identity: "a", LastLogin: now.Add(-24 * time.Hour).Format(time.RFC3339)}
+		old := KnownUser{Identity: "a", LastLogin: now.Add(-knownUserRetention - time.Hour).Format(time.RFC3339)}
+		c.So(knownUserStale(recent, now), ShouldBeFalse)
+		c.So(knownUserStale(old, now), ShouldBeTrue)
+		c.So(knownUserStale(KnownUser{Identity: "a"}, now), ShouldBeTrue)
+	})
+
+	Convey("Bulletin names should not reach outside their entry", t, func(c C) {
+		c.So(validBulletinName("rotate-credentials"), ShouldBeNil)
+		c.So(validBulletinName(""), ShouldNotBeNil)
+		c.So(validBulletinName("../requests/abc"), ShouldNotBeNil)
+	})
+}
@@ -1,27 +1,46 @@
 package vault
 
-import ()
+import (
+	"errors"
+)
 
 func (auth AuthInfo) GetBulletins() ([]map[string]interface{}, error) {
+	results, _, err := auth.GetBulletinsWithin(0, Budget{})
+	return results, err
+}
+
+// reads bulletins starting at offset, until the budget runs out
+// if reading stopped early, the offset to continue from is returned, otherwise -1
+func (auth AuthInfo) GetBulletinsWithin(offset int, budget Budget) ([]map[string]interface{}, int, error) {
 	c := GetConfig()
 
 	bulletins, err := auth.ListSecret(c.BulletinPath)
 	if err != nil {
-		return nil, err
+		return nil, -1, err
+	}
+	if offset > len(bulletins) {
+		return nil, -1, errors.New("Offset out of bound")
 	}
 
-	results := make([]map[string]interface{}, len(bulletins))
-	for i, bulletin := range bulletins {
+	results := make([]map[string]interface{}, 0, len(bulletins)-offset)
+	for i, bulletin := range bulletins[offset:] {
+		if budget.Exceeded() {
+			return results, offset + i, nil
+		}
+		var data map[string]interface{}
 		b, ok := bulletin.(string)
 		if ok {
-			data, err := auth.ReadSecret(c.BulletinPath + b)
+			data, err = auth.ReadSecret(c.BulletinPath + b)
 			if err != nil {
-				return nil, err
-			} else {
-				results[i] = data
+				return nil, -1, err
+			}
+			// the bulletin's key, which acknowledgements refer to
+			if _, taken := data["id"]; data != nil && !taken {
+				data["id"] = b
 			}
 		}
+		results = append(results, data)
 	}
 
-	return results, nil
+	return results, -1, nil
 }
@@ -0,0 +1,103 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// one policy's part of a policy request. Requests that change several policies
+// keep the first in their own fields, and the rest as a bundle of these
+type PolicyChange struct {
+	Policy  string `json:"policy"`
+	Current string `json:"current"`
+	New     string `json:"new"`
+}
+
+// writes policies on behalf of an approved request. AuthInfo is one, for generated root tokens
+type PolicyWriter interface {
+	PutPolicy(name, rules string) error
+	DeletePolicy(name string) error
+}
+
+// writes policies with goldfish's own token on a cluster
+type goldfishPolicyWriter struct {
+	client *api.Client
+}
+
+func (writer goldfishPolicyWriter) PutPolicy(name, rules string) error {
+	return writer.client.Sys().PutPolicy(name, rules)
+}
+
+func (writer goldfishPolicyWriter) DeletePolicy(name string) error {
+	return writer.client.Sys().DeletePolicy(name)
+}
+
+func EncodePolicyBundle(changes []PolicyChange) (string, error) {
+	if len(changes) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(changes)
+	return string(raw), err
+}
+
+func DecodePolicyBundle(raw string) ([]PolicyChange, error) {
+	changes := []PolicyChange{}
+	if raw == "" {
+		return changes, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &changes); err != nil {
+		return nil, errors.New("Request bundle appears to be malformed")
+	}
+	for _, change := range changes {
+		if change.Policy == "" {
+			return nil, errors.New("Request bundle appears to be malformed")
+		}
+	}
+	return changes, nil
+}
+
+// writes every change, or none of them. If a write fails, the policies already written
+// are put back as they were, and any that could not be restored are named in the error
+func ApplyPolicyChanges(writer PolicyWriter, changes []PolicyChange) error {
+	for i, change := range changes {
+		err := writer.PutPolicy(change.Policy, change.New)
+		if err == nil {
+			continue
+		}
+
+		unrestored := []string{}
+		for j := i - 1; j >= 0; j-- {
+			if rollbackPolicyChange(writer, changes[j]) != nil {
+				unrestored = append(unrestored, changes[j].Policy)
+			}
+		}
+		if len(unrestored) > 0 {
+			return fmt.Errorf("Could not write policy %s: %v. Policies %s could not be restored",
+				change.Policy, err, strings.Join(unrestored, ", "))
+		}
+		return fmt.Errorf("Could not write policy %s: %v. No policies were changed", change.Policy, err)
+	}
+	return nil
+}
+
+// policies that did not exist before the request are removed again
+func rollbackPolicyChange(writer PolicyWriter, change PolicyChange) error {
+	if change.Current == "" {
+		return writer.DeletePolicy(change.Policy)
+	}
+	return writer.PutPolicy(change.Policy, change.Current)
+}
+
+// writes every change with goldfish's own token on the request's cluster and namespace,
+// once the request has been approved
+func ApplyApprovedPolicyChanges(cluster, namespace string, changes []PolicyChange) error {
+	client, err := serverClient(cluster, namespace)
+	if err != nil {
+		return err
+	}
+	return ApplyPolicyChanges(goldfishPolicyWriter{client: client}, changes)
+}
@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// records policies in memory, failing writes to the named policy
+type fakePolicyWriter struct {
+	policies map[string]string
+	failOn   string
+}
+
+func (w *fakePolicyWriter) PutPolicy(name, rules string) error {
+	if name == w.failOn {
+		return errors.New("permission denied")
+	}
+	w.policies[name] = rules
+	return nil
+}
+
+func (w *fakePolicyWriter) DeletePolicy(name string) error {
+	delete(w.policies, name)
+	return nil
+}
+
+func TestApplyPolicyChanges(t *testing.T) {
+	changes := []PolicyChange{
+		{Policy: "alpha", Current: "alpha-old", New: "alpha-new"},
+		{Policy: "beta", Current: "", New: "beta-new"},
+		{Policy: "gamma", Current: "gamma-old", New: "gamma-new"},
+	}
+	original := func() map[string]string {
+		return map[string]string{"alpha": "alpha-old", "gamma": "gamma-old"}
+	}
+
+	Convey("Every change should be written", t, func(c C) {
+		writer := &fakePolicyWriter{policies: original()}
+		c.So(ApplyPolicyChanges(writer, changes), ShouldBeNil)
+		c.So(writer.policies, ShouldResemble, map[string]string{
+			"alpha": "alpha-new", "beta": "beta-new", "gamma": "gamma-new",
+		})
+	})
+
+	Convey("A failed write should undo the changes before it", t, func(c C) {
+		writer := &fakePolicyWriter{policies: original(), failOn: "gamma"}
+		err := ApplyPolicyChanges(writer, changes)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "No policies were changed")
+		c.So(writer.policies, ShouldResemble, original())
+	})
+}
+
+func TestPolicyBundle(t *testing.T) {
+	Convey("Bundles should survive encoding", t, func(c C) {
+		changes := []PolicyChange{{Policy: "alpha", Current: "a", New: "b"}}
+		raw, err := EncodePolicyBundle(changes)
+		c.So(err, ShouldBeNil)
+		decoded, err := DecodePolicyBundle(raw)
+		c.So(err, ShouldBeNil)
+		c.So(decoded, ShouldResemble, changes)
+	})
+
+	Convey("An empty bundle should encode as nothing", t, func(c C) {
+		raw, err := EncodePolicyBundle(nil)
+		c.So(err, ShouldBeNil)
+		c.So(raw, ShouldEqual, "")
+		decoded, err := DecodePolicyBundle("")
+		c.So(err, ShouldBeNil)
+		c.So(decoded, ShouldBeEmpty)
+	})
+
+	Convey("Changes without a policy name should be rejected", t, func(c C) {
+		_, err := DecodePolicyBundle(`[{"current":"a","new":"b"}]`)
+		c.So(err, ShouldNotBeNil)
+		_, err = DecodePolicyBundle(`not json`)
+		c.So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,131 @@
+package vault
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// the outcome of submitting a key share to a rekey. Once complete, Keys holds the new
+// shares, each PGP encrypted by vault for its holder. Ceremonies run on the session's cluster
+type RekeyProgress struct {
+	Status          *api.RekeyStatusResponse `json:"status,omitempty"`
+	Complete        bool                     `json:"complete"`
+	Keys            []string                 `json:"keys,omitempty"`
+	PGPFingerprints []string                 `json:"pgp_fingerprints,omitempty"`
+}
+
+// the outcome of submitting a key share to a root generation. Once complete, the root
+// token is encoded with the initiator's one time password or PGP key, which goldfish
+// never sees, so only the initiator can decode it
+type GenerateRootProgress struct {
+	Status           *api.GenerateRootStatusResponse `json:"status"`
+	EncodedRootToken string                          `json:"encoded_root_token,omitempty"`
+}
+
+func RekeyStatus(cluster string) (*api.RekeyStatusResponse, error) {
+	client, err := clusterClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return client.Sys().RekeyStatus()
+}
+
+// starts a rekey. Each new share is PGP encrypted for its holder, so whoever submits
+// the last share of the current key can't read the new ones
+func RekeyInit(cluster string, shares, threshold int, pgpKeys []string) (*api.RekeyStatusResponse, error) {
+	if threshold < 1 || shares < threshold {
+		return nil, errors.New("The threshold must be at least 1, and no more than the number of shares")
+	}
+	if len(pgpKeys) != shares {
+		return nil, errors.New("One PGP key is needed for each share")
+	}
+	client, err := clusterClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return client.Sys().RekeyInit(&api.RekeyInitRequest{
+		SecretShares:    shares,
+		SecretThreshold: threshold,
+		PGPKeys:         pgpKeys,
+	})
+}
+
+// submits a share of the current key. When the last one is in, the new encrypted shares are returned
+func RekeyUpdate(cluster, share, nonce string) (*RekeyProgress, error) {
+	if share == "" || nonce == "" {
+		return nil, errors.New("Key share and nonce are required")
+	}
+	client, err := clusterClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Sys().RekeyUpdate(share, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Complete {
+		status, err := client.Sys().RekeyStatus()
+		if err != nil {
+			return nil, err
+		}
+		return &RekeyProgress{Status: status}, nil
+	}
+	// a rekey started outside goldfish may not use PGP, and its shares are not handed out
+	if len(resp.PGPFingerprints) == 0 {
+		return nil, errors.New("The rekey completed without PGP keys, so its new shares are not shown")
+	}
+	return &RekeyProgress{
+		Complete:        true,
+		Keys:            resp.KeysB64,
+		PGPFingerprints: resp.PGPFingerprints,
+	}, nil
+}
+
+func RekeyCancel(cluster string) error {
+	client, err := clusterClient(cluster)
+	if err != nil {
+		return err
+	}
+	return client.Sys().RekeyCancel()
+}
+
+// starts a root generation, encoding the root token with either the initiator's one
+// time password, 16 random bytes in base64, or their PGP key. goldfish keeps neither
+func StartGenerateRoot(cluster, otp, pgpKey string) (*api.GenerateRootStatusResponse, error) {
+	if (otp == "") == (pgpKey == "") {
+		return nil, errors.New("Either a one time password or a PGP key is required")
+	}
+	if otp != "" {
+		if raw, err := base64.StdEncoding.DecodeString(otp); err != nil || len(raw) != 16 {
+			return nil, errors.New("The one time password must be 16 random bytes, base64 encoded")
+		}
+	}
+	client, err := clusterClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return client.Sys().GenerateRootInit(otp, pgpKey)
+}
+
+// submits an unseal key share. When the last one is in, the encoded root token is returned,
+// which only the initiator can decode
+func SubmitGenerateRoot(cluster, share, nonce string) (*GenerateRootProgress, error) {
+	if share == "" || nonce == "" {
+		return nil, errors.New("Key share and nonce are required")
+	}
+	status, err := GenerateRootUpdate(cluster, share, nonce)
+	if err != nil {
+		return nil, err
+	}
+	progress := &GenerateRootProgress{Status: status}
+	if status.Complete {
+		progress.EncodedRootToken = status.EncodedRootToken
+	}
+	return progress, nil
+}
+
+func CancelGenerateRoot(cluster string) error {
+	return GenerateRootCancel(cluster)
+}
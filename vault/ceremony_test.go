@@ -0,0 +1,39 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRekeyInitValidation(t *testing.T) {
+	Convey("Thresholds above the number of shares should be rejected", t, func(c C) {
+		_, err := RekeyInit("", 3, 5, nil)
+		c.So(err, ShouldNotBeNil)
+		_, err = RekeyInit("", 3, 0, nil)
+		c.So(err, ShouldNotBeNil)
+	})
+
+	Convey("Every share should need its own PGP key", t, func(c C) {
+		_, err := RekeyInit("", 3, 2, []string{"key1", "key2"})
+		c.So(err, ShouldNotBeNil)
+		_, err = RekeyInit("", 3, 2, nil)
+		c.So(err, ShouldNotBeNil)
+	})
+
+	Convey("Root generation should need exactly one of a one time password and a PGP key", t, func(c C) {
+		_, err := StartGenerateRoot("", "", "")
+		c.So(err, ShouldNotBeNil)
+		_, err = StartGenerateRoot("", "MTIzNDU2Nzg5MDEyMzQ1Ng==", "key")
+		c.So(err, ShouldNotBeNil)
+		_, err = StartGenerateRoot("", "c2hvcnQ=", "")
+		c.So(err, ShouldNotBeNil)
+	})
+
+	Convey("Submitting a share should need the operation's nonce", t, func(c C) {
+		_, err := RekeyUpdate("", "share", "")
+		c.So(err, ShouldNotBeNil)
+		_, err = SubmitGenerateRoot("", "share", "")
+		c.So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,195 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"text/template"
+
+	"github.com/caiyeon/goldfish/slack"
+	"github.com/caiyeon/goldfish/teams"
+)
+
+// chat channels are notified of the same events as webhooks, of bulletin posts,
+// and, if they subscribe to it, of destructive actions and the reasons given for them
+const (
+	ChatBulletin    = "bulletin"
+	ChatDestructive = "destructive"
+)
+
+// events a channel receives when it does not list any
+var defaultChatEvents = []string{RequestCreated, RequestApproved, ChatBulletin}
+
+// messages used for events a channel has no template for
+var defaultChatTemplates = map[string]string{
+	RequestCreated:  "*{{.Actor}}* requested a change to *{{.Policy}}*\nChange ID: *{{.ChangeID}}*",
+	RequestApproved: "*{{.Actor}}* approved the change to *{{.Policy}}*{{if .Detail}} ({{.Detail}}){{end}}\nChange ID: *{{.ChangeID}}*",
+	ChatBulletin:    "*{{.Title}}*\n{{.Message}}",
+	ChatDestructive: "*{{.Actor}}* {{.Title}}\nReason: {{.Message}}",
+	"":              "The change to *{{.Policy}}* was {{.Event}}{{if .Actor}} by {{.Actor}}{{end}}{{if .Detail}} ({{.Detail}}){{end}}\nChange ID: *{{.ChangeID}}*",
+}
+
+// a Slack or Microsoft Teams incoming webhook that receives chat messages
+// Templates maps events to Go templates of the message, rendered with a ChatMessage
+type ChatChannel struct {
+	Name    string `json:"-"`
+	Type    string `json:"type"`
+	Webhook string `json:"webhook"`
+	// slack only, overrides the webhook's default channel
+	Channel   string            `json:"channel"`
+	Events    []string          `json:"events"`
+	Templates map[string]string `json:"templates"`
+
+	templates map[string]*template.Template
+}
+
+// what chat templates are rendered with. Bulletins and destructive actions only fill
+// Title, Message and Actor
+type ChatMessage struct {
+	Event    string
+	ChangeID string
+	Policy   string
+	Actor    string
+	Detail   string
+	Title    string
+	Message  string
+}
+
+func parseChatChannels(raw string) (map[string]*ChatChannel, error) {
+	channels := map[string]*ChatChannel{}
+	if raw == "" {
+		return channels, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &channels); err != nil {
+		return nil, errors.New("ChatChannels must be a JSON object of channel names to webhooks")
+	}
+	known := append([]string{ChatBulletin, ChatDestructive}, webhookEvents...)
+	for name, ch := range channels {
+		if ch == nil {
+			return nil, errors.New("ChatChannels: " + name + " must have a webhook")
+		}
+		switch ch.Type {
+		case "slack":
+			// same rule as SlackWebhook
+			if !strings.HasPrefix(ch.Webhook, "https://hooks.slack.com/services") {
+				return nil, errors.New("ChatChannels: " + name + " must be a https://hooks.slack.com/services webhook")
+			}
+		case "teams":
+			if !strings.HasPrefix(ch.Webhook, "https://") {
+				return nil, errors.New("ChatChannels: " + name + " must have an https:// webhook")
+			}
+		default:
+			return nil, errors.New("ChatChannels: " + name + " type must be slack or teams")
+		}
+		if len(ch.Events) == 0 {
+			ch.Events = defaultChatEvents
+		}
+		for _, event := range ch.Events {
+			if !containsString(known, event) {
+				return nil, errors.New("ChatChannels: " + name + " events may only be " + strings.Join(known, ", "))
+			}
+		}
+
+		ch.templates = map[string]*template.Template{}
+		for event, text := range ch.Templates {
+			if !containsString(known, event) {
+				return nil, errors.New("ChatChannels: " + name + " has a template for unknown event " + event)
+			}
+			t, err := template.New(event).Parse(text)
+			if err != nil {
+				return nil, errors.New("ChatChannels: " + name + " template for " + event + " is invalid: " + err.Error())
+			}
+			ch.templates[event] = t
+		}
+		ch.Name = name
+	}
+	return channels, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// renders the channel's template for the message's event, or the default one
+func (ch ChatChannel) render(message ChatMessage) (string, error) {
+	t, ok := ch.templates[message.Event]
+	if !ok {
+		text, ok := defaultChatTemplates[message.Event]
+		if !ok {
+			text = defaultChatTemplates[""]
+		}
+		t = template.Must(template.New(message.Event).Parse(text))
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, message); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func chatTitle(event string) string {
+	if event == ChatBulletin {
+		return "A new bulletin has been posted"
+	}
+	if event == ChatDestructive {
+		return "A destructive action was taken"
+	}
+	return "Policy change request " + event
+}
+
+// sends a message to every chat channel subscribed to its event, in the background
+func notifyChatChannels(message ChatMessage) {
+	configLock.RLock()
+	channels := chatChannels
+	configLock.RUnlock()
+
+	for _, ch := range channels {
+		if !containsString(ch.Events, message.Event) {
+			continue
+		}
+		go func(ch ChatChannel) {
+			if err := postChatMessage(ch, message); err != nil {
+				log.Println("[ERROR]: Could not notify chat channel", ch.Name+":", err.Error())
+			}
+		}(*ch)
+	}
+}
+
+func postChatMessage(ch ChatChannel, message ChatMessage) error {
+	text, err := ch.render(message)
+	if err != nil {
+		return err
+	}
+	if ch.Type == "teams" {
+		return teams.PostMessageWebhook(chatTitle(message.Event), text, ch.Webhook)
+	}
+	return slack.PostMessageWebhook(ch.Channel, chatTitle(message.Event), text, ch.Webhook)
+}
+
+// tells chat channels that a bulletin was posted
+func NotifyBulletin(title, message, author string) {
+	notifyChatChannels(ChatMessage{
+		Event:   ChatBulletin,
+		Actor:   author,
+		Title:   title,
+		Message: message,
+	})
+}
+
+// tells chat channels subscribed to destructive actions that one was taken, and why
+func NotifyDestructiveAction(action, actor, reason string) {
+	notifyChatChannels(ChatMessage{
+		Event:   ChatDestructive,
+		Actor:   actor,
+		Title:   action,
+		Message: reason,
+	})
+}
@@ -0,0 +1,62 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseChatChannels(t *testing.T) {
+	Convey("Slack and Teams channels should be parsed", t, func(c C) {
+		channels, err := parseChatChannels(`{
+			"ops": {"type": "slack", "webhook": "https://hooks.slack.com/services/T0/B0/x", "channel": "#ops"},
+			"security": {"type": "teams", "webhook": "https://example.webhook.office.com/webhookb2/x", "events": ["applied"]}
+		}`)
+		c.So(err, ShouldBeNil)
+		c.So(channels["ops"].Events, ShouldResemble, defaultChatEvents)
+		c.So(channels["security"].Events, ShouldResemble, []string{RequestApplied})
+	})
+
+	Convey("Unknown types, bad webhooks and broken templates should be rejected", t, func(c C) {
+		_, err := parseChatChannels(`{"a": {"type": "irc", "webhook": "https://example.com"}}`)
+		c.So(err, ShouldNotBeNil)
+		_, err = parseChatChannels(`{"a": {"type": "slack", "webhook": "https://example.com"}}`)
+		c.So(err, ShouldNotBeNil)
+		_, err = parseChatChannels(`{"a": {"type": "teams", "webhook": "http://example.com"}}`)
+		c.So(err, ShouldNotBeNil)
+		_, err = parseChatChannels(`{"a": {"type": "teams", "webhook": "https://example.com", "templates": {"created": "{{.Policy"}}}`)
+		c.So(err, ShouldNotBeNil)
+		_, err = parseChatChannels(`{"a": {"type": "teams", "webhook": "https://example.com", "events": ["deleted"]}}`)
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRenderChatMessage(t *testing.T) {
+	channels, err := parseChatChannels(`{
+		"ops": {"type": "teams", "webhook": "https://example.com", "templates": {"created": "{{.Actor}} wants {{.Policy}} changed"}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := channels["ops"]
+
+	Convey("Channel templates should be used for their event", t, func(c C) {
+		text, err := ch.render(ChatMessage{Event: RequestCreated, Actor: "alice", Policy: "ops"})
+		c.So(err, ShouldBeNil)
+		c.So(text, ShouldEqual, "alice wants ops changed")
+	})
+
+	Convey("Other events should use the default templates", t, func(c C) {
+		text, err := ch.render(ChatMessage{Event: ChatBulletin, Title: "Maintenance", Message: "Vault restarts at noon"})
+		c.So(err, ShouldBeNil)
+		c.So(text, ShouldEqual, "*Maintenance*\nVault restarts at noon")
+
+		text, err = ch.render(ChatMessage{Event: RequestExpired, ChangeID: "abc", Policy: "ops", Actor: "goldfish"})
+		c.So(err, ShouldBeNil)
+		c.So(text, ShouldContainSubstring, "was expired by goldfish")
+
+		text, err = ch.render(ChatMessage{Event: ChatDestructive, Actor: "alice", Title: "disabled mount old/", Message: "decommissioned"})
+		c.So(err, ShouldBeNil)
+		c.So(text, ShouldEqual, "*alice* disabled mount old/\nReason: decommissioned")
+	})
+}
@@ -0,0 +1,225 @@
+package vault
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/caiyeon/goldfish/metrics"
+	"github.com/hashicorp/vault/api"
+)
+
+// another vault cluster that sessions may log in to instead of the one goldfish runs on
+// goldfish's own state, such as requests and the runtime config, stays on the default cluster
+type cluster struct {
+	address string
+	skipTLS bool
+	// server token from the cluster's approle, empty if it has none
+	token string
+}
+
+// a cluster as shown to users. The default cluster has an empty name
+type ClusterInfo struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+var (
+	clustersLock = sync.RWMutex{}
+	clusters     = map[string]*cluster{}
+)
+
+// makes a cluster available to sessions
+func AddCluster(name, address string, skipTLS bool) error {
+	if name == "" {
+		return errors.New("Cluster name is required")
+	}
+	clustersLock.Lock()
+	defer clustersLock.Unlock()
+	if _, ok := clusters[name]; ok {
+		return errors.New("Cluster " + name + " is defined more than once")
+	}
+	clusters[name] = &cluster{address: address, skipTLS: skipTLS}
+	return nil
+}
+
+// logs in to a cluster's approle with the wrapped secret_id, like goldfish does on its
+// default cluster. The server token is then kept renewed
+func StartClusterWrapper(name, wrappingToken, login, id string) error {
+	c, err := lookupCluster(name)
+	if err != nil {
+		return err
+	}
+	client, err := newClusterClient(c, "", requestContext{}, nil, nil)
+	if err != nil {
+		return err
+	}
+	auth, err := approleLogin(client, wrappingToken, login, id)
+	if err != nil {
+		return errors.New("Cluster " + name + ": " + err.Error())
+	}
+	log.Println("[INFO ]: Server token accessor of cluster", name+":", auth.Accessor)
+	return setClusterToken(name, auth.ClientToken)
+}
+
+// carries on with a cluster's server token handed over by a previous goldfish process
+func ResumeClusterWrapper(name, token string) error {
+	c, err := lookupCluster(name)
+	if err != nil {
+		return err
+	}
+	client, err := newClusterClient(c, "", requestContext{}, nil, nil)
+	if err != nil {
+		return err
+	}
+	client.SetToken(token)
+	if err := retryStartup("Verifying the handed over server token of cluster "+name, func() error {
+		_, err := client.Auth().Token().LookupSelf()
+		return err
+	}); err != nil {
+		return err
+	}
+	return setClusterToken(name, token)
+}
+
+func setClusterToken(name, token string) error {
+	clustersLock.Lock()
+	defer clustersLock.Unlock()
+	c, ok := clusters[name]
+	if !ok {
+		return errors.New("Unknown cluster " + name)
+	}
+	c.token = token
+	return nil
+}
+
+// the server tokens of the clusters that have one, for handing over to an upgraded process
+func ClusterTokens() map[string]string {
+	clustersLock.RLock()
+	defer clustersLock.RUnlock()
+	tokens := map[string]string{}
+	for name, c := range clusters {
+		if c.token != "" {
+			tokens[name] = c.token
+		}
+	}
+	return tokens
+}
+
+func revokeClusterTokens() error {
+	clustersLock.Lock()
+	defer clustersLock.Unlock()
+	for name, c := range clusters {
+		if c.token == "" {
+			continue
+		}
+		client, err := newClusterClient(c, "", requestContext{}, nil, nil)
+		if err != nil {
+			return err
+		}
+		client.SetToken(c.token)
+		if err := client.Auth().Token().RevokeSelf(""); err != nil {
+			return errors.New("Could not revoke server token of cluster " + name + ": " + err.Error())
+		}
+		c.token = ""
+	}
+	return nil
+}
+
+// the default cluster, followed by the others in order of name
+func ListClusters() []ClusterInfo {
+	clustersLock.RLock()
+	defer clustersLock.RUnlock()
+	names := make([]string, 0, len(clusters))
+	for name := range clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := []ClusterInfo{{Address: VaultAddress}}
+	for _, name := range names {
+		results = append(results, ClusterInfo{Name: name, Address: clusters[name].address})
+	}
+	return results
+}
+
+// the cluster a session works on. The empty name is the default cluster
+func lookupCluster(name string) (*cluster, error) {
+	if name == "" {
+		return &cluster{address: VaultAddress, skipTLS: VaultSkipTLS}, nil
+	}
+	clustersLock.RLock()
+	defer clustersLock.RUnlock()
+	c, ok := clusters[name]
+	if !ok {
+		return nil, errors.New("Unknown cluster " + name)
+	}
+	return c, nil
+}
+
+// the address of the cluster a session works on
+func (auth AuthInfo) ClusterAddress() string {
+	if c, err := lookupCluster(auth.Cluster); err == nil {
+		return c.address
+	}
+	return VaultAddress
+}
+
+func renewClusterTokens() error {
+	clustersLock.RLock()
+	defer clustersLock.RUnlock()
+	for name, c := range clusters {
+		if c.token == "" {
+			continue
+		}
+		client, err := newClusterClient(c, "", requestContext{}, nil, nil)
+		if err != nil {
+			return err
+		}
+		client.SetToken(c.token)
+		if _, err := client.Auth().Token().RenewSelf(0); err != nil {
+			metrics.TokenRenewalFailures.Inc(name)
+			return errors.New("Could not renew server token of cluster " + name + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// a client of the named cluster, without a token, for the unauthenticated sys endpoints
+func clusterClient(name string) (*api.Client, error) {
+	c, err := lookupCluster(name)
+	if err != nil {
+		return nil, err
+	}
+	return newClusterClient(c, "", requestContext{}, nil, nil)
+}
+
+// a client of the named cluster with goldfish's server token on it, for applying approved
+// requests made on that cluster. Its requests are made in the namespace, if given
+func serverClient(name, namespace string) (*api.Client, error) {
+	if name == "" {
+		client, err := newVaultClient(namespace, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		client.SetToken(ServerToken())
+		return client, nil
+	}
+	c, err := lookupCluster(name)
+	if err != nil {
+		return nil, err
+	}
+	clustersLock.RLock()
+	token := c.token
+	clustersLock.RUnlock()
+	if token == "" {
+		return nil, errors.New("Cluster " + name + " has no server token, so goldfish can't make changes on it")
+	}
+	client, err := newClusterClient(c, namespace, requestContext{}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(token)
+	return client, nil
+}
@@ -0,0 +1,30 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClusters(t *testing.T) {
+	Convey("Sessions without a cluster should use the default one", t, func(c C) {
+		cluster, err := lookupCluster("")
+		c.So(err, ShouldBeNil)
+		c.So(cluster.address, ShouldEqual, VaultAddress)
+	})
+
+	Convey("Added clusters should be listed after the default cluster", t, func(c C) {
+		c.So(AddCluster("test-staging", "https://vault.staging:8200", false), ShouldBeNil)
+		c.So(AddCluster("test-staging", "https://vault.other:8200", false), ShouldNotBeNil)
+
+		list := ListClusters()
+		c.So(list[0].Name, ShouldEqual, "")
+		c.So(list, ShouldContain, ClusterInfo{Name: "test-staging", Address: "https://vault.staging:8200"})
+		c.So(AuthInfo{Cluster: "test-staging"}.ClusterAddress(), ShouldEqual, "https://vault.staging:8200")
+	})
+
+	Convey("Unknown clusters should be rejected", t, func(c C) {
+		_, err := lookupCluster("test-missing")
+		c.So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,266 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// a goldfish feature that depends on a minimum vault version
+type Feature struct {
+	Name        string
+	Description string
+	MinVersion  string
+	// goldfish api routes that depend on the feature, matched by prefix
+	Endpoints []string `json:"-"`
+}
+
+// a published vault vulnerability. Fixed holds the first patched release of each
+// maintained minor series, any version below the matching fix is affected
+type Advisory struct {
+	ID         string
+	Summary    string
+	Introduced string
+	Fixed      []string
+}
+
+// keep in ascending order of MinVersion
+var featureMatrix = []Feature{
+	{
+		Name:        "response-wrapping",
+		Description: "Wrapping and unwrapping arbitrary data, and detecting expired wrapping tokens",
+		MinVersion:  "0.6.2",
+		Endpoints:   []string{"/api/wrapping", "/api/maintenance/gc"},
+	},
+	{
+		Name:        "ssh-ca",
+		Description: "Signing ssh keys with the ssh backend's certificate authority",
+		MinVersion:  "0.7.0",
+		Endpoints:   []string{"/api/ssh/sign/", "/api/ssh/ca"},
+	},
+	{
+		Name:        "database",
+		Description: "Dynamic credentials from the combined database backend",
+		MinVersion:  "0.7.1",
+		Endpoints:   []string{"/api/database/"},
+	},
+	{
+		Name:        "gcp",
+		Description: "Dynamic credentials from the gcp secret backend",
+		MinVersion:  "0.10.0",
+		Endpoints:   []string{"/api/gcp/"},
+	},
+	{
+		Name:        "kv-versioning",
+		Description: "Version history of secrets when copying, moving and exporting kv mounts",
+		MinVersion:  "0.10.0",
+	},
+	{
+		Name:        "azure",
+		Description: "Dynamic credentials from the azure secret backend",
+		MinVersion:  "0.11.0",
+		Endpoints:   []string{"/api/azure/"},
+	},
+}
+
+// bundled with each release, and not a substitute for hashicorp's security advisories
+var advisories = []Advisory{
+	{
+		ID:         "CVE-2018-19786",
+		Summary:    "Master key may be written to the server log when an autoseal returns incorrect data",
+		Introduced: "0.9.0",
+		Fixed:      []string{"1.0.0"},
+	},
+	{
+		ID:         "CVE-2020-16250",
+		Summary:    "AWS IAM auth method can be bypassed by spoofing the server id header",
+		Introduced: "0.7.1",
+		Fixed:      []string{"1.2.5", "1.3.8", "1.4.4", "1.5.1"},
+	},
+	{
+		ID:         "CVE-2020-16251",
+		Summary:    "GCP IAM auth method can be bypassed with a token for an unbound service account",
+		Introduced: "0.8.3",
+		Fixed:      []string{"1.2.5", "1.3.8", "1.4.4", "1.5.1"},
+	},
+	{
+		ID:         "CVE-2021-3024",
+		Summary:    "Internal IP address of the node is disclosed in responses to some invalid requests",
+		Introduced: "0.0.0",
+		Fixed:      []string{"1.5.7", "1.6.2"},
+	},
+	{
+		ID:         "CVE-2023-24999",
+		Summary:    "AppRole secret id accessors can be used to delete secret ids of other roles",
+		Introduced: "0.0.0",
+		Fixed:      []string{"1.11.8", "1.12.4", "1.13.0"},
+	},
+}
+
+// the connected server's version is cached, since it only changes on upgrade. Failures are
+// cached briefly too, so an unreachable vault isn't asked on every request
+const (
+	vaultVersionRefresh      = 10 * time.Minute
+	vaultVersionErrorRefresh = 30 * time.Second
+	vaultVersionTimeout      = 5 * time.Second
+)
+
+var (
+	vaultVersionLock    sync.Mutex
+	vaultVersion        string
+	vaultVersionErr     error
+	vaultVersionFetched time.Time
+)
+
+// returns the version reported by the vault server's health endpoint
+func VaultVersion() (string, error) {
+	vaultVersionLock.Lock()
+	if vaultVersionErr != nil && time.Since(vaultVersionFetched) < vaultVersionErrorRefresh {
+		defer vaultVersionLock.Unlock()
+		return "", vaultVersionErr
+	}
+	if vaultVersion != "" && time.Since(vaultVersionFetched) < vaultVersionRefresh {
+		defer vaultVersionLock.Unlock()
+		return vaultVersion, nil
+	}
+	// not held while vault is asked, so a slow vault doesn't hold up every request
+	vaultVersionLock.Unlock()
+
+	version, err := fetchVaultVersion()
+
+	vaultVersionLock.Lock()
+	defer vaultVersionLock.Unlock()
+	vaultVersionErr = err
+	vaultVersionFetched = time.Now()
+	if err != nil {
+		return "", err
+	}
+	vaultVersion = version
+	return version, nil
+}
+
+func fetchVaultVersion() (string, error) {
+	client, err := vaultHTTPClient(vaultVersionTimeout)
+	if err != nil {
+		return "", err
+	}
+	// standby and sealed servers respond with a non-200 code, but still report a version
+	resp, err := client.Get(VaultAddress + "/v1/sys/health?standbyok=true")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var health struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return "", err
+	}
+	if health.Version == "" {
+		return "", errors.New("Vault did not report its version")
+	}
+	return health.Version, nil
+}
+
+// a plain http client for vault's unauthenticated endpoints, trusting the same certificates
+// as the api clients: VAULT_CACERT and the like, or none at all with VaultSkipTLS
+func vaultHTTPClient(timeout time.Duration) (*http.Client, error) {
+	config := api.DefaultConfig()
+	if err := config.ConfigureTLS(&api.TLSConfig{Insecure: VaultSkipTLS}); err != nil {
+		return nil, err
+	}
+	config.HttpClient.Timeout = timeout
+	return config.HttpClient, nil
+}
+
+// lists features that are unavailable at the given vault version
+func UnavailableFeatures(version string) []Feature {
+	results := []Feature{}
+	for _, feature := range featureMatrix {
+		if compareVersions(version, feature.MinVersion) < 0 {
+			results = append(results, feature)
+		}
+	}
+	return results
+}
+
+// lists advisories that affect the given vault version
+func AffectingAdvisories(version string) []Advisory {
+	results := []Advisory{}
+	for _, advisory := range advisories {
+		if affects(advisory, version) {
+			results = append(results, advisory)
+		}
+	}
+	return results
+}
+
+// returns the feature an api route depends on, if it is unavailable at the given version
+func UnavailableFeatureForRoute(version, route string) (Feature, bool) {
+	for _, feature := range UnavailableFeatures(version) {
+		for _, endpoint := range feature.Endpoints {
+			if strings.HasPrefix(route, endpoint) {
+				return feature, true
+			}
+		}
+	}
+	return Feature{}, false
+}
+
+func affects(advisory Advisory, version string) bool {
+	if compareVersions(version, advisory.Introduced) < 0 {
+		return false
+	}
+	// a fix in the same minor series decides it
+	for _, fixed := range advisory.Fixed {
+		if sameMinor(version, fixed) {
+			return compareVersions(version, fixed) < 0
+		}
+	}
+	// otherwise the series is either unmaintained and affected, or newer than every fix
+	for _, fixed := range advisory.Fixed {
+		if compareVersions(version, fixed) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parses "0.9.1", "v0.9.1-rc1" or "0.9.1+ent" into its numeric components
+func parseVersion(version string) [3]int {
+	var result [3]int
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		version = version[:i]
+	}
+	for i, part := range strings.SplitN(version, ".", 3) {
+		result[i], _ = strconv.Atoi(part)
+	}
+	return result
+}
+
+// returns -1, 0 or 1 as a is older, equal or newer than b
+func compareVersions(a, b string) int {
+	va, vb := parseVersion(a), parseVersion(b)
+	for i := range va {
+		if va[i] < vb[i] {
+			return -1
+		}
+		if va[i] > vb[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+func sameMinor(a, b string) bool {
+	va, vb := parseVersion(a), parseVersion(b)
+	return va[0] == vb[0] && va[1] == vb[1]
+}
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/caiyeon/goldfish/schema"
 	"github.com/fatih/structs"
 	"github.com/mitchellh/hashstructure"
 )
@@ -28,15 +29,118 @@ type Config struct {
 	GithubPoliciesPath  string
 	GithubTargetBranch  string
 
+	// comma separated policies whose sessions are bound to the client's fingerprint
+	// "*" binds every session, empty disables binding
+	SessionBindingPolicies string
+	// comma separated request headers mixed into the fingerprint, besides User-Agent
+	SessionBindingHeaders  string
+
+	// comma separated path prefixes whose secrets need a second person's approval to read
+	ApprovalPaths       string
+
+	// comma separated path prefixes whose secrets may only be written or deleted through
+	// a request that others approve. goldfish's own token makes the change, so it needs
+	// write access to these paths, and users' policies can deny it to them
+	SecretRequestPaths  string
+	// how many people besides the requester must approve a secret request, 1 by default
+	SecretRequestApprovals string
+
+	// JSON object mapping secret path prefixes to JSON schemas
+	SecretSchemas       string
+
+	// JSON object mapping names to custom vault api calls, see CustomRequest
+	CustomRequests      string
+
+	// JSON object mapping tenant names to their scope, see Tenant
+	Tenants             string
+	// comma separated policies whose sessions are not confined to a tenant
+	TenantExemptPolicies string
+
+	// JSON object mapping approver group names to their members and required approvals,
+	// see ApproverGroup. goldfish's own token applies approved policies, so it needs
+	// write access to the policies that may be requested
+	ApproverGroups      string
+	// comma separated mounts, or "*" for all, that may only be tuned through a request
+	// approved by the approver groups. Needs ApproverGroups, and goldfish's own token
+	// must be able to tune these mounts
+	MountRequestMounts  string
+	// comma separated identity operations that may only be made through a request approved
+	// by the approver groups: create_token, create_secret_id, delete_user, write_approle and
+	// write_token_role. Needs ApproverGroups, and goldfish's own token makes the change
+	IdentityRequestOperations string
+
+	// comma separated policies whose sessions may generate replication secondary activation
+	// tokens, besides root. Vault enterprise only
+	ReplicationOperatorPolicies string
+
+	// how many days before the vault enterprise license expires that goldfish warns of it, 30 by default
+	LicenseWarningDays  string
+
+	// secret path holding policy templates, one per secret with policy, rules, variables
+	// and description fields, see PolicyTemplate. Read with the user's own token
+	PolicyTemplatePath  string
+
+	// how long a policy request may stay pending before it is rejected, as a duration
+	// empty or "0" keeps requests until someone acts on them
+	PolicyRequestTTL    string
+
+	// how long a session's token lookup is cached, as a duration. "0" disables the cache
+	TokenCacheTTL       string
+
+	// largest file, in bytes, that may be attached to a policy request
+	AttachmentMaxSize   string
+
+	// JSON object mapping webhook names to endpoints notified of policy request events,
+	// see Webhook. Each endpoint must be https, and its deliveries are signed with its secret
+	Webhooks            string
+	// JSON object mapping names to Slack or Microsoft Teams webhooks that receive chat messages
+	// about policy requests and bulletins, see ChatChannel
+	ChatChannels        string
+
+	// vault path holding the mail server goldfish emails through: host, port (587 by default),
+	// username, password and from. Read with goldfish's own token whenever an email is sent
+	SMTPPath            string
+	// comma separated addresses emailed when a policy request needs approval
+	ApproverEmails      string
+	// where users reach goldfish, e.g. https://goldfish.example.com, for links in emails
+	PublicURL           string
+
+	// https endpoint that receives captured requests as JSON while incident mode is on
+	IncidentSinkURL     string
+
+	// shared by goldfish replicas to sign requests forwarded to the coordinator
+	ReplicaSigningKey   string
+
+	// comma separated modules switched off for everyone, see Toggle: transit, secrets_write,
+	// user_creation, and writes, which leaves goldfish read-only
+	DisabledFeatures    string
+
+	// JSON object mapping goldfish roles (viewer, operator, admin) to the policies and identity
+	// groups given them, see RoleMapping. Once set, sessions can only reach the routes their
+	// role allows, whatever vault would let them do, and sessions without a role only log in
+	GoldfishRoles       string
+
 	// fields that goldfish will write
 	LastUpdated         string `hash:"ignore"`
 	GithubCurrentCommit string
+
+	// comma separated keys that were ServerTransitKey or UserTransitKey before a settings
+	// change. What was encrypted with them is still decrypted with them, so they must be kept
+	PreviousServerTransitKeys string
+	PreviousUserTransitKeys   string
 }
 
 var (
 	config              = Config{}
 	configLock          = new(sync.RWMutex)
 	configHash uint64   = 0
+	secretSchemas       = map[string]*schema.Schema{}
+	customRequests      = map[string]*CustomRequest{}
+	tenancy             = map[string]*Tenant{}
+	approverGroups      = map[string]*ApproverGroup{}
+	webhooks            = map[string]*Webhook{}
+	chatChannels        = map[string]*ChatChannel{}
+	roleMappings        = map[string]*RoleMapping{}
 	GithubCurrentCommit = ""
 )
 
@@ -46,32 +150,35 @@ func GetConfig() Config {
 	return config
 }
 
+// a runtime config, with what is parsed from its JSON fields
+type runtimeConfig struct {
+	config    Config
+	schemas   map[string]*schema.Schema
+	customs   map[string]*CustomRequest
+	tenants   map[string]*Tenant
+	approvers map[string]*ApproverGroup
+	hooks     map[string]*Webhook
+	channels  map[string]*ChatChannel
+	roles     map[string]*RoleMapping
+}
+
 func loadConfigFromVault(path string) error {
-	resp, err := vaultClient.Logical().Read(path)
+	resp, err := serverVaultClient().Logical().Read(path)
 	if err != nil {
 		return err
 	} else if resp == nil {
 		return errors.New("Failed to read config secret from vault")
 	}
+	return applyRuntimeConfig(path, resp.Data)
+}
 
-	// marshall into temp config to ensure it is valid
-	temp := Config{}
-	if b, err := json.Marshal(resp.Data); err == nil {
-		if err := json.Unmarshal(b, &temp); err != nil {
-			return err
-		}
-	} else {
+// checks the runtime config, and if it changed, writes it back timestamped and starts using it
+func applyRuntimeConfig(path string, data map[string]interface{}) error {
+	parsed, err := parseRuntimeConfig(data)
+	if err != nil {
 		return err
 	}
-
-	// the local copy of current commit is the source of truth
-	temp.GithubCurrentCommit = GithubCurrentCommit
-
-	// improperly formed slack webhooks are not allowed
-	if !strings.HasPrefix(temp.SlackWebhook, "https://hooks.slack.com/services") {
-		temp.SlackWebhook = ""
-		temp.SlackChannel = ""
-	}
+	temp := parsed.config
 
 	// don't waste a lock if nothing has changed
 	newHash, err := hashstructure.Hash(temp, nil)
@@ -85,7 +192,7 @@ func loadConfigFromVault(path string) error {
 	// timestamp the change in vault, notifying operators that the config has been updated
 	// if timestamp can't be written, operation should be aborted
 	temp.LastUpdated = time.Now().Format(time.UnixDate)
-	_, err = vaultClient.Logical().Write(path, structs.Map(temp))
+	_, err = serverVaultClient().Logical().Write(path, structs.Map(temp))
 	if err != nil {
 		return errors.New("As of v0.2.3, goldfish needs write permissions to the config_path vault endpoint.")
 	}
@@ -96,7 +203,148 @@ func loadConfigFromVault(path string) error {
 
 	config             = temp
 	configHash         = newHash
+	secretSchemas      = parsed.schemas
+	customRequests     = parsed.customs
+	tenancy            = parsed.tenants
+	approverGroups     = parsed.approvers
+	webhooks           = parsed.hooks
+	chatChannels       = parsed.channels
+	roleMappings       = parsed.roles
 
 	log.Println("Goldfish config reloaded")
 	return nil
 }
+
+// checks a runtime config as stored in vault, parsing its JSON fields
+func parseRuntimeConfig(data map[string]interface{}) (*runtimeConfig, error) {
+	// marshall into temp config to ensure it is valid
+	temp := Config{}
+	if b, err := json.Marshal(data); err == nil {
+		if err := json.Unmarshal(b, &temp); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	// the local copy of current commit is the source of truth
+	temp.GithubCurrentCommit = GithubCurrentCommit
+
+	// improperly formed slack webhooks are not allowed
+	if !strings.HasPrefix(temp.SlackWebhook, "https://hooks.slack.com/services") {
+		temp.SlackWebhook = ""
+		temp.SlackChannel = ""
+	}
+
+	// captured requests may only leave over https
+	if temp.IncidentSinkURL != "" && !strings.HasPrefix(temp.IncidentSinkURL, "https://") {
+		return nil, errors.New("IncidentSinkURL must be an https:// url")
+	}
+
+	if err := parseTokenCacheTTL(temp.TokenCacheTTL); err != nil {
+		return nil, err
+	}
+	if err := parseAttachmentMaxSize(temp.AttachmentMaxSize); err != nil {
+		return nil, err
+	}
+	if err := parseSecretRequestApprovals(temp.SecretRequestApprovals); err != nil {
+		return nil, err
+	}
+	if err := parseLicenseWarningDays(temp.LicenseWarningDays); err != nil {
+		return nil, err
+	}
+	if err := parsePolicyRequestTTL(temp.PolicyRequestTTL); err != nil {
+		return nil, err
+	}
+	if err := parseApproverEmails(temp.ApproverEmails); err != nil {
+		return nil, err
+	}
+	if err := parseDisabledFeatures(temp.DisabledFeatures); err != nil {
+		return nil, err
+	}
+	if temp.PublicURL != "" && !strings.HasPrefix(temp.PublicURL, "https://") && !strings.HasPrefix(temp.PublicURL, "http://") {
+		return nil, errors.New("PublicURL must be an http:// or https:// url")
+	}
+
+	// schemas must be valid, or secrets under them could never be written
+	schemas, err := parseSecretSchemas(temp.SecretSchemas)
+	if err != nil {
+		return nil, err
+	}
+	customs, err := parseCustomRequests(temp.CustomRequests)
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := parseTenants(temp.Tenants)
+	if err != nil {
+		return nil, err
+	}
+	approvers, err := parseApproverGroups(temp.ApproverGroups)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseMountRequestMounts(temp.MountRequestMounts, approvers); err != nil {
+		return nil, err
+	}
+	if err := parseIdentityRequestOperations(temp.IdentityRequestOperations, approvers); err != nil {
+		return nil, err
+	}
+	hooks, err := parseWebhooks(temp.Webhooks)
+	if err != nil {
+		return nil, err
+	}
+	channels, err := parseChatChannels(temp.ChatChannels)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := parseGoldfishRoles(temp.GoldfishRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runtimeConfig{
+		config:    temp,
+		schemas:   schemas,
+		customs:   customs,
+		tenants:   tenants,
+		approvers: approvers,
+		hooks:     hooks,
+		channels:  channels,
+		roles:     roles,
+	}, nil
+}
+
+func parseSecretSchemas(raw string) (map[string]*schema.Schema, error) {
+	schemas := map[string]*schema.Schema{}
+	if raw == "" {
+		return schemas, nil
+	}
+
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		return nil, errors.New("SecretSchemas must be a JSON object of path prefixes to schemas")
+	}
+	for prefix, rawSchema := range m {
+		s, err := schema.Parse(rawSchema)
+		if err != nil {
+			return nil, errors.New("SecretSchemas: invalid schema for " + prefix + ": " + err.Error())
+		}
+		schemas[prefix] = s
+	}
+	return schemas, nil
+}
+
+// returns the schema with the longest prefix matching the path, or nil if there is none
+func SecretSchema(path string) *schema.Schema {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	var match *schema.Schema
+	longest := -1
+	for prefix, s := range secretSchemas {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			match, longest = s, len(prefix)
+		}
+	}
+	return match
+}
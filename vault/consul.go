@@ -0,0 +1,39 @@
+package vault
+
+import (
+	"errors"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func init() {
+	RegisterSecretEngine("consul", credentialEngine{
+		description: EngineDescription{
+			Type:        "consul",
+			Name:        "Consul",
+			Description: "Dynamic Consul ACL tokens",
+		},
+		rolesPath: "roles",
+		credsPath: "creds",
+	})
+}
+
+func (auth AuthInfo) ListConsulRoles(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "consul") + "roles")
+}
+
+// role details include the token type and policies of generated tokens
+func (auth AuthInfo) ReadConsulRole(mount, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "consul") + "roles/" + name)
+}
+
+// generates an ACL token for the role. The secret carries the lease
+func (auth AuthInfo) GenerateConsulCredentials(mount, role string) (*api.Secret, error) {
+	if role == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.readCreds(mountPrefix(mount, "consul"), "creds/"+role)
+}
@@ -0,0 +1,251 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a request that vault enterprise held back for control group authorization
+// vault answered it with a wrapping token, which is kept encrypted until the requester,
+// once enough authorizers have approved, collects the response it wraps
+type ControlGroupRequest struct {
+	Accessor          string `json:"accessor"`
+	Path              string `json:"path"`
+	Requester         string `json:"requester"`
+	RequesterIdentity string `json:"requester_identity"`
+	Created           string `json:"created"`
+	Expires           string `json:"expires"`
+	WrappingToken     string `json:"wrapping_token,omitempty"`
+}
+
+// the wrap_info of a response, as sent by vault enterprise
+type controlGroupWrapInfo struct {
+	Token        string `json:"token"`
+	Accessor     string `json:"accessor"`
+	TTL          int    `json:"ttl"`
+	CreationPath string `json:"creation_path"`
+}
+
+var errMalformedControlGroupRequest = errors.New("Control group request appears to be malformed")
+
+// control group requests are recorded while handlers run, and collected from another
+var controlGroupsLock = sync.Mutex{}
+
+// controlGroupTransport notices responses that vault wrapped without being asked to,
+// which is how control groups hold a request back. The wrapping token is stored for the
+// requester, and the handler sees an error saying authorization is required
+type controlGroupTransport struct {
+	base http.RoundTripper
+	// lookup-self data of the client's token, nil until it has been looked up
+	self map[string]interface{}
+}
+
+func (t *controlGroupTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || t.self == nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	// wrapping that was asked for, or the wrapping endpoints themselves, are not control groups
+	// raft snapshots are streamed rather than read into memory, and are never wrapped
+	path := strings.TrimPrefix(req.URL.Path, "/v1/")
+	if req.Header.Get("X-Vault-Wrap-TTL") != "" || strings.HasPrefix(path, "sys/wrapping/") ||
+		path == "sys/storage/raft/snapshot" {
+		return resp, nil
+	}
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(raw))
+
+	var body struct {
+		WrapInfo *controlGroupWrapInfo `json:"wrap_info"`
+	}
+	if json.Unmarshal(raw, &body) != nil || body.WrapInfo == nil || body.WrapInfo.Accessor == "" {
+		return resp, nil
+	}
+	if body.WrapInfo.CreationPath == "" {
+		body.WrapInfo.CreationPath = path
+	}
+	request, err := recordControlGroupRequest(t.self, *body.WrapInfo, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return forbiddenResponse(req, "control group authorization is required for "+request.Path+
+		", request ID "+request.Accessor), nil
+}
+
+func recordControlGroupRequest(self map[string]interface{}, info controlGroupWrapInfo, now time.Time) (*ControlGroupRequest, error) {
+	identity, err := preferenceIdentityOf(self)
+	if err != nil {
+		return nil, err
+	}
+	if err := validControlGroupAccessor(info.Accessor); err != nil {
+		return nil, err
+	}
+	token, err := encryptServer([]byte(info.Token))
+	if err != nil {
+		return nil, err
+	}
+	name, _ := self["display_name"].(string)
+	request := &ControlGroupRequest{
+		Accessor:          info.Accessor,
+		Path:              info.CreationPath,
+		Requester:         name,
+		RequesterIdentity: identity,
+		Created:           now.UTC().Format(time.RFC3339),
+		Expires:           now.Add(time.Duration(info.TTL) * time.Second).UTC().Format(time.RFC3339),
+		WrappingToken:     token,
+	}
+	raw, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	controlGroupsLock.Lock()
+	defer controlGroupsLock.Unlock()
+	if _, err := WriteToCubbyhole("control_groups/"+request.Accessor, map[string]interface{}{
+		"request": string(raw),
+	}); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func validControlGroupAccessor(accessor string) error {
+	if accessor == "" || strings.ContainsAny(accessor, "/?#") {
+		return errors.New("Invalid control group request ID")
+	}
+	return nil
+}
+
+// reads a stored control group request, including its encrypted wrapping token
+func getControlGroupRequest(accessor string) (*ControlGroupRequest, error) {
+	if err := validControlGroupAccessor(accessor); err != nil {
+		return nil, err
+	}
+	resp, err := ReadFromCubbyhole("control_groups/" + accessor)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Control group request not found")
+	}
+	raw, _ := resp.Data["request"].(string)
+	var request ControlGroupRequest
+	if err := json.Unmarshal([]byte(raw), &request); err != nil || request.Accessor == "" {
+		return nil, errMalformedControlGroupRequest
+	}
+	return &request, nil
+}
+
+// lists stored control group requests, without their wrapping tokens
+func ListControlGroupRequests() ([]ControlGroupRequest, error) {
+	accessors, err := listCubbyhole("control_groups/")
+	if err != nil {
+		return nil, err
+	}
+	requests := []ControlGroupRequest{}
+	for _, accessor := range accessors {
+		if request, err := getControlGroupRequest(accessor); err == nil {
+			request.WrappingToken = ""
+			requests = append(requests, *request)
+		}
+	}
+	return requests, nil
+}
+
+// vault's view of a control group request: whether it is approved, and by whom
+// the session needs access to sys/control-group/request, as authorizers have
+func (auth AuthInfo) ControlGroupStatus(accessor string) (map[string]interface{}, error) {
+	if err := validControlGroupAccessor(accessor); err != nil {
+		return nil, err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Write("sys/control-group/request", map[string]interface{}{
+		"accessor": accessor,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Control group request not found")
+	}
+	return resp.Data, nil
+}
+
+// adds the session's authorization to a control group request
+func (auth AuthInfo) AuthorizeControlGroup(accessor string) (map[string]interface{}, error) {
+	if err := validControlGroupAccessor(accessor); err != nil {
+		return nil, err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Write("sys/control-group/authorize", map[string]interface{}{
+		"accessor": accessor,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return map[string]interface{}{}, nil
+	}
+	return resp.Data, nil
+}
+
+// unwraps the held back response for its requester, once vault considers it approved
+// vault also checks that the session belongs to the requester before unwrapping
+func (auth AuthInfo) CollectControlGroup(accessor string) (map[string]interface{}, error) {
+	identity, err := auth.PreferenceIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	controlGroupsLock.Lock()
+	defer controlGroupsLock.Unlock()
+
+	request, err := getControlGroupRequest(accessor)
+	if err != nil {
+		return nil, err
+	}
+	if request.RequesterIdentity != identity {
+		return nil, errors.New("Only the requester can collect the response")
+	}
+	token, err := decryptServer(request.WrappingToken)
+	if err != nil {
+		return nil, err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Unwrap(string(token))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := DeleteFromCubbyhole("control_groups/" + accessor); err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return map[string]interface{}{}, nil
+	}
+	return resp.Data, nil
+}
+
+// true once the wrapping token of a control group request has expired
+func controlGroupExpired(request *ControlGroupRequest, now time.Time) bool {
+	expires, err := time.Parse(time.RFC3339, request.Expires)
+	return err == nil && !now.Before(expires)
+}
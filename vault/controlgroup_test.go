@@ -0,0 +1,57 @@
+package vault
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestControlGroupTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/secret/plain" {
+			w.Write([]byte(`{"data": {"foo": "bar"}}`))
+			return
+		}
+		w.Write([]byte(`{"data": null, "wrap_info": {"token": "t", "accessor": "a", "ttl": 60}}`))
+	}))
+	defer server.Close()
+	transport := &controlGroupTransport{
+		base: http.DefaultTransport,
+		self: map[string]interface{}{"display_name": "alice"},
+	}
+
+	Convey("Ordinary responses should pass through intact", t, func(c C) {
+		req, _ := http.NewRequest("GET", server.URL+"/v1/secret/plain", nil)
+		resp, err := transport.RoundTrip(req)
+		c.So(err, ShouldBeNil)
+		body, _ := ioutil.ReadAll(resp.Body)
+		c.So(string(body), ShouldEqual, `{"data": {"foo": "bar"}}`)
+	})
+
+	Convey("Wrapping that was asked for should not be taken for a control group", t, func(c C) {
+		req, _ := http.NewRequest("GET", server.URL+"/v1/secret/wrapped", nil)
+		req.Header.Set("X-Vault-Wrap-TTL", "60")
+		resp, err := transport.RoundTrip(req)
+		c.So(err, ShouldBeNil)
+		c.So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+		req, _ = http.NewRequest("POST", server.URL+"/v1/sys/wrapping/rewrap", nil)
+		resp, err = transport.RoundTrip(req)
+		c.So(err, ShouldBeNil)
+		c.So(resp.StatusCode, ShouldEqual, http.StatusOK)
+	})
+}
+
+func TestControlGroupExpired(t *testing.T) {
+	Convey("Requests should expire with their wrapping token", t, func(c C) {
+		now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		request := &ControlGroupRequest{Expires: "2018-01-01T00:00:00Z"}
+		c.So(controlGroupExpired(request, now.Add(-time.Second)), ShouldBeFalse)
+		c.So(controlGroupExpired(request, now), ShouldBeTrue)
+		c.So(controlGroupExpired(&ControlGroupRequest{}, now), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,214 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// an operator-defined vault api call, exposed by name so teams can reach
+// endpoints goldfish doesn't support natively
+type CustomRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// one of GET, LIST, POST, PUT or DELETE
+	Method string `json:"method"`
+	// vault path, with {param} placeholders, e.g. "database/creds/{role}"
+	Path   string                 `json:"path"`
+	Params map[string]CustomParam `json:"params"`
+	// sessions need one of these policies to make the call, "*" allows everyone
+	Policies []string `json:"policies"`
+
+	placeholders []string
+}
+
+type CustomParam struct {
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Default     string `json:"default"`
+	// values must match this regular expression in full, if set
+	Pattern string `json:"pattern"`
+
+	pattern *regexp.Regexp
+}
+
+var placeholderRegexp = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+var customMethods = map[string]bool{
+	"GET": true, "LIST": true, "POST": true, "PUT": true, "DELETE": true,
+}
+
+func parseCustomRequests(raw string) (map[string]*CustomRequest, error) {
+	requests := map[string]*CustomRequest{}
+	if raw == "" {
+		return requests, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &requests); err != nil {
+		return nil, errors.New("CustomRequests must be a JSON object of names to request definitions")
+	}
+	for name, cr := range requests {
+		if cr == nil {
+			return nil, errors.New("CustomRequests: " + name + " is empty")
+		}
+		cr.Name = name
+		cr.Method = strings.ToUpper(cr.Method)
+		if !customMethods[cr.Method] {
+			return nil, errors.New("CustomRequests: " + name + " has an unsupported method")
+		}
+		cr.Path = strings.Trim(cr.Path, "/")
+		if cr.Path == "" {
+			return nil, errors.New("CustomRequests: " + name + " has an empty path")
+		}
+		if len(cr.Policies) == 0 {
+			return nil, errors.New("CustomRequests: " + name + " must list the policies allowed to call it")
+		}
+		for param, def := range cr.Params {
+			if def.Pattern != "" {
+				re, err := regexp.Compile("^(?:" + def.Pattern + ")$")
+				if err != nil {
+					return nil, errors.New("CustomRequests: " + name + " has an invalid pattern for " + param)
+				}
+				def.pattern = re
+				cr.Params[param] = def
+			}
+		}
+		for _, match := range placeholderRegexp.FindAllStringSubmatch(cr.Path, -1) {
+			if _, ok := cr.Params[match[1]]; !ok {
+				return nil, errors.New("CustomRequests: " + name + " does not define path parameter " + match[1])
+			}
+			cr.placeholders = append(cr.placeholders, match[1])
+		}
+	}
+	return requests, nil
+}
+
+// returns the custom request with this name
+func GetCustomRequest(name string) (*CustomRequest, bool) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	cr, ok := customRequests[name]
+	return cr, ok
+}
+
+// lists custom requests that a session with these policies may call, sorted by name
+func ListCustomRequests(policies []interface{}) []*CustomRequest {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	results := []*CustomRequest{}
+	for _, cr := range customRequests {
+		if cr.Allowed(policies) {
+			results = append(results, cr)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// true if a session holding these policies may make the call
+func (cr *CustomRequest) Allowed(policies []interface{}) bool {
+	for _, allowed := range cr.Policies {
+		if allowed == "*" {
+			return true
+		}
+		for _, p := range policies {
+			if name, ok := p.(string); ok && name == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validates the parameters and fills them into the path. Parameters that are not
+// part of the path are returned, to be sent as the query or body
+func (cr *CustomRequest) build(params map[string]string) (string, map[string]string, error) {
+	values := map[string]string{}
+	for name := range params {
+		if _, ok := cr.Params[name]; !ok {
+			return "", nil, errors.New("Unknown parameter " + name)
+		}
+	}
+	for name, def := range cr.Params {
+		value, ok := params[name]
+		if !ok || value == "" {
+			if def.Required {
+				return "", nil, errors.New("Missing required parameter " + name)
+			}
+			if value = def.Default; value == "" {
+				continue
+			}
+		}
+		if def.pattern != nil && !def.pattern.MatchString(value) {
+			return "", nil, errors.New("Parameter " + name + " does not match " + def.Pattern)
+		}
+		values[name] = value
+	}
+
+	path := cr.Path
+	for _, name := range cr.placeholders {
+		value := values[name]
+		// path parameters must stay within their segment
+		if value == "" || value == "." || value == ".." || strings.ContainsAny(value, "/?#") {
+			return "", nil, errors.New("Invalid value for path parameter " + name)
+		}
+		path = strings.Replace(path, "{"+name+"}", value, -1)
+		delete(values, name)
+	}
+	return path, values, nil
+}
+
+// makes the custom call, returning the path it resolved to along with the response
+func (auth AuthInfo) RunCustomRequest(cr *CustomRequest, params map[string]string) (string, *api.Secret, error) {
+	path, rest, err := cr.build(params)
+	if err != nil {
+		return "", nil, err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return path, nil, err
+	}
+
+	var r *api.Request
+	switch cr.Method {
+	case "LIST":
+		r = client.NewRequest("GET", "/v1/"+path)
+		r.Params.Set("list", "true")
+	case "POST", "PUT":
+		r = client.NewRequest(cr.Method, "/v1/"+path)
+		body := map[string]interface{}{}
+		for k, v := range rest {
+			body[k] = v
+		}
+		if err := r.SetJSONBody(body); err != nil {
+			return path, nil, err
+		}
+		rest = nil
+	default:
+		r = client.NewRequest(cr.Method, "/v1/"+path)
+	}
+	for k, v := range rest {
+		r.Params.Set(k, v)
+	}
+
+	resp, err := client.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return path, nil, err
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return path, nil, nil
+	}
+	secret, err := api.ParseSecret(resp.Body)
+	return path, secret, err
+}
@@ -0,0 +1,50 @@
+package vault
+
+import (
+	"errors"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func init() {
+	RegisterSecretEngine("database", credentialEngine{
+		description: EngineDescription{
+			Type:        "database",
+			Name:        "Database",
+			Description: "Dynamic database credentials",
+		},
+		rolesPath: "roles",
+		credsPath: "creds",
+	})
+}
+
+func (auth AuthInfo) ListDatabaseConnections(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "database") + "config")
+}
+
+func (auth AuthInfo) ReadDatabaseConnection(mount, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty connection name")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "database") + "config/" + name)
+}
+
+func (auth AuthInfo) ListDatabaseRoles(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "database") + "roles")
+}
+
+// role details include the creation and revocation statements
+func (auth AuthInfo) ReadDatabaseRole(mount, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "database") + "roles/" + name)
+}
+
+// generates a fresh set of credentials for the role. The secret carries the lease
+func (auth AuthInfo) GenerateDatabaseCredentials(mount, role string) (*api.Secret, error) {
+	if role == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.readCreds(mountPrefix(mount, "database"), "creds/"+role)
+}
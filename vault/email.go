@@ -0,0 +1,237 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// the mail server goldfish sends notifications through, read from SMTPPath
+type smtpSettings struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func parseApproverEmails(raw string) error {
+	for _, address := range strings.Split(raw, ",") {
+		if address = strings.TrimSpace(address); address == "" {
+			continue
+		}
+		if _, err := mail.ParseAddress(address); err != nil {
+			return errors.New("ApproverEmails: " + address + " is not an email address")
+		}
+	}
+	return nil
+}
+
+func approverEmails() []string {
+	emails := []string{}
+	for _, address := range strings.Split(GetConfig().ApproverEmails, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			emails = append(emails, address)
+		}
+	}
+	return emails
+}
+
+// reads the mail server's settings and credentials with goldfish's token
+// they are read for every email, so rotating them in vault takes effect immediately
+func readSMTPSettings() (*smtpSettings, error) {
+	path := GetConfig().SMTPPath
+	if path == "" {
+		return nil, errors.New("SMTPPath is not configured")
+	}
+	resp, err := serverVaultClient().Logical().Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, errors.New("No SMTP settings found at " + path)
+	}
+	settings := &smtpSettings{Port: "587"}
+	settings.Host, _ = resp.Data["host"].(string)
+	if port, ok := resp.Data["port"]; ok {
+		settings.Port = fmt.Sprint(port)
+	}
+	settings.Username, _ = resp.Data["username"].(string)
+	settings.Password, _ = resp.Data["password"].(string)
+	settings.From, _ = resp.Data["from"].(string)
+	if settings.Host == "" || settings.From == "" {
+		return nil, errors.New("SMTP settings at " + path + " must include host and from")
+	}
+	return settings, nil
+}
+
+// where a change ID can be looked at in goldfish's UI, or empty without a PublicURL
+func requestLink(publicURL, changeID string) string {
+	if publicURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(publicURL, "/") + "/#/requests?changeid=" + changeID
+}
+
+// the email address on the session's token metadata, or its identity entity's metadata
+func RequesterEmail(self *api.Secret) string {
+	if self == nil || self.Data == nil {
+		return ""
+	}
+	if meta, ok := self.Data["meta"].(map[string]interface{}); ok {
+		if email, ok := meta["email"].(string); ok && email != "" {
+			return email
+		}
+	}
+	entityID, _ := self.Data["entity_id"].(string)
+	if entityID == "" {
+		return ""
+	}
+	entity, err := serverVaultClient().Logical().Read("identity/entity/id/" + entityID)
+	if err != nil || entity == nil {
+		return ""
+	}
+	if meta, ok := entity.Data["metadata"].(map[string]interface{}); ok {
+		email, _ := meta["email"].(string)
+		return email
+	}
+	return ""
+}
+
+// remembers where to tell the requester that their request was applied
+func SetRequestContact(changeID, policy, email string) error {
+	if email == "" {
+		return nil
+	}
+	if _, err := mail.ParseAddress(email); err != nil {
+		return errors.New("Requester email is not an email address")
+	}
+	return updateRequestHistory(changeID, policy, func(history *RequestHistory) error {
+		history.Contact = email
+		return nil
+	})
+}
+
+// emails approvers when a request needs their approval, and requesters once it is applied
+func notifyEmail(changeID, policy, event string) {
+	if GetConfig().SMTPPath == "" {
+		return
+	}
+	link := requestLink(GetConfig().PublicURL, changeID)
+
+	var to []string
+	var subject, body string
+	switch event {
+	case RequestCreated:
+		to = approverEmails()
+		subject = "Policy change request for " + policy + " needs approval"
+		body = "A change to policy " + policy + " has been requested.\r\n\r\nChange ID: " + changeID + "\r\n"
+	case RequestApplied:
+		history, err := GetRequestHistory(changeID)
+		if err != nil || history == nil || history.Contact == "" {
+			return
+		}
+		to = []string{history.Contact}
+		subject = "Your policy change request for " + policy + " has been applied"
+		body = "Your requested change to policy " + policy + " has been applied.\r\n\r\nChange ID: " + changeID + "\r\n"
+	default:
+		return
+	}
+	if len(to) == 0 {
+		return
+	}
+	if link != "" {
+		body += "\r\n" + link + "\r\n"
+	}
+
+	go func() {
+		if err := sendEmail(to, subject, body); err != nil {
+			log.Println("[ERROR]: Could not email", event, "notification for", changeID+":", err.Error())
+		}
+	}()
+}
+
+// the longest an email may take to send, from dialing the mail server to quitting
+var smtpTimeout = 30 * time.Second
+
+func sendEmail(to []string, subject, body string) error {
+	settings, err := readSMTPSettings()
+	if err != nil {
+		return err
+	}
+	return deliverEmail(settings, to, emailMessage(settings.From, to, subject, body, time.Now()))
+}
+
+// sends as smtp.SendMail does, but gives up on a mail server that doesn't answer in time
+func deliverEmail(settings *smtpSettings, to []string, message []byte) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(settings.Host, settings.Port), smtpTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, settings.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: settings.Host}); err != nil {
+			return err
+		}
+	}
+	if settings.Username != "" {
+		// net/smtp only sends these credentials over TLS, or to localhost
+		auth := smtp.PlainAuth("", settings.Username, settings.Password, settings.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(settings.From); err != nil {
+		return err
+	}
+	for _, address := range to {
+		if err := client.Rcpt(address); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func emailMessage(from string, to []string, subject, body string, now time.Time) []byte {
+	// headers must stay on one line each
+	subject = strings.NewReplacer("\r", "", "\n", "").Replace(subject)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(body)
+	return b.Bytes()
+}
@@ -0,0 +1,73 @@
+package vault
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestApproverEmails(t *testing.T) {
+	Convey("Approver lists should only hold email addresses", t, func(c C) {
+		c.So(parseApproverEmails(""), ShouldBeNil)
+		c.So(parseApproverEmails("alice@example.com, Bob <bob@example.com>"), ShouldBeNil)
+		c.So(parseApproverEmails("alice@example.com, security team"), ShouldNotBeNil)
+	})
+}
+
+func TestRequestLink(t *testing.T) {
+	Convey("Links should open the request in the UI", t, func(c C) {
+		c.So(requestLink("https://goldfish.example.com/", "abc"), ShouldEqual,
+			"https://goldfish.example.com/#/requests?changeid=abc")
+		c.So(requestLink("", "abc"), ShouldEqual, "")
+	})
+}
+
+func TestEmailMessage(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	Convey("Messages should carry their headers before the body", t, func(c C) {
+		msg := string(emailMessage("goldfish@example.com", []string{"a@example.com", "b@example.com"},
+			"Needs approval", "body text\r\n", now))
+		c.So(msg, ShouldStartWith, "From: goldfish@example.com\r\nTo: a@example.com, b@example.com\r\n")
+		c.So(msg, ShouldContainSubstring, "Subject: Needs approval\r\n")
+		c.So(msg, ShouldEndWith, "\r\n\r\nbody text\r\n")
+	})
+
+	Convey("Subjects should not be able to add headers", t, func(c C) {
+		msg := string(emailMessage("goldfish@example.com", []string{"a@example.com"},
+			"policy\r\nBcc: eve@example.com", "", now))
+		c.So(strings.Contains(msg, "\r\nBcc:"), ShouldBeFalse)
+	})
+}
+
+func TestDeliverEmailTimeout(t *testing.T) {
+	Convey("A mail server that never answers should not hold up delivery forever", t, func(c C) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		c.So(err, ShouldBeNil)
+		defer l.Close()
+		// accepts, and then says nothing
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		timeout := smtpTimeout
+		smtpTimeout = 100 * time.Millisecond
+		defer func() { smtpTimeout = timeout }()
+
+		host, port, _ := net.SplitHostPort(l.Addr().String())
+		start := time.Now()
+		err = deliverEmail(&smtpSettings{Host: host, Port: port, From: "goldfish@example.com"},
+			[]string{"a@example.com"}, []byte("body"))
+		c.So(err, ShouldNotBeNil)
+		c.So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+	})
+}
@@ -0,0 +1,253 @@
+package vault
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// SecretEngine lets goldfish support a vault secret backend without changes to core handlers.
+// Paths given to an engine are relative to the mount, which always ends in '/'.
+type SecretEngine interface {
+	Describe() EngineDescription
+	List(auth AuthInfo, mount, path string) ([]interface{}, error)
+	Read(auth AuthInfo, mount, path string) (map[string]interface{}, error)
+	Write(auth AuthInfo, mount, path string, data map[string]interface{}) (interface{}, error)
+	Actions() []EngineAction
+}
+
+type EngineDescription struct {
+	Type        string
+	Name        string
+	Description string
+}
+
+// an engine-specific operation, e.g. generating credentials
+type EngineAction struct {
+	Name        string
+	Description string
+	Run         func(auth AuthInfo, mount, path string, params map[string]interface{}) (interface{}, error) `json:"-"`
+}
+
+var (
+	engines     = map[string]SecretEngine{}
+	enginesLock = new(sync.RWMutex)
+)
+
+// registers an engine for a mount type. Registering the same type twice panics,
+// as it almost certainly means two plugins are fighting over a backend
+func RegisterSecretEngine(mountType string, engine SecretEngine) {
+	enginesLock.Lock()
+	defer enginesLock.Unlock()
+
+	if engine == nil {
+		panic("vault: RegisterSecretEngine engine is nil")
+	}
+	if _, dup := engines[mountType]; dup {
+		panic("vault: RegisterSecretEngine called twice for " + mountType)
+	}
+	engines[mountType] = engine
+}
+
+// returns the engine registered for a mount type
+func GetSecretEngine(mountType string) (SecretEngine, bool) {
+	enginesLock.RLock()
+	defer enginesLock.RUnlock()
+	engine, ok := engines[mountType]
+	return engine, ok
+}
+
+// describes every registered engine, sorted by type
+func ListSecretEngines() []EngineDescription {
+	enginesLock.RLock()
+	defer enginesLock.RUnlock()
+
+	results := make([]EngineDescription, 0, len(engines))
+	for _, engine := range engines {
+		results = append(results, engine.Describe())
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Type < results[j].Type
+	})
+	return results
+}
+
+// finds the mount a path belongs to, and the engine registered for its type
+func (auth AuthInfo) EngineForPath(path string) (SecretEngine, string, error) {
+	mounts, err := auth.ListMounts()
+	if err != nil {
+		return nil, "", err
+	}
+
+	mount, mountType := "", ""
+	for name, m := range mounts {
+		if strings.HasPrefix(path, name) && len(name) > len(mount) {
+			mount, mountType = name, m.Type
+		}
+	}
+	if mount == "" {
+		return nil, "", errors.New("Path is not under any mount")
+	}
+
+	engine, ok := GetSecretEngine(mountType)
+	if !ok {
+		return nil, mount, errors.New("No engine registered for mount type " + mountType)
+	}
+	return engine, mount, nil
+}
+
+// returns the named action of an engine
+func FindEngineAction(engine SecretEngine, name string) (EngineAction, bool) {
+	for _, action := range engine.Actions() {
+		if action.Name == name {
+			return action, true
+		}
+	}
+	return EngineAction{}, false
+}
+
+// kvEngine supports generic, kv and cubbyhole mounts
+type kvEngine struct {
+	description EngineDescription
+}
+
+func (e kvEngine) Describe() EngineDescription {
+	return e.description
+}
+
+func (e kvEngine) List(auth AuthInfo, mount, path string) ([]interface{}, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	// kv-v2 mounts list through the metadata endpoint
+	listPath := mount + path
+	_, version, err := kvMount(client, auth.Namespace, mount+path)
+	if err != nil {
+		return nil, err
+	}
+	if version == 2 {
+		listPath = mount + "metadata/" + path
+	}
+
+	resp, err := client.Logical().List(listPath)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, errors.New("Invalid path")
+	}
+	keys, _ := resp.Data["keys"].([]interface{})
+	return keys, nil
+}
+
+func (e kvEngine) Read(auth AuthInfo, mount, path string) (map[string]interface{}, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	_, version, err := kvMount(client, auth.Namespace, mount+path)
+	if err != nil {
+		return nil, err
+	}
+	return readKV(client, mount, mount+path, version, 0)
+}
+
+func (e kvEngine) Write(auth AuthInfo, mount, path string, data map[string]interface{}) (interface{}, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	_, version, err := kvMount(client, auth.Namespace, mount+path)
+	if err != nil {
+		return nil, err
+	}
+	return nil, writeKV(client, mount, mount+path, version, data)
+}
+
+func (e kvEngine) Actions() []EngineAction {
+	return []EngineAction{}
+}
+
+// credentialEngine supports backends that hand out dynamic credentials per role,
+// with roles under rolesPath and credentials generated by reading credsPath/<role>
+type credentialEngine struct {
+	description EngineDescription
+	rolesPath   string
+	credsPath   string
+}
+
+func (e credentialEngine) Describe() EngineDescription {
+	return e.description
+}
+
+func (e credentialEngine) List(auth AuthInfo, mount, path string) ([]interface{}, error) {
+	if path == "" {
+		path = e.rolesPath + "/"
+	}
+	return auth.ListSecret(mount + path)
+}
+
+func (e credentialEngine) Read(auth AuthInfo, mount, path string) (map[string]interface{}, error) {
+	return auth.ReadSecret(mount + path)
+}
+
+func (e credentialEngine) Write(auth AuthInfo, mount, path string, data map[string]interface{}) (interface{}, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.Logical().Write(mount+path, data)
+}
+
+func (e credentialEngine) Actions() []EngineAction {
+	return []EngineAction{{
+		Name:        "creds",
+		Description: "Generate credentials for the role at path",
+		Run: func(auth AuthInfo, mount, path string, params map[string]interface{}) (interface{}, error) {
+			role := strings.TrimPrefix(strings.Trim(path, "/"), e.rolesPath+"/")
+			secret, err := auth.readCreds(mount, e.credsPath+"/"+role)
+			if err != nil {
+				return nil, err
+			}
+			return LeasedSecret(secret), nil
+		},
+	}}
+}
+
+// generates dynamic credentials by reading path under the mount. The secret carries the lease
+func (auth AuthInfo) readCreds(mount, path string) (*api.Secret, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Read(mount + path)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Invalid path")
+	}
+	return resp, nil
+}
+
+func init() {
+	RegisterSecretEngine("generic", kvEngine{EngineDescription{
+		Type:        "generic",
+		Name:        "Generic",
+		Description: "Arbitrary key/value secrets",
+	}})
+	RegisterSecretEngine("kv", kvEngine{EngineDescription{
+		Type:        "kv",
+		Name:        "Key/Value",
+		Description: "Arbitrary key/value secrets, optionally versioned",
+	}})
+	RegisterSecretEngine("cubbyhole", kvEngine{EngineDescription{
+		Type:        "cubbyhole",
+		Name:        "Cubbyhole",
+		Description: "Secrets private to the current token",
+	}})
+}
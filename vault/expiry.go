@@ -0,0 +1,154 @@
+package vault
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// how often pending policy requests are checked for expiry
+const expiredRequestsInterval = 5 * time.Minute
+
+// a policy request that was rejected because nobody acted on it in time
+type ExpiredRequest struct {
+	ChangeID  string `json:"change_id"`
+	Policy    string `json:"policy"`
+	Requester string `json:"requester"`
+	Created   string `json:"created"`
+	Expired   string `json:"expired"`
+}
+
+// how long policy requests may stay pending. Zero means they never expire
+func PolicyRequestTTL() time.Duration {
+	ttl, err := time.ParseDuration(GetConfig().PolicyRequestTTL)
+	if err != nil || ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+func parsePolicyRequestTTL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if ttl, err := time.ParseDuration(raw); err != nil || ttl < 0 {
+		return errors.New("PolicyRequestTTL must be a duration such as 168h, or 0 to keep requests forever")
+	}
+	return nil
+}
+
+// true if a request created at this time has outlived PolicyRequestTTL
+// requests made before they carried a creation time are stamped by the next sweep instead
+func PolicyRequestExpired(created string, now time.Time) bool {
+	ttl := PolicyRequestTTL()
+	if ttl == 0 {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, created)
+	return err == nil && !now.Before(t.Add(ttl))
+}
+
+// rejects and removes pending policy requests that have expired
+// approved requests waiting for their window are no longer pending, and are left alone
+func expirePolicyRequests(now time.Time) error {
+	if PolicyRequestTTL() == 0 {
+		return nil
+	}
+	ids, err := listCubbyhole("requests/")
+	if err != nil {
+		return err
+	}
+	scheduled, err := listCubbyhole("scheduled_requests/")
+	if err != nil {
+		return err
+	}
+	isScheduled := map[string]bool{}
+	for _, id := range scheduled {
+		isScheduled[id] = true
+	}
+
+	for _, id := range ids {
+		if isScheduled[id] {
+			continue
+		}
+		resp, err := ReadFromCubbyhole("requests/" + id)
+		if err != nil {
+			return err
+		}
+		if resp == nil || resp.Data == nil {
+			continue
+		}
+		var request struct {
+			Policy  string
+			Created string
+		}
+		if err := mapstructure.Decode(resp.Data, &request); err != nil || request.Policy == "" {
+			continue
+		}
+
+		if request.Created == "" {
+			resp.Data["Created"] = now.UTC().Format(time.RFC3339)
+			if _, err := WriteToCubbyhole("requests/"+id, resp.Data); err != nil {
+				return err
+			}
+			continue
+		}
+		if !PolicyRequestExpired(request.Created, now) {
+			continue
+		}
+
+		log.Println("[AUDIT]:", "policy request", id, "for", request.Policy, "expired")
+		if err := RecordRequestEvent(id, request.Policy, RequestExpired, "goldfish",
+			"pending for longer than "+PolicyRequestTTL().String()); err != nil {
+			return err
+		}
+		DeleteFromCubbyhole("unseal_wrapping_tokens/" + id)
+		DeleteAttachments(id)
+		DeletePolicyApprovals(id)
+		if _, err := DeleteFromCubbyhole("requests/" + id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns the policy requests that expired, from their history
+func ListExpiredRequests() ([]ExpiredRequest, error) {
+	ids, err := listCubbyhole("request_history/")
+	if err != nil {
+		return nil, err
+	}
+	expired := []ExpiredRequest{}
+	for _, id := range ids {
+		history, err := GetRequestHistory(id)
+		if err != nil || history == nil || len(history.Events) == 0 {
+			continue
+		}
+		last := history.Events[len(history.Events)-1]
+		if last.Event != RequestExpired {
+			continue
+		}
+		entry := ExpiredRequest{
+			ChangeID: id,
+			Policy:   history.Policy,
+			Expired:  last.Time,
+		}
+		for _, event := range history.Events {
+			if event.Event == RequestCreated {
+				entry.Requester = event.Actor
+				entry.Created = event.Time
+			}
+		}
+		expired = append(expired, entry)
+	}
+	return expired, nil
+}
+
+func expirePolicyRequestsEvery(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		errorChannel <- expirePolicyRequests(time.Now())
+	}
+}
@@ -0,0 +1,46 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolicyRequestExpiry(t *testing.T) {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-48 * time.Hour).Format(time.RFC3339)
+
+	setTTL := func(ttl string) {
+		configLock.Lock()
+		config.PolicyRequestTTL = ttl
+		configLock.Unlock()
+	}
+	defer setTTL("")
+
+	Convey("Requests should never expire without a ttl", t, func(c C) {
+		setTTL("")
+		c.So(PolicyRequestExpired(created, now), ShouldBeFalse)
+		setTTL("0")
+		c.So(PolicyRequestExpired(created, now), ShouldBeFalse)
+	})
+
+	Convey("Requests should expire once pending for longer than the ttl", t, func(c C) {
+		setTTL("24h")
+		c.So(PolicyRequestExpired(created, now), ShouldBeTrue)
+		setTTL("72h")
+		c.So(PolicyRequestExpired(created, now), ShouldBeFalse)
+	})
+
+	Convey("Requests without a creation time should not expire yet", t, func(c C) {
+		setTTL("1h")
+		c.So(PolicyRequestExpired("", now), ShouldBeFalse)
+	})
+
+	Convey("PolicyRequestTTL should be validated", t, func(c C) {
+		c.So(parsePolicyRequestTTL(""), ShouldBeNil)
+		c.So(parsePolicyRequestTTL("168h"), ShouldBeNil)
+		c.So(parsePolicyRequestTTL("a week"), ShouldNotBeNil)
+		c.So(parsePolicyRequestTTL("-1h"), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,245 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	archiveFormat     = "goldfish-export"
+	archiveVersion    = 1
+	archiveIterations = 100000
+)
+
+// the plaintext contents of an export
+type SecretArchive struct {
+	Path     string
+	Exported string
+	Secrets  map[string]map[string]interface{}
+}
+
+// the encrypted form of an export, as handed to the user
+type SealedArchive struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Encryption string `json:"encryption"`
+	TransitKey string `json:"transit_key,omitempty"`
+	Salt       string `json:"salt,omitempty"`
+	Nonce      string `json:"nonce,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// reads every secret under a prefix into an archive
+func (auth AuthInfo) ExportSecrets(path string) (*SecretArchive, error) {
+	if !strings.HasSuffix(path, "/") {
+		return nil, errors.New("Export path must end in '/'")
+	}
+
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := listRecursive(client, auth.Namespace, path)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &SecretArchive{
+		Path:     path,
+		Exported: time.Now().Format(time.RFC3339),
+		Secrets:  make(map[string]map[string]interface{}, len(keys)),
+	}
+	for _, key := range keys {
+		mount, version, err := kvMount(client, auth.Namespace, path+key)
+		if err != nil {
+			return nil, err
+		}
+		data, err := readKV(client, mount, path+key, version, 0)
+		if err != nil {
+			return nil, err
+		}
+		archive.Secrets[key] = data
+	}
+	return archive, nil
+}
+
+// writes every secret in the archive under the given prefix
+// returns the paths that were written
+func (auth AuthInfo) ImportSecrets(path string, archive *SecretArchive) ([]string, error) {
+	if !strings.HasSuffix(path, "/") {
+		return nil, errors.New("Import path must end in '/'")
+	}
+
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	written := make([]string, 0, len(archive.Secrets))
+	for key, data := range archive.Secrets {
+		if strings.Contains(key, "..") || strings.HasPrefix(key, "/") {
+			return written, errors.New("Archive contains an invalid key: " + key)
+		}
+		mount, version, err := kvMount(client, auth.Namespace, path+key)
+		if err != nil {
+			return written, err
+		}
+		if err := writeKV(client, mount, path+key, version, data); err != nil {
+			return written, err
+		}
+		written = append(written, path+key)
+	}
+	return written, nil
+}
+
+// encrypts an archive with the user's access to a transit key
+func (auth AuthInfo) SealArchiveTransit(archive *SecretArchive, key string) (*SealedArchive, error) {
+	plaintext, err := json.Marshal(archive)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := auth.EncryptTransit(key, string(plaintext))
+	if err != nil {
+		return nil, err
+	}
+	return &SealedArchive{
+		Format:     archiveFormat,
+		Version:    archiveVersion,
+		Encryption: "transit",
+		TransitKey: key,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// encrypts an archive with a key derived from a passphrase
+// this does not involve vault, so the archive can be restored into a different vault
+func SealArchivePassphrase(archive *SecretArchive, passphrase string) (*SealedArchive, error) {
+	if passphrase == "" {
+		return nil, errors.New("Passphrase must not be empty")
+	}
+	plaintext, err := json.Marshal(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := archiveCipher(passphrase, salt, archiveIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &SealedArchive{
+		Format:     archiveFormat,
+		Version:    archiveVersion,
+		Encryption: "passphrase",
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Iterations: archiveIterations,
+		Ciphertext: base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, nil)),
+	}, nil
+}
+
+// decrypts a sealed archive. Passphrase is only used for passphrase-encrypted archives
+func (auth AuthInfo) OpenArchive(sealed *SealedArchive, passphrase string) (*SecretArchive, error) {
+	if sealed.Format != archiveFormat || sealed.Version != archiveVersion {
+		return nil, errors.New("Unrecognized archive format")
+	}
+
+	var plaintext []byte
+	switch sealed.Encryption {
+	case "transit":
+		raw, err := auth.DecryptTransit(sealed.TransitKey, sealed.Ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		plaintext = []byte(raw)
+
+	case "passphrase":
+		salt, err := base64.StdEncoding.DecodeString(sealed.Salt)
+		if err != nil {
+			return nil, err
+		}
+		nonce, err := base64.StdEncoding.DecodeString(sealed.Nonce)
+		if err != nil {
+			return nil, err
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(sealed.Ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		// the iterations come from the uploaded archive, so any other count could be used
+		// to make goldfish spend as long as the uploader likes deriving the key
+		if sealed.Iterations != archiveIterations {
+			return nil, errors.New("Invalid archive iterations")
+		}
+		gcm, err := archiveCipher(passphrase, salt, sealed.Iterations)
+		if err != nil {
+			return nil, err
+		}
+		if len(nonce) != gcm.NonceSize() {
+			return nil, errors.New("Invalid archive nonce")
+		}
+		plaintext, err = gcm.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return nil, errors.New("Could not decrypt archive. Is the passphrase correct?")
+		}
+
+	default:
+		return nil, errors.New("Unsupported archive encryption")
+	}
+
+	archive := &SecretArchive{}
+	if err := json.Unmarshal(plaintext, archive); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func archiveCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(passphrase), salt, iterations))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// derives a 32 byte key as per RFC 2898. Only a single block is ever needed
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, password)
+	block := make([]byte, 4)
+	binary.BigEndian.PutUint32(block, 1)
+
+	prf.Write(salt)
+	prf.Write(block)
+	u := prf.Sum(nil)
+	key := make([]byte, len(u))
+	copy(key, u)
+
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
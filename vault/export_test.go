@@ -0,0 +1,38 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPassphraseArchive(t *testing.T) {
+	Convey("A passphrase sealed archive", t, func(c C) {
+		archive := &SecretArchive{
+			Path:    "secret/",
+			Secrets: map[string]map[string]interface{}{"db": {"password": "hunter2"}},
+		}
+		sealed, err := SealArchivePassphrase(archive, "correct horse")
+		c.So(err, ShouldBeNil)
+
+		c.Convey("Should open with the passphrase", func(c C) {
+			opened, err := AuthInfo{}.OpenArchive(sealed, "correct horse")
+			c.So(err, ShouldBeNil)
+			c.So(opened.Secrets["db"]["password"], ShouldEqual, "hunter2")
+		})
+
+		c.Convey("Should not open with another passphrase", func(c C) {
+			_, err := AuthInfo{}.OpenArchive(sealed, "battery staple")
+			c.So(err, ShouldNotBeNil)
+		})
+
+		c.Convey("Should refuse iteration counts it did not write", func(c C) {
+			sealed.Iterations = 1 << 30
+			_, err := AuthInfo{}.OpenArchive(sealed, "correct horse")
+			c.So(err, ShouldNotBeNil)
+			sealed.Iterations = 1
+			_, err = AuthInfo{}.OpenArchive(sealed, "correct horse")
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
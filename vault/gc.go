@@ -0,0 +1,441 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// a piece of goldfish state that no longer serves a purpose
+type OrphanedEntry struct {
+	Path   string
+	Reason string
+}
+
+// the cubbyhole prefixes goldfish knows how to clean up
+var gcPrefixes = []string{
+	"requests/",
+	"unseal_wrapping_tokens/",
+	"reveal_approvals/",
+	"request_attachments/",
+	"attachments/",
+	"secret_requests/",
+	"request_approvals/",
+	"scheduled_requests/",
+	"mount_requests/",
+	"identity_requests/",
+	"bulletin_acks/",
+	"known_users/",
+	"control_groups/",
+	"preferences/",
+}
+
+// cubbyhole entries goldfish knows how to clean up that sit directly in the cubbyhole
+var gcEntries = []string{
+	incidentPath,
+}
+
+// scans goldfish's storage for orphaned or expired entries
+func FindOrphanedState() ([]OrphanedEntry, error) {
+	orphans := []OrphanedEntry{}
+
+	// unseal tokens are wrapped with a short ttl. Once all of them expire, the entry is useless
+	ids, err := listGCEntries("unseal_wrapping_tokens/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		resp, err := ReadFromCubbyhole("unseal_wrapping_tokens/" + id)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil || resp.Data == nil {
+			continue
+		}
+		raw, _ := resp.Data["wrapping_tokens"].(string)
+		if !anyWrappingTokenAlive(strings.Split(raw, ";")) {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "unseal_wrapping_tokens/" + id,
+				Reason: "all wrapped unseal tokens have expired",
+			})
+		}
+	}
+
+	// requests that cannot be decoded can never be approved or rejected through the UI
+	ids, err = listGCEntries("requests/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		resp, err := ReadFromCubbyhole("requests/" + id)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil || resp.Data == nil {
+			continue
+		}
+		var request struct {
+			Policy string
+		}
+		if err := mapstructure.Decode(resp.Data, &request); err != nil || request.Policy == "" {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "requests/" + id,
+				Reason: "request is malformed",
+			})
+		}
+	}
+
+	// reveal approvals are only valid for a few minutes
+	ids, err = listGCEntries("reveal_approvals/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		resp, err := ReadFromCubbyhole("reveal_approvals/" + id)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil || resp.Data == nil {
+			continue
+		}
+		var approval RevealApproval
+		if err := mapstructure.Decode(resp.Data, &approval); err != nil || approval.expired() {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "reveal_approvals/" + id,
+				Reason: "reveal approval has expired",
+			})
+		}
+	}
+
+	// like policy requests, secret, mount and identity requests that cannot be decoded can never be acted on
+	ids, err = listGCEntries("secret_requests/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if _, err := GetSecretRequest(id); err == errMalformedSecretRequest {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "secret_requests/" + id,
+				Reason: "request is malformed",
+			})
+		}
+	}
+
+	ids, err = listGCEntries("mount_requests/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if _, err := GetMountRequest(id); err == errMalformedMountRequest {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "mount_requests/" + id,
+				Reason: "request is malformed",
+			})
+		}
+	}
+
+	ids, err = listGCEntries("identity_requests/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		request, err := GetIdentityRequest(id)
+		if err == errMalformedIdentityRequest {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "identity_requests/" + id,
+				Reason: "request is malformed",
+			})
+		} else if err == nil && identityCredentialsExpired(request, time.Now()) {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "identity_requests/" + id,
+				Reason: "created credentials were never collected and their wrapping has expired",
+			})
+		}
+	}
+
+	ids, err = listGCEntries("control_groups/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		request, err := getControlGroupRequest(id)
+		if err == errMalformedControlGroupRequest {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "control_groups/" + id,
+				Reason: "request is malformed",
+			})
+		} else if err == nil && controlGroupExpired(request, time.Now()) {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "control_groups/" + id,
+				Reason: "held back response was never collected and its wrapping has expired",
+			})
+		}
+	}
+
+	// approvals and schedules outlive their request only if the request was removed outside goldfish
+	ids, err = listGCEntries("request_approvals/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		resp, err := ReadFromCubbyhole("requests/" + id)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "request_approvals/" + id,
+				Reason: "request no longer exists",
+			})
+		}
+	}
+
+	ids, err = listGCEntries("scheduled_requests/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		resp, err := ReadFromCubbyhole("requests/" + id)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "scheduled_requests/" + id,
+				Reason: "request no longer exists",
+			})
+		}
+	}
+
+	// attachments outlive their request only if the request was removed outside goldfish
+	ids, err = listGCEntries("request_attachments/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		resp, err := ReadFromCubbyhole("requests/" + id)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "request_attachments/" + id,
+				Reason: "request no longer exists",
+			})
+		}
+	}
+	referenced, err := referencedAttachments()
+	if err != nil {
+		return nil, err
+	}
+	ids, err = listGCEntries("attachments/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if !referenced[id] {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "attachments/" + id,
+				Reason: "attachment is not attached to any request",
+			})
+		}
+	}
+
+	// people who stopped logging in, as they are recorded again on their next login
+	ids, err = listGCEntries("known_users/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		resp, err := ReadFromCubbyhole("known_users/" + id)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil || resp.Data == nil {
+			continue
+		}
+		raw, _ := resp.Data["user"].(string)
+		var user KnownUser
+		if json.Unmarshal([]byte(raw), &user) != nil || user.Identity == "" {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "known_users/" + id,
+				Reason: "known user is malformed",
+			})
+		} else if knownUserStale(user, time.Now()) {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "known_users/" + id,
+				Reason: "user has not logged in for 90 days",
+			})
+		}
+	}
+
+	// preferences are kept only as long as the person that saved them keeps logging in
+	ids, err = listGCEntries("preferences/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		resp, err := ReadFromCubbyhole("known_users/" + id)
+		if err != nil {
+			return nil, err
+		}
+		var user KnownUser
+		if resp != nil && resp.Data != nil {
+			raw, _ := resp.Data["user"].(string)
+			json.Unmarshal([]byte(raw), &user)
+		}
+		if user.Identity == "" || knownUserStale(user, time.Now()) {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   "preferences/" + id,
+				Reason: "user has not logged in for 90 days",
+			})
+		}
+	}
+
+	// an incident that has expired is never resumed, but still holds its hmac key
+	raw, err := ReadIncident()
+	if err != nil {
+		return nil, err
+	}
+	if raw != nil {
+		var incident struct {
+			Expires time.Time `json:"expires"`
+		}
+		if json.Unmarshal(raw, &incident) != nil {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   incidentPath,
+				Reason: "incident is malformed",
+			})
+		} else if time.Now().After(incident.Expires) {
+			orphans = append(orphans, OrphanedEntry{
+				Path:   incidentPath,
+				Reason: "incident has expired",
+			})
+		}
+	}
+
+	// acknowledgements of deleted bulletins. Skipped if goldfish cannot list bulletins
+	if bulletinPath := GetConfig().BulletinPath; bulletinPath != "" {
+		if resp, err := serverVaultClient().Logical().List(bulletinPath); err == nil {
+			bulletins := map[string]bool{}
+			if resp != nil && resp.Data != nil {
+				keys, _ := resp.Data["keys"].([]interface{})
+				for _, key := range keys {
+					if s, ok := key.(string); ok {
+						bulletins[s] = true
+					}
+				}
+			}
+			ids, err = listGCEntries("bulletin_acks/")
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				if !bulletins[id] {
+					orphans = append(orphans, OrphanedEntry{
+						Path:   "bulletin_acks/" + id,
+						Reason: "bulletin no longer exists",
+					})
+				}
+			}
+		}
+	}
+
+	return orphans, nil
+}
+
+// deletes the given entries, which must be directly under one of goldfish's own prefixes
+func DeleteOrphanedState(paths []string) error {
+	for _, path := range paths {
+		if !gcEntry(path) {
+			return errors.New("Refusing to delete unknown path " + path)
+		}
+	}
+	for _, path := range paths {
+		if _, err := DeleteFromCubbyhole(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// true if the path is an entry goldfish writes: one of gcEntries, or one key directly under one of gcPrefixes
+func gcEntry(path string) bool {
+	if containsString(gcEntries, path) {
+		return true
+	}
+	for _, prefix := range gcPrefixes {
+		if name := strings.TrimPrefix(path, prefix); strings.HasPrefix(path, prefix) &&
+			name != "" && name != "." && name != ".." && !strings.Contains(name, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// lists the entries under one of gcPrefixes. Folders beneath it aren't goldfish's, and are left alone
+func listGCEntries(prefix string) ([]string, error) {
+	keys, err := listCubbyhole(prefix)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if gcEntry(prefix + key) {
+			entries = append(entries, key)
+		}
+	}
+	return entries, nil
+}
+
+func listCubbyhole(prefix string) ([]string, error) {
+	resp, err := serverVaultClient().Logical().List("cubbyhole/" + prefix)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Data == nil {
+		return []string{}, nil
+	}
+	keys, _ := resp.Data["keys"].([]interface{})
+	results := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if s, ok := key.(string); ok {
+			results = append(results, s)
+		}
+	}
+	return results, nil
+}
+
+func anyWrappingTokenAlive(tokens []string) bool {
+	for _, token := range tokens {
+		if token == "" {
+			continue
+		}
+		_, err := serverVaultClient().Logical().Write("sys/wrapping/lookup", map[string]interface{}{
+			"token": token,
+		})
+		if err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// periodically reports orphaned state, leaving deletion to an operator
+func reportOrphanedStateEvery(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		orphans, err := FindOrphanedState()
+		if err != nil {
+			errorChannel <- err
+			continue
+		}
+		if len(orphans) > 0 {
+			log.Println("[INFO ]: Found", len(orphans), "orphaned goldfish entries, see /api/maintenance/gc")
+		}
+	}
+}
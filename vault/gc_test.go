@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGCEntry(t *testing.T) {
+	Convey("Only entries directly under goldfish's own prefixes should be collected", t, func(c C) {
+		c.So(gcEntry("requests/abc123"), ShouldBeTrue)
+		c.So(gcEntry("known_users/abc123"), ShouldBeTrue)
+		c.So(gcEntry("control_groups/abc123"), ShouldBeTrue)
+		c.So(gcEntry("preferences/abc123"), ShouldBeTrue)
+		c.So(gcEntry("incident"), ShouldBeTrue)
+
+		for _, path := range []string{
+			"requests/",
+			"requests/..",
+			"requests/team/abc123",
+			"requests/../preferences/abc123",
+			"request_history/abc123",
+			"incident/abc123",
+			"secret/foo",
+			"abc123",
+		} {
+			c.So(gcEntry(path), ShouldBeFalse)
+		}
+	})
+
+	Convey("Deleting anything else should be refused before anything is deleted", t, func(c C) {
+		c.So(DeleteOrphanedState([]string{"request_history/abc123"}), ShouldNotBeNil)
+		c.So(DeleteOrphanedState([]string{"requests/team/abc123"}), ShouldNotBeNil)
+	})
+}
+
+func TestFindOrphanedState(t *testing.T) {
+	Convey("Preferences of people gone for good and an expired incident should be reported", t, func(c C) {
+		user := func(identity string, lastLogin time.Time) map[string]interface{} {
+			raw, _ := json.Marshal(KnownUser{Identity: identity, LastLogin: lastLogin.Format(time.RFC3339)})
+			return map[string]interface{}{"user": string(raw)}
+		}
+		incident, _ := json.Marshal(map[string]interface{}{"id": "abc", "expires": time.Now().Add(-time.Hour)})
+		entries := map[string]map[string]interface{}{
+			"known_users/active": user("active", time.Now()),
+			"known_users/gone":   user("gone", time.Now().Add(-100*24*time.Hour)),
+			"preferences/active": {"preferences": "{}"},
+			"preferences/gone":   {"preferences": "{}"},
+			"preferences/never":  {"preferences": "{}"},
+			"incident":           {"incident": "vault:v1:" + base64.StdEncoding.EncodeToString(incident)},
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := strings.TrimPrefix(r.URL.Path, "/v1/")
+			switch {
+			case path == "transit/decrypt/server":
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				ciphertext, _ := body["ciphertext"].(string)
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"plaintext": strings.TrimPrefix(ciphertext, "vault:v1:")}})
+			case r.URL.Query().Get("list") == "true":
+				keys := []string{}
+				for name := range entries {
+					if strings.HasPrefix("cubbyhole/"+name, path+"/") {
+						keys = append(keys, strings.TrimPrefix("cubbyhole/"+name, path+"/"))
+					}
+				}
+				if len(keys) == 0 {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+			case entries[strings.TrimPrefix(path, "cubbyhole/")] != nil:
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": entries[strings.TrimPrefix(path, "cubbyhole/")]})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		address := VaultAddress
+		VaultAddress = server.URL
+		defer func() { VaultAddress = address }()
+		configLock.Lock()
+		previous := config
+		config = Config{TransitBackend: "transit", ServerTransitKey: "server"}
+		configLock.Unlock()
+		defer func() {
+			configLock.Lock()
+			config = previous
+			configLock.Unlock()
+		}()
+		client, err := newVaultClient("", nil, nil)
+		c.So(err, ShouldBeNil)
+		previousClient, previousToken := serverVaultClient(), ServerToken()
+		setServerToken(client, "server-token")
+		defer setServerToken(previousClient, previousToken)
+
+		orphans, err := FindOrphanedState()
+		c.So(err, ShouldBeNil)
+		paths := []string{}
+		for _, orphan := range orphans {
+			paths = append(paths, orphan.Path)
+		}
+		c.So(paths, ShouldContain, "known_users/gone")
+		c.So(paths, ShouldContain, "preferences/gone")
+		c.So(paths, ShouldContain, "preferences/never")
+		c.So(paths, ShouldContain, "incident")
+		c.So(paths, ShouldNotContain, "known_users/active")
+		c.So(paths, ShouldNotContain, "preferences/active")
+	})
+}
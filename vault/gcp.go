@@ -0,0 +1,43 @@
+package vault
+
+import (
+	"errors"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func init() {
+	RegisterSecretEngine("gcp", credentialEngine{
+		description: EngineDescription{
+			Type:        "gcp",
+			Name:        "Google Cloud",
+			Description: "Dynamic GCP OAuth2 access tokens and service account keys",
+		},
+		rolesPath: "rolesets",
+		credsPath: "token",
+	})
+}
+
+func (auth AuthInfo) ListGCPRolesets(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "gcp") + "rolesets")
+}
+
+// roleset details include the bound project, bindings and service account
+func (auth AuthInfo) ReadGCPRoleset(mount, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty roleset name")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "gcp") + "roleset/" + name)
+}
+
+// generates an OAuth2 access token for the roleset, or a service account key if key is set
+func (auth AuthInfo) GenerateGCPCredentials(mount, roleset string, key bool) (*api.Secret, error) {
+	if roleset == "" {
+		return nil, errors.New("Empty roleset name")
+	}
+	endpoint := "token/"
+	if key {
+		endpoint = "key/"
+	}
+	return auth.readCreds(mountPrefix(mount, "gcp"), endpoint+roleset)
+}
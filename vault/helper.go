@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/hashicorp/vault/api"
 )
@@ -23,33 +24,33 @@ func VaultHealth() (string, error) {
 	return string(body), nil
 }
 
-// lookup current root generation status
-func GenerateRootStatus() (*api.GenerateRootStatusResponse, error) {
-	client, err := NewVaultClient()
+// lookup current root generation status of a cluster, the default one if empty
+func GenerateRootStatus(cluster string) (*api.GenerateRootStatusResponse, error) {
+	client, err := clusterClient(cluster)
 	if err != nil {
 		return nil, err
 	}
 	return client.Sys().GenerateRootStatus()
 }
 
-func GenerateRootInit(otp string) (*api.GenerateRootStatusResponse, error) {
-	client, err := NewVaultClient()
+func GenerateRootInit(cluster, otp string) (*api.GenerateRootStatusResponse, error) {
+	client, err := clusterClient(cluster)
 	if err != nil {
 		return nil, err
 	}
 	return client.Sys().GenerateRootInit(otp, "")
 }
 
-func GenerateRootUpdate(shard, nonce string) (*api.GenerateRootStatusResponse, error) {
-	client, err := NewVaultClient()
+func GenerateRootUpdate(cluster, shard, nonce string) (*api.GenerateRootStatusResponse, error) {
+	client, err := clusterClient(cluster)
 	if err != nil {
 		return nil, err
 	}
 	return client.Sys().GenerateRootUpdate(shard, nonce)
 }
 
-func GenerateRootCancel() error {
-	client, err := NewVaultClient()
+func GenerateRootCancel(cluster string) error {
+	client, err := clusterClient(cluster)
 	if err != nil {
 		return err
 	}
@@ -61,8 +62,8 @@ func WriteToCubbyhole(name string, data map[string]interface{}) (interface{}, er
 	if err != nil {
 		return nil, err
 	}
-	client.SetToken(vaultToken)
-	return vaultClient.Logical().Write("cubbyhole/" + name, data)
+	client.SetToken(ServerToken())
+	return serverVaultClient().Logical().Write("cubbyhole/" + name, data)
 }
 
 func ReadFromCubbyhole(name string) (*api.Secret, error) {
@@ -70,8 +71,8 @@ func ReadFromCubbyhole(name string) (*api.Secret, error) {
 	if err != nil {
 		return nil, err
 	}
-	client.SetToken(vaultToken)
-	return vaultClient.Logical().Read("cubbyhole/" + name)
+	client.SetToken(ServerToken())
+	return serverVaultClient().Logical().Read("cubbyhole/" + name)
 }
 
 func DeleteFromCubbyhole(name string) (*api.Secret, error) {
@@ -79,8 +80,8 @@ func DeleteFromCubbyhole(name string) (*api.Secret, error) {
 	if err != nil {
 		return nil, err
 	}
-	client.SetToken(vaultToken)
-	return vaultClient.Logical().Delete("cubbyhole/" + name)
+	client.SetToken(ServerToken())
+	return serverVaultClient().Logical().Delete("cubbyhole/" + name)
 }
 
 func renewServerToken() (err error) {
@@ -88,7 +89,7 @@ func renewServerToken() (err error) {
 	if err != nil {
 		return err
 	}
-	client.SetToken(vaultToken)
+	client.SetToken(ServerToken())
 	_, err = client.Auth().Token().RenewSelf(0)
 	return
 }
@@ -98,7 +99,7 @@ func WrapData(wrapttl string, data map[string]interface{}) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	client.SetToken(vaultToken)
+	client.SetToken(ServerToken())
 
 	client.SetWrappingLookupFunc(func(operation, path string) string {
 		return wrapttl
@@ -117,7 +118,7 @@ func UnwrapData(wrappingToken string) (map[string]interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
-	client.SetToken(vaultToken)
+	client.SetToken(ServerToken())
 
 	// make a raw unwrap call. This will use the token as a header
 	resp, err := client.Logical().Unwrap(wrappingToken)
@@ -126,3 +127,32 @@ func UnwrapData(wrappingToken string) (map[string]interface{}, error) {
 	}
 	return resp.Data, nil
 }
+
+// normalizes a user-supplied mount path to the form "mount/", falling back to a default
+func mountPrefix(mount, fallback string) string {
+	mount = strings.Trim(mount, "/")
+	if mount == "" {
+		mount = fallback
+	}
+	return mount + "/"
+}
+
+// turns a secret with a lease into a plain response, so lease details are not lost
+func LeasedSecret(secret *api.Secret) map[string]interface{} {
+	if secret == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"data":           secret.Data,
+		"lease_id":       secret.LeaseID,
+		"lease_duration": secret.LeaseDuration,
+		"renewable":      secret.Renewable,
+		"warnings":       secret.Warnings,
+	}
+}
+
+// returns the last segment of a path, e.g. the role name of "roles/myrole"
+func lastSegment(path string) string {
+	path = strings.Trim(path, "/")
+	return path[strings.LastIndex(path, "/")+1:]
+}
@@ -0,0 +1,425 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/api"
+)
+
+// the kinds of identity changes that can be made to go through a request
+const (
+	IdentityCreateToken    = "create_token"
+	IdentityCreateSecretID = "create_secret_id"
+	IdentityDeleteUser     = "delete_user"
+	IdentityWriteAppRole   = "write_approle"
+	IdentityWriteTokenRole = "write_token_role"
+)
+
+var identityOperations = []string{
+	IdentityCreateToken,
+	IdentityCreateSecretID,
+	IdentityDeleteUser,
+	IdentityWriteAppRole,
+	IdentityWriteTokenRole,
+}
+
+// how long the credentials created by an approved request stay wrapped, unless the request asks otherwise
+const defaultIdentityWrapTTL = "24h"
+
+// a change to users or roles, made by goldfish once every approver group approves
+// Target is the role for role writes and secret ids, and the user for deletions
+// created credentials are response wrapped, and the wrapping token kept for the requester
+type IdentityRequest struct {
+	ID            string
+	Operation     string
+	Backend       string
+	Target        string
+	Params        map[string]interface{}
+	WrapTTL       string
+	Requester     string
+	RequesterHash string
+	Approvals     []PolicyApproval
+	Created       string
+	Applied       string
+	WrappingToken string
+	// the cluster the change is made on, empty for the default cluster
+	Cluster string
+}
+
+var errMalformedIdentityRequest = errors.New("Request appears to be malformed")
+
+// approvals are read, counted and written back, so two approvals must not interleave
+var identityRequestsLock = sync.Mutex{}
+
+// identity requests are approved by approver groups, so operations can only be listed along
+// with them. Otherwise listed operations could neither be made directly, nor through a request
+func parseIdentityRequestOperations(raw string, groups map[string]*ApproverGroup) error {
+	for _, op := range strings.Split(raw, ",") {
+		if op = strings.TrimSpace(op); op == "" {
+			continue
+		}
+		known := false
+		for _, o := range identityOperations {
+			known = known || o == op
+		}
+		if !known {
+			return errors.New("IdentityRequestOperations may only list " + strings.Join(identityOperations, ", "))
+		}
+		if len(groups) == 0 {
+			return errors.New("IdentityRequestOperations needs ApproverGroups to approve its requests")
+		}
+	}
+	return nil
+}
+
+// true if the operation must go through a request
+func RequiresIdentityRequest(operation string) bool {
+	for _, op := range strings.Split(GetConfig().IdentityRequestOperations, ",") {
+		if strings.TrimSpace(op) == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// creates a request on behalf of the session, on its cluster. Tokens may only be requested
+// with policies the requester holds, so a request can't be used to gain access
+func (auth AuthInfo) CreateIdentityRequest(request IdentityRequest) (*IdentityRequest, error) {
+	if !RequiresIdentityRequest(request.Operation) {
+		return nil, errors.New("Operation does not require a request")
+	}
+	if err := validateIdentityRequest(request); err != nil {
+		return nil, err
+	}
+	if request.Operation == IdentityCreateToken {
+		self, err := auth.LookupSelf()
+		if err != nil {
+			return nil, err
+		}
+		held := policiesOf(self.Data)
+		for _, policy := range requestedPolicies(request.Params) {
+			if !held[policy] {
+				return nil, errors.New("You can only request tokens with policies you hold, not " + policy)
+			}
+		}
+		client, err := serverClient(auth.Cluster, "")
+		if err != nil {
+			return nil, err
+		}
+		if err := checkServerPolicies(client, requestedPolicies(request.Params)); err != nil {
+			return nil, err
+		}
+	}
+	if request.WrapTTL == "" {
+		request.WrapTTL = defaultIdentityWrapTTL
+	}
+	if wrapTTLDuration(request.WrapTTL) <= 0 {
+		return nil, errors.New("wrap_ttl must be a duration or a number of seconds")
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	request.ID = id
+	request.Approvals = []PolicyApproval{}
+	request.Created = time.Now().UTC().Format(time.RFC3339)
+	request.Applied = ""
+	request.WrappingToken = ""
+	request.Cluster = auth.Cluster
+	if request.Params == nil {
+		request.Params = map[string]interface{}{}
+	}
+	if err := writeIdentityRequest(&request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func validateIdentityRequest(request IdentityRequest) error {
+	switch request.Operation {
+	case IdentityCreateToken:
+		// without policies, the token would get every policy of goldfish's own token
+		policies := requestedPolicies(request.Params)
+		if len(policies) == 0 {
+			return errors.New("Tokens created through a request must list their policies")
+		}
+		if containsString(policies, "root") {
+			return errors.New("Root tokens can't be created through a request")
+		}
+		// a role's policies would not be checked
+		if _, ok := request.Params["role_name"]; ok {
+			return errors.New("Tokens created through a request can't use a token role")
+		}
+	case IdentityDeleteUser:
+		if request.Backend != "token" && request.Backend != "userpass" && request.Backend != "approle" {
+			return errors.New("Unsupported user deletion type")
+		}
+		if request.Target == "" || strings.ContainsAny(request.Target, "/?#") {
+			return errors.New("Invalid deletion ID")
+		}
+	case IdentityCreateSecretID, IdentityWriteAppRole, IdentityWriteTokenRole:
+		if request.Target == "" || strings.ContainsAny(request.Target, "/?#") {
+			return errors.New("Invalid role name")
+		}
+	default:
+		return errors.New("Unsupported operation")
+	}
+	return nil
+}
+
+// the policies a create_token request asks for, given as a list or comma separated
+func requestedPolicies(params map[string]interface{}) []string {
+	policies := []string{}
+	switch raw := params["policies"].(type) {
+	case []interface{}:
+		for _, p := range raw {
+			if name, ok := p.(string); ok && strings.TrimSpace(name) != "" {
+				policies = append(policies, strings.TrimSpace(name))
+			}
+		}
+	case []string:
+		for _, name := range raw {
+			if strings.TrimSpace(name) != "" {
+				policies = append(policies, strings.TrimSpace(name))
+			}
+		}
+	case string:
+		for _, name := range strings.Split(raw, ",") {
+			if strings.TrimSpace(name) != "" {
+				policies = append(policies, strings.TrimSpace(name))
+			}
+		}
+	}
+	return policies
+}
+
+// refuses policies that goldfish's own token on the client's cluster holds, besides
+// default, since a token holding them could decrypt every session
+func checkServerPolicies(client *api.Client, policies []string) error {
+	self, err := client.Auth().Token().LookupSelf()
+	if err != nil {
+		return err
+	}
+	own := policiesOf(self.Data)
+	for _, policy := range policies {
+		if policy != "default" && own[policy] {
+			return errors.New("Tokens can't be given goldfish's own policy " + policy)
+		}
+	}
+	return nil
+}
+
+func GetIdentityRequest(id string) (*IdentityRequest, error) {
+	if id == "" || strings.Contains(id, "/") {
+		return nil, errors.New("Invalid request ID")
+	}
+	resp, err := ReadFromCubbyhole("identity_requests/" + id)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Request not found")
+	}
+
+	raw, _ := resp.Data["request"].(string)
+	var request IdentityRequest
+	if err := json.Unmarshal([]byte(raw), &request); err != nil ||
+		validateIdentityRequest(request) != nil {
+		return nil, errMalformedIdentityRequest
+	}
+	return &request, nil
+}
+
+// returns all identity requests, pending or awaiting collection. Malformed ones are left for garbage collection
+func ListIdentityRequests() ([]IdentityRequest, error) {
+	ids, err := listCubbyhole("identity_requests/")
+	if err != nil {
+		return nil, err
+	}
+	requests := []IdentityRequest{}
+	for _, id := range ids {
+		if request, err := GetIdentityRequest(id); err == nil {
+			requests = append(requests, *request)
+		}
+	}
+	return requests, nil
+}
+
+// records an approval on behalf of the approver's groups. Once every group has approved,
+// the change is made with goldfish's token. Requests that create credentials are kept
+// until the requester collects them, the others are removed
+func ApproveIdentityRequest(id string, approval PolicyApproval) (*IdentityRequest, bool, error) {
+	if len(approval.Groups) == 0 {
+		return nil, false, errors.New("You are not in any approver group")
+	}
+
+	identityRequestsLock.Lock()
+	defer identityRequestsLock.Unlock()
+
+	request, err := GetIdentityRequest(id)
+	if err != nil {
+		return nil, false, err
+	}
+	if request.Applied != "" {
+		return nil, false, errors.New("Request has already been applied")
+	}
+	if request.RequesterHash == approval.ApproverHash {
+		return nil, false, errors.New("Requester cannot approve their own request")
+	}
+	for _, existing := range request.Approvals {
+		if existing.ApproverHash == approval.ApproverHash {
+			return nil, false, errors.New("You have already approved this request")
+		}
+	}
+	approval.Approved = time.Now().UTC().Format(time.RFC3339)
+	request.Approvals = append(request.Approvals, approval)
+
+	if !PolicyApprovalsSatisfied(request.Approvals) {
+		if err := writeIdentityRequest(request); err != nil {
+			return nil, false, err
+		}
+		return request, false, nil
+	}
+
+	wrappingToken, err := applyIdentityRequest(request)
+	if err != nil {
+		return nil, false, err
+	}
+	request.Applied = time.Now().UTC().Format(time.RFC3339)
+	if wrappingToken == "" {
+		if _, err := DeleteFromCubbyhole("identity_requests/" + id); err != nil {
+			return nil, false, err
+		}
+		return request, true, nil
+	}
+
+	// the wrapping token is a credential, so it is only stored encrypted
+	if request.WrappingToken, err = encryptServer([]byte(wrappingToken)); err != nil {
+		return nil, false, err
+	}
+	if err := writeIdentityRequest(request); err != nil {
+		return nil, false, err
+	}
+	return request, true, nil
+}
+
+// makes the change with goldfish's token on the request's cluster, returning the wrapping
+// token of any created credential
+func applyIdentityRequest(request *IdentityRequest) (string, error) {
+	client, err := serverClient(request.Cluster, "")
+	if err != nil {
+		return "", err
+	}
+	logical := client.Logical()
+
+	switch request.Operation {
+	case IdentityDeleteUser:
+		return "", deleteUser(logical, request.Backend, request.Target)
+	case IdentityWriteAppRole, IdentityWriteTokenRole:
+		backend := "approle"
+		if request.Operation == IdentityWriteTokenRole {
+			backend = "token"
+		}
+		return "", writeRole(logical, backend, request.Target, request.Params)
+	}
+
+	path := "auth/approle/role/" + request.Target + "/secret-id"
+	if request.Operation == IdentityCreateToken {
+		// goldfish's policies may have changed since the request was made
+		if err := checkServerPolicies(client, requestedPolicies(request.Params)); err != nil {
+			return "", err
+		}
+		// an orphan, so the token does not depend on goldfish's own
+		path = "auth/token/create-orphan"
+	}
+	wrapttl := request.WrapTTL
+	client.SetWrappingLookupFunc(func(operation, path string) string {
+		return wrapttl
+	})
+	resp, err := logical.Write(path, request.Params)
+	if err != nil {
+		return "", err
+	}
+	if resp == nil || resp.WrapInfo == nil || resp.WrapInfo.Token == "" {
+		return "", errors.New("Vault did not wrap the created credentials")
+	}
+	return resp.WrapInfo.Token, nil
+}
+
+// hands the wrapping token of an applied request to its requester, and removes the request
+func CollectIdentityRequest(id, requesterHash string) (string, error) {
+	identityRequestsLock.Lock()
+	defer identityRequestsLock.Unlock()
+
+	request, err := GetIdentityRequest(id)
+	if err != nil {
+		return "", err
+	}
+	if request.RequesterHash != requesterHash {
+		return "", errors.New("Only the requester can collect the created credentials")
+	}
+	if request.Applied == "" || request.WrappingToken == "" {
+		return "", errors.New("Request has not been applied yet")
+	}
+	wrappingToken, err := decryptServer(request.WrappingToken)
+	if err != nil {
+		return "", err
+	}
+	if _, err := DeleteFromCubbyhole("identity_requests/" + id); err != nil {
+		return "", err
+	}
+	return string(wrappingToken), nil
+}
+
+// true if the request was applied, but its wrapped credentials outlived their wrapping
+func identityCredentialsExpired(request *IdentityRequest, now time.Time) bool {
+	if request.Applied == "" || request.WrappingToken == "" {
+		return false
+	}
+	applied, err := time.Parse(time.RFC3339, request.Applied)
+	if err != nil {
+		return false
+	}
+	ttl := wrapTTLDuration(request.WrapTTL)
+	return ttl > 0 && !now.Before(applied.Add(ttl))
+}
+
+// vault accepts wrap ttls as durations or seconds. Zero if it is neither
+func wrapTTLDuration(raw string) time.Duration {
+	if ttl, err := time.ParseDuration(raw); err == nil {
+		return ttl
+	}
+	if seconds, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+func DeleteIdentityRequest(id string) error {
+	if id == "" || strings.Contains(id, "/") {
+		return errors.New("Invalid request ID")
+	}
+	identityRequestsLock.Lock()
+	defer identityRequestsLock.Unlock()
+	_, err := DeleteFromCubbyhole("identity_requests/" + id)
+	return err
+}
+
+// stored as JSON, as the params and approvals don't survive structs.Map intact
+func writeIdentityRequest(request *IdentityRequest) error {
+	raw, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	_, err = WriteToCubbyhole("identity_requests/"+request.ID, map[string]interface{}{
+		"request": string(raw),
+	})
+	return err
+}
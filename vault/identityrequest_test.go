@@ -0,0 +1,92 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequiresIdentityRequest(t *testing.T) {
+	configLock.Lock()
+	previousConfig, previousGroups := config, approverGroups
+	configLock.Unlock()
+	defer func() {
+		configLock.Lock()
+		config, approverGroups = previousConfig, previousGroups
+		configLock.Unlock()
+	}()
+
+	set := func(operations string, groups map[string]*ApproverGroup) {
+		configLock.Lock()
+		config.IdentityRequestOperations = operations
+		approverGroups = groups
+		configLock.Unlock()
+	}
+	security := map[string]*ApproverGroup{
+		"security": {Name: "security", Policies: []string{"security"}, Required: 1},
+	}
+
+	Convey("Listed operations should require a request", t, func(c C) {
+		set("create_token, delete_user", security)
+		c.So(RequiresIdentityRequest(IdentityCreateToken), ShouldBeTrue)
+		c.So(RequiresIdentityRequest(IdentityDeleteUser), ShouldBeTrue)
+		c.So(RequiresIdentityRequest(IdentityWriteAppRole), ShouldBeFalse)
+	})
+
+	Convey("Unknown operations should be rejected in the config", t, func(c C) {
+		c.So(parseIdentityRequestOperations("", security), ShouldBeNil)
+		c.So(parseIdentityRequestOperations("write_approle,write_token_role", security), ShouldBeNil)
+		c.So(parseIdentityRequestOperations("create_token,delete_policy", security), ShouldNotBeNil)
+	})
+
+	Convey("Listed operations should need approver groups in the config", t, func(c C) {
+		c.So(parseIdentityRequestOperations("", map[string]*ApproverGroup{}), ShouldBeNil)
+		c.So(parseIdentityRequestOperations("create_token", map[string]*ApproverGroup{}), ShouldNotBeNil)
+	})
+}
+
+func TestIdentityCredentialsExpired(t *testing.T) {
+	applied := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := &IdentityRequest{
+		Applied:       applied.Format(time.RFC3339),
+		WrapTTL:       "1h",
+		WrappingToken: "vault:v1:ciphertext",
+	}
+
+	Convey("Credentials should expire with their wrapping", t, func(c C) {
+		c.So(identityCredentialsExpired(request, applied.Add(30*time.Minute)), ShouldBeFalse)
+		c.So(identityCredentialsExpired(request, applied.Add(time.Hour)), ShouldBeTrue)
+	})
+
+	Convey("Wrap ttls in seconds should be understood", t, func(c C) {
+		seconds := *request
+		seconds.WrapTTL = "600"
+		c.So(identityCredentialsExpired(&seconds, applied.Add(5*time.Minute)), ShouldBeFalse)
+		c.So(identityCredentialsExpired(&seconds, applied.Add(10*time.Minute)), ShouldBeTrue)
+	})
+
+	Convey("Requests that were not applied should never expire", t, func(c C) {
+		pending := *request
+		pending.Applied, pending.WrappingToken = "", ""
+		c.So(identityCredentialsExpired(&pending, applied.Add(48*time.Hour)), ShouldBeFalse)
+	})
+}
+
+func TestValidateCreateTokenRequest(t *testing.T) {
+	Convey("Token requests should list their policies", t, func(c C) {
+		request := IdentityRequest{Operation: IdentityCreateToken, Params: map[string]interface{}{}}
+		c.So(validateIdentityRequest(request), ShouldNotBeNil)
+
+		request.Params["policies"] = []interface{}{"dev", "ops"}
+		c.So(validateIdentityRequest(request), ShouldBeNil)
+		c.So(requestedPolicies(request.Params), ShouldResemble, []string{"dev", "ops"})
+
+		request.Params["policies"] = "dev, root"
+		c.So(validateIdentityRequest(request), ShouldNotBeNil)
+
+		request.Params["policies"] = "dev"
+		request.Params["role_name"] = "admin"
+		c.So(validateIdentityRequest(request), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,39 @@
+package vault
+
+// incident mode is kept in the cubbyhole rather than in one goldfish's memory,
+// so that every replica captures requests while it is on
+const incidentPath = "incident"
+
+// stores the current incident, replacing any other. It holds the incident's hmac key,
+// so it is encrypted with the server transit key
+func WriteIncident(raw []byte) error {
+	ciphertext, err := encryptServer(raw)
+	if err != nil {
+		return err
+	}
+	_, err = WriteToCubbyhole(incidentPath, map[string]interface{}{
+		"incident": ciphertext,
+	})
+	return err
+}
+
+// returns the stored incident, nil if there is none
+func ReadIncident() ([]byte, error) {
+	resp, err := ReadFromCubbyhole(incidentPath)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, nil
+	}
+	ciphertext, _ := resp.Data["incident"].(string)
+	if ciphertext == "" {
+		return nil, nil
+	}
+	return decryptServer(ciphertext)
+}
+
+func DeleteIncident() error {
+	_, err := DeleteFromCubbyhole(incidentPath)
+	return err
+}
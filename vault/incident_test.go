@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIncidentStorage(t *testing.T) {
+	Convey("The incident should be kept in the cubbyhole, encrypted", t, func(c C) {
+		stored := map[string]interface{}{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			switch {
+			case r.URL.Path == "/v1/transit/encrypt/server":
+				plaintext, _ := body["plaintext"].(string)
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"ciphertext": "vault:v1:" + plaintext}})
+			case r.URL.Path == "/v1/transit/decrypt/server":
+				ciphertext, _ := body["ciphertext"].(string)
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"plaintext": strings.TrimPrefix(ciphertext, "vault:v1:")}})
+			case r.URL.Path == "/v1/cubbyhole/incident" && r.Method == "GET":
+				if len(stored) == 0 {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"errors": []}`))
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": stored})
+			case r.URL.Path == "/v1/cubbyhole/incident" && r.Method == "DELETE":
+				stored = map[string]interface{}{}
+				w.WriteHeader(http.StatusNoContent)
+			case r.URL.Path == "/v1/cubbyhole/incident":
+				stored = body
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		address := VaultAddress
+		VaultAddress = server.URL
+		defer func() { VaultAddress = address }()
+		configLock.Lock()
+		previous := config
+		config.TransitBackend = "transit"
+		config.ServerTransitKey = "server"
+		configLock.Unlock()
+		defer func() {
+			configLock.Lock()
+			config = previous
+			configLock.Unlock()
+		}()
+		client, err := newVaultClient("", nil, nil)
+		c.So(err, ShouldBeNil)
+		previousClient, previousToken := serverVaultClient(), ServerToken()
+		setServerToken(client, "server-token")
+		defer setServerToken(previousClient, previousToken)
+
+		raw, err := ReadIncident()
+		c.So(err, ShouldBeNil)
+		c.So(raw, ShouldBeNil)
+
+		c.So(WriteIncident([]byte(`{"id": "abc", "key": "secret"}`)), ShouldBeNil)
+		c.So(stored["incident"], ShouldStartWith, "vault:v1:")
+		raw, err = ReadIncident()
+		c.So(err, ShouldBeNil)
+		c.So(string(raw), ShouldEqual, `{"id": "abc", "key": "secret"}`)
+
+		c.So(DeleteIncident(), ShouldBeNil)
+		raw, err = ReadIncident()
+		c.So(err, ShouldBeNil)
+		c.So(raw, ShouldBeNil)
+	})
+}
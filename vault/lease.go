@@ -0,0 +1,166 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// a lease, as vault's lease lookup describes it
+type LeaseInfo struct {
+	ID          string `json:"id"`
+	IssueTime   string `json:"issue_time"`
+	ExpireTime  string `json:"expire_time"`
+	LastRenewal string `json:"last_renewal"`
+	Renewable   bool   `json:"renewable"`
+	TTL         int    `json:"ttl"`
+}
+
+// the leases directly under a prefix, and the prefixes below it
+type LeaseListing struct {
+	Prefixes []string    `json:"prefixes"`
+	Leases   []LeaseInfo `json:"leases"`
+}
+
+// a lease prefix with exactly one trailing slash, or an empty prefix for the root
+func cleanLeasePrefix(prefix string) (string, error) {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if strings.Contains(prefix, "..") || strings.ContainsAny(prefix, "?#") {
+		return "", errors.New("Invalid lease prefix")
+	}
+	if prefix == "" {
+		return "", nil
+	}
+	return prefix + "/", nil
+}
+
+// lists the leases under a prefix, looking each up starting at offset, until the budget runs out
+// if listing stopped early, the offset to continue from is returned, otherwise -1
+// prefixes are only included from the start, as they need no lookups
+func (auth AuthInfo) ListLeasesWithin(prefix string, offset int, budget Budget) (*LeaseListing, int, error) {
+	prefix, err := cleanLeasePrefix(prefix)
+	if err != nil {
+		return nil, -1, err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, -1, err
+	}
+
+	keys, err := listKeys(client.Logical(), "sys/leases/lookup/"+prefix)
+	if err != nil {
+		return nil, -1, err
+	}
+	listing := &LeaseListing{Prefixes: []string{}, Leases: []LeaseInfo{}}
+	ids := []string{}
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") {
+			if offset == 0 {
+				listing.Prefixes = append(listing.Prefixes, prefix+key)
+			}
+		} else {
+			ids = append(ids, prefix+key)
+		}
+	}
+	if offset > len(ids) {
+		return nil, -1, errors.New("Offset out of bound")
+	}
+
+	for i, id := range ids[offset:] {
+		if budget.Exceeded() {
+			return listing, offset + i, nil
+		}
+		lease, err := auth.LookupLease(id)
+		// the lease may have expired or been revoked since listing
+		if err != nil {
+			continue
+		}
+		listing.Leases = append(listing.Leases, *lease)
+	}
+	return listing, -1, nil
+}
+
+func (auth AuthInfo) LookupLease(leaseID string) (*LeaseInfo, error) {
+	if leaseID == "" {
+		return nil, errors.New("Empty lease id")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Write("sys/leases/lookup", map[string]interface{}{
+		"lease_id": leaseID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Lease not found")
+	}
+	return parseLeaseInfo(resp.Data)
+}
+
+func parseLeaseInfo(data map[string]interface{}) (*LeaseInfo, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var lease LeaseInfo
+	if err := json.Unmarshal(raw, &lease); err != nil {
+		return nil, err
+	}
+	if lease.ID == "" {
+		return nil, errors.New("Vault did not describe the lease")
+	}
+	return &lease, nil
+}
+
+// extends a lease by increment seconds, or by its default if increment is 0
+func (auth AuthInfo) RenewLease(leaseID string, increment int) (*LeaseInfo, error) {
+	if leaseID == "" {
+		return nil, errors.New("Empty lease id")
+	}
+	if increment < 0 {
+		return nil, errors.New("Increment must not be negative")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.Sys().Renew(leaseID, increment); err != nil {
+		return nil, err
+	}
+	return auth.LookupLease(leaseID)
+}
+
+// revokes a lease immediately, invalidating any dynamic credentials tied to it
+func (auth AuthInfo) RevokeLease(leaseID string) error {
+	if leaseID == "" {
+		return errors.New("Empty lease id")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	return client.Sys().Revoke(leaseID)
+}
+
+// revokes every lease under a prefix. Forcing removes the leases even if the backend
+// fails to revoke the credentials, which may leave them valid outside of vault
+func (auth AuthInfo) RevokeLeasePrefix(prefix string, force bool) error {
+	prefix, err := cleanLeasePrefix(prefix)
+	if err != nil {
+		return err
+	}
+	if prefix == "" {
+		return errors.New("A lease prefix is required")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	if force {
+		return client.Sys().RevokeForce(prefix)
+	}
+	return client.Sys().RevokePrefix(prefix)
+}
@@ -0,0 +1,51 @@
+package vault
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCleanLeasePrefix(t *testing.T) {
+	Convey("Lease prefixes should end with exactly one slash", t, func(c C) {
+		prefix, err := cleanLeasePrefix("/aws/creds/deploy//")
+		c.So(err, ShouldBeNil)
+		c.So(prefix, ShouldEqual, "aws/creds/deploy/")
+	})
+
+	Convey("An empty prefix should stand for every lease", t, func(c C) {
+		prefix, err := cleanLeasePrefix(" / ")
+		c.So(err, ShouldBeNil)
+		c.So(prefix, ShouldEqual, "")
+	})
+
+	Convey("Traversing prefixes should be rejected", t, func(c C) {
+		_, err := cleanLeasePrefix("aws/../sys")
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestParseLeaseInfo(t *testing.T) {
+	Convey("Lease lookups should be read into their fields", t, func(c C) {
+		var data map[string]interface{}
+		c.So(json.Unmarshal([]byte(`{
+			"id": "aws/creds/deploy/abcd",
+			"issue_time": "2017-07-01T10:00:00Z",
+			"expire_time": "2017-07-01T11:00:00Z",
+			"last_renewal": null,
+			"renewable": true,
+			"ttl": 3599
+		}`), &data), ShouldBeNil)
+		lease, err := parseLeaseInfo(data)
+		c.So(err, ShouldBeNil)
+		c.So(lease.ID, ShouldEqual, "aws/creds/deploy/abcd")
+		c.So(lease.Renewable, ShouldBeTrue)
+		c.So(lease.TTL, ShouldEqual, 3599)
+	})
+
+	Convey("Lookups without a lease id should be rejected", t, func(c C) {
+		_, err := parseLeaseInfo(map[string]interface{}{"ttl": 5})
+		c.So(err, ShouldNotBeNil)
+	})
+}
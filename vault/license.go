@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// how many days before a license expires that it is flagged, unless LicenseWarningDays says otherwise
+const defaultLicenseWarningDays = 30
+
+// a vault enterprise license. Warning is set once it expires within LicenseWarningDays
+type License struct {
+	LicenseID      string   `json:"license_id"`
+	ExpirationTime string   `json:"expiration_time"`
+	Features       []string `json:"features"`
+	ExpiresInDays  int      `json:"expires_in_days"`
+	Warning        bool     `json:"warning"`
+}
+
+func LicenseWarningDays() int {
+	if n, err := strconv.Atoi(GetConfig().LicenseWarningDays); err == nil && n >= 0 {
+		return n
+	}
+	return defaultLicenseWarningDays
+}
+
+func parseLicenseWarningDays(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(raw); err != nil || n < 0 {
+		return errors.New("LicenseWarningDays must be a non-negative number of days")
+	}
+	return nil
+}
+
+// the license of the cluster the session works on
+func (auth AuthInfo) GetLicense() (*License, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	// newer vaults report the license in use under autoloaded, or else persisted
+	resp, err := client.Logical().Read("sys/license/status")
+	if err == nil && resp != nil {
+		for _, key := range []string{"autoloaded", "persisted"} {
+			if data, ok := resp.Data[key].(map[string]interface{}); ok {
+				return parseLicense(data, LicenseWarningDays(), time.Now())
+			}
+		}
+	}
+	// older vaults only have sys/license
+	resp, err = client.Logical().Read("sys/license")
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Licenses are only available in vault enterprise")
+	}
+	return parseLicense(resp.Data, LicenseWarningDays(), time.Now())
+}
+
+func parseLicense(data map[string]interface{}, warningDays int, now time.Time) (*License, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	license := &License{}
+	if err := json.Unmarshal(b, license); err != nil {
+		return nil, errors.New("Could not read license: " + err.Error())
+	}
+	if license.Features == nil {
+		license.Features = []string{}
+	}
+	expires, err := time.Parse(time.RFC3339, license.ExpirationTime)
+	if err != nil {
+		return nil, errors.New("License has no valid expiration time")
+	}
+	license.ExpiresInDays = int(expires.Sub(now).Hours() / 24)
+	license.Warning = expires.Before(now.AddDate(0, 0, warningDays))
+	return license, nil
+}
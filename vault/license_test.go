@@ -0,0 +1,39 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseLicense(t *testing.T) {
+	now := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	data := func(expiration string) map[string]interface{} {
+		return map[string]interface{}{
+			"license_id":      "3e8c6b5d",
+			"expiration_time": expiration,
+			"features":        []interface{}{"HSM", "Performance Replication"},
+		}
+	}
+
+	Convey("Licenses far from expiring should not warn", t, func(c C) {
+		license, err := parseLicense(data("2018-12-01T00:00:00Z"), 30, now)
+		c.So(err, ShouldBeNil)
+		c.So(license.Warning, ShouldBeFalse)
+		c.So(license.ExpiresInDays, ShouldEqual, 275)
+		c.So(license.Features, ShouldResemble, []string{"HSM", "Performance Replication"})
+	})
+
+	Convey("Licenses expiring within the threshold should warn", t, func(c C) {
+		license, err := parseLicense(data("2018-03-20T00:00:00Z"), 30, now)
+		c.So(err, ShouldBeNil)
+		c.So(license.Warning, ShouldBeTrue)
+		c.So(license.ExpiresInDays, ShouldEqual, 19)
+	})
+
+	Convey("Licenses without an expiration time should be rejected", t, func(c C) {
+		_, err := parseLicense(data(""), 30, now)
+		c.So(err, ShouldNotBeNil)
+	})
+}
@@ -2,24 +2,54 @@ package vault
 
 import (
 	"errors"
+	"net/http"
+
 	"github.com/hashicorp/vault/api"
 )
 
 // constructs a client with server's vault address and client access token
+// if tenants are configured, the client is confined to the session's tenant scope
 func (auth AuthInfo) Client() (*api.Client, error) {
-	client, err := NewVaultClient()
+	client, _, err := auth.clientTransport()
+	return client, err
+}
+
+// the client, and the transport its requests go through, for requests the client can't make
+func (auth AuthInfo) clientTransport() (*api.Client, http.RoundTripper, error) {
+	c, err := lookupCluster(auth.Cluster)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	tenant := &tenantTransport{}
+	groups := &controlGroupTransport{}
+	client, err := newClusterClient(c, auth.Namespace, auth.request, tenant, groups)
+	if err != nil {
+		return nil, nil, err
 	}
 	client.SetToken(auth.ID)
-	_, err = client.Auth().Token().LookupSelf()
-	return client, err
+	self, err := lookupSelfCached(auth.Cluster, client)
+	if err != nil {
+		return client, tenant, err
+	}
+	groups.self = self.Data
+	tenant.scope, err = tenantScopeFor(self.Data)
+	return client, tenant, err
 }
 
 // verifies whether auth ID and password are valid
 // if valid, creates a client access token and returns the metadata
 func (auth *AuthInfo) Login() (map[string]interface{}, error) {
-	client, err := NewVaultClient()
+	namespace, err := normalizeNamespace(auth.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	auth.Namespace = namespace
+	c, err := lookupCluster(auth.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	// logging in to an auth backend of a namespace needs the namespace too
+	client, err := newClusterClient(c, namespace, auth.request, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -119,6 +149,7 @@ func (auth AuthInfo) RenewSelf() (*api.Secret, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer InvalidateToken(auth.Cluster, auth.ID)
 	return client.Auth().Token().RenewSelf(0)
 }
 
@@ -127,5 +158,5 @@ func (auth AuthInfo) LookupSelf() (*api.Secret, error) {
 	if err != nil {
 		return nil, err
 	}
-	return client.Auth().Token().LookupSelf()
+	return lookupSelfCached(auth.Cluster, client)
 }
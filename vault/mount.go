@@ -1,6 +1,10 @@
 package vault
 
 import (
+	"errors"
+	"strings"
+
+	"github.com/fatih/structs"
 	"github.com/hashicorp/vault/api"
 )
 
@@ -31,3 +35,94 @@ func (auth AuthInfo) TuneMount(path string, config api.MountConfigInput) error {
 
 	return client.Sys().TuneMount(path+"/", config)
 }
+
+// a new secret backend mount. Options are backend specific, e.g. version for kv
+type MountSpec struct {
+	Path        string               `json:"path"`
+	Type        string               `json:"type"`
+	Description string               `json:"description"`
+	Local       bool                 `json:"local"`
+	Config      api.MountConfigInput `json:"config"`
+	Options     map[string]string    `json:"options"`
+}
+
+// a mount path without its surrounding slashes, or an error if it can't be one
+func cleanMountPath(path string) (string, error) {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" || strings.Contains(path, "..") || strings.ContainsAny(path, "?#") {
+		return "", errors.New("Invalid mount path")
+	}
+	return path, nil
+}
+
+// goldfish's transit backend holds the keys every session is encrypted with, so it must
+// never be disabled or moved away through goldfish
+func checkOwnMount(path string) error {
+	if path == strings.Trim(GetConfig().TransitBackend, "/") {
+		return errors.New("Goldfish's own transit backend can't be disabled or moved through goldfish")
+	}
+	return nil
+}
+
+func (auth AuthInfo) EnableMount(spec MountSpec) error {
+	path, err := cleanMountPath(spec.Path)
+	if err != nil {
+		return err
+	}
+	if spec.Type == "" {
+		return errors.New("Mount type is required")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+
+	// the api client's mount input has no options, so the request is made directly
+	data := map[string]interface{}{
+		"type":        spec.Type,
+		"description": spec.Description,
+		"local":       spec.Local,
+		"config":      structs.Map(spec.Config),
+	}
+	if len(spec.Options) > 0 {
+		data["options"] = spec.Options
+	}
+	_, err = client.Logical().Write("sys/mounts/"+path, data)
+	return err
+}
+
+// disables a mount, revoking all of its leases and deleting all of its data
+func (auth AuthInfo) DisableMount(path string) error {
+	path, err := cleanMountPath(path)
+	if err != nil {
+		return err
+	}
+	if err := checkOwnMount(path); err != nil {
+		return err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	return client.Sys().Unmount(path)
+}
+
+// moves a mount to another path, keeping its data. Leases of the old path are revoked
+func (auth AuthInfo) MoveMount(from, to string) error {
+	from, err := cleanMountPath(from)
+	if err != nil {
+		return err
+	}
+	to, err = cleanMountPath(to)
+	if err != nil {
+		return err
+	}
+	if err := checkOwnMount(from); err != nil {
+		return err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	return client.Sys().Remount(from, to)
+}
@@ -0,0 +1,46 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCleanMountPath(t *testing.T) {
+	Convey("Mount paths should lose their surrounding slashes", t, func(c C) {
+		path, err := cleanMountPath(" /team/kv/ ")
+		c.So(err, ShouldBeNil)
+		c.So(path, ShouldEqual, "team/kv")
+	})
+
+	Convey("Empty and traversing paths should be rejected", t, func(c C) {
+		for _, path := range []string{"", "/", "../sys", "kv?x=1"} {
+			_, err := cleanMountPath(path)
+			c.So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestOwnMount(t *testing.T) {
+	Convey("Goldfish's own transit backend", t, func(c C) {
+		configLock.Lock()
+		previous := config
+		config.TransitBackend = "transit"
+		configLock.Unlock()
+		defer func() {
+			configLock.Lock()
+			config = previous
+			configLock.Unlock()
+		}()
+
+		c.Convey("Should not be disabled or moved away", func(c C) {
+			auth := AuthInfo{}
+			c.So(auth.DisableMount("/transit/"), ShouldNotBeNil)
+			c.So(auth.MoveMount("transit", "old-transit"), ShouldNotBeNil)
+		})
+
+		c.Convey("Should leave other mounts alone", func(c C) {
+			c.So(checkOwnMount("team/kv"), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,246 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/api"
+)
+
+// the tunable settings of a mount. Empty fields are left as they are
+type MountSettings struct {
+	DefaultLeaseTTL string `json:"default_lease_ttl"`
+	MaxLeaseTTL     string `json:"max_lease_ttl"`
+	Description     string `json:"description"`
+}
+
+// a change to a mount's settings, applied by goldfish once every approver group approves
+type MountRequest struct {
+	ID            string
+	Mount         string
+	Current       MountSettings
+	New           MountSettings
+	Requester     string
+	RequesterHash string
+	Approvals     []PolicyApproval
+	Created       string
+	// the cluster the mount is on, empty for the default cluster
+	Cluster string
+}
+
+var errMalformedMountRequest = errors.New("Request appears to be malformed")
+
+// approvals are read, counted and written back, so two approvals must not interleave
+var mountRequestsLock = sync.Mutex{}
+
+// true if tuning the mount must go through a request
+func RequiresMountRequest(mount string) bool {
+	mount = strings.Trim(mount, "/")
+	for _, m := range strings.Split(GetConfig().MountRequestMounts, ",") {
+		if m = strings.Trim(strings.TrimSpace(m), "/"); m == "*" || (m != "" && m == mount) {
+			return true
+		}
+	}
+	return false
+}
+
+// mount requests are approved by approver groups, so mounts can only be listed along with them
+// Otherwise listed mounts could neither be tuned directly, nor through an approved request
+func parseMountRequestMounts(raw string, groups map[string]*ApproverGroup) error {
+	if strings.TrimSpace(strings.Replace(raw, ",", "", -1)) != "" && len(groups) == 0 {
+		return errors.New("MountRequestMounts needs ApproverGroups to approve its requests")
+	}
+	return nil
+}
+
+// reads a mount's current settings, with goldfish's token so all requests compare alike
+func currentMountSettings(client *api.Client, mount string) (MountSettings, error) {
+	mounts, err := client.Sys().ListMounts()
+	if err != nil {
+		return MountSettings{}, err
+	}
+	m, ok := mounts[mount+"/"]
+	if !ok {
+		return MountSettings{}, errors.New("Mount not found")
+	}
+	return MountSettings{
+		DefaultLeaseTTL: strconv.Itoa(m.Config.DefaultLeaseTTL),
+		MaxLeaseTTL:     strconv.Itoa(m.Config.MaxLeaseTTL),
+		Description:     m.Description,
+	}, nil
+}
+
+func CreateMountRequest(cluster, mount string, settings MountSettings, requester, requesterHash string) (*MountRequest, error) {
+	mount = strings.Trim(mount, "/")
+	if !RequiresMountRequest(mount) {
+		return nil, errors.New("Mount does not require a request")
+	}
+	if settings == (MountSettings{}) {
+		return nil, errors.New("Request does not change anything")
+	}
+	for _, ttl := range []string{settings.DefaultLeaseTTL, settings.MaxLeaseTTL} {
+		if ttl == "" || ttl == "system" {
+			continue
+		}
+		if _, err := strconv.Atoi(ttl); err == nil {
+			continue
+		}
+		if _, err := time.ParseDuration(ttl); err != nil {
+			return nil, errors.New("TTLs must be durations, seconds, or 'system'")
+		}
+	}
+
+	client, err := serverClient(cluster, "")
+	if err != nil {
+		return nil, err
+	}
+	current, err := currentMountSettings(client, mount)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	request := &MountRequest{
+		ID:            id,
+		Mount:         mount,
+		Current:       current,
+		New:           settings,
+		Requester:     requester,
+		RequesterHash: requesterHash,
+		Approvals:     []PolicyApproval{},
+		Created:       time.Now().UTC().Format(time.RFC3339),
+		Cluster:       cluster,
+	}
+	if err := writeMountRequest(request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func GetMountRequest(id string) (*MountRequest, error) {
+	if id == "" || strings.Contains(id, "/") {
+		return nil, errors.New("Invalid request ID")
+	}
+	resp, err := ReadFromCubbyhole("mount_requests/" + id)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Request not found")
+	}
+
+	raw, _ := resp.Data["request"].(string)
+	var request MountRequest
+	if err := json.Unmarshal([]byte(raw), &request); err != nil || request.Mount == "" {
+		return nil, errMalformedMountRequest
+	}
+	return &request, nil
+}
+
+// returns all pending mount requests. Malformed ones are left for garbage collection
+func ListMountRequests() ([]MountRequest, error) {
+	ids, err := listCubbyhole("mount_requests/")
+	if err != nil {
+		return nil, err
+	}
+	requests := []MountRequest{}
+	for _, id := range ids {
+		if request, err := GetMountRequest(id); err == nil {
+			requests = append(requests, *request)
+		}
+	}
+	return requests, nil
+}
+
+// records an approval on behalf of the approver's groups. Once every group has approved,
+// the mount is tuned with goldfish's token and the request removed
+func ApproveMountRequest(id string, approval PolicyApproval) (*MountRequest, bool, error) {
+	if len(approval.Groups) == 0 {
+		return nil, false, errors.New("You are not in any approver group")
+	}
+
+	mountRequestsLock.Lock()
+	defer mountRequestsLock.Unlock()
+
+	request, err := GetMountRequest(id)
+	if err != nil {
+		return nil, false, err
+	}
+	if request.RequesterHash == approval.ApproverHash {
+		return nil, false, errors.New("Requester cannot approve their own request")
+	}
+	for _, existing := range request.Approvals {
+		if existing.ApproverHash == approval.ApproverHash {
+			return nil, false, errors.New("You have already approved this request")
+		}
+	}
+	approval.Approved = time.Now().UTC().Format(time.RFC3339)
+	request.Approvals = append(request.Approvals, approval)
+
+	if !PolicyApprovalsSatisfied(request.Approvals) {
+		if err := writeMountRequest(request); err != nil {
+			return nil, false, err
+		}
+		return request, false, nil
+	}
+
+	// like policy requests, a mount tuned since the request was made must be requested again
+	client, err := serverClient(request.Cluster, "")
+	if err != nil {
+		return nil, false, err
+	}
+	current, err := currentMountSettings(client, request.Mount)
+	if err != nil {
+		return nil, false, err
+	}
+	if current != request.Current {
+		return nil, false, errors.New("Mount has been tuned since the request was made")
+	}
+
+	data := map[string]interface{}{}
+	if request.New.DefaultLeaseTTL != "" {
+		data["default_lease_ttl"] = request.New.DefaultLeaseTTL
+	}
+	if request.New.MaxLeaseTTL != "" {
+		data["max_lease_ttl"] = request.New.MaxLeaseTTL
+	}
+	if request.New.Description != "" {
+		data["description"] = request.New.Description
+	}
+	if _, err := client.Logical().Write("sys/mounts/"+request.Mount+"/tune", data); err != nil {
+		return nil, false, err
+	}
+	if _, err := DeleteFromCubbyhole("mount_requests/" + id); err != nil {
+		return nil, false, err
+	}
+	return request, true, nil
+}
+
+func DeleteMountRequest(id string) error {
+	if id == "" || strings.Contains(id, "/") {
+		return errors.New("Invalid request ID")
+	}
+	mountRequestsLock.Lock()
+	defer mountRequestsLock.Unlock()
+	_, err := DeleteFromCubbyhole("mount_requests/" + id)
+	return err
+}
+
+// stored as JSON, as the settings and approvals don't survive structs.Map intact
+func writeMountRequest(request *MountRequest) error {
+	raw, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	_, err = WriteToCubbyhole("mount_requests/"+request.ID, map[string]interface{}{
+		"request": string(raw),
+	})
+	return err
+}
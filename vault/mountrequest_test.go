@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequiresMountRequest(t *testing.T) {
+	configLock.Lock()
+	previousConfig, previousGroups := config, approverGroups
+	configLock.Unlock()
+	defer func() {
+		configLock.Lock()
+		config, approverGroups = previousConfig, previousGroups
+		configLock.Unlock()
+	}()
+
+	set := func(mounts string, groups map[string]*ApproverGroup) {
+		configLock.Lock()
+		config.MountRequestMounts = mounts
+		approverGroups = groups
+		configLock.Unlock()
+	}
+	security := map[string]*ApproverGroup{
+		"security": {Name: "security", Policies: []string{"security"}, Required: 1},
+	}
+
+	Convey("Listed mounts should require a request", t, func(c C) {
+		set("secret/, /pki", security)
+		c.So(RequiresMountRequest("secret"), ShouldBeTrue)
+		c.So(RequiresMountRequest("pki/"), ShouldBeTrue)
+		c.So(RequiresMountRequest("transit"), ShouldBeFalse)
+	})
+
+	Convey("A wildcard should cover every mount", t, func(c C) {
+		set("*", security)
+		c.So(RequiresMountRequest("transit"), ShouldBeTrue)
+	})
+
+	Convey("Listed mounts should need approver groups in the config", t, func(c C) {
+		c.So(parseMountRequestMounts("", map[string]*ApproverGroup{}), ShouldBeNil)
+		c.So(parseMountRequestMounts("secret/", security), ShouldBeNil)
+		c.So(parseMountRequestMounts("secret/", map[string]*ApproverGroup{}), ShouldNotBeNil)
+		c.So(parseMountRequestMounts("*", nil), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,86 @@
+package vault
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// namespaces are nested by slashes, e.g. "team-a/dev"
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(/[A-Za-z0-9_-]+)*$`)
+
+// namespaceTransport makes every request of a client in a vault enterprise namespace
+type namespaceTransport struct {
+	base      http.RoundTripper
+	namespace string
+}
+
+func (t *namespaceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the request may be retried, so it is copied rather than changed
+	clone := new(http.Request)
+	*clone = *req
+	clone.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		clone.Header[k] = v
+	}
+	clone.Header.Set("X-Vault-Namespace", t.namespace)
+	return t.base.RoundTrip(clone)
+}
+
+// trims the slashes vault allows around a namespace path, empty is the root namespace
+func normalizeNamespace(namespace string) (string, error) {
+	namespace = strings.Trim(strings.TrimSpace(namespace), "/")
+	if namespace != "" && !namespacePattern.MatchString(namespace) {
+		return "", errors.New("Invalid namespace")
+	}
+	return namespace, nil
+}
+
+// changes the namespace the session works in, checking that its token can be used there
+func (auth *AuthInfo) SetNamespace(namespace string) error {
+	namespace, err := normalizeNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	previous := auth.Namespace
+	auth.Namespace = namespace
+	if _, err := auth.CapabilitiesSelf("sys/namespaces"); err != nil {
+		auth.Namespace = previous
+		return err
+	}
+	return nil
+}
+
+// lists the namespaces directly within the session's namespace
+func (auth AuthInfo) ListNamespaces() ([]string, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := listKeys(client.Logical(), "sys/namespaces")
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimSuffix(key, "/")
+	}
+	return keys, nil
+}
+
+// creates a namespace within the session's namespace
+func (auth AuthInfo) CreateNamespace(name string) error {
+	name, err := normalizeNamespace(name)
+	if err != nil {
+		return err
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return errors.New("Namespaces are created one level at a time, within the current one")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().Write("sys/namespaces/"+name, nil)
+	return err
+}
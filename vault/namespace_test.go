@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNamespaceTransport(t *testing.T) {
+	seen := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get("X-Vault-Namespace")
+	}))
+	defer server.Close()
+
+	Convey("Requests should carry the namespace without changing the original", t, func(c C) {
+		transport := &namespaceTransport{base: http.DefaultTransport, namespace: "team-a/dev"}
+		req, err := http.NewRequest("GET", server.URL, nil)
+		c.So(err, ShouldBeNil)
+		resp, err := transport.RoundTrip(req)
+		c.So(err, ShouldBeNil)
+		resp.Body.Close()
+		c.So(seen, ShouldEqual, "team-a/dev")
+		c.So(req.Header.Get("X-Vault-Namespace"), ShouldEqual, "")
+	})
+}
+
+func TestNormalizeNamespace(t *testing.T) {
+	Convey("Namespaces should be trimmed of slashes", t, func(c C) {
+		ns, err := normalizeNamespace(" /team-a/dev/ ")
+		c.So(err, ShouldBeNil)
+		c.So(ns, ShouldEqual, "team-a/dev")
+
+		ns, err = normalizeNamespace("")
+		c.So(err, ShouldBeNil)
+		c.So(ns, ShouldEqual, "")
+	})
+
+	Convey("Malformed namespaces should be rejected", t, func(c C) {
+		for _, ns := range []string{"team-a//dev", "../root", "team a", "team-a?x=1"} {
+			_, err := normalizeNamespace(ns)
+			c.So(err, ShouldNotBeNil)
+		}
+	})
+}
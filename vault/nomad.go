@@ -0,0 +1,39 @@
+package vault
+
+import (
+	"errors"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func init() {
+	RegisterSecretEngine("nomad", credentialEngine{
+		description: EngineDescription{
+			Type:        "nomad",
+			Name:        "Nomad",
+			Description: "Dynamic Nomad ACL tokens",
+		},
+		rolesPath: "role",
+		credsPath: "creds",
+	})
+}
+
+func (auth AuthInfo) ListNomadRoles(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "nomad") + "role")
+}
+
+// role details include the token type and policies of generated tokens
+func (auth AuthInfo) ReadNomadRole(mount, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "nomad") + "role/" + name)
+}
+
+// generates an ACL token for the role. The secret carries the lease
+func (auth AuthInfo) GenerateNomadCredentials(mount, role string) (*api.Secret, error) {
+	if role == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.readCreds(mountPrefix(mount, "nomad"), "creds/"+role)
+}
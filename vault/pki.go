@@ -0,0 +1,191 @@
+package vault
+
+import (
+	"errors"
+)
+
+func init() {
+	RegisterSecretEngine("pki", pkiEngine{})
+}
+
+func (auth AuthInfo) ListPKIRoles(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "pki") + "roles")
+}
+
+func (auth AuthInfo) ReadPKIRole(mount, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "pki") + "roles/" + name)
+}
+
+// issues a certificate with a private key generated by vault
+// if csr is not empty, the csr is signed instead, and no private key is returned
+func (auth AuthInfo) IssuePKICert(mount, role, csr string, params map[string]interface{}) (map[string]interface{}, error) {
+	if role == "" {
+		return nil, errors.New("Empty role name")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	path := mountPrefix(mount, "pki") + "issue/" + role
+	if csr != "" {
+		path = mountPrefix(mount, "pki") + "sign/" + role
+		params["csr"] = csr
+	}
+
+	resp, err := client.Logical().Write(path, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Invalid path")
+	}
+	return resp.Data, nil
+}
+
+// lists serial numbers of all certificates issued by the backend
+func (auth AuthInfo) ListPKICerts(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "pki") + "certs")
+}
+
+func (auth AuthInfo) ReadPKICert(mount, serial string) (map[string]interface{}, error) {
+	if serial == "" {
+		return nil, errors.New("Empty serial number")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "pki") + "cert/" + serial)
+}
+
+func (auth AuthInfo) RevokePKICert(mount, serial string) (map[string]interface{}, error) {
+	if serial == "" {
+		return nil, errors.New("Empty serial number")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Write(mountPrefix(mount, "pki")+"revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, nil
+	}
+	return resp.Data, nil
+}
+
+// pkiEngine exposes issuing and revocation as engine actions
+type pkiEngine struct{}
+
+func (e pkiEngine) Describe() EngineDescription {
+	return EngineDescription{
+		Type:        "pki",
+		Name:        "PKI",
+		Description: "X.509 certificates issued by a vault CA",
+	}
+}
+
+func (e pkiEngine) List(auth AuthInfo, mount, path string) ([]interface{}, error) {
+	if path == "" {
+		path = "roles/"
+	}
+	return auth.ListSecret(mount + path)
+}
+
+func (e pkiEngine) Read(auth AuthInfo, mount, path string) (map[string]interface{}, error) {
+	return auth.ReadSecret(mount + path)
+}
+
+func (e pkiEngine) Write(auth AuthInfo, mount, path string, data map[string]interface{}) (interface{}, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.Logical().Write(mount+path, data)
+}
+
+func (e pkiEngine) Actions() []EngineAction {
+	return []EngineAction{
+		{
+			Name:        "issue",
+			Description: "Issue a certificate for the role at path, or sign the given csr",
+			Run: func(auth AuthInfo, mount, path string, params map[string]interface{}) (interface{}, error) {
+				csr, _ := params["csr"].(string)
+				delete(params, "csr")
+				return auth.IssuePKICert(mount, lastSegment(path), csr, params)
+			},
+		},
+		{
+			Name:        "revoke",
+			Description: "Revoke the certificate with the serial number at path",
+			Run: func(auth AuthInfo, mount, path string, params map[string]interface{}) (interface{}, error) {
+				return auth.RevokePKICert(mount, lastSegment(path))
+			},
+		},
+	}
+}
+
+// returns the CA certificate and, where the backend has one, the chain above it
+func (auth AuthInfo) ReadPKICA(mount string) (map[string]interface{}, error) {
+	ca, err := auth.ReadSecret(mountPrefix(mount, "pki") + "cert/ca")
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{
+		"certificate": ca["certificate"],
+	}
+	// older backends have no chain endpoint, which is not an error
+	if chain, err := auth.ReadSecret(mountPrefix(mount, "pki") + "cert/ca_chain"); err == nil {
+		result["ca_chain"] = chain["certificate"]
+	}
+	return result, nil
+}
+
+func (auth AuthInfo) ReadPKICRL(mount string) (map[string]interface{}, error) {
+	return auth.ReadSecret(mountPrefix(mount, "pki") + "cert/crl")
+}
+
+// forces the CRL to be rebuilt
+func (auth AuthInfo) RotatePKICRL(mount string) (map[string]interface{}, error) {
+	return auth.ReadSecret(mountPrefix(mount, "pki") + "crl/rotate")
+}
+
+// removes expired certificates from storage and the revocation list
+func (auth AuthInfo) TidyPKI(mount string, params map[string]interface{}) error {
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().Write(mountPrefix(mount, "pki")+"tidy", params)
+	return err
+}
+
+func (auth AuthInfo) ReadPKIURLs(mount string) (map[string]interface{}, error) {
+	return auth.ReadSecret(mountPrefix(mount, "pki") + "config/urls")
+}
+
+// urls not in params keep their current values, as some vault versions clear what isn't sent
+func (auth AuthInfo) WritePKIURLs(mount string, params map[string]interface{}) error {
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	path := mountPrefix(mount, "pki") + "config/urls"
+	current, err := client.Logical().Read(path)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		for key, value := range current.Data {
+			if _, ok := params[key]; !ok {
+				params[key] = value
+			}
+		}
+	}
+	_, err = client.Logical().Write(path, params)
+	return err
+}
@@ -0,0 +1,132 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// a policy with placeholders, stored as a secret under PolicyTemplatePath
+// Policy and Rules are Go templates rendered with the variables, e.g. {{.team}}
+type PolicyTemplate struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Policy      string   `json:"policy"`
+	Rules       string   `json:"rules"`
+	Variables   []string `json:"variables"`
+}
+
+// variable values end up inside quoted HCL paths, so they are kept to a safe alphabet
+var templateVariable = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+func policyTemplatePath() (string, error) {
+	path := GetConfig().PolicyTemplatePath
+	if path == "" {
+		return "", errors.New("PolicyTemplatePath is not configured")
+	}
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return path, nil
+}
+
+// lists the names of the policy templates the session can read
+func (auth AuthInfo) ListPolicyTemplates() ([]string, error) {
+	path, err := policyTemplatePath()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := auth.ListSecret(path)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, key := range keys {
+		// templates are not nested
+		if name, ok := key.(string); ok && !strings.HasSuffix(name, "/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// reads a policy template with the session's token, so vault decides who may use it
+func (auth AuthInfo) GetPolicyTemplate(name string) (*PolicyTemplate, error) {
+	if name == "" || strings.ContainsAny(name, "/?#") {
+		return nil, errors.New("Invalid template name")
+	}
+	path, err := policyTemplatePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := auth.ReadSecret(path + name)
+	if err != nil {
+		return nil, err
+	}
+	return parsePolicyTemplate(name, data)
+}
+
+func parsePolicyTemplate(name string, data map[string]interface{}) (*PolicyTemplate, error) {
+	t := &PolicyTemplate{Name: name}
+	t.Description, _ = data["description"].(string)
+	t.Policy, _ = data["policy"].(string)
+	t.Rules, _ = data["rules"].(string)
+	if t.Policy == "" || t.Rules == "" {
+		return nil, errors.New("Policy template " + name + " must have a policy name and rules")
+	}
+	raw, _ := data["variables"].(string)
+	t.Variables = []string{}
+	for _, variable := range strings.Split(raw, ",") {
+		if variable = strings.TrimSpace(variable); variable != "" {
+			t.Variables = append(t.Variables, variable)
+		}
+	}
+	return t, nil
+}
+
+// fills in the template's placeholders, returning the policy name and its rules
+// every declared variable must be given, and nothing else
+func (t PolicyTemplate) Render(values map[string]string) (string, string, error) {
+	for _, variable := range t.Variables {
+		if _, ok := values[variable]; !ok {
+			return "", "", errors.New("Variable " + variable + " is required")
+		}
+	}
+	for variable, value := range values {
+		if !containsString(t.Variables, variable) {
+			return "", "", errors.New("Template " + t.Name + " has no variable " + variable)
+		}
+		if !templateVariable.MatchString(value) {
+			return "", "", errors.New("Variable " + variable + " may only contain letters, digits, - and _")
+		}
+	}
+
+	name, err := renderTemplate(t.Name+" policy", t.Policy, values)
+	if err != nil {
+		return "", "", err
+	}
+	rules, err := renderTemplate(t.Name+" rules", t.Rules, values)
+	if err != nil {
+		return "", "", err
+	}
+	if name = strings.TrimSpace(name); name == "" || strings.ContainsAny(name, "/ ") {
+		return "", "", errors.New("Template " + t.Name + " renders an invalid policy name")
+	}
+	return name, rules, nil
+}
+
+func renderTemplate(name, text string, values map[string]string) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errors.New("Template " + name + " is invalid: " + err.Error())
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, values); err != nil {
+		return "", errors.New("Template " + name + " could not be rendered: " + err.Error())
+	}
+	return b.String(), nil
+}
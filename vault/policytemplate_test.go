@@ -0,0 +1,53 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolicyTemplate(t *testing.T) {
+	tmpl, err := parsePolicyTemplate("team-secrets", map[string]interface{}{
+		"policy":    "{{.team}}-{{.env}}",
+		"rules":     "path \"secret/{{.team}}/{{.env}}/*\" {\n  capabilities = [\"read\", \"list\"]\n}\n",
+		"variables": "team, env",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Templates should be rendered with their variables", t, func(c C) {
+		c.So(tmpl.Variables, ShouldResemble, []string{"team", "env"})
+		name, rules, err := tmpl.Render(map[string]string{"team": "payments", "env": "prod"})
+		c.So(err, ShouldBeNil)
+		c.So(name, ShouldEqual, "payments-prod")
+		c.So(rules, ShouldStartWith, `path "secret/payments/prod/*" {`)
+	})
+
+	Convey("Missing, unknown and unsafe variables should be rejected", t, func(c C) {
+		_, _, err := tmpl.Render(map[string]string{"team": "payments"})
+		c.So(err, ShouldNotBeNil)
+		_, _, err = tmpl.Render(map[string]string{"team": "payments", "env": "prod", "region": "eu"})
+		c.So(err, ShouldNotBeNil)
+		_, _, err = tmpl.Render(map[string]string{"team": `x" {} path "*`, "env": "prod"})
+		c.So(err, ShouldNotBeNil)
+		_, _, err = tmpl.Render(map[string]string{"team": "..", "env": "prod"})
+		c.So(err, ShouldNotBeNil)
+	})
+
+	Convey("Templates without a policy name or rules should be rejected", t, func(c C) {
+		_, err := parsePolicyTemplate("empty", map[string]interface{}{"rules": "path \"x\" {}"})
+		c.So(err, ShouldNotBeNil)
+	})
+
+	Convey("Placeholders without a declared variable should fail to render", t, func(c C) {
+		undeclared, err := parsePolicyTemplate("undeclared", map[string]interface{}{
+			"policy":    "{{.team}}",
+			"rules":     "path \"secret/{{.team}}/{{.app}}\" {}",
+			"variables": "team",
+		})
+		c.So(err, ShouldBeNil)
+		_, _, err = undeclared.Render(map[string]string{"team": "payments"})
+		c.So(err, ShouldNotBeNil)
+	})
+}
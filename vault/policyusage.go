@@ -0,0 +1,172 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// how many live tokens, identity entities and identity groups reference a policy
+// LastAttached is when the newest of them was created or updated, empty if none
+// references from auth backend roles are not counted, as they are not live
+type PolicyUsage struct {
+	Policy       string `json:"policy"`
+	Tokens       int    `json:"tokens"`
+	Entities     int    `json:"entities"`
+	Groups       int    `json:"groups"`
+	LastAttached string `json:"last_attached"`
+}
+
+// something that can hold policies, looked up one at a time
+type usageSource struct {
+	kind string
+	id   string
+}
+
+type policyUsageCounter map[string]*PolicyUsage
+
+func (counter policyUsageCounter) get(policy string) *PolicyUsage {
+	usage, ok := counter[policy]
+	if !ok {
+		usage = &PolicyUsage{Policy: policy}
+		counter[policy] = usage
+	}
+	return usage
+}
+
+// counts one token, entity or group holding the policies, attached at the given time
+func (counter policyUsageCounter) add(kind string, policies interface{}, attached time.Time) {
+	list, _ := policies.([]interface{})
+	for _, raw := range list {
+		policy, ok := raw.(string)
+		if !ok {
+			continue
+		}
+		usage := counter.get(policy)
+		switch kind {
+		case "token":
+			usage.Tokens++
+		case "entity":
+			usage.Entities++
+		case "group":
+			usage.Groups++
+		}
+		if attached.IsZero() {
+			continue
+		}
+		if last, err := time.Parse(time.RFC3339, usage.LastAttached); err != nil || attached.After(last) {
+			usage.LastAttached = attached.UTC().Format(time.RFC3339)
+		}
+	}
+}
+
+func (counter policyUsageCounter) sorted() []PolicyUsage {
+	results := make([]PolicyUsage, 0, len(counter))
+	for _, usage := range counter {
+		results = append(results, *usage)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Policy < results[j].Policy
+	})
+	return results
+}
+
+func listKeys(logical *api.Logical, path string) ([]string, error) {
+	resp, err := logical.List(path)
+	if err != nil || resp == nil {
+		return []string{}, err
+	}
+	raw, _ := resp.Data["keys"].([]interface{})
+	keys := make([]string, 0, len(raw))
+	for _, key := range raw {
+		if s, ok := key.(string); ok {
+			keys = append(keys, s)
+		}
+	}
+	return keys, nil
+}
+
+// counts the references to every policy, starting at offset, until the budget runs out
+// if counting stopped early, the offset to continue from is returned, otherwise -1
+// counts of a continued listing only cover what it looked at, so they should be summed
+func (auth AuthInfo) GetPolicyUsageWithin(offset int, budget Budget) ([]PolicyUsage, int, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, -1, err
+	}
+	logical := client.Logical()
+
+	accessors, err := listKeys(logical, "auth/token/accessors")
+	if err != nil {
+		return nil, -1, err
+	}
+	sources := make([]usageSource, 0, len(accessors))
+	for _, accessor := range accessors {
+		sources = append(sources, usageSource{"token", accessor})
+	}
+	// identity only exists from vault 0.9, so failing to list it means there is nothing to count
+	if entities, err := listKeys(logical, "identity/entity/id"); err == nil {
+		for _, id := range entities {
+			sources = append(sources, usageSource{"entity", id})
+		}
+	}
+	if groups, err := listKeys(logical, "identity/group/id"); err == nil {
+		for _, id := range groups {
+			sources = append(sources, usageSource{"group", id})
+		}
+	}
+	if offset > len(sources) {
+		return nil, -1, errors.New("Offset out of bound")
+	}
+
+	counter := policyUsageCounter{}
+	// unused policies are the point of the listing, so they are included from the start
+	if offset == 0 {
+		policies, err := client.Sys().ListPolicies()
+		if err != nil {
+			return nil, -1, err
+		}
+		for _, policy := range policies {
+			counter.get(policy)
+		}
+	}
+
+	for i, source := range sources[offset:] {
+		if budget.Exceeded() {
+			return counter.sorted(), offset + i, nil
+		}
+		var resp *api.Secret
+		if source.kind == "token" {
+			resp, err = logical.Write("auth/token/lookup-accessor", map[string]interface{}{
+				"accessor": source.id,
+			})
+		} else {
+			resp, err = logical.Read("identity/" + source.kind + "/id/" + source.id)
+		}
+		// the token may have expired, or the entity been deleted, since listing
+		if err != nil || resp == nil {
+			continue
+		}
+		counter.add(source.kind, resp.Data["policies"], attachedAt(resp.Data))
+	}
+	return counter.sorted(), -1, nil
+}
+
+// when a token was created, or an entity or group last updated
+func attachedAt(data map[string]interface{}) time.Time {
+	if raw, ok := data["last_update_time"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			return t
+		}
+	}
+	if raw, ok := data["creation_time"]; ok {
+		if unix, err := strconv.ParseInt(fmt.Sprint(raw), 10, 64); err == nil {
+			return time.Unix(unix, 0)
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,42 @@
+package vault
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolicyUsageCounter(t *testing.T) {
+	Convey("References should be counted per policy and kind", t, func(c C) {
+		counter := policyUsageCounter{}
+		counter.get("unused")
+		counter.add("token", []interface{}{"default", "ops"}, time.Unix(1500000000, 0))
+		counter.add("token", []interface{}{"ops"}, time.Unix(1400000000, 0))
+		counter.add("entity", []interface{}{"ops"}, time.Time{})
+		counter.add("group", []interface{}{"ops"}, time.Unix(1600000000, 0))
+
+		usage := counter.sorted()
+		c.So(len(usage), ShouldEqual, 3)
+		c.So(usage[0], ShouldResemble, PolicyUsage{
+			Policy:       "default",
+			Tokens:       1,
+			LastAttached: "2017-07-14T02:40:00Z",
+		})
+		c.So(usage[1], ShouldResemble, PolicyUsage{
+			Policy:       "ops",
+			Tokens:       2,
+			Entities:     1,
+			Groups:       1,
+			LastAttached: "2020-09-13T12:26:40Z",
+		})
+		c.So(usage[2], ShouldResemble, PolicyUsage{Policy: "unused"})
+	})
+
+	Convey("Tokens and identities should be dated by their own fields", t, func(c C) {
+		c.So(attachedAt(map[string]interface{}{"creation_time": json.Number("1500000000")}).Unix(), ShouldEqual, 1500000000)
+		c.So(attachedAt(map[string]interface{}{"last_update_time": "2018-01-02T03:04:05.123456Z"}).Unix(), ShouldEqual, 1514862245)
+		c.So(attachedAt(map[string]interface{}{}).IsZero(), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// per-user ui settings, kept server-side so they follow the user across browsers
+type Preferences struct {
+	// section the ui opens after login, e.g. "/secrets"
+	LandingPage string `json:"landing_page"`
+	PageSize    int    `json:"page_size"`
+	// keyed by view, e.g. "secrets", "tokens" or "requests"
+	SavedFilters map[string][]SavedFilter `json:"saved_filters"`
+}
+
+type SavedFilter struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+const (
+	maxPreferencePageSize  = 500
+	maxSavedFilterViews    = 20
+	maxSavedFiltersPerView = 50
+	maxSavedFilterLength   = 1024
+	// all saved preferences together, as stored
+	maxPreferencesSize = 64 * 1024
+)
+
+func (p Preferences) Validate() error {
+	if p.LandingPage != "" && (!strings.HasPrefix(p.LandingPage, "/") || strings.HasPrefix(p.LandingPage, "//")) {
+		return errors.New("landing_page must be a path within goldfish, e.g. /secrets")
+	}
+	if p.PageSize < 0 || p.PageSize > maxPreferencePageSize {
+		return fmt.Errorf("page_size must be between 0 and %d", maxPreferencePageSize)
+	}
+	if len(p.SavedFilters) > maxSavedFilterViews {
+		return fmt.Errorf("filters can be saved for at most %d views", maxSavedFilterViews)
+	}
+	for view, filters := range p.SavedFilters {
+		if view == "" || len(view) > maxSavedFilterLength {
+			return fmt.Errorf("saved filters need a view name of at most %d characters", maxSavedFilterLength)
+		}
+		if len(filters) > maxSavedFiltersPerView {
+			return fmt.Errorf("at most %d filters can be saved for %s", maxSavedFiltersPerView, view)
+		}
+		for _, f := range filters {
+			if f.Name == "" {
+				return errors.New("saved filters need a name")
+			}
+			if len(f.Name)+len(f.Query) > maxSavedFilterLength {
+				return errors.New("saved filter " + f.Name + " is too long")
+			}
+		}
+	}
+	if raw, err := json.Marshal(p); err != nil || len(raw) > maxPreferencesSize {
+		return fmt.Errorf("preferences can be at most %d bytes", maxPreferencesSize)
+	}
+	return nil
+}
+
+// identifies the person behind a session across logins: their identity entity, or for tokens
+// that have none, such as root tokens, the token itself by its accessor. Display names are not
+// used, as the same name can log in through different auth mounts
+func (auth AuthInfo) PreferenceIdentity() (string, error) {
+	self, err := auth.LookupSelf()
+	if err != nil {
+		return "", err
+	}
+	return preferenceIdentityOf(self.Data)
+}
+
+// the identity of the token described by lookup-self data
+func preferenceIdentityOf(self map[string]interface{}) (string, error) {
+	identity := ""
+	if entity, ok := self["entity_id"].(string); ok && entity != "" {
+		identity = "entity:" + entity
+	} else if accessor, ok := self["accessor"].(string); ok && accessor != "" {
+		identity = "accessor:" + accessor
+	} else {
+		return "", errors.New("Could not identify session")
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(identity))), nil
+}
+
+// returns saved preferences, or empty ones if none were saved
+func GetPreferences(identity string) (Preferences, error) {
+	prefs := Preferences{}
+	resp, err := ReadFromCubbyhole("preferences/" + identity)
+	if err != nil || resp == nil {
+		return prefs, err
+	}
+	raw, ok := resp.Data["preferences"].(string)
+	if !ok {
+		return prefs, errors.New("Could not parse saved preferences")
+	}
+	err = json.Unmarshal([]byte(raw), &prefs)
+	return prefs, err
+}
+
+func SetPreferences(identity string, prefs Preferences) error {
+	if err := prefs.Validate(); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+	_, err = WriteToCubbyhole("preferences/"+identity, map[string]interface{}{
+		"preferences": string(raw),
+	})
+	return err
+}
+
+func DeletePreferences(identity string) error {
+	_, err := DeleteFromCubbyhole("preferences/" + identity)
+	return err
+}
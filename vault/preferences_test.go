@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPreferencesValidate(t *testing.T) {
+	Convey("Saved filters should be capped by count and size", t, func(c C) {
+		prefs := Preferences{
+			LandingPage:  "/secrets",
+			PageSize:     50,
+			SavedFilters: map[string][]SavedFilter{"secrets": {{Name: "mine", Query: "team/"}}},
+		}
+		c.So(prefs.Validate(), ShouldBeNil)
+
+		views := map[string][]SavedFilter{}
+		for i := 0; i <= maxSavedFilterViews; i++ {
+			views["view"+strconv.Itoa(i)] = []SavedFilter{{Name: "f"}}
+		}
+		c.So(Preferences{SavedFilters: views}.Validate(), ShouldNotBeNil)
+
+		filters := make([]SavedFilter, maxSavedFiltersPerView+1)
+		for i := range filters {
+			filters[i].Name = "f" + strconv.Itoa(i)
+		}
+		c.So(Preferences{SavedFilters: map[string][]SavedFilter{"secrets": filters}}.Validate(), ShouldNotBeNil)
+
+		long := strings.Repeat("a", maxSavedFilterLength)
+		c.So(Preferences{SavedFilters: map[string][]SavedFilter{long + "a": {{Name: "f"}}}}.Validate(), ShouldNotBeNil)
+		c.So(Preferences{SavedFilters: map[string][]SavedFilter{"secrets": {{Name: "f", Query: long}}}}.Validate(), ShouldNotBeNil)
+
+		// every filter within its own limits, but too much together
+		views = map[string][]SavedFilter{}
+		for i := 0; i < maxSavedFilterViews; i++ {
+			filters := make([]SavedFilter, maxSavedFiltersPerView)
+			for j := range filters {
+				filters[j] = SavedFilter{Name: "f" + strconv.Itoa(j), Query: strings.Repeat("q", 900)}
+			}
+			views["view"+strconv.Itoa(i)] = filters
+		}
+		c.So(Preferences{SavedFilters: views}.Validate(), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,39 @@
+package vault
+
+import (
+	"errors"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func init() {
+	RegisterSecretEngine("rabbitmq", credentialEngine{
+		description: EngineDescription{
+			Type:        "rabbitmq",
+			Name:        "RabbitMQ",
+			Description: "Dynamic RabbitMQ users",
+		},
+		rolesPath: "roles",
+		credsPath: "creds",
+	})
+}
+
+func (auth AuthInfo) ListRabbitMQRoles(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "rabbitmq") + "roles")
+}
+
+// role details include the tags and vhost permissions of generated users
+func (auth AuthInfo) ReadRabbitMQRole(mount, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "rabbitmq") + "roles/" + name)
+}
+
+// generates a user for the role. The secret carries the lease, for revocation
+func (auth AuthInfo) GenerateRabbitMQCredentials(mount, role string) (*api.Secret, error) {
+	if role == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.readCreds(mountPrefix(mount, "rabbitmq"), "creds/"+role)
+}
@@ -0,0 +1,120 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// a server of an integrated storage cluster, as raft's configuration lists it
+type RaftPeer struct {
+	NodeID  string `json:"node_id"`
+	Address string `json:"address"`
+	Leader  bool   `json:"leader"`
+	Voter   bool   `json:"voter"`
+}
+
+// the servers of the raft cluster the session works on
+func (auth AuthInfo) GetRaftPeers() ([]RaftPeer, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Read("sys/storage/raft/configuration")
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Vault is not using integrated storage")
+	}
+	return parseRaftPeers(resp.Data)
+}
+
+func parseRaftPeers(data map[string]interface{}) ([]RaftPeer, error) {
+	b, err := json.Marshal(data["config"])
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Servers []RaftPeer `json:"servers"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, errors.New("Could not read raft configuration: " + err.Error())
+	}
+	if config.Servers == nil {
+		return []RaftPeer{}, nil
+	}
+	return config.Servers, nil
+}
+
+// autopilot's view of the raft cluster: its health, leader, and each server's state
+func (auth AuthInfo) GetAutopilotState() (map[string]interface{}, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Read("sys/storage/raft/autopilot/state")
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Vault is not using integrated storage")
+	}
+	return resp.Data, nil
+}
+
+// a snapshot of the raft cluster's data, which the caller must close
+// snapshots can outgrow the api client's timeout and retries, so the request is made directly
+func (auth AuthInfo) RaftSnapshot() (io.ReadCloser, error) {
+	resp, err := auth.raftSnapshotRequest("GET", "sys/storage/raft/snapshot", nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// restores a snapshot, replacing all of the cluster's data. Forcing restores snapshots
+// of other clusters, whose keys may not match this one's
+func (auth AuthInfo) RestoreRaftSnapshot(snapshot io.Reader, size int64, force bool) error {
+	path := "sys/storage/raft/snapshot"
+	if force {
+		path = "sys/storage/raft/snapshot-force"
+	}
+	resp, err := auth.raftSnapshotRequest("POST", path, snapshot, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (auth AuthInfo) raftSnapshotRequest(method, path string, body io.Reader, size int64) (*http.Response, error) {
+	client, transport, err := auth.clientTransport()
+	if err != nil {
+		return nil, err
+	}
+	r := client.NewRequest(method, "/v1/"+path)
+	r.Body = body
+	r.BodySize = size
+	req, err := r.ToHTTP()
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 {
+		req.ContentLength = size
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	result := &api.Response{Response: resp}
+	if err := result.Error(); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,36 @@
+package vault
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseRaftPeers(t *testing.T) {
+	Convey("Raft servers should be read from the configuration", t, func(c C) {
+		var data map[string]interface{}
+		c.So(json.Unmarshal([]byte(`{
+			"config": {
+				"index": 42,
+				"servers": [
+					{"node_id": "vault-0", "address": "10.0.0.1:8201", "leader": true, "voter": true},
+					{"node_id": "vault-1", "address": "10.0.0.2:8201", "leader": false, "voter": false}
+				]
+			}
+		}`), &data), ShouldBeNil)
+
+		peers, err := parseRaftPeers(data)
+		c.So(err, ShouldBeNil)
+		c.So(peers, ShouldResemble, []RaftPeer{
+			{NodeID: "vault-0", Address: "10.0.0.1:8201", Leader: true, Voter: true},
+			{NodeID: "vault-1", Address: "10.0.0.2:8201"},
+		})
+	})
+
+	Convey("A configuration without servers should list none", t, func(c C) {
+		peers, err := parseRaftPeers(map[string]interface{}{})
+		c.So(err, ShouldBeNil)
+		c.So(peers, ShouldBeEmpty)
+	})
+}
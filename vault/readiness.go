@@ -0,0 +1,70 @@
+package vault
+
+import "errors"
+
+// whether goldfish can serve requests, with the outcome of each check: "ok", or why it failed
+type Readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// checks that vault is reachable and unsealed, that goldfish's server token is still valid,
+// and that the runtime config has been loaded
+func CheckReadiness() Readiness {
+	return readiness(map[string]error{
+		"vault":  checkVaultUnsealed(),
+		"token":  checkServerToken(),
+		"config": checkRuntimeConfig(),
+	})
+}
+
+func readiness(results map[string]error) Readiness {
+	r := Readiness{Ready: true, Checks: map[string]string{}}
+	for name, err := range results {
+		if err != nil {
+			r.Ready = false
+			r.Checks[name] = err.Error()
+		} else {
+			r.Checks[name] = "ok"
+		}
+	}
+	return r
+}
+
+func checkVaultUnsealed() error {
+	client, err := NewVaultClient()
+	if err != nil {
+		return err
+	}
+	status, err := client.Sys().SealStatus()
+	if err != nil {
+		return err
+	}
+	if status.Sealed {
+		return errors.New("Vault is sealed")
+	}
+	return nil
+}
+
+func checkServerToken() error {
+	if ServerToken() == "" {
+		return errors.New("Goldfish has not logged in to vault")
+	}
+	client, err := NewVaultClient()
+	if err != nil {
+		return err
+	}
+	client.SetToken(ServerToken())
+	_, err = client.Auth().Token().LookupSelf()
+	return err
+}
+
+// the config hash is only set once a config has been loaded
+func checkRuntimeConfig() error {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	if configHash == 0 {
+		return errors.New("Runtime config has not been loaded")
+	}
+	return nil
+}
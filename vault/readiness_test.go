@@ -0,0 +1,23 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReadiness(t *testing.T) {
+	Convey("Goldfish should be ready when every check passes", t, func(c C) {
+		r := readiness(map[string]error{"vault": nil, "token": nil, "config": nil})
+		c.So(r.Ready, ShouldBeTrue)
+		c.So(r.Checks, ShouldResemble, map[string]string{"vault": "ok", "token": "ok", "config": "ok"})
+	})
+
+	Convey("A failed check should make goldfish unready, saying why", t, func(c C) {
+		r := readiness(map[string]error{"vault": errors.New("Vault is sealed"), "token": nil})
+		c.So(r.Ready, ShouldBeFalse)
+		c.So(r.Checks["vault"], ShouldEqual, "Vault is sealed")
+		c.So(r.Checks["token"], ShouldEqual, "ok")
+	})
+}
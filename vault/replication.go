@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// the replication state of one kind of replication, performance or dr, on this cluster
+// Mode is disabled, primary or secondary. Known secondaries are only listed on a primary
+type ReplicationStatus struct {
+	Mode             string   `json:"mode"`
+	State            string   `json:"state"`
+	ClusterID        string   `json:"cluster_id"`
+	LastWAL          uint64   `json:"last_wal"`
+	KnownSecondaries []string `json:"known_secondaries"`
+	PrimaryAddress   string   `json:"primary_cluster_addr"`
+}
+
+// a secondary activation token, wrapped by vault. It activates the secondary named ID
+type SecondaryToken struct {
+	ID    string `json:"id"`
+	Token string `json:"token"`
+	TTL   int    `json:"ttl"`
+}
+
+var secondaryID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+func validReplicationKind(kind string) error {
+	if kind != "performance" && kind != "dr" {
+		return errors.New("Replication kind must be performance or dr")
+	}
+	return nil
+}
+
+// the status of performance and dr replication, keyed by kind
+func (auth AuthInfo) GetReplicationStatus() (map[string]*ReplicationStatus, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Read("sys/replication/status")
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Replication is only available in vault enterprise")
+	}
+	return parseReplicationStatus(resp.Data)
+}
+
+func parseReplicationStatus(data map[string]interface{}) (map[string]*ReplicationStatus, error) {
+	results := map[string]*ReplicationStatus{}
+	for _, kind := range []string{"performance", "dr"} {
+		raw, ok := data[kind]
+		if !ok {
+			continue
+		}
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		status := &ReplicationStatus{}
+		if err := json.Unmarshal(b, status); err != nil {
+			return nil, errors.New("Could not read " + kind + " replication status: " + err.Error())
+		}
+		if status.KnownSecondaries == nil {
+			status.KnownSecondaries = []string{}
+		}
+		results[kind] = status
+	}
+	return results, nil
+}
+
+// true if the session holds one of the ReplicationOperatorPolicies, or is root
+func (auth AuthInfo) IsReplicationOperator() (bool, error) {
+	self, err := auth.LookupSelf()
+	if err != nil {
+		return false, err
+	}
+	operators := map[string]bool{"root": true}
+	for _, p := range strings.Split(GetConfig().ReplicationOperatorPolicies, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			operators[p] = true
+		}
+	}
+	list, _ := self.Data["policies"].([]interface{})
+	for _, p := range list {
+		if name, ok := p.(string); ok && operators[name] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// has the primary generate an activation token for a new secondary, wrapped for ttl
+func (auth AuthInfo) GenerateSecondaryToken(kind, id string, ttl time.Duration) (*SecondaryToken, error) {
+	if err := validReplicationKind(kind); err != nil {
+		return nil, err
+	}
+	if !secondaryID.MatchString(id) {
+		return nil, errors.New("Secondary id may only contain letters, digits, '.', '-' and '_'")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("TTL must be a positive duration")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	// asking for the wrapping also tells control groups apart from this response
+	client.SetWrappingLookupFunc(func(operation, path string) string {
+		return ttl.String()
+	})
+	resp, err := client.Logical().Write("sys/replication/"+kind+"/primary/secondary-token", map[string]interface{}{
+		"id":  id,
+		"ttl": ttl.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secondaryTokenFrom(id, resp)
+}
+
+func secondaryTokenFrom(id string, resp *api.Secret) (*SecondaryToken, error) {
+	if resp == nil || resp.WrapInfo == nil || resp.WrapInfo.Token == "" {
+		return nil, errors.New("Vault did not return an activation token")
+	}
+	return &SecondaryToken{
+		ID:    id,
+		Token: resp.WrapInfo.Token,
+		TTL:   resp.WrapInfo.TTL,
+	}, nil
+}
@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseReplicationStatus(t *testing.T) {
+	Convey("Both kinds of replication should be read from the status", t, func(c C) {
+		var data map[string]interface{}
+		c.So(json.Unmarshal([]byte(`{
+			"dr": {"mode": "disabled"},
+			"performance": {
+				"mode": "primary",
+				"state": "running",
+				"cluster_id": "d4095d41",
+				"last_wal": 241,
+				"known_secondaries": ["eu-west"]
+			}
+		}`), &data), ShouldBeNil)
+
+		status, err := parseReplicationStatus(data)
+		c.So(err, ShouldBeNil)
+		c.So(status["dr"].Mode, ShouldEqual, "disabled")
+		c.So(status["dr"].KnownSecondaries, ShouldResemble, []string{})
+		c.So(status["performance"].LastWAL, ShouldEqual, 241)
+		c.So(status["performance"].KnownSecondaries, ShouldResemble, []string{"eu-west"})
+	})
+}
+
+func TestSecondaryTokenFrom(t *testing.T) {
+	Convey("Activation tokens should be taken from the wrap info", t, func(c C) {
+		token, err := secondaryTokenFrom("eu-west", &api.Secret{
+			WrapInfo: &api.SecretWrapInfo{Token: "wrapped", TTL: 1800},
+		})
+		c.So(err, ShouldBeNil)
+		c.So(*token, ShouldResemble, SecondaryToken{ID: "eu-west", Token: "wrapped", TTL: 1800})
+	})
+
+	Convey("Unwrapped responses should be rejected", t, func(c C) {
+		_, err := secondaryTokenFrom("eu-west", &api.Secret{})
+		c.So(err, ShouldNotBeNil)
+	})
+}
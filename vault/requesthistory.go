@@ -0,0 +1,176 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caiyeon/goldfish/metrics"
+	"github.com/hashicorp/go-uuid"
+)
+
+// longest comment, in characters, that may be left on a request
+const maxRequestCommentLength = 4096
+
+// what happened to a policy request
+const (
+	RequestCreated  = "created"
+	RequestApproved = "approved"
+	RequestRejected = "rejected"
+	RequestApplied  = "applied"
+	// approved, and waiting for its apply window to open
+	RequestScheduled = "scheduled"
+	// approved, but could not be applied in its window
+	RequestFailed = "failed"
+	// nobody acted on it within PolicyRequestTTL
+	RequestExpired = "expired"
+)
+
+// an entry in a policy request's status history
+type RequestEvent struct {
+	Event  string `json:"event"`
+	Actor  string `json:"actor"`
+	Detail string `json:"detail,omitempty"`
+	Time   string `json:"time"`
+}
+
+// a comment on a policy request. Replies name the comment they answer as their parent
+type RequestComment struct {
+	ID         string `json:"id"`
+	Parent     string `json:"parent,omitempty"`
+	Author     string `json:"author"`
+	AuthorHash string `json:"author_hash"`
+	Body       string `json:"body"`
+	Created    string `json:"created"`
+}
+
+// the discussion and decisions on a policy request. It outlives the request,
+// so that decisions can be reconstructed after the change was applied or rejected
+type RequestHistory struct {
+	Policy string `json:"policy"`
+	// where the requester is emailed once the request is applied, see SetRequestContact
+	Contact  string           `json:"contact,omitempty"`
+	Events   []RequestEvent   `json:"events"`
+	Comments []RequestComment `json:"comments"`
+}
+
+// history is read, appended to and written back, so two updates must not interleave
+var requestHistoryLock = sync.Mutex{}
+
+// returns the history of a change ID, or nil if it has none
+func GetRequestHistory(changeID string) (*RequestHistory, error) {
+	if changeID == "" || strings.Contains(changeID, "/") {
+		return nil, errors.New("Invalid change ID")
+	}
+	resp, err := ReadFromCubbyhole("request_history/" + changeID)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, nil
+	}
+	raw, _ := resp.Data["history"].(string)
+	history := &RequestHistory{}
+	if err := json.Unmarshal([]byte(raw), history); err != nil {
+		return nil, errors.New("Request history appears to be malformed")
+	}
+	return history, nil
+}
+
+// appends an event to the history of a policy request, and notifies webhooks, chat channels and email of it
+func RecordRequestEvent(changeID, policy, event, actor, detail string) error {
+	err := updateRequestHistory(changeID, policy, func(history *RequestHistory) error {
+		history.Events = append(history.Events, RequestEvent{
+			Event:  event,
+			Actor:  actor,
+			Detail: detail,
+			Time:   time.Now().UTC().Format(time.RFC3339),
+		})
+		return nil
+	})
+	if err == nil {
+		metrics.PolicyRequests.Inc(event)
+		notifyWebhooks(changeID, policy, event, actor, detail)
+		notifyChatChannels(ChatMessage{
+			Event:    event,
+			ChangeID: changeID,
+			Policy:   policy,
+			Actor:    actor,
+			Detail:   detail,
+		})
+		notifyEmail(changeID, policy, event)
+	}
+	return err
+}
+
+// adds a comment to a policy request, as a reply if parent is the ID of another comment
+func AddRequestComment(changeID, policy, parent, author, authorHash, body string) (*RequestComment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, errors.New("Comment must not be empty")
+	}
+	if len([]rune(body)) > maxRequestCommentLength {
+		return nil, errors.New("Comment is too long")
+	}
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	comment := RequestComment{
+		ID:         id,
+		Parent:     parent,
+		Author:     author,
+		AuthorHash: authorHash,
+		Body:       body,
+		Created:    time.Now().UTC().Format(time.RFC3339),
+	}
+
+	err = updateRequestHistory(changeID, policy, func(history *RequestHistory) error {
+		if parent != "" {
+			found := false
+			for _, existing := range history.Comments {
+				found = found || existing.ID == parent
+			}
+			if !found {
+				return errors.New("Parent comment not found")
+			}
+		}
+		history.Comments = append(history.Comments, comment)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+func updateRequestHistory(changeID, policy string, update func(*RequestHistory) error) error {
+	requestHistoryLock.Lock()
+	defer requestHistoryLock.Unlock()
+
+	history, err := GetRequestHistory(changeID)
+	if err != nil {
+		return err
+	}
+	if history == nil {
+		history = &RequestHistory{
+			Events:   []RequestEvent{},
+			Comments: []RequestComment{},
+		}
+	}
+	history.Policy = policy
+	if err := update(history); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	_, err = WriteToCubbyhole("request_history/"+changeID, map[string]interface{}{
+		"history": string(raw),
+	})
+	return err
+}
@@ -0,0 +1,185 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// goldfish roles, in increasing order of what they allow. Each role may do everything
+// the roles before it may: viewers read, operators also change, and admins also reach
+// the routes that manage vault itself
+var goldfishRoles = []string{"viewer", "operator", "admin"}
+
+// the sessions a goldfish role is given to: those holding any of the policies,
+// or members of any of the identity groups
+type RoleMapping struct {
+	Groups   []string `json:"groups"`
+	Policies []string `json:"policies"`
+}
+
+// routes, matched with everything under them, that only admins may reach
+var adminRoutes = []string{
+	"/api/mounts",
+	"/api/auth",
+	"/api/audit",
+	"/api/sys",
+	"/api/replication",
+	"/api/raft",
+	"/api/namespaces",
+	"/api/sentinel",
+	"/api/settings",
+	"/api/maintenance",
+}
+
+// endpoints outside the admin routes that only admins may use, as they change vault for all of
+// its users: deleting policies, revoking tokens, writing approle roles, revoking leases by prefix
+// and rotating the CRL. Creating tokens stays with operators, who can only give tokens the
+// policies their own token has
+var adminEndpoints = []string{
+	"DELETE /api/policy",
+	"POST /api/users/revoke",
+	"POST /api/users/role",
+	"POST /api/leases/revoke-prefix",
+	"POST /api/pki/crl/rotate",
+}
+
+// routes every session may reach, whatever its role, to log in and out and find its way around
+var roleExemptRoutes = []string{
+	"GET /api/login/csrf",
+	"POST /api/login",
+	"POST /api/login/renew-self",
+	"POST /api/login/namespace",
+	"POST /api/logout",
+	"GET /api/health",
+	"GET /api/compat",
+	"GET /api/toggles",
+	"GET /api/role",
+	"GET /api/preferences",
+	"POST /api/preferences",
+	"DELETE /api/preferences",
+}
+
+func parseGoldfishRoles(raw string) (map[string]*RoleMapping, error) {
+	roles := map[string]*RoleMapping{}
+	if raw == "" {
+		return roles, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &roles); err != nil {
+		return nil, errors.New("GoldfishRoles must be a JSON object of goldfish roles to policies and groups")
+	}
+	for name, r := range roles {
+		if !containsString(goldfishRoles, name) {
+			return nil, errors.New("GoldfishRoles may only map " + strings.Join(goldfishRoles, ", "))
+		}
+		if r == nil || (len(r.Groups) == 0 && len(r.Policies) == 0) {
+			return nil, errors.New("GoldfishRoles: " + name + " must list the groups or policies it is given to")
+		}
+	}
+	return roles, nil
+}
+
+// true if goldfish roles are configured, and enforced
+func RolesEnabled() bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return len(roleMappings) > 0
+}
+
+func roleRank(role string) int {
+	for i, r := range goldfishRoles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// true if a session with the role may reach routes that need the required role
+func RoleAllows(role, required string) bool {
+	return roleRank(role) >= roleRank(required)
+}
+
+// true if the request to the route or path is to one of the admin endpoints, or one of the
+// admin routes or beneath one
+func AdminRoute(method, path string) bool {
+	if containsString(adminEndpoints, method+" "+path) {
+		return true
+	}
+	for _, prefix := range adminRoutes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// the least role needed for a request to the given route, empty if any session may make it
+func RequiredRole(method, route string) string {
+	if !strings.HasPrefix(route, "/api/") || containsString(roleExemptRoutes, method+" "+route) {
+		return ""
+	}
+	if AdminRoute(method, route) {
+		return "admin"
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return "viewer"
+	}
+	// what stays available in read-only mode doesn't change anything
+	if containsString(readOnlyExempt, method+" "+route) {
+		return "viewer"
+	}
+	return "operator"
+}
+
+// the goldfish role of the session, empty if it has none
+func (auth AuthInfo) GoldfishRole() (string, error) {
+	self, err := auth.LookupSelf()
+	if err != nil {
+		return "", err
+	}
+	return roleOf(self.Data)
+}
+
+// the highest role the token described by lookup-self data is given. Root is always an admin
+func roleOf(self map[string]interface{}) (string, error) {
+	configLock.RLock()
+	roles := roleMappings
+	configLock.RUnlock()
+
+	policies := policiesOf(self)
+	if policies["root"] {
+		return "admin", nil
+	}
+
+	var groups map[string]bool
+	role := ""
+	for name, r := range roles {
+		if roleRank(name) <= roleRank(role) {
+			continue
+		}
+		member := false
+		for _, p := range r.Policies {
+			member = member || policies[p]
+		}
+		if !member && len(r.Groups) > 0 {
+			if groups == nil {
+				entityID, _ := self["entity_id"].(string)
+				var err error
+				if groups, err = entityGroups(entityID); err != nil {
+					return "", err
+				}
+			}
+			for _, g := range r.Groups {
+				member = member || groups[g]
+			}
+		}
+		if member {
+			role = name
+		}
+	}
+	return role, nil
+}
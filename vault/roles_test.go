@@ -0,0 +1,70 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGoldfishRoles(t *testing.T) {
+	Convey("Goldfish roles", t, func(c C) {
+		c.Convey("Should only map known roles to policies or groups", func(c C) {
+			roles, err := parseGoldfishRoles(`{"admin": {"policies": ["goldfish-admin"]}, "viewer": {"groups": ["everyone"]}}`)
+			c.So(err, ShouldBeNil)
+			c.So(roles, ShouldContainKey, "admin")
+			_, err = parseGoldfishRoles(`{"superuser": {"policies": ["a"]}}`)
+			c.So(err, ShouldNotBeNil)
+			_, err = parseGoldfishRoles(`{"admin": {}}`)
+			c.So(err, ShouldNotBeNil)
+			_, err = parseGoldfishRoles(`not json`)
+			c.So(err, ShouldNotBeNil)
+		})
+
+		c.Convey("Should require a role by route", func(c C) {
+			c.So(RequiredRole("GET", "/api/mounts"), ShouldEqual, "admin")
+			c.So(RequiredRole("POST", "/api/sys/rotate"), ShouldEqual, "admin")
+			c.So(RequiredRole("GET", "/api/authentication"), ShouldEqual, "viewer")
+			c.So(RequiredRole("GET", "/api/secrets"), ShouldEqual, "viewer")
+			c.So(RequiredRole("POST", "/api/policy/validate"), ShouldEqual, "viewer")
+			c.So(RequiredRole("POST", "/api/secrets"), ShouldEqual, "operator")
+			c.So(RequiredRole("GET", "/api/policy"), ShouldEqual, "viewer")
+			c.So(RequiredRole("DELETE", "/api/policy"), ShouldEqual, "admin")
+			c.So(RequiredRole("POST", "/api/leases/revoke-prefix"), ShouldEqual, "admin")
+			c.So(RequiredRole("POST", "/api/users/create"), ShouldEqual, "operator")
+			c.So(RequiredRole("POST", "/api/login"), ShouldEqual, "")
+			c.So(RequiredRole("GET", "/metrics"), ShouldEqual, "")
+		})
+
+		c.Convey("Should rank roles", func(c C) {
+			c.So(RoleAllows("admin", "operator"), ShouldBeTrue)
+			c.So(RoleAllows("operator", "operator"), ShouldBeTrue)
+			c.So(RoleAllows("viewer", "operator"), ShouldBeFalse)
+			c.So(RoleAllows("", "viewer"), ShouldBeFalse)
+		})
+
+		c.Convey("Should give a session its highest role", func(c C) {
+			configLock.Lock()
+			roleMappings = map[string]*RoleMapping{
+				"viewer":   {Policies: []string{"default"}},
+				"operator": {Policies: []string{"ops"}},
+				"admin":    {Policies: []string{"goldfish-admin"}},
+			}
+			configLock.Unlock()
+			defer func() {
+				configLock.Lock()
+				roleMappings = map[string]*RoleMapping{}
+				configLock.Unlock()
+			}()
+
+			role, err := roleOf(map[string]interface{}{"policies": []interface{}{"default", "ops"}})
+			c.So(err, ShouldBeNil)
+			c.So(role, ShouldEqual, "operator")
+			role, _ = roleOf(map[string]interface{}{"policies": []interface{}{"default"}, "identity_policies": []interface{}{"goldfish-admin"}})
+			c.So(role, ShouldEqual, "admin")
+			role, _ = roleOf(map[string]interface{}{"policies": []interface{}{"root"}})
+			c.So(role, ShouldEqual, "admin")
+			role, _ = roleOf(map[string]interface{}{"policies": []interface{}{"other"}})
+			c.So(role, ShouldEqual, "")
+		})
+	})
+}
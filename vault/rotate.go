@@ -0,0 +1,27 @@
+package vault
+
+import (
+	"github.com/hashicorp/vault/api"
+)
+
+// the term of the barrier's current encryption key, and when it was installed
+func (auth AuthInfo) KeyStatus() (*api.KeyStatus, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.Sys().KeyStatus()
+}
+
+// installs a new barrier encryption key. Data is encrypted with it from then on,
+// while older keys are kept to decrypt what was written before
+func (auth AuthInfo) RotateKey() (*api.KeyStatus, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Sys().Rotate(); err != nil {
+		return nil, err
+	}
+	return client.Sys().KeyStatus()
+}
@@ -0,0 +1,179 @@
+package vault
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// how often approved requests are checked for an open apply window
+const scheduledRequestsInterval = time.Minute
+
+// where a request stands relative to its apply window
+const (
+	ApplyWindowPending = "pending"
+	ApplyWindowOpen    = "open"
+	ApplyWindowClosed  = "closed"
+)
+
+// checks the optional apply window of a new request. Either end may be empty
+func ValidateApplyWindow(after, before string, now time.Time) error {
+	var start, end time.Time
+	var err error
+	if after != "" {
+		if start, err = time.Parse(time.RFC3339, after); err != nil {
+			return errors.New("apply_after must be an RFC3339 timestamp")
+		}
+	}
+	if before != "" {
+		if end, err = time.Parse(time.RFC3339, before); err != nil {
+			return errors.New("apply_before must be an RFC3339 timestamp")
+		}
+		if !end.After(now) {
+			return errors.New("apply_before must be in the future")
+		}
+		if after != "" && !end.After(start) {
+			return errors.New("apply_before must be later than apply_after")
+		}
+	}
+	return nil
+}
+
+// whether a request with this window may be applied at the given time
+// windows are validated when the request is made, so unparseable ends are ignored
+func ApplyWindowState(after, before string, now time.Time) string {
+	if start, err := time.Parse(time.RFC3339, after); err == nil && now.Before(start) {
+		return ApplyWindowPending
+	}
+	if end, err := time.Parse(time.RFC3339, before); err == nil && !now.Before(end) {
+		return ApplyWindowClosed
+	}
+	return ApplyWindowOpen
+}
+
+// marks an approved policy request to be applied once its window opens
+func SchedulePolicyRequest(changeID string) error {
+	_, err := WriteToCubbyhole("scheduled_requests/"+changeID, map[string]interface{}{
+		"approved": time.Now().UTC().Format(time.RFC3339),
+	})
+	return err
+}
+
+func UnschedulePolicyRequest(changeID string) error {
+	_, err := DeleteFromCubbyhole("scheduled_requests/" + changeID)
+	return err
+}
+
+// the parts of a policy request the scheduler needs
+type scheduledRequest struct {
+	Policy      string
+	Current     string
+	New         string
+	Requester   string
+	ApplyAfter  string
+	ApplyBefore string
+	Bundle      string
+	Cluster     string
+	Namespace   string
+}
+
+// every policy the request changes, the first one included
+func (request scheduledRequest) changes() ([]PolicyChange, error) {
+	bundle, err := DecodePolicyBundle(request.Bundle)
+	if err != nil {
+		return nil, err
+	}
+	first := PolicyChange{Policy: request.Policy, Current: request.Current, New: request.New}
+	return append([]PolicyChange{first}, bundle...), nil
+}
+
+// applies every scheduled request whose window is open, and drops those whose window has passed
+// nothing is applied or dropped while goldfish is read-only, so requests wait until writes are back
+func applyScheduledRequests(now time.Time) error {
+	if ReadOnly() {
+		return nil
+	}
+	ids, err := listCubbyhole("scheduled_requests/")
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		resp, err := ReadFromCubbyhole("requests/" + id)
+		if err != nil {
+			return err
+		}
+		if resp == nil {
+			// the request was rejected after it was approved
+			UnschedulePolicyRequest(id)
+			continue
+		}
+		var request scheduledRequest
+		if err := mapstructure.Decode(resp.Data, &request); err != nil || request.Policy == "" {
+			continue
+		}
+
+		switch ApplyWindowState(request.ApplyAfter, request.ApplyBefore, now) {
+		case ApplyWindowPending:
+			continue
+		case ApplyWindowClosed:
+			finishScheduledRequest(id, request, RequestFailed, "apply window passed before it could be applied")
+			continue
+		}
+
+		changes, err := request.changes()
+		if err != nil {
+			finishScheduledRequest(id, request, RequestFailed, err.Error())
+			continue
+		}
+		client, err := serverClient(request.Cluster, request.Namespace)
+		if err != nil {
+			finishScheduledRequest(id, request, RequestFailed, err.Error())
+			continue
+		}
+		changed := ""
+		for _, change := range changes {
+			current, err := client.Sys().GetPolicy(change.Policy)
+			if err != nil {
+				return err
+			}
+			if strings.TrimSpace(current) != strings.TrimSpace(change.Current) {
+				changed = change.Policy
+				break
+			}
+		}
+		if changed != "" {
+			finishScheduledRequest(id, request, RequestFailed, "policy "+changed+" was changed since the request was made")
+			continue
+		}
+		if err := ApplyApprovedPolicyChanges(request.Cluster, request.Namespace, changes); err != nil {
+			// left scheduled, and retried while the window is open
+			errorChannel <- errors.New("Could not apply scheduled policy request " + id + ": " + err.Error())
+			continue
+		}
+		finishScheduledRequest(id, request, RequestApplied, "at its scheduled time")
+	}
+	return nil
+}
+
+// records the outcome of a scheduled request and removes it
+func finishScheduledRequest(id string, request scheduledRequest, event, detail string) {
+	log.Println("[AUDIT]:", "scheduled policy request", id, "for", request.Policy, event+":", detail)
+	if err := RecordRequestEvent(id, request.Policy, event, "goldfish", detail); err != nil {
+		errorChannel <- err
+	}
+	DeleteFromCubbyhole("unseal_wrapping_tokens/" + id)
+	DeleteAttachments(id)
+	DeletePolicyApprovals(id)
+	DeleteFromCubbyhole("requests/" + id)
+	UnschedulePolicyRequest(id)
+}
+
+func applyScheduledRequestsEvery(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		errorChannel <- applyScheduledRequests(time.Now())
+	}
+}
@@ -0,0 +1,72 @@
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestApplyWindow(t *testing.T) {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	hour := func(h int) string {
+		return now.Add(time.Duration(h) * time.Hour).Format(time.RFC3339)
+	}
+
+	Convey("Apply windows should be validated", t, func(c C) {
+		c.So(ValidateApplyWindow("", "", now), ShouldBeNil)
+		c.So(ValidateApplyWindow(hour(1), hour(2), now), ShouldBeNil)
+		c.So(ValidateApplyWindow(hour(-1), "", now), ShouldBeNil)
+		c.So(ValidateApplyWindow("tomorrow", "", now), ShouldNotBeNil)
+		c.So(ValidateApplyWindow("", hour(-1), now), ShouldNotBeNil)
+		c.So(ValidateApplyWindow(hour(2), hour(1), now), ShouldNotBeNil)
+	})
+
+	Convey("A request's window should open and close", t, func(c C) {
+		c.So(ApplyWindowState("", "", now), ShouldEqual, ApplyWindowOpen)
+		c.So(ApplyWindowState(hour(1), hour(2), now), ShouldEqual, ApplyWindowPending)
+		c.So(ApplyWindowState(hour(1), hour(2), now.Add(time.Hour)), ShouldEqual, ApplyWindowOpen)
+		c.So(ApplyWindowState(hour(1), hour(2), now.Add(2*time.Hour)), ShouldEqual, ApplyWindowClosed)
+		c.So(ApplyWindowState("", hour(-1), now), ShouldEqual, ApplyWindowClosed)
+	})
+}
+
+func TestApplyScheduledRequestsReadOnly(t *testing.T) {
+	Convey("The scheduler should not touch vault while goldfish is read-only", t, func(c C) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		address := VaultAddress
+		VaultAddress = server.URL
+		defer func() { VaultAddress = address }()
+		configLock.Lock()
+		previous := config
+		config.DisabledFeatures = ReadOnlyToggle
+		configLock.Unlock()
+		defer func() {
+			configLock.Lock()
+			config = previous
+			configLock.Unlock()
+		}()
+		client, err := newVaultClient("", nil, nil)
+		c.So(err, ShouldBeNil)
+		previousClient, previousToken := serverVaultClient(), ServerToken()
+		setServerToken(client, "server-token")
+		defer setServerToken(previousClient, previousToken)
+
+		c.So(applyScheduledRequests(time.Now()), ShouldBeNil)
+		c.So(requests, ShouldEqual, 0)
+
+		configLock.Lock()
+		config.DisabledFeatures = ""
+		configLock.Unlock()
+		applyScheduledRequests(time.Now())
+		c.So(requests, ShouldBeGreaterThan, 0)
+	})
+}
@@ -0,0 +1,38 @@
+package vault
+
+import (
+	"errors"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// seal status and unsealing need no token, as no token works while vault is sealed
+
+func SealStatus() (*api.SealStatusResponse, error) {
+	client, err := NewVaultClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Sys().SealStatus()
+}
+
+// submits one unseal key share. Vault unseals once the threshold of shares is reached
+func Unseal(key string) (*api.SealStatusResponse, error) {
+	if key == "" {
+		return nil, errors.New("Unseal key is required")
+	}
+	client, err := NewVaultClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Sys().Unseal(key)
+}
+
+// discards the shares submitted so far
+func ResetUnseal() (*api.SealStatusResponse, error) {
+	client, err := NewVaultClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Sys().ResetUnsealProcess()
+}
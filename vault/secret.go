@@ -3,6 +3,13 @@ package vault
 import (
 	"encoding/json"
 	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
 )
 
 func (auth AuthInfo) ListSecret(path string) ([]interface{}, error) {
@@ -65,3 +72,346 @@ func (auth AuthInfo) DeleteSecret(path string) (interface{}, error) {
 	}
 	return client.Logical().Delete(path)
 }
+
+// returned when a kv-v2 secret has no live version to copy
+var errNoLiveVersions = errors.New("Secret has no live versions to copy")
+
+// copies a single secret from src to dst. If both paths live on a kv-v2 mount,
+// every live version is replayed in order so that the destination's history
+// mirrors the source, and the mount-level metadata settings are carried over
+func (auth AuthInfo) CopySecret(src, dst string) error {
+	return auth.transferSecret(src, dst, false)
+}
+
+// moves a single secret from src to dst. Only what was copied is deleted from src: on kv-v2
+// mounts those versions are soft-deleted, so that they can still be undeleted, and versions
+// that were already deleted or destroyed are left as they are
+func (auth AuthInfo) MoveSecret(src, dst string) error {
+	return auth.transferSecret(src, dst, true)
+}
+
+func (auth AuthInfo) transferSecret(src, dst string, move bool) error {
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+
+	srcMount, srcVersion, err := kvMount(client, auth.Namespace, src)
+	if err != nil {
+		return err
+	}
+	dstMount, dstVersion, err := kvMount(client, auth.Namespace, dst)
+	if err != nil {
+		return err
+	}
+
+	// kv-v1 on either end means only the latest data can be carried over
+	if srcVersion != 2 || dstVersion != 2 {
+		data, err := readKV(client, srcMount, src, srcVersion, 0)
+		if err != nil {
+			return err
+		}
+		if err := writeKV(client, dstMount, dst, dstVersion, data); err != nil {
+			return err
+		}
+		if move {
+			return deleteKV(client, srcMount, src, srcVersion)
+		}
+		return nil
+	}
+
+	srcKey := strings.TrimPrefix(src, srcMount)
+	dstKey := strings.TrimPrefix(dst, dstMount)
+
+	meta, err := client.Logical().Read(srcMount + "metadata/" + srcKey)
+	if err != nil {
+		return err
+	}
+	if meta == nil || meta.Data == nil {
+		return errors.New("Invalid path")
+	}
+
+	// replay versions oldest first, skipping deleted and destroyed ones
+	versions, _ := meta.Data["versions"].(map[string]interface{})
+	numbers := make([]int, 0, len(versions))
+	for k, v := range versions {
+		n, err := strconv.Atoi(k)
+		if err != nil {
+			continue
+		}
+		if details, ok := v.(map[string]interface{}); ok {
+			if destroyed, _ := details["destroyed"].(bool); destroyed {
+				continue
+			}
+			if deleted, _ := details["deletion_time"].(string); deleted != "" {
+				continue
+			}
+		}
+		numbers = append(numbers, n)
+	}
+	if len(numbers) == 0 {
+		return errNoLiveVersions
+	}
+	sort.Ints(numbers)
+	for _, n := range numbers {
+		data, err := readKV(client, srcMount, src, 2, n)
+		if err != nil {
+			return err
+		}
+		if err := writeKV(client, dstMount, dst, 2, data); err != nil {
+			return err
+		}
+	}
+
+	// carry over metadata settings, best effort
+	settings := map[string]interface{}{}
+	for _, k := range []string{"max_versions", "cas_required", "delete_version_after", "custom_metadata"} {
+		if v, ok := meta.Data[k]; ok && v != nil {
+			settings[k] = v
+		}
+	}
+	if len(settings) > 0 {
+		client.Logical().Write(dstMount+"metadata/"+dstKey, settings)
+	}
+
+	if move {
+		_, err := client.Logical().Write(srcMount+"delete/"+srcKey, map[string]interface{}{
+			"versions": numbers,
+		})
+		return err
+	}
+	return nil
+}
+
+// copies every secret under the src prefix to the same relative path under dst
+// returns the source paths that were copied. Secrets without live versions are skipped
+func (auth AuthInfo) CopyPrefix(src, dst string) ([]string, error) {
+	return auth.transferPrefix(src, dst, false)
+}
+
+// moves every secret under the src prefix to the same relative path under dst, as MoveSecret
+// returns the source paths that were moved. Secrets without live versions are left as they are
+func (auth AuthInfo) MovePrefix(src, dst string) ([]string, error) {
+	return auth.transferPrefix(src, dst, true)
+}
+
+func (auth AuthInfo) transferPrefix(src, dst string, move bool) ([]string, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := listRecursive(client, auth.Namespace, src)
+	if err != nil {
+		return nil, err
+	}
+
+	transferred := make([]string, 0, len(keys))
+	for _, key := range keys {
+		err := auth.transferSecret(src+key, dst+key, move)
+		if err == errNoLiveVersions {
+			continue
+		}
+		if err != nil {
+			return transferred, err
+		}
+		transferred = append(transferred, src+key)
+	}
+	return transferred, nil
+}
+
+// returns all secrets under a prefix, relative to that prefix
+func (auth AuthInfo) ListSecretRecursive(path string) ([]string, error) {
+	keys, _, err := auth.ListSecretRecursiveWithin(path, "", Budget{})
+	return keys, err
+}
+
+// lists the secrets under a prefix in order, starting after the key 'after', until the budget runs out
+// if listing stopped early, the last key listed is returned to continue after, otherwise ""
+func (auth AuthInfo) ListSecretRecursiveWithin(path, after string, budget Budget) ([]string, string, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, "", err
+	}
+	results := []string{}
+	complete, err := walkSecrets(client, auth.Namespace, path, "", after, budget, &results)
+	if err != nil {
+		return nil, "", err
+	}
+	if complete {
+		return results, "", nil
+	}
+	return results, results[len(results)-1], nil
+}
+
+// returns all leaf keys under a path, relative to that path
+func listRecursive(client *api.Client, namespace, path string) ([]string, error) {
+	results := []string{}
+	if _, err := walkSecrets(client, namespace, path, "", "", Budget{}, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// appends the leaf keys under path+dir that sort after 'after', relative to path, in order
+// returns false if the budget ran out first. At least one key is listed before stopping,
+// so that continuing always makes progress
+func walkSecrets(client *api.Client, namespace, path, dir, after string, budget Budget, results *[]string) (bool, error) {
+	// kv-v2 mounts list through the metadata endpoint
+	listPath := path + dir
+	mount, version, err := kvMount(client, namespace, listPath)
+	if err != nil {
+		return false, err
+	}
+	if version == 2 {
+		listPath = mount + "metadata/" + strings.TrimPrefix(listPath, mount)
+	}
+
+	resp, err := client.Logical().List(listPath)
+	if err != nil {
+		return false, err
+	}
+	if resp == nil || resp.Data == nil {
+		return false, errors.New("Invalid path")
+	}
+	raw, _ := resp.Data["keys"].([]interface{})
+	keys := make([]string, 0, len(raw))
+	for _, key := range raw {
+		if key, ok := key.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := dir + key
+		if strings.HasSuffix(key, "/") {
+			// everything in a folder sorts before 'after' unless 'after' is in it or comes first
+			if after != "" && name < after && !strings.HasPrefix(after, name) {
+				continue
+			}
+			if complete, err := walkSecrets(client, namespace, path, name, after, budget, results); err != nil || !complete {
+				return complete, err
+			}
+			continue
+		}
+		if name <= after {
+			continue
+		}
+		if len(*results) > 0 && budget.Exceeded() {
+			return false, nil
+		}
+		*results = append(*results, name)
+	}
+	return true, nil
+}
+
+// how long a mount's kv version is remembered, so that upgrades to kv-v2 are picked up
+const kvMountCacheTTL = 5 * time.Minute
+
+type cachedKVMount struct {
+	version int
+	expires time.Time
+}
+
+var (
+	kvMountsLock = sync.Mutex{}
+	// keyed by the vault address, namespace and mount path
+	kvMounts = map[string]cachedKVMount{}
+)
+
+// returns the mount a path belongs to, and its kv version
+// mounts are looked up through sys/internal/ui/mounts, which any token with access to a path
+// on the mount may read, and remembered for every vault and namespace
+func kvMount(client *api.Client, namespace, path string) (string, int, error) {
+	scope := client.Address() + "\x00" + namespace + "\x00"
+	now := time.Now()
+
+	// mounts can't be nested, so at most one cached mount holds the path
+	kvMountsLock.Lock()
+	for key, entry := range kvMounts {
+		mount := strings.TrimPrefix(key, scope)
+		if strings.HasPrefix(key, scope) && strings.HasPrefix(path, mount) && now.Before(entry.expires) {
+			kvMountsLock.Unlock()
+			return mount, entry.version, nil
+		}
+	}
+	kvMountsLock.Unlock()
+
+	resp, err := client.Logical().Read("sys/internal/ui/mounts/" + path)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp == nil || resp.Data == nil {
+		return "", 0, errors.New("Could not find the mount of " + path)
+	}
+	mount, _ := resp.Data["path"].(string)
+	if mount == "" || !strings.HasPrefix(path, mount) {
+		return "", 0, errors.New("Could not find the mount of " + path)
+	}
+	version := 1
+	if options, ok := resp.Data["options"].(map[string]interface{}); ok && options["version"] == "2" {
+		version = 2
+	}
+
+	kvMountsLock.Lock()
+	kvMounts[scope+mount] = cachedKVMount{version: version, expires: now.Add(kvMountCacheTTL)}
+	kvMountsLock.Unlock()
+	return mount, version, nil
+}
+
+// reads a secret's data. A version of 0 on kv-v2 means the latest version
+func readKV(client *api.Client, mount, path string, version, n int) (map[string]interface{}, error) {
+	if version != 2 {
+		resp, err := client.Logical().Read(path)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			return nil, errors.New("Invalid path")
+		}
+		return resp.Data, nil
+	}
+
+	r := client.NewRequest("GET", "/v1/"+mount+"data/"+strings.TrimPrefix(path, mount))
+	if n > 0 {
+		r.Params.Set("version", strconv.Itoa(n))
+	}
+	resp, err := client.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	secret, err := api.ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("Invalid path")
+	}
+	data, _ := secret.Data["data"].(map[string]interface{})
+	return data, nil
+}
+
+func writeKV(client *api.Client, mount, path string, version int, data map[string]interface{}) error {
+	if version != 2 {
+		_, err := client.Logical().Write(path, data)
+		return err
+	}
+	_, err := client.Logical().Write(mount+"data/"+strings.TrimPrefix(path, mount),
+		map[string]interface{}{
+			"data": data,
+		})
+	return err
+}
+
+// deletes a secret. On kv-v2 mounts, this is a soft delete of the latest version
+func deleteKV(client *api.Client, mount, path string, version int) error {
+	if version == 2 {
+		path = mount + "data/" + strings.TrimPrefix(path, mount)
+	}
+	_, err := client.Logical().Delete(path)
+	return err
+}
@@ -0,0 +1,169 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKVMount(t *testing.T) {
+	Convey("A path's mount and kv version should be looked up once per mount", t, func(c C) {
+		lookups := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lookups++
+			switch {
+			case r.Header.Get("X-Vault-Namespace") != "":
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"errors": ["permission denied"]}`))
+			case r.URL.Path == "/v1/sys/internal/ui/mounts/kv2/foo":
+				w.Write([]byte(`{"data": {"path": "kv2/", "type": "kv", "options": {"version": "2"}}}`))
+			case r.URL.Path == "/v1/sys/internal/ui/mounts/kv1/foo":
+				w.Write([]byte(`{"data": {"path": "kv1/", "type": "kv", "options": null}}`))
+			default:
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"errors": ["permission denied"]}`))
+			}
+		}))
+		defer server.Close()
+
+		client, err := newClusterClient(&cluster{address: server.URL}, "", requestContext{}, nil, nil)
+		c.So(err, ShouldBeNil)
+
+		mount, version, err := kvMount(client, "", "kv2/foo")
+		c.So(err, ShouldBeNil)
+		c.So(mount, ShouldEqual, "kv2/")
+		c.So(version, ShouldEqual, 2)
+
+		mount, version, err = kvMount(client, "", "kv2/bar/baz")
+		c.So(err, ShouldBeNil)
+		c.So(mount, ShouldEqual, "kv2/")
+		c.So(version, ShouldEqual, 2)
+		c.So(lookups, ShouldEqual, 1)
+
+		mount, version, err = kvMount(client, "", "kv1/foo")
+		c.So(err, ShouldBeNil)
+		c.So(mount, ShouldEqual, "kv1/")
+		c.So(version, ShouldEqual, 1)
+
+		c.Convey("Mounts should be remembered separately for each namespace", func(c C) {
+			namespaced, err := newClusterClient(&cluster{address: server.URL}, "team-a/", requestContext{}, nil, nil)
+			c.So(err, ShouldBeNil)
+			_, _, err = kvMount(namespaced, "team-a/", "kv2/bar/baz")
+			c.So(err, ShouldNotBeNil)
+		})
+
+		c.Convey("A denied lookup should be an error, rather than assumed to be kv-v1", func(c C) {
+			_, _, err := kvMount(client, "", "secret/foo")
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMoveSecret(t *testing.T) {
+	Convey("Moving a kv-v2 secret should only soft-delete the versions that were copied", t, func(c C) {
+		changes := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/v1/auth/token/lookup-self":
+				w.Write([]byte(`{"data": {"policies": ["default"]}}`))
+			case strings.HasPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/"):
+				w.Write([]byte(`{"data": {"path": "secret/", "type": "kv", "options": {"version": "2"}}}`))
+			case r.URL.Path == "/v1/secret/metadata/src":
+				w.Write([]byte(`{"data": {"versions": {
+					"1": {"destroyed": true, "deletion_time": ""},
+					"2": {"destroyed": false, "deletion_time": "2018-01-01T00:00:00Z"},
+					"3": {"destroyed": false, "deletion_time": ""},
+					"4": {"destroyed": false, "deletion_time": ""}}}}`))
+			case r.URL.Path == "/v1/secret/metadata/deleted":
+				w.Write([]byte(`{"data": {"versions": {
+					"1": {"destroyed": false, "deletion_time": "2018-01-01T00:00:00Z"}}}}`))
+			case r.Method == "GET" && r.URL.Path == "/v1/secret/data/src":
+				w.Write([]byte(`{"data": {"data": {"version": "` + r.URL.Query().Get("version") + `"}}}`))
+			default:
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				raw, _ := json.Marshal(body)
+				changes = append(changes, r.Method+" "+r.URL.Path+" "+string(raw))
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		defer server.Close()
+
+		address := VaultAddress
+		VaultAddress = server.URL
+		defer func() { VaultAddress = address }()
+
+		auth := &AuthInfo{Type: "token", ID: "move-test-token"}
+		c.So(auth.MoveSecret("secret/src", "secret/dst"), ShouldBeNil)
+		c.So(changes, ShouldResemble, []string{
+			`PUT /v1/secret/data/dst {"data":{"version":"3"}}`,
+			`PUT /v1/secret/data/dst {"data":{"version":"4"}}`,
+			`PUT /v1/secret/delete/src {"versions":[3,4]}`,
+		})
+
+		c.Convey("A secret without live versions should be neither copied nor deleted", func(c C) {
+			changes = []string{}
+			c.So(auth.MoveSecret("secret/deleted", "secret/dst"), ShouldEqual, errNoLiveVersions)
+			c.So(changes, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestListSecretRecursiveWithin(t *testing.T) {
+	Convey("Secrets under a prefix should be listed in order, and continued after the last one", t, func(c C) {
+		tree := map[string]string{
+			"/v1/tree":   `["c/", "b", "a/"]`,
+			"/v1/tree/a": `["y", "x"]`,
+			"/v1/tree/c": `["z"]`,
+		}
+		listed := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/v1/auth/token/lookup-self":
+				w.Write([]byte(`{"data": {"policies": ["default"]}}`))
+			case strings.HasPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/"):
+				w.Write([]byte(`{"data": {"path": "tree/", "type": "kv"}}`))
+			case tree[r.URL.Path] != "":
+				listed = append(listed, r.URL.Path)
+				w.Write([]byte(`{"data": {"keys": ` + tree[r.URL.Path] + `}}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		address := VaultAddress
+		VaultAddress = server.URL
+		defer func() { VaultAddress = address }()
+
+		auth := &AuthInfo{Type: "token", ID: "tree-test-token"}
+		keys, err := auth.ListSecretRecursive("tree/")
+		c.So(err, ShouldBeNil)
+		c.So(keys, ShouldResemble, []string{"a/x", "a/y", "b", "c/z"})
+
+		c.Convey("An exhausted budget should still list one key, and folders before the continuation are skipped", func(c C) {
+			exhausted := NewBudget(time.Nanosecond)
+			time.Sleep(time.Millisecond)
+
+			all := []string{}
+			after := ""
+			for i := 0; i < 5; i++ {
+				listed = []string{}
+				keys, next, err := auth.ListSecretRecursiveWithin("tree/", after, exhausted)
+				c.So(err, ShouldBeNil)
+				c.So(keys, ShouldHaveLength, 1)
+				all = append(all, keys...)
+				if after = next; after == "" {
+					break
+				}
+			}
+			c.So(all, ShouldResemble, []string{"a/x", "a/y", "b", "c/z"})
+			c.So(listed, ShouldResemble, []string{"/v1/tree", "/v1/tree/c"})
+		})
+	})
+}
@@ -0,0 +1,259 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/hashicorp/go-uuid"
+	"github.com/mitchellh/mapstructure"
+)
+
+// used when SecretRequestApprovals is not configured
+const defaultSecretRequestApprovals = 1
+
+// what a secret request does to its path once approved
+const (
+	SecretRequestWrite  = "write"
+	SecretRequestDelete = "delete"
+)
+
+// a write or delete on a path that only goldfish may change, once enough people approve it
+// the proposed data is encrypted with the server transit key while the request is pending
+type SecretRequest struct {
+	ID             string
+	Path           string
+	Operation      string
+	Data           string
+	Requester      string
+	RequesterHash  string
+	Required       int
+	Approvers      []string
+	ApproverHashes []string
+	Created        string
+	// the cluster the path is on, empty for the default cluster
+	Cluster string
+}
+
+var errMalformedSecretRequest = errors.New("Request appears to be malformed")
+
+// approvals are read, counted and written back, so two approvals must not interleave
+var secretRequestsLock = sync.Mutex{}
+
+// true if changes to the path must go through a secret request
+// kv-v2 paths, e.g. secret/data/foo, are matched by their kv-v1 form too
+func RequiresSecretRequest(path string) bool {
+	return matchesSecretRequestPaths(path, false)
+}
+
+// true if the path or anything beneath it requires a secret request
+// bulk writes to such paths would bypass the approvals, and must be refused
+func TouchesSecretRequest(path string) bool {
+	return matchesSecretRequestPaths(path, true)
+}
+
+func matchesSecretRequestPaths(path string, beneath bool) bool {
+	for _, raw := range strings.Split(GetConfig().SecretRequestPaths, ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		for _, prefix := range unversionedPaths(raw) {
+			for _, candidate := range unversionedPaths(path) {
+				if strings.HasPrefix(candidate, prefix) || (beneath && strings.HasPrefix(prefix, candidate)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// the number of people besides the requester that must approve a secret request
+func SecretRequestApprovals() int {
+	if n, err := strconv.Atoi(GetConfig().SecretRequestApprovals); err == nil && n > 0 {
+		return n
+	}
+	return defaultSecretRequestApprovals
+}
+
+func parseSecretRequestApprovals(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(raw); err != nil || n <= 0 {
+		return errors.New("SecretRequestApprovals must be a positive number")
+	}
+	return nil
+}
+
+// stores a pending change to a path on the cluster. data is ignored for deletes
+func CreateSecretRequest(cluster, path, operation string, data map[string]interface{}, requester, requesterHash string) (*SecretRequest, error) {
+	if !RequiresSecretRequest(path) {
+		return nil, errors.New("Path does not require a request")
+	}
+	request := &SecretRequest{
+		Path:           path,
+		Operation:      operation,
+		Requester:      requester,
+		RequesterHash:  requesterHash,
+		Required:       SecretRequestApprovals(),
+		Approvers:      []string{},
+		ApproverHashes: []string{},
+		Created:        time.Now().UTC().Format(time.RFC3339),
+		Cluster:        cluster,
+	}
+
+	switch operation {
+	case SecretRequestWrite:
+		if data == nil {
+			return nil, errors.New("Data must be a JSON object")
+		}
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		if request.Data, err = encryptServer(raw); err != nil {
+			return nil, err
+		}
+	case SecretRequestDelete:
+	default:
+		return nil, errors.New("Operation must be either write or delete")
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	request.ID = id
+	if _, err := WriteToCubbyhole("secret_requests/"+id, structs.Map(request)); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func GetSecretRequest(id string) (*SecretRequest, error) {
+	if id == "" || strings.Contains(id, "/") {
+		return nil, errors.New("Invalid request ID")
+	}
+	resp, err := ReadFromCubbyhole("secret_requests/" + id)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Request not found")
+	}
+
+	var request SecretRequest
+	if err := mapstructure.Decode(resp.Data, &request); err != nil || request.Path == "" {
+		return nil, errMalformedSecretRequest
+	}
+	return &request, nil
+}
+
+// returns all pending secret requests. Malformed ones are left for garbage collection
+func ListSecretRequests() ([]SecretRequest, error) {
+	ids, err := listCubbyhole("secret_requests/")
+	if err != nil {
+		return nil, err
+	}
+	requests := []SecretRequest{}
+	for _, id := range ids {
+		request, err := GetSecretRequest(id)
+		if err != nil {
+			continue
+		}
+		requests = append(requests, *request)
+	}
+	return requests, nil
+}
+
+// the data a write request proposes
+func (request SecretRequest) ProposedData() (map[string]interface{}, error) {
+	if request.Operation != SecretRequestWrite {
+		return nil, nil
+	}
+	raw, err := decryptServer(request.Data)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, errors.New("Request data appears to be malformed")
+	}
+	return data, nil
+}
+
+// records an approval. Approvers must differ from the requester and from each other
+// Once enough people have approved, the change is made with goldfish's token and the request removed
+func ApproveSecretRequest(id, approver, approverHash string) (*SecretRequest, bool, error) {
+	secretRequestsLock.Lock()
+	defer secretRequestsLock.Unlock()
+
+	request, err := GetSecretRequest(id)
+	if err != nil {
+		return nil, false, err
+	}
+	if request.RequesterHash == approverHash {
+		return nil, false, errors.New("Requester cannot approve their own request")
+	}
+	for _, hash := range request.ApproverHashes {
+		if hash == approverHash {
+			return nil, false, errors.New("You have already approved this request")
+		}
+	}
+	request.Approvers = append(request.Approvers, approver)
+	request.ApproverHashes = append(request.ApproverHashes, approverHash)
+
+	if len(request.ApproverHashes) < request.Required {
+		if _, err := WriteToCubbyhole("secret_requests/"+id, structs.Map(request)); err != nil {
+			return nil, false, err
+		}
+		return request, false, nil
+	}
+
+	if err := applySecretRequest(request); err != nil {
+		return nil, false, err
+	}
+	if _, err := DeleteFromCubbyhole("secret_requests/" + id); err != nil {
+		return nil, false, err
+	}
+	return request, true, nil
+}
+
+func applySecretRequest(request *SecretRequest) error {
+	client, err := serverClient(request.Cluster, "")
+	if err != nil {
+		return err
+	}
+	mount, version, err := kvMount(client, "", request.Path)
+	if err != nil {
+		return err
+	}
+	// requests hold the secret's data, so kv-v2 paths may be given in either form
+	path := request.Path
+	if version == 2 {
+		path = mount + strings.TrimPrefix(strings.TrimPrefix(path, mount), "data/")
+	}
+	if request.Operation == SecretRequestDelete {
+		return deleteKV(client, mount, path, version)
+	}
+	data, err := request.ProposedData()
+	if err != nil {
+		return err
+	}
+	return writeKV(client, mount, path, version, data)
+}
+
+func DeleteSecretRequest(id string) error {
+	if id == "" || strings.Contains(id, "/") {
+		return errors.New("Invalid request ID")
+	}
+	secretRequestsLock.Lock()
+	defer secretRequestsLock.Unlock()
+	_, err := DeleteFromCubbyhole("secret_requests/" + id)
+	return err
+}
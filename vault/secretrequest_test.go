@@ -0,0 +1,121 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSecretRequestPaths(t *testing.T) {
+	Convey("With secret request paths configured", t, func(c C) {
+		configLock.Lock()
+		previous := config
+		config.SecretRequestPaths = "secret/prod/, kv/data/payments/"
+		config.SecretRequestApprovals = ""
+		configLock.Unlock()
+		defer func() {
+			configLock.Lock()
+			config = previous
+			configLock.Unlock()
+		}()
+
+		c.Convey("Paths under a prefix should require a request", func(c C) {
+			c.So(RequiresSecretRequest("secret/prod/db"), ShouldBeTrue)
+			c.So(RequiresSecretRequest("secret/dev/db"), ShouldBeFalse)
+		})
+
+		c.Convey("kv-v2 paths should be matched by their kv-v1 form", func(c C) {
+			c.So(RequiresSecretRequest("secret/data/prod/db"), ShouldBeTrue)
+			c.So(RequiresSecretRequest("secret/metadata/prod/db"), ShouldBeTrue)
+			c.So(RequiresSecretRequest("kv/payments/stripe"), ShouldBeTrue)
+			c.So(RequiresSecretRequest("kv/data/payments/stripe"), ShouldBeTrue)
+			c.So(RequiresSecretRequest("secret/data/dev/db"), ShouldBeFalse)
+			c.So(RequiresSecretRequest("kv/dev/db"), ShouldBeFalse)
+		})
+
+		c.Convey("Parents of a prefix should be touched by it", func(c C) {
+			c.So(TouchesSecretRequest("secret/"), ShouldBeTrue)
+			c.So(TouchesSecretRequest("secret/prod/db/"), ShouldBeTrue)
+			c.So(TouchesSecretRequest("secret/data/"), ShouldBeTrue)
+			c.So(TouchesSecretRequest("kv/"), ShouldBeTrue)
+			c.So(TouchesSecretRequest("kv/payments/"), ShouldBeTrue)
+			c.So(TouchesSecretRequest("secret/dev/"), ShouldBeFalse)
+		})
+
+		c.Convey("One approval should be required by default", func(c C) {
+			c.So(SecretRequestApprovals(), ShouldEqual, 1)
+		})
+	})
+
+	Convey("SecretRequestApprovals should be validated", t, func(c C) {
+		c.So(parseSecretRequestApprovals(""), ShouldBeNil)
+		c.So(parseSecretRequestApprovals("3"), ShouldBeNil)
+		c.So(parseSecretRequestApprovals("0"), ShouldNotBeNil)
+		c.So(parseSecretRequestApprovals("two"), ShouldNotBeNil)
+	})
+}
+
+func TestApplySecretRequest(t *testing.T) {
+	Convey("Approved secret requests should be applied through the kv version of their mount", t, func(c C) {
+		changes := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case strings.HasPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/kv2/"):
+				w.Write([]byte(`{"data": {"path": "kv2/", "type": "kv", "options": {"version": "2"}}}`))
+			case strings.HasPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/kv1/"):
+				w.Write([]byte(`{"data": {"path": "kv1/", "type": "kv"}}`))
+			case r.URL.Path == "/v1/transit/decrypt/server":
+				plaintext := base64.StdEncoding.EncodeToString([]byte(`{"password": "hunter2"}`))
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"plaintext": plaintext}})
+			default:
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				raw, _ := json.Marshal(body)
+				changes = append(changes, r.Method+" "+r.URL.Path+" "+string(raw))
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		defer server.Close()
+
+		address := VaultAddress
+		VaultAddress = server.URL
+		defer func() { VaultAddress = address }()
+		configLock.Lock()
+		previous := config
+		config.TransitBackend = "transit"
+		config.ServerTransitKey = "server"
+		configLock.Unlock()
+		defer func() {
+			configLock.Lock()
+			config = previous
+			configLock.Unlock()
+		}()
+		client, err := newVaultClient("", nil, nil)
+		c.So(err, ShouldBeNil)
+		previousClient, previousToken := serverVaultClient(), ServerToken()
+		setServerToken(client, "server-token")
+		defer setServerToken(previousClient, previousToken)
+
+		for _, request := range []*SecretRequest{
+			{Path: "kv2/prod/db", Operation: SecretRequestWrite, Data: "vault:v1:secret"},
+			{Path: "kv2/data/prod/db", Operation: SecretRequestWrite, Data: "vault:v1:secret"},
+			{Path: "kv2/data/prod/db", Operation: SecretRequestDelete},
+			{Path: "kv1/prod/db", Operation: SecretRequestWrite, Data: "vault:v1:secret"},
+			{Path: "kv1/prod/db", Operation: SecretRequestDelete},
+		} {
+			c.So(applySecretRequest(request), ShouldBeNil)
+		}
+		c.So(changes, ShouldResemble, []string{
+			`PUT /v1/kv2/data/prod/db {"data":{"password":"hunter2"}}`,
+			`PUT /v1/kv2/data/prod/db {"data":{"password":"hunter2"}}`,
+			`DELETE /v1/kv2/data/prod/db null`,
+			`PUT /v1/kv1/prod/db {"password":"hunter2"}`,
+			`DELETE /v1/kv1/prod/db null`,
+		})
+	})
+}
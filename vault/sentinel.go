@@ -0,0 +1,135 @@
+package vault
+
+import (
+	"errors"
+	"strings"
+)
+
+// enforcement levels of sentinel policies, from least to most strict
+var sentinelEnforcementLevels = []string{"advisory", "soft-mandatory", "hard-mandatory"}
+
+// a role governing (rgp) or endpoint governing (egp) sentinel policy, only on vault enterprise
+// Paths are the request paths an egp applies to, rgps are attached to tokens like acl policies
+type SentinelPolicy struct {
+	Name             string   `json:"name"`
+	Type             string   `json:"type"`
+	Policy           string   `json:"policy"`
+	EnforcementLevel string   `json:"enforcement_level"`
+	Paths            []string `json:"paths,omitempty"`
+}
+
+func sentinelPath(kind, name string) (string, error) {
+	if kind != "rgp" && kind != "egp" {
+		return "", errors.New("Sentinel policy type must be rgp or egp")
+	}
+	if strings.ContainsAny(name, "/?#") {
+		return "", errors.New("Invalid sentinel policy name")
+	}
+	return "sys/policies/" + kind + "/" + name, nil
+}
+
+func (p SentinelPolicy) validate() error {
+	if p.Name == "" {
+		return errors.New("Empty sentinel policy name")
+	}
+	if p.Policy == "" {
+		return errors.New("Sentinel policy " + p.Name + " has no code")
+	}
+	if !containsString(sentinelEnforcementLevels, p.EnforcementLevel) {
+		return errors.New("Enforcement level must be one of " + strings.Join(sentinelEnforcementLevels, ", "))
+	}
+	if p.Type == "egp" && len(p.Paths) == 0 {
+		return errors.New("Endpoint governing policies must apply to at least one path")
+	}
+	if p.Type == "rgp" && len(p.Paths) != 0 {
+		return errors.New("Role governing policies are attached to tokens, not paths")
+	}
+	return nil
+}
+
+// lists the names of sentinel policies of a type
+func (auth AuthInfo) ListSentinelPolicies(kind string) ([]string, error) {
+	path, err := sentinelPath(kind, "")
+	if err != nil {
+		return nil, err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	return listKeys(client.Logical(), strings.TrimSuffix(path, "/"))
+}
+
+func (auth AuthInfo) GetSentinelPolicy(kind, name string) (*SentinelPolicy, error) {
+	path, err := sentinelPath(kind, name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, errors.New("Empty sentinel policy name")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, errors.New("Sentinel policy " + name + " not found")
+	}
+
+	p := &SentinelPolicy{Name: name, Type: kind}
+	p.Policy, _ = resp.Data["policy"].(string)
+	p.EnforcementLevel, _ = resp.Data["enforcement_level"].(string)
+	if paths, ok := resp.Data["paths"].([]interface{}); ok {
+		for _, raw := range paths {
+			if s, ok := raw.(string); ok {
+				p.Paths = append(p.Paths, s)
+			}
+		}
+	}
+	return p, nil
+}
+
+// creates or replaces a sentinel policy
+func (auth AuthInfo) PutSentinelPolicy(p SentinelPolicy) error {
+	path, err := sentinelPath(p.Type, p.Name)
+	if err != nil {
+		return err
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"policy":            p.Policy,
+		"enforcement_level": p.EnforcementLevel,
+	}
+	if p.Type == "egp" {
+		data["paths"] = p.Paths
+	}
+	_, err = client.Logical().Write(path, data)
+	return err
+}
+
+func (auth AuthInfo) DeleteSentinelPolicy(kind, name string) error {
+	path, err := sentinelPath(kind, name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return errors.New("Empty sentinel policy name")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().Delete(path)
+	return err
+}
@@ -0,0 +1,43 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSentinelPolicy(t *testing.T) {
+	Convey("Only rgp and egp policies should have paths", t, func(c C) {
+		path, err := sentinelPath("egp", "business-hours")
+		c.So(err, ShouldBeNil)
+		c.So(path, ShouldEqual, "sys/policies/egp/business-hours")
+
+		_, err = sentinelPath("acl", "default")
+		c.So(err, ShouldNotBeNil)
+		_, err = sentinelPath("rgp", "../acl/default")
+		c.So(err, ShouldNotBeNil)
+	})
+
+	Convey("Sentinel policies should be validated before being written", t, func(c C) {
+		egp := SentinelPolicy{
+			Name:             "business-hours",
+			Type:             "egp",
+			Policy:           "main = rule { true }",
+			EnforcementLevel: "soft-mandatory",
+			Paths:            []string{"secret/*"},
+		}
+		c.So(egp.validate(), ShouldBeNil)
+
+		rgp := egp
+		rgp.Type = "rgp"
+		c.So(rgp.validate(), ShouldNotBeNil)
+		rgp.Paths = nil
+		c.So(rgp.validate(), ShouldBeNil)
+
+		egp.Paths = nil
+		c.So(egp.validate(), ShouldNotBeNil)
+
+		rgp.EnforcementLevel = "mandatory"
+		c.So(rgp.validate(), ShouldNotBeNil)
+	})
+}
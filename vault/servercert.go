@@ -0,0 +1,60 @@
+package vault
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"strings"
+)
+
+// issues a certificate for goldfish's own listener from a PKI role, with goldfish's token.
+// path is the role's issue endpoint, e.g. pki/issue/goldfish
+func IssueServerCertificate(path, commonName string, altNames []string, ttl string) (*tls.Certificate, error) {
+	params := map[string]interface{}{
+		"common_name": commonName,
+	}
+	if len(altNames) > 0 {
+		params["alt_names"] = strings.Join(altNames, ",")
+	}
+	if ttl != "" {
+		params["ttl"] = ttl
+	}
+	resp, err := serverVaultClient().Logical().Write(path, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Vault did not return a certificate")
+	}
+	return parseIssuedCertificate(resp.Data)
+}
+
+// the certificate and key of a PKI issue response, with the chain up to the CA
+func parseIssuedCertificate(data map[string]interface{}) (*tls.Certificate, error) {
+	certificate, _ := data["certificate"].(string)
+	key, _ := data["private_key"].(string)
+	if certificate == "" || key == "" {
+		return nil, errors.New("Vault did not return a certificate and private key")
+	}
+
+	chain := []string{certificate}
+	// ca_chain is only returned by newer vaults, and includes the issuing ca
+	if cas, ok := data["ca_chain"].([]interface{}); ok && len(cas) > 0 {
+		for _, ca := range cas {
+			if s, ok := ca.(string); ok {
+				chain = append(chain, s)
+			}
+		}
+	} else if ca, ok := data["issuing_ca"].(string); ok && ca != "" {
+		chain = append(chain, ca)
+	}
+
+	cert, err := tls.X509KeyPair([]byte(strings.Join(chain, "\n")), []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
@@ -0,0 +1,70 @@
+package vault
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// a certificate signed by parent, or self-signed if parent is nil, in PEM
+func testCertificate(name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (string, *x509.Certificate, *ecdsa.PrivateKey) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	cert, _ := x509.ParseCertificate(der)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), cert, key
+}
+
+func TestParseIssuedCertificate(t *testing.T) {
+	caPEM, ca, caKey := testCertificate("ca", nil, nil)
+	leafPEM, _, leafKey := testCertificate("goldfish.example.com", ca, caKey)
+	keyDER, _ := x509.MarshalECPrivateKey(leafKey)
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+
+	Convey("An issued certificate should be served with its chain", t, func(c C) {
+		cert, err := parseIssuedCertificate(map[string]interface{}{
+			"certificate": leafPEM,
+			"private_key": keyPEM,
+			"issuing_ca":  caPEM,
+		})
+		c.So(err, ShouldBeNil)
+		c.So(cert.Certificate, ShouldHaveLength, 2)
+		c.So(cert.Leaf.Subject.CommonName, ShouldEqual, "goldfish.example.com")
+
+		cert, err = parseIssuedCertificate(map[string]interface{}{
+			"certificate": leafPEM,
+			"private_key": keyPEM,
+			"ca_chain":    []interface{}{caPEM},
+			"issuing_ca":  caPEM,
+		})
+		c.So(err, ShouldBeNil)
+		c.So(cert.Certificate, ShouldHaveLength, 2)
+	})
+
+	Convey("A response without a key should be rejected", t, func(c C) {
+		_, err := parseIssuedCertificate(map[string]interface{}{
+			"certificate": leafPEM,
+		})
+		c.So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,193 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	// the server token is renewed at half its TTL, but no more often than this
+	minServerTokenWait = 10 * time.Second
+	// a renewed token with less TTL than this has reached its max TTL, and can only be replaced
+	minServerTokenTTL = 30 * time.Second
+	// how soon to try again after renewing or logging in failed
+	serverTokenRetryWait = time.Minute
+)
+
+var (
+	// logs in again for a new server token, nil if goldfish can't
+	serverLogin     func(*api.Client) (*api.SecretAuth, error)
+	serverLoginLock = sync.Mutex{}
+	// the server token belongs to something else, e.g. vault agent, so goldfish doesn't revoke it
+	serverTokenShared = false
+	// the auth mount goldfish logs in through, set once at startup
+	serverLoginMount = ""
+
+	serverTokenStatus     = ServerTokenStatus{Healthy: true}
+	serverTokenStatusLock = sync.RWMutex{}
+)
+
+// how goldfish's server token is doing, for /api/health
+// Expires is empty for tokens without a TTL. LastError is the latest failure, cleared by a success
+type ServerTokenStatus struct {
+	Healthy     bool   `json:"healthy"`
+	Expires     string `json:"expires,omitempty"`
+	LastRenewed string `json:"last_renewed,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+	Relogins    int    `json:"relogins"`
+	CanRelogin  bool   `json:"can_relogin"`
+}
+
+func ServerTokenHealth() ServerTokenStatus {
+	serverTokenStatusLock.RLock()
+	defer serverTokenStatusLock.RUnlock()
+	status := serverTokenStatus
+	status.CanRelogin = serverLogin != nil
+	return status
+}
+
+// renews the server token, or logs in for a new one if it can't be renewed any more
+// returns how long to wait before doing so again, at most max
+func maintainServerToken(max time.Duration) (time.Duration, error) {
+	ttl, err := renewServerTokenTTL()
+	if err == nil && (ttl == 0 || ttl >= minServerTokenTTL) {
+		recordServerToken(ttl, false, nil)
+		return serverTokenWait(ttl, max), nil
+	}
+
+	// a sealed or unreachable vault is waited out, a new token wouldn't help
+	if err != nil && retryable(err) {
+		recordServerToken(0, false, err)
+		return serverTokenRetryWait, err
+	}
+	if err == nil {
+		err = errors.New("Server token expires in " + ttl.String() + " and can't be renewed any further")
+	}
+	if serverLogin == nil {
+		recordServerToken(0, false, err)
+		return serverTokenRetryWait, err
+	}
+
+	log.Println("[WARN ]: Logging in again, the server token can't be renewed:", err.Error())
+	if ttl, err = reloginServerToken(); err != nil {
+		recordServerToken(0, false, err)
+		return serverTokenRetryWait, errors.New("Could not log in again: " + err.Error())
+	}
+	recordServerToken(ttl, true, nil)
+	return serverTokenWait(ttl, max), nil
+}
+
+func renewServerTokenTTL() (time.Duration, error) {
+	client, err := NewVaultClient()
+	if err != nil {
+		return 0, err
+	}
+	client.SetToken(ServerToken())
+	// whatever owns a shared token renews it, so goldfish only checks how long it has left
+	if serverTokenShared {
+		resp, err := client.Auth().Token().LookupSelf()
+		if err != nil {
+			return 0, err
+		}
+		ttl, _ := strconv.Atoi(fmt.Sprint(resp.Data["ttl"]))
+		return time.Duration(ttl) * time.Second, nil
+	}
+	resp, err := client.Auth().Token().RenewSelf(0)
+	if err != nil {
+		return 0, err
+	}
+	if resp == nil || resp.Auth == nil {
+		return 0, errors.New("Renewal response from vault did not contain the token's TTL")
+	}
+	return time.Duration(resp.Auth.LeaseDuration) * time.Second, nil
+}
+
+// replaces the server token with a new login. goldfish's state lives in the server token's
+// cubbyhole, so it is copied over to the new token before switching. The old token must
+// still be valid for that, or the state is lost as it would be on a restart
+func reloginServerToken() (time.Duration, error) {
+	serverLoginLock.Lock()
+	defer serverLoginLock.Unlock()
+	client, err := NewVaultClient()
+	if err != nil {
+		return 0, err
+	}
+	auth, err := serverLogin(client)
+	if err != nil {
+		return 0, err
+	}
+	client.SetToken(auth.ClientToken)
+	if err := copyCubbyhole(serverVaultClient(), client, ""); err != nil {
+		log.Println("[ERROR]: Could not copy goldfish's state to the new server token, pending requests are lost:", err.Error())
+	}
+	setServerToken(client, auth.ClientToken)
+	log.Println("[INFO ]: Server token accessor:", auth.Accessor)
+	return time.Duration(auth.LeaseDuration) * time.Second, nil
+}
+
+// copies every entry under the prefix of one token's cubbyhole to another's
+func copyCubbyhole(from, to *api.Client, prefix string) error {
+	keys, err := listKeys(from.Logical(), "cubbyhole/"+prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") {
+			if err := copyCubbyhole(from, to, prefix+key); err != nil {
+				return err
+			}
+			continue
+		}
+		resp, err := from.Logical().Read("cubbyhole/" + prefix + key)
+		if err != nil {
+			return err
+		}
+		if resp == nil || resp.Data == nil {
+			continue
+		}
+		if _, err := to.Logical().Write("cubbyhole/"+prefix+key, resp.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// half the token's TTL, bounded by the minimum wait and max. Tokens without a TTL wait max
+func serverTokenWait(ttl, max time.Duration) time.Duration {
+	wait := ttl / 2
+	if ttl == 0 || wait > max {
+		wait = max
+	}
+	if wait < minServerTokenWait {
+		wait = minServerTokenWait
+	}
+	return wait
+}
+
+func recordServerToken(ttl time.Duration, relogin bool, err error) {
+	serverTokenStatusLock.Lock()
+	defer serverTokenStatusLock.Unlock()
+	if err != nil {
+		serverTokenStatus.Healthy = false
+		serverTokenStatus.LastError = err.Error()
+		return
+	}
+	now := time.Now()
+	serverTokenStatus.Healthy = true
+	serverTokenStatus.LastError = ""
+	serverTokenStatus.LastRenewed = now.UTC().Format(time.RFC3339)
+	serverTokenStatus.Expires = ""
+	if ttl > 0 {
+		serverTokenStatus.Expires = now.Add(ttl).UTC().Format(time.RFC3339)
+	}
+	if relogin {
+		serverTokenStatus.Relogins++
+	}
+}
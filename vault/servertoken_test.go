@@ -0,0 +1,49 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestServerTokenWait(t *testing.T) {
+	Convey("The wait before renewing the server token", t, func(c C) {
+		c.Convey("Should be half the TTL", func(c C) {
+			c.So(serverTokenWait(20*time.Minute, time.Hour), ShouldEqual, 10*time.Minute)
+		})
+
+		c.Convey("Should be bounded", func(c C) {
+			c.So(serverTokenWait(24*time.Hour, time.Hour), ShouldEqual, time.Hour)
+			c.So(serverTokenWait(0, time.Hour), ShouldEqual, time.Hour)
+			c.So(serverTokenWait(4*time.Second, time.Hour), ShouldEqual, minServerTokenWait)
+		})
+	})
+}
+
+func TestServerTokenStatus(t *testing.T) {
+	Convey("The server token's status", t, func(c C) {
+		defer func() { serverTokenStatus = ServerTokenStatus{Healthy: true} }()
+
+		recordServerToken(time.Hour, false, nil)
+		status := ServerTokenHealth()
+		c.So(status.Healthy, ShouldBeTrue)
+		c.So(status.Expires, ShouldNotBeEmpty)
+		c.So(status.Relogins, ShouldEqual, 0)
+
+		c.Convey("Should keep the latest error until a success", func(c C) {
+			recordServerToken(0, false, errors.New("Code: 503"))
+			status := ServerTokenHealth()
+			c.So(status.Healthy, ShouldBeFalse)
+			c.So(status.LastError, ShouldEqual, "Code: 503")
+
+			recordServerToken(0, true, nil)
+			status = ServerTokenHealth()
+			c.So(status.Healthy, ShouldBeTrue)
+			c.So(status.LastError, ShouldBeEmpty)
+			c.So(status.Expires, ShouldBeEmpty)
+			c.So(status.Relogins, ShouldEqual, 1)
+		})
+	})
+}
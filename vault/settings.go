@@ -0,0 +1,137 @@
+package vault
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/fatih/structs"
+)
+
+// shown instead of a setting that holds a credential. Sending it back leaves the setting unchanged
+const RedactedSetting = "(redacted)"
+
+// settings that hold credentials, or urls that carry them, which are never sent to the browser
+var secretSettings = map[string]bool{
+	"GithubAccessToken": true,
+	"SlackWebhook":      true,
+	"Webhooks":          true,
+	"ChatChannels":      true,
+	"IncidentSinkURL":   true,
+	"ReplicaSigningKey": true,
+}
+
+// changes are read, checked and written back one at a time
+var settingsLock = sync.Mutex{}
+
+// settings that can't be changed through goldfish, and why
+var readOnlySettings = map[string]string{
+	"LastUpdated":               "is set by goldfish",
+	"GithubCurrentCommit":       "is set by goldfish",
+	"PreviousServerTransitKeys": "is set by goldfish",
+	"PreviousUserTransitKeys":   "is set by goldfish",
+	// moving the backend would leave every key goldfish encrypted with behind
+	"TransitBackend": "holds goldfish's transit keys",
+}
+
+// settings naming goldfish's transit keys, and the settings keeping the keys they replaced
+// so that sessions, and what users encrypted, can still be decrypted after a change
+var transitKeySettings = map[string]string{
+	"ServerTransitKey": "PreviousServerTransitKeys",
+	"UserTransitKey":   "PreviousUserTransitKeys",
+}
+
+// the runtime config goldfish is using, with credentials redacted
+func GetSettings() map[string]interface{} {
+	settings := structs.Map(GetConfig())
+	for name := range secretSettings {
+		if value, _ := settings[name].(string); value != "" {
+			settings[name] = RedactedSetting
+		}
+	}
+	return settings
+}
+
+// changes the runtime config stored in vault, and applies it at once
+// the whole config is checked as it would be on reload, so an invalid change is not written
+// other goldfish replicas pick the change up at their next reload
+func UpdateSettings(changes map[string]string) error {
+	if len(changes) == 0 {
+		return errors.New("No settings were given")
+	}
+	fields := reflect.TypeOf(Config{})
+	for name, value := range changes {
+		if _, ok := fields.FieldByName(name); !ok {
+			return errors.New("Unknown setting " + name)
+		}
+		if reason, ok := readOnlySettings[name]; ok {
+			return errors.New(name + " " + reason + ", and can't be changed through goldfish")
+		}
+		if name == "SlackWebhook" && value != "" && value != RedactedSetting &&
+			!strings.HasPrefix(value, "https://hooks.slack.com/services") {
+			return errors.New("SlackWebhook must be a https://hooks.slack.com/services url")
+		}
+		if _, ok := transitKeySettings[name]; ok && (value == "" || strings.ContainsAny(value, "/?#,")) {
+			return errors.New(name + " must name a transit key")
+		}
+	}
+
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	resp, err := serverVaultClient().Logical().Read(runtimeConfigPath)
+	if err != nil {
+		return err
+	}
+	if resp == nil || resp.Data == nil {
+		return errors.New("Failed to read config secret from vault")
+	}
+	for name, previousName := range transitKeySettings {
+		value, ok := changes[name]
+		current, _ := resp.Data[name].(string)
+		if !ok || value == current {
+			continue
+		}
+		// every session is encrypted with the server key, so goldfish must be able to use it
+		if name == "ServerTransitKey" {
+			backend, _ := resp.Data["TransitBackend"].(string)
+			if err := checkServerTransitKey(backend, value); err != nil {
+				return errors.New("Goldfish can't use " + value + " as its server transit key: " + err.Error())
+			}
+		}
+		previous, _ := resp.Data[previousName].(string)
+		kept := []string{}
+		for _, key := range transitKeys(current, previous) {
+			if key != "" && key != value {
+				kept = append(kept, key)
+			}
+		}
+		resp.Data[previousName] = strings.Join(kept, ",")
+	}
+	for name, value := range changes {
+		if secretSettings[name] && value == RedactedSetting {
+			continue
+		}
+		resp.Data[name] = value
+	}
+
+	return applyRuntimeConfig(runtimeConfigPath, resp.Data)
+}
+
+// checks that goldfish's own token can encrypt and decrypt with a transit key
+func checkServerTransitKey(backend, key string) error {
+	client := serverVaultClient()
+	resp, err := client.Logical().Write(backend+"/encrypt/"+key, map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString([]byte("goldfish")),
+	})
+	if err != nil {
+		return err
+	}
+	cipher, ok := resp.Data["ciphertext"].(string)
+	if !ok {
+		return errors.New("Failed type assertion of response to string")
+	}
+	_, err = decryptWithKeys(client, backend, []string{key}, cipher)
+	return err
+}
@@ -0,0 +1,130 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSettings(t *testing.T) {
+	Convey("Runtime settings", t, func(c C) {
+		configLock.Lock()
+		previous := config
+		config = Config{
+			ServerTransitKey:  "goldfish",
+			GithubAccessToken: "secret",
+		}
+		configLock.Unlock()
+		defer func() {
+			configLock.Lock()
+			config = previous
+			configLock.Unlock()
+		}()
+
+		c.Convey("Should redact credentials that are set", func(c C) {
+			settings := GetSettings()
+			c.So(settings["ServerTransitKey"], ShouldEqual, "goldfish")
+			c.So(settings["GithubAccessToken"], ShouldEqual, RedactedSetting)
+			c.So(settings["SlackWebhook"], ShouldEqual, "")
+		})
+
+		c.Convey("Should reject changes that could never be valid", func(c C) {
+			c.So(UpdateSettings(nil), ShouldNotBeNil)
+			c.So(UpdateSettings(map[string]string{"NoSuchSetting": "x"}), ShouldNotBeNil)
+			c.So(UpdateSettings(map[string]string{"LastUpdated": "now"}), ShouldNotBeNil)
+			c.So(UpdateSettings(map[string]string{"UserTransitKey": ""}), ShouldNotBeNil)
+			c.So(UpdateSettings(map[string]string{"ServerTransitKey": "a/b"}), ShouldNotBeNil)
+			c.So(UpdateSettings(map[string]string{"PreviousServerTransitKeys": "other"}), ShouldNotBeNil)
+			c.So(UpdateSettings(map[string]string{"TransitBackend": "other-transit"}), ShouldNotBeNil)
+			c.So(UpdateSettings(map[string]string{"SlackWebhook": "http://example.com"}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestUpdateTransitKeySettings(t *testing.T) {
+	Convey("Changing goldfish's transit keys should keep the old keys for decryption", t, func(c C) {
+		// ciphertexts name the key that made them, and only that key decrypts them
+		keys := map[string]bool{"old": true, "new": true, "user-old": true, "user-new": true}
+		stored := map[string]interface{}{
+			"TransitBackend":   "transit",
+			"ServerTransitKey": "old",
+			"UserTransitKey":   "user-old",
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			switch {
+			case strings.HasPrefix(r.URL.Path, "/v1/transit/encrypt/") && keys[strings.TrimPrefix(r.URL.Path, "/v1/transit/encrypt/")]:
+				key := strings.TrimPrefix(r.URL.Path, "/v1/transit/encrypt/")
+				plaintext, _ := body["plaintext"].(string)
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"ciphertext": "vault:" + key + ":" + plaintext}})
+			case strings.HasPrefix(r.URL.Path, "/v1/transit/decrypt/"):
+				key := strings.TrimPrefix(r.URL.Path, "/v1/transit/decrypt/")
+				ciphertext, _ := body["ciphertext"].(string)
+				if !keys[key] || !strings.HasPrefix(ciphertext, "vault:"+key+":") {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"errors": ["cipher: message authentication failed"]}`))
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"plaintext": strings.TrimPrefix(ciphertext, "vault:"+key+":")}})
+			case r.URL.Path == "/v1/goldfish/config" && r.Method == "GET":
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": stored})
+			case r.URL.Path == "/v1/goldfish/config":
+				stored = body
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors": ["no such key"]}`))
+			}
+		}))
+		defer server.Close()
+
+		address, path := VaultAddress, runtimeConfigPath
+		VaultAddress, runtimeConfigPath = server.URL, "goldfish/config"
+		defer func() { VaultAddress, runtimeConfigPath = address, path }()
+		configLock.Lock()
+		previous, previousHash := config, configHash
+		config = Config{TransitBackend: "transit", ServerTransitKey: "old", UserTransitKey: "user-old"}
+		configLock.Unlock()
+		defer func() {
+			configLock.Lock()
+			config, configHash = previous, previousHash
+			configLock.Unlock()
+		}()
+		client, err := newVaultClient("", nil, nil)
+		c.So(err, ShouldBeNil)
+		previousClient, previousToken := serverVaultClient(), ServerToken()
+		setServerToken(client, "server-token")
+		defer setServerToken(previousClient, previousToken)
+
+		session, err := encryptServer([]byte("session"))
+		c.So(err, ShouldBeNil)
+
+		c.So(UpdateSettings(map[string]string{"ServerTransitKey": "new", "UserTransitKey": "user-new"}), ShouldBeNil)
+		c.So(GetConfig().ServerTransitKey, ShouldEqual, "new")
+		c.So(GetConfig().PreviousServerTransitKeys, ShouldEqual, "old")
+		c.So(GetConfig().UserTransitKey, ShouldEqual, "user-new")
+		c.So(GetConfig().PreviousUserTransitKeys, ShouldEqual, "user-old")
+
+		// what was encrypted before the change still decrypts, and new sessions use the new key
+		plaintext, err := decryptServer(session)
+		c.So(err, ShouldBeNil)
+		c.So(string(plaintext), ShouldEqual, "session")
+		session, err = encryptServer([]byte("session"))
+		c.So(err, ShouldBeNil)
+		c.So(session, ShouldStartWith, "vault:new:")
+
+		// switching back moves the key out of the previous keys
+		c.So(UpdateSettings(map[string]string{"ServerTransitKey": "old"}), ShouldBeNil)
+		c.So(GetConfig().PreviousServerTransitKeys, ShouldEqual, "new")
+		c.So(checkOwnTransitKey("new"), ShouldNotBeNil)
+
+		// goldfish must be able to use a new server key before sessions depend on it
+		c.So(UpdateSettings(map[string]string{"ServerTransitKey": "missing"}), ShouldNotBeNil)
+		c.So(GetConfig().ServerTransitKey, ShouldEqual, "old")
+	})
+}
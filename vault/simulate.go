@@ -0,0 +1,128 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// how many paths one simulation may check, each is a call to vault
+const maxSimulatedPaths = 50
+
+// the capabilities a token or set of policies effectively has on a path
+type PathCapabilities struct {
+	Path         string   `json:"path"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// trims, de-duplicates and bounds the paths a simulation checks
+func simulationPaths(raw []string) ([]string, error) {
+	paths := []string{}
+	seen := map[string]bool{}
+	for _, path := range raw {
+		path = strings.TrimPrefix(strings.TrimSpace(path), "/")
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("At least one path is required")
+	}
+	if len(paths) > maxSimulatedPaths {
+		return nil, fmt.Errorf("At most %d paths can be simulated at once", maxSimulatedPaths)
+	}
+	return paths, nil
+}
+
+// the capabilities of the token with the given accessor, on each path
+func (auth AuthInfo) SimulateAccessor(accessor string, paths []string) ([]PathCapabilities, error) {
+	if accessor == "" {
+		return nil, errors.New("Empty token accessor")
+	}
+	paths, err := simulationPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]PathCapabilities, 0, len(paths))
+	for _, path := range paths {
+		caps, err := capabilitiesAccessor(client, accessor, path)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, PathCapabilities{Path: path, Capabilities: caps})
+	}
+	return results, nil
+}
+
+// the capabilities a token with exactly these policies would have, on each path
+// vault only answers for tokens, so a short-lived one is created and revoked afterwards
+func (auth AuthInfo) SimulatePolicies(policies []string, paths []string) ([]PathCapabilities, error) {
+	if len(policies) == 0 {
+		return nil, errors.New("At least one policy is required")
+	}
+	paths, err := simulationPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Auth().Token().Create(&api.TokenCreateRequest{
+		Policies:        policies,
+		NoDefaultPolicy: true,
+		TTL:             "1m",
+		DisplayName:     "goldfish-simulation",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Auth == nil {
+		return nil, errors.New("Vault did not return a token to simulate with")
+	}
+	defer client.Auth().Token().RevokeTree(resp.Auth.ClientToken)
+
+	results := make([]PathCapabilities, 0, len(paths))
+	for _, path := range paths {
+		caps, err := client.Sys().Capabilities(resp.Auth.ClientToken, path)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, PathCapabilities{Path: path, Capabilities: caps})
+	}
+	return results, nil
+}
+
+// the api client has no helper for sys/capabilities-accessor
+func capabilitiesAccessor(client *api.Client, accessor, path string) ([]string, error) {
+	r := client.NewRequest("POST", "/v1/sys/capabilities-accessor")
+	if err := r.SetJSONBody(map[string]string{
+		"accessor": accessor,
+		"path":     path,
+	}); err != nil {
+		return nil, err
+	}
+	resp, err := client.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Capabilities []string `json:"capabilities"`
+	}
+	if err := resp.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return result.Capabilities, nil
+}
@@ -0,0 +1,28 @@
+package vault
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSimulationPaths(t *testing.T) {
+	Convey("Paths should be trimmed and de-duplicated", t, func(c C) {
+		paths, err := simulationPaths([]string{" /secret/foo", "secret/foo", "", "sys/mounts\r"})
+		c.So(err, ShouldBeNil)
+		c.So(paths, ShouldResemble, []string{"secret/foo", "sys/mounts"})
+	})
+
+	Convey("Empty and oversized lists should be rejected", t, func(c C) {
+		_, err := simulationPaths([]string{" ", ""})
+		c.So(err, ShouldNotBeNil)
+
+		many := []string{}
+		for i := 0; i <= maxSimulatedPaths; i++ {
+			many = append(many, fmt.Sprintf("secret/%d", i))
+		}
+		_, err = simulationPaths(many)
+		c.So(err, ShouldNotBeNil)
+	})
+}
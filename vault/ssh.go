@@ -0,0 +1,111 @@
+package vault
+
+import (
+	"errors"
+)
+
+func init() {
+	RegisterSecretEngine("ssh", sshEngine{})
+}
+
+func (auth AuthInfo) ListSSHRoles(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "ssh") + "roles")
+}
+
+func (auth AuthInfo) ReadSSHRole(mount, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty role name")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "ssh") + "roles/" + name)
+}
+
+// returns the public key of the CA that signs keys, for configuring TrustedUserCAKeys
+func (auth AuthInfo) ReadSSHCAPublicKey(mount string) (map[string]interface{}, error) {
+	return auth.ReadSecret(mountPrefix(mount, "ssh") + "config/ca")
+}
+
+// signs a public key with a CA role, returning the signed certificate
+func (auth AuthInfo) SignSSHKey(mount, role string, params map[string]interface{}) (map[string]interface{}, error) {
+	if role == "" {
+		return nil, errors.New("Empty role name")
+	}
+	if key, _ := params["public_key"].(string); key == "" {
+		return nil, errors.New("Empty public key")
+	}
+	return auth.writeSSH(mountPrefix(mount, "ssh")+"sign/"+role, params)
+}
+
+// generates a one-time password for the host at ip, with an OTP role
+func (auth AuthInfo) GenerateSSHOTP(mount, role, ip, username string) (map[string]interface{}, error) {
+	if role == "" || ip == "" {
+		return nil, errors.New("Role and ip must not be empty")
+	}
+	params := map[string]interface{}{
+		"ip": ip,
+	}
+	if username != "" {
+		params["username"] = username
+	}
+	return auth.writeSSH(mountPrefix(mount, "ssh")+"creds/"+role, params)
+}
+
+func (auth AuthInfo) writeSSH(path string, params map[string]interface{}) (map[string]interface{}, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Write(path, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Invalid path")
+	}
+	return LeasedSecret(resp), nil
+}
+
+type sshEngine struct{}
+
+func (e sshEngine) Describe() EngineDescription {
+	return EngineDescription{
+		Type:        "ssh",
+		Name:        "SSH",
+		Description: "Signed SSH certificates and one-time passwords",
+	}
+}
+
+func (e sshEngine) List(auth AuthInfo, mount, path string) ([]interface{}, error) {
+	if path == "" {
+		path = "roles/"
+	}
+	return auth.ListSecret(mount + path)
+}
+
+func (e sshEngine) Read(auth AuthInfo, mount, path string) (map[string]interface{}, error) {
+	return auth.ReadSecret(mount + path)
+}
+
+func (e sshEngine) Write(auth AuthInfo, mount, path string, data map[string]interface{}) (interface{}, error) {
+	return auth.writeSSH(mount+path, data)
+}
+
+func (e sshEngine) Actions() []EngineAction {
+	return []EngineAction{
+		{
+			Name:        "sign",
+			Description: "Sign public_key with the CA role at path",
+			Run: func(auth AuthInfo, mount, path string, params map[string]interface{}) (interface{}, error) {
+				return auth.SignSSHKey(mount, lastSegment(path), params)
+			},
+		},
+		{
+			Name:        "otp",
+			Description: "Generate a one-time password for ip with the OTP role at path",
+			Run: func(auth AuthInfo, mount, path string, params map[string]interface{}) (interface{}, error) {
+				ip, _ := params["ip"].(string)
+				username, _ := params["username"].(string)
+				return auth.GenerateSSHOTP(mount, lastSegment(path), ip, username)
+			},
+		},
+	}
+}
@@ -0,0 +1,55 @@
+package vault
+
+import (
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	// how often, and how patiently, startup steps are retried while vault is unreachable
+	StartupRetries       = 10
+	StartupRetryInterval = 2 * time.Second
+)
+
+// the longest wait between two startup attempts
+const maxStartupRetryInterval = time.Minute
+
+// runs a startup step until it succeeds, retrying errors that vault may recover from
+// (unreachable, sealed, standby) with exponential backoff
+func retryStartup(step string, fn func() error) error {
+	interval := StartupRetryInterval
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !retryable(err) || attempt >= StartupRetries {
+			return err
+		}
+
+		log.Printf("[WARN ]: %s failed (attempt %d of %d), retrying in %s: %s",
+			step, attempt+1, StartupRetries+1, interval, err.Error())
+		time.Sleep(interval)
+		if interval *= 2; interval > maxStartupRetryInterval {
+			interval = maxStartupRetryInterval
+		}
+	}
+}
+
+// errors about the request itself (4xx) won't go away by waiting, anything else might
+func retryable(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	msg := err.Error()
+	if strings.Contains(msg, "Code: 4") {
+		return false
+	}
+	for _, transient := range []string{
+		"Code: 5", "connection refused", "no such host", "i/o timeout", "EOF", "connection reset",
+	} {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
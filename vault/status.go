@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"encoding/json"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// everything about the cluster that vault tells without a token
+// HAMode is active, standby or disabled. Replication modes are empty on vaults without replication
+type ClusterStatus struct {
+	Initialized                bool                    `json:"initialized"`
+	Sealed                     bool                    `json:"sealed"`
+	HAMode                     string                  `json:"ha_mode"`
+	LeaderAddress              string                  `json:"leader_address"`
+	ReplicationPerformanceMode string                  `json:"replication_performance_mode"`
+	ReplicationDRMode          string                  `json:"replication_dr_mode"`
+	Version                    string                  `json:"version"`
+	ClusterName                string                  `json:"cluster_name"`
+	ClusterID                  string                  `json:"cluster_id"`
+	ServerTimeUTC              int64                   `json:"server_time_utc"`
+	Seal                       *api.SealStatusResponse `json:"seal"`
+}
+
+// the parts of sys/health that the status is built from
+type healthResponse struct {
+	Initialized                bool   `json:"initialized"`
+	Sealed                     bool   `json:"sealed"`
+	Standby                    bool   `json:"standby"`
+	ReplicationPerformanceMode string `json:"replication_performance_mode"`
+	ReplicationDRMode          string `json:"replication_dr_mode"`
+	ServerTimeUTC              int64  `json:"server_time_utc"`
+	Version                    string `json:"version"`
+	ClusterName                string `json:"cluster_name"`
+	ClusterID                  string `json:"cluster_id"`
+}
+
+// gathers health, seal and leader status in one go. A sealed vault has no leader to report
+func GetClusterStatus() (*ClusterStatus, error) {
+	status, _, err := GetClusterStatusWithin(Budget{})
+	return status, err
+}
+
+// gathers the status like GetClusterStatus, until the budget runs out
+// if it ran out, the parts not yet gathered are left out, HA mode included, and false is returned
+func GetClusterStatusWithin(budget Budget) (*ClusterStatus, bool, error) {
+	raw, err := VaultHealth()
+	if err != nil {
+		return nil, false, err
+	}
+	var health healthResponse
+	if err := json.Unmarshal([]byte(raw), &health); err != nil {
+		return nil, false, err
+	}
+	if budget.Exceeded() {
+		status := clusterStatus(health, nil, nil)
+		status.HAMode = ""
+		return status, false, nil
+	}
+
+	client, err := NewVaultClient()
+	if err != nil {
+		return nil, false, err
+	}
+	seal, err := client.Sys().SealStatus()
+	if err != nil {
+		return nil, false, err
+	}
+	if budget.Exceeded() {
+		status := clusterStatus(health, seal, nil)
+		status.HAMode = ""
+		return status, false, nil
+	}
+	var leader *api.LeaderResponse
+	if !health.Sealed && health.Initialized {
+		if leader, err = client.Sys().Leader(); err != nil {
+			return nil, false, err
+		}
+	}
+	return clusterStatus(health, seal, leader), true, nil
+}
+
+func clusterStatus(health healthResponse, seal *api.SealStatusResponse, leader *api.LeaderResponse) *ClusterStatus {
+	status := &ClusterStatus{
+		Initialized:                health.Initialized,
+		Sealed:                     health.Sealed,
+		HAMode:                     "disabled",
+		ReplicationPerformanceMode: health.ReplicationPerformanceMode,
+		ReplicationDRMode:          health.ReplicationDRMode,
+		Version:                    health.Version,
+		ClusterName:                health.ClusterName,
+		ClusterID:                  health.ClusterID,
+		ServerTimeUTC:              health.ServerTimeUTC,
+		Seal:                       seal,
+	}
+	if leader != nil && leader.HAEnabled {
+		status.LeaderAddress = leader.LeaderAddress
+		if health.Standby && !leader.IsSelf {
+			status.HAMode = "standby"
+		} else {
+			status.HAMode = "active"
+		}
+	}
+	return status
+}
@@ -0,0 +1,32 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClusterStatus(t *testing.T) {
+	Convey("A node without HA should report HA as disabled", t, func(c C) {
+		status := clusterStatus(healthResponse{Initialized: true}, nil, &api.LeaderResponse{})
+		c.So(status.HAMode, ShouldEqual, "disabled")
+	})
+
+	Convey("A sealed node has no leader to report", t, func(c C) {
+		status := clusterStatus(healthResponse{Initialized: true, Sealed: true}, nil, nil)
+		c.So(status.HAMode, ShouldEqual, "disabled")
+		c.So(status.Sealed, ShouldBeTrue)
+	})
+
+	Convey("Standby and active nodes should be told apart", t, func(c C) {
+		leader := &api.LeaderResponse{HAEnabled: true, LeaderAddress: "https://vault-0:8200"}
+		status := clusterStatus(healthResponse{Initialized: true, Standby: true}, nil, leader)
+		c.So(status.HAMode, ShouldEqual, "standby")
+		c.So(status.LeaderAddress, ShouldEqual, "https://vault-0:8200")
+
+		leader.IsSelf = true
+		status = clusterStatus(healthResponse{Initialized: true}, nil, leader)
+		c.So(status.HAMode, ShouldEqual, "active")
+	})
+}
@@ -0,0 +1,52 @@
+package vault
+
+import (
+	"errors"
+	"io/ioutil"
+)
+
+// vault's sys/metrics, in one of the formats it can render them in
+type VaultMetrics struct {
+	Format string
+	Body   []byte
+}
+
+// json unless prometheus is asked for, which is the only other format vault knows
+func metricsFormat(format string) (string, error) {
+	switch format {
+	case "", "json":
+		return "json", nil
+	case "prometheus":
+		return format, nil
+	}
+	return "", errors.New("Metrics format must be json or prometheus")
+}
+
+// vault's telemetry, read with the session's token so vault decides who may see it
+func (auth AuthInfo) GetVaultMetrics(format string) (*VaultMetrics, error) {
+	format, err := metricsFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	r := client.NewRequest("GET", "/v1/sys/metrics")
+	if format == "prometheus" {
+		r.Params.Set("format", format)
+	}
+	resp, err := client.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &VaultMetrics{Format: format, Body: body}, nil
+}
@@ -0,0 +1,26 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetricsFormat(t *testing.T) {
+	Convey("Metrics should default to json", t, func(c C) {
+		format, err := metricsFormat("")
+		c.So(err, ShouldBeNil)
+		c.So(format, ShouldEqual, "json")
+	})
+
+	Convey("Prometheus format should be passed on", t, func(c C) {
+		format, err := metricsFormat("prometheus")
+		c.So(err, ShouldBeNil)
+		c.So(format, ShouldEqual, "prometheus")
+	})
+
+	Convey("Unknown formats should be rejected", t, func(c C) {
+		_, err := metricsFormat("statsd")
+		c.So(err, ShouldNotBeNil)
+	})
+}
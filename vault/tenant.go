@@ -0,0 +1,369 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a team sharing this goldfish instance. Sessions belong to the tenant if they hold
+// any of its policies or are members of any of its identity groups, and can then
+// only reach vault paths under its prefixes and mounts
+type Tenant struct {
+	Name     string   `json:"-"`
+	Groups   []string `json:"groups"`
+	Policies []string `json:"policies"`
+	// path prefixes, e.g. "secret/team-a/"
+	Prefixes []string `json:"prefixes"`
+	// whole mounts, e.g. "transit/"
+	Mounts []string `json:"mounts"`
+}
+
+// paths every session needs, which only concern the session's own token
+var tenantExemptPaths = []string{
+	"auth/token/lookup-self",
+	"auth/token/renew-self",
+	"auth/token/revoke-self",
+	"sys/capabilities-self",
+	"sys/wrapping/",
+	"cubbyhole/",
+}
+
+// kv-v2 inserts these after the mount
+var kvVersionedSegments = []string{"data/", "metadata/", "delete/", "undelete/", "destroy/"}
+
+func parseTenants(raw string) (map[string]*Tenant, error) {
+	tenants := map[string]*Tenant{}
+	if raw == "" {
+		return tenants, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &tenants); err != nil {
+		return nil, errors.New("Tenants must be a JSON object of tenant names to scopes")
+	}
+	for name, t := range tenants {
+		if t == nil || (len(t.Groups) == 0 && len(t.Policies) == 0) {
+			return nil, errors.New("Tenants: " + name + " must list the groups or policies it applies to")
+		}
+		t.Name = name
+		for i, prefix := range t.Prefixes {
+			t.Prefixes[i] = strings.TrimPrefix(prefix, "/")
+			if !strings.Contains(t.Prefixes[i], "/") {
+				return nil, errors.New("Tenants: " + name + " prefix " + prefix + " must include its mount")
+			}
+		}
+		for i, mount := range t.Mounts {
+			t.Mounts[i] = strings.Trim(mount, "/") + "/"
+		}
+	}
+	return tenants, nil
+}
+
+// the combined scope of every tenant a session belongs to
+type tenantScope struct {
+	names    []string
+	prefixes []string
+}
+
+// returns the scope a session is confined to, or nil if it is unrestricted
+func tenantScopeFor(self map[string]interface{}) (*tenantScope, error) {
+	configLock.RLock()
+	tenants := tenancy
+	exempt := strings.Split(config.TenantExemptPolicies, ",")
+	configLock.RUnlock()
+
+	if len(tenants) == 0 {
+		return nil, nil
+	}
+
+	policies := map[string]bool{}
+	list, _ := self["policies"].([]interface{})
+	for _, p := range list {
+		if name, ok := p.(string); ok {
+			policies[name] = true
+		}
+	}
+	if policies["root"] {
+		return nil, nil
+	}
+	for _, p := range exempt {
+		if policies[strings.TrimSpace(p)] {
+			return nil, nil
+		}
+	}
+
+	var groups map[string]bool
+	scope := &tenantScope{}
+	for _, t := range tenants {
+		member := false
+		for _, p := range t.Policies {
+			member = member || policies[p]
+		}
+		if !member && len(t.Groups) > 0 {
+			if groups == nil {
+				entityID, _ := self["entity_id"].(string)
+				var err error
+				if groups, err = entityGroups(entityID); err != nil {
+					return nil, err
+				}
+			}
+			for _, g := range t.Groups {
+				member = member || groups[g]
+			}
+		}
+		if member {
+			scope.names = append(scope.names, t.Name)
+			scope.prefixes = append(scope.prefixes, t.Prefixes...)
+			scope.prefixes = append(scope.prefixes, t.Mounts...)
+		}
+	}
+
+	// sessions outside every tenant get an empty scope, tenancy fails closed
+	return scope, nil
+}
+
+// true if the vault path is within scope
+func (s *tenantScope) allows(path string) bool {
+	for _, exempt := range tenantExemptPaths {
+		if path == exempt || (strings.HasSuffix(exempt, "/") && strings.HasPrefix(path, exempt)) {
+			return true
+		}
+	}
+	// leases are named after the path that issued them
+	for _, lease := range []string{"sys/renew/", "sys/revoke/", "sys/leases/renew/", "sys/leases/revoke/"} {
+		if strings.HasPrefix(path, lease) {
+			return s.contains(strings.TrimPrefix(path, lease))
+		}
+	}
+	return s.contains(path)
+}
+
+func (s *tenantScope) contains(path string) bool {
+	for _, candidate := range unversionedPaths(path) {
+		for _, prefix := range s.prefixes {
+			if strings.HasPrefix(candidate, prefix) || candidate+"/" == prefix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// true if the path is a directory leading to something in scope, which may be listed
+func (s *tenantScope) leadsInto(dir string) bool {
+	for _, candidate := range unversionedPaths(dir) {
+		for _, prefix := range s.prefixes {
+			if strings.HasPrefix(prefix, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returns the path along with its kv-v1 form, if it looks like a kv-v2 path
+func unversionedPaths(path string) []string {
+	results := []string{path}
+	i := strings.Index(path, "/")
+	if i < 0 {
+		return results
+	}
+	mount, rest := path[:i+1], path[i+1:]
+	for _, segment := range kvVersionedSegments {
+		if strings.HasPrefix(rest, segment) {
+			results = append(results, mount+strings.TrimPrefix(rest, segment))
+		} else if rest+"/" == segment {
+			results = append(results, mount)
+		}
+	}
+	return results
+}
+
+// keeps only the listed keys that are in scope or lead into it
+func (s *tenantScope) filterKeys(dir string, keys []interface{}) []interface{} {
+	results := []interface{}{}
+	for _, key := range keys {
+		name, _ := key.(string)
+		if s.contains(dir+name) || s.leadsInto(dir+name) {
+			results = append(results, key)
+		}
+	}
+	return results
+}
+
+// tenantTransport confines every request made with a user's client to the tenant scope,
+// so no handler can reach outside it regardless of the token's capabilities
+type tenantTransport struct {
+	base  http.RoundTripper
+	scope *tenantScope
+}
+
+func (t *tenantTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.scope == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v1/")
+	listing := req.Method == "LIST" || (req.Method == "GET" && req.URL.Query().Get("list") == "true")
+	dir := strings.TrimSuffix(path, "/") + "/"
+
+	switch {
+	case req.Method == "GET" && path == "sys/mounts":
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			return resp, err
+		}
+		return t.filterResponse(resp, func(body map[string]interface{}) {
+			filterMounts(t.scope, body)
+			if data, ok := body["data"].(map[string]interface{}); ok {
+				filterMounts(t.scope, data)
+			}
+		})
+
+	// the mount of a path may be looked up if the path could be reached
+	case req.Method == "GET" && strings.HasPrefix(path, "sys/internal/ui/mounts/"):
+		mountPath := strings.TrimPrefix(path, "sys/internal/ui/mounts/")
+		if t.scope.contains(mountPath) || t.scope.leadsInto(mountPath) {
+			return t.base.RoundTrip(req)
+		}
+
+	case t.scope.allows(path):
+		return t.base.RoundTrip(req)
+
+	case listing && t.scope.leadsInto(dir):
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			return resp, err
+		}
+		return t.filterResponse(resp, func(body map[string]interface{}) {
+			if data, ok := body["data"].(map[string]interface{}); ok {
+				if keys, ok := data["keys"].([]interface{}); ok {
+					data["keys"] = t.scope.filterKeys(dir, keys)
+				}
+			}
+		})
+	}
+
+	return tenantDenied(req, t.scope), nil
+}
+
+func filterMounts(scope *tenantScope, mounts map[string]interface{}) {
+	for mount, v := range mounts {
+		// mounts are keyed by their path, other keys are response fields
+		if _, ok := v.(map[string]interface{}); !ok || !strings.HasSuffix(mount, "/") {
+			continue
+		}
+		if !scope.contains(mount) && !scope.leadsInto(mount) {
+			delete(mounts, mount)
+		}
+	}
+}
+
+func (t *tenantTransport) filterResponse(resp *http.Response, filter func(map[string]interface{})) (*http.Response, error) {
+	raw, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	filter(body)
+	if raw, err = json.Marshal(body); err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	resp.ContentLength = int64(len(raw))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+func tenantDenied(req *http.Request, scope *tenantScope) *http.Response {
+	msg := "path is outside the scope of this goldfish tenant"
+	if len(scope.names) > 0 {
+		msg = "path is outside the scope of tenant " + strings.Join(scope.names, ", ")
+	}
+	return forbiddenResponse(req, msg)
+}
+
+// a response shaped like vault's own permission errors, so callers handle it the same way
+func forbiddenResponse(req *http.Request, msg string) *http.Response {
+	raw, _ := json.Marshal(map[string][]string{"errors": {msg}})
+	return &http.Response{
+		Status:        "403 Forbidden",
+		StatusCode:    http.StatusForbidden,
+		Proto:         req.Proto,
+		ProtoMajor:    req.ProtoMajor,
+		ProtoMinor:    req.ProtoMinor,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(raw)),
+		ContentLength: int64(len(raw)),
+		Request:       req,
+	}
+}
+
+// entity group names are cached briefly, since they're needed on every request
+const entityGroupsTTL = time.Minute
+
+type cachedGroups struct {
+	names   map[string]bool
+	fetched time.Time
+}
+
+var (
+	entityGroupsLock  sync.Mutex
+	entityGroupsCache = map[string]cachedGroups{}
+)
+
+// returns the names of the identity groups an entity belongs to, directly or as a member of a
+// member group, read with the server's token
+func entityGroups(entityID string) (map[string]bool, error) {
+	if entityID == "" {
+		return map[string]bool{}, nil
+	}
+
+	entityGroupsLock.Lock()
+	defer entityGroupsLock.Unlock()
+	if cached, ok := entityGroupsCache[entityID]; ok && time.Since(cached.fetched) < entityGroupsTTL {
+		return cached.names, nil
+	}
+
+	entity, err := serverVaultClient().Logical().Read("identity/entity/id/" + entityID)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	if entity != nil {
+		// groups the entity is in through a member group count as much as its own
+		ids, _ := entity.Data["group_ids"].([]interface{})
+		inherited, _ := entity.Data["inherited_group_ids"].([]interface{})
+		for _, id := range append(ids, inherited...) {
+			groupID, _ := id.(string)
+			group, err := serverVaultClient().Logical().Read("identity/group/id/" + groupID)
+			if err != nil {
+				return nil, err
+			}
+			if group == nil {
+				continue
+			}
+			if name, ok := group.Data["name"].(string); ok {
+				names[name] = true
+			}
+		}
+	}
+
+	// evict stale entries while holding the lock anyway
+	for id, cached := range entityGroupsCache {
+		if time.Since(cached.fetched) >= entityGroupsTTL {
+			delete(entityGroupsCache, id)
+		}
+	}
+	entityGroupsCache[entityID] = cachedGroups{names: names, fetched: time.Now()}
+	return names, nil
+}
@@ -0,0 +1,112 @@
+package vault
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTenantScope(t *testing.T) {
+	Convey("Parsing tenants", t, func(c C) {
+		tenants, err := parseTenants(`{
+			"team-a": {"policies": ["team-a"], "prefixes": ["/secret/team-a/"], "mounts": ["transit"]}
+		}`)
+		c.So(err, ShouldBeNil)
+		c.So(tenants["team-a"].Prefixes, ShouldResemble, []string{"secret/team-a/"})
+		c.So(tenants["team-a"].Mounts, ShouldResemble, []string{"transit/"})
+
+		_, err = parseTenants(`{"team-b": {"prefixes": ["secret/team-b/"]}}`)
+		c.So(err, ShouldNotBeNil)
+		_, err = parseTenants(`{"team-b": {"policies": ["b"], "prefixes": ["secret"]}}`)
+		c.So(err, ShouldNotBeNil)
+	})
+
+	Convey("A tenant scope", t, func(c C) {
+		scope := &tenantScope{
+			names:    []string{"team-a"},
+			prefixes: []string{"secret/team-a/", "transit/"},
+		}
+
+		c.Convey("Should allow paths under its prefixes and mounts", func(c C) {
+			c.So(scope.allows("secret/team-a/db"), ShouldBeTrue)
+			c.So(scope.allows("secret/team-a"), ShouldBeTrue)
+			c.So(scope.allows("transit/encrypt/key"), ShouldBeTrue)
+			c.So(scope.allows("secret/data/team-a/db"), ShouldBeTrue)
+			c.So(scope.allows("secret/metadata/team-a/db"), ShouldBeTrue)
+			c.So(scope.allows("secret/team-a-other/db"), ShouldBeFalse)
+			c.So(scope.allows("secret/team-b/db"), ShouldBeFalse)
+			c.So(scope.allows("secret/data/team-b/db"), ShouldBeFalse)
+			c.So(scope.allows("sys/policy/admin"), ShouldBeFalse)
+		})
+
+		c.Convey("Should allow paths about the session's own token", func(c C) {
+			c.So(scope.allows("auth/token/lookup-self"), ShouldBeTrue)
+			c.So(scope.allows("cubbyhole/notes"), ShouldBeTrue)
+			c.So(scope.allows("auth/token/create"), ShouldBeFalse)
+		})
+
+		c.Convey("Should judge leases by the path that issued them", func(c C) {
+			c.So(scope.allows("sys/revoke/transit/creds/x/123"), ShouldBeTrue)
+			c.So(scope.allows("sys/revoke/aws/creds/admin/123"), ShouldBeFalse)
+		})
+
+		c.Convey("Should filter listings of parent directories", func(c C) {
+			c.So(scope.leadsInto("secret/"), ShouldBeTrue)
+			c.So(scope.leadsInto("secret/metadata/"), ShouldBeTrue)
+			c.So(scope.leadsInto("aws/"), ShouldBeFalse)
+			keys := scope.filterKeys("secret/", []interface{}{"team-a/", "team-b/", "team-a-other/"})
+			c.So(keys, ShouldResemble, []interface{}{"team-a/"})
+		})
+	})
+
+	Convey("The tenant transport", t, func(c C) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/sys/mounts":
+				w.Write([]byte(`{"secret/": {"type": "kv"}, "aws/": {"type": "aws"},
+					"data": {"secret/": {"type": "kv"}, "aws/": {"type": "aws"}}}`))
+			default:
+				w.Write([]byte(`{"data": {"keys": ["team-a/", "team-b/"]}}`))
+			}
+		}))
+		defer server.Close()
+
+		client := &http.Client{Transport: &tenantTransport{
+			base:  http.DefaultTransport,
+			scope: &tenantScope{names: []string{"team-a"}, prefixes: []string{"secret/team-a/"}},
+		}}
+		get := func(path string) (int, map[string]interface{}) {
+			resp, err := client.Get(server.URL + path)
+			c.So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			raw, _ := ioutil.ReadAll(resp.Body)
+			body := map[string]interface{}{}
+			json.Unmarshal(raw, &body)
+			return resp.StatusCode, body
+		}
+
+		code, body := get("/v1/secret/?list=true")
+		c.So(code, ShouldEqual, http.StatusOK)
+		c.So(body["data"].(map[string]interface{})["keys"], ShouldResemble, []interface{}{"team-a/"})
+
+		code, body = get("/v1/sys/mounts")
+		c.So(code, ShouldEqual, http.StatusOK)
+		c.So(body["aws/"], ShouldBeNil)
+		c.So(body["secret/"], ShouldNotBeNil)
+		c.So(body["data"].(map[string]interface{})["aws/"], ShouldBeNil)
+
+		code, _ = get("/v1/sys/internal/ui/mounts/secret/team-a/db")
+		c.So(code, ShouldEqual, http.StatusOK)
+		code, _ = get("/v1/sys/internal/ui/mounts/aws/creds/admin")
+		c.So(code, ShouldEqual, http.StatusForbidden)
+
+		code, _ = get("/v1/secret/team-b/db")
+		c.So(code, ShouldEqual, http.StatusForbidden)
+		code, _ = get("/v1/aws/?list=true")
+		c.So(code, ShouldEqual, http.StatusForbidden)
+	})
+}
@@ -0,0 +1,171 @@
+package vault
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// a goldfish module that the runtime config can switch off, listed in DisabledFeatures
+type Toggle struct {
+	Name        string
+	Description string
+	Disabled    bool
+	// api routes the toggle switches off, as "METHOD /route" with the route as registered
+	Routes []string `json:"-"`
+}
+
+// the toggle that switches off every change made through goldfish
+const ReadOnlyToggle = "writes"
+
+// routes that stay available in read-only mode although they aren't GETs. They either
+// don't change vault, or are needed to log in, or to turn read-only mode off again
+var readOnlyExempt = []string{
+	"POST /api/login",
+	"POST /api/login/renew-self",
+	"POST /api/login/namespace",
+	"POST /api/logout",
+	"POST /api/policy/summary",
+	"POST /api/policy/validate",
+	"POST /api/policy/simulate",
+	"POST /api/transit/encrypt",
+	"POST /api/transit/decrypt",
+	"POST /api/transit/sign/:key",
+	"POST /api/transit/verify/:key",
+	"POST /api/transit/verify-hmac/:key",
+	"POST /api/transit/hmac/:key",
+	"POST /api/transit/datakey",
+	"POST /api/transit/encrypt-file",
+	"POST /api/transit/decrypt-file",
+	"POST /api/secrets/export",
+	"POST /api/wrapping/lookup",
+	"POST /api/totp/code/:name",
+	"PUT /api/settings",
+}
+
+var toggles = []Toggle{
+	{
+		Name:        "transit",
+		Description: "The transit page, and every transit encryption, signing and key operation",
+		Routes: []string{
+			"GET /api/transit",
+			"POST /api/transit/encrypt",
+			"POST /api/transit/decrypt",
+			"GET /api/transit/keys",
+			"POST /api/transit/keys/:name",
+			"DELETE /api/transit/keys/:name",
+			"POST /api/transit/keys/:name/rotate",
+			"POST /api/transit/keys/:name/config",
+			"POST /api/transit/keys/:name/trim",
+			"POST /api/transit/sign/:key",
+			"POST /api/transit/verify/:key",
+			"POST /api/transit/hmac/:key",
+			"POST /api/transit/verify-hmac/:key",
+			"POST /api/transit/datakey",
+			"POST /api/transit/encrypt-file",
+			"POST /api/transit/decrypt-file",
+		},
+	},
+	{
+		Name:        "secrets_write",
+		Description: "Writing, deleting, copying, moving and importing secrets and requests to do so, writing the cubbyhole, and running custom requests",
+		Routes: []string{
+			"POST /api/secrets",
+			"DELETE /api/secrets",
+			"POST /api/secrets/copy",
+			"POST /api/secrets/move",
+			"POST /api/secrets/import",
+			"POST /api/secrets/requests",
+			"POST /api/secrets/requests/:id",
+			"POST /api/engines/path",
+			"POST /api/cubbyhole",
+			"DELETE /api/cubbyhole",
+			"POST /api/custom/:name",
+		},
+	},
+	{
+		Name:        "user_creation",
+		Description: "Creating and exchanging tokens, and creating approle secret ids and roles, directly or through identity requests",
+		Routes: []string{
+			"POST /api/users/create",
+			"POST /api/users/exchange",
+			"POST /api/users/role",
+			"POST /api/identity-requests",
+			"POST /api/identity-requests/:id",
+			"POST /api/identity-requests/:id/collect",
+		},
+	},
+	{
+		Name:        ReadOnlyToggle,
+		Description: "Every change made through goldfish, leaving it read-only",
+	},
+}
+
+func disabledToggles() map[string]bool {
+	disabled := map[string]bool{}
+	for _, name := range strings.Split(GetConfig().DisabledFeatures, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			disabled[name] = true
+		}
+	}
+	return disabled
+}
+
+func parseDisabledFeatures(raw string) error {
+	names := make([]string, 0, len(toggles))
+	for _, toggle := range toggles {
+		names = append(names, toggle.Name)
+	}
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name != "" && !containsString(names, name) {
+			return errors.New("DisabledFeatures may only list " + strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// lists the modules that can be switched off, and whether they are
+func Toggles() []Toggle {
+	disabled := disabledToggles()
+	results := make([]Toggle, 0, len(toggles))
+	for _, toggle := range toggles {
+		toggle.Disabled = disabled[toggle.Name]
+		results = append(results, toggle)
+	}
+	return results
+}
+
+// the routes that read-only mode or goldfish roles let through, all of which must be registered
+func ExemptRoutes() []string {
+	return append(append([]string{}, readOnlyExempt...), roleExemptRoutes...)
+}
+
+// true if goldfish must not change anything
+func ReadOnly() bool {
+	return disabledToggles()[ReadOnlyToggle]
+}
+
+// returns the disabled toggle that switches off a request to the given route, if any
+func DisabledToggleForRoute(method, route string) (Toggle, bool) {
+	disabled := disabledToggles()
+	endpoint := method + " " + route
+	for _, toggle := range toggles {
+		if !disabled[toggle.Name] {
+			continue
+		}
+		if toggle.Name == ReadOnlyToggle {
+			switch method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				continue
+			}
+			if strings.HasPrefix(route, "/api/") && !containsString(readOnlyExempt, endpoint) {
+				return toggle, true
+			}
+			continue
+		}
+		if containsString(toggle.Routes, endpoint) {
+			return toggle, true
+		}
+	}
+	return Toggle{}, false
+}
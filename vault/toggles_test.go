@@ -0,0 +1,54 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestToggles(t *testing.T) {
+	Convey("Feature toggles", t, func(c C) {
+		setDisabled := func(raw string) {
+			configLock.Lock()
+			config.DisabledFeatures = raw
+			configLock.Unlock()
+		}
+		defer setDisabled("")
+
+		c.Convey("Should only accept known modules", func(c C) {
+			c.So(parseDisabledFeatures(""), ShouldBeNil)
+			c.So(parseDisabledFeatures("transit, writes"), ShouldBeNil)
+			c.So(parseDisabledFeatures("transit,nope"), ShouldNotBeNil)
+		})
+
+		c.Convey("Should switch off only the disabled modules' routes", func(c C) {
+			setDisabled("transit")
+			_, disabled := DisabledToggleForRoute("POST", "/api/transit/encrypt")
+			c.So(disabled, ShouldBeTrue)
+			_, disabled = DisabledToggleForRoute("POST", "/api/secrets")
+			c.So(disabled, ShouldBeFalse)
+			c.So(ReadOnly(), ShouldBeFalse)
+		})
+
+		c.Convey("Should leave reads and exempt routes alone in read-only mode", func(c C) {
+			setDisabled("writes")
+			c.So(ReadOnly(), ShouldBeTrue)
+			toggle, disabled := DisabledToggleForRoute("POST", "/api/secrets")
+			c.So(disabled, ShouldBeTrue)
+			c.So(toggle.Name, ShouldEqual, ReadOnlyToggle)
+			_, disabled = DisabledToggleForRoute("GET", "/api/secrets")
+			c.So(disabled, ShouldBeFalse)
+			_, disabled = DisabledToggleForRoute("POST", "/api/login")
+			c.So(disabled, ShouldBeFalse)
+			_, disabled = DisabledToggleForRoute("PUT", "/api/settings")
+			c.So(disabled, ShouldBeFalse)
+		})
+
+		c.Convey("Should report which modules are disabled", func(c C) {
+			setDisabled("user_creation")
+			for _, toggle := range Toggles() {
+				c.So(toggle.Disabled, ShouldEqual, toggle.Name == "user_creation")
+			}
+		})
+	})
+}
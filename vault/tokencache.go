@@ -0,0 +1,170 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// how long a session's token lookup is trusted, unless TokenCacheTTL says otherwise
+const defaultTokenCacheTTL = 30 * time.Second
+
+// how often cached tokens are looked up again, so revoked tokens are dropped early
+const tokenRevocationCheckInterval = 10 * time.Second
+
+type cachedToken struct {
+	cluster string
+	token   string
+	self    *api.Secret
+	expires time.Time
+}
+
+var (
+	tokenCacheLock = sync.Mutex{}
+	// keyed by a hash of the cluster and token, as clusters look up tokens independently
+	tokenCache = map[string]cachedToken{}
+)
+
+// how long token lookups are cached for. Zero disables the cache
+func tokenCacheTTL() time.Duration {
+	raw := GetConfig().TokenCacheTTL
+	if raw == "" {
+		return defaultTokenCacheTTL
+	}
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl < 0 {
+		return defaultTokenCacheTTL
+	}
+	return ttl
+}
+
+func parseTokenCacheTTL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if ttl, err := time.ParseDuration(raw); err != nil || ttl < 0 {
+		return errors.New("TokenCacheTTL must be a duration such as 30s, or 0 to disable caching")
+	}
+	return nil
+}
+
+func tokenCacheKey(cluster, token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(cluster+"\x00"+token)))
+}
+
+// returns the cached lookup of a token on a cluster, if it has not expired
+func cachedLookup(cluster, token string, now time.Time) (*api.Secret, bool) {
+	tokenCacheLock.Lock()
+	defer tokenCacheLock.Unlock()
+	entry, ok := tokenCache[tokenCacheKey(cluster, token)]
+	if !ok || !now.Before(entry.expires) {
+		return nil, false
+	}
+	return entry.self, true
+}
+
+// caches a token lookup for ttl, or until the token itself expires if that is sooner
+func cacheLookup(cluster, token string, self *api.Secret, ttl time.Duration, now time.Time) {
+	if ttl <= 0 || self == nil || self.Data == nil {
+		return
+	}
+	expires := now.Add(ttl)
+	if remaining, ok := tokenTTL(self.Data); ok && remaining > 0 {
+		if until := now.Add(remaining); until.Before(expires) {
+			expires = until
+		}
+	}
+
+	tokenCacheLock.Lock()
+	defer tokenCacheLock.Unlock()
+	tokenCache[tokenCacheKey(cluster, token)] = cachedToken{
+		cluster: cluster,
+		token:   token,
+		self:    self,
+		expires: expires,
+	}
+}
+
+// drops a token's cached lookup on a cluster, e.g. when it is renewed, revoked or logged out
+func InvalidateToken(cluster, token string) {
+	tokenCacheLock.Lock()
+	defer tokenCacheLock.Unlock()
+	delete(tokenCache, tokenCacheKey(cluster, token))
+}
+
+// the remaining ttl of a token from its lookup. A ttl of zero means it never expires
+func tokenTTL(data map[string]interface{}) (time.Duration, bool) {
+	var seconds int64
+	switch ttl := data["ttl"].(type) {
+	case json.Number:
+		n, err := ttl.Int64()
+		if err != nil {
+			return 0, false
+		}
+		seconds = n
+	case float64:
+		seconds = int64(ttl)
+	default:
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// looks up the client's own token on the cluster the client is for, through the cache
+func lookupSelfCached(cluster string, client *api.Client) (*api.Secret, error) {
+	token := client.Token()
+	if self, ok := cachedLookup(cluster, token, time.Now()); ok {
+		return self, nil
+	}
+	self, err := client.Auth().Token().LookupSelf()
+	if err != nil {
+		return nil, err
+	}
+	cacheLookup(cluster, token, self, tokenCacheTTL(), time.Now())
+	return self, nil
+}
+
+// removes expired entries, and those whose token can no longer be looked up
+func checkCachedTokens() {
+	now := time.Now()
+	tokens := []cachedToken{}
+	tokenCacheLock.Lock()
+	for key, entry := range tokenCache {
+		if !now.Before(entry.expires) {
+			delete(tokenCache, key)
+		} else {
+			tokens = append(tokens, entry)
+		}
+	}
+	tokenCacheLock.Unlock()
+
+	for _, entry := range tokens {
+		// a token can only look itself up in the namespace it was created in
+		namespace, _ := entry.self.Data["namespace_path"].(string)
+		c, err := lookupCluster(entry.cluster)
+		if err != nil {
+			InvalidateToken(entry.cluster, entry.token)
+			continue
+		}
+		client, err := newClusterClient(c, namespace, requestContext{}, nil, nil)
+		if err != nil {
+			return
+		}
+		client.SetToken(entry.token)
+		if _, err := client.Auth().Token().LookupSelf(); err != nil {
+			InvalidateToken(entry.cluster, entry.token)
+		}
+	}
+}
+
+func checkCachedTokensEvery(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		checkCachedTokens()
+	}
+}
@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTokenCache(t *testing.T) {
+	Convey("A cached token lookup", t, func(c C) {
+		now := time.Now()
+		self := &api.Secret{Data: map[string]interface{}{
+			"display_name": "token-test",
+			"ttl":          json.Number("3600"),
+		}}
+		cacheLookup("", "token-a", self, 30*time.Second, now)
+		defer InvalidateToken("", "token-a")
+
+		c.Convey("Should be returned until its ttl passes", func(c C) {
+			cached, ok := cachedLookup("", "token-a", now.Add(29*time.Second))
+			c.So(ok, ShouldBeTrue)
+			c.So(cached.Data["display_name"], ShouldEqual, "token-test")
+			_, ok = cachedLookup("", "token-a", now.Add(30*time.Second))
+			c.So(ok, ShouldBeFalse)
+		})
+
+		c.Convey("Should not be returned for other tokens", func(c C) {
+			_, ok := cachedLookup("", "token-b", now)
+			c.So(ok, ShouldBeFalse)
+		})
+
+		c.Convey("Should not be returned for the same token on another cluster", func(c C) {
+			_, ok := cachedLookup("secondary", "token-a", now)
+			c.So(ok, ShouldBeFalse)
+		})
+
+		c.Convey("Should be dropped when invalidated", func(c C) {
+			InvalidateToken("", "token-a")
+			_, ok := cachedLookup("", "token-a", now)
+			c.So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Caching a token that is about to expire", t, func(c C) {
+		now := time.Now()
+		cacheLookup("", "token-c", &api.Secret{Data: map[string]interface{}{
+			"ttl": json.Number("5"),
+		}}, 30*time.Second, now)
+		defer InvalidateToken("", "token-c")
+
+		c.Convey("Should not outlive the token", func(c C) {
+			_, ok := cachedLookup("", "token-c", now.Add(4*time.Second))
+			c.So(ok, ShouldBeTrue)
+			_, ok = cachedLookup("", "token-c", now.Add(5*time.Second))
+			c.So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("A zero cache ttl", t, func(c C) {
+		now := time.Now()
+		cacheLookup("", "token-d", &api.Secret{Data: map[string]interface{}{}}, 0, now)
+
+		c.Convey("Should disable caching", func(c C) {
+			_, ok := cachedLookup("", "token-d", now)
+			c.So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Cache ttl config", t, func(c C) {
+		c.So(parseTokenCacheTTL(""), ShouldBeNil)
+		c.So(parseTokenCacheTTL("0"), ShouldBeNil)
+		c.So(parseTokenCacheTTL("15s"), ShouldBeNil)
+		c.So(parseTokenCacheTTL("-1s"), ShouldNotBeNil)
+		c.So(parseTokenCacheTTL("soon"), ShouldNotBeNil)
+	})
+}
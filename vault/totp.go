@@ -0,0 +1,103 @@
+package vault
+
+import (
+	"errors"
+)
+
+func init() {
+	RegisterSecretEngine("totp", credentialEngine{
+		description: EngineDescription{
+			Type:        "totp",
+			Name:        "TOTP",
+			Description: "Shared time-based one-time password keys",
+		},
+		rolesPath: "keys",
+		credsPath: "code",
+	})
+}
+
+func (auth AuthInfo) ListTOTPKeys(mount string) ([]interface{}, error) {
+	return auth.ListSecret(mountPrefix(mount, "totp") + "keys")
+}
+
+// key details exclude the shared secret itself
+func (auth AuthInfo) ReadTOTPKey(mount, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty key name")
+	}
+	return auth.ReadSecret(mountPrefix(mount, "totp") + "keys/" + name)
+}
+
+// creates a key. If vault generates it, the response holds the provisioning url and a base64 png barcode
+// of it. Otherwise params carry the existing key or otpauth url being imported
+func (auth AuthInfo) CreateTOTPKey(mount, name string, params map[string]interface{}) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty key name")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Logical().Write(mountPrefix(mount, "totp")+"keys/"+name, params)
+	if err != nil {
+		return nil, err
+	}
+	// imported keys return nothing
+	if resp == nil {
+		return map[string]interface{}{}, nil
+	}
+	return resp.Data, nil
+}
+
+func (auth AuthInfo) DeleteTOTPKey(mount, name string) error {
+	if name == "" {
+		return errors.New("Empty key name")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().Delete(mountPrefix(mount, "totp") + "keys/" + name)
+	return err
+}
+
+// returns the current code of a key
+func (auth AuthInfo) GenerateTOTPCode(mount, name string) (string, error) {
+	if name == "" {
+		return "", errors.New("Empty key name")
+	}
+	data, err := auth.ReadSecret(mountPrefix(mount, "totp") + "code/" + name)
+	if err != nil {
+		return "", err
+	}
+	code, ok := data["code"].(string)
+	if !ok {
+		return "", errors.New("Could not parse code")
+	}
+	return code, nil
+}
+
+// checks a code against a key
+func (auth AuthInfo) ValidateTOTPCode(mount, name, code string) (bool, error) {
+	if name == "" || code == "" {
+		return false, errors.New("Key name and code must not be empty")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return false, err
+	}
+	resp, err := client.Logical().Write(mountPrefix(mount, "totp")+"code/"+name, map[string]interface{}{
+		"code": code,
+	})
+	if err != nil {
+		return false, err
+	}
+	if resp == nil {
+		return false, errors.New("Invalid path")
+	}
+	valid, ok := resp.Data["valid"].(bool)
+	if !ok {
+		return false, errors.New("Could not parse validation result")
+	}
+	return valid, nil
+}
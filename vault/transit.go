@@ -3,6 +3,9 @@ package vault
 import (
 	"encoding/base64"
 	"errors"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
 )
 
 // encrypt given string with userTransitKey
@@ -43,12 +46,13 @@ func (auth AuthInfo) EncryptTransit(key string, plaintext string) (string, error
 func (auth AuthInfo) DecryptTransit(key string, cipher string) (string, error) {
 	c := GetConfig()
 
-	// if no key is specified, use run-time defaults
+	// if no key is specified, use run-time defaults, and the defaults before them
+	keys := []string{key}
 	if key == "" {
-		key = c.UserTransitKey
-		if key == "" {
+		if c.UserTransitKey == "" {
 			return "", errors.New("No transit key specified")
 		}
+		keys = transitKeys(c.UserTransitKey, c.PreviousUserTransitKeys)
 	}
 
 	client, err := auth.Client()
@@ -56,24 +60,247 @@ func (auth AuthInfo) DecryptTransit(key string, cipher string) (string, error) {
 		return "", err
 	}
 
-	resp, err := client.Logical().Write(
-		c.TransitBackend + "/decrypt/" + key,
-		map[string]interface{}{
-			"ciphertext": cipher,
-		})
+	b64, err := decryptWithKeys(client, c.TransitBackend, keys, cipher)
 	if err != nil {
 		return "", err
 	}
 
-	b64, ok := resp.Data["plaintext"].(string)
+	rawbytes, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return "", err
+	}
+
+	return string(rawbytes), nil
+}
+
+// the current key followed by the comma separated keys used before it
+func transitKeys(current, previous string) []string {
+	keys := []string{current}
+	for _, key := range strings.Split(previous, ",") {
+		if key = strings.TrimSpace(key); key != "" && !containsString(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// decrypts with the first of the keys that can, returning the base64 plaintext, so that
+// what was encrypted before goldfish's keys were changed can still be decrypted
+func decryptWithKeys(client *api.Client, backend string, keys []string, ciphertext string) (string, error) {
+	var err error
+	for _, key := range keys {
+		var resp *api.Secret
+		resp, err = client.Logical().Write(backend+"/decrypt/"+key, map[string]interface{}{
+			"ciphertext": ciphertext,
+		})
+		if err != nil {
+			continue
+		}
+		b64, ok := resp.Data["plaintext"].(string)
+		if !ok {
+			return "", errors.New("Failed type assertion of response to string")
+		}
+		return b64, nil
+	}
+	return "", err
+}
+
+func (auth AuthInfo) ListTransitKeys() ([]interface{}, error) {
+	return auth.ListSecret(GetConfig().TransitBackend + "/keys")
+}
+
+// key details include its type, versions and deletion settings
+func (auth AuthInfo) ReadTransitKey(name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, errors.New("Empty key name")
+	}
+	return auth.ReadSecret(GetConfig().TransitBackend + "/keys/" + name)
+}
+
+// creates a key, with its type and options such as derived or exportable in params
+func (auth AuthInfo) CreateTransitKey(name string, params map[string]interface{}) error {
+	return auth.writeTransitKey(name, "", params)
+}
+
+// adds a new version of the key, which becomes the one used for encryption
+func (auth AuthInfo) RotateTransitKey(name string) error {
+	return auth.writeTransitKey(name, "/rotate", nil)
+}
+
+// updates settings such as min_decryption_version and deletion_allowed
+func (auth AuthInfo) ConfigTransitKey(name string, params map[string]interface{}) error {
+	if err := checkOwnTransitKey(name); err != nil {
+		return err
+	}
+	if len(params) == 0 {
+		return errors.New("No settings to update")
+	}
+	return auth.writeTransitKey(name, "/config", params)
+}
+
+// permanently removes key versions below minVersion, which can then never decrypt again
+func (auth AuthInfo) TrimTransitKey(name string, minVersion int) error {
+	if err := checkOwnTransitKey(name); err != nil {
+		return err
+	}
+	if minVersion < 1 {
+		return errors.New("Minimum available version must be positive")
+	}
+	return auth.writeTransitKey(name, "/trim", map[string]interface{}{
+		"min_available_version": minVersion,
+	})
+}
+
+// deletes the key, which vault only allows once deletion_allowed is configured
+func (auth AuthInfo) DeleteTransitKey(name string) error {
+	if name == "" {
+		return errors.New("Empty key name")
+	}
+	if err := checkOwnTransitKey(name); err != nil {
+		return err
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().Delete(GetConfig().TransitBackend + "/keys/" + name)
+	return err
+}
+
+// goldfish's own keys must never be deleted, trimmed or reconfigured through it, as that
+// could lock every session out, or let old ciphertexts of them be decrypted again
+func checkOwnTransitKey(name string) error {
+	conf := GetConfig()
+	if containsString(transitKeys(conf.ServerTransitKey, conf.PreviousServerTransitKeys), name) ||
+		containsString(transitKeys(conf.UserTransitKey, conf.PreviousUserTransitKeys), name) {
+		return errors.New("Goldfish's own transit keys can't be changed through goldfish")
+	}
+	return nil
+}
+
+func (auth AuthInfo) writeTransitKey(name, action string, params map[string]interface{}) error {
+	if name == "" {
+		return errors.New("Empty key name")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().Write(GetConfig().TransitBackend+"/keys/"+name+action, params)
+	return err
+}
+
+// signs input with an asymmetric key. algorithm (e.g. sha2-256) and params
+// such as key_version are optional
+func (auth AuthInfo) SignTransit(key, algorithm string, input []byte, params map[string]interface{}) (string, error) {
+	resp, err := auth.transitOperation("sign", key, algorithm, input, params)
+	if err != nil {
+		return "", err
+	}
+	signature, ok := resp.Data["signature"].(string)
 	if !ok {
 		return "", errors.New("Failed type assertion of response to string")
 	}
+	return signature, nil
+}
 
-	rawbytes, err := base64.StdEncoding.DecodeString(b64)
+func (auth AuthInfo) VerifyTransitSignature(key, algorithm string, input []byte, signature string) (bool, error) {
+	return auth.verifyTransit(key, algorithm, input, map[string]interface{}{
+		"signature": signature,
+	})
+}
+
+// computes an hmac of input with the key. algorithm and params such as key_version are optional
+func (auth AuthInfo) HMACTransit(key, algorithm string, input []byte, params map[string]interface{}) (string, error) {
+	resp, err := auth.transitOperation("hmac", key, algorithm, input, params)
 	if err != nil {
 		return "", err
 	}
+	hmac, ok := resp.Data["hmac"].(string)
+	if !ok {
+		return "", errors.New("Failed type assertion of response to string")
+	}
+	return hmac, nil
+}
 
-	return string(rawbytes), nil
+func (auth AuthInfo) VerifyTransitHMAC(key, algorithm string, input []byte, hmac string) (bool, error) {
+	return auth.verifyTransit(key, algorithm, input, map[string]interface{}{
+		"hmac": hmac,
+	})
+}
+
+func (auth AuthInfo) verifyTransit(key, algorithm string, input []byte, params map[string]interface{}) (bool, error) {
+	resp, err := auth.transitOperation("verify", key, algorithm, input, params)
+	if err != nil {
+		return false, err
+	}
+	valid, ok := resp.Data["valid"].(bool)
+	if !ok {
+		return false, errors.New("Failed type assertion of response to bool")
+	}
+	return valid, nil
+}
+
+func (auth AuthInfo) transitOperation(operation, key, algorithm string, input []byte, params map[string]interface{}) (*api.Secret, error) {
+	if key == "" {
+		return nil, errors.New("No transit key specified")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	// the algorithm is part of the path, so it must not be able to change it
+	if strings.ContainsAny(algorithm, "/.?#") || strings.ContainsAny(key, "/?#") {
+		return nil, errors.New("Invalid key or hash algorithm")
+	}
+	path := GetConfig().TransitBackend + "/" + operation + "/" + key
+	if algorithm != "" {
+		path += "/" + algorithm
+	}
+	data := map[string]interface{}{
+		"input": base64.StdEncoding.EncodeToString(input),
+	}
+	for k, v := range params {
+		data[k] = v
+	}
+
+	resp, err := client.Logical().Write(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Invalid path")
+	}
+	return resp, nil
+}
+
+// generates a data key for envelope encryption. keyType "plaintext" returns the key
+// and its ciphertext, "wrapped" only the ciphertext. params such as bits are optional
+func (auth AuthInfo) GenerateTransitDataKey(key, keyType string, params map[string]interface{}) (map[string]interface{}, error) {
+	if keyType != "plaintext" && keyType != "wrapped" {
+		return nil, errors.New("Data key type must be plaintext or wrapped")
+	}
+	if key == "" {
+		key = GetConfig().UserTransitKey
+		if key == "" {
+			return nil, errors.New("No transit key specified")
+		}
+	}
+	if strings.ContainsAny(key, "/?#") {
+		return nil, errors.New("Invalid key")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Logical().Write(GetConfig().TransitBackend+"/datakey/"+keyType+"/"+key, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Invalid path")
+	}
+	return resp.Data, nil
 }
@@ -0,0 +1,33 @@
+package vault
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOwnTransitKeys(t *testing.T) {
+	Convey("Goldfish's own transit keys", t, func(c C) {
+		configLock.Lock()
+		previous := config
+		config.ServerTransitKey = "goldfish"
+		config.UserTransitKey = "usertransit"
+		configLock.Unlock()
+		defer func() {
+			configLock.Lock()
+			config = previous
+			configLock.Unlock()
+		}()
+
+		c.Convey("Should not be deleted, trimmed or reconfigured", func(c C) {
+			auth := AuthInfo{}
+			c.So(auth.DeleteTransitKey("goldfish"), ShouldNotBeNil)
+			c.So(auth.TrimTransitKey("usertransit", 2), ShouldNotBeNil)
+			c.So(auth.ConfigTransitKey("goldfish", map[string]interface{}{"deletion_allowed": true}), ShouldNotBeNil)
+		})
+
+		c.Convey("Should leave other keys alone", func(c C) {
+			c.So(checkOwnTransitKey("payments"), ShouldBeNil)
+		})
+	})
+}
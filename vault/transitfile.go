@@ -0,0 +1,153 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	transitFileFormat  = "goldfish-file"
+	transitFileVersion = 1
+
+	// files are encrypted in memory, so only small ones are accepted
+	TransitFileMaxSize = 10 * 1024 * 1024
+)
+
+// the first line of an encrypted file. The rest of the file is the ciphertext,
+// sealed with a data key that only the transit key can decrypt
+type transitFileHeader struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	TransitKey string `json:"transit_key"`
+	DataKey    string `json:"datakey"`
+	Nonce      string `json:"nonce"`
+	Name       string `json:"name,omitempty"`
+}
+
+// encrypts a file with a fresh data key from the transit key
+func (auth AuthInfo) EncryptFile(key, name string, plaintext []byte) ([]byte, error) {
+	if key == "" {
+		key = GetConfig().UserTransitKey
+		if key == "" {
+			return nil, errors.New("No transit key specified")
+		}
+	}
+	datakey, err := auth.GenerateTransitDataKey(key, "plaintext", map[string]interface{}{
+		"bits": 256,
+	})
+	if err != nil {
+		return nil, err
+	}
+	wrapped, _ := datakey["ciphertext"].(string)
+	encoded, _ := datakey["plaintext"].(string)
+	dataKey, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || wrapped == "" {
+		return nil, errors.New("Failed to parse data key from vault")
+	}
+	defer zero(dataKey)
+
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return sealTransitFile(transitFileHeader{
+		Format:     transitFileFormat,
+		Version:    transitFileVersion,
+		TransitKey: key,
+		DataKey:    wrapped,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Name:       name,
+	}, dataKey, plaintext)
+}
+
+// decrypts a file produced by EncryptFile, returning its original name and content
+func (auth AuthInfo) DecryptFile(sealed []byte) (string, []byte, error) {
+	header, ciphertext, err := parseTransitFile(sealed)
+	if err != nil {
+		return "", nil, err
+	}
+	raw, err := auth.DecryptTransit(header.TransitKey, header.DataKey)
+	if err != nil {
+		return "", nil, err
+	}
+	dataKey := []byte(raw)
+	defer zero(dataKey)
+
+	plaintext, err := openTransitFile(sealed[:len(sealed)-len(ciphertext)], header, dataKey, ciphertext)
+	if err != nil {
+		return "", nil, err
+	}
+	return header.Name, plaintext, nil
+}
+
+// the header is authenticated along with the content, so it can't be swapped
+func sealTransitFile(header transitFileHeader, dataKey, plaintext []byte) ([]byte, error) {
+	raw, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	raw = append(raw, '\n')
+
+	gcm, err := fileCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(header.Nonce)
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("Invalid nonce")
+	}
+	return gcm.Seal(raw, nonce, plaintext, raw), nil
+}
+
+func parseTransitFile(sealed []byte) (*transitFileHeader, []byte, error) {
+	i := bytes.IndexByte(sealed, '\n')
+	if i < 0 {
+		return nil, nil, errors.New("Unrecognized file format")
+	}
+	header := &transitFileHeader{}
+	if err := json.Unmarshal(sealed[:i], header); err != nil {
+		return nil, nil, errors.New("Unrecognized file format")
+	}
+	if header.Format != transitFileFormat || header.Version != transitFileVersion {
+		return nil, nil, errors.New("Unrecognized file format")
+	}
+	if header.TransitKey == "" || header.DataKey == "" {
+		return nil, nil, errors.New("File is missing its data key")
+	}
+	return header, sealed[i+1:], nil
+}
+
+func openTransitFile(rawHeader []byte, header *transitFileHeader, dataKey, ciphertext []byte) ([]byte, error) {
+	gcm, err := fileCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(header.Nonce)
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("Invalid nonce")
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, rawHeader)
+	if err != nil {
+		return nil, errors.New("File has been tampered with, or was not encrypted by goldfish")
+	}
+	return plaintext, nil
+}
+
+func fileCipher(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, errors.New("Invalid data key")
+	}
+	return cipher.NewGCM(block)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,58 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTransitFile(t *testing.T) {
+	Convey("A file sealed with a data key", t, func(c C) {
+		dataKey := bytes.Repeat([]byte{7}, 32)
+		header := transitFileHeader{
+			Format:     transitFileFormat,
+			Version:    transitFileVersion,
+			TransitKey: "usertransit",
+			DataKey:    "vault:v1:wrapped",
+			Nonce:      base64.StdEncoding.EncodeToString(make([]byte, 12)),
+			Name:       "diagram.png",
+		}
+		plaintext := []byte("not really a png")
+		sealed, err := sealTransitFile(header, dataKey, plaintext)
+		c.So(err, ShouldBeNil)
+
+		c.Convey("Should open with the same data key", func(c C) {
+			parsed, ciphertext, err := parseTransitFile(sealed)
+			c.So(err, ShouldBeNil)
+			c.So(parsed.Name, ShouldEqual, "diagram.png")
+			c.So(parsed.TransitKey, ShouldEqual, "usertransit")
+			opened, err := openTransitFile(sealed[:len(sealed)-len(ciphertext)], parsed, dataKey, ciphertext)
+			c.So(err, ShouldBeNil)
+			c.So(opened, ShouldResemble, plaintext)
+		})
+
+		c.Convey("Should not open with another data key", func(c C) {
+			parsed, ciphertext, err := parseTransitFile(sealed)
+			c.So(err, ShouldBeNil)
+			_, err = openTransitFile(sealed[:len(sealed)-len(ciphertext)], parsed, bytes.Repeat([]byte{8}, 32), ciphertext)
+			c.So(err, ShouldNotBeNil)
+		})
+
+		c.Convey("Should not open if its header was altered", func(c C) {
+			altered := bytes.Replace(sealed, []byte("diagram.png"), []byte("diagram.exe"), 1)
+			parsed, ciphertext, err := parseTransitFile(altered)
+			c.So(err, ShouldBeNil)
+			_, err = openTransitFile(altered[:len(altered)-len(ciphertext)], parsed, dataKey, ciphertext)
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Files in another format", t, func(c C) {
+		_, _, err := parseTransitFile([]byte("plain text"))
+		c.So(err, ShouldNotBeNil)
+		_, _, err = parseTransitFile([]byte(`{"format":"goldfish-export","version":1}` + "\n"))
+		c.So(err, ShouldNotBeNil)
+	})
+}
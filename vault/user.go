@@ -3,14 +3,22 @@ package vault
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 
 	"github.com/hashicorp/vault/api"
 )
 
 func (auth AuthInfo) ListUsers(backend string, offset int) (interface{}, error) {
+	users, _, err := auth.ListUsersWithin(backend, offset, Budget{})
+	return users, err
+}
+
+// lists users of a backend, starting at offset, until the budget runs out
+// if the listing stopped early, the offset to continue from is returned, otherwise -1
+func (auth AuthInfo) ListUsersWithin(backend string, offset int, budget Budget) (interface{}, int, error) {
 	client, err := auth.Client()
 	if err != nil {
-		return nil, err
+		return nil, -1, err
 	}
 	logical := client.Logical()
 
@@ -19,34 +27,42 @@ func (auth AuthInfo) ListUsers(backend string, offset int) (interface{}, error)
 		// get a list of token accessors
 		resp, err := logical.List("auth/token/accessors")
 		if err != nil {
-			return nil, err
+			return nil, -1, err
 		}
 		accessors, ok := resp.Data["keys"].([]interface{})
 		if !ok {
-			return nil, errors.New("Failed to convert response")
+			return nil, -1, errors.New("Failed to convert response")
 		}
 
 		// calculate how many accessors to read, to avoid too much stress on vault server
 		limit := 300
 		if offset > len(accessors) {
-			return nil, errors.New("Offset out of bound")
+			return nil, -1, errors.New("Offset out of bound")
 		} else if offset + limit > len(accessors) {
 			limit = len(accessors) - offset
 		}
 
 		// fetch details for each accessor
-		tokens := make([]interface{}, limit)
+		tokens := make([]interface{}, 0, limit)
 		for i := 0; i < limit; i++ {
+			if budget.Exceeded() {
+				return tokens, offset + i, nil
+			}
 			resp, err := logical.Write("auth/token/lookup-accessor",
 				map[string]interface{}{
 					"accessor": accessors[i + offset],
 				})
 			// error may occur if accessor expired, simply ignore it
 			if err == nil {
-				tokens[i] = resp.Data
+				tokens = append(tokens, resp.Data)
+			} else {
+				tokens = append(tokens, nil)
 			}
 		}
-		return tokens, nil
+		if offset + limit < len(accessors) {
+			return tokens, offset + limit, nil
+		}
+		return tokens, -1, nil
 
 	case "userpass":
 		type User struct {
@@ -59,25 +75,32 @@ func (auth AuthInfo) ListUsers(backend string, offset int) (interface{}, error)
 		// get a list of usernames
 		resp, err := logical.List("auth/userpass/users")
 		if err != nil {
-			return nil, err
+			return nil, -1, err
 		}
 		usernames, ok := resp.Data["keys"].([]interface{})
 		if !ok {
-			return nil, errors.New("Failed to convert response")
+			return nil, -1, errors.New("Failed to convert response")
+		}
+		if offset > len(usernames) {
+			return nil, -1, errors.New("Offset out of bound")
 		}
 
 		// fetch each user's details
-		users := make([]User, len(usernames))
-		for i, username := range usernames {
-			users[i].Name = username.(string)
-			resp, err := logical.Read("auth/userpass/users/" + users[i].Name)
+		users := make([]User, 0, len(usernames) - offset)
+		for i, username := range usernames[offset:] {
+			if budget.Exceeded() {
+				return users, offset + i, nil
+			}
+			user := User{Name: username.(string)}
+			resp, err := logical.Read("auth/userpass/users/" + user.Name)
 			if err == nil {
 				if b, err := json.Marshal(resp.Data); err == nil {
-					json.Unmarshal(b, &users[i])
+					json.Unmarshal(b, &user)
 				}
 			}
+			users = append(users, user)
 		}
-		return users, nil
+		return users, -1, nil
 
 	case "approle":
 		type Role struct {
@@ -95,28 +118,35 @@ func (auth AuthInfo) ListUsers(backend string, offset int) (interface{}, error)
 		// get a list of roles
 		resp, err := logical.List("auth/approle/role")
 		if err != nil {
-			return nil, err
+			return nil, -1, err
 		}
 		rolenames, ok := resp.Data["keys"].([]interface{})
 		if !ok {
-			return nil, errors.New("Failed to convert response")
+			return nil, -1, errors.New("Failed to convert response")
+		}
+		if offset > len(rolenames) {
+			return nil, -1, errors.New("Offset out of bound")
 		}
 
 		// fetch each role's details
-		roles := make([]Role, len(rolenames))
-		for i, role := range rolenames {
-			roles[i].Roleid = role.(string)
-			resp, err := logical.Read("auth/approle/role/" + roles[i].Roleid)
+		roles := make([]Role, 0, len(rolenames) - offset)
+		for i, rolename := range rolenames[offset:] {
+			if budget.Exceeded() {
+				return roles, offset + i, nil
+			}
+			role := Role{Roleid: rolename.(string)}
+			resp, err := logical.Read("auth/approle/role/" + role.Roleid)
 			if err == nil {
 				if b, err := json.Marshal(resp.Data); err == nil {
-					json.Unmarshal(b, &roles[i])
+					json.Unmarshal(b, &role)
 				}
 			}
+			roles = append(roles, role)
 		}
-		return roles, nil
+		return roles, -1, nil
 
 	default:
-		return nil, errors.New("Unsupported user listing type")
+		return nil, -1, errors.New("Unsupported user listing type")
 	}
 }
 
@@ -125,8 +155,11 @@ func (auth AuthInfo) DeleteUser(backend string, deleteID string) error {
 	if err != nil {
 		return err
 	}
-	logical := client.Logical()
+	return deleteUser(client.Logical(), backend, deleteID)
+}
 
+// shared with identity requests, which delete users with goldfish's token
+func deleteUser(logical *api.Logical, backend string, deleteID string) error {
 	if deleteID == "" {
 		return errors.New("Invalid deletion ID")
 	}
@@ -185,6 +218,26 @@ func (auth AuthInfo) CreateToken(opts *api.TokenCreateRequest, wrapttl string) (
 	return client.Auth().Token().Create(opts)
 }
 
+// generates a secret_id for an approle role. If wrapttl is set, it is returned wrapped
+func (auth AuthInfo) GenerateSecretID(role string, params map[string]interface{}, wrapttl string) (*api.Secret, error) {
+	if role == "" || strings.ContainsAny(role, "/?#") {
+		return nil, errors.New("Invalid role name")
+	}
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	// if requester wants response wrapped
+	if wrapttl != "" {
+		client.SetWrappingLookupFunc(func(operation, path string) string {
+			return wrapttl
+		})
+	}
+
+	return client.Logical().Write("auth/approle/role/"+role+"/secret-id", params)
+}
+
 func (auth AuthInfo) ListRoles() (interface{}, error) {
 	client, err := auth.Client()
 	if err != nil {
@@ -218,3 +271,72 @@ func (auth AuthInfo) GetRole(rolename string) (interface{}, error) {
 	}
 	return resp.Data, nil
 }
+
+// mints a short-lived, non-renewable child token of the current session
+// intended to be handed to the vault CLI, so it is bound by both ttl and use count, and may only
+// have policies listed explicitly from those the session holds
+func (auth AuthInfo) CreateCLIToken(ttl string, uses int, policies []string) (*api.Secret, error) {
+	if len(policies) == 0 {
+		return nil, errors.New("List the policies the token needs")
+	}
+	if containsString(policies, "root") {
+		return nil, errors.New("Root tokens can't be exchanged for")
+	}
+	self, err := auth.LookupSelf()
+	if err != nil {
+		return nil, err
+	}
+	held := policiesOf(self.Data)
+	for _, policy := range policies {
+		if !held[policy] {
+			return nil, errors.New("The token can only have policies you hold, not " + policy)
+		}
+	}
+
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	renewable := false
+	return client.Auth().Token().Create(&api.TokenCreateRequest{
+		Policies:       policies,
+		TTL:            ttl,
+		ExplicitMaxTTL: ttl,
+		NumUses:        uses,
+		Renewable:      &renewable,
+		DisplayName:    "goldfish-cli",
+		Metadata: map[string]string{
+			"created_by": "goldfish",
+		},
+	})
+}
+
+// creates or updates an approle or token role with the given parameters
+func (auth AuthInfo) WriteRole(backend, rolename string, params map[string]interface{}) error {
+	client, err := auth.Client()
+	if err != nil {
+		return err
+	}
+	return writeRole(client.Logical(), backend, rolename, params)
+}
+
+// shared with identity requests, which write roles with goldfish's token
+func writeRole(logical *api.Logical, backend, rolename string, params map[string]interface{}) error {
+	if rolename == "" || strings.ContainsAny(rolename, "/?#") {
+		return errors.New("Invalid role name")
+	}
+
+	switch backend {
+	case "approle":
+		_, err := logical.Write("auth/approle/role/"+rolename, params)
+		return err
+
+	case "token":
+		_, err := logical.Write("auth/token/roles/"+rolename, params)
+		return err
+
+	default:
+		return errors.New("Unsupported role type")
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"encoding/gob"
 	"errors"
 	"log"
+	"net/http"
+	"sync"
 	"time"
 
+	"github.com/caiyeon/goldfish/metrics"
+	"github.com/caiyeon/goldfish/tracing"
 	"github.com/hashicorp/vault/api"
 )
 
@@ -13,6 +17,25 @@ type AuthInfo struct {
 	Type string `json:"Type" form:"Type" query:"Type"`
 	ID   string `json:"ID" form:"ID" query:"ID"`
 	Pass string `json:"password" form:"Password" query:"Password"`
+
+	// vault enterprise namespace the session works in, empty for the root namespace
+	Namespace string `json:"Namespace" form:"Namespace" query:"Namespace"`
+
+	// cluster the session logged in to, empty for the default cluster
+	Cluster string `json:"Cluster" form:"Cluster" query:"Cluster"`
+
+	// if set, the session is only valid for clients with this fingerprint
+	Fingerprint string `json:"-" form:"-" query:"-"`
+
+	// the goldfish request the session is serving, passed on to vault. Never stored in cookies
+	request requestContext
+}
+
+// what a goldfish request passes on to the vault requests it makes
+type requestContext struct {
+	id string
+	// the request's span, which vault requests are traced within
+	span *tracing.Span
 }
 
 var (
@@ -20,9 +43,17 @@ var (
 	VaultAddress  = ""
 	VaultSkipTLS  = false
 
-	vaultToken    = ""
-	vaultClient   *api.Client
-	errorChannel  chan error
+	// goldfish's own token, and a client using it. Both are replaced when goldfish logs in
+	// again, so they are read through ServerToken and serverVaultClient
+	vaultToken      = ""
+	vaultClient     *api.Client
+	serverTokenLock = sync.RWMutex{}
+	errorChannel    = make(chan error)
+
+	// where goldfish's runtime settings are stored, and how often they are re-read
+	runtimeConfigPath         = ""
+	runtimeConfigInterval     = time.Minute
+	runtimeConfigIntervalLock = sync.RWMutex{}
 )
 
 func init() {
@@ -31,10 +62,22 @@ func init() {
 }
 
 func NewVaultClient() (*api.Client, error) {
+	return newVaultClient("", nil, nil)
+}
+
+// a client of the default cluster
+func newVaultClient(namespace string, tenant *tenantTransport, groups *controlGroupTransport) (*api.Client, error) {
+	return newClusterClient(&cluster{address: VaultAddress, skipTLS: VaultSkipTLS}, namespace, requestContext{}, tenant, groups)
+}
+
+// requests are made in the namespace, and tagged with the goldfish request's ID and traced, if
+// given. The control group transport, then the tenant transport, wrap the client's transport if
+// given. Every round trip is timed for metrics
+func newClusterClient(c *cluster, namespace string, request requestContext, tenant *tenantTransport, groups *controlGroupTransport) (*api.Client, error) {
 	config := api.DefaultConfig()
 	err := config.ConfigureTLS(
 		&api.TLSConfig{
-			Insecure: VaultSkipTLS,
+			Insecure: c.skipTLS,
 		},
 	)
 	if err != nil {
@@ -44,30 +87,161 @@ func NewVaultClient() (*api.Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	client.SetAddress(VaultAddress)
+	// the api client expects an *http.Transport until it is constructed
+	config.HttpClient.Transport = &timedTransport{base: config.HttpClient.Transport}
+	if namespace != "" {
+		config.HttpClient.Transport = &namespaceTransport{
+			base:      config.HttpClient.Transport,
+			namespace: namespace,
+		}
+	}
+	if request.id != "" || request.span != nil {
+		config.HttpClient.Transport = &requestTransport{
+			base:    config.HttpClient.Transport,
+			request: request,
+		}
+	}
+	if groups != nil {
+		groups.base = config.HttpClient.Transport
+		config.HttpClient.Transport = groups
+	}
+	if tenant != nil {
+		tenant.base = config.HttpClient.Transport
+		config.HttpClient.Transport = tenant
+	}
+	client.SetAddress(c.address)
 	client.SetToken("")
 	return client, nil
 }
 
-func StartGoldfishWrapper(wrappingToken, login, id string) error {
+// times every round trip to vault, including those of retried requests
+type timedTransport struct {
+	base http.RoundTripper
+}
+
+func (t *timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	metrics.VaultRequestDuration.Observe(time.Since(start).Seconds(), req.Method)
+	return resp, err
+}
+
+// sends the ID of the goldfish request along, so vault's audit log can record it if vault is
+// told to, with sys/config/auditing/request-headers/x-request-id. Each round trip is a span
+// within the goldfish request's
+type requestTransport struct {
+	base    http.RoundTripper
+	request requestContext
+}
+
+func (t *requestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the request may be retried, so it is copied rather than changed
+	clone := new(http.Request)
+	*clone = *req
+	clone.Header = make(http.Header, len(req.Header)+2)
+	for k, v := range req.Header {
+		clone.Header[k] = v
+	}
+	if t.request.id != "" {
+		clone.Header.Set("X-Request-Id", t.request.id)
+	}
+	if t.request.span == nil {
+		return t.base.RoundTrip(clone)
+	}
+
+	span := t.request.span.Child("vault "+req.Method+" "+req.URL.Path, tracing.KindClient)
+	defer span.Finish()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	clone.Header.Set("Traceparent", span.Traceparent())
+	resp, err := t.base.RoundTrip(clone)
+	if err != nil {
+		span.SetError(err.Error())
+		return resp, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		span.SetError(resp.Status)
+	}
+	return resp, err
+}
+
+// if relogin is set, the unwrapped secret_id is kept to log in again once the server token
+// can't be renewed any more, which needs a secret_id that can be used more than once
+func StartGoldfishWrapper(wrappingToken, login, id string, relogin bool) error {
 	if wrappingToken == "" {
 		return errors.New("Token must be provided in non-dev mode")
 	}
+	serverLoginMount = loginMount(login)
+	secretID := ""
+	return startGoldfish(func(client *api.Client) (*api.SecretAuth, error) {
+		if secretID == "" {
+			unwrapped, err := unwrapSecretID(client, wrappingToken)
+			if err != nil {
+				return nil, err
+			}
+			secretID = unwrapped
+		}
+		return approleSecretLogin(client, login, id, secretID)
+	}, relogin)
+}
 
+// logs in for the server token, and checks that it works
+// if relogin is set, login is kept for replacing the server token once it can't be renewed
+func startGoldfish(login func(*api.Client) (*api.SecretAuth, error), relogin bool) error {
 	client, err := NewVaultClient()
 	if err != nil {
 		return err
 	}
-	vaultClient = client
 
+	auth, err := login(client)
+	if err != nil {
+		return err
+	}
+	if relogin {
+		serverLogin = login
+	}
+
+	// verify that the secret_id is valid
+	client.SetToken(auth.ClientToken)
+	setServerToken(client, auth.ClientToken)
+	if err := retryStartup("Verifying the server token", func() error {
+		_, err := client.Auth().Token().LookupSelf()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	go logErrors()
+
+	log.Println("[INFO ]: Server token accessor:", auth.Accessor)
+	return nil
+}
+
+// unwraps the secret_id in the wrapping token, and logs in to the approle with it
+func approleLogin(client *api.Client, wrappingToken, login, id string) (*api.SecretAuth, error) {
+	secretID, err := unwrapSecretID(client, wrappingToken)
+	if err != nil {
+		return nil, err
+	}
+	return approleSecretLogin(client, login, id, secretID)
+}
+
+func unwrapSecretID(client *api.Client, wrappingToken string) (string, error) {
+	// the wrapping token is single use, so each step is retried on its own
 	// make a raw unwrap call. This will use the token as a header
-	vaultClient.SetToken(wrappingToken)
-	resp, err := vaultClient.Logical().Unwrap("")
+	var resp *api.Secret
+	var err error
+	err = retryStartup("Unwrapping the secret_id", func() error {
+		client.SetToken(wrappingToken)
+		resp, err = client.Logical().Unwrap("")
+		return err
+	})
 	if err != nil {
-		return errors.New("Failed to unwrap provided token, revoke it if possible\nReason:" + err.Error())
+		return "", errors.New("Failed to unwrap provided token, revoke it if possible\nReason:" + err.Error())
 	}
 	if resp == nil {
-		return errors.New("Unwrap response from vault was nil. Please revoke token")
+		return "", errors.New("Unwrap response from vault was nil. Please revoke token")
 	}
 
 	// verify that a secret_id was wrapped
@@ -79,59 +253,168 @@ func StartGoldfishWrapper(wrappingToken, login, id string) error {
 		}
 	}
 	if err != nil {
+		return "", err
+	}
+	return secretID, nil
+}
+
+// fetch vault token with secret_id
+func approleSecretLogin(client *api.Client, login, id, secretID string) (*api.SecretAuth, error) {
+	var resp *api.Secret
+	err := retryStartup("Logging in with approle", func() error {
+		var err error
+		client.SetToken("")
+		resp, err = client.Logical().Write(login,
+			map[string]interface{}{
+				"role_id":   id,
+				"secret_id": secretID,
+			})
 		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Auth == nil {
+		return nil, errors.New("Approle login response from vault did not contain a token")
 	}
 
-	// fetch vault token with secret_id
-	resp, err = vaultClient.Logical().Write(login,
-		map[string]interface{}{
-			"role_id":   id,
-			"secret_id": secretID,
-		})
+	return resp.Auth, nil
+}
+
+// starts with the server token of a previous goldfish process, which handed over to this one
+func ResumeGoldfishWrapper(token string) error {
+	if token == "" {
+		return errors.New("No server token was handed over")
+	}
+
+	client, err := NewVaultClient()
 	if err != nil {
 		return err
 	}
+	client.SetToken(token)
+	setServerToken(client, token)
+	if err := retryStartup("Verifying the handed over server token", func() error {
+		_, err := client.Auth().Token().LookupSelf()
+		return err
+	}); err != nil {
+		return err
+	}
 
-	// verify that the secret_id is valid
-	vaultToken = resp.Auth.ClientToken
-	vaultClient.SetToken(resp.Auth.ClientToken)
-	if _, err := vaultClient.Auth().Token().LookupSelf(); err != nil {
+	go logErrors()
+	return nil
+}
+
+// the token goldfish itself uses, for handing over to an upgraded process
+func ServerToken() string {
+	serverTokenLock.RLock()
+	defer serverTokenLock.RUnlock()
+	return vaultToken
+}
+
+// the client using goldfish's own token
+func serverVaultClient() *api.Client {
+	serverTokenLock.RLock()
+	defer serverTokenLock.RUnlock()
+	return vaultClient
+}
+
+// switches goldfish over to a token, and a client using it
+func setServerToken(client *api.Client, token string) {
+	serverTokenLock.Lock()
+	defer serverTokenLock.Unlock()
+	vaultClient = client
+	vaultToken = token
+}
+
+// revokes goldfish's server tokens on every cluster, once it no longer needs them
+func RevokeServerTokens() error {
+	client, err := NewVaultClient()
+	if err != nil {
 		return err
 	}
+	client.SetToken(ServerToken())
+	if serverTokenShared {
+		return revokeClusterTokens()
+	}
+	if err := client.Auth().Token().RevokeSelf(""); err != nil {
+		return err
+	}
+	return revokeClusterTokens()
+}
 
-	// errors that are not catastrophic can be logged here
-	go func() {
-		for err := range errorChannel {
-			if err != nil {
-				log.Println("[ERROR]: ", err.Error())
-			}
+// errors that are not catastrophic can be logged here
+func logErrors() {
+	for err := range errorChannel {
+		if err != nil {
+			log.Println("[ERROR]: ", err.Error())
 		}
-	}()
-
-	log.Println("[INFO ]: Server token accessor:", resp.Auth.Accessor)
-	return nil
+	}
 }
 
 func LoadRuntimeConfig(configPath string) error {
+	runtimeConfigPath = configPath
+
 	// load config once to ensure validity
-	if err := loadConfigFromVault(configPath); err != nil {
+	if err := retryStartup("Loading runtime config", func() error {
+		return loadConfigFromVault(configPath)
+	}); err != nil {
 		return err
 	}
-	go loadConfigEvery(time.Minute, configPath)
+	go loadConfigEvery(configPath)
 	go renewServerTokenEvery(time.Hour)
+	go reportOrphanedStateEvery(24 * time.Hour)
+	go checkCachedTokensEvery(tokenRevocationCheckInterval)
+	go applyScheduledRequestsEvery(scheduledRequestsInterval)
+	go expirePolicyRequestsEvery(expiredRequestsInterval)
 	return nil
 }
 
-func loadConfigEvery(interval time.Duration, configPath string) {
+func loadConfigEvery(configPath string) {
 	for {
-		time.Sleep(interval)
+		time.Sleep(getRuntimeConfigInterval())
 		errorChannel <- loadConfigFromVault(configPath)
 	}
 }
 
+// how often the runtime config is re-read. A change applies after the next re-read
+func SetRuntimeConfigInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	runtimeConfigIntervalLock.Lock()
+	defer runtimeConfigIntervalLock.Unlock()
+	runtimeConfigInterval = interval
+}
+
+func getRuntimeConfigInterval() time.Duration {
+	runtimeConfigIntervalLock.RLock()
+	defer runtimeConfigIntervalLock.RUnlock()
+	return runtimeConfigInterval
+}
+
+// re-reads the runtime config now, rather than at the next interval
+func ReloadRuntimeConfig() error {
+	return loadConfigFromVault(runtimeConfigPath)
+}
+
+// renews the server token at half its TTL, but at least once every interval
 func renewServerTokenEvery(interval time.Duration) {
+	go renewClusterTokensEvery(interval)
+	wait := minServerTokenWait
+	for {
+		time.Sleep(wait)
+		var err error
+		wait, err = maintainServerToken(interval)
+		if err != nil {
+			metrics.TokenRenewalFailures.Inc("")
+		}
+		errorChannel <- err
+	}
+}
+
+func renewClusterTokensEvery(interval time.Duration) {
 	for {
 		time.Sleep(interval)
-		errorChannel <- renewServerToken()
+		errorChannel <- renewClusterTokens()
 	}
 }
@@ -201,6 +201,7 @@ func TestGoldfishWrapper(t *testing.T) {
 				wrappingToken,
 				"auth/approle/login",
 				"goldfish",
+				false,
 			)
 			So(err, ShouldBeNil)
 
@@ -380,22 +381,22 @@ func TestGoldfishWrapper(t *testing.T) {
 				// state checks
 				_, err = VaultHealth()
 				So(err, ShouldBeNil)
-				_, err = GenerateRootStatus()
+				_, err = GenerateRootStatus("")
 				So(err, ShouldBeNil)
 
 				// generating a new root token
 				otp := base64.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(16))
-				status, err := GenerateRootInit(otp)
+				status, err := GenerateRootInit("", otp)
 				So(err, ShouldBeNil)
 				So(status.Progress, ShouldEqual, 0)
 
 				// supplying a fake unseal token
-				status, err = GenerateRootUpdate("YWJjZGVmZ2hpamtsbW5vcHFyc3Q=", status.Nonce)
+				status, err = GenerateRootUpdate("", "YWJjZGVmZ2hpamtsbW5vcHFyc3Q=", status.Nonce)
 				So(err, ShouldBeNil)
 				So(status.Progress, ShouldEqual, 1)
 
 				// cancelling unseal process
-				So(GenerateRootCancel(), ShouldBeNil)
+				So(GenerateRootCancel(""), ShouldBeNil)
 
 				// cubbyhole operations
 				_, err = WriteToCubbyhole("testsecret", map[string]interface{}{
@@ -0,0 +1,189 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+)
+
+// an endpoint notified of policy request events. Deliveries are signed with the secret:
+// X-Goldfish-Signature is "sha256=" and the hex HMAC-SHA256 of the body
+// an empty event list subscribes to every event
+type Webhook struct {
+	Name   string   `json:"-"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// the body POSTed to webhooks. ID is unique to the delivery, so receivers can drop retries
+type WebhookPayload struct {
+	ID       string `json:"id"`
+	Event    string `json:"event"`
+	ChangeID string `json:"change_id"`
+	Policy   string `json:"policy"`
+	Actor    string `json:"actor"`
+	Detail   string `json:"detail,omitempty"`
+	Time     string `json:"time"`
+}
+
+type webhookDelivery struct {
+	webhook Webhook
+	payload WebhookPayload
+}
+
+const (
+	webhookQueueSize = 256
+	webhookAttempts  = 3
+)
+
+var (
+	webhookQueue  = make(chan webhookDelivery, webhookQueueSize)
+	webhookClient = &http.Client{Timeout: 10 * time.Second}
+	// lengthened between attempts, and shortened by tests
+	webhookRetryDelay = 2 * time.Second
+)
+
+func init() {
+	go deliverWebhooks()
+}
+
+var webhookEvents = []string{
+	RequestCreated,
+	RequestApproved,
+	RequestRejected,
+	RequestApplied,
+	RequestScheduled,
+	RequestFailed,
+	RequestExpired,
+}
+
+func parseWebhooks(raw string) (map[string]*Webhook, error) {
+	webhooks := map[string]*Webhook{}
+	if raw == "" {
+		return webhooks, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &webhooks); err != nil {
+		return nil, errors.New("Webhooks must be a JSON object of webhook names to endpoints")
+	}
+	for name, w := range webhooks {
+		if w == nil || !strings.HasPrefix(w.URL, "https://") {
+			return nil, errors.New("Webhooks: " + name + " must have an https:// url")
+		}
+		if w.Secret == "" {
+			return nil, errors.New("Webhooks: " + name + " must have a secret to sign deliveries with")
+		}
+		for _, event := range w.Events {
+			if !containsString(webhookEvents, event) {
+				return nil, errors.New("Webhooks: " + name + " events may only be " + strings.Join(webhookEvents, ", "))
+			}
+		}
+		w.Name = name
+	}
+	return webhooks, nil
+}
+
+func (w Webhook) subscribed(event string) bool {
+	return len(w.Events) == 0 || containsString(w.Events, event)
+}
+
+// queues a policy request event for every webhook subscribed to it
+// deliveries happen in the background, so a slow endpoint never holds up a request
+func notifyWebhooks(changeID, policy, event, actor, detail string) {
+	configLock.RLock()
+	hooks := webhooks
+	configLock.RUnlock()
+
+	for _, w := range hooks {
+		if !w.subscribed(event) {
+			continue
+		}
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			log.Println("[ERROR]: Could not notify webhook", w.Name+":", err.Error())
+			continue
+		}
+		delivery := webhookDelivery{
+			webhook: *w,
+			payload: WebhookPayload{
+				ID:       id,
+				Event:    event,
+				ChangeID: changeID,
+				Policy:   policy,
+				Actor:    actor,
+				Detail:   detail,
+				Time:     time.Now().UTC().Format(time.RFC3339),
+			},
+		}
+		select {
+		case webhookQueue <- delivery:
+		default:
+			log.Println("[ERROR]: Webhook queue is full, dropped", event, "event for", w.Name)
+		}
+	}
+}
+
+// the signature of a webhook body, as sent in X-Goldfish-Signature
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func deliverWebhooks() {
+	for delivery := range webhookQueue {
+		if err := deliverWebhook(delivery); err != nil {
+			log.Println("[ERROR]: Could not deliver", delivery.payload.Event,
+				"event to webhook", delivery.webhook.Name+":", err.Error())
+		}
+	}
+}
+
+// posts a delivery, retrying failed attempts with a growing delay
+func deliverWebhook(delivery webhookDelivery) error {
+	body, err := json.Marshal(delivery.payload)
+	if err != nil {
+		return err
+	}
+
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		err = postWebhook(delivery.webhook, delivery.payload.Event, body)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func postWebhook(w Webhook, event string, body []byte) error {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "goldfish")
+	req.Header.Set("X-Goldfish-Event", event)
+	req.Header.Set("X-Goldfish-Signature", WebhookSignature(w.Secret, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New("endpoint responded with " + resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package vault
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseWebhooks(t *testing.T) {
+	Convey("Valid webhooks should be parsed", t, func(c C) {
+		hooks, err := parseWebhooks(`{"tickets": {"url": "https://tickets.example.com/hook", "secret": "s3cret", "events": ["created", "applied"]}}`)
+		c.So(err, ShouldBeNil)
+		c.So(hooks["tickets"].Name, ShouldEqual, "tickets")
+		c.So(hooks["tickets"].subscribed(RequestApplied), ShouldBeTrue)
+		c.So(hooks["tickets"].subscribed(RequestApproved), ShouldBeFalse)
+	})
+
+	Convey("Webhooks without events should receive every event", t, func(c C) {
+		hooks, err := parseWebhooks(`{"all": {"url": "https://example.com", "secret": "s"}}`)
+		c.So(err, ShouldBeNil)
+		c.So(hooks["all"].subscribed(RequestExpired), ShouldBeTrue)
+	})
+
+	Convey("Insecure, unsigned or unknown subscriptions should be rejected", t, func(c C) {
+		_, err := parseWebhooks(`{"plain": {"url": "http://example.com", "secret": "s"}}`)
+		c.So(err, ShouldNotBeNil)
+		_, err = parseWebhooks(`{"unsigned": {"url": "https://example.com"}}`)
+		c.So(err, ShouldNotBeNil)
+		_, err = parseWebhooks(`{"typo": {"url": "https://example.com", "secret": "s", "events": ["approve"]}}`)
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	previousClient, previousDelay := webhookClient, webhookRetryDelay
+	defer func() {
+		webhookClient, webhookRetryDelay = previousClient, previousDelay
+	}()
+	webhookRetryDelay = time.Millisecond
+
+	attempts := 0
+	var signature string
+	var received WebhookPayload
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		signature = r.Header.Get("X-Goldfish-Signature")
+		json.Unmarshal(body, &received)
+		if signature != WebhookSignature("s3cret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	webhookClient = server.Client()
+
+	Convey("Deliveries should be signed and retried", t, func(c C) {
+		err := deliverWebhook(webhookDelivery{
+			webhook: Webhook{Name: "tickets", URL: server.URL, Secret: "s3cret"},
+			payload: WebhookPayload{ID: "1", Event: RequestApproved, ChangeID: "abc", Policy: "ops"},
+		})
+		c.So(err, ShouldBeNil)
+		c.So(attempts, ShouldEqual, 2)
+		c.So(signature, ShouldStartWith, "sha256=")
+		c.So(received.ChangeID, ShouldEqual, "abc")
+		c.So(received.Event, ShouldEqual, RequestApproved)
+	})
+}
@@ -3,6 +3,8 @@ package vault
 import (
 	"encoding/json"
 	"errors"
+
+	"github.com/hashicorp/vault/api"
 )
 
 func (auth *AuthInfo) WrapData(wrapttl string, raw string) (string, error) {
@@ -10,7 +12,7 @@ func (auth *AuthInfo) WrapData(wrapttl string, raw string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	client.SetToken(vaultToken)
+	client.SetToken(ServerToken())
 
 	// unmarshal raw string into a map
 	var data map[string]interface{}
@@ -36,7 +38,7 @@ func (auth *AuthInfo) UnwrapData(wrappingToken string) (map[string]interface{},
 	if err != nil {
 		return nil, err
 	}
-	client.SetToken(vaultToken)
+	client.SetToken(ServerToken())
 
 	// make a raw unwrap call. This will use the token as a header
 	resp, err := client.Logical().Unwrap(wrappingToken)
@@ -45,3 +47,44 @@ func (auth *AuthInfo) UnwrapData(wrappingToken string) (map[string]interface{},
 	}
 	return resp.Data, nil
 }
+
+// returns the creation time, ttl and path of a wrapping token, without consuming it
+func (auth *AuthInfo) LookupWrappingToken(wrappingToken string) (map[string]interface{}, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(ServerToken())
+
+	resp, err := client.Logical().Write("sys/wrapping/lookup", map[string]interface{}{
+		"token": wrappingToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("Failed to look up wrapping token")
+	}
+	return resp.Data, nil
+}
+
+// exchanges a wrapping token for a new one with the same contents and ttl
+// the old token is consumed, so this also tells whether it was still valid
+func (auth *AuthInfo) RewrapData(wrappingToken string) (*api.SecretWrapInfo, error) {
+	client, err := auth.Client()
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(ServerToken())
+
+	resp, err := client.Logical().Write("sys/wrapping/rewrap", map[string]interface{}{
+		"token": wrappingToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.WrapInfo == nil {
+		return nil, errors.New("Failed to rewrap token")
+	}
+	return resp.WrapInfo, nil
+}